@@ -0,0 +1,47 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package auth is the API for adding authentication schemes, e.g. exotic HMAC signatures, from external modules. A
+// transport is an http.RoundTripper that authorizes the requests and sends them with the base round tripper of its
+// configuration. It is registered by name from the init function of its package:
+//
+//	func init() {
+//		auth.Register("hmac", func(ctx context.Context, cfg auth.Config) (auth.Transport, error) {
+//			return NewHMAC(cfg.Params["key"], cfg.Base), nil
+//		})
+//	}
+//
+// Configurations then use it with `authentication: {registered: {name: hmac, params: {key: ...}}}`.
+package auth
+
+import (
+	"github.com/alpine-hodler/gidari/internal/web/auth"
+)
+
+// Transport is the interface of an authentication scheme, which authorizes the requests of the web clients.
+type Transport = auth.Transport
+
+// Refresher is implemented by the transports whose credentials can be refreshed. When a request is unauthorized, the
+// web clients call Refresh and send the request again once if it returns true.
+type Refresher = auth.Refresher
+
+// Config is the configuration of a registered transport: the URL of the web API, the params of the authentication,
+// and the round tripper that must send the authenticated requests.
+type Config = auth.Config
+
+// Factory will construct a registered transport from its configuration.
+type Factory = auth.Factory
+
+// ErrUnregisteredTransport is returned when a configuration uses a transport that is not registered.
+var ErrUnregisteredTransport = auth.ErrUnregisteredTransport
+
+// Register will add a transport that is constructed by the factory for the authentications with the name. It panics if
+// the factory is nil, or if the name is empty or already registered.
+func Register(name string, factory Factory) {
+	auth.Register(name, factory)
+}
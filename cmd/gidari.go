@@ -10,8 +10,17 @@ package main
 import (
 	"context"
 	_ "embed" // Embed external data.
+	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/alpine-hodler/gidari"
 	"github.com/alpine-hodler/gidari/version"
@@ -19,15 +28,89 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const (
+	// codegenFileMode is the file mode of generated Go files.
+	codegenFileMode = 0o644
+
+	// debugReadHeaderTimeout is the timeout to read the request headers of the debug and control servers.
+	debugReadHeaderTimeout = 5 * time.Second
+)
+
 //go:embed bash-completion.sh
 var bashCompletion string
 
-func main() {
+// options are the command line options.
+type options struct {
 	// configFilepath is the path to the configuration file.
-	var configFilepath string
+	configFilepath string
 
 	// verbose is a flag that enables verbose logging.
-	var verbose bool
+	verbose bool
+
+	// logLevels are the log levels of the subsystems of the logs, e.g. "web=warn".
+	logLevels []string
+
+	// plan is a flag that prints the estimated cost of the transport operation instead of executing it.
+	plan bool
+
+	// resume is the path to a snapshot file to resume the transport operation from.
+	resume string
+
+	// interactive is a flag that shows the progress of the transport operation in a terminal UI.
+	interactive bool
+
+	// purge is the ID of a run whose records are deleted instead of executing the transport operation.
+	purge string
+
+	// replay is a flag that upserts the archived responses instead of executing the transport operation.
+	replay bool
+
+	// checksum is a flag that prints the checksums of the tables on each storage instead of executing the transport
+	// operation.
+	checksum bool
+
+	// compare is a flag that compares the latest run with the previous runs instead of executing the transport
+	// operation.
+	compare bool
+
+	// codegen is the path of a Go file to generate with the types of the tables, instead of executing the transport
+	// operation.
+	codegen string
+
+	// codegenPackage is the package name of the generated Go file.
+	codegenPackage string
+
+	// only are the selectors of the requests to run, e.g. "tags=prices".
+	only []string
+
+	// decrypt is the path of an encrypted snapshot or dead letter file to print in plain text.
+	decrypt string
+
+	// debugAddr is the address to serve the live metrics of the transport operation on, at "/debug/vars".
+	debugAddr string
+
+	// controlAddr is the address to serve the endpoints that pause and resume the daemon on.
+	controlAddr string
+
+	// every is the interval of the transport operation in daemon mode. The operation runs once if it is zero.
+	every time.Duration
+
+	// poll will poll the endpoints with HEAD requests in daemon mode, and only run the requests that changed.
+	poll bool
+
+	// smoke is a flag that smoke tests the configuration instead of executing the transport operation, making only
+	// the first chunk and page of every request and printing the decoded samples of each table.
+	smoke bool
+
+	// smokeTimeout is the time limit of the smoke test.
+	smokeTimeout time.Duration
+
+	// strict is a flag that fails on the keys of the configuration file that are not settings, e.g. misspelled keys.
+	strict bool
+}
+
+func main() {
+	var opts options
 
 	cmd := &cobra.Command{
 		Long: "Gidari is a tool for querying web APIs and persisting resultant data onto local storage\n" +
@@ -40,11 +123,53 @@ func main() {
 		Deprecated:             "",
 		Version:                version.Gidari,
 
-		Run: func(_ *cobra.Command, args []string) { run(configFilepath, verbose, args) },
+		Run: func(_ *cobra.Command, args []string) {
+			run(&opts, args)
+		},
 	}
 
-	cmd.Flags().StringVar(&configFilepath, "config", "c", "path to configuration")
-	cmd.Flags().BoolVar(&verbose, "verbose", false, "print log data as the binary executes")
+	cmd.Flags().StringVar(&opts.configFilepath, "config", "c", "path to configuration")
+	cmd.Flags().BoolVar(&opts.verbose, "verbose", false, "print log data as the binary executes")
+	cmd.Flags().StringArrayVar(&opts.logLevels, "log-level", nil,
+		"log level of a subsystem (web, repository, planner, or auth), e.g. web=warn; repeat for each subsystem")
+	cmd.Flags().BoolVar(&opts.plan, "plan", false,
+		"print the number of requests and estimated duration of a run from the start, without making web requests")
+	cmd.Flags().StringVar(&opts.resume, "resume", "", "path to a snapshot file to resume an interrupted run from")
+	cmd.Flags().BoolVar(&opts.interactive, "tui", false, "show the progress of each request in a terminal UI")
+	cmd.Flags().StringVar(&opts.purge, "purge", "", "ID of a run whose records are deleted from every storage")
+	cmd.Flags().BoolVar(&opts.replay, "replay", false,
+		"upsert the archived responses with the current configuration, without making any web requests")
+	cmd.Flags().BoolVar(&opts.checksum, "checksum", false,
+		"print the checksum of each table on every storage, exiting with an error if they differ")
+	cmd.Flags().BoolVar(&opts.compare, "compare", false,
+		"compare the records of each table in the latest run with the previous runs, exiting with an error on drops")
+	cmd.Flags().StringVar(&opts.codegen, "codegen", "", "path of a Go file to generate with the types of the tables")
+	cmd.Flags().StringVar(&opts.codegenPackage, "package", "tables", "package name of the generated Go file")
+	cmd.Flags().StringArrayVar(&opts.only, "only", nil,
+		"only run the requests matching a selector, e.g. tags=prices or table=candles; repeat to match every selector")
+	cmd.Flags().StringVar(&opts.decrypt, "decrypt", "", "path of an encrypted snapshot or dead letter file to print")
+	cmd.Flags().StringVar(&opts.debugAddr, "debug-addr", "",
+		"address to serve live metrics on at /debug/vars; a port alone, e.g. :6060, binds to localhost")
+	cmd.Flags().StringVar(&opts.controlAddr, "control-addr", "",
+		"address to serve the pause and resume endpoints of the daemon on; a port alone binds to localhost")
+	cmd.Flags().DurationVar(&opts.every, "every", 0,
+		"run as a daemon every interval, e.g. 1h; send SIGHUP to reload the configuration for the next runs")
+	cmd.Flags().BoolVar(&opts.poll, "poll", false,
+		"with --every, poll the endpoints with HEAD requests and only run the requests whose endpoints changed")
+	cmd.Flags().BoolVar(&opts.smoke, "smoke", false,
+		"make only the first chunk and page of every request without writing to storage, and print decoded samples")
+	cmd.Flags().DurationVar(&opts.smokeTimeout, "smoke-timeout", gidari.DefaultSmokeTimeout,
+		"time limit of the smoke test; the requests that are not made in time are skipped")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false,
+		"fail on keys of the configuration file that are not settings, e.g. \"ratelimit\" instead of \"rateLimit\"")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON schema of the configuration file",
+		Run: func(_ *cobra.Command, _ []string) {
+			printSchema()
+		},
+	})
 
 	if err := cmd.MarkFlagRequired("config"); err != nil {
 		logrus.Fatalf("error marking flag as required: %v", err)
@@ -55,24 +180,425 @@ func main() {
 	}
 }
 
-func run(configFilepath string, verboseLogging bool, _ []string) {
-	file, err := os.Open(configFilepath)
+// loadConfig will load the configuration file with the command line options.
+func loadConfig(opts *options) (*gidari.Config, error) {
+	file, err := os.Open(opts.configFilepath)
 	if err != nil {
-		log.Fatalf("error opening config file  %s: %v", configFilepath, err)
+		return nil, fmt.Errorf("error opening config file %s: %w", opts.configFilepath, err)
+	}
+
+	defer file.Close()
+
+	newConfig := gidari.NewConfig
+	if opts.strict {
+		newConfig = gidari.NewStrictConfig
 	}
 
-	cfg, err := gidari.NewConfig(context.Background(), file)
+	cfg, err := newConfig(context.Background(), file)
 	if err != nil {
-		log.Fatalf("error creating new config: %v", err)
+		return nil, fmt.Errorf("error creating new config: %w", err)
 	}
 
-	if verboseLogging {
+	if opts.verbose {
 		cfg.Logger.SetOutput(os.Stdout)
 		cfg.Logger.SetLevel(logrus.InfoLevel)
 	}
 
-	err = gidari.Transport(context.Background(), cfg)
+	for _, flag := range opts.logLevels {
+		subsystem, level, ok := strings.Cut(flag, "=")
+		if _, err := logrus.ParseLevel(level); !ok || err != nil {
+			return nil, fmt.Errorf("invalid log level %q, expected subsystem=level", flag)
+		}
+
+		if cfg.LogLevels == nil {
+			cfg.LogLevels = make(map[string]string)
+		}
+
+		cfg.LogLevels[subsystem] = level
+	}
+
+	cfg.Only = append(cfg.Only, opts.only...)
+
+	if opts.resume != "" {
+		cfg.Snapshot = &gidari.Snapshot{File: opts.resume, Resume: true}
+	}
+
+	return cfg, nil
+}
+
+func run(opts *options, _ []string) {
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.plan {
+		printPlan(cfg)
+
+		return
+	}
+
+	if opts.smoke {
+		smokeTest(cfg, opts.smokeTimeout)
+
+		return
+	}
+
+	if opts.purge != "" {
+		purgeRun(cfg, opts.purge)
+
+		return
+	}
+
+	if opts.replay {
+		replayArchive(cfg)
+
+		return
+	}
+
+	if opts.checksum {
+		printChecksums(cfg)
+
+		return
+	}
+
+	if opts.compare {
+		compareRuns(cfg)
+
+		return
+	}
+
+	if opts.codegen != "" {
+		generate(cfg, opts.codegen, opts.codegenPackage)
+
+		return
+	}
+
+	if opts.decrypt != "" {
+		plaintext, err := gidari.Decrypt(cfg, opts.decrypt)
+		if err != nil {
+			log.Fatalf("failed to decrypt state file: %v", err)
+		}
+
+		fmt.Print(string(plaintext))
+
+		return
+	}
+
+	// The terminal UI replaces the log output, which would otherwise be drawn over.
+	if opts.interactive {
+		cfg.Logger.SetOutput(io.Discard)
+
+		ui := newTUI(os.Stdout)
+		cfg.Progress = ui.handle
+
+		go ui.run()
+		defer ui.close()
+	}
+
+	if opts.debugAddr != "" {
+		go serve("debug", opts.debugAddr, http.DefaultServeMux)
+	}
+
+	// Cancel the operation on an interrupt, so that a snapshot of the incomplete requests can be written.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if opts.every > 0 {
+		runDaemon(ctx, opts, cfg.Progress)
+
+		return
+	}
+
+	result, err := gidari.Transport(ctx, cfg)
 	if err != nil {
 		log.Fatalf("failed to transport data: %v", err)
 	}
+
+	if cfg.Lineage != nil && !opts.interactive {
+		fmt.Printf("run ID: %s\n", result.RunID)
+	}
+}
+
+// runDaemon will run the transport operation every interval until the context is canceled, reloading the configuration
+// file for the next runs on SIGHUP. The progress callback is set on every configuration.
+func runDaemon(ctx context.Context, opts *options, progress func(*gidari.ProgressEvent)) {
+	daemon, err := gidari.NewDaemon(opts.every, func() (*gidari.Config, error) {
+		cfg, err := loadConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Progress = progress
+
+		return cfg, nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	defer signal.Stop(hangup)
+
+	go func() {
+		for range hangup {
+			// The run in flight finishes with the configuration it started with.
+			if err := daemon.Reload(); err != nil {
+				log.Printf("keeping the current configuration: %v", err)
+			}
+		}
+	}()
+
+	stopControl := controlPause(daemon, opts.controlAddr)
+	defer stopControl()
+
+	handle := func(result *gidari.UpsertResult, err error) {
+		switch {
+		case err != nil:
+			log.Printf("failed to transport data: %v", err)
+		case daemon.Config().Lineage != nil && !opts.interactive:
+			fmt.Printf("run ID: %s\n", result.RunID)
+		}
+	}
+
+	if opts.poll {
+		daemon.Poll(ctx, handle)
+
+		return
+	}
+
+	daemon.Run(ctx, handle)
+}
+
+// controlPause will pause the daemon on SIGUSR1 and resume it on SIGUSR2, and serve the control endpoints on the
+// address if it is not empty. It returns a function that stops the signals.
+func controlPause(daemon *gidari.Daemon, addr string) func() {
+	signals := make(chan os.Signal, 1)
+	for sig := range pauseSignals {
+		signal.Notify(signals, sig)
+	}
+
+	go func() {
+		for sig := range signals {
+			if pauseSignals[sig] {
+				daemon.Pause()
+			} else {
+				daemon.Resume()
+			}
+		}
+	}()
+
+	if addr != "" {
+		go serve("control", addr, controlMux(daemon))
+	}
+
+	return func() { signal.Stop(signals) }
+}
+
+// controlMux will return the mux of the control endpoints, "/control/pause" and "/control/resume", which only accept
+// POST requests. The endpoints are served on a mux of their own, apart from the metrics and profiles of the debug
+// server on the default serve mux.
+func controlMux(daemon *gidari.Daemon) *http.ServeMux {
+	control := func(toggle func() bool, state, conflict string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+
+				return
+			}
+
+			if !toggle() {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprintln(w, conflict)
+
+				return
+			}
+
+			fmt.Fprintln(w, state)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/control/pause", control(daemon.Pause, "paused", "already paused"))
+	mux.HandleFunc("/control/resume", control(daemon.Resume, "resumed", "not paused"))
+
+	return mux
+}
+
+// printPlan will print the estimated cost of the transport operation.
+func printPlan(cfg *gidari.Config) {
+	plan, err := gidari.Estimate(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("failed to estimate transport: %v", err)
+	}
+
+	tables := make([]string, 0, len(plan.Tables))
+	for table := range plan.Tables {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		fmt.Printf("%s: %d requests\n", table, plan.Tables[table])
+	}
+
+	fmt.Printf("total: %d requests, estimated duration: %v\n", plan.Requests, plan.EstimatedDuration)
+}
+
+// smokeTest will smoke test the configuration and print the result of every request and the decoded samples of each
+// table, exiting with an error if a request failed.
+func smokeTest(cfg *gidari.Config, timeout time.Duration) {
+	result, err := gidari.Smoke(context.Background(), cfg, timeout)
+	if err != nil {
+		log.Fatalf("failed to smoke test config: %v", err)
+	}
+
+	for _, req := range result.Requests {
+		switch {
+		case req.Err != nil:
+			fmt.Printf("FAIL %s (%s): %v\n", req.Endpoint, req.Table, req.Err)
+		case req.Skipped != "":
+			fmt.Printf("SKIP %s (%s): %s\n", req.Endpoint, req.Table, req.Skipped)
+		default:
+			fmt.Printf("ok   %s (%s): %d records in %v\n", req.Endpoint, req.Table, req.Records,
+				req.Duration.Round(time.Millisecond))
+		}
+	}
+
+	tables := make([]string, 0, len(result.Tables))
+	for table := range result.Tables {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		fmt.Printf("\n%s: %d records\n", table, result.Tables[table].Records)
+
+		for _, sample := range result.Tables[table].Samples {
+			fmt.Printf("  %s\n", sample)
+		}
+	}
+
+	fmt.Printf("\nsmoke test took %v\n", result.Duration.Round(time.Millisecond))
+
+	if err := result.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// purgeRun will delete the records of the run and print the number of records deleted from each table.
+func purgeRun(cfg *gidari.Config, runID string) {
+	result, err := gidari.Purge(context.Background(), cfg, runID)
+	if err != nil {
+		log.Fatalf("failed to purge run: %v", err)
+	}
+
+	tables := make([]string, 0, len(result.Tables))
+	for table := range result.Tables {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		fmt.Printf("%s: %d records deleted\n", table, result.Tables[table])
+	}
+}
+
+// replayArchive will upsert the archived responses and print the number of records upserted.
+func replayArchive(cfg *gidari.Config) {
+	result, err := gidari.Replay(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("failed to replay archive: %v", err)
+	}
+
+	fmt.Printf("replayed run %s: %d records upserted, %d matched\n", result.RunID, result.UpsertedCount(),
+		result.MatchedCount())
+}
+
+// printChecksums will print the checksum of each table on every storage, and exit with an error if the checksums of a
+// table differ between storages.
+func printChecksums(cfg *gidari.Config) {
+	result, err := gidari.Checksum(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("failed to compute checksums: %v", err)
+	}
+
+	for _, stg := range result.Storages {
+		tables := make([]string, 0, len(stg.Tables))
+		for table := range stg.Tables {
+			tables = append(tables, table)
+		}
+
+		sort.Strings(tables)
+
+		for _, table := range tables {
+			sum := stg.Tables[table]
+			fmt.Printf("%s %s: %d records, checksum %s\n", stg.Scheme, table, sum.Records, sum.Checksum)
+		}
+	}
+
+	if mismatches := result.Mismatches(); len(mismatches) > 0 {
+		log.Fatalf("checksums differ between storages for tables: %s", strings.Join(mismatches, ", "))
+	}
+}
+
+// compareRuns will print the records of each table in the latest run and the median of the previous runs, and exit
+// with an error if the records of a table dropped anomalously.
+func compareRuns(cfg *gidari.Config) {
+	comparison, err := gidari.Compare(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("failed to compare runs: %v", err)
+	}
+
+	fmt.Printf("run %s compared with %d previous runs\n", comparison.RunID, len(comparison.PreviousRuns))
+
+	for _, table := range comparison.Tables {
+		fmt.Printf("%s: %d records, median %.0f (%+.1f%%)\n", table.Table, table.Records, table.Baseline,
+			table.Change*100)
+	}
+
+	if anomalies := comparison.Anomalies(); len(anomalies) > 0 {
+		log.Fatalf("records dropped anomalously for tables: %s", strings.Join(anomalies, ", "))
+	}
+}
+
+// printSchema will print the JSON schema of the configuration file.
+func printSchema() {
+	schema, err := gidari.ConfigSchema()
+	if err != nil {
+		log.Fatalf("failed to generate config schema: %v", err)
+	}
+
+	fmt.Println(string(schema))
+}
+
+// generate will write a Go file with the types of the records of each table.
+func generate(cfg *gidari.Config, path, pkg string) {
+	src, err := gidari.Generate(context.Background(), cfg, pkg)
+	if err != nil {
+		log.Fatalf("failed to generate code: %v", err)
+	}
+
+	if err := os.WriteFile(path, src, codegenFileMode); err != nil {
+		log.Fatalf("failed to write generated code: %v", err)
+	}
+}
+
+// serve will serve the handler on the address, e.g. the live metrics of the transport operation, which are published
+// with expvar on the default serve mux. Addresses without a host are bound to localhost rather than every interface,
+// since the servers have no authentication.
+func serve(name, addr string, handler http.Handler) {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: debugReadHeaderTimeout}
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("%s server stopped: %v", name, err)
+	}
 }
@@ -0,0 +1,19 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignals are the signals that pause and resume the daemon.
+var pauseSignals = map[os.Signal]bool{syscall.SIGUSR1: true, syscall.SIGUSR2: false}
@@ -0,0 +1,201 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari"
+)
+
+const (
+	// tuiRefreshInterval is the interval between redraws of the terminal UI.
+	tuiRefreshInterval = 200 * time.Millisecond
+
+	// tuiBarWidth is the number of characters in a progress bar.
+	tuiBarWidth = 24
+)
+
+// tuiRow is the progress of the requests and records of a table.
+type tuiRow struct {
+	table     string
+	planned   int
+	completed int
+	failed    int
+	records   int64
+	errors    int64
+}
+
+// tui is a terminal UI that shows the progress of a transport operation, driven by its progress events. The UI is
+// redrawn in place using ANSI escape codes.
+type tui struct {
+	mutex sync.Mutex
+	out   io.Writer
+	start time.Time
+
+	rows   map[string]*tuiRow
+	tables []string
+
+	webQueue        int
+	repositoryQueue int
+	lastErr         error
+
+	// lines is the number of lines of the last draw, which are overwritten by the next draw.
+	lines int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newTUI(out io.Writer) *tui {
+	return &tui{
+		out:   out,
+		start: time.Now(),
+		rows:  make(map[string]*tuiRow),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// row will return the row of the table, adding it if it does not exist.
+func (ui *tui) row(table string) *tuiRow {
+	row, ok := ui.rows[table]
+	if !ok {
+		row = &tuiRow{table: table}
+		ui.rows[table] = row
+		ui.tables = append(ui.tables, table)
+	}
+
+	return row
+}
+
+// handle will update the UI with a progress event. It is used as the progress callback of the configuration.
+func (ui *tui) handle(event *gidari.ProgressEvent) {
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	row := ui.row(event.Table)
+
+	switch event.Type {
+	case gidari.ProgressPlanned:
+		row.planned += event.Requests
+	case gidari.ProgressRequestCompleted:
+		row.completed++
+		ui.webQueue = event.WebQueue
+		ui.repositoryQueue = event.RepositoryQueue
+	case gidari.ProgressRequestFailed:
+		row.failed++
+		ui.lastErr = event.Err
+	case gidari.ProgressUpserted:
+		row.records += event.Records
+		row.errors += event.RecordErrors
+		ui.repositoryQueue = event.RepositoryQueue
+	}
+}
+
+// run will redraw the UI until it is closed.
+func (ui *tui) run() {
+	defer close(ui.done)
+
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ui.stop:
+			ui.draw()
+
+			return
+		case <-ticker.C:
+			ui.draw()
+		}
+	}
+}
+
+// close will stop redrawing the UI after a final draw.
+func (ui *tui) close() {
+	close(ui.stop)
+	<-ui.done
+}
+
+// bar will return a progress bar for the number of completed requests out of the planned requests.
+func bar(completed, planned int) string {
+	if planned == 0 {
+		return strings.Repeat(" ", tuiBarWidth+2)
+	}
+
+	filled := tuiBarWidth * completed / planned
+	if filled > tuiBarWidth {
+		filled = tuiBarWidth
+	}
+
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", tuiBarWidth-filled) + "]"
+}
+
+// draw will overwrite the last draw of the UI with the current progress.
+func (ui *tui) draw() {
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	elapsed := time.Since(ui.start)
+	seconds := elapsed.Seconds()
+
+	var buf bytes.Buffer
+
+	// Move the cursor to the start of the last draw.
+	if ui.lines > 0 {
+		fmt.Fprintf(&buf, "\x1b[%dF", ui.lines)
+	}
+
+	lines := make([]string, 0, len(ui.tables)+2)
+
+	width := 0
+	for _, table := range ui.tables {
+		if len(table) > width {
+			width = len(table)
+		}
+	}
+
+	for _, table := range ui.tables {
+		row := ui.rows[table]
+		lines = append(lines, fmt.Sprintf("%-*s %s %6d/%-6d %8.1f req/s %10d rec %10.1f rec/s %6d err %4d failed",
+			width, table, bar(row.completed, row.planned), row.completed, row.planned,
+			float64(row.completed)/seconds, row.records, float64(row.records)/seconds, row.errors, row.failed))
+	}
+
+	lines = append(lines, fmt.Sprintf("queues: web %d, repository %d    elapsed %v", ui.webQueue,
+		ui.repositoryQueue, elapsed.Round(time.Second)))
+
+	if ui.lastErr != nil {
+		lines = append(lines, fmt.Sprintf("last error: %v", ui.lastErr))
+	}
+
+	for _, line := range lines {
+		// Clear the line before writing it, since the last draw may have been longer.
+		fmt.Fprintf(&buf, "\x1b[2K%s\n", line)
+	}
+
+	// Clear the lines of the last draw that are not overwritten.
+	for extra := len(lines); extra < ui.lines; extra++ {
+		buf.WriteString("\x1b[2K\n")
+	}
+
+	if len(lines) > ui.lines {
+		ui.lines = len(lines)
+	}
+
+	if _, err := ui.out.Write(buf.Bytes()); err != nil {
+		log.Printf("unable to draw terminal UI: %v", err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/alpine-hodler/gidari/internal/transport"
 )
@@ -21,7 +22,239 @@ type Config struct {
 	transport.Config
 }
 
+// UpsertResult is the aggregate result of a Transport operation, containing the number of records upserted and
+// matched for each table.
+type UpsertResult = transport.UpsertResult
+
+// Timings is the time that the workers of a Transport operation spent on the rate limiter, network, and storage.
+type Timings = transport.Timings
+
+// Plan is the estimated cost of a Transport operation.
+type Plan = transport.Plan
+
+// SmokeResult is the result of a smoke test of a configuration, with the decoded samples of each table.
+type SmokeResult = transport.SmokeResult
+
+// SmokeRequest is the result of smoke testing a request of a configuration.
+type SmokeRequest = transport.SmokeRequest
+
+// SmokeTable is the number of records and the decoded samples of a table in a smoke test.
+type SmokeTable = transport.SmokeTable
+
+// ErrSmokeTestFailed is returned by SmokeResult.Err when a request of the smoke test failed.
+var ErrSmokeTestFailed = transport.ErrSmokeTestFailed
+
+// DefaultSmokeTimeout is the time limit of a smoke test if none is given.
+const DefaultSmokeTimeout = transport.DefaultSmokeTimeout
+
+// Snapshot is the configuration for writing and resuming from a snapshot of the incomplete requests of a Transport
+// operation.
+type Snapshot = transport.Snapshot
+
+// Schema is the definition of a table, used to validate records and optionally create the table.
+type Schema = transport.Schema
+
+// Partition splits the records of a table with a schema by the period of a timestamp field.
+type Partition = transport.Partition
+
+// QuietWindow is a recurring time window during which the requests of a Transport operation are paused or made at a
+// reduced rate.
+type QuietWindow = transport.QuietWindow
+
+// Route restricts the tables that a Transport operation writes to a storage.
+type Route = transport.Route
+
+// Normalizer converts messy string fields of the records of a request into numbers before they are upserted.
+type Normalizer = transport.Normalizer
+
+// Lineage stamps every record upserted by a Transport operation with the ID of the run.
+type Lineage = transport.Lineage
+
+// Audit logs the upserts of a Transport operation that overwrite existing records into an audit table.
+type Audit = transport.Audit
+
+// RunStats persists the number of records of every table of a run, so that runs can be compared with Compare.
+type RunStats = transport.RunStats
+
+// Checkpoints stores the snapshot and cache of a Transport operation on a durable store instead of the local
+// filesystem.
+type Checkpoints = transport.Checkpoints
+
+// CheckpointStore stores the checkpoints of the runs of a Transport operation, e.g. in a store of a program using the
+// library.
+type CheckpointStore = transport.CheckpointStore
+
+// ErrCheckpointNotFound is returned by a CheckpointStore when it does not have a checkpoint with the key.
+var ErrCheckpointNotFound = transport.ErrCheckpointNotFound
+
+// StateEncryption encrypts the snapshot and dead letter files of a Transport operation at rest.
+type StateEncryption = transport.StateEncryption
+
+// Retry is the policy for retrying the failed web requests of a Transport operation.
+type Retry = transport.Retry
+
+// Daemon runs the Transport operation of a configuration on an interval, reloading the configuration for the runs that
+// start after a reload.
+type Daemon = transport.Daemon
+
+// UpsertOption is an option of a Transport operation, e.g. WithWebWorkers.
+type UpsertOption = transport.UpsertOption
+
+// Pause pauses and resumes the web requests of Transport operations, e.g. to yield the quota of the web API to other
+// systems temporarily.
+type Pause = transport.Pause
+
+// Archive stores the raw body of every response of a Transport operation, so that the responses can be replayed.
+type Archive = transport.Archive
+
+// Cache sends the conditional requests of a Transport operation, skipping the requests whose responses are not
+// modified since the previous run.
+type Cache = transport.Cache
+
+// RunLock prevents two processes from running the Transport operation of a configuration at the same time.
+type RunLock = transport.RunLock
+
+// ErrRunLocked is returned by a Transport operation when another process holds the run lock of the configuration.
+var ErrRunLocked = transport.ErrRunLocked
+
+// Proxy is the proxy that the requests of a Transport operation are sent through.
+type Proxy = transport.Proxy
+
+// CacheMode is how a request uses the cache of a Transport operation.
+type CacheMode = transport.CacheMode
+
+// The cache modes of a request.
+const (
+	CacheModePrefer  = transport.CacheModePrefer
+	CacheModeNever   = transport.CacheModeNever
+	CacheModeRefresh = transport.CacheModeRefresh
+)
+
+// Offload routes the oversized records of a Transport operation to an object store.
+type Offload = transport.Offload
+
+// ObjectStore stores the payloads of the offloaded records, e.g. a bucket of an object storage service.
+type ObjectStore = transport.ObjectStore
+
+// TLS is the TLS configuration of the requests of a Transport operation, e.g. for mutual TLS.
+type TLS = transport.TLS
+
+// Maintenance pauses the requests of a Transport operation during the maintenance windows of the web API and backs
+// off on 503 responses.
+type Maintenance = transport.Maintenance
+
+// MaintenanceWindow is an announced window of downtime of the web API.
+type MaintenanceWindow = transport.MaintenanceWindow
+
+// Downsample upserts the aggregates of the candles of a timeseries at coarser granularities into companion tables.
+type Downsample = transport.Downsample
+
+// Bisect splits the timeseries chunks that time out into smaller ranges, instead of failing the request.
+type Bisect = transport.Bisect
+
+// Foreach fans a request of a Transport operation out into a request for every value of a table that it upserts.
+type Foreach = transport.Foreach
+
+// Vault resolves the credentials of the web API from a secret in HashiCorp Vault.
+type Vault = transport.Vault
+
+// Autoscale adjusts the number of web workers of a Transport operation while it runs.
+type Autoscale = transport.Autoscale
+
+// Universe is a named list of instruments of a web API, e.g. the products of an exchange, that the requests of a
+// Transport operation iterate over.
+type Universe = transport.Universe
+
+// Compression gzips the large request bodies of a Transport operation and negotiates compressed responses.
+type Compression = transport.Compression
+
+// Limits are the guardrails of the size and number of records of the responses of a request.
+type Limits = transport.Limits
+
+// The actions of a response that exceeds its limits.
+const (
+	LimitActionWarn     = transport.LimitActionWarn
+	LimitActionTruncate = transport.LimitActionTruncate
+	LimitActionFail     = transport.LimitActionFail
+)
+
+// ErrorMode is how a Transport operation handles the requests that fail.
+type ErrorMode = transport.ErrorMode
+
+// The error modes of a Transport operation.
+const (
+	ErrorModeFirst   = transport.ErrorModeFirst
+	ErrorModeCollect = transport.ErrorModeCollect
+)
+
+// RequestError is the error of a request that failed during a Transport operation.
+type RequestError = transport.RequestError
+
+// RequestErrors are the errors of the requests that failed during a Transport operation with the "collect" error mode.
+type RequestErrors = transport.RequestErrors
+
+// PurgeResult is the result of a Purge operation.
+type PurgeResult = transport.PurgeResult
+
+// ChecksumResult is the result of a Checksum operation.
+type ChecksumResult = transport.ChecksumResult
+
+// StorageChecksum are the checksums of the tables of a storage.
+type StorageChecksum = transport.StorageChecksum
+
+// TableChecksum is the checksum of the records of a table on a storage.
+type TableChecksum = transport.TableChecksum
+
+// RunComparison is the result of a Compare operation.
+type RunComparison = transport.RunComparison
+
+// TableComparison compares the records of a table in the latest run with the previous runs.
+type TableComparison = transport.TableComparison
+
+// Webhook verifies the signature, timestamp, and event ID of webhook deliveries, so that forged and replayed deliveries
+// are not handled. Use "Guard" to wrap the handler of the deliveries.
+type Webhook = transport.Webhook
+
+// ProgressEvent is an event on the progress of a Transport operation, sent to the "Progress" callback of the
+// configuration.
+type ProgressEvent = transport.ProgressEvent
+
+// The types of progress events.
+const (
+	ProgressPlanned          = transport.ProgressPlanned
+	ProgressRequestCompleted = transport.ProgressRequestCompleted
+	ProgressRequestFailed    = transport.ProgressRequestFailed
+	ProgressUpserted         = transport.ProgressUpserted
+	ProgressLimitExceeded    = transport.ProgressLimitExceeded
+	ProgressNotModified      = transport.ProgressNotModified
+)
+
 func NewConfig(ctx context.Context, file *os.File) (*Config, error) {
+	return newConfig(file, transport.NewConfig)
+}
+
+// NewStrictConfig is like NewConfig, but returns an error wrapping ErrUnknownConfigKey if the configuration file has
+// keys that are not settings, e.g. a misspelled "ratelimit" instead of "rateLimit", which NewConfig ignores.
+func NewStrictConfig(ctx context.Context, file *os.File) (*Config, error) {
+	return newConfig(file, transport.NewStrictConfig)
+}
+
+// ErrUnknownConfigKey is returned by NewStrictConfig when the configuration file has a key that is not a setting.
+var ErrUnknownConfigKey = transport.ErrUnknownConfigKey
+
+// ConfigSchema will return the JSON schema of the configuration file, e.g. for the completion and validation of
+// configuration files in editors.
+func ConfigSchema() ([]byte, error) {
+	schema, err := transport.ConfigSchema()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate config schema: %w", err)
+	}
+
+	return schema, nil
+}
+
+// newConfig will read the configuration file and decode it with the decode function.
+func newConfig(file *os.File, decode func([]byte) (*transport.Config, error)) (*Config, error) {
 	info, err := file.Stat()
 	if err != nil {
 		return nil, fmt.Errorf("unable to get file stat for reading: %w", err)
@@ -34,7 +267,7 @@ func NewConfig(ctx context.Context, file *os.File) (*Config, error) {
 		return nil, fmt.Errorf("unable to read file: %w", err)
 	}
 
-	cfg, err := transport.NewConfig(bytes)
+	cfg, err := decode(bytes)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create new config: %w", err)
 	}
@@ -46,20 +279,157 @@ func NewConfig(ctx context.Context, file *os.File) (*Config, error) {
 }
 
 // TransportFile will construct the transport operation using a configuration YAML file.
-func TransportFile(ctx context.Context, file *os.File) error {
+func TransportFile(ctx context.Context, file *os.File) (*UpsertResult, error) {
 	cfg, err := NewConfig(ctx, file)
 	if err != nil {
-		return fmt.Errorf("unable to create new config: %w", err)
+		return nil, fmt.Errorf("unable to create new config: %w", err)
 	}
 
 	return Transport(ctx, cfg)
 }
 
-// Transport will construct the transport operation using a "transport.Config" object.
-func Transport(ctx context.Context, cfg *Config) error {
-	if err := transport.Upsert(ctx, &cfg.Config); err != nil {
-		return fmt.Errorf("unable to upsert the config: %w", err)
+// Transport will construct the transport operation using a "transport.Config" object. The options take precedence
+// over the configuration.
+func Transport(ctx context.Context, cfg *Config, opts ...UpsertOption) (*UpsertResult, error) {
+	result, err := transport.Upsert(ctx, &cfg.Config, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to upsert the config: %w", err)
+	}
+
+	return result, nil
+}
+
+// WithWebWorkers will set the number of workers that make the web requests of a Transport operation.
+func WithWebWorkers(workers int) UpsertOption {
+	return transport.WithWebWorkers(workers)
+}
+
+// WithStorageWorkers will set the number of workers that send the records of a Transport operation to the storage.
+func WithStorageWorkers(workers int) UpsertOption {
+	return transport.WithStorageWorkers(workers)
+}
+
+// WithDecodeWorkers will set the number of workers that decode the response bodies of a Transport operation.
+func WithDecodeWorkers(workers int) UpsertOption {
+	return transport.WithDecodeWorkers(workers)
+}
+
+// WithPause will hold the web requests of a Transport operation while the pause is paused.
+func WithPause(pause *Pause) UpsertOption {
+	return transport.WithPause(pause)
+}
+
+// NewPause will return a Pause that is not paused.
+func NewPause() *Pause {
+	return transport.NewPause()
+}
+
+// NewDaemon will return a daemon that runs the Transport operation every interval with the configuration returned by
+// load, which is called again on every reload of the daemon.
+func NewDaemon(interval time.Duration, load func() (*Config, error)) (*Daemon, error) {
+	daemon, err := transport.NewDaemon(interval, func() (*transport.Config, error) {
+		cfg, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		return &cfg.Config, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create daemon: %w", err)
+	}
+
+	return daemon, nil
+}
+
+// Estimate will plan the transport operation without making any web requests, returning the number of requests it
+// will make and its estimated duration given the rate limits. The secrets of the authentication are not resolved and
+// a snapshot is not resumed, so the plan is of a run from the start.
+func Estimate(ctx context.Context, cfg *Config) (*Plan, error) {
+	plan, err := transport.Estimate(ctx, &cfg.Config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to estimate the config: %w", err)
+	}
+
+	return plan, nil
+}
+
+// Smoke will test the configuration by making only the first chunk and page of every request, without writing to the
+// storage, and return the decoded records of each table. Requests that are not made before the timeout are skipped;
+// the timeout is DefaultSmokeTimeout if it is zero.
+func Smoke(ctx context.Context, cfg *Config, timeout time.Duration) (*SmokeResult, error) {
+	result, err := transport.Smoke(ctx, &cfg.Config, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to smoke test the config: %w", err)
+	}
+
+	return result, nil
+}
+
+// Purge will delete the records written by a run from the tables of the configuration in every storage. The
+// configuration must have lineage, and the run ID is the one on the result of the Transport operation.
+func Purge(ctx context.Context, cfg *Config, runID string) (*PurgeResult, error) {
+	result, err := transport.Purge(ctx, &cfg.Config, runID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to purge the run: %w", err)
+	}
+
+	return result, nil
+}
+
+// Checksum will compute a deterministic checksum of the records of each table on every storage that the table is
+// routed to, e.g. to verify that the storages of a dual-write hold identical data. The tables are the tables of the
+// requests of the configuration, if none are given.
+func Checksum(ctx context.Context, cfg *Config, tables ...string) (*ChecksumResult, error) {
+	result, err := transport.Checksum(ctx, &cfg.Config, tables...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute checksums: %w", err)
+	}
+
+	return result, nil
+}
+
+// Compare will compare the records of every table of the latest run with the previous runs, flagging the tables whose
+// records dropped anomalously, e.g. because of a silent change of the web API. The configuration must have run stats.
+func Compare(ctx context.Context, cfg *Config) (*RunComparison, error) {
+	comparison, err := transport.Compare(ctx, &cfg.Config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compare the runs: %w", err)
+	}
+
+	return comparison, nil
+}
+
+// Replay will upsert the responses in the archive of the configuration without making any web requests, decoding and
+// transforming them with the current settings of their requests, e.g. after a schema or normalizer change.
+func Replay(ctx context.Context, cfg *Config) (*UpsertResult, error) {
+	result, err := transport.Replay(ctx, &cfg.Config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to replay the archive: %w", err)
+	}
+
+	return result, nil
+}
+
+// Generate will return the Go source of a package with a struct for the records of each table of the configuration.
+// The fields of tables with a schema are derived from its columns, and the fields of other tables are inferred from a
+// sampled response of the web API.
+func Generate(ctx context.Context, cfg *Config, pkg string) ([]byte, error) {
+	src, err := transport.Generate(ctx, &cfg.Config, pkg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate code for the config: %w", err)
+	}
+
+	return src, nil
+}
+
+// Decrypt will return the plain text of a snapshot or dead letter file that is encrypted with the state encryption of
+// the configuration.
+func Decrypt(cfg *Config, path string) ([]byte, error) {
+	plaintext, err := transport.Decrypt(&cfg.Config, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the state file: %w", err)
 	}
 
-	return nil
+	return plaintext, nil
 }
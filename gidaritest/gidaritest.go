@@ -0,0 +1,311 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package gidaritest is a harness for end-to-end tests of gidari configurations. It starts MongoDB and PostgreSQL
+// containers with Docker, serves the responses of a web API from fixtures, and runs a full Transport operation of a
+// configuration against them, so that configurations and custom encoders can be tested against real backends in CI:
+//
+//	func TestConfig(t *testing.T) {
+//		server := gidaritest.Serve(t, gidaritest.Fixtures{"/candles": `[{"id": "1", "close": 1.5}]`})
+//		cfg := gidaritest.Config(t, configYAML, server.URL, gidaritest.Mongo(t))
+//
+//		result := gidaritest.Upsert(t, cfg)
+//		gidaritest.AssertUpserted(t, result, "candles", 1)
+//	}
+//
+// The tests that start a container are skipped if Docker is not available.
+package gidaritest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari"
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/internal/transport"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// MongoDNSEnv and PostgresDNSEnv are the environment variables of the DNS of an existing database, which is used
+	// instead of starting a container, e.g. for the service containers of a CI job.
+	MongoDNSEnv    = "GIDARITEST_MONGODB_DNS"
+	PostgresDNSEnv = "GIDARITEST_POSTGRES_DNS"
+
+	// readyTimeout is the time that a container has to accept connections.
+	readyTimeout = time.Minute
+)
+
+// MongoImage and PostgresImage are the images of the containers started by Mongo and Postgres.
+var (
+	MongoImage    = "mongo"
+	PostgresImage = "postgres:11.1"
+)
+
+// Fixtures maps the path of a request to the body of its response. The bodies are served as JSON.
+type Fixtures map[string]string
+
+// FixturesDir will return the fixtures of the files in the directory, where the path of a file is its name without
+// the extension, e.g. "candles.json" is served at "/candles".
+func FixturesDir(t *testing.T, dir string) Fixtures {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+
+	fixtures := make(Fixtures)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		body, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("failed to read fixture %q: %v", entry.Name(), err)
+		}
+
+		fixtures["/"+strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))] = string(body)
+	}
+
+	return fixtures
+}
+
+// Serve will start a web API that responds to the requests with the fixture of their path, or with a 404 if the path
+// has no fixture. The server is closed when the test is done.
+func Serve(t *testing.T, fixtures Fixtures) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Mongo will start a single node replica set of MongoDB, which supports transactions, and return its DNS. The
+// container is removed when the test is done.
+func Mongo(t *testing.T) string {
+	t.Helper()
+
+	if dns := os.Getenv(MongoDNSEnv); dns != "" {
+		return dns
+	}
+
+	id, addr := startContainer(t, MongoImage, "27017", nil, "--bind_ip_all", "--replSet", "rs0")
+	dns := fmt.Sprintf("mongodb://%s/gidaritest?directConnection=true", addr)
+
+	initiate := "rs.initiate({_id: 'rs0', members: [{_id: 0, host: '127.0.0.1:27017'}]})"
+
+	waitReady(t, func() error {
+		if out, err := exec.Command("docker", "exec", id, "mongosh", "--quiet", "--eval", initiate).
+			CombinedOutput(); err != nil && !strings.Contains(string(out), "already initialized") {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+
+		return ping(dns)
+	})
+
+	return dns
+}
+
+// Postgres will start PostgreSQL and return its DNS. The scripts are SQL files that are run when the database is
+// created, e.g. to create the tables of the configuration. The container is removed when the test is done.
+func Postgres(t *testing.T, scripts ...string) string {
+	t.Helper()
+
+	if dns := os.Getenv(PostgresDNSEnv); dns != "" {
+		return dns
+	}
+
+	options := []string{"-e", "POSTGRES_USER=root", "-e", "POSTGRES_PASSWORD=root", "-e", "POSTGRES_DB=defaultdb"}
+
+	for idx, script := range scripts {
+		path, err := filepath.Abs(script)
+		if err != nil {
+			t.Fatalf("failed to find script %q: %v", script, err)
+		}
+
+		options = append(options, "-v", fmt.Sprintf("%s:/docker-entrypoint-initdb.d/%02d_%s:ro", path, idx,
+			filepath.Base(path)))
+	}
+
+	_, addr := startContainer(t, PostgresImage, "5432", options)
+	dns := fmt.Sprintf("postgresql://root:root@%s/defaultdb?sslmode=disable", addr)
+
+	waitReady(t, func() error { return ping(dns) })
+
+	return dns
+}
+
+// startContainer will start a container of the image with the port published on the loopback interface, returning
+// the ID of the container and the address of the port. The options are options of "docker run" and the arguments are
+// arguments of the container.
+func startContainer(t *testing.T, image, port string, options []string, args ...string) (string, string) {
+	t.Helper()
+
+	if err := exec.Command("docker", "info").Run(); err != nil {
+		t.Skipf("docker is not available: %v", err)
+	}
+
+	run := append([]string{"run", "-d", "-p", "127.0.0.1::" + port}, options...)
+
+	out, err := exec.Command("docker", append(append(run, image), args...)...).Output()
+	if err != nil {
+		t.Fatalf("failed to start %s: %v", image, err)
+	}
+
+	id := strings.TrimSpace(string(out))
+
+	t.Cleanup(func() {
+		if err := exec.Command("docker", "rm", "-f", "-v", id).Run(); err != nil {
+			t.Errorf("failed to remove container %s: %v", id, err)
+		}
+	})
+
+	out, err = exec.Command("docker", "port", id, port+"/tcp").Output()
+	if err != nil {
+		t.Fatalf("failed to get the address of %s: %v", image, err)
+	}
+
+	// The port can be published on several interfaces, one per line.
+	addr, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+
+	return id, addr
+}
+
+// waitReady will call the check until it succeeds, failing the test if it does not succeed within the timeout.
+func waitReady(t *testing.T, check func() error) {
+	t.Helper()
+
+	deadline := time.Now().Add(readyTimeout)
+
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("container is not ready: %v", err)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+// ping will return an error if the storage of the DNS can not list its tables.
+func ping(dns string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stg, err := storage.New(ctx, dns)
+	if err != nil {
+		return fmt.Errorf("unable to connect: %w", err)
+	}
+
+	defer stg.Close()
+
+	if _, err := stg.ListTables(ctx); err != nil {
+		return fmt.Errorf("unable to list tables: %w", err)
+	}
+
+	return nil
+}
+
+// Config will return the configuration of the YAML, with its URL set to the URL of the web API and its connection
+// strings set to the DNS, e.g. of a fixture server and of containers. The logs of the operation are discarded.
+func Config(t *testing.T, yamlBytes []byte, url string, dns ...string) *gidari.Config {
+	t.Helper()
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(yamlBytes, &doc); err != nil {
+		t.Fatalf("failed to unmarshal configuration: %v", err)
+	}
+
+	doc = setKey(doc, "url", url)
+	doc = setKey(doc, "connectionStrings", dns)
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		t.Fatalf("failed to marshal configuration: %v", err)
+	}
+
+	cfg, err := transport.NewConfig(out)
+	if err != nil {
+		t.Fatalf("failed to create configuration: %v", err)
+	}
+
+	cfg.Logger.SetOutput(io.Discard)
+
+	return &gidari.Config{Config: *cfg}
+}
+
+func setKey(doc yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for idx := range doc {
+		if doc[idx].Key == key {
+			doc[idx].Value = value
+
+			return doc
+		}
+	}
+
+	return append(doc, yaml.MapItem{Key: key, Value: value})
+}
+
+// Upsert will run the Transport operation of the configuration, failing the test if it returns an error.
+func Upsert(t *testing.T, cfg *gidari.Config, opts ...gidari.UpsertOption) *gidari.UpsertResult {
+	t.Helper()
+
+	result, err := gidari.Transport(context.Background(), cfg, opts...)
+	if err != nil {
+		t.Fatalf("failed to run the transport operation: %v", err)
+	}
+
+	return result
+}
+
+// AssertUpserted will fail the test if the operation did not upsert or match the number of records in the table, over
+// every storage of the configuration.
+func AssertUpserted(t *testing.T, result *gidari.UpsertResult, table string, expected int64) {
+	t.Helper()
+
+	rsp, ok := result.Tables[table]
+	if !ok {
+		t.Fatalf("expected records in %q, got none", table)
+	}
+
+	if got := rsp.GetUpsertedCount() + rsp.GetMatchedCount(); got != expected {
+		t.Fatalf("expected %d records in %q, got %d", expected, table, got)
+	}
+
+	if len(rsp.GetErrors()) != 0 {
+		t.Fatalf("expected no record errors in %q, got %v", table, rsp.GetErrors())
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package gidaritest
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /candles
+    table: gidaritest_candles
+`
+
+func TestServe(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "candles.json"), []byte(`[{"id":"1"}]`), 0o600); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	server := Serve(t, FixturesDir(t, dir))
+
+	for _, tcase := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/candles", status: http.StatusOK, body: `[{"id":"1"}]`},
+		{path: "/trades", status: http.StatusNotFound, body: "404 page not found\n"},
+	} {
+		rsp, err := http.Get(server.URL + tcase.path)
+		if err != nil {
+			t.Fatalf("failed to get %q: %v", tcase.path, err)
+		}
+
+		body, err := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+
+		if err != nil {
+			t.Fatalf("failed to read %q: %v", tcase.path, err)
+		}
+
+		if rsp.StatusCode != tcase.status || string(body) != tcase.body {
+			t.Fatalf("expected %q to return %d %q, got %d %q", tcase.path, tcase.status, tcase.body, rsp.StatusCode,
+				body)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config(t, []byte(testConfig), "https://api.test.com", "mongodb://localhost:27017/db")
+
+	if cfg.RawURL != "https://api.test.com" || cfg.URL.Host != "api.test.com" {
+		t.Fatalf("unexpected url: %q", cfg.RawURL)
+	}
+
+	if len(cfg.ConnectionStrings) != 1 || cfg.ConnectionStrings[0] != "mongodb://localhost:27017/db" {
+		t.Fatalf("unexpected connection strings: %v", cfg.ConnectionStrings)
+	}
+
+	if len(cfg.Requests) != 1 || cfg.Requests[0].Table != "gidaritest_candles" {
+		t.Fatalf("unexpected requests: %v", cfg.Requests)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	t.Parallel()
+
+	server := Serve(t, Fixtures{"/candles": `[{"id": "1", "close": 1.5}, {"id": "2", "close": 2.5}]`})
+
+	cfg := Config(t, []byte(testConfig), server.URL, Mongo(t))
+
+	AssertUpserted(t, Upsert(t, cfg), "gidaritest_candles", 2)
+}
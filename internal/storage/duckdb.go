@@ -0,0 +1,624 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+//go:build cgo
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	_ "github.com/marcboeker/go-duckdb" // duckdb driver
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// duckPartitionSize is the number of records that are upserted in a single statement.
+const duckPartitionSize = 1000
+
+// duckTxType is the type of the context key of the transaction ID of a DuckDB transaction.
+type duckTxType uint8
+
+const (
+	duckTxID duckTxType = iota
+)
+
+// duckColumnTypes maps the column types of a table definition to DuckDB data types. JSON values are stored as strings,
+// since the JSON type of DuckDB is an extension that is not always available.
+var duckColumnTypes = map[string]string{
+	ColumnTypeString:    "VARCHAR",
+	ColumnTypeInteger:   "BIGINT",
+	ColumnTypeNumber:    "DOUBLE",
+	ColumnTypeBoolean:   "BOOLEAN",
+	ColumnTypeTimestamp: "TIMESTAMPTZ",
+	ColumnTypeJSON:      "VARCHAR",
+}
+
+// DuckDB is a storage for a local DuckDB database file, so that the records of a run can be queried with SQL, e.g.
+// from the DuckDB CLI or pandas, without a database server. DuckDB locks the file for the process that opens it, so
+// the file can not be queried while a run writes to it.
+type DuckDB struct {
+	*sql.DB
+
+	writeMutex sync.Mutex
+
+	// activeTx are the transactions that are currently active, by their ID. The transaction ID is added to the
+	// context of the operations of a transaction in the "StartTx" method, like the transaction ID of Postgres.
+	activeTx sync.Map
+}
+
+// NewDuckDB will return a DuckDB storage for a DNS of the form duckdb:///path/to/file.duckdb, or duckdb://file.duckdb
+// for a path relative to the working directory. The file is created if it does not exist, and a DNS without a path is
+// an in-memory database. The parameters of the DNS are configuration options of DuckDB, e.g. "threads=4".
+func NewDuckDB(ctx context.Context, dns string) (*DuckDB, error) {
+	db, err := sql.Open("duckdb", strings.TrimPrefix(dns, Scheme(DuckDBType)+"://"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open duckdb: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("unable to open duckdb: %w", err)
+	}
+
+	return &DuckDB{DB: db}, nil
+}
+
+// newDuckDBStorage will return the DuckDB storage of the DNS.
+func newDuckDBStorage(ctx context.Context, dns string) (Storage, error) {
+	return NewDuckDB(ctx, dns)
+}
+
+// IsNoSQL returns "false" to indicate that DuckDB is not a NoSQL database.
+func (duck *DuckDB) IsNoSQL() bool { return false }
+
+// Type implements the storage interface.
+func (duck *DuckDB) Type() uint8 { return DuckDBType }
+
+// Close will close the database, which releases the lock of its file.
+func (duck *DuckDB) Close() {
+	duck.DB.Close()
+}
+
+// duckCreateTableStmt will return the statement that creates the table of the request if it does not exist.
+func duckCreateTableStmt(req *proto.CreateTableRequest) (string, error) {
+	defs := make([]string, 0, len(req.GetColumns())+1)
+
+	for _, column := range req.GetColumns() {
+		dataType, ok := duckColumnTypes[column.GetType()]
+		if !ok {
+			return "", UnknownColumnTypeError(column.GetName(), column.GetType())
+		}
+
+		def := fmt.Sprintf("%s %s", pq.QuoteIdentifier(column.GetName()), dataType)
+		if column.GetRequired() {
+			def += " NOT NULL"
+		}
+
+		defs = append(defs, def)
+	}
+
+	if pks := req.GetPrimaryKeys(); len(pks) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", duckQuoteIdentifiers(pks)))
+	}
+
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", pq.QuoteIdentifier(req.GetTable()),
+		strings.Join(defs, ", ")), nil
+}
+
+// duckQuoteIdentifiers will quote the identifiers and join them with commas.
+func duckQuoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for idx, name := range names {
+		quoted[idx] = pq.QuoteIdentifier(name)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// CreateTable will create the table of the request if it does not exist. Existing tables are not altered. The indexes
+// of the request are not created, since DuckDB scans the columns of a table rather than using indexes, and it can not
+// update the indexed columns of a record on conflict. DuckDB has no native partitions, so the records of partitions
+// are stored in the partitioned table, and partitions are not created.
+func (duck *DuckDB) CreateTable(ctx context.Context, req *proto.CreateTableRequest) (*proto.CreateTableResponse,
+	error,
+) {
+	if req.GetPartitionOf() != nil {
+		return &proto.CreateTableResponse{}, nil
+	}
+
+	stmt, err := duckCreateTableStmt(req)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := duck.columns(ctx, duck.DB.QueryContext, req.GetTable())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := duck.DB.ExecContext(ctx, stmt); err != nil {
+		return nil, fmt.Errorf("unable to create table %q: %w", req.GetTable(), err)
+	}
+
+	return &proto.CreateTableResponse{Created: len(columns) == 0}, nil
+}
+
+// duckQueryFn can be used to query the database or a transaction.
+type duckQueryFn func(context.Context, string, ...interface{}) (*sql.Rows, error)
+
+// columns will return the set of the columns of the table, which is empty if the table does not exist.
+func (duck *DuckDB) columns(ctx context.Context, query duckQueryFn, table string) (map[string]bool, error) {
+	rows, err := query(ctx, "SELECT column_name FROM duckdb_columns() WHERE schema_name = current_schema() "+
+		"AND table_name = $1", table)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list columns of table %q: %w", table, err)
+	}
+
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("unable to scan column: %w", err)
+		}
+
+		columns[column] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to iterate columns: %w", err)
+	}
+
+	return columns, nil
+}
+
+// ListPrimaryKeys will return the primary keys of every table in the database.
+func (duck *DuckDB) ListPrimaryKeys(ctx context.Context) (*proto.ListPrimaryKeysResponse, error) {
+	pks, err := duck.primaryKeys(ctx, duck.DB.QueryContext)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &proto.ListPrimaryKeysResponse{PKSet: make(map[string]*proto.PrimaryKeys, len(pks))}
+	for table, columns := range pks {
+		rsp.PKSet[table] = &proto.PrimaryKeys{List: columns}
+	}
+
+	return rsp, nil
+}
+
+// primaryKeys will return the primary keys of every table in the database that has them.
+func (duck *DuckDB) primaryKeys(ctx context.Context, query duckQueryFn) (map[string][]string, error) {
+	rows, err := query(ctx, "SELECT table_name, constraint_column_names FROM duckdb_constraints() "+
+		"WHERE schema_name = current_schema() AND constraint_type = 'PRIMARY KEY'")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list primary keys: %w", err)
+	}
+
+	defer rows.Close()
+
+	pks := make(map[string][]string)
+
+	for rows.Next() {
+		var (
+			table   string
+			columns []interface{}
+		)
+
+		if err := rows.Scan(&table, &columns); err != nil {
+			return nil, fmt.Errorf("unable to scan primary keys: %w", err)
+		}
+
+		for _, column := range columns {
+			pks[table] = append(pks[table], fmt.Sprint(column))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to iterate primary keys: %w", err)
+	}
+
+	return pks, nil
+}
+
+// ListTables will return the tables of the database, with their number of records as their size.
+func (duck *DuckDB) ListTables(ctx context.Context) (*proto.ListTablesResponse, error) {
+	rows, err := duck.DB.QueryContext(ctx, "SELECT table_name FROM duckdb_tables() WHERE schema_name = current_schema()")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tables: %w", err)
+	}
+
+	defer rows.Close()
+
+	var tables []string
+
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("unable to scan table: %w", err)
+		}
+
+		tables = append(tables, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to iterate tables: %w", err)
+	}
+
+	rsp := &proto.ListTablesResponse{TableSet: make(map[string]*proto.Table, len(tables))}
+
+	for _, table := range tables {
+		var size int64
+
+		query := fmt.Sprintf("SELECT count(*) FROM %s", pq.QuoteIdentifier(table))
+		if err := duck.DB.QueryRowContext(ctx, query).Scan(&size); err != nil {
+			return nil, fmt.Errorf("unable to count records of table %q: %w", table, err)
+		}
+
+		rsp.TableSet[table] = &proto.Table{Size: size}
+	}
+
+	return rsp, nil
+}
+
+// Truncate will delete all records of the tables.
+func (duck *DuckDB) Truncate(ctx context.Context, req *proto.TruncateRequest) (*proto.TruncateResponse, error) {
+	duck.writeMutex.Lock()
+	defer duck.writeMutex.Unlock()
+
+	var deleted int64
+
+	for _, table := range req.GetTables() {
+		result, err := duck.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", pq.QuoteIdentifier(table)))
+		if err != nil {
+			return nil, fmt.Errorf("unable to truncate table %q: %w", table, err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get rows affected: %w", err)
+		}
+
+		deleted += affected
+	}
+
+	return &proto.TruncateResponse{DeletedCount: int32(deleted)}, nil
+}
+
+// duckDeleteStmt will return a delete statement and its arguments for the scope of the delete request. Columns are
+// compared in sorted order so the statement is deterministic.
+func duckDeleteStmt(req *proto.DeleteRequest) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	required := req.GetRequired().AsMap()
+
+	columns := make([]string, 0, len(required))
+	for column := range required {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		args = append(args, required[column])
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(column), len(args)))
+	}
+
+	if field := req.GetRangeField(); field != "" {
+		if start := req.GetRangeStart(); start != "" {
+			args = append(args, start)
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d", pq.QuoteIdentifier(field), len(args)))
+		}
+
+		if end := req.GetRangeEnd(); end != "" {
+			args = append(args, end)
+			conditions = append(conditions, fmt.Sprintf("%s < $%d", pq.QuoteIdentifier(field), len(args)))
+		}
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s", pq.QuoteIdentifier(req.GetTable()))
+	if len(conditions) > 0 {
+		query = fmt.Sprintf("%s WHERE %s", query, strings.Join(conditions, " AND "))
+	}
+
+	return query, args
+}
+
+// Delete will delete the records in a table that are within the scope of the request. If a transaction has been
+// assigned to the context, the delete is executed on the transaction.
+func (duck *DuckDB) Delete(ctx context.Context, req *proto.DeleteRequest) (*proto.DeleteResponse, error) {
+	duck.writeMutex.Lock()
+	defer duck.writeMutex.Unlock()
+
+	query, args := duckDeleteStmt(req)
+
+	result, err := duck.execer(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute delete: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get rows affected: %w", err)
+	}
+
+	return &proto.DeleteResponse{DeletedCount: deleted}, nil
+}
+
+// duckExecer executes and queries statements on the database or on a transaction.
+type duckExecer interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+// execer will return the transaction assigned to the context, or the database if no transaction has been assigned to
+// the context.
+func (duck *DuckDB) execer(ctx context.Context) duckExecer {
+	if txID, ok := ctx.Value(duckTxID).(string); ok {
+		if tx, ok := duck.activeTx.Load(txID); ok {
+			return tx.(*sql.Tx)
+		}
+	}
+
+	return duck.DB
+}
+
+// Upsert will insert or update a batch of records in a table. Records with the primary keys of existing records
+// update them, and the fields of the records that are not columns of the table are ignored. If a transaction has been
+// assigned to the context, the upsert is executed on the transaction.
+//
+// DuckDB has no savepoints, so a record that fails, e.g. on a constraint violation, fails the upsert and its
+// transaction rather than being returned as an error on the response.
+func (duck *DuckDB) Upsert(ctx context.Context, req *proto.UpsertRequest) (*proto.UpsertResponse, error) {
+	duck.writeMutex.Lock()
+	defer duck.writeMutex.Unlock()
+
+	records, err := tools.DecodeUpsertRecords(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode records: %w", err)
+	}
+
+	// Do nothing if there are no records.
+	if len(records) == 0 {
+		return &proto.UpsertResponse{}, nil
+	}
+
+	execer := duck.execer(ctx)
+
+	tableColumns, err := duck.columns(ctx, execer.QueryContext, req.GetTable())
+	if err != nil {
+		return nil, err
+	}
+
+	pks, err := duck.primaryKeys(ctx, execer.QueryContext)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := new(proto.UpsertResponse)
+
+	for _, partition := range tools.PartitionStructs(duckPartitionSize, records) {
+		query, args := duckUpsertStmt(req.GetTable(), tableColumns, pks[req.GetTable()], partition)
+		if query == "" {
+			continue
+		}
+
+		result, err := execer.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to upsert records into table %q: %w", req.GetTable(), err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get rows affected: %w", err)
+		}
+
+		rsp.UpsertedCount += affected
+	}
+
+	return rsp, nil
+}
+
+// duckUpsertStmt will return the statement that upserts the records into the columns of the table, and its arguments.
+// The columns of the statement are the columns of the table that any of the records has, in sorted order, and the
+// records without a field of a column set it to null. The statement is empty if the records have no columns of the
+// table.
+func duckUpsertStmt(table string, tableColumns map[string]bool, pks []string,
+	records []*structpb.Struct,
+) (string, []interface{}) {
+	fields := make(map[string]bool)
+
+	for _, record := range records {
+		for field := range record.GetFields() {
+			if tableColumns[field] {
+				fields[field] = true
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	columns := make([]string, 0, len(fields))
+	for field := range fields {
+		columns = append(columns, field)
+	}
+
+	sort.Strings(columns)
+
+	values := make([]string, 0, len(records))
+	args := make([]interface{}, 0, len(records)*len(columns))
+
+	for _, record := range records {
+		params := make([]string, len(columns))
+
+		for idx, column := range columns {
+			args = append(args, duckValue(record.GetFields()[column]))
+			params[idx] = fmt.Sprintf("$%d", len(args))
+		}
+
+		values = append(values, fmt.Sprintf("(%s)", strings.Join(params, ", ")))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", pq.QuoteIdentifier(table), duckQuoteIdentifiers(columns),
+		strings.Join(values, ", "))
+
+	if len(pks) == 0 {
+		return query, args
+	}
+
+	isPK := make(map[string]bool, len(pks))
+	for _, pk := range pks {
+		isPK[pk] = true
+	}
+
+	var updates []string
+
+	for _, column := range columns {
+		if !isPK[column] {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", pq.QuoteIdentifier(column),
+				pq.QuoteIdentifier(column)))
+		}
+	}
+
+	if len(updates) == 0 {
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", query, duckQuoteIdentifiers(pks)), args
+	}
+
+	return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", query, duckQuoteIdentifiers(pks),
+		strings.Join(updates, ", ")), args
+}
+
+// duckValue will return the argument of a value of a record. Objects and arrays are encoded as JSON.
+func duckValue(val *structpb.Value) interface{} {
+	switch val.GetKind().(type) {
+	case *structpb.Value_StructValue, *structpb.Value_ListValue:
+		encoded, _ := json.Marshal(val.AsInterface())
+
+		return string(encoded)
+	default:
+		return val.AsInterface()
+	}
+}
+
+// StartTx will start a transaction on the database, which is used by the operations sent to it.
+func (duck *DuckDB) StartTx(ctx context.Context) (*Txn, error) {
+	txnID := uuid.New().String()
+
+	tx, err := duck.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	duck.activeTx.Store(txnID, tx)
+
+	// end will end the transaction and remove it from the activeTx map.
+	end := func(fn func() error) func() error {
+		return func() error {
+			defer duck.activeTx.Delete(txnID)
+
+			duck.writeMutex.Lock()
+			defer duck.writeMutex.Unlock()
+
+			return fn()
+		}
+	}
+
+	return NewTxn(ctx, duck, TxnHooks{
+		// Create a copy of the operation context with a transaction ID.
+		Context: func(ctx context.Context) context.Context {
+			return context.WithValue(ctx, duckTxID, txnID)
+		},
+		Commit:   end(tx.Commit),
+		Rollback: end(tx.Rollback),
+	}), nil
+}
+
+// Scan will call fn with every row of a table. The rows are read outside of any transaction assigned to the context.
+func (duck *DuckDB) Scan(ctx context.Context, table string, fn func(record map[string]interface{}) error) error {
+	rows, err := duck.DB.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s", pq.QuoteIdentifier(table)))
+	if err != nil {
+		return fmt.Errorf("unable to query table: %w", err)
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("unable to get columns: %w", err)
+	}
+
+	for rows.Next() {
+		vals := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+
+		for idx := range vals {
+			ptrs[idx] = &vals[idx]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		record := make(map[string]interface{}, len(columns))
+
+		for idx, column := range columns {
+			if val := duckScanValue(vals[idx]); val != nil {
+				record[column] = val
+			}
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("unable to iterate rows: %w", err)
+	}
+
+	return nil
+}
+
+// duckScanValue will convert the value of a column to the type of its JSON value.
+func duckScanValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case int8:
+		return float64(val)
+	case int16:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case float32:
+		return float64(val)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	default:
+		return val
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+//go:build !cgo
+
+package storage
+
+import (
+	"context"
+)
+
+// newDuckDBStorage will return ErrDuckDBNotSupported, since the DuckDB driver is built with cgo.
+func newDuckDBStorage(context.Context, string) (Storage, error) {
+	return nil, ErrDuckDBNotSupported
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+//go:build cgo
+
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/tools"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newTestDuckDB will return a DuckDB storage of a file in a temporary directory, with the candles table created.
+func newTestDuckDB(t *testing.T) *DuckDB {
+	t.Helper()
+
+	svc, err := New(context.Background(), "duckdb://"+filepath.Join(t.TempDir(), "gidari.duckdb"))
+	if err != nil {
+		t.Fatalf("failed to construct duckdb storage: %v", err)
+	}
+
+	t.Cleanup(svc.Close)
+
+	duck, ok := svc.Storage.(*DuckDB)
+	if !ok {
+		t.Fatalf("expected a duckdb storage, got %T", svc.Storage)
+	}
+
+	rsp, err := duck.CreateTable(context.Background(), &proto.CreateTableRequest{
+		Table: "candles",
+		Columns: []*proto.Column{
+			{Name: "product_id", Type: ColumnTypeString, Required: true},
+			{Name: "time", Type: ColumnTypeTimestamp, Required: true},
+			{Name: "close", Type: ColumnTypeNumber},
+			{Name: "trades", Type: ColumnTypeInteger},
+			{Name: "meta", Type: ColumnTypeJSON},
+		},
+		PrimaryKeys: []string{"product_id", "time"},
+		Indexes:     []*proto.Index{{Columns: []string{"close"}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	if !rsp.GetCreated() {
+		t.Fatalf("expected the table to be created")
+	}
+
+	return duck
+}
+
+func duckUpsertRequest(data string) *proto.UpsertRequest {
+	return &proto.UpsertRequest{Table: "candles", Data: []byte(data), DataType: int32(tools.UpsertDataJSON)}
+}
+
+func duckScan(t *testing.T, duck *DuckDB) []map[string]interface{} {
+	t.Helper()
+
+	var records []map[string]interface{}
+
+	err := duck.Scan(context.Background(), "candles", func(record map[string]interface{}) error {
+		records = append(records, record)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+
+	return records
+}
+
+func TestDuckDB(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	duck := newTestDuckDB(t)
+
+	_, err := duck.Upsert(ctx, duckUpsertRequest(`[{"product_id":"BTC-USD","time":"2022-05-10T00:00:00Z","close":1.5,`+
+		`"trades":3,"meta":{"source":"coinbase"},"unknown":true},{"product_id":"ETH-USD","time":"2022-05-10T00:00:00Z"}]`))
+	if err != nil {
+		t.Fatalf("failed to upsert records: %v", err)
+	}
+
+	rsp, err := duck.Upsert(ctx, duckUpsertRequest(`{"product_id":"ETH-USD","time":"2022-05-10T00:00:00Z","close":2}`))
+	if err != nil {
+		t.Fatalf("failed to update record: %v", err)
+	}
+
+	if rsp.GetUpsertedCount() != 1 {
+		t.Fatalf("expected 1 record to be upserted, got %d", rsp.GetUpsertedCount())
+	}
+
+	expected := []map[string]interface{}{
+		{
+			"product_id": "BTC-USD", "time": "2022-05-10T00:00:00Z", "close": 1.5, "trades": float64(3),
+			"meta": `{"source":"coinbase"}`,
+		},
+		{"product_id": "ETH-USD", "time": "2022-05-10T00:00:00Z", "close": float64(2)},
+	}
+	if records := duckScan(t, duck); !reflect.DeepEqual(records, expected) {
+		t.Fatalf("expected records %v, got %v", expected, records)
+	}
+
+	pks, err := duck.ListPrimaryKeys(ctx)
+	if err != nil {
+		t.Fatalf("failed to list primary keys: %v", err)
+	}
+
+	if list := pks.GetPKSet()["candles"].GetList(); !reflect.DeepEqual(list, []string{"product_id", "time"}) {
+		t.Fatalf("expected the primary keys of candles, got %v", list)
+	}
+
+	tables, err := duck.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+
+	if size := tables.GetTableSet()["candles"].GetSize(); size != 2 {
+		t.Fatalf("expected the size of candles to be 2, got %d", size)
+	}
+
+	required, _ := structpb.NewStruct(map[string]interface{}{"product_id": "BTC-USD"})
+
+	deleted, err := duck.Delete(ctx, &proto.DeleteRequest{
+		Table:      "candles",
+		Required:   required,
+		RangeField: "time",
+		RangeStart: "2022-05-10T00:00:00Z",
+		RangeEnd:   "2022-05-11T00:00:00Z",
+	})
+	if err != nil || deleted.GetDeletedCount() != 1 {
+		t.Fatalf("expected 1 record to be deleted, got %d: %v", deleted.GetDeletedCount(), err)
+	}
+
+	truncated, err := duck.Truncate(ctx, &proto.TruncateRequest{Tables: []string{"candles"}})
+	if err != nil || truncated.GetDeletedCount() != 1 {
+		t.Fatalf("expected 1 record to be truncated, got %d: %v", truncated.GetDeletedCount(), err)
+	}
+}
+
+func TestDuckDBTxn(t *testing.T) {
+	t.Parallel()
+
+	upsert := func(ctx context.Context, stg Storage) error {
+		_, err := stg.Upsert(ctx, duckUpsertRequest(`{"product_id":"BTC-USD","time":"2022-05-10T00:00:00Z"}`))
+
+		return err
+	}
+
+	for _, tcase := range []struct {
+		name    string
+		commit  bool
+		records int
+	}{
+		{name: "commit", commit: true, records: 1},
+		{name: "rollback"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			duck := newTestDuckDB(t)
+
+			txn, err := duck.StartTx(context.Background())
+			if err != nil {
+				t.Fatalf("failed to start transaction: %v", err)
+			}
+
+			txn.Send(upsert)
+
+			end := txn.Rollback
+			if tcase.commit {
+				end = txn.Commit
+			}
+
+			if err := end(); err != nil {
+				t.Fatalf("failed to end transaction: %v", err)
+			}
+
+			if records := duckScan(t, duck); len(records) != tcase.records {
+				t.Fatalf("expected %d records, got %v", tcase.records, records)
+			}
+		})
+	}
+}
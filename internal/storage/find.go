@@ -0,0 +1,57 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrFindNotSupported is returned when finding the records of a storage device that does not implement Finder.
+var ErrFindNotSupported = fmt.Errorf("find is not supported")
+
+// FindNotSupportedError wraps an error with ErrFindNotSupported.
+func FindNotSupportedError(scheme string) error {
+	return fmt.Errorf("%w: %s", ErrFindNotSupported, scheme)
+}
+
+// Finder is implemented by the storage devices that can read the records of a table by their keys, e.g. to compare
+// the records of a table with the records that overwrite them. Finder is optional for the storage backends added with
+// Register.
+type Finder interface {
+	// Find will call fn with every record of the table whose fields equal the fields of any of the keys, in no
+	// particular order. The values of the records are decoded like the values of Scan. Find reads on the transaction
+	// assigned to the context, if there is one, so that it sees the records written earlier on the transaction.
+	Find(ctx context.Context, table string, keys []map[string]interface{},
+		fn func(record map[string]interface{}) error) error
+}
+
+// Find will call fn with every record of the table on the storage device that matches any of the keys, or return
+// ErrFindNotSupported if the storage device does not implement Finder.
+func Find(ctx context.Context, stg Storage, table string, keys []map[string]interface{},
+	fn func(record map[string]interface{}) error,
+) error {
+	if svc, ok := stg.(*Service); ok {
+		stg = svc.Storage
+	}
+
+	finder, ok := stg.(Finder)
+	if !ok {
+		return FindNotSupportedError(Scheme(stg.Type()))
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := finder.Find(ctx, table, keys, fn); err != nil {
+		return fmt.Errorf("unable to find records of table %q: %w", table, err)
+	}
+
+	return nil
+}
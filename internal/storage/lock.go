@@ -0,0 +1,59 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+var (
+	// ErrLockNotSupported is returned when locking a storage device that does not implement Locker.
+	ErrLockNotSupported = fmt.Errorf("lock is not supported")
+
+	// ErrLocked is returned when an advisory lock is held by another session.
+	ErrLocked = fmt.Errorf("lock is held by another session")
+)
+
+// LockNotSupportedError wraps an error with ErrLockNotSupported.
+func LockNotSupportedError(scheme string) error {
+	return fmt.Errorf("%w: %s", ErrLockNotSupported, scheme)
+}
+
+// LockedError wraps an error with ErrLocked.
+func LockedError(key string) error {
+	return fmt.Errorf("%w: %q", ErrLocked, key)
+}
+
+// Locker is implemented by the storage devices that support advisory locks, e.g. to prevent two processes from
+// writing the same tables at the same time. Locker is optional for the storage backends added with Register.
+type Locker interface {
+	// TryLock will acquire the advisory lock of the key without waiting, or return ErrLocked if another session holds
+	// it. The lock is held until release is called or the storage device is closed.
+	TryLock(ctx context.Context, key string) (release func() error, err error)
+}
+
+// TryLock will acquire the advisory lock of the key on the storage device, or return ErrLockNotSupported if the
+// storage device does not implement Locker.
+func TryLock(ctx context.Context, stg Storage, key string) (func() error, error) {
+	if svc, ok := stg.(*Service); ok {
+		stg = svc.Storage
+	}
+
+	locker, ok := stg.(Locker)
+	if !ok {
+		return nil, LockNotSupportedError(Scheme(stg.Type()))
+	}
+
+	release, err := locker.TryLock(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to lock %q: %w", key, err)
+	}
+
+	return release, nil
+}
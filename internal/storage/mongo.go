@@ -11,6 +11,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -28,6 +29,9 @@ const (
 	mdbLifetime              = 60 * time.Second
 	mdbTransactionRetryLimit = 3
 	mdbWriteConflicErrCode   = 112
+
+	// mongoIDField is the field that holds the primary key of every MongoDB document.
+	mongoIDField = "_id"
 )
 
 // Mongo is a wrapper for *mongo.Client, use to perform CRUD operations on a mongo DB instance.
@@ -117,7 +121,8 @@ func (m *Mongo) receiveWrites(sctx mongo.SessionContext, txn *Txn) *errgroup.Gro
 					continue
 				}
 
-				err = opr(sctx, m)
+				// Execute the operation on the session, with the context of the operation.
+				err = opr.fn(mongo.NewSessionContext(opr.ctx, sctx), m)
 			}
 		}
 
@@ -171,11 +176,7 @@ func (m *Mongo) startSession(ctx context.Context, txn *Txn) {
 // 60 seconds, the transacting data will be committed commit the transaction and start a new one.
 func (m *Mongo) StartTx(ctx context.Context) (*Txn, error) {
 	// Construct a transaction.
-	txn := &Txn{
-		make(chan TxnChanFn),
-		make(chan error, 1),
-		make(chan bool, 1),
-	}
+	txn := newTxn(ctx)
 
 	// Create a go routine that creates a session and listens for writes.
 	go m.startSession(ctx, txn)
@@ -183,6 +184,60 @@ func (m *Mongo) StartTx(ctx context.Context) (*Txn, error) {
 	return txn, nil
 }
 
+// CreateTable will create the collection of the request if it does not exist, along with its indexes. The primary
+// keys of the request are created as a unique index, unless they are the "_id" field. MongoDB collections have no
+// fixed columns, so the columns of the request are not created. MongoDB has no native partitions, so the records of
+// partitions are stored in the partitioned collection, and partitions are not created.
+func (m *Mongo) CreateTable(ctx context.Context, req *proto.CreateTableRequest) (*proto.CreateTableResponse, error) {
+	if req.GetPartitionOf() != nil {
+		return &proto.CreateTableResponse{}, nil
+	}
+
+	connString, err := connstring.ParseAndValidate(m.dns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	database := m.Client.Database(connString.Database)
+
+	names, err := database.ListCollectionNames(ctx, bson.D{{Key: "name", Value: req.GetTable()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	rsp := &proto.CreateTableResponse{Created: len(names) == 0}
+	if rsp.Created {
+		if err := database.CreateCollection(ctx, req.GetTable()); err != nil {
+			return nil, fmt.Errorf("failed to create collection %s: %w", req.GetTable(), err)
+		}
+	}
+
+	indexes := req.GetIndexes()
+	if pks := req.GetPrimaryKeys(); len(pks) > 0 && !(len(pks) == 1 && pks[0] == mongoIDField) {
+		indexes = append(indexes, &proto.Index{Name: req.GetTable() + "_pkey", Columns: pks, Unique: true})
+	}
+
+	models := make([]mongo.IndexModel, 0, len(indexes))
+
+	for _, index := range indexes {
+		keys := bson.D{}
+		for _, column := range index.GetColumns() {
+			keys = append(keys, bson.E{Key: column, Value: 1})
+		}
+
+		opts := options.Index().SetName(indexName(req.GetTable(), index)).SetUnique(index.GetUnique())
+		models = append(models, mongo.IndexModel{Keys: keys, Options: opts})
+	}
+
+	if len(models) > 0 {
+		if _, err := database.Collection(req.GetTable()).Indexes().CreateMany(ctx, models); err != nil {
+			return nil, fmt.Errorf("failed to create indexes on collection %s: %w", req.GetTable(), err)
+		}
+	}
+
+	return rsp, nil
+}
+
 // Truncate will delete all records in a collection.
 func (m *Mongo) Truncate(ctx context.Context, req *proto.TruncateRequest) (*proto.TruncateResponse, error) {
 	// If there are no collections to truncate, return.
@@ -207,6 +262,46 @@ func (m *Mongo) Truncate(ctx context.Context, req *proto.TruncateRequest) (*prot
 	return &proto.TruncateResponse{}, nil
 }
 
+// Delete will delete the records in a collection that are within the scope of the request.
+func (m *Mongo) Delete(ctx context.Context, req *proto.DeleteRequest) (*proto.DeleteResponse, error) {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+
+	filter := bson.M{}
+	for field, value := range req.GetRequired().AsMap() {
+		filter[field] = value
+	}
+
+	if field := req.GetRangeField(); field != "" {
+		bounds := bson.M{}
+		if start := req.GetRangeStart(); start != "" {
+			bounds["$gte"] = start
+		}
+
+		if end := req.GetRangeEnd(); end != "" {
+			bounds["$lt"] = end
+		}
+
+		if len(bounds) > 0 {
+			filter[field] = bounds
+		}
+	}
+
+	connString, err := connstring.ParseAndValidate(m.dns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	coll := m.Client.Database(connString.Database).Collection(req.GetTable())
+
+	result, err := coll.DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting from collection %s: %w", req.GetTable(), err)
+	}
+
+	return &proto.DeleteResponse{DeletedCount: result.DeletedCount}, nil
+}
+
 // Upsert will insert or update a record in a collection.
 func (m *Mongo) Upsert(ctx context.Context, req *proto.UpsertRequest) (*proto.UpsertResponse, error) {
 	m.writeMutex.Lock()
@@ -230,7 +325,14 @@ func (m *Mongo) Upsert(ctx context.Context, req *proto.UpsertRequest) (*proto.Up
 			return nil, fmt.Errorf("failed to assign record to bson document: %w", err)
 		}
 
-		models = append(models, mongo.NewUpdateOneModel().SetFilter(doc).
+		// Records with an "_id" are matched on the "_id", so that keyed records are updated in place instead of
+		// being inserted as new documents when any of their fields change.
+		var filter interface{} = doc
+		if id, ok := record.GetFields()[mongoIDField]; ok {
+			filter = bson.D{primitive.E{Key: mongoIDField, Value: id.AsInterface()}}
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).
 			SetUpdate(bson.D{primitive.E{Key: "$set", Value: doc}}).
 			SetUpsert(true))
 	}
@@ -242,12 +344,26 @@ func (m *Mongo) Upsert(ctx context.Context, req *proto.UpsertRequest) (*proto.Up
 
 	coll := m.Client.Database(cs.Database).Collection(req.Table)
 
-	bwr, err := coll.BulkWrite(ctx, models)
-	if err != nil {
+	// The bulk write is unordered so that a record that fails to write does not prevent the remaining records
+	// from being written.
+	bwr, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+
+	var bwErr mongo.BulkWriteException
+	if err != nil && (!errors.As(err, &bwErr) || bwErr.WriteConcernError != nil || len(bwErr.WriteErrors) == 0) {
 		return nil, fmt.Errorf("bulk write error: %w", err)
 	}
 
-	return &proto.UpsertResponse{MatchedCount: bwr.MatchedCount, UpsertedCount: bwr.UpsertedCount}, nil
+	rsp := &proto.UpsertResponse{MatchedCount: bwr.MatchedCount, UpsertedCount: bwr.UpsertedCount}
+
+	for _, writeErr := range bwErr.WriteErrors {
+		rsp.Errors = append(rsp.Errors, &proto.RecordError{
+			Index:   int64(writeErr.Index),
+			Message: writeErr.Message,
+			Record:  records[writeErr.Index],
+		})
+	}
+
+	return rsp, nil
 }
 
 // ListPrimaryKeys will return a "proto.ListPrimaryKeysResponse" containing a list of primary keys data for all tables
@@ -266,7 +382,7 @@ func (m *Mongo) ListPrimaryKeys(ctx context.Context) (*proto.ListPrimaryKeysResp
 			rsp.PKSet[collection] = &proto.PrimaryKeys{}
 		}
 
-		rsp.PKSet[collection].List = append(rsp.PKSet[collection].List, "_id")
+		rsp.PKSet[collection].List = append(rsp.PKSet[collection].List, mongoIDField)
 	}
 
 	return rsp, nil
@@ -305,3 +421,126 @@ func (m *Mongo) ListTables(ctx context.Context) (*proto.ListTablesResponse, erro
 
 	return rsp, nil
 }
+
+// Scan will call fn with every document of a collection. Generated object IDs are omitted, since they differ between
+// storage devices that hold the same records.
+func (m *Mongo) Scan(ctx context.Context, table string, fn func(record map[string]interface{}) error) error {
+	connString, err := connstring.ParseAndValidate(m.dns)
+	if err != nil {
+		return fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	cursor, err := m.Client.Database(connString.Database).Collection(table).Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to find documents: %w", err)
+	}
+
+	return mongoScanCursor(ctx, cursor, fn)
+}
+
+// Find will call fn with every document of a collection that matches any of the keys. The documents are read on the
+// session of the context, if there is one.
+func (m *Mongo) Find(ctx context.Context, table string, keys []map[string]interface{},
+	fn func(record map[string]interface{}) error,
+) error {
+	connString, err := connstring.ParseAndValidate(m.dns)
+	if err != nil {
+		return fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	filters := make(bson.A, 0, len(keys))
+
+	for _, key := range keys {
+		if len(key) > 0 {
+			filters = append(filters, bson.M(key))
+		}
+	}
+
+	if len(filters) == 0 {
+		return nil
+	}
+
+	cursor, err := m.Client.Database(connString.Database).Collection(table).
+		Find(ctx, bson.D{primitive.E{Key: "$or", Value: filters}})
+	if err != nil {
+		return fmt.Errorf("failed to find documents: %w", err)
+	}
+
+	return mongoScanCursor(ctx, cursor, fn)
+}
+
+// mongoScanCursor will call fn with every document of the cursor, closing the cursor once it is read. Generated
+// object IDs are omitted.
+func mongoScanCursor(ctx context.Context, cursor *mongo.Cursor, fn func(record map[string]interface{}) error) error {
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode document: %w", err)
+		}
+
+		record := make(map[string]interface{}, len(doc))
+
+		for _, elem := range doc {
+			if _, ok := elem.Value.(primitive.ObjectID); ok && elem.Key == mongoIDField {
+				continue
+			}
+
+			if val := mongoScanValue(elem.Value); val != nil {
+				record[elem.Key] = val
+			}
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate documents: %w", err)
+	}
+
+	return nil
+}
+
+// mongoScanValue will convert a BSON value to the type of its JSON value.
+func mongoScanValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case primitive.D:
+		obj := make(map[string]interface{}, len(val))
+
+		for _, elem := range val {
+			if elemVal := mongoScanValue(elem.Value); elemVal != nil {
+				obj[elem.Key] = elemVal
+			}
+		}
+
+		return obj
+	case primitive.A:
+		arr := make([]interface{}, len(val))
+		for idx, elem := range val {
+			arr[idx] = mongoScanValue(elem)
+		}
+
+		return arr
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case primitive.DateTime:
+		return val.Time().UTC().Format(time.RFC3339Nano)
+	case primitive.ObjectID:
+		return val.Hex()
+	case primitive.Decimal128:
+		if num, err := strconv.ParseFloat(val.String(), 64); err == nil {
+			return num
+		}
+
+		return val.String()
+	case primitive.Null, primitive.Undefined:
+		return nil
+	default:
+		return val
+	}
+}
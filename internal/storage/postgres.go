@@ -10,22 +10,30 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/alpine-hodler/gidari/proto"
 	"github.com/alpine-hodler/gidari/tools"
 	"github.com/google/uuid"
 	"github.com/lib/pq" // postgres driver
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 const (
 	pgPartitionSize = 1000
 	pgGCRetryLimit  = 10
+
+	// pgUpsertSavepoint is the name of the savepoint used to recover a transaction from a failed upsert.
+	pgUpsertSavepoint = "gidari_upsert"
 )
 
 // postgresTxType is a type alias for the postgres transaction type.
@@ -221,7 +229,205 @@ func (pg *Postgres) ListTables(ctx context.Context) (*proto.ListTablesResponse,
 	return rsp, nil
 }
 
-// Truncate will truncate a table.
+// pgColumnTypes maps the column types of a table definition to postgres data types.
+var pgColumnTypes = map[string]string{
+	ColumnTypeString:    "text",
+	ColumnTypeInteger:   "bigint",
+	ColumnTypeNumber:    "double precision",
+	ColumnTypeBoolean:   "boolean",
+	ColumnTypeTimestamp: "timestamptz",
+	ColumnTypeJSON:      "jsonb",
+}
+
+// indexName will return the name of an index, defaulting to the table and columns of the index.
+func indexName(table string, index *proto.Index) string {
+	if name := index.GetName(); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("%s_%s_idx", table, strings.Join(index.GetColumns(), "_"))
+}
+
+// createTableStmts will return the statements that create the table and indexes of the request if they do not exist.
+// Partitions of a partitioned table inherit its columns and indexes.
+func createTableStmts(req *proto.CreateTableRequest) ([]string, error) {
+	table := pq.QuoteIdentifier(req.GetTable())
+
+	if partition := req.GetPartitionOf(); partition != nil {
+		return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s)", table,
+			pq.QuoteIdentifier(partition.GetTable()), pq.QuoteLiteral(partition.GetStart()),
+			pq.QuoteLiteral(partition.GetEnd()))}, nil
+	}
+	defs := make([]string, 0, len(req.GetColumns())+1)
+
+	for _, column := range req.GetColumns() {
+		dataType, ok := pgColumnTypes[column.GetType()]
+		if !ok {
+			return nil, UnknownColumnTypeError(column.GetName(), column.GetType())
+		}
+
+		def := fmt.Sprintf("%s %s", pq.QuoteIdentifier(column.GetName()), dataType)
+		if column.GetRequired() {
+			def += " NOT NULL"
+		}
+
+		defs = append(defs, def)
+	}
+
+	if pks := req.GetPrimaryKeys(); len(pks) > 0 {
+		quoted := make([]string, 0, len(pks))
+		for _, pk := range pks {
+			quoted = append(quoted, pq.QuoteIdentifier(pk))
+		}
+
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(quoted, ", ")))
+	}
+
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(defs, ", "))
+	if column := req.GetPartitionBy(); column != "" {
+		create = fmt.Sprintf("%s PARTITION BY RANGE (%s)", create, pq.QuoteIdentifier(column))
+	}
+
+	stmts := []string{create}
+
+	for _, index := range req.GetIndexes() {
+		unique := ""
+		if index.GetUnique() {
+			unique = "UNIQUE "
+		}
+
+		quoted := make([]string, 0, len(index.GetColumns()))
+		for _, column := range index.GetColumns() {
+			quoted = append(quoted, pq.QuoteIdentifier(column))
+		}
+
+		stmts = append(stmts, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)", unique,
+			pq.QuoteIdentifier(indexName(req.GetTable(), index)), table, strings.Join(quoted, ", ")))
+	}
+
+	return stmts, nil
+}
+
+// CreateTable will create the table and indexes of the request if they do not exist. Existing tables are not altered.
+func (pg *Postgres) CreateTable(ctx context.Context, req *proto.CreateTableRequest) (*proto.CreateTableResponse, error) {
+	stmts, err := createTableStmts(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pg.loadMeta(ctx, false); err != nil {
+		return nil, fmt.Errorf("unable to load postgres metadata: %w", err)
+	}
+
+	_, exists := pg.meta.cols[req.GetTable()]
+
+	for _, stmt := range stmts {
+		if _, err := pg.DB.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("unable to create table %q: %w", req.GetTable(), err)
+		}
+	}
+
+	return &proto.CreateTableResponse{Created: !exists}, nil
+}
+
+// foreignKeys will return the tables that each table references with a foreign key.
+func (pg *Postgres) foreignKeys(ctx context.Context) (map[string][]string, error) {
+	rows, err := pg.DB.QueryContext(ctx, string(pgForeignKeys))
+	if err != nil {
+		return nil, fmt.Errorf("unable to query foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	refs := make(map[string][]string)
+
+	for rows.Next() {
+		var table, referenced string
+		if err := rows.Scan(&table, &referenced); err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		refs[table] = append(refs[table], referenced)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read foreign keys: %w", err)
+	}
+
+	return refs, nil
+}
+
+// truncateOrder will order the tables so that every table comes before the tables it references with a foreign key,
+// i.e. the records that reference a table are deleted before the records they reference. Tables in a reference cycle
+// keep their relative order.
+func truncateOrder(tables []string, refs map[string][]string) []string {
+	inSet := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		inSet[table] = true
+	}
+
+	// referencedBy maps each table to the tables of the set that reference it.
+	referencedBy := make(map[string][]string)
+
+	for _, table := range tables {
+		for _, referenced := range refs[table] {
+			if inSet[referenced] && referenced != table {
+				referencedBy[referenced] = append(referencedBy[referenced], table)
+			}
+		}
+	}
+
+	ordered := make([]string, 0, len(tables))
+	visited := make(map[string]bool, len(tables))
+
+	var visit func(table string)
+	visit = func(table string) {
+		if visited[table] {
+			return
+		}
+
+		visited[table] = true
+
+		for _, child := range referencedBy[table] {
+			visit(child)
+		}
+
+		ordered = append(ordered, table)
+	}
+
+	for _, table := range tables {
+		visit(table)
+	}
+
+	return ordered
+}
+
+// referencedOutside will return true if a table that is not in the tables references one of the tables with a foreign
+// key, in which case the tables can not be truncated without truncating the referencing table.
+func referencedOutside(tables []string, refs map[string][]string) bool {
+	inSet := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		inSet[table] = true
+	}
+
+	for table, referenced := range refs {
+		if inSet[table] {
+			continue
+		}
+
+		for _, ref := range referenced {
+			if inSet[ref] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Truncate will truncate the tables. Tables that reference each other with foreign keys are truncated together, and
+// if a table is referenced by a table that is not truncated, the records are deleted in the order of their
+// dependencies instead, which succeeds as long as no remaining record references them. If the request cascades, the
+// referencing tables are truncated as well.
 func (pg *Postgres) Truncate(ctx context.Context, req *proto.TruncateRequest) (*proto.TruncateResponse, error) {
 	// If the table is not specified, return an error.
 	if len(req.Tables) == 0 {
@@ -233,42 +439,258 @@ func (pg *Postgres) Truncate(ctx context.Context, req *proto.TruncateRequest) (*
 		return nil, ErrNoTables
 	}
 
-	stmt, err := pg.DB.PrepareContext(ctx, fmt.Sprintf(string(pgTruncatedTables), strings.Join(tables, ",")))
+	if req.GetCascade() {
+		query := fmt.Sprintf("TRUNCATE TABLE %s CASCADE", pgQuoteIdentifiers(tables))
+		if _, err := pg.DB.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("unable to truncate tables: %w", err)
+		}
+
+		return &proto.TruncateResponse{}, nil
+	}
+
+	refs, err := pg.foreignKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tables = truncateOrder(tables, refs)
+
+	if !referencedOutside(tables, refs) {
+		query := fmt.Sprintf(string(pgTruncatedTables), pgQuoteIdentifiers(tables))
+		if _, err := pg.DB.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("unable to truncate tables: %w", err)
+		}
+
+		return &proto.TruncateResponse{}, nil
+	}
+
+	// The deletes are made in a transaction, so that the tables are not left partially deleted if one fails.
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+
+	var deleted int64
+
+	for _, table := range tables {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", pq.QuoteIdentifier(table)))
+		if err != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				return nil, fmt.Errorf("unable to roll back truncate: %v: %w", rerr, err)
+			}
+
+			return nil, fmt.Errorf("unable to delete records of table %q: %w", table, err)
+		}
+
+		count, err := result.RowsAffected()
+		if err == nil {
+			deleted += count
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("unable to commit truncate: %w", err)
+	}
+
+	return &proto.TruncateResponse{DeletedCount: int32(deleted)}, nil
+}
+
+// pgQuoteIdentifiers will quote the identifiers, e.g. the names of tables, and join them with commas. The names are
+// kept as they are, so that mixed-case names match the names of the catalog.
+func pgQuoteIdentifiers(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, pq.QuoteIdentifier(name))
+	}
+
+	return strings.Join(quoted, ",")
+}
+
+// deleteStmt will return a postgres delete statement and its arguments for the scope of the delete request. Columns
+// are compared in sorted order so the statement is deterministic.
+func (meta *pgmeta) deleteStmt(req *proto.DeleteRequest) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	required := req.GetRequired().AsMap()
+
+	columns := make([]string, 0, len(required))
+	for column := range required {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		args = append(args, required[column])
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(column), len(args)))
+	}
+
+	if field := req.GetRangeField(); field != "" {
+		if start := req.GetRangeStart(); start != "" {
+			args = append(args, start)
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d", pq.QuoteIdentifier(field), len(args)))
+		}
+
+		if end := req.GetRangeEnd(); end != "" {
+			args = append(args, end)
+			conditions = append(conditions, fmt.Sprintf("%s < $%d", pq.QuoteIdentifier(field), len(args)))
+		}
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s", pq.QuoteIdentifier(req.GetTable()))
+	if len(conditions) > 0 {
+		query = fmt.Sprintf("%s WHERE %s", query, strings.Join(conditions, " AND "))
+	}
+
+	return query, args
+}
+
+// Delete will delete the records in a table that are within the scope of the request. If a transaction has been
+// assigned to the context, the delete is executed on the transaction.
+func (pg *Postgres) Delete(ctx context.Context, req *proto.DeleteRequest) (*proto.DeleteResponse, error) {
+	pg.writeMutex.Lock()
+	defer pg.writeMutex.Unlock()
+
+	prepareContextFn, err := pg.getPrepareContextFn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get preparer: %w", err)
+	}
+
+	query, args := pg.meta.deleteStmt(req)
+
+	stmt, err := prepareContextFn(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("unable to prepare statement: %w", err)
 	}
 
-	rows, err := stmt.QueryContext(ctx)
+	result, err := stmt.ExecContext(ctx, args...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to query: %w", err)
+		return nil, fmt.Errorf("unable to execute delete: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get rows affected: %w", err)
 	}
-	defer rows.Close()
 
-	return &proto.TruncateResponse{}, nil
+	return &proto.DeleteResponse{DeletedCount: deleted}, nil
+}
+
+// getTx will return the transaction assigned to the context. If no transaction has been assigned to the context, nil
+// is returned.
+func (pg *Postgres) getTx(ctx context.Context) (*sql.Tx, error) {
+	txID, ok := ctx.Value(basicPostgressTxID).(string)
+	if !ok {
+		return nil, nil
+	}
+
+	stored, ok := pg.activeTx.Load(txID)
+	if !ok {
+		return nil, nil
+	}
+
+	tx, ok := stored.(*sql.Tx)
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+
+	return tx, nil
 }
 
 // getPrepareContextFn will return a function that can prepare an upsert statement for a given table.
 func (pg *Postgres) getPrepareContextFn(ctx context.Context) (sqlPrepareContextFn, error) {
 	// First check to see if a transaction has been assigned to the context. If it has, use the transaction.
 	// Otherwise, use the database.
-	txID, ok := ctx.Value(basicPostgressTxID).(string)
-	if ok {
-		if tx, ok := pg.activeTx.Load(txID); ok {
-			tx, ok := tx.(*sql.Tx)
-			if !ok {
-				return nil, ErrTransactionNotFound
-			}
+	tx, err := pg.getTx(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-			return tx.PrepareContext, nil
-		}
+	if tx != nil {
+		return tx.PrepareContext, nil
 	}
 
 	return pg.DB.PrepareContext, nil
 }
 
+// isPGRecordError will return true if the error is caused by the data in a record, i.e. a data exception or an
+// integrity constraint violation, rather than by the statement or the connection.
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+func isPGRecordError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	switch pqErr.Code.Class() {
+	case "22", "23":
+		return true
+	default:
+		return false
+	}
+}
+
+// withSavepoint will execute fn within a savepoint on the transaction. If fn fails, the transaction is rolled back to
+// the savepoint so that it can continue to be used. If there is no transaction, fn is executed directly.
+func withSavepoint(ctx context.Context, tx *sql.Tx, fn func() error) error {
+	if tx == nil {
+		return fn()
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SAVEPOINT %s", pgUpsertSavepoint)); err != nil {
+		return fmt.Errorf("unable to create savepoint: %w", err)
+	}
+
+	if err := fn(); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", pgUpsertSavepoint)); rbErr != nil {
+			return fmt.Errorf("unable to rollback to savepoint: %v: %w", rbErr, err)
+		}
+
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("RELEASE SAVEPOINT %s", pgUpsertSavepoint)); err != nil {
+		return fmt.Errorf("unable to release savepoint: %w", err)
+	}
+
+	return nil
+}
+
+// upsertPartition will upsert a partition of records in a single statement, returning the number of rows affected.
+func (pg *Postgres) upsertPartition(ctx context.Context, table string, pcf sqlPrepareContextFn,
+	partition []*structpb.Struct,
+) (int64, error) {
+	stmt, err := pg.meta.upsertStmt(ctx, table, pcf, len(partition))
+	if err != nil {
+		return 0, fmt.Errorf("unable to prepare statement: %w", err)
+	}
+
+	arguments := tools.SQLFlattenPartition(pg.meta.cols[table], partition)
+
+	result, err := stmt.ExecContext(ctx, arguments...)
+	if err != nil {
+		return 0, fmt.Errorf("unable to execute upsert: %w", err)
+	}
+
+	// Postgres does not distinguish between inserted and updated rows for an "ON CONFLICT DO UPDATE" statement, so
+	// every affected row is counted as upserted.
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("unable to get rows affected: %w", err)
+	}
+
+	return affected, nil
+}
+
 // Upsert will insert the records on the request if they do not exist in the database. On conflict, it will use the
 // PK on the request record to update the data in the database. An upsert request will update the entire table
 // for a given record, include fields that have not been set directly.
+//
+// If a partition of records fails because of the data in a record, e.g. a constraint violation, then the records in
+// the partition are upserted one at a time and the records that fail are returned as errors on the response.
 func (pg *Postgres) Upsert(ctx context.Context, req *proto.UpsertRequest) (*proto.UpsertResponse, error) {
 	pg.writeMutex.Lock()
 	defer pg.writeMutex.Unlock()
@@ -283,6 +705,11 @@ func (pg *Postgres) Upsert(ctx context.Context, req *proto.UpsertRequest) (*prot
 		return &proto.UpsertResponse{}, nil
 	}
 
+	tx, err := pg.getTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get transaction: %w", err)
+	}
+
 	prepareContextFn, err := pg.getPrepareContextFn(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get preparer: %w", err)
@@ -293,23 +720,72 @@ func (pg *Postgres) Upsert(ctx context.Context, req *proto.UpsertRequest) (*prot
 	}
 
 	table := req.GetTable()
+	rsp := new(proto.UpsertResponse)
+	offset := 0
 
 	// Upsert 1000 records at a time, the maximum number of records that can be inserted in a single statement on a
 	// postgres database.
 	for _, partition := range tools.PartitionStructs(pgPartitionSize, records) {
-		stmt, err := pg.meta.upsertStmt(ctx, table, prepareContextFn, len(partition))
-		if err != nil {
-			return nil, fmt.Errorf("unable to prepare statement: %w", err)
+		partition := partition
+
+		var affected int64
+
+		err := withSavepoint(ctx, tx, func() error {
+			var err error
+			affected, err = pg.upsertPartition(ctx, table, prepareContextFn, partition)
+
+			return err
+		})
+
+		switch {
+		case err == nil:
+			rsp.UpsertedCount += affected
+		case isPGRecordError(err):
+			if err := pg.upsertRecords(ctx, table, tx, prepareContextFn, partition, offset, rsp); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, err
 		}
 
-		// Execute upsert.
-		arguments := tools.SQLFlattenPartition(pg.meta.cols[table], partition)
-		if _, err := stmt.ExecContext(ctx, arguments...); err != nil {
-			return nil, fmt.Errorf("unable to execute upsert: %w", err)
+		offset += len(partition)
+	}
+
+	return rsp, nil
+}
+
+// upsertRecords will upsert the records one at a time, adding the records that fail because of their data to the
+// errors on the response.
+func (pg *Postgres) upsertRecords(ctx context.Context, table string, tx *sql.Tx, pcf sqlPrepareContextFn,
+	records []*structpb.Struct, offset int, rsp *proto.UpsertResponse,
+) error {
+	for idx, record := range records {
+		record := record
+
+		var affected int64
+
+		err := withSavepoint(ctx, tx, func() error {
+			var err error
+			affected, err = pg.upsertPartition(ctx, table, pcf, []*structpb.Struct{record})
+
+			return err
+		})
+
+		switch {
+		case err == nil:
+			rsp.UpsertedCount += affected
+		case isPGRecordError(err):
+			rsp.Errors = append(rsp.Errors, &proto.RecordError{
+				Index:   int64(offset + idx),
+				Message: err.Error(),
+				Record:  record,
+			})
+		default:
+			return err
 		}
 	}
 
-	return &proto.UpsertResponse{}, nil
+	return nil
 }
 
 // Postgres is a wrapper around the sql.DB object.
@@ -400,52 +876,212 @@ func (pg *Postgres) setMaxOpenConns() {
 // StartTx will start a transaction on the Postgres connection. The transaction ID is returned and should be used
 // to commit or rollback the transaction.
 func (pg *Postgres) StartTx(ctx context.Context) (*Txn, error) {
-	// Construct a gidari storage transaction.
-	txn := &Txn{
-		make(chan TxnChanFn),
-		make(chan error, 1),
-		make(chan bool, 1),
-	}
-
 	// Instantiate a new transaction on the Postgres connection and store it in the activeTx map.
 	txnID := uuid.New().String()
 
 	pgtx, err := pg.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return txn, fmt.Errorf("failed to start transaction: %w", err)
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
 
 	pg.activeTx.Store(txnID, pgtx)
 
-	// Create a copy of the parent context with a transaction ID.
-	pgCtx := context.WithValue(ctx, basicPostgressTxID, txnID)
+	// end will end the transaction and remove it from the activeTx map.
+	end := func(fn func() error) func() error {
+		return func() error {
+			defer pg.activeTx.Delete(txnID)
 
-	go func() {
-		defer func() {
-			// Remove the transaction from the activeTx map.
-			pg.activeTx.Delete(txnID)
-		}()
+			return fn()
+		}
+	}
 
-		for fn := range txn.ch {
-			if err != nil {
-				continue
+	return NewTxn(ctx, pg, TxnHooks{
+		// Create a copy of the operation context with a transaction ID.
+		Context: func(ctx context.Context) context.Context {
+			return context.WithValue(ctx, basicPostgressTxID, txnID)
+		},
+		Commit:   end(pgtx.Commit),
+		Rollback: end(pgtx.Rollback),
+	}), nil
+}
+
+// TryLock will acquire a session level advisory lock on the hash of the key, with a connection that is held until the
+// lock is released.
+func (pg *Postgres) TryLock(ctx context.Context, key string) (func() error, error) {
+	conn, err := pg.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get connection: %w", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&locked); err != nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("unable to acquire advisory lock: %w", err)
+	}
+
+	if !locked {
+		conn.Close()
+
+		return nil, LockedError(key)
+	}
+
+	return func() error {
+		defer conn.Close()
+
+		// The lock is released with the context of the caller canceled, e.g. after an operation is interrupted.
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", key); err != nil {
+			return fmt.Errorf("unable to release advisory lock: %w", err)
+		}
+
+		return nil
+	}, nil
+}
+
+// Scan will call fn with every row of a table. The rows are read outside of any transaction assigned to the context.
+func (pg *Postgres) Scan(ctx context.Context, table string, fn func(record map[string]interface{}) error) error {
+	rows, err := pg.DB.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s", pq.QuoteIdentifier(table)))
+	if err != nil {
+		return fmt.Errorf("unable to query table: %w", err)
+	}
+
+	return pgScanRows(rows, fn)
+}
+
+// Find will call fn with every row of a table that matches any of the keys, reading on the transaction assigned to
+// the context if there is one. The keys are queried in partitions, so that a statement does not exceed the maximum
+// number of parameters.
+func (pg *Postgres) Find(ctx context.Context, table string, keys []map[string]interface{},
+	fn func(record map[string]interface{}) error,
+) error {
+	tx, err := pg.getTx(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get transaction: %w", err)
+	}
+
+	query := pg.DB.QueryContext
+	if tx != nil {
+		query = tx.QueryContext
+	}
+
+	for start := 0; start < len(keys); start += pgPartitionSize {
+		end := start + pgPartitionSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var (
+			conditions []string
+			args       []interface{}
+		)
+
+		for _, key := range keys[start:end] {
+			fields := make([]string, 0, len(key))
+			for field := range key {
+				fields = append(fields, field)
+			}
+
+			sort.Strings(fields)
+
+			terms := make([]string, len(fields))
+			for idx, field := range fields {
+				args = append(args, key[field])
+				terms[idx] = fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(field), len(args))
 			}
 
-			err = fn(pgCtx, pg)
+			if len(terms) > 0 {
+				conditions = append(conditions, "("+strings.Join(terms, " AND ")+")")
+			}
+		}
+
+		if len(conditions) == 0 {
+			continue
 		}
 
+		rows, err := query(ctx, fmt.Sprintf("SELECT * FROM %s WHERE %s", pq.QuoteIdentifier(table),
+			strings.Join(conditions, " OR ")), args...)
 		if err != nil {
-			txn.done <- err
+			return fmt.Errorf("unable to query table: %w", err)
+		}
 
-			return
+		if err := pgScanRows(rows, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pgScanRows will call fn with every row, closing the rows once they are read.
+func pgScanRows(rows *sql.Rows, fn func(record map[string]interface{}) error) error {
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("unable to get column types: %w", err)
+	}
+
+	for rows.Next() {
+		vals := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+
+		for idx := range vals {
+			ptrs[idx] = &vals[idx]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("unable to scan row: %w", err)
+		}
+
+		record := make(map[string]interface{}, len(columns))
+
+		for idx, column := range columns {
+			val, err := pgScanValue(column.DatabaseTypeName(), vals[idx])
+			if err != nil {
+				return fmt.Errorf("unable to decode column %q: %w", column.Name(), err)
+			}
+
+			if val != nil {
+				record[column.Name()] = val
+			}
+		}
+
+		if err := fn(record); err != nil {
+			return err
 		}
+	}
 
-		if <-txn.commit {
-			txn.done <- pgtx.Commit()
-		} else {
-			txn.done <- pgtx.Rollback()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("unable to iterate rows: %w", err)
+	}
+
+	return nil
+}
+
+// pgScanValue will convert the value of a column of the database type to the type of its JSON value.
+func pgScanValue(databaseType string, val interface{}) (interface{}, error) {
+	switch val := val.(type) {
+	case []byte:
+		switch databaseType {
+		case "JSON", "JSONB":
+			var decoded interface{}
+			if err := json.Unmarshal(val, &decoded); err != nil {
+				return nil, fmt.Errorf("unable to decode json: %w", err)
+			}
+
+			return decoded, nil
+		case "NUMERIC":
+			if num, err := strconv.ParseFloat(string(val), 64); err == nil {
+				return num, nil
+			}
 		}
-	}()
 
-	return txn, nil
+		return string(val), nil
+	case int64:
+		return float64(val), nil
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano), nil
+	default:
+		return val, nil
+	}
 }
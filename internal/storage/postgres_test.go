@@ -10,9 +10,15 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/lib/pq"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func TestPGMeta(t *testing.T) {
@@ -150,3 +156,229 @@ func TestPGMeta(t *testing.T) {
 		})
 	}
 }
+
+func TestPGDeleteStmt(t *testing.T) {
+	t.Parallel()
+
+	required, err := structpb.NewStruct(map[string]interface{}{"product_id": "BTC-USD", "exchange": "cb"})
+	if err != nil {
+		t.Fatalf("failed to create struct: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		req      *proto.DeleteRequest
+		query    string
+		expected []interface{}
+	}{
+		{
+			name:  "no scope",
+			req:   &proto.DeleteRequest{Table: "candles"},
+			query: `DELETE FROM "candles"`,
+		},
+		{
+			name:     "quoted identifiers",
+			req:      &proto.DeleteRequest{Table: "Candles", RangeField: `my"time`, RangeStart: "2022-05-10T00:00:00Z"},
+			query:    `DELETE FROM "Candles" WHERE "my""time" >= $1`,
+			expected: []interface{}{"2022-05-10T00:00:00Z"},
+		},
+		{
+			name:     "required fields",
+			req:      &proto.DeleteRequest{Table: "candles", Required: required},
+			query:    `DELETE FROM "candles" WHERE "exchange" = $1 AND "product_id" = $2`,
+			expected: []interface{}{"cb", "BTC-USD"},
+		},
+		{
+			name: "required fields and range",
+			req: &proto.DeleteRequest{
+				Table:      "candles",
+				Required:   required,
+				RangeField: "time",
+				RangeStart: "2022-05-10T00:00:00Z",
+				RangeEnd:   "2022-05-11T00:00:00Z",
+			},
+			query: `DELETE FROM "candles" WHERE "exchange" = $1 AND "product_id" = $2 AND "time" >= $3 AND ` +
+				`"time" < $4`,
+			expected: []interface{}{"cb", "BTC-USD", "2022-05-10T00:00:00Z", "2022-05-11T00:00:00Z"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			query, args := new(pgmeta).deleteStmt(test.req)
+			if query != test.query {
+				t.Errorf("expected query %q, got %q", test.query, query)
+			}
+
+			if !reflect.DeepEqual(args, test.expected) {
+				t.Errorf("expected args %v, got %v", test.expected, args)
+			}
+		})
+	}
+}
+
+func TestPGCreateTableStmts(t *testing.T) {
+	t.Parallel()
+
+	req := &proto.CreateTableRequest{
+		Table: "candles",
+		Columns: []*proto.Column{
+			{Name: "product_id", Type: ColumnTypeString, Required: true},
+			{Name: "time", Type: ColumnTypeTimestamp, Required: true},
+			{Name: "close", Type: ColumnTypeNumber},
+		},
+		PrimaryKeys: []string{"product_id", "time"},
+		Indexes: []*proto.Index{
+			{Columns: []string{"time"}},
+			{Name: "candles_close", Columns: []string{"close", "time"}, Unique: true},
+		},
+	}
+
+	stmts, err := createTableStmts(req)
+	if err != nil {
+		t.Fatalf("failed to create statements: %v", err)
+	}
+
+	expected := []string{
+		`CREATE TABLE IF NOT EXISTS "candles" ("product_id" text NOT NULL, "time" timestamptz NOT NULL, ` +
+			`"close" double precision, PRIMARY KEY ("product_id", "time"))`,
+		`CREATE INDEX IF NOT EXISTS "candles_time_idx" ON "candles" ("time")`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "candles_close" ON "candles" ("close", "time")`,
+	}
+
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("expected statements %q, got %q", expected, stmts)
+	}
+
+	req.Columns[0].Type = "uuid"
+	if _, err := createTableStmts(req); !errors.Is(err, ErrUnknownColumnType) {
+		t.Errorf("expected error %v, got %v", ErrUnknownColumnType, err)
+	}
+}
+
+func TestPGCreatePartitionStmts(t *testing.T) {
+	t.Parallel()
+
+	req := &proto.CreateTableRequest{
+		Table:       "candles",
+		Columns:     []*proto.Column{{Name: "time", Type: ColumnTypeTimestamp, Required: true}},
+		PrimaryKeys: []string{"time"},
+		PartitionBy: "time",
+	}
+
+	stmts, err := createTableStmts(req)
+	if err != nil {
+		t.Fatalf("failed to create statements: %v", err)
+	}
+
+	expected := []string{
+		`CREATE TABLE IF NOT EXISTS "candles" ("time" timestamptz NOT NULL, PRIMARY KEY ("time")) ` +
+			`PARTITION BY RANGE ("time")`,
+	}
+
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("expected statements %q, got %q", expected, stmts)
+	}
+
+	stmts, err = createTableStmts(&proto.CreateTableRequest{
+		Table: "candles_2024_05",
+		PartitionOf: &proto.PartitionOf{
+			Table: "candles",
+			Start: "2024-05-01T00:00:00Z",
+			End:   "2024-06-01T00:00:00Z",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create statements: %v", err)
+	}
+
+	expected = []string{
+		`CREATE TABLE IF NOT EXISTS "candles_2024_05" PARTITION OF "candles" ` +
+			`FOR VALUES FROM ('2024-05-01T00:00:00Z') TO ('2024-06-01T00:00:00Z')`,
+	}
+
+	if !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("expected statements %q, got %q", expected, stmts)
+	}
+}
+
+func TestTruncateOrder(t *testing.T) {
+	t.Parallel()
+
+	// orders and fills reference products, fills reference orders, and products references itself.
+	refs := map[string][]string{
+		"orders":   {"products"},
+		"fills":    {"orders", "products"},
+		"products": {"products"},
+		"audits":   {"accounts"},
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		tables   []string
+		expected []string
+		outside  bool
+	}{
+		{
+			name:     "dependencies",
+			tables:   []string{"products", "orders", "fills"},
+			expected: []string{"fills", "orders", "products"},
+		},
+		{
+			name:     "independent",
+			tables:   []string{"candles", "products", "fills", "orders"},
+			expected: []string{"candles", "fills", "orders", "products"},
+		},
+		{
+			name:     "referenced outside",
+			tables:   []string{"products", "orders"},
+			expected: []string{"orders", "products"},
+			outside:  true,
+		},
+		{
+			name:     "referencing outside",
+			tables:   []string{"audits"},
+			expected: []string{"audits"},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if ordered := truncateOrder(tcase.tables, refs); !reflect.DeepEqual(ordered, tcase.expected) {
+				t.Errorf("expected order %v, got %v", tcase.expected, ordered)
+			}
+
+			if outside := referencedOutside(tcase.tables, refs); outside != tcase.outside {
+				t.Errorf("expected referenced outside to be %v, got %v", tcase.outside, outside)
+			}
+		})
+	}
+
+	if quoted := pgQuoteIdentifiers([]string{"fills", "Orders"}); quoted != `"fills","Orders"` {
+		t.Errorf("expected quoted tables, got %s", quoted)
+	}
+}
+
+func TestIsPGRecordError(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		err      error
+		expected bool
+	}{
+		{err: &pq.Error{Code: "23505"}, expected: true},
+		{err: fmt.Errorf("wrapped: %w", &pq.Error{Code: "22001"}), expected: true},
+		{err: &pq.Error{Code: "42P01"}, expected: false},
+		{err: sql.ErrConnDone, expected: false},
+	} {
+		if actual := isPGRecordError(tcase.err); actual != tcase.expected {
+			t.Errorf("isPGRecordError(%v) = %t; want %t", tcase.err, actual, tcase.expected)
+		}
+	}
+}
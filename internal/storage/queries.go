@@ -19,3 +19,6 @@ var pgTruncatedTables []byte
 
 //go:embed queries/pg_garbage_collect.sql
 var pgGarbageCollect []byte
+
+//go:embed queries/pg_foreign_keys.sql
+var pgForeignKeys []byte
@@ -0,0 +1,8 @@
+SELECT DISTINCT tc.table_name,
+       ccu.table_name AS referenced_table_name
+FROM information_schema.table_constraints tc
+    INNER JOIN information_schema.constraint_column_usage ccu
+        ON ccu.constraint_name = tc.constraint_name
+           AND ccu.constraint_schema = tc.constraint_schema
+WHERE tc.constraint_type = 'FOREIGN KEY'
+      AND tc.table_schema = 'public'
@@ -0,0 +1,97 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Factory will construct a storage backend from a DNS.
+type Factory func(ctx context.Context, dns string) (Storage, error)
+
+// registry holds the storage backends added with Register, by the scheme of their DNS.
+var registry = struct {
+	sync.RWMutex
+
+	factories map[string]Factory
+
+	// schemes are the schemes of the types of the constructed backends, for Scheme.
+	schemes map[uint8]string
+}{
+	factories: make(map[string]Factory),
+	schemes:   make(map[uint8]string),
+}
+
+// Register will add a storage backend that is constructed by the factory for a DNS with the scheme, e.g.
+// "mydb" for "mydb://localhost:9000/db". Registered backends take precedence over the built-in storage,
+// but the schemes of the built-in storage can not be registered. The Type of a registered backend should not be the
+// type of another storage.
+//
+// Register is meant to be called from the init function of the package of a backend. It panics if the factory is nil,
+// or if the scheme is empty or already registered.
+func Register(scheme string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if factory == nil {
+		panic("storage: Register factory is nil")
+	}
+
+	if scheme == "" || scheme == Scheme(MongoType) || scheme == Scheme(PostgresType) ||
+		scheme == Scheme(ClickHouseType) || scheme == Scheme(DuckDBType) || scheme == Scheme(ElasticsearchType) ||
+		scheme == esOpenSearchScheme {
+		panic(fmt.Sprintf("storage: Register of invalid scheme %q", scheme))
+	}
+
+	if _, dup := registry.factories[scheme]; dup {
+		panic(fmt.Sprintf("storage: Register called twice for scheme %q", scheme))
+	}
+
+	registry.factories[scheme] = factory
+}
+
+// registered will construct the registered backend of the scheme of the DNS. The second value is false if the scheme
+// is not registered.
+func registered(ctx context.Context, dns string) (Storage, bool, error) {
+	scheme, _, ok := strings.Cut(dns, "://")
+	if !ok {
+		return nil, false, nil
+	}
+
+	registry.RLock()
+	factory, ok := registry.factories[scheme]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	stg, err := factory(ctx, dns)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to construct %s storage: %w", scheme, err)
+	}
+
+	registry.Lock()
+	registry.schemes[stg.Type()] = scheme
+	registry.Unlock()
+
+	return stg, true, nil
+}
+
+// registeredScheme will return the scheme of a constructed registered backend by its type.
+func registeredScheme(t uint8) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	scheme, ok := registry.schemes[t]
+
+	return scheme, ok
+}
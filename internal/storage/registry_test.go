@@ -0,0 +1,177 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// fakeStorage is a storage backend for testing the registry, which records the operations of its transactions.
+type fakeStorage struct {
+	Storage
+
+	t   uint8
+	dns string
+	ops []string
+}
+
+func (fake *fakeStorage) Type() uint8 { return fake.t }
+
+func (fake *fakeStorage) StartTx(ctx context.Context) (*Txn, error) {
+	return NewTxn(ctx, fake, TxnHooks{
+		Commit:   func() error { fake.ops = append(fake.ops, "commit"); return nil },
+		Rollback: func() error { fake.ops = append(fake.ops, "rollback"); return nil },
+	}), nil
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	const fakeType uint8 = 200
+
+	errFactory := fmt.Errorf("factory error")
+
+	Register("fakedb", func(_ context.Context, dns string) (Storage, error) {
+		return &fakeStorage{t: fakeType, dns: dns}, nil
+	})
+
+	Register("brokendb", func(context.Context, string) (Storage, error) {
+		return nil, errFactory
+	})
+
+	t.Run("new", func(t *testing.T) {
+		t.Parallel()
+
+		svc, err := New(context.Background(), "fakedb://localhost:1234/db")
+		if err != nil {
+			t.Fatalf("failed to construct registered storage: %v", err)
+		}
+
+		if dns := svc.Storage.(*fakeStorage).dns; dns != "fakedb://localhost:1234/db" {
+			t.Fatalf("expected the factory to receive the dns, got %q", dns)
+		}
+
+		if scheme := Scheme(fakeType); scheme != "fakedb" {
+			t.Fatalf("expected the scheme of the registered type to be %q, got %q", "fakedb", scheme)
+		}
+	})
+
+	t.Run("factory error", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := New(context.Background(), "brokendb://localhost"); !errors.Is(err, errFactory) {
+			t.Fatalf("expected error %v, got %v", errFactory, err)
+		}
+	})
+
+	t.Run("not registered", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := New(context.Background(), "otherdb://localhost"); !errors.Is(err, ErrDNSNotSupported) {
+			t.Fatalf("expected error %v, got %v", ErrDNSNotSupported, err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		factory := func(context.Context, string) (Storage, error) { return &fakeStorage{}, nil }
+
+		for _, tcase := range []struct {
+			name    string
+			scheme  string
+			factory Factory
+		}{
+			{"duplicate", "fakedb", factory},
+			{"built-in", "postgresql", factory},
+			{"empty", "", factory},
+			{"nil factory", "nildb", nil},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				defer func() {
+					if recover() == nil {
+						t.Fatalf("expected Register to panic")
+					}
+				}()
+
+				Register(tcase.scheme, tcase.factory)
+			})
+		}
+	})
+}
+
+func TestNewTxn(t *testing.T) {
+	t.Parallel()
+
+	errOperation := fmt.Errorf("operation error")
+
+	for _, tcase := range []struct {
+		name     string
+		fail     bool
+		commit   bool
+		expected []string
+	}{
+		{"commit", false, true, []string{"op", "op", "commit"}},
+		{"rollback", false, false, []string{"op", "op", "rollback"}},
+		{"rollback on error", true, true, []string{"op", "rollback"}},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := &fakeStorage{}
+
+			txn, err := fake.StartTx(context.Background())
+			if err != nil {
+				t.Fatalf("failed to start transaction: %v", err)
+			}
+
+			txn.Send(func(_ context.Context, stg Storage) error {
+				stg.(*fakeStorage).ops = append(stg.(*fakeStorage).ops, "op")
+
+				if tcase.fail {
+					return errOperation
+				}
+
+				return nil
+			})
+
+			txn.Send(func(_ context.Context, stg Storage) error {
+				stg.(*fakeStorage).ops = append(stg.(*fakeStorage).ops, "op")
+
+				return nil
+			})
+
+			end := txn.Rollback
+			if tcase.commit {
+				end = txn.Commit
+			}
+
+			err = end()
+			if tcase.fail && !errors.Is(err, errOperation) {
+				t.Fatalf("expected error %v, got %v", errOperation, err)
+			}
+
+			if !tcase.fail && err != nil {
+				t.Fatalf("failed to end transaction: %v", err)
+			}
+
+			if fmt.Sprint(fake.ops) != fmt.Sprint(tcase.expected) {
+				t.Fatalf("expected operations %v, got %v", tcase.expected, fake.ops)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrScanNotSupported is returned when scanning a table of a storage device that does not implement Scanner.
+var ErrScanNotSupported = fmt.Errorf("scan is not supported")
+
+// ScanNotSupportedError wraps an error with ErrScanNotSupported.
+func ScanNotSupportedError(scheme string) error {
+	return fmt.Errorf("%w: %s", ErrScanNotSupported, scheme)
+}
+
+// Scanner is implemented by the storage devices that can read every record of a table, e.g. to verify the data of a
+// table. Scanner is optional for the storage backends added with Register.
+type Scanner interface {
+	// Scan will call fn with every record of the table, in no particular order. The values of the records are
+	// decoded to the types of JSON: strings, float64s, booleans, maps, and slices. Null values are omitted, and
+	// timestamps are RFC 3339 strings in UTC. Scan stops at the first error returned by fn.
+	Scan(ctx context.Context, table string, fn func(record map[string]interface{}) error) error
+}
+
+// Scan will call fn with every record of the table on the storage device, or return ErrScanNotSupported if the
+// storage device does not implement Scanner.
+func Scan(ctx context.Context, stg Storage, table string, fn func(record map[string]interface{}) error) error {
+	if svc, ok := stg.(*Service); ok {
+		stg = svc.Storage
+	}
+
+	scanner, ok := stg.(Scanner)
+	if !ok {
+		return ScanNotSupportedError(Scheme(stg.Type()))
+	}
+
+	if err := scanner.Scan(ctx, table, fn); err != nil {
+		return fmt.Errorf("unable to scan table %q: %w", table, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScanValues(t *testing.T) {
+	t.Parallel()
+
+	moment := time.Date(2022, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	for _, tcase := range []struct {
+		name     string
+		pgType   string
+		pgVal    interface{}
+		mongoVal interface{}
+		expected interface{}
+	}{
+		{
+			name:     "integer",
+			pgType:   "INT8",
+			pgVal:    int64(42),
+			mongoVal: int32(42),
+			expected: float64(42),
+		},
+		{
+			name:     "numeric",
+			pgType:   "NUMERIC",
+			pgVal:    []byte("1.50"),
+			mongoVal: 1.5,
+			expected: 1.5,
+		},
+		{
+			name:     "text",
+			pgType:   "TEXT",
+			pgVal:    []byte("BTC-USD"),
+			mongoVal: "BTC-USD",
+			expected: "BTC-USD",
+		},
+		{
+			name:     "timestamp",
+			pgType:   "TIMESTAMPTZ",
+			pgVal:    moment.In(time.FixedZone("EST", -5*60*60)),
+			mongoVal: primitive.NewDateTimeFromTime(moment),
+			expected: "2022-05-01T12:30:00Z",
+		},
+		{
+			name:     "json",
+			pgType:   "JSONB",
+			pgVal:    []byte(`{"a":[1,"b"]}`),
+			mongoVal: primitive.D{{Key: "a", Value: primitive.A{int64(1), "b"}}},
+			expected: map[string]interface{}{"a": []interface{}{float64(1), "b"}},
+		},
+		{
+			name:     "null",
+			pgType:   "TEXT",
+			pgVal:    nil,
+			mongoVal: primitive.Null{},
+			expected: nil,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			pgVal, err := pgScanValue(tcase.pgType, tcase.pgVal)
+			if err != nil {
+				t.Fatalf("error decoding postgres value: %v", err)
+			}
+
+			if !reflect.DeepEqual(pgVal, tcase.expected) {
+				t.Fatalf("expected postgres value %#v, got %#v", tcase.expected, pgVal)
+			}
+
+			if mongoVal := mongoScanValue(tcase.mongoVal); !reflect.DeepEqual(mongoVal, tcase.expected) {
+				t.Fatalf("expected mongo value %#v, got %#v", tcase.expected, mongoVal)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Server serves a storage as the Storage service of the proto package, e.g. registered on a gRPC server with
+// proto.RegisterStorageServer.
+type Server struct {
+	proto.UnimplementedStorageServer
+
+	stg Storage
+}
+
+// NewServer will return a server of the Storage service for the storage.
+func NewServer(stg Storage) *Server {
+	return &Server{stg: stg}
+}
+
+// CreateTable will create a table and its indexes on the storage if they do not exist.
+func (srv *Server) CreateTable(ctx context.Context, req *proto.CreateTableRequest) (*proto.CreateTableResponse,
+	error,
+) {
+	return srv.stg.CreateTable(ctx, req)
+}
+
+// Delete will delete the records in a table of the storage that are within the scope of the request.
+func (srv *Server) Delete(ctx context.Context, req *proto.DeleteRequest) (*proto.DeleteResponse, error) {
+	return srv.stg.Delete(ctx, req)
+}
+
+// ListPrimaryKeys will return the primary keys of the tables of the storage.
+func (srv *Server) ListPrimaryKeys(ctx context.Context, _ *emptypb.Empty) (*proto.ListPrimaryKeysResponse, error) {
+	return srv.stg.ListPrimaryKeys(ctx)
+}
+
+// ListTables will return the tables of the storage.
+func (srv *Server) ListTables(ctx context.Context, _ *emptypb.Empty) (*proto.ListTablesResponse, error) {
+	return srv.stg.ListTables(ctx)
+}
+
+// Truncate will delete the records of the tables of the storage.
+func (srv *Server) Truncate(ctx context.Context, req *proto.TruncateRequest) (*proto.TruncateResponse, error) {
+	return srv.stg.Truncate(ctx, req)
+}
+
+// Upsert will insert or update a batch of records on the storage.
+func (srv *Server) Upsert(ctx context.Context, req *proto.UpsertRequest) (*proto.UpsertResponse, error) {
+	return srv.stg.Upsert(ctx, req)
+}
+
+// TruncateBatch will truncate the tables of the batch on the storage, see TruncateBatch.
+func (srv *Server) TruncateBatch(ctx context.Context, req *proto.TruncateBatchRequest) (*proto.TruncateBatchResponse,
+	error,
+) {
+	return TruncateBatch(ctx, srv.stg, req)
+}
+
+// UpsertStream will upsert the batches of the stream on the storage, see ServeUpsertStream.
+func (srv *Server) UpsertStream(stream proto.Storage_UpsertStreamServer) error {
+	return ServeUpsertStream(stream.Context(), srv.stg, stream)
+}
+
+// TruncateBatch will execute the truncates of the batch on the storage in order, returning their responses and the
+// number of records they deleted. It returns with the error of the first truncate that fails, in which case the
+// truncates after it are not executed.
+func TruncateBatch(ctx context.Context, stg Storage, req *proto.TruncateBatchRequest) (*proto.TruncateBatchResponse,
+	error,
+) {
+	batch := &proto.TruncateBatchResponse{}
+
+	for idx, truncate := range req.GetRequests() {
+		rsp, err := stg.Truncate(ctx, truncate)
+		if err != nil {
+			return nil, fmt.Errorf("unable to truncate request %d of batch: %w", idx, err)
+		}
+
+		batch.Responses = append(batch.Responses, rsp)
+		batch.DeletedCount += rsp.GetDeletedCount()
+	}
+
+	return batch, nil
+}
+
+// UpsertStream is the server side of a client stream of upsert batches, e.g. of the UpsertStream RPC of the Storage
+// service. Recv returns io.EOF once the client is done sending batches.
+type UpsertStream interface {
+	Recv() (*proto.UpsertBatch, error)
+	SendAndClose(*proto.UpsertStreamResponse) error
+}
+
+// ServeUpsertStream will upsert the batches of the stream on the storage in the order they are received. Once the
+// client is done sending batches, the stream is closed with an acknowledgement of every batch with the counts of its
+// records. It returns with the error of the first batch that fails, in which case the batches after it are not
+// upserted.
+func ServeUpsertStream(ctx context.Context, stg Storage, stream UpsertStream) error {
+	rsp := &proto.UpsertStreamResponse{}
+
+	for {
+		batch, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to receive upsert batch: %w", err)
+		}
+
+		upserted, err := stg.Upsert(ctx, batch.GetRequest())
+		if err != nil {
+			return fmt.Errorf("unable to upsert batch %d: %w", batch.GetSequence(), err)
+		}
+
+		rsp.Acks = append(rsp.Acks, &proto.UpsertAck{
+			Sequence:      batch.GetSequence(),
+			UpsertedCount: upserted.GetUpsertedCount(),
+			MatchedCount:  upserted.GetMatchedCount(),
+			Errors:        upserted.GetErrors(),
+		})
+
+		rsp.UpsertedCount += upserted.GetUpsertedCount()
+		rsp.MatchedCount += upserted.GetMatchedCount()
+	}
+
+	if err := stream.SendAndClose(rsp); err != nil {
+		return fmt.Errorf("unable to acknowledge upsert batches: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// recordCounter is a storage that counts the records of each upsert and truncate.
+type recordCounter struct {
+	Storage
+
+	tables []string
+}
+
+func (counter *recordCounter) Upsert(_ context.Context, req *proto.UpsertRequest) (*proto.UpsertResponse, error) {
+	if req.Table == "" {
+		return nil, fmt.Errorf("no table")
+	}
+
+	var records []map[string]interface{}
+	if err := json.Unmarshal(req.Data, &records); err != nil {
+		return nil, fmt.Errorf("unable to decode records: %w", err)
+	}
+
+	counter.tables = append(counter.tables, req.Table)
+
+	return &proto.UpsertResponse{UpsertedCount: int64(len(records))}, nil
+}
+
+func (counter *recordCounter) Truncate(_ context.Context, req *proto.TruncateRequest) (*proto.TruncateResponse,
+	error,
+) {
+	if len(req.Tables) == 0 {
+		return nil, fmt.Errorf("no tables")
+	}
+
+	counter.tables = append(counter.tables, req.Tables...)
+
+	return &proto.TruncateResponse{DeletedCount: int32(len(req.Tables))}, nil
+}
+
+// sliceStream is an upsert stream of a slice of batches.
+type sliceStream struct {
+	batches []*proto.UpsertBatch
+	rsp     *proto.UpsertStreamResponse
+}
+
+func (stream *sliceStream) Recv() (*proto.UpsertBatch, error) {
+	if len(stream.batches) == 0 {
+		return nil, io.EOF
+	}
+
+	batch := stream.batches[0]
+	stream.batches = stream.batches[1:]
+
+	return batch, nil
+}
+
+func (stream *sliceStream) SendAndClose(rsp *proto.UpsertStreamResponse) error {
+	stream.rsp = rsp
+
+	return nil
+}
+
+func TestServeUpsertStream(t *testing.T) {
+	t.Parallel()
+
+	t.Run("acknowledges every batch", func(t *testing.T) {
+		t.Parallel()
+
+		counter := &recordCounter{}
+		stream := &sliceStream{batches: []*proto.UpsertBatch{
+			{Sequence: 1, Request: &proto.UpsertRequest{Table: "candles", Data: []byte(`[{"id":1}]`)}},
+			{Sequence: 2, Request: &proto.UpsertRequest{Table: "fills", Data: []byte(`[{"id":1},{"id":2}]`)}},
+		}}
+
+		if err := ServeUpsertStream(context.Background(), counter, stream); err != nil {
+			t.Fatalf("error serving stream: %v", err)
+		}
+
+		if len(counter.tables) != 2 || counter.tables[1] != "fills" {
+			t.Fatalf("expected 2 batches to be upserted in order, got %v", counter.tables)
+		}
+
+		if len(stream.rsp.Acks) != 2 || stream.rsp.UpsertedCount != 3 {
+			t.Fatalf("expected 2 acks of 3 records, got %v", stream.rsp)
+		}
+
+		for idx, expected := range []int64{1, 2} {
+			if ack := stream.rsp.Acks[idx]; ack.Sequence != int64(idx+1) || ack.UpsertedCount != expected {
+				t.Fatalf("unexpected ack %d: %v", idx, ack)
+			}
+		}
+	})
+
+	t.Run("stops at the first failed batch", func(t *testing.T) {
+		t.Parallel()
+
+		counter := &recordCounter{}
+		stream := &sliceStream{batches: []*proto.UpsertBatch{
+			{Sequence: 1, Request: &proto.UpsertRequest{}},
+			{Sequence: 2, Request: &proto.UpsertRequest{Table: "fills", Data: []byte(`[]`)}},
+		}}
+
+		err := ServeUpsertStream(context.Background(), counter, stream)
+		if err == nil || stream.rsp != nil || len(counter.tables) != 0 {
+			t.Fatalf("expected the stream to fail at the first batch, got %v", err)
+		}
+
+		if errors.Is(err, io.EOF) {
+			t.Fatalf("unexpected end of stream")
+		}
+	})
+}
+
+func TestTruncateBatch(t *testing.T) {
+	t.Parallel()
+
+	counter := &recordCounter{}
+
+	rsp, err := TruncateBatch(context.Background(), counter, &proto.TruncateBatchRequest{
+		Requests: []*proto.TruncateRequest{{Tables: []string{"candles"}}, {Tables: []string{"fills", "orders"}}},
+	})
+	if err != nil {
+		t.Fatalf("error truncating batch: %v", err)
+	}
+
+	if len(rsp.Responses) != 2 || rsp.DeletedCount != 3 || len(counter.tables) != 3 {
+		t.Fatalf("expected 2 truncates of 3 tables, got %v", rsp)
+	}
+
+	_, err = TruncateBatch(context.Background(), counter, &proto.TruncateBatchRequest{
+		Requests: []*proto.TruncateRequest{{}, {Tables: []string{"trades"}}},
+	})
+	if err == nil || len(counter.tables) != 3 {
+		t.Fatalf("expected the batch to fail at the first truncate, got %v", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	listener := bufconn.Listen(1 << 20)
+
+	server := grpc.NewServer()
+	proto.RegisterStorageServer(server, NewServer(&recordCounter{}))
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			t.Errorf("error serving: %v", err)
+		}
+	}()
+
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }))
+	if err != nil {
+		t.Fatalf("error dialing: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	client := proto.NewStorageClient(conn)
+	ctx := context.Background()
+
+	stream, err := client.UpsertStream(ctx)
+	if err != nil {
+		t.Fatalf("error opening stream: %v", err)
+	}
+
+	for seq, data := range []string{`[{"id":1},{"id":2}]`, `[{"id":3}]`} {
+		batch := &proto.UpsertBatch{Sequence: int64(seq), Request: &proto.UpsertRequest{Table: "fills", Data: []byte(data)}}
+		if err := stream.Send(batch); err != nil {
+			t.Fatalf("error sending batch: %v", err)
+		}
+	}
+
+	rsp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("error closing stream: %v", err)
+	}
+
+	if len(rsp.Acks) != 2 || rsp.UpsertedCount != 3 {
+		t.Fatalf("expected 2 acks of 3 records, got %v", rsp)
+	}
+
+	batch, err := client.TruncateBatch(ctx, &proto.TruncateBatchRequest{
+		Requests: []*proto.TruncateRequest{{Tables: []string{"fills"}}},
+	})
+	if err != nil || batch.DeletedCount != 1 {
+		t.Fatalf("expected the batch to truncate 1 table, got %v: %v", batch, err)
+	}
+}
@@ -22,13 +22,36 @@ const (
 
 	// PostgresType is the byte representation of a postgres database.
 	PostgresType
+
+	// ClickHouseType is the byte representation of a clickhouse database.
+	ClickHouseType
+
+	// DuckDBType is the byte representation of a duckdb database.
+	DuckDBType
+
+	// ElasticsearchType is the byte representation of an elasticsearch or opensearch cluster.
+	ElasticsearchType
+)
+
+// Column types of a table definition.
+const (
+	ColumnTypeString    = "string"
+	ColumnTypeInteger   = "integer"
+	ColumnTypeNumber    = "number"
+	ColumnTypeBoolean   = "boolean"
+	ColumnTypeTimestamp = "timestamp"
+	ColumnTypeJSON      = "json"
 )
 
 var (
 	ErrDNSNotSupported     = fmt.Errorf("dns is not supported")
+	ErrUnknownColumnType   = fmt.Errorf("unknown column type")
 	ErrTransactionNotFound = fmt.Errorf("transaction not found")
 	ErrNoTables            = fmt.Errorf("no tables found")
 	ErrTransactionAborted  = fmt.Errorf("transaction aborted")
+
+	// ErrDuckDBNotSupported is returned for a duckdb DNS by builds without cgo, which the duckdb driver requires.
+	ErrDuckDBNotSupported = fmt.Errorf("duckdb is not supported without cgo")
 )
 
 // DNSNotSupported wraps an error with ErrDNSNotSupported.
@@ -36,11 +59,22 @@ func DNSNotSupportedError(dns string) error {
 	return fmt.Errorf("%w: %s", ErrDNSNotSupported, dns)
 }
 
+// UnknownColumnTypeError wraps an error with ErrUnknownColumnType.
+func UnknownColumnTypeError(column, columnType string) error {
+	return fmt.Errorf("%w: %q for column %q", ErrUnknownColumnType, columnType, column)
+}
+
 // Storage is an interface that defines the methods that a storage device should implement.
 type Storage interface {
 	// Close will disconnect the storage device.
 	Close()
 
+	// CreateTable will create a table and its indexes if they do not exist.
+	CreateTable(context.Context, *proto.CreateTableRequest) (*proto.CreateTableResponse, error)
+
+	// Delete will delete the records in a table that are within the scope of the request.
+	Delete(context.Context, *proto.DeleteRequest) (*proto.DeleteResponse, error)
+
 	// ListPrimaryKeys will return a list of primary keys for all tables in the database.
 	ListPrimaryKeys(ctx context.Context) (*proto.ListPrimaryKeysResponse, error)
 
@@ -75,7 +109,17 @@ func Scheme(t uint8) string {
 		return "mongodb"
 	case PostgresType:
 		return "postgresql"
+	case ClickHouseType:
+		return "clickhouse"
+	case DuckDBType:
+		return "duckdb"
+	case ElasticsearchType:
+		return "elasticsearch"
 	default:
+		if scheme, ok := registeredScheme(t); ok {
+			return scheme
+		}
+
 		return "unknown"
 	}
 }
@@ -85,8 +129,17 @@ type Service struct {
 	Storage
 }
 
-// New will attempt to return a generic storage object given a DNS.
+// New will attempt to return a generic storage object given a DNS. Storage backends added with Register are resolved
+// by the scheme of the DNS before the built-in storage.
 func New(ctx context.Context, dns string) (*Service, error) {
+	if svc, ok, err := registered(ctx, dns); ok {
+		if err != nil {
+			return nil, err
+		}
+
+		return &Service{svc}, nil
+	}
+
 	if strings.Contains(dns, Scheme(MongoType)) {
 		svc, err := NewMongo(ctx, dns)
 		if err != nil {
@@ -105,5 +158,32 @@ func New(ctx context.Context, dns string) (*Service, error) {
 		return &Service{svc}, nil
 	}
 
+	if strings.HasPrefix(dns, Scheme(ClickHouseType)+"://") {
+		svc, err := NewClickHouse(ctx, dns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct clickhouse storage: %w", err)
+		}
+
+		return &Service{svc}, nil
+	}
+
+	if strings.HasPrefix(dns, Scheme(DuckDBType)+"://") {
+		svc, err := newDuckDBStorage(ctx, dns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct duckdb storage: %w", err)
+		}
+
+		return &Service{svc}, nil
+	}
+
+	if strings.HasPrefix(dns, Scheme(ElasticsearchType)+"://") || strings.HasPrefix(dns, esOpenSearchScheme+"://") {
+		svc, err := NewElasticsearch(ctx, dns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct elasticsearch storage: %w", err)
+		}
+
+		return &Service{svc}, nil
+	}
+
 	return nil, DNSNotSupportedError(dns)
 }
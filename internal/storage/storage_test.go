@@ -422,3 +422,29 @@ func TestListPrimaryKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestTxnSendContext(t *testing.T) {
+	t.Parallel()
+
+	type ctxKey struct{}
+
+	txnCtx := context.WithValue(context.Background(), ctxKey{}, "txn")
+	opCtx := context.WithValue(context.Background(), ctxKey{}, "op")
+
+	txn := newTxn(txnCtx)
+
+	go func() {
+		txn.Send(func(context.Context, Storage) error { return nil })
+		txn.SendContext(opCtx, func(context.Context, Storage) error { return nil })
+		close(txn.ch)
+	}()
+
+	var values []interface{}
+	for op := range txn.ch {
+		values = append(values, op.ctx.Value(ctxKey{}))
+	}
+
+	if expected := []interface{}{"txn", "op"}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected operation contexts %v, got %v", expected, values)
+	}
+}
@@ -14,11 +14,29 @@ import (
 // TxnChanFn is a function that will be sent to the transaction channel.
 type TxnChanFn func(context.Context, Storage) error
 
+// txnOp is a function sent to the transaction channel, along with the context of the operation.
+type txnOp struct {
+	ctx context.Context
+	fn  TxnChanFn
+}
+
 // Txn is a wrapper for a mongo session that can be used to perform CRUD operations on a mongo DB instance.
 type Txn struct {
-	ch     chan TxnChanFn
+	ch     chan txnOp
 	done   chan error
 	commit chan bool
+
+	// ctx is the context the transaction was started with, which is used for operations sent without a context.
+	ctx context.Context
+}
+
+func newTxn(ctx context.Context) *Txn {
+	return &Txn{
+		ch:     make(chan txnOp),
+		done:   make(chan error, 1),
+		commit: make(chan bool, 1),
+		ctx:    ctx,
+	}
 }
 
 // Transactor is an interface that can be used to perform CRUD operations within the context of a database transaction.
@@ -26,6 +44,7 @@ type Transactor interface {
 	Commit() error
 	Rollback() error
 	Send(TxnChanFn)
+	SendContext(context.Context, TxnChanFn)
 }
 
 // Commit will commit the transaction.
@@ -44,7 +63,80 @@ func (txn *Txn) Rollback() error {
 	return <-txn.done
 }
 
-// Send will send a function to the transaction channel.
+// Send will send a function to the transaction channel. The function is executed with the context that the
+// transaction was started with.
 func (txn *Txn) Send(fn TxnChanFn) {
-	txn.ch <- fn
+	txn.SendContext(txn.ctx, fn)
+}
+
+// SendContext will send a function to the transaction channel. The function is executed with a context that carries
+// the transaction and the values, deadline, and cancellation of ctx, so that a stuck storage operation can be canceled
+// by the caller.
+func (txn *Txn) SendContext(ctx context.Context, fn TxnChanFn) {
+	txn.ch <- txnOp{ctx: ctx, fn: fn}
+}
+
+// TxnHooks are the functions of a storage backend that end a transaction started with NewTxn.
+type TxnHooks struct {
+	// Context will return the context that an operation of the transaction is executed with, e.g. to carry the
+	// transaction of the backend. Operations are executed with the context they were sent with if it is nil.
+	Context func(context.Context) context.Context
+
+	// Commit will commit the operations of the transaction.
+	Commit func() error
+
+	// Rollback will rollback the operations of the transaction.
+	Rollback func() error
+}
+
+// NewTxn will return a transaction that executes the operations sent to it on the storage, in the order they are sent.
+// Once the transaction is committed or rolled back, the hook of the decision is called. If an operation fails, the
+// operations after it are skipped, the transaction is rolled back, and the error is returned by the decision.
+//
+// NewTxn is the building block of the StartTx method of storage backends that are added with Register.
+func NewTxn(ctx context.Context, stg Storage, hooks TxnHooks) *Txn {
+	txn := newTxn(ctx)
+
+	go func() {
+		var err error
+
+		for op := range txn.ch {
+			if err != nil {
+				continue
+			}
+
+			opctx := op.ctx
+			if hooks.Context != nil {
+				opctx = hooks.Context(opctx)
+			}
+
+			err = op.fn(opctx, stg)
+		}
+
+		if err != nil {
+			// Release the locks and connection of the failed transaction.
+			if hooks.Rollback != nil {
+				_ = hooks.Rollback()
+			}
+
+			txn.done <- err
+
+			return
+		}
+
+		end := hooks.Rollback
+		if <-txn.commit {
+			end = hooks.Commit
+		}
+
+		if end == nil {
+			txn.done <- nil
+
+			return
+		}
+
+		txn.done <- end()
+	}()
+
+	return txn
 }
@@ -0,0 +1,366 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// archiveFileMode is the file mode of the archived responses, which can contain sensitive data.
+	archiveFileMode = 0o600
+
+	// archiveDirMode is the file mode of the directories of the archive.
+	archiveDirMode = 0o700
+
+	// archiveExt is the extension of the archived responses.
+	archiveExt = ".json"
+)
+
+var (
+	// ErrArchiveDisabled is returned when replaying with a configuration that does not have an archive.
+	ErrArchiveDisabled = fmt.Errorf("archive is not configured")
+
+	// ErrInvalidArchive is returned when the archive of the configuration is invalid.
+	ErrInvalidArchive = fmt.Errorf("invalid archive")
+)
+
+// Archive stores the raw body of every response that is upserted, so that the responses can be replayed through the
+// decoding and transform stages with Replay, e.g. after the envelope, normalizers, or schemas of the requests change,
+// without making the requests again. The archived responses are encrypted with the state encryption, if it is
+// configured.
+type Archive struct {
+	// Dir is the directory of the archive. The responses of each table are archived in a directory named after the
+	// table, in a file per response.
+	Dir string `yaml:"dir"`
+}
+
+// validate will ensure that the archive is valid.
+func (archive *Archive) validate() error {
+	if archive != nil && archive.Dir == "" {
+		return fmt.Errorf("%w: dir is required", ErrInvalidArchive)
+	}
+
+	return nil
+}
+
+// archivedResponse is a response in the archive.
+type archivedResponse struct {
+	// Table is the table of the request of the response.
+	Table string `json:"table"`
+
+	// URL is the URL of the request of the response.
+	URL string `json:"url"`
+
+	// FetchedAt is the time the response was received.
+	FetchedAt time.Time `json:"fetchedAt"`
+
+	// Header is the header of the response, for the response headers that are captured.
+	Header http.Header `json:"header,omitempty"`
+
+	// Body is the raw body of the response.
+	Body []byte `json:"body"`
+}
+
+// archiveWriter writes the responses of an upsert operation to the archive. A nil archiveWriter does not archive the
+// responses.
+type archiveWriter struct {
+	dir    string
+	cipher *stateCipher
+}
+
+// newArchiveWriter will return the writer of the archive, or nil if the archive is not configured.
+func newArchiveWriter(archive *Archive, sc *stateCipher) *archiveWriter {
+	if archive == nil {
+		return nil
+	}
+
+	return &archiveWriter{dir: archive.Dir, cipher: sc}
+}
+
+// write will archive the raw body of the response of a request for the table. The files are named after the time the
+// response was received, so that they are replayed in the order they were received.
+func (aw *archiveWriter) write(table string, rsp *web.FetchResponse, body []byte) error {
+	if aw == nil {
+		return nil
+	}
+
+	entry := &archivedResponse{
+		Table:     table,
+		URL:       rsp.Request.URL.String(),
+		FetchedAt: time.Now().UTC(),
+		Header:    rsp.Header,
+		Body:      body,
+	}
+
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal archived response: %w", err)
+	}
+
+	if bytes, err = aw.cipher.seal(bytes); err != nil {
+		return fmt.Errorf("unable to encrypt archived response: %w", err)
+	}
+
+	dir := filepath.Join(aw.dir, url.PathEscape(table))
+	if err := os.MkdirAll(dir, archiveDirMode); err != nil {
+		return fmt.Errorf("unable to create archive directory: %w", err)
+	}
+
+	entropy := make([]byte, runIDEntropy)
+	if _, err := rand.Read(entropy); err != nil {
+		return fmt.Errorf("unable to generate archive file name: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s%s", entry.FetchedAt.Format("20060102T150405.000000000Z"),
+		hex.EncodeToString(entropy), archiveExt)
+
+	if err := os.WriteFile(filepath.Join(dir, name), bytes, archiveFileMode); err != nil {
+		return fmt.Errorf("unable to write archived response: %w", err)
+	}
+
+	return nil
+}
+
+// archivedFiles will return the files of the archived responses, in the order they were received.
+func (archive *Archive) archivedFiles() ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(archive.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() && filepath.Ext(path) == archiveExt {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list archived responses: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) < filepath.Base(files[j]) })
+
+	return files, nil
+}
+
+// readArchivedResponse will read an archived response, decrypting it with the state cipher.
+func readArchivedResponse(file string, sc *stateCipher) (*archivedResponse, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read archived response: %w", err)
+	}
+
+	if bytes, err = sc.open(bytes); err != nil {
+		return nil, err
+	}
+
+	entry := new(archivedResponse)
+	if err := json.Unmarshal(bytes, entry); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal archived response %q: %w", file, err)
+	}
+
+	return entry, nil
+}
+
+// replayRequest will return the request of the configuration that an archived response is replayed with: the request
+// for the table of the response, or, if several requests are for the table, the one with the endpoint of the URL of
+// the response. Nil is returned if no request is for the table.
+func replayRequest(requests []*Request, entry *archivedResponse) *Request {
+	var match *Request
+
+	rurl, err := url.Parse(entry.URL)
+	if err != nil {
+		rurl = &url.URL{}
+	}
+
+	for _, req := range requests {
+		if req.Table != entry.Table || req.Sink != nil {
+			continue
+		}
+
+		endpoint := path.Join("/", strings.SplitN(req.Endpoint, "?", 2)[0])
+		if strings.HasSuffix(rurl.Path, endpoint) {
+			return req
+		}
+
+		if match == nil {
+			match = req
+		}
+	}
+
+	return match
+}
+
+// replayJob will return the repository job of an archived response, decoded and transformed with the request.
+func replayJob(req *Request, entry *archivedResponse, lineage map[string]interface{}) (*repoJob, error) {
+	rurl, err := url.Parse(entry.URL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse archived URL: %w", err)
+	}
+
+	flatReq := &flattenedRequest{
+		fetchConfig:  &web.FetchConfig{Method: req.Method, URL: rurl},
+		table:        req.Table,
+		split:        req.Split,
+		headers:      req.ResponseHeaders,
+		singletonKey: req.singletonKey(),
+		envelope:     req.Envelope,
+		normalizers:  req.Normalize,
+		projection:   req.projection(),
+	}
+
+	if req.Timeseries != nil {
+		flatReq.downsample = req.Timeseries.Downsample
+	}
+
+	records, page, err := newDecoder(flatReq.envelope).decode(entry.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRepoJob(flatReq, entry.Header, records, page, lineage), nil
+}
+
+// Replay will upsert the archived responses of the configuration without making any web requests. Each response is
+// decoded and transformed with the current settings of its request, i.e. the envelope, normalizers, split, singleton,
+// and response headers, and validated against the current schemas, so that the data can be reprocessed after the
+// settings or the schemas change. The tables are not truncated, and the scoped deletes, staleness guards, and limits
+// of the requests do not apply. The responses are replayed in the order they were received, in a single transaction
+// on each storage, and the responses of tables that no request is for are skipped.
+func Replay(ctx context.Context, cfg *Config) (*UpsertResult, error) {
+	start := time.Now()
+
+	if cfg.Archive == nil {
+		return nil, ErrArchiveDisabled
+	}
+
+	release, err := cfg.Lock.acquire(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	files, err := cfg.Archive.archivedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := cfg.expandRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := cfg.StateEncryption.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := createSchemas(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	repoConfig, err := newRepoConfig(withoutCancel(ctx), cfg, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	defer repoConfig.closeRepos()
+
+	defer func() {
+		if err := repoConfig.deadLetter.close(); err != nil {
+			tools.LogEvent{Msg: err.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+		}
+	}()
+
+	lineage := cfg.Lineage.fields(repoConfig.result.RunID)
+
+	if err := replayFiles(ctx, repoConfig, files, requests, sc, lineage); err != nil {
+		for _, repo := range repoConfig.repos {
+			if rbErr := repo.Rollback(); rbErr != nil {
+				tools.LogEvent{Msg: "unable to rollback", Err: rbErr}.Log(cfg.Logger, logrus.ErrorLevel)
+			}
+		}
+
+		return nil, err
+	}
+
+	for _, repo := range repoConfig.repos {
+		if err := repo.Commit(); err != nil {
+			return nil, fmt.Errorf("unable to commit transaction: %w", err)
+		}
+	}
+
+	logInfo := tools.LogEvent{
+		Duration: time.Since(start),
+		Msg:      "replay completed",
+		Count:    len(files),
+		RunID:    repoConfig.result.RunID,
+	}
+	logInfo.Log(cfg.Logger, logrus.InfoLevel)
+
+	return repoConfig.result, nil
+}
+
+// replayFiles will send the upserts of the archived responses to the transactions of the repositories.
+func replayFiles(ctx context.Context, repoConfig *repoConfig, files []string, requests []*Request,
+	sc *stateCipher, lineage map[string]interface{},
+) error {
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return fmt.Errorf("replay canceled: %w", ctx.Err())
+		}
+
+		entry, err := readArchivedResponse(file, sc)
+		if err != nil {
+			return err
+		}
+
+		req := replayRequest(requests, entry)
+		if req == nil {
+			logWarn := tools.LogEvent{Msg: "skipping archived response without a request for its table", Table: entry.Table}
+			logWarn.Log(repoConfig.logger, logrus.WarnLevel)
+
+			continue
+		}
+
+		job, err := replayJob(req, entry, lineage)
+		if err == nil {
+			var upserts []*partitionedUpsert
+			if upserts, err = prepareUpserts(ctx, repoConfig, job); err == nil {
+				err = transactUpserts(ctx, 1, repoConfig, job, upserts)
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to replay %q: %w", file, err)
+		}
+	}
+
+	return transactDownsamples(ctx, repoConfig)
+}
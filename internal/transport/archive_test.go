@@ -0,0 +1,235 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		if err := (&Archive{}).validate(); !errors.Is(err, ErrInvalidArchive) {
+			t.Fatalf("expected error %v, got %v", ErrInvalidArchive, err)
+		}
+
+		if err := (*Archive)(nil).validate(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("write and read", func(t *testing.T) {
+		t.Parallel()
+
+		key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, stateKeySize))
+
+		sc, err := (&StateEncryption{Key: key}).cipher()
+		if err != nil {
+			t.Fatalf("failed to create cipher: %v", err)
+		}
+
+		archive := &Archive{Dir: t.TempDir()}
+		writer := newArchiveWriter(archive, sc)
+
+		for _, body := range []string{`[{"id":1}]`, `[{"id":2}]`} {
+			rsp := &web.FetchResponse{
+				Request: &http.Request{URL: &url.URL{Scheme: "https", Host: "api.test.com", Path: "/orders"}},
+				Header:  http.Header{"Cb-After": {"42"}},
+			}
+
+			if err := writer.write("orders/open", rsp, []byte(body)); err != nil {
+				t.Fatalf("failed to archive response: %v", err)
+			}
+		}
+
+		files, err := archive.archivedFiles()
+		if err != nil {
+			t.Fatalf("failed to list archived responses: %v", err)
+		}
+
+		if len(files) != 2 {
+			t.Fatalf("expected 2 archived responses, got %d", len(files))
+		}
+
+		for idx, expected := range []string{`[{"id":1}]`, `[{"id":2}]`} {
+			raw, err := os.ReadFile(files[idx])
+			if err != nil {
+				t.Fatalf("failed to read archived response: %v", err)
+			}
+
+			if bytes.Contains(raw, []byte("orders")) {
+				t.Fatalf("expected the archived response to be encrypted: %s", raw)
+			}
+
+			entry, err := readArchivedResponse(files[idx], sc)
+			if err != nil {
+				t.Fatalf("failed to read archived response: %v", err)
+			}
+
+			if entry.Table != "orders/open" || string(entry.Body) != expected || entry.Header.Get("CB-AFTER") != "42" {
+				t.Fatalf("unexpected archived response %d: %+v", idx, entry)
+			}
+		}
+
+		if _, err := readArchivedResponse(files[0], nil); !errors.Is(err, ErrDecryptState) {
+			t.Fatalf("expected error %v, got %v", ErrDecryptState, err)
+		}
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		t.Parallel()
+
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"id":1}]`))
+		}))
+		defer testServer.Close()
+
+		archive := &Archive{Dir: t.TempDir()}
+
+		cfg, err := NewConfig([]byte(fmt.Sprintf(`
+url: %s
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /candles
+`, testServer.URL)))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		requests, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error flattening requests: %v", err)
+		}
+
+		job := &webJob{flattenedRequest: requests[0], logger: cfg.Logger, archive: newArchiveWriter(archive, nil)}
+		if _, _, _, err := fetch(context.Background(), job); err != nil {
+			t.Fatalf("error fetching: %v", err)
+		}
+
+		files, err := archive.archivedFiles()
+		if err != nil || len(files) != 1 {
+			t.Fatalf("expected 1 archived response, got %d (%v)", len(files), err)
+		}
+
+		entry, err := readArchivedResponse(files[0], nil)
+		if err != nil {
+			t.Fatalf("failed to read archived response: %v", err)
+		}
+
+		if entry.Table != "candles" || string(entry.Body) != `[{"id":1}]` {
+			t.Fatalf("unexpected archived response: %+v", entry)
+		}
+	})
+
+	t.Run("nil writer", func(t *testing.T) {
+		t.Parallel()
+
+		if err := newArchiveWriter(nil, nil).write("orders", nil, nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestReplayRequest(t *testing.T) {
+	t.Parallel()
+
+	requests := []*Request{
+		{Endpoint: "/export", Table: "orders", Sink: &Sink{File: "orders.jsonl"}},
+		{Endpoint: "/orders/open", Table: "orders"},
+		{Endpoint: "/orders/closed?limit=100", Table: "orders"},
+		{Endpoint: "/fills", Table: "fills"},
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		entry    *archivedResponse
+		expected *Request
+	}{
+		{"endpoint", &archivedResponse{Table: "orders", URL: "https://api.test.com/v1/orders/closed?limit=100"}, requests[2]},
+		{"table", &archivedResponse{Table: "orders", URL: "https://api.test.com/orders/all"}, requests[1]},
+		{"single", &archivedResponse{Table: "fills", URL: "https://api.test.com/fills"}, requests[3]},
+		{"missing", &archivedResponse{Table: "trades", URL: "https://api.test.com/trades"}, nil},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if req := replayRequest(requests, tcase.entry); req != tcase.expected {
+				t.Fatalf("expected request %+v, got %+v", tcase.expected, req)
+			}
+		})
+	}
+}
+
+func TestReplayJob(t *testing.T) {
+	t.Parallel()
+
+	req := &Request{
+		Method:          http.MethodGet,
+		Table:           "candles",
+		Envelope:        &Envelope{Records: "data", NextCursor: "next"},
+		ResponseHeaders: []*ResponseHeader{{Header: "X-Request-Id", Field: "requestId"}},
+	}
+
+	entry := &archivedResponse{
+		Table:  "candles",
+		URL:    "https://api.test.com/candles",
+		Header: http.Header{"X-Request-Id": {"abc"}},
+		Body:   []byte(`{"data":[{"id":1}],"next":"c2"}`),
+	}
+
+	job, err := replayJob(req, entry, map[string]interface{}{"gidariRunId": "run"})
+	if err != nil {
+		t.Fatalf("failed to create replay job: %v", err)
+	}
+
+	if string(job.b) != `[{"id":1}]` || job.table != "candles" {
+		t.Fatalf("unexpected replay job records %s for %q", job.b, job.table)
+	}
+
+	expected := map[string]interface{}{"requestId": "abc", "gidariRunId": "run"}
+	if !reflect.DeepEqual(job.fields, expected) {
+		t.Fatalf("expected fields %v, got %v", expected, job.fields)
+	}
+
+	reqs, err := newUpsertRequests(job)
+	if err != nil {
+		t.Fatalf("failed to create upsert requests: %v", err)
+	}
+
+	if len(reqs) != 1 || reqs[0].Table != "candles" {
+		t.Fatalf("unexpected upsert requests: %v", reqs)
+	}
+
+	entry.Body = []byte(`[{"id":1}]`)
+	if _, err := replayJob(req, entry, nil); err == nil {
+		t.Fatal("expected an error decoding a response without the envelope")
+	}
+
+	if _, err := Replay(context.Background(), &Config{}); !errors.Is(err, ErrArchiveDisabled) {
+		t.Fatalf("expected error %v, got %v", ErrArchiveDisabled, err)
+	}
+}
@@ -0,0 +1,476 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+// defaultAuditTable is the default table of the audit records.
+const defaultAuditTable = "gidari_audit"
+
+// ErrInvalidAudit is returned when the audit of the configuration is invalid.
+var ErrInvalidAudit = fmt.Errorf("invalid audit")
+
+// InvalidAuditError wraps an error with ErrInvalidAudit.
+func InvalidAuditError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidAudit, msg)
+}
+
+// Audit logs every upsert that overwrites an existing record with different values into an audit table, with the key
+// of the record, the columns that changed, and their old and new values. The existing records are read by their
+// primary keys on the transaction of the upsert, so the audit records are committed or rolled back with it.
+//
+// The audit records of a run on a storage form a hash chain: every audit record has a sequence number, the hash of
+// the audit record before it, and the SHA-256 hash of its own content, so that an audit record that is changed or
+// removed breaks the chain.
+type Audit struct {
+	// Table is the table of the audit records, the default is "gidari_audit". It is created if it does not exist.
+	Table string `yaml:"table"`
+
+	// Tables are the tables whose upserts are audited, the default is every table.
+	Tables []string `yaml:"tables"`
+}
+
+// validate will ensure that the audit is valid.
+func (audit *Audit) validate() error {
+	if audit == nil {
+		return nil
+	}
+
+	for _, table := range audit.Tables {
+		if table == audit.table() {
+			return InvalidAuditError(fmt.Sprintf("the audit table %q can not be audited", table))
+		}
+	}
+
+	return nil
+}
+
+// table will return the table of the audit records.
+func (audit *Audit) table() string {
+	if audit.Table == "" {
+		return defaultAuditTable
+	}
+
+	return audit.Table
+}
+
+// audits will return true if the upserts of the table are audited.
+func (audit *Audit) audits(table string) bool {
+	if audit == nil || table == audit.table() {
+		return false
+	}
+
+	if len(audit.Tables) == 0 {
+		return true
+	}
+
+	for _, audited := range audit.Tables {
+		if audited == table {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createTableRequest will return the request to create the audit table.
+func (audit *Audit) createTableRequest() *proto.CreateTableRequest {
+	return &proto.CreateTableRequest{
+		Table: audit.table(),
+		Columns: []*proto.Column{
+			{Name: "hash", Type: "string", Required: true},
+			{Name: "previousHash", Type: "string"},
+			{Name: "sequence", Type: "integer", Required: true},
+			{Name: "runId", Type: "string", Required: true},
+			{Name: "tableName", Type: "string", Required: true},
+			{Name: "key", Type: "json", Required: true},
+			{Name: "columns", Type: "json", Required: true},
+			{Name: "oldValues", Type: "json"},
+			{Name: "newValues", Type: "json"},
+			{Name: "changedAt", Type: "timestamp", Required: true},
+		},
+		PrimaryKeys: []string{"hash"},
+	}
+}
+
+// auditEntry is a record of the audit table.
+type auditEntry struct {
+	Hash         string                 `json:"hash,omitempty"`
+	PreviousHash string                 `json:"previousHash"`
+	Sequence     int64                  `json:"sequence"`
+	RunID        string                 `json:"runId"`
+	TableName    string                 `json:"tableName"`
+	Key          map[string]interface{} `json:"key"`
+	Columns      []string               `json:"columns"`
+	OldValues    map[string]interface{} `json:"oldValues"`
+	NewValues    map[string]interface{} `json:"newValues"`
+	ChangedAt    string                 `json:"changedAt"`
+}
+
+// sum will return the SHA-256 hash of the JSON encoding of the entry without its hash. The fields of the key and
+// values are encoded in sorted order, so the hash of an entry read back from storage can be verified.
+func (entry *auditEntry) sum() (string, error) {
+	unhashed := *entry
+	unhashed.Hash = ""
+
+	data, err := json.Marshal(unhashed)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode audit record: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// auditChange is the audit record of a record of an upsert request, which overwrites an existing record.
+type auditChange struct {
+	// index is the index of the record on the upsert request.
+	index int64
+
+	entry *auditEntry
+}
+
+// auditChain is the hash chain of the audit records of a run on a repository.
+type auditChain struct {
+	sequence int64
+	hash     string
+}
+
+// recordFinder reads the records of a table by their keys.
+type recordFinder interface {
+	Find(ctx context.Context, table string, keys []map[string]interface{},
+		fn func(record map[string]interface{}) error) error
+}
+
+// auditor writes the audit records of the upserts of a run.
+type auditor struct {
+	mutex sync.Mutex
+	audit *Audit
+	runID string
+
+	// ignore are the fields that are not compared, i.e. the run ID of the lineage, which differs on every run.
+	ignore map[string]bool
+
+	// keys are the primary keys of the audited tables, keyed by the repository index and the table.
+	keys map[string][]string
+
+	// created are the repositories, by index, that the audit table has been created on.
+	created map[int]bool
+
+	// chains are the hash chains of the repositories, by index.
+	chains map[int]*auditChain
+
+	now func() time.Time
+}
+
+// newAuditor will return the auditor of the run, or nil if the audit is not configured.
+func newAuditor(audit *Audit, runID string, lineage *Lineage) *auditor {
+	if audit == nil {
+		return nil
+	}
+
+	ignore := make(map[string]bool)
+	if lineage != nil {
+		ignore[lineage.field()] = true
+	}
+
+	return &auditor{
+		audit:   audit,
+		runID:   runID,
+		ignore:  ignore,
+		keys:    make(map[string][]string),
+		created: make(map[int]bool),
+		chains:  make(map[int]*auditChain),
+		now:     time.Now,
+	}
+}
+
+// create will create the audit table on the repository at the index, if the table is audited and the audit table has
+// not been created on the repository.
+func (aud *auditor) create(ctx context.Context, repoIdx int, repo repository.Generic, table string) error {
+	if aud == nil || !aud.audit.audits(table) {
+		return nil
+	}
+
+	aud.mutex.Lock()
+	defer aud.mutex.Unlock()
+
+	if aud.created[repoIdx] {
+		return nil
+	}
+
+	if _, err := repo.CreateTable(ctx, aud.audit.createTableRequest()); err != nil {
+		return fmt.Errorf("unable to create audit table %q: %w", aud.audit.table(), err)
+	}
+
+	aud.created[repoIdx] = true
+
+	return nil
+}
+
+// primaryKeys will return the primary keys of the table on the repository at the index. The keys are cached once the
+// table exists.
+func (aud *auditor) primaryKeys(ctx context.Context, repoIdx int, repo repository.Generic,
+	table string,
+) ([]string, error) {
+	id := fmt.Sprintf("%d/%s", repoIdx, table)
+
+	aud.mutex.Lock()
+	keys, ok := aud.keys[id]
+	aud.mutex.Unlock()
+
+	if ok {
+		return keys, nil
+	}
+
+	rsp, err := repo.ListPrimaryKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list primary keys: %w", err)
+	}
+
+	keys = rsp.GetPKSet()[table].GetList()
+	if len(keys) > 0 {
+		aud.mutex.Lock()
+		aud.keys[id] = keys
+		aud.mutex.Unlock()
+	}
+
+	return keys, nil
+}
+
+// changes will return the audit records of the records of the upsert request that overwrite existing records of the
+// repository with different values. Records without a value for every primary key can not overwrite a record.
+func (aud *auditor) changes(ctx context.Context, repoIdx int, repo repository.Generic,
+	req *proto.UpsertRequest,
+) ([]*auditChange, error) {
+	if aud == nil || !aud.audit.audits(req.Table) {
+		return nil, nil
+	}
+
+	keys, err := aud.primaryKeys(ctx, repoIdx, repo, req.Table)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	records, err := tools.DecodeUpsertRecords(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode records: %w", err)
+	}
+
+	incoming := make([]map[string]interface{}, len(records))
+	byKey := make(map[string]int)
+	lookups := make([]map[string]interface{}, 0, len(records))
+
+	for idx, record := range records {
+		incoming[idx] = record.AsMap()
+
+		key, id, ok := auditKey(incoming[idx], keys)
+		if !ok {
+			continue
+		}
+
+		// The last record with a key is the one that is stored.
+		if _, ok := byKey[id]; !ok {
+			lookups = append(lookups, key)
+		}
+
+		byKey[id] = idx
+	}
+
+	finder, ok := repo.(recordFinder)
+	if !ok {
+		return nil, storage.FindNotSupportedError(storage.Scheme(repo.Type()))
+	}
+
+	var changes []*auditChange
+
+	err = finder.Find(ctx, req.Table, lookups, func(existing map[string]interface{}) error {
+		key, id, ok := auditKey(existing, keys)
+		if !ok {
+			return nil
+		}
+
+		idx, ok := byKey[id]
+		if !ok {
+			return nil
+		}
+
+		columns, oldValues, newValues := diffRecord(existing, incoming[idx], aud.ignore)
+		if len(columns) == 0 {
+			return nil
+		}
+
+		changes = append(changes, &auditChange{index: int64(idx), entry: &auditEntry{
+			TableName: req.Table,
+			Key:       key,
+			Columns:   columns,
+			OldValues: oldValues,
+			NewValues: newValues,
+		}})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read existing records: %w", err)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].index < changes[j].index })
+
+	return changes, nil
+}
+
+// write will chain the audit records of the changes and upsert them into the audit table of the repository at the
+// index. The changes of the records that failed to upsert are not written.
+func (aud *auditor) write(ctx context.Context, repoIdx int, repo repository.Generic, changes []*auditChange,
+	errs []*proto.RecordError,
+) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	failed := make(map[int64]bool, len(errs))
+	for _, recordErr := range errs {
+		failed[recordErr.GetIndex()] = true
+	}
+
+	aud.mutex.Lock()
+	defer aud.mutex.Unlock()
+
+	chain, ok := aud.chains[repoIdx]
+	if !ok {
+		chain = &auditChain{}
+		aud.chains[repoIdx] = chain
+	}
+
+	entries := make([]*auditEntry, 0, len(changes))
+	changedAt := aud.now().UTC().Format(time.RFC3339Nano)
+
+	for _, change := range changes {
+		if failed[change.index] {
+			continue
+		}
+
+		entry := change.entry
+		entry.PreviousHash = chain.hash
+		entry.Sequence = chain.sequence + 1
+		entry.RunID = aud.runID
+		entry.ChangedAt = changedAt
+
+		hash, err := entry.sum()
+		if err != nil {
+			return err
+		}
+
+		entry.Hash = hash
+		chain.hash, chain.sequence = hash, entry.Sequence
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit records: %w", err)
+	}
+
+	req := &proto.UpsertRequest{Table: aud.audit.table(), Data: data, DataType: int32(tools.UpsertDataJSON)}
+	if _, err := repo.Upsert(ctx, req); err != nil {
+		return fmt.Errorf("unable to upsert audit records: %w", err)
+	}
+
+	return nil
+}
+
+// auditKey will return the values of the primary keys of the record, and their encoding to match the records of the
+// storage with the records of the request. It returns false if the record does not have every primary key.
+func auditKey(record map[string]interface{}, keys []string) (map[string]interface{}, string, bool) {
+	key := make(map[string]interface{}, len(keys))
+	vals := make([]interface{}, len(keys))
+
+	for idx, field := range keys {
+		val, ok := record[field]
+		if !ok || val == nil {
+			return nil, "", false
+		}
+
+		key[field] = val
+		vals[idx] = auditValue(val)
+	}
+
+	id, err := json.Marshal(vals)
+	if err != nil {
+		return nil, "", false
+	}
+
+	return key, string(id), true
+}
+
+// diffRecord will return the fields of the incoming record whose values differ from the values of the existing
+// record, with their old and new values. Fields that are not on the existing record have an old value of null.
+func diffRecord(existing, incoming map[string]interface{}, ignore map[string]bool,
+) ([]string, map[string]interface{}, map[string]interface{}) {
+	var columns []string
+
+	oldValues := make(map[string]interface{})
+	newValues := make(map[string]interface{})
+
+	for field, val := range incoming {
+		if ignore[field] || reflect.DeepEqual(auditValue(existing[field]), auditValue(val)) {
+			continue
+		}
+
+		columns = append(columns, field)
+		oldValues[field] = existing[field]
+		newValues[field] = val
+	}
+
+	sort.Strings(columns)
+
+	return columns, oldValues, newValues
+}
+
+// auditValue will return the value to compare a value of a record with, since the values read from a storage do not
+// have the types or formats of the values of the request: numbers are float64s, and timestamps are RFC 3339 strings
+// in UTC.
+func auditValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case string:
+		if ts, err := time.Parse(time.RFC3339Nano, val); err == nil {
+			return ts.UTC().Format(time.RFC3339Nano)
+		}
+
+		return val
+	case int:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	default:
+		return val
+	}
+}
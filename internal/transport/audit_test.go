@@ -0,0 +1,220 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+// fakeAuditRepository is a repository with a table of existing records keyed by "id", which records the upserts of
+// the audit table. The other methods of the repository are not implemented.
+type fakeAuditRepository struct {
+	repository.Generic
+
+	existing []map[string]interface{}
+	audited  []*auditEntry
+}
+
+func (repo *fakeAuditRepository) ListPrimaryKeys(context.Context) (*proto.ListPrimaryKeysResponse, error) {
+	return &proto.ListPrimaryKeysResponse{PKSet: map[string]*proto.PrimaryKeys{
+		"accounts": {List: []string{"id"}},
+	}}, nil
+}
+
+func (repo *fakeAuditRepository) Find(_ context.Context, _ string, keys []map[string]interface{},
+	fn func(map[string]interface{}) error,
+) error {
+	for _, record := range repo.existing {
+		for _, key := range keys {
+			if record["id"] == key["id"] {
+				if err := fn(record); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (repo *fakeAuditRepository) Upsert(_ context.Context, req *proto.UpsertRequest) (*proto.UpsertResponse, error) {
+	var entries []*auditEntry
+	if err := json.Unmarshal(req.Data, &entries); err != nil {
+		return nil, err
+	}
+
+	repo.audited = append(repo.audited, entries...)
+
+	return &proto.UpsertResponse{UpsertedCount: int64(len(entries))}, nil
+}
+
+func TestAuditAudits(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		audit    *Audit
+		table    string
+		expected bool
+	}{
+		{name: "not configured", table: "accounts"},
+		{name: "every table", audit: &Audit{}, table: "accounts", expected: true},
+		{name: "listed table", audit: &Audit{Tables: []string{"accounts"}}, table: "accounts", expected: true},
+		{name: "unlisted table", audit: &Audit{Tables: []string{"accounts"}}, table: "fills"},
+		{name: "audit table", audit: &Audit{}, table: defaultAuditTable},
+		{name: "custom audit table", audit: &Audit{Table: "history"}, table: "history"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tcase.audit.audits(tcase.table); got != tcase.expected {
+				t.Fatalf("expected %v, got %v", tcase.expected, got)
+			}
+		})
+	}
+
+	audit := &Audit{Table: "history", Tables: []string{"history"}}
+	if err := audit.validate(); !errors.Is(err, ErrInvalidAudit) {
+		t.Fatalf("expected an invalid audit error, got %v", err)
+	}
+}
+
+func TestDiffRecord(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		existing  map[string]interface{}
+		incoming  map[string]interface{}
+		columns   []string
+		oldValues map[string]interface{}
+	}{
+		{
+			name:     "unchanged",
+			existing: map[string]interface{}{"id": "1", "balance": 1.5, "meta": map[string]interface{}{"a": true}},
+			incoming: map[string]interface{}{"id": "1", "balance": 1.5, "meta": map[string]interface{}{"a": true}},
+		},
+		{
+			name:      "changed",
+			existing:  map[string]interface{}{"id": "1", "balance": 1.5, "currency": "USD"},
+			incoming:  map[string]interface{}{"id": "1", "balance": 2.5, "currency": "EUR"},
+			columns:   []string{"balance", "currency"},
+			oldValues: map[string]interface{}{"balance": 1.5, "currency": "USD"},
+		},
+		{
+			name:      "new field",
+			existing:  map[string]interface{}{"id": "1"},
+			incoming:  map[string]interface{}{"id": "1", "hold": 0.5},
+			columns:   []string{"hold"},
+			oldValues: map[string]interface{}{"hold": nil},
+		},
+		{
+			name:     "equal timestamps",
+			existing: map[string]interface{}{"id": "1", "time": "2022-05-01T12:30:00Z"},
+			incoming: map[string]interface{}{"id": "1", "time": "2022-05-01T07:30:00-05:00"},
+		},
+		{
+			name:     "ignored field",
+			existing: map[string]interface{}{"id": "1", "gidariRunId": "a"},
+			incoming: map[string]interface{}{"id": "1", "gidariRunId": "b"},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			columns, oldValues, _ := diffRecord(tcase.existing, tcase.incoming, map[string]bool{"gidariRunId": true})
+			if !reflect.DeepEqual(columns, tcase.columns) {
+				t.Fatalf("expected columns %v, got %v", tcase.columns, columns)
+			}
+
+			if len(columns) > 0 && !reflect.DeepEqual(oldValues, tcase.oldValues) {
+				t.Fatalf("expected old values %v, got %v", tcase.oldValues, oldValues)
+			}
+		})
+	}
+}
+
+func TestAuditorChain(t *testing.T) {
+	t.Parallel()
+
+	repo := &fakeAuditRepository{existing: []map[string]interface{}{
+		{"id": "1", "balance": 1.5},
+		{"id": "2", "balance": 2.5},
+		{"id": "3", "balance": 3.5},
+	}}
+
+	aud := newAuditor(&Audit{}, "run", &Lineage{})
+	aud.now = func() time.Time { return time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC) }
+
+	for _, batch := range []string{
+		`[{"id": "1", "balance": 1.5}, {"id": "2", "balance": 20}, {"id": "4", "balance": 4}]`,
+		`[{"id": "3", "balance": 30, "gidariRunId": "run"}, {"id": "1", "balance": 10}]`,
+	} {
+		req := &proto.UpsertRequest{Table: "accounts", Data: []byte(batch), DataType: int32(tools.UpsertDataJSON)}
+
+		changes, err := aud.changes(context.Background(), 0, repo, req)
+		if err != nil {
+			t.Fatalf("error finding changes: %v", err)
+		}
+
+		// The record with ID 1 fails to upsert, so its change is not audited.
+		var errs []*proto.RecordError
+		if len(changes) == 2 {
+			errs = []*proto.RecordError{{Index: 1}}
+		}
+
+		if err := aud.write(context.Background(), 0, repo, changes, errs); err != nil {
+			t.Fatalf("error writing audit records: %v", err)
+		}
+	}
+
+	if len(repo.audited) != 2 {
+		t.Fatalf("expected 2 audit records, got %d", len(repo.audited))
+	}
+
+	var previous string
+
+	for idx, entry := range repo.audited {
+		if entry.Sequence != int64(idx+1) || entry.PreviousHash != previous || entry.RunID != "run" {
+			t.Fatalf("unexpected chain of audit record %d: %+v", idx, entry)
+		}
+
+		sum, err := entry.sum()
+		if err != nil || sum != entry.Hash {
+			t.Fatalf("expected hash %q of audit record %d, got %q", sum, idx, entry.Hash)
+		}
+
+		previous = entry.Hash
+	}
+
+	if key := repo.audited[0].Key["id"]; key != "2" {
+		t.Fatalf("expected the first audit record of ID 2, got %v", key)
+	}
+
+	if got := repo.audited[1].NewValues; !reflect.DeepEqual(got, map[string]interface{}{"balance": 30.0}) {
+		t.Fatalf("unexpected new values: %v", got)
+	}
+
+	repo.audited[0].OldValues["balance"] = 0.0
+	if sum, _ := repo.audited[0].sum(); sum == repo.audited[0].Hash {
+		t.Fatalf("expected a changed audit record to break the chain")
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultAutoscaleInterval is the default interval at which the number of web workers is adjusted.
+	defaultAutoscaleInterval = time.Second
+
+	// defaultAutoscaleMaxPerCPU is the default maximum number of web workers for each CPU.
+	defaultAutoscaleMaxPerCPU = 4
+)
+
+// ErrInvalidAutoscale is returned when the autoscaling configuration is invalid.
+var ErrInvalidAutoscale = fmt.Errorf("invalid autoscale")
+
+// InvalidAutoscaleError wraps an error with ErrInvalidAutoscale.
+func InvalidAutoscaleError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidAutoscale, msg)
+}
+
+// Autoscale adjusts the number of web workers of an operation while it runs, starting from the configured number.
+// The workers grow while requests wait for a worker, and shrink while the requests spend most of their latency waiting
+// on the rate limiter or the repository queue is deeper than the storage workers can take, since more workers would
+// only wait.
+type Autoscale struct {
+	// MinWebWorkers and MaxWebWorkers are the bounds of the number of web workers. The defaults are 1 and four times
+	// the number of CPUs.
+	MinWebWorkers int `yaml:"minWebWorkers"`
+	MaxWebWorkers int `yaml:"maxWebWorkers"`
+
+	// Interval is the interval at which the number of web workers is adjusted, the default is one second.
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (as *Autoscale) validate() error {
+	if as == nil {
+		return nil
+	}
+
+	if as.MinWebWorkers < 0 || as.MaxWebWorkers < 0 || as.Interval < 0 {
+		return InvalidAutoscaleError("minWebWorkers, maxWebWorkers, and interval can not be negative")
+	}
+
+	if as.MaxWebWorkers > 0 && as.MinWebWorkers > as.MaxWebWorkers {
+		return InvalidAutoscaleError("minWebWorkers is greater than maxWebWorkers")
+	}
+
+	return nil
+}
+
+func (as *Autoscale) bounds() (int, int) {
+	lower, upper := as.MinWebWorkers, as.MaxWebWorkers
+	if lower == 0 {
+		lower = 1
+	}
+
+	if upper == 0 {
+		upper = defaultAutoscaleMaxPerCPU * runtime.NumCPU()
+	}
+
+	if upper < lower {
+		upper = lower
+	}
+
+	return lower, upper
+}
+
+func (as *Autoscale) interval() time.Duration {
+	if as.Interval == 0 {
+		return defaultAutoscaleInterval
+	}
+
+	return as.Interval
+}
+
+// clamp will return the number of workers within the bounds.
+func (as *Autoscale) clamp(workers int) int {
+	lower, upper := as.bounds()
+
+	switch {
+	case workers < lower:
+		return lower
+	case workers > upper:
+		return upper
+	default:
+		return workers
+	}
+}
+
+// autoscaleSample is what the web workers observed during an interval.
+type autoscaleSample struct {
+	// requests are the number of requests that completed, with their total latency and rate limiter wait.
+	requests      int
+	latency, wait time.Duration
+
+	// webQueue is the number of requests waiting for a web worker, and repositoryQueue is the number of responses
+	// waiting for a storage worker.
+	webQueue, repositoryQueue int
+	storageWorkers            int
+}
+
+// scale will return the number of web workers for the next interval.
+func (as *Autoscale) scale(workers int, sample autoscaleSample) int {
+	switch {
+	case sample.repositoryQueue > sample.storageWorkers:
+		// The storage is behind, so more responses would only wait in the repository queue.
+		return as.clamp(workers - 1)
+	case sample.requests == 0:
+		return workers
+	case 2*sample.wait > sample.latency:
+		// Most of the latency is spent waiting on the rate limiter, so more workers would only wait on it.
+		return as.clamp(workers - 1)
+	case sample.webQueue > 0:
+		// The requests are I/O bound and waiting for a worker.
+		grow := workers
+		if sample.webQueue < grow {
+			grow = sample.webQueue
+		}
+
+		return as.clamp(workers + grow)
+	default:
+		return workers
+	}
+}
+
+// autoscaler collects the latency and the rate limiter wait of the requests of the web workers.
+type autoscaler struct {
+	mutex sync.Mutex
+
+	requests      int
+	latency, wait time.Duration
+}
+
+// observe will record the latency of a request, including the time it waited on the rate limiter.
+func (scaler *autoscaler) observe(latency, wait time.Duration) {
+	if scaler == nil {
+		return
+	}
+
+	scaler.mutex.Lock()
+	defer scaler.mutex.Unlock()
+
+	scaler.requests++
+	scaler.latency += latency
+	scaler.wait += wait
+}
+
+// reset will return the observations since the last reset.
+func (scaler *autoscaler) reset() autoscaleSample {
+	scaler.mutex.Lock()
+	defer scaler.mutex.Unlock()
+
+	sample := autoscaleSample{requests: scaler.requests, latency: scaler.latency, wait: scaler.wait}
+	scaler.requests, scaler.latency, scaler.wait = 0, 0, 0
+
+	return sample
+}
+
+// webPool is the web workers of an operation, which can be added and removed while it runs.
+type webPool struct {
+	ctx    context.Context
+	group  *sync.WaitGroup
+	jobs   chan *webJob
+	logger *logrus.Logger
+
+	// quit stops a worker once it is done with its job, for every worker that is removed.
+	quit chan struct{}
+
+	size, lastID int
+}
+
+// newWebPool will return a pool that starts its web workers in the wait group. The pool can have at most max workers.
+func newWebPool(ctx context.Context, group *sync.WaitGroup, jobs chan *webJob, logger *logrus.Logger,
+	limit int,
+) *webPool {
+	return &webPool{ctx: ctx, group: group, jobs: jobs, logger: logger, quit: make(chan struct{}, limit)}
+}
+
+// resize will start or stop web workers until the pool has the number of workers. Stopped workers finish their job
+// first.
+func (pool *webPool) resize(size int) {
+	for pool.size < size {
+		pool.lastID++
+		pool.size++
+
+		id := pool.lastID
+
+		pool.group.Add(1)
+
+		go func() {
+			defer pool.group.Done()
+
+			webWorker(pool.ctx, id, pool.jobs, pool.quit)
+		}()
+	}
+
+	for pool.size > size {
+		pool.quit <- struct{}{}
+		pool.size--
+	}
+}
+
+// autoscale will adjust the number of web workers of the pool every interval, until the returned function is called.
+// The function returns once the pool is no longer adjusted.
+func (pool *webPool) autoscale(as *Autoscale, scaler *autoscaler, repoJobs chan *repoJob,
+	storageWorkers int,
+) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(as.interval())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-pool.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			sample := scaler.reset()
+			sample.webQueue = len(pool.jobs)
+			sample.repositoryQueue = len(repoJobs)
+			sample.storageWorkers = storageWorkers
+
+			size := as.scale(pool.size, sample)
+			if size == pool.size {
+				continue
+			}
+
+			logInfo := tools.LogEvent{WorkerName: "web", Msg: "scaling web workers", Count: size, Previous: pool.size}
+			logInfo.Log(pool.logger, logrus.InfoLevel)
+
+			pool.resize(size)
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAutoscaleScale(t *testing.T) {
+	t.Parallel()
+
+	autoscale := &Autoscale{MinWebWorkers: 2, MaxWebWorkers: 8}
+
+	for _, tcase := range []struct {
+		name     string
+		workers  int
+		sample   autoscaleSample
+		expected int
+	}{
+		{
+			name:     "grows while requests wait for a worker",
+			workers:  2,
+			sample:   autoscaleSample{requests: 10, latency: time.Second, webQueue: 5, storageWorkers: 2},
+			expected: 4,
+		},
+		{
+			name:     "grows by the web queue",
+			workers:  4,
+			sample:   autoscaleSample{requests: 10, latency: time.Second, webQueue: 1, storageWorkers: 2},
+			expected: 5,
+		},
+		{
+			name:     "grows up to the maximum",
+			workers:  6,
+			sample:   autoscaleSample{requests: 10, latency: time.Second, webQueue: 20, storageWorkers: 2},
+			expected: 8,
+		},
+		{
+			name:     "shrinks while waiting on the rate limiter",
+			workers:  4,
+			sample:   autoscaleSample{requests: 10, latency: time.Second, wait: 600 * time.Millisecond, webQueue: 5},
+			expected: 3,
+		},
+		{
+			name:     "shrinks while the repository queue is deep",
+			workers:  4,
+			sample:   autoscaleSample{requests: 10, latency: time.Second, repositoryQueue: 5, storageWorkers: 2},
+			expected: 3,
+		},
+		{
+			name:     "shrinks down to the minimum",
+			workers:  2,
+			sample:   autoscaleSample{repositoryQueue: 5, storageWorkers: 2},
+			expected: 2,
+		},
+		{
+			name:     "keeps the workers without requests",
+			workers:  4,
+			sample:   autoscaleSample{webQueue: 5, storageWorkers: 2},
+			expected: 4,
+		},
+		{
+			name:     "keeps the workers without a web queue",
+			workers:  4,
+			sample:   autoscaleSample{requests: 10, latency: time.Second, storageWorkers: 2},
+			expected: 4,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if workers := autoscale.scale(tcase.workers, tcase.sample); workers != tcase.expected {
+				t.Fatalf("expected %d workers, got %d", tcase.expected, workers)
+			}
+		})
+	}
+}
+
+func TestAutoscaleValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, autoscale := range []*Autoscale{
+		{MinWebWorkers: -1},
+		{MinWebWorkers: 4, MaxWebWorkers: 2},
+		{Interval: -time.Second},
+	} {
+		if err := autoscale.validate(); err == nil {
+			t.Fatalf("expected an error for %+v", autoscale)
+		}
+	}
+
+	if err := (&Autoscale{MinWebWorkers: 2}).validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWebPoolResize(t *testing.T) {
+	t.Parallel()
+
+	var group sync.WaitGroup
+
+	jobs := make(chan *webJob)
+	pool := newWebPool(context.Background(), &group, jobs, logrus.New(), 4)
+
+	pool.resize(4)
+	pool.resize(1)
+
+	// The workers that are removed stop, so the last worker stops once the jobs are closed.
+	close(jobs)
+
+	group.Wait()
+
+	if pool.size != 1 || pool.lastID != 4 {
+		t.Fatalf("unexpected pool: size %d, last ID %d", pool.size, pool.lastID)
+	}
+}
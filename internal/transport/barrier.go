@@ -0,0 +1,147 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrDependencyCycle is returned when requests depend on the tables of each other.
+var ErrDependencyCycle = fmt.Errorf("dependency cycle")
+
+// DependencyCycleError wraps an error with ErrDependencyCycle.
+func DependencyCycleError(tables []string) error {
+	return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(tables, " -> "))
+}
+
+// barrier holds back the requests that depend on tables until every request that writes to the tables is done, so
+// that the requests see the complete data of the tables. Tables that no request of the run writes to do not hold back
+// their dependents.
+type barrier struct {
+	// pending is the number of requests that are not done for each table.
+	pending map[string]int
+
+	// blocked are the requests that are waiting for their dependencies.
+	blocked []*flattenedRequest
+}
+
+// newBarrier will return a barrier for the requests of a run, returning an error if the requests depend on each other.
+func newBarrier(requests []*flattenedRequest) (*barrier, error) {
+	bar := &barrier{pending: make(map[string]int)}
+
+	// edges are the tables that the requests writing to a table depend on.
+	edges := make(map[string][]string)
+
+	for _, req := range requests {
+		for _, table := range req.tables() {
+			bar.pending[table]++
+			edges[table] = append(edges[table], req.dependsOn...)
+		}
+	}
+
+	if cycle := findCycle(edges); cycle != nil {
+		return nil, DependencyCycleError(cycle)
+	}
+
+	return bar, nil
+}
+
+// findCycle will return the tables of a cycle of the dependency edges, or nil if there is no cycle.
+func findCycle(edges map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(edges))
+
+	var path []string
+
+	var visit func(table string) []string
+	visit = func(table string) []string {
+		switch state[table] {
+		case visited:
+			return nil
+		case visiting:
+			for idx, t := range path {
+				if t == table {
+					return append(append([]string{}, path[idx:]...), table)
+				}
+			}
+		}
+
+		state[table] = visiting
+		path = append(path, table)
+
+		for _, dep := range edges[table] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[table] = visited
+
+		return nil
+	}
+
+	for table := range edges {
+		if cycle := visit(table); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// ready will return true if none of the dependencies of the request have pending requests.
+func (bar *barrier) ready(req *flattenedRequest) bool {
+	for _, table := range req.dependsOn {
+		if bar.pending[table] > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// release will return the requests that are ready to run, holding back the rest until their dependencies are done.
+func (bar *barrier) release(requests []*flattenedRequest) []*flattenedRequest {
+	var released []*flattenedRequest
+
+	for _, req := range requests {
+		if bar.ready(req) {
+			released = append(released, req)
+		} else {
+			bar.blocked = append(bar.blocked, req)
+		}
+	}
+
+	return released
+}
+
+// add will add a request to the pending requests of its tables, e.g. the next page of a request that is not done.
+func (bar *barrier) add(req *flattenedRequest) {
+	for _, table := range req.tables() {
+		bar.pending[table]++
+	}
+}
+
+// done will mark the request as done, returning the blocked requests that are now ready to run.
+func (bar *barrier) done(req *flattenedRequest) []*flattenedRequest {
+	for _, table := range req.tables() {
+		bar.pending[table]--
+	}
+
+	blocked := bar.blocked
+	bar.blocked = nil
+
+	return bar.release(blocked)
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBarrier(t *testing.T) {
+	t.Parallel()
+
+	t.Run("cycle", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name     string
+			requests []*flattenedRequest
+			err      error
+		}{
+			{"none", []*flattenedRequest{{table: "candles"}, {table: "stats", dependsOn: []string{"candles"}}}, nil},
+			{"unknown table", []*flattenedRequest{{table: "stats", dependsOn: []string{"candles"}}}, nil},
+			{"self", []*flattenedRequest{{table: "candles", dependsOn: []string{"candles"}}}, ErrDependencyCycle},
+			{"indirect", []*flattenedRequest{
+				{table: "a", dependsOn: []string{"b"}},
+				{table: "b", dependsOn: []string{"c"}},
+				{split: []*Split{{Table: "c"}, {Table: "d"}}, dependsOn: []string{"a"}},
+			}, ErrDependencyCycle},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if _, err := newBarrier(tcase.requests); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		t.Parallel()
+
+		chunks := []*flattenedRequest{{table: "candles"}, {table: "candles"}}
+		stats := &flattenedRequest{table: "stats", dependsOn: []string{"candles"}}
+		report := &flattenedRequest{table: "report", dependsOn: []string{"stats", "tickers"}}
+		tickers := &flattenedRequest{table: "tickers"}
+
+		requests := []*flattenedRequest{report, chunks[0], stats, chunks[1], tickers}
+
+		bar, err := newBarrier(requests)
+		if err != nil {
+			t.Fatalf("failed to create barrier: %v", err)
+		}
+
+		expectReleased := func(released []*flattenedRequest, expected ...*flattenedRequest) {
+			t.Helper()
+
+			if len(released) != len(expected) {
+				t.Fatalf("expected %d released requests, got %d", len(expected), len(released))
+			}
+
+			for idx := range expected {
+				if released[idx] != expected[idx] {
+					t.Fatalf("expected released request %d to be %q, got %q", idx, expected[idx].table,
+						released[idx].table)
+				}
+			}
+		}
+
+		expectReleased(bar.release(requests), chunks[0], chunks[1], tickers)
+		expectReleased(bar.done(chunks[0]))
+		expectReleased(bar.done(tickers))
+		expectReleased(bar.done(chunks[1]), stats)
+		expectReleased(bar.done(stats), report)
+	})
+}
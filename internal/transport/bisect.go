@@ -0,0 +1,200 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultBisectMinPeriod is the smallest range of a chunk that is bisected, if the bisect does not define one.
+const defaultBisectMinPeriod = time.Minute
+
+// defaultBisectStatusCodes are the status codes of the responses of web APIs that time out: request timeout, gateway
+// timeout, and the timeout of Cloudflare.
+var defaultBisectStatusCodes = []int{http.StatusRequestTimeout, http.StatusGatewayTimeout, 524}
+
+// ErrInvalidBisect is returned when the bisect of a timeseries is invalid.
+var ErrInvalidBisect = fmt.Errorf("invalid bisect")
+
+// InvalidBisectError wraps an error with ErrInvalidBisect.
+func InvalidBisectError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidBisect, msg)
+}
+
+// Bisect splits the timeseries chunks that time out into two halves that are fetched in their place, for web APIs
+// that time out on ranges with too much data to serve. The halves are bisected again while they time out, down to
+// the minimum period, and their records are upserted together as the records of the chunk. A chunk is bisected once
+// the retries of its retry policy are exhausted.
+type Bisect struct {
+	// MinPeriod is the smallest range of a chunk that is bisected, the default is one minute. A chunk that times out
+	// with a smaller range fails.
+	MinPeriod time.Duration `yaml:"minPeriod" json:"minPeriod,omitempty"`
+
+	// StatusCodes are the status codes of the responses that time out, the default is 408, 504, and 524. Requests
+	// that time out on the network are always bisected.
+	StatusCodes []int `yaml:"statusCodes" json:"statusCodes,omitempty"`
+}
+
+// validate will ensure that the bisect is valid.
+func (bisect *Bisect) validate(req *Request) error {
+	if bisect == nil {
+		return nil
+	}
+
+	if bisect.MinPeriod < 0 {
+		return InvalidBisectError("minPeriod must not be negative")
+	}
+
+	// The halves are made by changing the range on the query, which would not change the range in a body template.
+	if req.BodyTemplate != "" {
+		return InvalidBisectError(fmt.Sprintf("request %q has a bodyTemplate", req.Endpoint))
+	}
+
+	return nil
+}
+
+// minPeriod will return the smallest range of a chunk that is bisected.
+func (bisect *Bisect) minPeriod() time.Duration {
+	if bisect.MinPeriod == 0 {
+		return defaultBisectMinPeriod
+	}
+
+	return bisect.MinPeriod
+}
+
+// timedOut will return true if the error is a timeout of the web API or of the network.
+func (bisect *Bisect) timedOut(err error) bool {
+	var rspErr *web.ResponseError
+	if errors.As(err, &rspErr) {
+		codes := bisect.StatusCodes
+		if codes == nil {
+			codes = defaultBisectStatusCodes
+		}
+
+		for _, code := range codes {
+			if code == rspErr.StatusCode {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// chunkBisect is the bisect of a timeseries chunk, with the query parameters of the range of the chunk.
+type chunkBisect struct {
+	*Bisect
+
+	StartName string `json:"startName"`
+	EndName   string `json:"endName"`
+	Layout    string `json:"layout"`
+}
+
+// chunkBisect will return the bisect of the chunks of the timeseries, or nil if the chunks are not bisected.
+func (ts *timeseries) chunkBisect() *chunkBisect {
+	if ts.Bisect == nil {
+		return nil
+	}
+
+	return &chunkBisect{Bisect: ts.Bisect, StartName: ts.StartName, EndName: ts.EndName, Layout: *ts.Layout}
+}
+
+// halves will return the jobs of the two halves of the chunk of the job, or false if the chunk can not be bisected.
+func (bisect *chunkBisect) halves(job *webJob) ([2]*webJob, bool) {
+	if bisect == nil || job.chunk == nil {
+		return [2]*webJob{}, false
+	}
+
+	start, end := job.chunk[0], job.chunk[1]
+
+	// The halves are truncated to the precision of the layout, so the midpoint must differ from both ends.
+	mid, err := time.Parse(bisect.Layout, start.Add(end.Sub(start)/2).Format(bisect.Layout))
+	if err != nil || end.Sub(start) < bisect.minPeriod() || !mid.After(start) || !mid.Before(end) {
+		return [2]*webJob{}, false
+	}
+
+	var halves [2]*webJob
+
+	for idx, bounds := range [2][2]time.Time{{start, mid}, {mid, end}} {
+		rurl := *job.fetchConfig.URL
+
+		query := rurl.Query()
+		query.Set(bisect.StartName, bounds[0].Format(bisect.Layout))
+		query.Set(bisect.EndName, bounds[1].Format(bisect.Layout))
+		rurl.RawQuery = query.Encode()
+
+		half := job.withURL(&rurl)
+		half.chunk = &[2]time.Time{bounds[0], bounds[1]}
+		halves[idx] = half
+	}
+
+	return halves, true
+}
+
+// fetchBisected will fetch the pages of the job. If the job is a timeseries chunk that times out, the chunk is
+// bisected and its halves are fetched in its place, returning their records together with the response and page of
+// the last half.
+func fetchBisected(ctx context.Context, job *webJob) (*web.FetchResponse, []byte, *Page, error) {
+	rsp, records, page, err := fetchPages(ctx, job)
+	if err == nil || ctx.Err() != nil || job.bisect == nil || !job.bisect.timedOut(err) {
+		return rsp, records, page, err
+	}
+
+	halves, ok := job.bisect.halves(job)
+	if !ok {
+		return rsp, records, page, err
+	}
+
+	logWarn := tools.LogEvent{
+		Msg:   "bisecting timeseries chunk",
+		Table: job.table,
+		Since: job.chunk[0],
+		Until: job.chunk[1],
+		Err:   err,
+	}
+	logWarn.Log(job.logger, logrus.WarnLevel)
+
+	merged := make([]json.RawMessage, 0)
+
+	for _, half := range halves {
+		rsp, records, page, err = fetchBisected(ctx, half)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		job.next = append(job.next, half.next...)
+
+		var halfRecords []json.RawMessage
+		if err := json.Unmarshal(records, &halfRecords); err != nil {
+			return nil, nil, nil, fmt.Errorf("unable to decode records of bisected chunk: %w", err)
+		}
+
+		merged = append(merged, halfRecords...)
+	}
+
+	records, err = json.Marshal(merged)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to encode records: %w", err)
+	}
+
+	return rsp, records, page, nil
+}
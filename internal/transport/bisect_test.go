@@ -0,0 +1,197 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func TestBisect(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name   string
+			bisect *Bisect
+			req    *Request
+			err    error
+		}{
+			{"nil", nil, &Request{}, nil},
+			{"default", &Bisect{}, &Request{}, nil},
+			{"negative min period", &Bisect{MinPeriod: -time.Minute}, &Request{}, ErrInvalidBisect},
+			{"body template", &Bisect{}, &Request{BodyTemplate: `{"start":"{{ .Start }}"}`}, ErrInvalidBisect},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.bisect.validate(tcase.req); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name     string
+			bisect   *Bisect
+			err      error
+			expected bool
+		}{
+			{"gateway timeout", &Bisect{}, &web.ResponseError{StatusCode: http.StatusGatewayTimeout}, true},
+			{"not found", &Bisect{}, &web.ResponseError{StatusCode: http.StatusNotFound}, false},
+			{"status codes", &Bisect{StatusCodes: []int{500}}, &web.ResponseError{StatusCode: 500}, true},
+			{"network", &Bisect{}, &url.Error{Op: "Get", Err: timeoutError{}}, true},
+			{"other", &Bisect{}, errors.New("failed"), false},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if got := tcase.bisect.timedOut(tcase.err); got != tcase.expected {
+					t.Fatalf("expected %v, got %v", tcase.expected, got)
+				}
+			})
+		}
+	})
+
+	t.Run("fetch bisected", func(t *testing.T) {
+		t.Parallel()
+
+		// The web API times out on ranges longer than an hour and returns a record for every minute of the range.
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start, _ := time.Parse(time.RFC3339, r.URL.Query().Get("start"))
+			end, _ := time.Parse(time.RFC3339, r.URL.Query().Get("end"))
+
+			if end.Sub(start) > time.Hour {
+				w.WriteHeader(http.StatusGatewayTimeout)
+
+				return
+			}
+
+			// The records are at the start of every minute, so a range that starts within a minute begins at the next.
+			first := start.Truncate(time.Minute)
+			if first.Before(start) {
+				first = first.Add(time.Minute)
+			}
+
+			records := make([]map[string]string, 0)
+			for ts := first; ts.Before(end); ts = ts.Add(time.Minute) {
+				records = append(records, map[string]string{"time": ts.Format(time.RFC3339)})
+			}
+
+			_ = json.NewEncoder(w).Encode(records)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		newJob := func(period time.Duration, bisect *Bisect) *webJob {
+			end := start.Add(period)
+			rurl, _ := url.Parse(fmt.Sprintf("%s/candles?start=%s&end=%s", server.URL, start.Format(time.RFC3339),
+				end.Format(time.RFC3339)))
+
+			ts := &timeseries{StartName: "start", EndName: "end", Bisect: bisect}
+			ts.Layout = new(string)
+			*ts.Layout = time.RFC3339
+
+			return &webJob{
+				flattenedRequest: &flattenedRequest{
+					fetchConfig: &web.FetchConfig{
+						C: client, Method: http.MethodGet, URL: rurl, RateLimiter: rate.NewLimiter(rate.Inf, 1),
+					},
+					table:  "candles",
+					chunk:  &[2]time.Time{start, end},
+					bisect: ts.chunkBisect(),
+				},
+				logger: logrus.New(),
+			}
+		}
+
+		for _, tcase := range []struct {
+			name     string
+			period   time.Duration
+			bisect   *Bisect
+			expected int
+			err      bool
+		}{
+			{"not bisected", time.Hour, nil, 60, false},
+			{"no bisect", 6 * time.Hour, nil, 0, true},
+			{"bisected", 6 * time.Hour, &Bisect{}, 360, false},
+			{"uneven", 5 * time.Hour, &Bisect{}, 300, false},
+			{"min period", 6 * time.Hour, &Bisect{MinPeriod: 4 * time.Hour}, 0, true},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				job := newJob(tcase.period, tcase.bisect)
+
+				_, data, _, err := fetchBisected(context.Background(), job)
+				if tcase.err != (err != nil) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if tcase.err {
+					return
+				}
+
+				var records []map[string]string
+				if err := json.Unmarshal(data, &records); err != nil {
+					t.Fatalf("failed to decode records: %v", err)
+				}
+
+				if len(records) != tcase.expected {
+					t.Fatalf("expected %d records, got %d", tcase.expected, len(records))
+				}
+
+				// The records of the halves are in the order of their ranges, without gaps or duplicates.
+				for idx, record := range records {
+					if expected := start.Add(time.Duration(idx) * time.Minute).Format(time.RFC3339); record["time"] != expected {
+						t.Fatalf("expected record %d at %s, got %s", idx, expected, record["time"])
+					}
+				}
+
+				if job.chunk[1].Sub(job.chunk[0]) != tcase.period {
+					t.Fatalf("expected the chunk of the job to be unchanged, got %v", job.chunk)
+				}
+			})
+		}
+	})
+}
+
+// timeoutError is a network error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
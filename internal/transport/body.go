@@ -0,0 +1,120 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// defaultContentType is the content type of request bodies, if the request does not define one.
+const defaultContentType = "application/json"
+
+// ErrInvalidBody is returned when the body of a request is invalid.
+var ErrInvalidBody = fmt.Errorf("invalid request body")
+
+// InvalidBodyError wraps an error with ErrInvalidBody.
+func InvalidBodyError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidBody, msg)
+}
+
+// bodyData is the data of a body template. Start and End are the boundaries of the timeseries chunk of the request,
+// formatted with the layout of the timeseries. They are empty if the request is not a timeseries. Each is the value of
+// a foreach request.
+type bodyData struct {
+	Start string
+	End   string
+	Each  string
+}
+
+// hasBody will return true if the request has a body.
+func (req *Request) hasBody() bool {
+	return req.Body != nil || req.BodyTemplate != ""
+}
+
+// validateBody will ensure that the body of the request is valid.
+func (req *Request) validateBody() error {
+	if req.Body != nil && req.BodyTemplate != "" {
+		return InvalidBodyError("body and bodyTemplate can not both be set")
+	}
+
+	if req.BodyTemplate != "" {
+		if _, err := template.New("body").Funcs(templateFuncs).Parse(req.BodyTemplate); err != nil {
+			return InvalidBodyError(err.Error())
+		}
+	}
+
+	if _, err := json.Marshal(jsonValue(req.Body)); err != nil {
+		return InvalidBodyError(err.Error())
+	}
+
+	return nil
+}
+
+// newBody will return the body of the request and its content type, or nil if the request does not have a body. The
+// body template is rendered with the boundaries of the timeseries chunk, if the request is a chunk.
+func (req *Request) newBody(bounds *[2]string) ([]byte, string, error) {
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	if req.Body != nil {
+		body, err := json.Marshal(jsonValue(req.Body))
+		if err != nil {
+			return nil, "", InvalidBodyError(err.Error())
+		}
+
+		return body, contentType, nil
+	}
+
+	if req.BodyTemplate == "" {
+		return nil, "", nil
+	}
+
+	data := bodyData{Each: req.each}
+	if bounds != nil {
+		data.Start, data.End = bounds[0], bounds[1]
+	}
+
+	tmpl, err := template.New("body").Funcs(templateFuncs).Parse(req.BodyTemplate)
+	if err != nil {
+		return nil, "", InvalidBodyError(err.Error())
+	}
+
+	var bldr strings.Builder
+	if err := tmpl.Execute(&bldr, data); err != nil {
+		return nil, "", fmt.Errorf("unable to execute body template: %w", err)
+	}
+
+	return []byte(bldr.String()), contentType, nil
+}
+
+// jsonValue will convert the maps decoded from YAML, which have interface keys, into maps that can be JSON encoded.
+func jsonValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(val))
+		for key, elem := range val {
+			obj[fmt.Sprint(key)] = jsonValue(elem)
+		}
+
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, len(val))
+		for idx, elem := range val {
+			arr[idx] = jsonValue(elem)
+		}
+
+		return arr
+	default:
+		return val
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRequestBody(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name string
+			req  *Request
+			err  error
+		}{
+			{"none", &Request{}, nil},
+			{"body", &Request{Body: map[interface{}]interface{}{"query": "{ candles }"}}, nil},
+			{"template", &Request{BodyTemplate: `{"start":"{{ .Start }}"}`}, nil},
+			{"both", &Request{Body: "{}", BodyTemplate: "{}"}, ErrInvalidBody},
+			{"invalid template", &Request{BodyTemplate: "{{ .Start "}, ErrInvalidBody},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.req.validateBody(); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("flatten", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /search
+    body:
+      filters:
+        product_id: [BTC-USD, ETH-USD]
+      limit: 100
+  - endpoint: /report
+    contentType: application/graphql
+    bodyTemplate: '{ candles(start: "{{ .Start }}", end: "{{ .End }}") { open close } }'
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-10T02:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+  - endpoint: /candles
+`))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		requests, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error flattening requests: %v", err)
+		}
+
+		if len(requests) != 4 {
+			t.Fatalf("expected 4 requests, got %d", len(requests))
+		}
+
+		for idx, expected := range []struct {
+			method      string
+			body        string
+			contentType string
+		}{
+			{http.MethodPost, `{"filters":{"product_id":["BTC-USD","ETH-USD"]},"limit":100}`, "application/json"},
+			{
+				http.MethodPost, `{ candles(start: "2022-05-10T00:00:00Z", end: "2022-05-10T01:00:00Z") { open close } }`,
+				"application/graphql",
+			},
+			{
+				http.MethodPost, `{ candles(start: "2022-05-10T01:00:00Z", end: "2022-05-10T02:00:00Z") { open close } }`,
+				"application/graphql",
+			},
+			{http.MethodGet, "", ""},
+		} {
+			fetchConfig := requests[idx].fetchConfig
+
+			if fetchConfig.Method != expected.method {
+				t.Fatalf("expected request %d to use %s, got %s", idx, expected.method, fetchConfig.Method)
+			}
+
+			if string(fetchConfig.Body) != expected.body || fetchConfig.ContentType != expected.contentType {
+				t.Fatalf("expected request %d to have body %s (%s), got %s (%s)", idx, expected.body,
+					expected.contentType, fetchConfig.Body, fetchConfig.ContentType)
+			}
+		}
+	})
+}
@@ -0,0 +1,331 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+// CacheMode is how a request uses the cache of the configuration.
+type CacheMode string
+
+const (
+	// CacheModePrefer sends the request conditionally, and skips it without sending it while its previous response
+	// is fresh, i.e. younger than the "max-age" of its "Cache-Control" header. This is the default, which suits
+	// static reference endpoints.
+	CacheModePrefer CacheMode = "prefer"
+
+	// CacheModeNever sends the request unconditionally and does not store the validators of its response, for
+	// dynamic endpoints.
+	CacheModeNever CacheMode = "never"
+
+	// CacheModeRefresh sends the request unconditionally and stores the validators of its response, to force a
+	// refresh of the cached response.
+	CacheModeRefresh CacheMode = "refresh"
+)
+
+// validate will ensure that the cache mode is valid.
+func (mode CacheMode) validate() error {
+	switch mode {
+	case "", CacheModePrefer, CacheModeNever, CacheModeRefresh:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidCache, mode)
+	}
+}
+
+var (
+	// ErrInvalidCache is returned when the cache of the configuration is invalid.
+	ErrInvalidCache = fmt.Errorf("invalid cache")
+
+	// errNotModified is returned when the response of a conditional request is not modified.
+	errNotModified = fmt.Errorf("response not modified")
+)
+
+// Cache sends conditional requests with the validators of the responses of the previous runs, i.e. their "ETag" and
+// "Last-Modified" headers, and skips the requests whose responses are not modified. This makes repeated runs much
+// cheaper against web APIs that support conditional requests. Only GET requests without pagination are conditional,
+// and requests for tables that are truncated before the run are not, since their records would be lost. The
+// validators of a run are stored once its transactions are committed, and only for the requests that completed. The
+// cache mode of each request determines how it uses the cache, see CacheMode.
+type Cache struct {
+	// File is the path of the file that stores the validators of the responses, by the URL of their request. The
+	// file is encrypted with the state encryption, if it is configured. With checkpoints, the file is the key of the
+	// cache on their store.
+	File string `yaml:"file"`
+}
+
+// validate will ensure that the cache is valid.
+func (cache *Cache) validate() error {
+	if cache != nil && cache.File == "" {
+		return fmt.Errorf("%w: file is required", ErrInvalidCache)
+	}
+
+	return nil
+}
+
+// cacheValidators are the validators of a response.
+type cacheValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+
+	// Expires is the time the response stops being fresh, from the "max-age" of its "Cache-Control" header. It is
+	// zero if the response must always be validated.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// newCacheValidators will return the validators of the response headers, or nil if the response must not be stored.
+func newCacheValidators(header http.Header, now time.Time) *cacheValidators {
+	validators := &cacheValidators{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+
+	var maxAge time.Duration
+
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.ToLower(strings.TrimSpace(directive)), "=")
+
+		switch name {
+		case "no-store":
+			return nil
+		case "no-cache":
+			return validators
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds > 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	if maxAge > 0 {
+		validators.Expires = now.Add(maxAge).UTC()
+	}
+
+	return validators
+}
+
+// responseCache holds the validators of the responses of an upsert operation. A nil responseCache does not send
+// conditional requests.
+type responseCache struct {
+	file        string
+	checkpoints CheckpointStore
+	cipher      *stateCipher
+
+	// truncated are the tables that are truncated before the run.
+	truncated map[string]bool
+
+	mutex sync.Mutex
+
+	// validators are the validators of the previous runs, by the URL of their request.
+	validators map[string]*cacheValidators
+
+	// pending are the validators of the responses of the run, which are stored once their requests complete.
+	pending map[*flattenedRequest]*cacheValidators
+}
+
+// load will read the validators of the cache from the store, or return nil if the cache is not configured. A missing
+// cache is an empty cache.
+func (cache *Cache) load(ctx context.Context, store CheckpointStore, sc *stateCipher,
+	truncated []string,
+) (*responseCache, error) {
+	if cache == nil {
+		return nil, nil
+	}
+
+	rc := &responseCache{
+		file:        cache.File,
+		checkpoints: store,
+		cipher:      sc,
+		truncated:   make(map[string]bool, len(truncated)),
+		validators:  make(map[string]*cacheValidators),
+		pending:     make(map[*flattenedRequest]*cacheValidators),
+	}
+
+	for _, table := range truncated {
+		rc.truncated[table] = true
+	}
+
+	bytes, err := store.Get(ctx, cache.File)
+	if errors.Is(err, ErrCheckpointNotFound) {
+		return rc, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cache: %w", err)
+	}
+
+	if bytes, err = sc.open(bytes); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bytes, &rc.validators); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal cache: %w", err)
+	}
+
+	return rc, nil
+}
+
+// cacheable will return true if the response of the request can be cached.
+func (rc *responseCache) cacheable(req *flattenedRequest) bool {
+	if rc == nil || req.fetchConfig.Method != http.MethodGet || req.pagination != nil || req.sink != nil {
+		return false
+	}
+
+	if req.cacheMode == CacheModeNever {
+		return false
+	}
+
+	for _, table := range req.tables() {
+		if rc.truncated[table] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cached will return the validators of the previous response to the request, if the request uses them.
+func (rc *responseCache) cached(req *flattenedRequest) (*cacheValidators, bool) {
+	if !rc.cacheable(req) || req.cacheMode == CacheModeRefresh {
+		return nil, false
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	validators, ok := rc.validators[req.fetchConfig.URL.String()]
+
+	return validators, ok
+}
+
+// fresh will return true if the previous response to the request is still fresh, in which case the request is not
+// sent.
+func (rc *responseCache) fresh(req *flattenedRequest) bool {
+	validators, ok := rc.cached(req)
+
+	return ok && time.Now().Before(validators.Expires)
+}
+
+// conditional will return a copy of the job that sends the validators of the previous response to the request, or the
+// job itself if there are none.
+func (rc *responseCache) conditional(job *webJob) *webJob {
+	validators, ok := rc.cached(job.flattenedRequest)
+	if !ok {
+		return job
+	}
+
+	header := job.fetchConfig.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	if validators.ETag != "" {
+		header.Set("If-None-Match", validators.ETag)
+	}
+
+	if validators.LastModified != "" {
+		header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	fetchConfig := *job.fetchConfig
+	fetchConfig.Header = header
+
+	req := *job.flattenedRequest
+	req.fetchConfig = &fetchConfig
+
+	conditional := *job
+	conditional.flattenedRequest = &req
+
+	return &conditional
+}
+
+// store will hold the validators of the response to the request until the request completes.
+func (rc *responseCache) store(req *flattenedRequest, rsp *web.FetchResponse) {
+	if !rc.cacheable(req) {
+		return
+	}
+
+	validators := newCacheValidators(rsp.Header, time.Now())
+	if validators == nil {
+		validators = new(cacheValidators)
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.pending[req] = validators
+}
+
+// write will store the validators of the completed requests in the cache on the store. The validators of requests
+// whose responses do not have any, or must not be stored, are removed.
+func (rc *responseCache) write(ctx context.Context, completed map[*flattenedRequest]bool) error {
+	if rc == nil {
+		return nil
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if len(rc.pending) == 0 {
+		return nil
+	}
+
+	for req, validators := range rc.pending {
+		if !completed[req] {
+			continue
+		}
+
+		key := req.fetchConfig.URL.String()
+		if validators.ETag == "" && validators.LastModified == "" {
+			delete(rc.validators, key)
+		} else {
+			rc.validators[key] = validators
+		}
+	}
+
+	bytes, err := json.MarshalIndent(rc.validators, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal cache: %w", err)
+	}
+
+	if bytes, err = rc.cipher.seal(bytes); err != nil {
+		return fmt.Errorf("unable to encrypt cache: %w", err)
+	}
+
+	if err := rc.checkpoints.Put(ctx, rc.file, bytes); err != nil {
+		return fmt.Errorf("unable to write cache: %w", err)
+	}
+
+	return nil
+}
+
+// truncatedTables will return the tables of the requests that are truncated before an upsert operation.
+func (cfg *Config) truncatedTables() ([]string, error) {
+	requests, err := cfg.expandRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []string
+
+	for _, req := range requests {
+		if req.Truncate != nil && *req.Truncate && req.TruncateScope == nil {
+			tables = append(tables, req.tables()...)
+		}
+	}
+
+	return tables, nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		if err := (&Cache{}).validate(); !errors.Is(err, ErrInvalidCache) {
+			t.Fatalf("expected error %v, got %v", ErrInvalidCache, err)
+		}
+
+		if err := (*Cache)(nil).validate(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("conditional requests", func(t *testing.T) {
+		t.Parallel()
+
+		var notModified int32
+
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/candles":
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					atomic.AddInt32(&notModified, 1)
+					w.WriteHeader(http.StatusNotModified)
+
+					return
+				}
+
+				w.Header().Set("ETag", `"v1"`)
+			case "/products":
+				if r.Header.Get("If-Modified-Since") != "" {
+					atomic.AddInt32(&notModified, 1)
+					w.WriteHeader(http.StatusNotModified)
+
+					return
+				}
+
+				w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+			}
+
+			w.Write([]byte(`[{"id":1}]`))
+		}))
+		defer testServer.Close()
+
+		cfg, err := NewConfig([]byte(fmt.Sprintf(`
+url: %s
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /candles
+  - endpoint: /products
+  - endpoint: /trades
+    truncate: true
+`, testServer.URL)))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		truncated, err := cfg.truncatedTables()
+		if err != nil {
+			t.Fatalf("error listing truncated tables: %v", err)
+		}
+
+		cache := &Cache{File: filepath.Join(t.TempDir(), "cache.json")}
+
+		// run will fetch every request with the validators of the previous run, returning the number of requests
+		// that are not modified.
+		run := func(completed bool) int {
+			rc, err := cache.load(context.Background(), fileCheckpoints{}, nil, truncated)
+			if err != nil {
+				t.Fatalf("error loading cache: %v", err)
+			}
+
+			requests, err := cfg.flattenRequests(context.Background())
+			if err != nil {
+				t.Fatalf("error flattening requests: %v", err)
+			}
+
+			done := make(map[*flattenedRequest]bool)
+			count := 0
+
+			for _, req := range requests {
+				job := &webJob{flattenedRequest: req, logger: cfg.Logger, cache: rc}
+
+				_, _, _, err := fetchPages(context.Background(), job)
+				if errors.Is(err, errNotModified) {
+					count++
+				} else if err != nil {
+					t.Fatalf("error fetching: %v", err)
+				}
+
+				done[req] = completed
+			}
+
+			if err := rc.write(context.Background(), done); err != nil {
+				t.Fatalf("error writing cache: %v", err)
+			}
+
+			return count
+		}
+
+		if count := run(false); count != 0 {
+			t.Fatalf("expected the first run to be modified, got %d not modified", count)
+		}
+
+		// The validators of requests that did not complete are not stored.
+		if count := run(true); count != 0 {
+			t.Fatalf("expected the second run to be modified, got %d not modified", count)
+		}
+
+		if count := run(true); count != 2 {
+			t.Fatalf("expected 2 requests not modified, got %d", count)
+		}
+
+		if count := atomic.LoadInt32(&notModified); count != 2 {
+			t.Fatalf("expected the server to receive 2 conditional requests, got %d", count)
+		}
+	})
+
+	t.Run("modes", func(t *testing.T) {
+		t.Parallel()
+
+		var received int32
+
+		testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&received, 1)
+
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+
+			w.Header().Set("ETag", `"v1"`)
+
+			if r.URL.Path == "/products" {
+				w.Header().Set("Cache-Control", "public, max-age=3600")
+			}
+
+			w.Write([]byte(`[{"id":1}]`))
+		}))
+		defer testServer.Close()
+
+		// run will fetch the request with the cache mode twice, storing the validators of the first response, and
+		// return the number of requests made by the second run and whether it was not modified.
+		run := func(endpoint string, mode CacheMode) (int32, bool) {
+			cfg, err := NewConfig([]byte(fmt.Sprintf(`
+url: %s
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: %s
+    cache: %s
+`, testServer.URL, endpoint, mode)))
+			if err != nil {
+				t.Fatalf("error creating config: %v", err)
+			}
+
+			cache := &Cache{File: filepath.Join(t.TempDir(), "cache.json")}
+
+			var (
+				before      int32
+				notModified bool
+			)
+
+			for idx := 0; idx < 2; idx++ {
+				rc, err := cache.load(context.Background(), fileCheckpoints{}, nil, nil)
+				if err != nil {
+					t.Fatalf("error loading cache: %v", err)
+				}
+
+				requests, err := cfg.flattenRequests(context.Background())
+				if err != nil {
+					t.Fatalf("error flattening requests: %v", err)
+				}
+
+				before = atomic.LoadInt32(&received)
+
+				job := &webJob{flattenedRequest: requests[0], logger: cfg.Logger, cache: rc}
+
+				_, _, _, err = fetchPages(context.Background(), job)
+				if notModified = errors.Is(err, errNotModified); err != nil && !notModified {
+					t.Fatalf("error fetching: %v", err)
+				}
+
+				if err := rc.write(context.Background(), map[*flattenedRequest]bool{requests[0]: true}); err != nil {
+					t.Fatalf("error writing cache: %v", err)
+				}
+			}
+
+			return atomic.LoadInt32(&received) - before, notModified
+		}
+
+		for _, tcase := range []struct {
+			endpoint    string
+			mode        CacheMode
+			requests    int32
+			notModified bool
+		}{
+			{"/candles", CacheModePrefer, 1, true},
+			{"/candles", CacheModeNever, 1, false},
+			{"/candles", CacheModeRefresh, 1, false},
+			{"/products", CacheModePrefer, 0, true},
+			{"/products", CacheModeRefresh, 1, false},
+		} {
+			requests, notModified := run(tcase.endpoint, tcase.mode)
+			if requests != tcase.requests || notModified != tcase.notModified {
+				t.Fatalf("expected %s with mode %q to make %d requests (not modified %v), got %d (%v)",
+					tcase.endpoint, tcase.mode, tcase.requests, tcase.notModified, requests, notModified)
+			}
+		}
+
+		if err := CacheMode("always").validate(); !errors.Is(err, ErrInvalidCache) {
+			t.Fatalf("expected error %v, got %v", ErrInvalidCache, err)
+		}
+	})
+
+	t.Run("validators", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		for _, tcase := range []struct {
+			cacheControl string
+			expected     *cacheValidators
+		}{
+			{"", &cacheValidators{ETag: `"v1"`}},
+			{"max-age=60", &cacheValidators{ETag: `"v1"`, Expires: now.Add(time.Minute)}},
+			{"no-cache, max-age=60", &cacheValidators{ETag: `"v1"`}},
+			{"private, no-store", nil},
+		} {
+			header := http.Header{"Etag": {`"v1"`}, "Cache-Control": {tcase.cacheControl}}
+			if validators := newCacheValidators(header, now); !reflect.DeepEqual(validators, tcase.expected) {
+				t.Fatalf("expected validators %+v for %q, got %+v", tcase.expected, tcase.cacheControl, validators)
+			}
+		}
+	})
+
+	t.Run("not cacheable", func(t *testing.T) {
+		t.Parallel()
+
+		rc, err := (&Cache{File: filepath.Join(t.TempDir(), "cache.json")}).load(context.Background(), fileCheckpoints{}, nil, []string{"trades"})
+		if err != nil {
+			t.Fatalf("error loading cache: %v", err)
+		}
+
+		for _, tcase := range []struct {
+			name string
+			req  *flattenedRequest
+		}{
+			{"truncated", &flattenedRequest{fetchConfig: &web.FetchConfig{Method: http.MethodGet}, table: "trades"}},
+			{"post", &flattenedRequest{fetchConfig: &web.FetchConfig{Method: http.MethodPost}, table: "candles"}},
+			{"paginated", &flattenedRequest{
+				fetchConfig: &web.FetchConfig{Method: http.MethodGet}, table: "candles", pagination: &Pagination{},
+			}},
+		} {
+			if rc.cacheable(tcase.req) {
+				t.Fatalf("expected the %s request not to be cacheable", tcase.name)
+			}
+		}
+
+		if (*responseCache)(nil).cacheable(&flattenedRequest{fetchConfig: &web.FetchConfig{Method: http.MethodGet}}) {
+			t.Fatal("expected requests not to be cacheable without a cache")
+		}
+	})
+}
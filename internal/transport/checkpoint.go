@@ -0,0 +1,235 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// checkpointFileMode is the file mode of the checkpoints of the file store.
+	checkpointFileMode = 0o600
+
+	// checkpointDirMode is the file mode of the directories of the checkpoints of the file store.
+	checkpointDirMode = 0o700
+)
+
+var (
+	// ErrCheckpointNotFound is returned by a checkpoint store when it does not have a checkpoint with the key.
+	ErrCheckpointNotFound = fmt.Errorf("checkpoint not found")
+
+	// ErrInvalidCheckpoints is returned when the checkpoints of the configuration are invalid.
+	ErrInvalidCheckpoints = fmt.Errorf("invalid checkpoints")
+)
+
+// InvalidCheckpointsError wraps an error with ErrInvalidCheckpoints.
+func InvalidCheckpointsError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCheckpoints, msg)
+}
+
+// CheckpointStore stores the state that a run leaves for the later runs: the snapshot to resume from, and the
+// validators of the cache of conditional requests. The keys are the "file" of the snapshot and of the cache.
+type CheckpointStore interface {
+	// Get will return the checkpoint with the key, or an error wrapping ErrCheckpointNotFound if there is none.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Put will store the checkpoint under the key, replacing the checkpoint with the key, if there is one.
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Delete will remove the checkpoint with the key. It is not an error if there is none.
+	Delete(ctx context.Context, key string) error
+}
+
+// Checkpoints stores the snapshots and caches of the runs in a durable store instead of the local filesystem, e.g. for
+// runs on ephemeral containers. The store is selected by the scheme of its URL:
+//
+//   - "file:///var/lib/gidari" stores the checkpoints as files in the directory.
+//   - "redis://:password@localhost:6379/0" stores the checkpoints as keys of Redis, "rediss" uses TLS.
+//   - "s3://bucket/prefix" stores the checkpoints as objects of an S3 bucket, with the credentials chain of the AWS
+//     SDKs.
+//   - a connection string of a storage, e.g. "postgresql://localhost:5432/db", stores the checkpoints as records of
+//     a table of the storage.
+type Checkpoints struct {
+	// URL is the URL of the store, which can reference an AWS secret like the connection strings.
+	URL string `yaml:"url"`
+
+	// Prefix is prepended to the keys of the checkpoints, e.g. to share a store between configurations.
+	Prefix string `yaml:"prefix"`
+
+	// Table is the table of the checkpoints on a storage, the default is "gidari_checkpoints".
+	Table string `yaml:"table"`
+
+	// Store is the store of the checkpoints, e.g. a store of a program using the library. It takes precedence over
+	// the URL.
+	Store CheckpointStore `yaml:"-"`
+}
+
+// validate will ensure that the checkpoints are valid.
+func (checkpoints *Checkpoints) validate() error {
+	if checkpoints == nil || checkpoints.Store != nil {
+		return nil
+	}
+
+	if checkpoints.URL == "" {
+		return InvalidCheckpointsError("url is required")
+	}
+
+	// References to secrets are resolved when the store is used.
+	if _, ok := parseAWSSecret(checkpoints.URL); ok {
+		return nil
+	}
+
+	if _, _, ok := strings.Cut(checkpoints.URL, "://"); !ok {
+		return InvalidCheckpointsError(fmt.Sprintf("url %q has no scheme", checkpoints.URL))
+	}
+
+	return nil
+}
+
+// store will return the store of the checkpoints. Without checkpoints, the keys are paths of the local filesystem.
+func (checkpoints *Checkpoints) store(ctx context.Context) (CheckpointStore, error) {
+	if checkpoints == nil {
+		return fileCheckpoints{}, nil
+	}
+
+	var store CheckpointStore
+
+	switch {
+	case checkpoints.Store != nil:
+		store = checkpoints.Store
+	default:
+		resolved, err := resolveSecret(ctx, checkpoints.URL)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve checkpoints url: %w", err)
+		}
+
+		if store, err = newCheckpointStore(resolved, checkpoints.Table); err != nil {
+			return nil, err
+		}
+	}
+
+	if checkpoints.Prefix == "" {
+		return store, nil
+	}
+
+	return prefixedCheckpoints{CheckpointStore: store, prefix: checkpoints.Prefix}, nil
+}
+
+// newCheckpointStore will return the store of the URL.
+func newCheckpointStore(rawURL, table string) (CheckpointStore, error) {
+	scheme, _, _ := strings.Cut(rawURL, "://")
+
+	switch scheme {
+	case "file", "redis", "rediss", "s3":
+	default:
+		return newTableCheckpoints(rawURL, table), nil
+	}
+
+	storeURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, InvalidCheckpointsError(fmt.Sprintf("unable to parse url: %v", err))
+	}
+
+	switch scheme {
+	case "file":
+		return fileCheckpoints{dir: storeURL.Path}, nil
+	case "s3":
+		return newS3Checkpoints(storeURL)
+	default:
+		return newRedisCheckpoints(storeURL)
+	}
+}
+
+// checkpointStore will return the store of the checkpoints of the configuration.
+func (cfg *Config) checkpointStore(ctx context.Context) (CheckpointStore, error) {
+	return cfg.Checkpoints.store(ctx)
+}
+
+// prefixedCheckpoints prepends a prefix to the keys of the checkpoints of a store.
+type prefixedCheckpoints struct {
+	CheckpointStore
+	prefix string
+}
+
+func (store prefixedCheckpoints) Get(ctx context.Context, key string) ([]byte, error) {
+	return store.CheckpointStore.Get(ctx, store.prefix+key)
+}
+
+func (store prefixedCheckpoints) Put(ctx context.Context, key string, data []byte) error {
+	return store.CheckpointStore.Put(ctx, store.prefix+key, data)
+}
+
+func (store prefixedCheckpoints) Delete(ctx context.Context, key string) error {
+	return store.CheckpointStore.Delete(ctx, store.prefix+key)
+}
+
+// fileCheckpoints stores the checkpoints as files of a directory. If the directory is empty, the keys are the paths of
+// the files.
+type fileCheckpoints struct {
+	dir string
+}
+
+// path will return the path of the file of the checkpoint with the key.
+func (store fileCheckpoints) path(key string) string {
+	if store.dir == "" {
+		return key
+	}
+
+	return filepath.Join(store.dir, filepath.FromSlash(key))
+}
+
+func (store fileCheckpoints) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(store.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, key)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint: %w", err)
+	}
+
+	return data, nil
+}
+
+// Put will write the checkpoint to a temporary file that is renamed to the file of the checkpoint, so that the file
+// is never partially written.
+func (store fileCheckpoints) Put(_ context.Context, key string, data []byte) error {
+	path := store.path(key)
+
+	if store.dir != "" {
+		if err := os.MkdirAll(filepath.Dir(path), checkpointDirMode); err != nil {
+			return fmt.Errorf("unable to create checkpoint directory: %w", err)
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, checkpointFileMode); err != nil {
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (store fileCheckpoints) Delete(_ context.Context, key string) error {
+	if err := os.Remove(store.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to remove checkpoint: %w", err)
+	}
+
+	return nil
+}
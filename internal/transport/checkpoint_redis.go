@@ -0,0 +1,212 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRedisPort is the port of Redis if the URL of the checkpoints has none.
+	defaultRedisPort = "6379"
+
+	// redisTimeout is the timeout of the commands of the Redis checkpoints, if the context has no deadline.
+	redisTimeout = 30 * time.Second
+)
+
+// redisCheckpoints stores the checkpoints as keys of Redis, with the commands of the RESP protocol. There is a
+// connection for every command, since the checkpoints are read and written a few times per run.
+type redisCheckpoints struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	db       string
+}
+
+func newRedisCheckpoints(storeURL *url.URL) (*redisCheckpoints, error) {
+	store := &redisCheckpoints{addr: storeURL.Host, tls: storeURL.Scheme == "rediss"}
+
+	if storeURL.Port() == "" {
+		store.addr = net.JoinHostPort(storeURL.Hostname(), defaultRedisPort)
+	}
+
+	if storeURL.User != nil {
+		store.username = storeURL.User.Username()
+		store.password, _ = storeURL.User.Password()
+	}
+
+	if db := strings.Trim(storeURL.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, InvalidCheckpointsError(fmt.Sprintf("invalid redis database %q", db))
+		}
+
+		store.db = db
+	}
+
+	return store, nil
+}
+
+// do will execute the command on a new connection to Redis, after authenticating and selecting the database.
+func (store *redisCheckpoints) do(ctx context.Context, args ...string) (*redisReply, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, redisTimeout)
+		defer cancel()
+	}
+
+	var dialer interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	} = &net.Dialer{}
+
+	if store.tls {
+		dialer = &tls.Dialer{}
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", store.addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	commands := make([][]string, 0, 3)
+
+	switch {
+	case store.username != "" && store.password != "":
+		commands = append(commands, []string{"AUTH", store.username, store.password})
+	case store.password != "":
+		commands = append(commands, []string{"AUTH", store.password})
+	}
+
+	if store.db != "" {
+		commands = append(commands, []string{"SELECT", store.db})
+	}
+
+	commands = append(commands, args)
+	reader := bufio.NewReader(conn)
+
+	var reply *redisReply
+
+	for _, command := range commands {
+		if _, err := conn.Write(encodeRedisCommand(command)); err != nil {
+			return nil, fmt.Errorf("unable to send redis command: %w", err)
+		}
+
+		if reply, err = readRedisReply(reader); err != nil {
+			return nil, err
+		}
+
+		if reply.err != "" {
+			return nil, fmt.Errorf("redis %s: %s", command[0], reply.err)
+		}
+	}
+
+	return reply, nil
+}
+
+func (store *redisCheckpoints) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := store.do(ctx, "GET", key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint: %w", err)
+	}
+
+	if reply.null {
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, key)
+	}
+
+	return reply.data, nil
+}
+
+func (store *redisCheckpoints) Put(ctx context.Context, key string, data []byte) error {
+	if _, err := store.do(ctx, "SET", key, string(data)); err != nil {
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (store *redisCheckpoints) Delete(ctx context.Context, key string) error {
+	if _, err := store.do(ctx, "DEL", key); err != nil {
+		return fmt.Errorf("unable to remove checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// redisReply is a reply of Redis to a command. Only the replies of the commands of the checkpoints are supported.
+type redisReply struct {
+	data []byte
+	null bool
+	err  string
+}
+
+// encodeRedisCommand will encode the command as an array of bulk strings.
+func encodeRedisCommand(args []string) []byte {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "*%d\r\n", len(args))
+
+	for _, arg := range args {
+		fmt.Fprintf(&builder, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	return []byte(builder.String())
+}
+
+// readRedisReply will read a simple string, error, integer, or bulk string reply.
+func readRedisReply(reader *bufio.Reader) (*redisReply, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("unable to read redis reply: %w", err)
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("unable to read redis reply: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return &redisReply{data: []byte(line[1:])}, nil
+	case '-':
+		return &redisReply{err: line[1:]}, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("unable to read redis reply: invalid size %q", line[1:])
+		}
+
+		if size < 0 {
+			return &redisReply{null: true}, nil
+		}
+
+		data := make([]byte, size+len("\r\n"))
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("unable to read redis reply: %w", err)
+		}
+
+		return &redisReply{data: data[:size]}, nil
+	default:
+		return nil, fmt.Errorf("unable to read redis reply: unexpected reply %q", line)
+	}
+}
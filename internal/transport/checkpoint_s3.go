@@ -0,0 +1,147 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web/auth"
+)
+
+// s3Checkpoints stores the checkpoints as objects of an S3 bucket, under the prefix of the URL of the checkpoints. The
+// region is the "region" query parameter of the URL or the region of the environment, and the AWS_ENDPOINT_URL
+// environment variable overrides the endpoint, e.g. for a VPC endpoint or an S3 compatible store.
+type s3Checkpoints struct {
+	bucket string
+	prefix string
+	region string
+	chain  *auth.AWSCredentialsChain
+}
+
+func newS3Checkpoints(storeURL *url.URL) (*s3Checkpoints, error) {
+	if storeURL.Host == "" {
+		return nil, InvalidCheckpointsError("s3 url has no bucket")
+	}
+
+	region := storeURL.Query().Get("region")
+	if region == "" {
+		region = envRegion()
+	}
+
+	if region == "" {
+		return nil, InvalidCheckpointsError(fmt.Sprintf("no region for bucket %q", storeURL.Host))
+	}
+
+	return &s3Checkpoints{
+		bucket: storeURL.Host,
+		prefix: strings.Trim(storeURL.Path, "/"),
+		region: region,
+		chain:  auth.NewAWSCredentialsChain(""),
+	}, nil
+}
+
+// objectURL will return the URL of the object of the checkpoint with the key. Without AWS_ENDPOINT_URL, the URL is
+// virtual-hosted style, otherwise it is path style.
+func (store *s3Checkpoints) objectURL(key string) string {
+	object := strings.TrimPrefix(path.Join("/", store.prefix, key), "/")
+	escaped := (&url.URL{Path: object}).EscapedPath()
+
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint, "/"), store.bucket, escaped)
+	}
+
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", store.bucket, store.region, escaped)
+}
+
+// do will send the signed request for the object of the checkpoint, returning the status code and body of the
+// response.
+func (store *s3Checkpoints) do(ctx context.Context, method, key string, body []byte) (int, []byte, error) {
+	creds, err := store.chain.Retrieve(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to retrieve AWS credentials: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, awsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, store.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to create s3 request: %w", err)
+	}
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	auth.SignV4(req, body, creds, store.region, "s3", time.Now())
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to reach s3: %w", err)
+	}
+
+	defer rsp.Body.Close()
+
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to read s3 response: %w", err)
+	}
+
+	return rsp.StatusCode, data, nil
+}
+
+func (store *s3Checkpoints) Get(ctx context.Context, key string) ([]byte, error) {
+	status, data, err := store.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint: %w", err)
+	}
+
+	switch status {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, key)
+	default:
+		return nil, fmt.Errorf("unable to read checkpoint: status %d from s3: %s", status, data)
+	}
+}
+
+func (store *s3Checkpoints) Put(ctx context.Context, key string, data []byte) error {
+	status, body, err := store.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return fmt.Errorf("unable to write checkpoint: %w", err)
+	}
+
+	if status != http.StatusOK {
+		return fmt.Errorf("unable to write checkpoint: status %d from s3: %s", status, body)
+	}
+
+	return nil
+}
+
+func (store *s3Checkpoints) Delete(ctx context.Context, key string) error {
+	status, body, err := store.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return fmt.Errorf("unable to remove checkpoint: %w", err)
+	}
+
+	if status != http.StatusNoContent && status != http.StatusOK && status != http.StatusNotFound {
+		return fmt.Errorf("unable to remove checkpoint: status %d from s3: %s", status, body)
+	}
+
+	return nil
+}
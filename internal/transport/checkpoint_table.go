@@ -0,0 +1,156 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// defaultCheckpointsTable is the default table of the checkpoints on a storage.
+const defaultCheckpointsTable = "gidari_checkpoints"
+
+// tableCheckpoints stores the checkpoints as records of a table of a storage, with the data of the checkpoints encoded
+// as base64. Getting a checkpoint requires a storage that implements the Finder interface of the storage package.
+type tableCheckpoints struct {
+	dns   string
+	table string
+}
+
+// tableCheckpoint is a record of the checkpoints table.
+type tableCheckpoint struct {
+	Key       string `json:"key"`
+	Data      string `json:"data"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+func newTableCheckpoints(dns, table string) *tableCheckpoints {
+	if table == "" {
+		table = defaultCheckpointsTable
+	}
+
+	return &tableCheckpoints{dns: dns, table: table}
+}
+
+// createTableRequest will return the request to create the checkpoints table.
+func (store *tableCheckpoints) createTableRequest() *proto.CreateTableRequest {
+	return &proto.CreateTableRequest{
+		Table: store.table,
+		Columns: []*proto.Column{
+			{Name: "key", Type: "string", Required: true},
+			{Name: "data", Type: "string", Required: true},
+			{Name: "updatedAt", Type: "timestamp", Required: true},
+		},
+		PrimaryKeys: []string{"key"},
+	}
+}
+
+// transact will execute fn on a transaction of the storage, creating the checkpoints table if it does not exist.
+func (store *tableCheckpoints) transact(ctx context.Context, fn func(context.Context, repository.Generic) error) error {
+	repo, err := repository.NewTx(ctx, store.dns)
+	if err != nil {
+		return WrapRepositoryError(repository.FailedToCreateRepositoryError(err))
+	}
+
+	defer repo.Close()
+
+	if _, err := repo.CreateTable(ctx, store.createTableRequest()); err != nil {
+		return fmt.Errorf("unable to create checkpoints table %q: %w", store.table, err)
+	}
+
+	repo.TransactContext(ctx, fn)
+
+	if err := repo.Commit(); err != nil {
+		return fmt.Errorf("unable to commit checkpoint on %q: %w", storage.Scheme(repo.Type()), err)
+	}
+
+	return nil
+}
+
+func (store *tableCheckpoints) Get(ctx context.Context, key string) ([]byte, error) {
+	repo, err := repository.New(ctx, store.dns)
+	if err != nil {
+		return nil, WrapRepositoryError(repository.FailedToCreateRepositoryError(err))
+	}
+
+	defer repo.Close()
+
+	if _, err := repo.CreateTable(ctx, store.createTableRequest()); err != nil {
+		return nil, fmt.Errorf("unable to create checkpoints table %q: %w", store.table, err)
+	}
+
+	var encoded *string
+
+	err = repo.Find(ctx, store.table, []map[string]interface{}{{"key": key}}, func(record map[string]interface{}) error {
+		data := fmt.Sprint(record["data"])
+		encoded = &data
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint: %w", err)
+	}
+
+	if encoded == nil {
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, key)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(*encoded)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode checkpoint %q: %w", key, err)
+	}
+
+	return data, nil
+}
+
+func (store *tableCheckpoints) Put(ctx context.Context, key string, data []byte) error {
+	record, err := json.Marshal(&tableCheckpoint{
+		Key:       key,
+		Data:      base64.StdEncoding.EncodeToString(data),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode checkpoint: %w", err)
+	}
+
+	req := &proto.UpsertRequest{Table: store.table, Data: record, DataType: int32(tools.UpsertDataJSON)}
+
+	return store.transact(ctx, func(sctx context.Context, repo repository.Generic) error {
+		if _, err := repo.Upsert(sctx, req); err != nil {
+			return fmt.Errorf("unable to upsert checkpoint: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (store *tableCheckpoints) Delete(ctx context.Context, key string) error {
+	required, err := structpb.NewStruct(map[string]interface{}{"key": key})
+	if err != nil {
+		return fmt.Errorf("unable to encode checkpoint key: %w", err)
+	}
+
+	req := &proto.DeleteRequest{Table: store.table, Required: required}
+
+	return store.transact(ctx, func(sctx context.Context, repo repository.Generic) error {
+		if _, err := repo.Delete(sctx, req); err != nil {
+			return fmt.Errorf("unable to delete checkpoint: %w", err)
+		}
+
+		return nil
+	})
+}
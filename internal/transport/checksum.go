@@ -0,0 +1,202 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultChecksumKey is the key of the records of the tables that do not have a schema with a primary key.
+const defaultChecksumKey = "id"
+
+// TableChecksum is the checksum of the records of a table on a storage.
+type TableChecksum struct {
+	// Records is the number of records in the table.
+	Records int64
+
+	// Checksum is the hex encoded SHA-256 checksum of the records of the table.
+	Checksum string
+}
+
+// StorageChecksum are the checksums of the tables of a storage.
+type StorageChecksum struct {
+	// Scheme is the scheme of the storage, e.g. "postgresql".
+	Scheme string
+
+	// Tables maps each table that is routed to the storage to its checksum.
+	Tables map[string]*TableChecksum
+}
+
+// ChecksumResult is the result of a checksum operation.
+type ChecksumResult struct {
+	// Storages are the checksums of each storage, in the order of the connection strings of the configuration.
+	Storages []*StorageChecksum
+}
+
+// Mismatches will return the sorted tables whose checksums are not the same on every storage that the table is
+// routed to.
+func (result *ChecksumResult) Mismatches() []string {
+	checksums := make(map[string]string)
+	mismatched := make(map[string]bool)
+
+	for _, stg := range result.Storages {
+		for table, sum := range stg.Tables {
+			if checksum, ok := checksums[table]; ok && checksum != sum.Checksum {
+				mismatched[table] = true
+			}
+
+			checksums[table] = sum.Checksum
+		}
+	}
+
+	tables := make([]string, 0, len(mismatched))
+	for table := range mismatched {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	return tables
+}
+
+// tableScanner reads every record of a table.
+type tableScanner interface {
+	Scan(ctx context.Context, table string, fn func(record map[string]interface{}) error) error
+}
+
+// checksumEntry is a record of a table, identified by its key and the hash of its canonical encoding.
+type checksumEntry struct {
+	key  []byte
+	hash [sha256.Size]byte
+}
+
+// checksumTable will compute the checksum of the records of the table. Each record is hashed by its canonical JSON
+// encoding, which sorts the fields of objects. The hashes are then ordered by the key of their record, and by the
+// hash itself for records with the same key, and hashed together. The order is computed here rather than by the
+// storage, so that the checksum does not depend on the order that the storage returns the records in or on its
+// collation.
+func checksumTable(ctx context.Context, scanner tableScanner, table string, keys []string) (*TableChecksum, error) {
+	var entries []checksumEntry
+
+	err := scanner.Scan(ctx, table, func(record map[string]interface{}) error {
+		canonical, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("unable to encode record: %w", err)
+		}
+
+		keyVals := make([]interface{}, len(keys))
+		for idx, key := range keys {
+			keyVals[idx] = record[key]
+		}
+
+		key, err := json.Marshal(keyVals)
+		if err != nil {
+			return fmt.Errorf("unable to encode record key: %w", err)
+		}
+
+		entries = append(entries, checksumEntry{key: key, hash: sha256.Sum256(canonical)})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan table %q: %w", table, err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if cmp := bytes.Compare(entries[i].key, entries[j].key); cmp != 0 {
+			return cmp < 0
+		}
+
+		return bytes.Compare(entries[i].hash[:], entries[j].hash[:]) < 0
+	})
+
+	hash := sha256.New()
+	for _, entry := range entries {
+		hash.Write(entry.hash[:])
+	}
+
+	return &TableChecksum{Records: int64(len(entries)), Checksum: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// checksumKeys will return the fields that key the records of the table: the primary key of its schema, or "id".
+func (cfg *Config) checksumKeys(table string) []string {
+	if schema := cfg.Schemas[table]; schema != nil && len(schema.PrimaryKey) > 0 {
+		return schema.PrimaryKey
+	}
+
+	return []string{defaultChecksumKey}
+}
+
+// Checksum will compute a deterministic checksum of the records of each table on every storage that the table is
+// routed to, so that storages written to by the same runs can be cheaply verified to hold identical data. The tables
+// are the tables that the requests of the configuration write to, if none are given. The checksum of a table does not
+// depend on the storage, as long as the storage holds the same records. Every storage must implement the Scanner
+// interface of the storage package.
+func Checksum(ctx context.Context, cfg *Config, tables ...string) (*ChecksumResult, error) {
+	start := time.Now()
+
+	if len(tables) == 0 {
+		var err error
+		if tables, err = cfg.purgeTables(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ChecksumResult{}
+	routing := cfg.routing()
+
+	for idx, dns := range cfg.ConnectionStrings {
+		resolved, err := resolveSecret(ctx, dns)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve connection string: %w", err)
+		}
+
+		repo, err := repository.New(ctx, resolved)
+		if err != nil {
+			return nil, WrapRepositoryError(repository.FailedToCreateRepositoryError(err))
+		}
+
+		stg := &StorageChecksum{Scheme: storage.Scheme(repo.Type()), Tables: make(map[string]*TableChecksum)}
+
+		for _, table := range routing.filter(idx, tables) {
+			sum, err := checksumTable(ctx, repo, table, cfg.checksumKeys(table))
+			if err != nil {
+				repo.Close()
+
+				return nil, fmt.Errorf("unable to compute checksum on %q: %w", stg.Scheme, err)
+			}
+
+			stg.Tables[table] = sum
+		}
+
+		repo.Close()
+
+		result.Storages = append(result.Storages, stg)
+	}
+
+	logInfo := tools.LogEvent{
+		Duration: time.Since(start),
+		Msg:      "computed checksums of tables",
+		Count:    len(tables),
+	}
+	logInfo.Log(cfg.Logger, logrus.InfoLevel)
+
+	return result, nil
+}
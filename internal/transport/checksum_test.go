@@ -0,0 +1,164 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeScanner is a table scanner that returns the records of its tables in order.
+type fakeScanner map[string][]map[string]interface{}
+
+func (scanner fakeScanner) Scan(_ context.Context, table string, fn func(map[string]interface{}) error) error {
+	for _, record := range scanner[table] {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestChecksumTable(t *testing.T) {
+	t.Parallel()
+
+	records := []map[string]interface{}{
+		{"id": "b", "price": 2.5, "tags": []interface{}{"x"}},
+		{"id": "a", "price": 1.0, "meta": map[string]interface{}{"y": true, "x": "z"}},
+		{"id": "c", "price": 3.0},
+	}
+
+	reversed := []map[string]interface{}{records[2], records[1], records[0]}
+
+	for _, tcase := range []struct {
+		name  string
+		other []map[string]interface{}
+		keys  []string
+		equal bool
+	}{
+		{
+			name:  "same order",
+			other: records,
+			keys:  []string{"id"},
+			equal: true,
+		},
+		{
+			name:  "different order",
+			other: reversed,
+			keys:  []string{"id"},
+			equal: true,
+		},
+		{
+			name:  "missing key",
+			other: reversed,
+			keys:  []string{"missing"},
+			equal: true,
+		},
+		{
+			name:  "different value",
+			other: []map[string]interface{}{records[0], records[1], {"id": "c", "price": 3.1}},
+			keys:  []string{"id"},
+		},
+		{
+			name:  "missing record",
+			other: records[:2],
+			keys:  []string{"id"},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			sum, err := checksumTable(ctx, fakeScanner{"t": records}, "t", tcase.keys)
+			if err != nil {
+				t.Fatalf("error computing checksum: %v", err)
+			}
+
+			other, err := checksumTable(ctx, fakeScanner{"t": tcase.other}, "t", tcase.keys)
+			if err != nil {
+				t.Fatalf("error computing checksum: %v", err)
+			}
+
+			if sum.Records != int64(len(records)) || other.Records != int64(len(tcase.other)) {
+				t.Fatalf("unexpected record counts %d and %d", sum.Records, other.Records)
+			}
+
+			if equal := sum.Checksum == other.Checksum; equal != tcase.equal {
+				t.Fatalf("expected checksums to be equal=%v, got %q and %q", tcase.equal, sum.Checksum, other.Checksum)
+			}
+		})
+	}
+
+	t.Run("scan error", func(t *testing.T) {
+		t.Parallel()
+
+		errScan := errors.New("scan failed")
+
+		scanner := fakeScanner{"t": {{"fn": func() {}}}}
+		if _, err := checksumTable(context.Background(), scanner, "t", nil); err == nil {
+			t.Fatal("expected an error encoding the record")
+		}
+
+		_, err := checksumTable(context.Background(), failingScanner{errScan}, "t", nil)
+		if !errors.Is(err, errScan) {
+			t.Fatalf("expected error %v, got %v", errScan, err)
+		}
+	})
+}
+
+// failingScanner is a table scanner that fails.
+type failingScanner struct{ err error }
+
+func (scanner failingScanner) Scan(context.Context, string, func(map[string]interface{}) error) error {
+	return scanner.err
+}
+
+func TestChecksumResultMismatches(t *testing.T) {
+	t.Parallel()
+
+	result := &ChecksumResult{Storages: []*StorageChecksum{
+		{Scheme: "mongodb", Tables: map[string]*TableChecksum{
+			"a": {Checksum: "1"},
+			"b": {Checksum: "2"},
+			"c": {Checksum: "3"},
+		}},
+		{Scheme: "postgresql", Tables: map[string]*TableChecksum{
+			"a": {Checksum: "1"},
+			"b": {Checksum: "4"},
+		}},
+	}}
+
+	if mismatches := result.Mismatches(); !reflect.DeepEqual(mismatches, []string{"b"}) {
+		t.Fatalf("expected mismatches [b], got %v", mismatches)
+	}
+}
+
+func TestChecksumKeys(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Schemas: map[string]*Schema{
+		"keyed":   {PrimaryKey: []string{"product", "time"}},
+		"unkeyed": {},
+	}}
+
+	for table, expected := range map[string][]string{
+		"keyed":   {"product", "time"},
+		"unkeyed": {"id"},
+		"none":    {"id"},
+	} {
+		if keys := cfg.checksumKeys(table); !reflect.DeepEqual(keys, expected) {
+			t.Fatalf("expected keys %v for %q, got %v", expected, table, keys)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"math"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+)
+
+// ErrInvalidPackage is returned when the package name of generated code is not a Go identifier.
+var ErrInvalidPackage = fmt.Errorf("invalid package name")
+
+// goInitialisms are the words that are upper case in Go identifiers.
+var goInitialisms = map[string]bool{
+	"api": true, "http": true, "id": true, "ip": true, "json": true, "sql": true, "uri": true, "url": true,
+	"utc": true, "uuid": true,
+}
+
+// goName will return the exported Go identifier for a table or field name, e.g. "product_id" is "ProductID".
+func goName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var bldr strings.Builder
+
+	for _, word := range words {
+		if goInitialisms[strings.ToLower(word)] {
+			bldr.WriteString(strings.ToUpper(word))
+
+			continue
+		}
+
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		bldr.WriteString(string(runes))
+	}
+
+	ident := bldr.String()
+	if ident == "" || !unicode.IsLetter([]rune(ident)[0]) {
+		ident = "X" + ident
+	}
+
+	return ident
+}
+
+// codegenField is a field of a generated struct.
+type codegenField struct {
+	Name string
+	Type string
+	Tag  string
+}
+
+// codegenTable is a generated struct for the records of a table.
+type codegenTable struct {
+	Name   string
+	Table  string
+	Source string
+	Fields []*codegenField
+}
+
+// addField will add a field for the column to the struct, renaming it if another column has the same Go name.
+func (table *codegenTable) addField(column, goType string, names map[string]bool) {
+	name := goName(column)
+	for suffix := 2; names[name]; suffix++ {
+		name = fmt.Sprintf("%s%d", goName(column), suffix)
+	}
+
+	names[name] = true
+
+	table.Fields = append(table.Fields, &codegenField{
+		Name: name,
+		Type: goType,
+		Tag:  fmt.Sprintf("`json:%q bson:%q`", column+",omitempty", column+",omitempty"),
+	})
+}
+
+// columnGoTypes are the Go types of the schema column types.
+var columnGoTypes = map[string]string{
+	storage.ColumnTypeString:    "string",
+	storage.ColumnTypeInteger:   "int64",
+	storage.ColumnTypeNumber:    "float64",
+	storage.ColumnTypeBoolean:   "bool",
+	storage.ColumnTypeTimestamp: "time.Time",
+	storage.ColumnTypeJSON:      "interface{}",
+}
+
+// nullable will return the Go type of a column that may be missing or null.
+func nullable(goType string) string {
+	if goType == "interface{}" {
+		return goType
+	}
+
+	return "*" + goType
+}
+
+// schemaTable will return the generated struct for the table of a schema.
+func schemaTable(table string, schema *Schema, lineage *Lineage) *codegenTable {
+	gen := &codegenTable{Name: goName(table), Table: table, Source: "schema"}
+	names := make(map[string]bool)
+
+	for _, column := range schema.Columns {
+		goType := columnGoTypes[column.Type]
+		if !column.Required {
+			goType = nullable(goType)
+		}
+
+		gen.addField(column.Name, goType, names)
+	}
+
+	if lineage != nil {
+		var found bool
+
+		for _, column := range schema.Columns {
+			found = found || column.Name == lineage.field()
+		}
+
+		if !found {
+			gen.addField(lineage.field(), "string", names)
+		}
+	}
+
+	return gen
+}
+
+// sampledType will return the Go type of a field from the values of the field on the sampled records.
+func sampledType(values []interface{}) string {
+	var kinds []string
+
+	for _, val := range values {
+		kind := "interface{}"
+
+		switch val := val.(type) {
+		case string:
+			kind = "string"
+		case bool:
+			kind = "bool"
+		case float64:
+			kind = "float64"
+			if val == math.Trunc(val) {
+				kind = "int64"
+			}
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	goType := kinds[0]
+
+	for _, kind := range kinds[1:] {
+		switch {
+		case kind == goType:
+		case (kind == "int64" && goType == "float64") || (kind == "float64" && goType == "int64"):
+			goType = "float64"
+		default:
+			return "interface{}"
+		}
+	}
+
+	return goType
+}
+
+// sampledTable will return the generated struct for a table from the JSON encoded records of a sampled response.
+// Fields that are missing or null on any of the records are nullable.
+func sampledTable(table string, data []byte) (*codegenTable, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("unable to decode sampled records for table %q: %w", table, err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	var columns []string
+
+	values := make(map[string][]interface{})
+
+	for _, record := range records {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for column, val := range fields {
+			if _, ok := values[column]; !ok {
+				columns = append(columns, column)
+			}
+
+			if val != nil {
+				values[column] = append(values[column], val)
+			} else if values[column] == nil {
+				values[column] = []interface{}{}
+			}
+		}
+	}
+
+	sort.Strings(columns)
+
+	gen := &codegenTable{Name: goName(table), Table: table, Source: "sampled response"}
+	names := make(map[string]bool)
+
+	for _, column := range columns {
+		if len(values[column]) == 0 {
+			gen.addField(column, "interface{}", names)
+
+			continue
+		}
+
+		goType := sampledType(values[column])
+		if len(values[column]) < len(records) {
+			goType = nullable(goType)
+		}
+
+		gen.addField(column, goType, names)
+	}
+
+	return gen, nil
+}
+
+// sampleUpserts will make the web request and return the upsert requests of its response, without upserting them.
+func sampleUpserts(ctx context.Context, cfg *Config, req *flattenedRequest) ([]*proto.UpsertRequest, error) {
+	job := &webJob{flattenedRequest: req, logger: cfg.logger(logWeb), quietHours: cfg.QuietHours,
+		maintenance: cfg.Maintenance}
+
+	rsp, records, _, err := fetch(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, _ := captureHeaders(rsp.Header, req.headers)
+	for field, value := range cfg.Lineage.fields("") {
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+
+		fields[field] = value
+	}
+
+	return newUpsertRequests(&repoJob{
+		b:            records,
+		table:        req.table,
+		split:        req.split,
+		fields:       fields,
+		singletonKey: req.singletonKey,
+		normalizers:  req.normalizers,
+		projection:   req.projection,
+	})
+}
+
+// sampleTables will make the first web request of each table without a schema that has records, and return the
+// generated structs for the records of its response.
+func sampleTables(ctx context.Context, cfg *Config) (map[string]*codegenTable, error) {
+	flattenedRequests, err := cfg.flattenRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]*codegenTable)
+
+	// The requests of a foreach are not sampled, since they are only expanded during a run.
+	for _, req := range flattenedRequests {
+		if req.sink != nil || req.foreach != nil {
+			continue
+		}
+
+		var sample bool
+
+		for _, table := range req.tables() {
+			_, sampled := tables[table]
+			sample = sample || (!sampled && cfg.Schemas[table] == nil)
+		}
+
+		if !sample {
+			continue
+		}
+
+		reqs, err := sampleUpserts(ctx, cfg, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, upsert := range reqs {
+			if _, ok := tables[upsert.Table]; ok || cfg.Schemas[upsert.Table] != nil {
+				continue
+			}
+
+			gen, err := sampledTable(upsert.Table, upsert.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			// Sample the next request of the table if the response has no records.
+			if len(gen.Fields) > 0 {
+				tables[upsert.Table] = gen
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+var codegenTemplate = template.Must(template.New("codegen").Parse(`// Code generated by gidari. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"encoding/json"
+	"fmt"
+{{- if .Time }}
+	"time"
+{{- end }}
+)
+{{ range .Tables }}
+// {{ .Name }}Table is the name of the table of {{ .Name }} records.
+const {{ .Name }}Table = {{ printf "%q" .Table }}
+
+// {{ .Name }} is a record of the {{ printf "%q" .Table }} table, generated from its {{ .Source }}.
+type {{ .Name }} struct {
+{{- range .Fields }}
+	{{ .Name }} {{ .Type }} {{ .Tag }}
+{{- end }}
+}
+
+// Table will return the name of the table of the record.
+func (*{{ .Name }}) Table() string {
+	return {{ .Name }}Table
+}
+
+// Unmarshal{{ .Name }} will decode a JSON object or array of objects into {{ .Name }} records.
+func Unmarshal{{ .Name }}(data []byte) ([]*{{ .Name }}, error) {
+	var records []*{{ .Name }}
+	if err := json.Unmarshal(data, &records); err == nil {
+		return records, nil
+	}
+
+	record := new({{ .Name }})
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("unable to decode {{ .Table }} records: %w", err)
+	}
+
+	return []*{{ .Name }}{record}, nil
+}
+{{ end -}}
+`))
+
+// Generate will return the Go source of a package with a struct for the records of each table of the configuration,
+// so that applications reading the tables have compile-time types. The fields of tables with a schema are derived from
+// its columns, and the fields of other tables are inferred from a sampled response of the web API.
+func Generate(ctx context.Context, cfg *Config, pkg string) ([]byte, error) {
+	if !token.IsIdentifier(pkg) || token.IsKeyword(pkg) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPackage, pkg)
+	}
+
+	tables, err := sampleTables(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for table, schema := range cfg.Schemas {
+		tables[table] = schemaTable(table, schema, cfg.Lineage)
+	}
+
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+
+	sort.Strings(names)
+
+	data := struct {
+		Package string
+		Time    bool
+		Tables  []*codegenTable
+	}{Package: pkg}
+
+	for _, name := range names {
+		for _, field := range tables[name].Fields {
+			data.Time = data.Time || strings.HasSuffix(field.Type, "time.Time")
+		}
+
+		data.Tables = append(data.Tables, tables[name])
+	}
+
+	var buf bytes.Buffer
+	if err := codegenTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("unable to generate code: %w", err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("unable to format generated code: %w", err)
+	}
+
+	return src, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGoName(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		expected string
+	}{
+		{name: "product_id", expected: "ProductID"},
+		{name: "candles", expected: "Candles"},
+		{name: "trade-history.v2", expected: "TradeHistoryV2"},
+		{name: "24h_volume", expected: "X24hVolume"},
+		{name: "_", expected: "X"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if name := goName(tcase.name); name != tcase.expected {
+				t.Fatalf("expected %q, got %q", tcase.expected, name)
+			}
+		})
+	}
+}
+
+func TestSampledType(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		values   []interface{}
+		expected string
+	}{
+		{name: "string", values: []interface{}{"a", "b"}, expected: "string"},
+		{name: "integer", values: []interface{}{1.0, 2.0}, expected: "int64"},
+		{name: "number", values: []interface{}{1.0, 2.5}, expected: "float64"},
+		{name: "boolean", values: []interface{}{true}, expected: "bool"},
+		{name: "object", values: []interface{}{map[string]interface{}{}}, expected: "interface{}"},
+		{name: "mixed", values: []interface{}{"a", 1.0}, expected: "interface{}"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if goType := sampledType(tcase.values); goType != tcase.expected {
+				t.Fatalf("expected %q, got %q", tcase.expected, goType)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id": "BTC-USD", "price": 1.5, "volume": 10}, {"id": "ETH-USD", "price": 2, "halted": true}]`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+rateLimit:
+  burst: 1
+  period: 1
+lineage:
+  field: run_id
+schemas:
+  candles:
+    columns:
+      - name: time
+        type: timestamp
+        required: true
+      - name: close
+        type: number
+requests:
+  - endpoint: /candles
+  - endpoint: /products
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	src, err := Generate(context.Background(), cfg, "tables")
+	if err != nil {
+		t.Fatalf("error generating code: %v", err)
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "tables.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+
+	for _, expected := range []string{
+		"package tables",
+		`const CandlesTable = "candles"`,
+		"Time  time.Time " + "`" + `json:"time,omitempty" bson:"time,omitempty"` + "`",
+		"Close *float64 ",
+		"RunID string ",
+		`const ProductsTable = "products"`,
+		"Halted *bool ",
+		"ID     string ",
+		"Price  float64 ",
+		"Volume *int64 ",
+		"func UnmarshalProducts(data []byte) ([]*Products, error)",
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Errorf("expected generated code to contain %q:\n%s", expected, src)
+		}
+	}
+
+	if _, err := Generate(context.Background(), cfg, "func"); !errors.Is(err, ErrInvalidPackage) {
+		t.Fatalf("expected error %v, got %v", ErrInvalidPackage, err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+// defaultMinBodySize is the size of the smallest request body that is gzipped, if the compression does not define one.
+const defaultMinBodySize = 1024
+
+// ErrInvalidCompression is returned when the compression configuration is invalid.
+var ErrInvalidCompression = fmt.Errorf("invalid compression")
+
+// InvalidCompressionError wraps an error with ErrInvalidCompression.
+func InvalidCompressionError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCompression, msg)
+}
+
+// Compression reduces the bandwidth of the web requests, e.g. on constrained links or for large report queries. The
+// request bodies of at least the minimum size are gzipped, and the requests accept gzip, deflate, brotli, and zstd
+// responses.
+type Compression struct {
+	// MinBodySize is the size in bytes of the smallest request body that is gzipped, the default is 1024.
+	MinBodySize int64 `yaml:"minBodySize"`
+}
+
+// validate will ensure that the compression is valid.
+func (comp *Compression) validate() error {
+	if comp != nil && comp.MinBodySize < 0 {
+		return InvalidCompressionError("minBodySize must not be negative")
+	}
+
+	return nil
+}
+
+// wrap will return the round tripper that compresses the requests sent with the base round tripper, or the base round
+// tripper if there is no compression. If decompression is disabled, the responses are requested without an encoding
+// whether or not there is a compression.
+func (comp *Compression) wrap(base http.RoundTripper, disableDecompression bool) http.RoundTripper {
+	if comp == nil && !disableDecompression {
+		return base
+	}
+
+	if comp == nil {
+		return &web.CompressionTransport{DisableDecompression: true, Base: base}
+	}
+
+	minBodySize := comp.MinBodySize
+	if minBodySize == 0 {
+		minBodySize = defaultMinBodySize
+	}
+
+	return &web.CompressionTransport{MinBodySize: minBodySize, DisableDecompression: disableDecompression, Base: base}
+}
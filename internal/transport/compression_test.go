@@ -0,0 +1,149 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/internal/web/auth"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		if err := (&Compression{MinBodySize: -1}).validate(); !errors.Is(err, ErrInvalidCompression) {
+			t.Fatalf("expected error %v, got %v", ErrInvalidCompression, err)
+		}
+	})
+
+	t.Run("round tripper", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := &Config{Compression: &Compression{}}
+
+		rt, err := cfg.newRoundTripper(new(Egress))
+		if err != nil {
+			t.Fatalf("error creating round tripper: %v", err)
+		}
+
+		ct, ok := rt.(*web.CompressionTransport)
+		if !ok {
+			t.Fatalf("expected a compression transport, got %T", rt)
+		}
+
+		if ct.MinBodySize != defaultMinBodySize {
+			t.Fatalf("expected the default minimum body size, got %d", ct.MinBodySize)
+		}
+
+		if _, ok := ct.Base.(*http.Transport); !ok {
+			t.Fatalf("expected the compression to wrap the egress transport, got %T", ct.Base)
+		}
+
+		rt, err = (&Config{}).newRoundTripper(new(Egress))
+		if err != nil {
+			t.Fatalf("error creating round tripper: %v", err)
+		}
+
+		if _, ok := rt.(*http.Transport); !ok {
+			t.Fatalf("expected requests without compression to use the egress transport, got %T", rt)
+		}
+
+		rt, err = (&Config{DisableDecompression: true}).newRoundTripper(new(Egress))
+		if err != nil {
+			t.Fatalf("error creating round tripper: %v", err)
+		}
+
+		if ct, ok := rt.(*web.CompressionTransport); !ok || !ct.DisableDecompression || ct.MinBodySize != 0 {
+			t.Fatalf("expected a transport that disables decompression without compressing requests, got %+v", rt)
+		}
+	})
+
+	t.Run("sigV4", func(t *testing.T) {
+		t.Parallel()
+
+		creds := auth.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+		rurl, _ := url.Parse("https://api.example.com")
+		cfg := &Config{
+			RawURL:      rurl.String(),
+			URL:         rurl,
+			Logger:      logrus.New(),
+			Compression: &Compression{MinBodySize: 1},
+			Authentication: Authentication{SigV4: &SigV4{
+				Service:         "execute-api",
+				Region:          "us-east-1",
+				AccessKeyID:     creds.AccessKeyID,
+				SecretAccessKey: creds.SecretAccessKey,
+			}},
+		}
+
+		if err := cfg.validate(); errors.Is(err, ErrInvalidAuthentication) {
+			t.Fatalf("expected sigV4 to be valid with compression, got %v", err)
+		}
+
+		// The base round tripper checks that the signature is of the body that is sent.
+		base := cfg.Compression.wrap(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			if req.Header.Get("Content-Encoding") != "gzip" || bytes.Equal(body, []byte(`{"symbol":"BTC"}`)) {
+				t.Errorf("expected the body to be gzipped")
+			}
+
+			now, err := time.Parse("20060102T150405Z", req.Header.Get("X-Amz-Date"))
+			if err != nil {
+				return nil, err
+			}
+
+			signed := req.Clone(context.Background())
+			signed.Header.Del("Authorization")
+			auth.SignV4(signed, body, creds, "us-east-1", "execute-api", now)
+
+			if signed.Header.Get("Authorization") != req.Header.Get("Authorization") {
+				t.Errorf("expected the signature to be of the gzipped body")
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`[]`)),
+				Request:    req,
+			}, nil
+		}), false)
+
+		client, err := cfg.newClient(context.Background(), base)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		rsp, err := client.Client.Post(rurl.String()+"/prod/candles", "application/json",
+			strings.NewReader(`{"symbol":"BTC"}`))
+		if err != nil {
+			t.Fatalf("failed to post: %v", err)
+		}
+
+		rsp.Body.Close()
+
+		if _, ok := client.Client.Transport.(auth.Refresher); !ok {
+			t.Fatalf("expected the credentials of the compressed sigV4 transport to be refreshable")
+		}
+	})
+}
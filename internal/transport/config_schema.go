@@ -0,0 +1,323 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// configSchemaDialect is the dialect of the JSON schema of the configuration.
+	configSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+	// modulePath is the path of the module, whose types are the only types of the configuration that are decoded.
+	modulePath = "github.com/alpine-hodler/gidari"
+
+	// maxKeySuggestionDistance is the maximum edit distance of a key from an unknown key for it to be suggested.
+	maxKeySuggestionDistance = 2
+)
+
+// ErrUnknownConfigKey is returned by NewStrictConfig when the configuration has a key that is not a setting, e.g. a
+// misspelled "ratelimit" instead of "rateLimit".
+var ErrUnknownConfigKey = fmt.Errorf("unknown config key")
+
+// UnknownConfigKeyError wraps an error with ErrUnknownConfigKey.
+func UnknownConfigKeyError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrUnknownConfigKey, msg)
+}
+
+// unknownFieldPattern matches the errors of yaml.UnmarshalStrict for the keys that are not fields of their type.
+var unknownFieldPattern = regexp.MustCompile(`^line (\d+): field (.+) not found in type (\S+)$`)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// configField is a field of a type of the configuration that is decoded from a key of the YAML.
+type configField struct {
+	key   string
+	field reflect.StructField
+}
+
+// configFields will return the fields of the struct that are decoded from the YAML, with the fields of the inlined
+// structs. Fields of types that are not of this module, e.g. the logger, and functions are set by programs using the
+// library.
+func configFields(typ reflect.Type) []configField {
+	var fields []configField
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+
+		key, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(opts, "inline") {
+			fields = append(fields, configFields(field.Type)...)
+
+			continue
+		}
+
+		if !decodable(field.Type) {
+			continue
+		}
+
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+
+		fields = append(fields, configField{key: key, field: field})
+	}
+
+	return fields
+}
+
+// decodable will return true if the type can be decoded from the YAML of the configuration.
+func decodable(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return false
+	case reflect.Interface:
+		return typ.NumMethod() == 0
+	case reflect.Struct:
+		return typ == timeType || strings.HasPrefix(typ.PkgPath(), modulePath)
+	default:
+		return true
+	}
+}
+
+// configSchema generates the JSON schema of the configuration, with a definition for every struct.
+type configSchema struct {
+	defs  map[string]interface{}
+	names map[reflect.Type]string
+
+	// types are the structs by the name that yaml.v2 reports them with, e.g. "transport.Config".
+	types map[string]reflect.Type
+}
+
+func newConfigSchema() *configSchema {
+	schema := &configSchema{
+		defs:  make(map[string]interface{}),
+		names: make(map[reflect.Type]string),
+		types: make(map[string]reflect.Type),
+	}
+
+	schema.schema(reflect.TypeOf(Config{}))
+
+	return schema
+}
+
+// name will return the name of the definition of the struct, qualified by its package if another struct has its name.
+func (schema *configSchema) name(typ reflect.Type) string {
+	if name, ok := schema.names[typ]; ok {
+		return name
+	}
+
+	name := typ.Name()
+	for other, otherName := range schema.names {
+		if otherName == name && other != typ {
+			name = strings.ReplaceAll(typ.String(), ".", "_")
+
+			break
+		}
+	}
+
+	schema.names[typ] = name
+
+	return name
+}
+
+// schema will return the schema of the type, adding the definitions of its structs.
+func (schema *configSchema) schema(typ reflect.Type) map[string]interface{} {
+	switch typ {
+	case durationType:
+		return map[string]interface{}{"type": []string{"string", "integer"}, "description": `a duration, e.g. "1m30s"`}
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return schema.schema(typ.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schema.schema(typ.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schema.schema(typ.Elem())}
+	case reflect.Struct:
+		return schema.object(typ)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object will return a reference to the definition of the struct, which does not allow keys that are not its fields.
+func (schema *configSchema) object(typ reflect.Type) map[string]interface{} {
+	name := schema.name(typ)
+	ref := map[string]interface{}{"$ref": "#/$defs/" + name}
+
+	if _, ok := schema.defs[name]; ok {
+		return ref
+	}
+
+	properties := make(map[string]interface{})
+	def := map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+
+	// The definition is added before the schemas of the fields, which can reference the struct.
+	schema.defs[name] = def
+	schema.types[typ.String()] = typ
+
+	for _, field := range configFields(typ) {
+		properties[field.key] = schema.schema(field.field.Type)
+	}
+
+	return ref
+}
+
+// ConfigSchema will return the JSON schema of the YAML configuration, e.g. for the completion and validation of
+// configurations in editors. The schema does not allow keys that are not settings, like NewStrictConfig.
+func ConfigSchema() ([]byte, error) {
+	schema := newConfigSchema()
+
+	bytes, err := json.MarshalIndent(map[string]interface{}{
+		"$schema": configSchemaDialect,
+		"$ref":    "#/$defs/" + schema.name(reflect.TypeOf(Config{})),
+		"$defs":   schema.defs,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode config schema: %w", err)
+	}
+
+	return bytes, nil
+}
+
+// unmarshalStrict will decode the YAML into the configuration, returning an error wrapping ErrUnknownConfigKey for the
+// keys that are not settings, with the settings they are most likely a misspelling of.
+func unmarshalStrict(yamlBytes []byte, cfg *Config) error {
+	err := yaml.UnmarshalStrict(yamlBytes, cfg)
+
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+
+	var (
+		schema  = newConfigSchema()
+		unknown []string
+		other   []string
+	)
+
+	for _, msg := range typeErr.Errors {
+		match := unknownFieldPattern.FindStringSubmatch(msg)
+		if match == nil {
+			other = append(other, msg)
+
+			continue
+		}
+
+		line, key, typeName := match[1], match[2], match[3]
+		msg := fmt.Sprintf("%q on line %s", key, line)
+
+		if typ, ok := schema.types[typeName]; ok {
+			if suggestion := suggestKey(key, configFields(typ)); suggestion != "" {
+				msg += fmt.Sprintf(", did you mean %q?", suggestion)
+			}
+		}
+
+		unknown = append(unknown, msg)
+	}
+
+	if len(unknown) == 0 {
+		return err
+	}
+
+	if len(other) > 0 {
+		unknown = append(unknown, other...)
+	}
+
+	return UnknownConfigKeyError(strings.Join(unknown, "; "))
+}
+
+// suggestKey will return the key of the fields that is closest to the unknown key, or an empty string if none is
+// close.
+func suggestKey(key string, fields []configField) string {
+	var (
+		suggestion string
+		best       = maxKeySuggestionDistance + 1
+	)
+
+	for _, field := range fields {
+		distance := editDistance(strings.ToLower(key), strings.ToLower(field.key))
+		if distance < best {
+			suggestion, best = field.key, distance
+		}
+	}
+
+	return suggestion
+}
+
+// editDistance will return the Levenshtein distance between the strings.
+func editDistance(src, dst string) int {
+	prev := make([]int, len(dst)+1)
+	curr := make([]int, len(dst)+1)
+
+	for idx := range prev {
+		prev[idx] = idx
+	}
+
+	for i := 1; i <= len(src); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(dst); j++ {
+			cost := 1
+			if src[i-1] == dst[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(dst)]
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewStrictConfig(t *testing.T) {
+	t.Parallel()
+
+	const base = "url: https://api.pro.coinbase.com\nrateLimit:\n  burst: 1\n  period: 1\n"
+
+	for _, tcase := range []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "valid",
+			yaml: base + "truncate: true\n",
+		},
+		{
+			name: "misspelled",
+			yaml: base + "ratelimitGroups:\n  slow:\n    burst: 1\n    period: 1\n",
+			err:  `"ratelimitGroups" on line 5, did you mean "rateLimitGroups"?`,
+		},
+		{
+			name: "nested",
+			yaml: base + "requests:\n  - endpoint: /products\n    tabel: products\n",
+			err:  `"tabel" on line 7, did you mean "table"?`,
+		},
+		{
+			name: "inline",
+			yaml: base + "universes:\n  products:\n    endpoint: /products\n    pathh: id\n",
+			err:  `"pathh" on line 8, did you mean "path"?`,
+		},
+		{
+			name: "unknown",
+			yaml: base + "frobnicate: true\n",
+			err:  `"frobnicate" on line 5`,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := NewConfig([]byte(tcase.yaml)); err != nil {
+				t.Fatalf("expected NewConfig to ignore unknown keys, got %v", err)
+			}
+
+			_, err := NewStrictConfig([]byte(tcase.yaml))
+			if tcase.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrUnknownConfigKey) || !strings.Contains(err.Error(), tcase.err) {
+				t.Fatalf("expected an unknown config key error with %q, got %v", tcase.err, err)
+			}
+
+			if strings.HasSuffix(tcase.err, "line 5") && strings.Contains(err.Error(), "did you mean") {
+				t.Fatalf("expected no suggestion, got %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	t.Parallel()
+
+	bytes, err := ConfigSchema()
+	if err != nil {
+		t.Fatalf("error generating schema: %v", err)
+	}
+
+	var schema struct {
+		Ref  string `json:"$ref"`
+		Defs map[string]struct {
+			Properties           map[string]map[string]interface{} `json:"properties"`
+			AdditionalProperties bool                              `json:"additionalProperties"`
+		} `json:"$defs"`
+	}
+
+	if err := json.Unmarshal(bytes, &schema); err != nil {
+		t.Fatalf("error decoding schema: %v", err)
+	}
+
+	config, ok := schema.Defs["Config"]
+	if schema.Ref != "#/$defs/Config" || !ok || config.AdditionalProperties {
+		t.Fatalf("expected a strict Config definition, got %s", bytes)
+	}
+
+	for key, expected := range map[string]string{
+		"rateLimit":          "#/$defs/RateLimitConfig",
+		"truncate":           "",
+		"transactionTimeout": "",
+	} {
+		property, ok := config.Properties[key]
+		if !ok || (expected != "" && property["$ref"] != expected) {
+			t.Fatalf("expected property %q with ref %q, got %v", key, expected, property)
+		}
+	}
+
+	for _, key := range []string{"logger", "progress"} {
+		if _, ok := config.Properties[key]; ok {
+			t.Fatalf("expected no property %q", key)
+		}
+	}
+
+	if _, ok := schema.Defs["Universe"].Properties["endpoint"]; !ok {
+		t.Fatalf("expected the inlined request properties on Universe")
+	}
+
+	if _, ok := schema.Defs["Checkpoints"].Properties["store"]; ok {
+		t.Fatalf("expected the fields that are not decoded to be skipped")
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		src, dst string
+		expected int
+	}{
+		{src: "", dst: "abc", expected: 3},
+		{src: "ratelimit", dst: "ratelimit", expected: 0},
+		{src: "tabel", dst: "table", expected: 2},
+		{src: "endpont", dst: "endpoint", expected: 1},
+		{src: "kitten", dst: "sitting", expected: 3},
+	} {
+		if got := editDistance(tcase.src, tcase.dst); got != tcase.expected {
+			t.Fatalf("expected the distance of %q and %q to be %d, got %d", tcase.src, tcase.dst, tcase.expected, got)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidDaemonInterval is returned when the interval of a daemon is not positive.
+var ErrInvalidDaemonInterval = fmt.Errorf("invalid daemon interval")
+
+// Daemon runs the Upsert operation of a configuration every interval, until its context is canceled. The configuration
+// can be reloaded while the daemon runs, e.g. on SIGHUP: the runs that start after a reload use the new configuration,
+// while the run in flight finishes with the configuration it started with. The daemon can also be paused, e.g. on
+// SIGUSR1, to yield the quota of the web API to other systems: the run in flight stops making new requests and no run
+// starts until the daemon is resumed.
+type Daemon struct {
+	interval time.Duration
+	load     func() (*Config, error)
+	pause    *Pause
+
+	mutex sync.Mutex
+	cfg   *Config
+}
+
+// NewDaemon will return a daemon that runs every interval with the configuration returned by load. The configuration
+// is loaded once here, and again on every reload.
+func NewDaemon(interval time.Duration, load func() (*Config, error)) (*Daemon, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDaemonInterval, interval)
+	}
+
+	daemon := &Daemon{interval: interval, load: load, pause: NewPause()}
+	if err := daemon.Reload(); err != nil {
+		return nil, err
+	}
+
+	return daemon, nil
+}
+
+// Reload will load the configuration of the runs that start after it. If the configuration can not be loaded, the
+// daemon keeps its configuration and the error is returned.
+func (daemon *Daemon) Reload() error {
+	cfg, err := daemon.load()
+	if err != nil {
+		return fmt.Errorf("unable to reload configuration: %w", err)
+	}
+
+	daemon.mutex.Lock()
+	daemon.cfg = cfg
+	daemon.mutex.Unlock()
+
+	tools.LogEvent{Msg: "configuration loaded"}.Log(cfg.Logger, logrus.InfoLevel)
+
+	return nil
+}
+
+// Config will return the configuration of the next run.
+func (daemon *Daemon) Config() *Config {
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+
+	return daemon.cfg
+}
+
+// Pause will stop the run in flight from making new web requests, keeping its transactions open, and hold the runs
+// that start after it until Resume is called. It returns false if the daemon is already paused.
+func (daemon *Daemon) Pause() bool {
+	if !daemon.pause.Pause() {
+		return false
+	}
+
+	tools.LogEvent{Msg: "daemon paused"}.Log(daemon.Config().Logger, logrus.InfoLevel)
+
+	return true
+}
+
+// Resume will let the daemon make web requests again. It returns false if the daemon is not paused.
+func (daemon *Daemon) Resume() bool {
+	if !daemon.pause.Resume() {
+		return false
+	}
+
+	tools.LogEvent{Msg: "daemon resumed"}.Log(daemon.Config().Logger, logrus.InfoLevel)
+
+	return true
+}
+
+// Paused will return true and the time the daemon was paused at if it is paused.
+func (daemon *Daemon) Paused() (bool, time.Time) {
+	return daemon.pause.Paused()
+}
+
+// Run will run the Upsert operation now and then every interval, until the context is canceled. Runs do not overlap,
+// if a run takes longer than the interval then the next run starts once it is done. The result of every run is passed
+// to handle, which may be nil. Run returns once the context is canceled and the run in flight has stopped.
+func (daemon *Daemon) Run(ctx context.Context, handle func(*UpsertResult, error)) {
+	ticker := time.NewTicker(daemon.interval)
+	defer ticker.Stop()
+
+	for {
+		// A run does not start while the daemon is paused.
+		if err := daemon.pause.wait(ctx, daemon.Config().logger(logPlanner)); err != nil {
+			return
+		}
+
+		result, err := Upsert(ctx, daemon.Config(), WithPause(daemon.pause))
+		if handle != nil {
+			handle(result, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// The ticker may be ready at the same time as the context is canceled.
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDaemon(t *testing.T) {
+	t.Parallel()
+
+	errLoad := fmt.Errorf("load error")
+
+	newDaemonConfig := func(t *testing.T, url, endpoint string) *Config {
+		t.Helper()
+
+		cfg, err := NewConfig([]byte(fmt.Sprintf(`
+url: %s
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: %s
+`, url, endpoint)))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		return cfg
+	}
+
+	t.Run("invalid interval", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewDaemon(0, func() (*Config, error) { return &Config{}, nil })
+		if !errors.Is(err, ErrInvalidDaemonInterval) {
+			t.Fatalf("expected error %v, got %v", ErrInvalidDaemonInterval, err)
+		}
+	})
+
+	t.Run("reload error", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := newDaemonConfig(t, "http://api.test.invalid", "/old")
+		fail := false
+
+		daemon, err := NewDaemon(time.Hour, func() (*Config, error) {
+			if fail {
+				return nil, errLoad
+			}
+
+			return cfg, nil
+		})
+		if err != nil {
+			t.Fatalf("failed to create daemon: %v", err)
+		}
+
+		fail = true
+
+		if err := daemon.Reload(); !errors.Is(err, errLoad) {
+			t.Fatalf("expected error %v, got %v", errLoad, err)
+		}
+
+		if daemon.Config() != cfg {
+			t.Fatalf("expected the daemon to keep its configuration")
+		}
+	})
+
+	t.Run("reload in flight", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mutex     sync.Mutex
+			endpoints []string
+		)
+
+		started := make(chan struct{})
+		unblock := make(chan struct{})
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			endpoints = append(endpoints, r.URL.Path)
+			mutex.Unlock()
+
+			// Hold the first run in flight until the configuration is reloaded.
+			if r.URL.Path == "/old" {
+				close(started)
+				<-unblock
+			}
+
+			fmt.Fprint(w, `[]`)
+		}))
+		t.Cleanup(server.Close)
+
+		endpoint := "/old"
+
+		daemon, err := NewDaemon(time.Millisecond, func() (*Config, error) {
+			return newDaemonConfig(t, server.URL, endpoint), nil
+		})
+		if err != nil {
+			t.Fatalf("failed to create daemon: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var runs int
+
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+
+			daemon.Run(ctx, func(_ *UpsertResult, err error) {
+				if err != nil {
+					t.Errorf("failed to run: %v", err)
+				}
+
+				if runs++; runs == 2 {
+					cancel()
+				}
+			})
+		}()
+
+		<-started
+
+		endpoint = "/new"
+		if err := daemon.Reload(); err != nil {
+			t.Fatalf("failed to reload: %v", err)
+		}
+
+		close(unblock)
+		<-stopped
+
+		if fmt.Sprint(endpoints) != "[/old /new]" {
+			t.Fatalf("expected the runs to request [/old /new], got %v", endpoints)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+const deadLetterFileMode = 0o600
+
+// DeadLetter is the configuration for handling records that fail to upsert. If a dead letter file is not configured,
+// failed records are logged as warnings.
+type DeadLetter struct {
+	// File is the path to a file where the records that failed to upsert are appended as JSON lines.
+	File string `yaml:"file"`
+}
+
+// deadLetterRecord is a record that failed to upsert, as it is written to the dead letter file.
+type deadLetterRecord struct {
+	Time    time.Time              `json:"time"`
+	Storage string                 `json:"storage"`
+	Table   string                 `json:"table"`
+	Index   int64                  `json:"index"`
+	Error   string                 `json:"error"`
+	Record  map[string]interface{} `json:"record"`
+}
+
+// deadLetterWriter routes the records that failed to upsert to the dead letter file. It is safe for concurrent use.
+type deadLetterWriter struct {
+	path   string
+	logger *logrus.Logger
+
+	// cipher encrypts each line of the dead letter file, if the state is encrypted.
+	cipher *stateCipher
+
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func newDeadLetterWriter(cfg *DeadLetter, logger *logrus.Logger, sc *stateCipher) *deadLetterWriter {
+	dlw := &deadLetterWriter{logger: logger, cipher: sc}
+	if cfg != nil {
+		dlw.path = cfg.File
+	}
+
+	return dlw
+}
+
+// write will route the failed records for a table on a storage device to the dead letter file.
+func (dlw *deadLetterWriter) write(storage, table string, errs []*proto.RecordError) error {
+	if dlw.path == "" {
+		for _, recordErr := range errs {
+			index := recordErr.Index
+			logWarn := tools.LogEvent{
+				Msg:     "failed to upsert record",
+				Storage: storage,
+				Table:   table,
+				Record:  &index,
+				Err:     errors.New(recordErr.Message),
+			}
+			logWarn.Log(dlw.logger, logrus.WarnLevel)
+		}
+
+		return nil
+	}
+
+	dlw.mutex.Lock()
+	defer dlw.mutex.Unlock()
+
+	if dlw.file == nil {
+		file, err := os.OpenFile(dlw.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, deadLetterFileMode)
+		if err != nil {
+			return fmt.Errorf("unable to open dead letter file: %w", err)
+		}
+
+		dlw.file = file
+	}
+
+	for _, recordErr := range errs {
+		line, err := json.Marshal(&deadLetterRecord{
+			Time:    time.Now(),
+			Storage: storage,
+			Table:   table,
+			Index:   recordErr.Index,
+			Error:   recordErr.Message,
+			Record:  recordErr.GetRecord().AsMap(),
+		})
+		if err != nil {
+			return fmt.Errorf("unable to encode dead letter record: %w", err)
+		}
+
+		if line, err = dlw.cipher.seal(line); err != nil {
+			return fmt.Errorf("unable to encrypt dead letter record: %w", err)
+		}
+
+		if _, err := dlw.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("unable to write dead letter record: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// close will close the dead letter file if it has been opened.
+func (dlw *deadLetterWriter) close() error {
+	dlw.mutex.Lock()
+	defer dlw.mutex.Unlock()
+
+	if dlw.file == nil {
+		return nil
+	}
+
+	if err := dlw.file.Close(); err != nil {
+		return fmt.Errorf("unable to close dead letter file: %w", err)
+	}
+
+	dlw.file = nil
+
+	return nil
+}
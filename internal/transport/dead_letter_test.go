@@ -0,0 +1,80 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestDeadLetterWriter(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	dlw := newDeadLetterWriter(&DeadLetter{File: path}, logrus.New(), nil)
+
+	record, err := structpb.NewStruct(map[string]interface{}{"id": "abc"})
+	if err != nil {
+		t.Fatalf("failed to create struct: %v", err)
+	}
+
+	errs := []*proto.RecordError{
+		{Index: 3, Message: "duplicate key", Record: record},
+		{Index: 7, Message: "value too long"},
+	}
+
+	if err := dlw.write("postgresql", "trades", errs[:1]); err != nil {
+		t.Fatalf("failed to write dead letter records: %v", err)
+	}
+
+	if err := dlw.write("mongodb", "trades", errs[1:]); err != nil {
+		t.Fatalf("failed to write dead letter records: %v", err)
+	}
+
+	if err := dlw.close(); err != nil {
+		t.Fatalf("failed to close dead letter writer: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open dead letter file: %v", err)
+	}
+	defer file.Close()
+
+	var records []deadLetterRecord
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("failed to decode dead letter record: %v", err)
+		}
+
+		records = append(records, rec)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 dead letter records, got %d", len(records))
+	}
+
+	if records[0].Storage != "postgresql" || records[0].Index != 3 || records[0].Error != "duplicate key" ||
+		records[0].Record["id"] != "abc" {
+		t.Fatalf("unexpected dead letter record: %+v", records[0])
+	}
+
+	if records[1].Storage != "mongodb" || records[1].Index != 7 || records[1].Table != "trades" {
+		t.Fatalf("unexpected dead letter record: %+v", records[1])
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+// decodeJob is the response of a web job, which is decoded and prepared for the repositories by a decode worker. The
+// decode workers are a stage of their own between the web and repository workers, so that decoding large bodies holds
+// neither the network requests nor the storage operations, and the CPU it uses is sized independently of both.
+type decodeJob struct {
+	*webJob
+
+	rsp *web.FetchResponse
+
+	// body is the response body if it is undecoded, otherwise the records of the response.
+	body      []byte
+	page      *Page
+	undecoded bool
+
+	// workerID, start, and webQueue are the web worker that made the request, the time it started the request, and
+	// the number of web jobs waiting for a worker at the time, for the logs and progress of the request.
+	workerID int
+	start    time.Time
+	webQueue int
+}
+
+// deferrable will return true if the response body of the job can be decoded by the decode workers. The responses of
+// paginated requests, of requests with a staleness guard, and of bisected chunks are decoded by the web worker, since
+// they are needed to make the next request; the decode workers then only prepare their records.
+func (job *webJob) deferrable() bool {
+	return job.pagination == nil && job.staleness == nil && job.bisect == nil
+}
+
+// fetchUndecoded will make the web request of a deferrable job and return the undecoded response body, with the last
+// value set to true. If the response links to a next page, the body is decoded to follow the link like fetchPages, and
+// its records are returned with the last value set to false.
+func fetchUndecoded(ctx context.Context, job *webJob) (*web.FetchResponse, []byte, *Page, bool, error) {
+	if job.cache.fresh(job.flattenedRequest) {
+		return nil, nil, nil, false, errNotModified
+	}
+
+	current := job.cache.conditional(job)
+
+	rsp, body, err := fetchBody(ctx, current)
+	if err != nil {
+		return rsp, nil, nil, false, err
+	}
+
+	link := nextLink(rsp.Header, rsp.Request.URL)
+	if link == nil {
+		job.store(rsp)
+
+		return rsp, body, nil, true, nil
+	}
+
+	records, page, err := current.decode(rsp, body)
+	if err != nil {
+		return nil, nil, nil, false, err
+	}
+
+	if err := job.follow(current, link, records); err != nil {
+		return nil, nil, nil, false, err
+	}
+
+	return rsp, records, page, false, nil
+}
+
+// decode will decode the records and pagination metadata of the response body of the job, and archive the body.
+func (job *webJob) decode(rsp *web.FetchResponse, body []byte) ([]byte, *Page, error) {
+	records, page, err := newDecoder(job.envelope).decode(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Only the responses that are upserted are archived, so that they can be replayed.
+	if err := job.archive.write(job.table, rsp, body); err != nil {
+		return nil, nil, err
+	}
+
+	return records, page, nil
+}
+
+// records will decode the response of the job if it is undecoded, and return its records within the limits of the
+// request.
+func (job *decodeJob) records() ([]byte, *Page, error) {
+	records, page := job.body, job.page
+
+	if job.undecoded {
+		var err error
+		if records, page, err = job.decode(job.rsp, job.body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	records, err := job.limits.check(job.webJob, records, job.webQueue)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return records, page, nil
+}
+
+// decodeWorker will decode the responses of the jobs and send their upserts to the repository workers, until the jobs
+// channel is closed. Once the context is canceled, the responses are not decoded and are done as canceled.
+func decodeWorker(ctx context.Context, cfg *repoConfig) {
+	for job := range cfg.decodeJobs {
+		if ctx.Err() != nil {
+			cfg.done <- &jobDone{req: job.flattenedRequest, canceled: true}
+
+			continue
+		}
+
+		records, page, err := job.records()
+		if err != nil {
+			job.progress.send(&ProgressEvent{Type: ProgressRequestFailed, Table: job.table, Err: err})
+			cfg.done <- &jobDone{req: job.flattenedRequest, err: err}
+
+			continue
+		}
+
+		// The progress is sent before the repository job, so that it is sent before the operation completes.
+		job.progress.send(&ProgressEvent{
+			Type:            ProgressRequestCompleted,
+			Table:           job.table,
+			WebQueue:        job.webQueue,
+			RepositoryQueue: len(cfg.jobs),
+		})
+
+		repoJob := newRepoJob(job.flattenedRequest, job.rsp.Header, records, page, job.lineage)
+		repoJob.req = *job.rsp.Request
+		repoJob.next = job.next
+
+		// The upserts are built from the records here, so that the repository workers only execute them.
+		if repoJob.upserts, err = prepareUpserts(ctx, cfg, repoJob); err != nil {
+			cfg.done <- &jobDone{req: job.flattenedRequest, err: err}
+
+			continue
+		}
+
+		cfg.jobs <- repoJob
+
+		logWebRequest(job.logger, job.workerID, job.start, job.rsp.Request.URL, tools.LogEvent{Msg: "web request completed"})
+	}
+}
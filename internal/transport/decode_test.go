@@ -0,0 +1,165 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func TestFetchUndecoded(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			if r.URL.Path == "/linked" {
+				w.Header().Set("Link", fmt.Sprintf(`<%s?page=2>; rel="next"`, r.URL.Path))
+			}
+
+			fmt.Fprint(w, `{"data":[{"page":1}]}`)
+		case "2":
+			fmt.Fprint(w, `{"data":[{"page":2}]}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := web.NewClient(context.Background(), http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		path      string
+		undecoded bool
+		expected  string
+		next      string
+	}{
+		{path: "/single", undecoded: true, expected: `{"data":[{"page":1}]}`},
+		{path: "/linked", expected: `[{"page":1}]`, next: "/linked?page=2"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.path, func(t *testing.T) {
+			t.Parallel()
+
+			rurl, _ := url.Parse(server.URL + tcase.path)
+			job := &webJob{
+				flattenedRequest: &flattenedRequest{
+					fetchConfig: &web.FetchConfig{
+						C:           client,
+						Method:      http.MethodGet,
+						URL:         rurl,
+						RateLimiter: rate.NewLimiter(rate.Inf, 1),
+					},
+					envelope: &Envelope{Records: "data"},
+				},
+				logger: logrus.New(),
+			}
+
+			if !job.deferrable() {
+				t.Fatalf("expected the job to be deferrable")
+			}
+
+			_, data, _, undecoded, err := fetchUndecoded(context.Background(), job)
+			if err != nil {
+				t.Fatalf("failed to fetch: %v", err)
+			}
+
+			if undecoded != tcase.undecoded || string(data) != tcase.expected {
+				t.Fatalf("expected %s undecoded %v, got %s undecoded %v", tcase.expected, tcase.undecoded, data,
+					undecoded)
+			}
+
+			var next string
+			for _, req := range job.next {
+				next += req.fetchConfig.URL.RequestURI()
+			}
+
+			if next != tcase.next {
+				t.Fatalf("expected the next page %q, got %q", tcase.next, next)
+			}
+		})
+	}
+}
+
+func TestUpsertDecodeWorkers(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/products":
+			fmt.Fprint(w, `{"data":[{"id":"BTC-USD"},{"id":"ETH-USD"}]}`)
+		case "/trades":
+			fmt.Fprint(w, `[{"id":1}]`)
+		case "/invalid":
+			fmt.Fprint(w, `{"data":`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+errorMode: collect
+decodeWorkers: 1
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /products
+    envelope:
+      records: data
+  - endpoint: /trades
+    pagination:
+      offsetName: offset
+      pageSize: 10
+      maxPages: 1
+  - endpoint: /invalid
+    envelope:
+      records: data
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	var (
+		mutex     sync.Mutex
+		completed = make(map[string]bool)
+	)
+
+	cfg.Progress = func(event *ProgressEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if event.Type == ProgressRequestCompleted {
+			completed[event.Table] = true
+		}
+	}
+
+	_, err = Upsert(context.Background(), cfg)
+
+	var reqErrs RequestErrors
+	if !errors.As(err, &reqErrs) || len(reqErrs) != 1 || !strings.Contains(reqErrs[0].Error(), "envelope") {
+		t.Fatalf("expected the envelope error of the invalid response, got %v", err)
+	}
+
+	if len(completed) != 2 || !completed["products"] || !completed["trades"] {
+		t.Fatalf("expected the products and trades requests to complete, got %v", completed)
+	}
+}
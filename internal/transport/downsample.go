@@ -0,0 +1,421 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// unixMillisThreshold is the smallest numeric time that is read as milliseconds rather than seconds since the epoch.
+const unixMillisThreshold = 1e12
+
+// ErrInvalidDownsample is returned when the downsampling of a timeseries is invalid.
+var ErrInvalidDownsample = fmt.Errorf("invalid downsample")
+
+// InvalidDownsampleError wraps an error with ErrInvalidDownsample.
+func InvalidDownsampleError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidDownsample, msg)
+}
+
+// Downsample computes the aggregates of the candles of a timeseries at coarser granularities, e.g. 5m candles into 1h
+// and 1d candles, and upserts them into companion tables on the same transactions as the candles. The aggregates are
+// computed from the candles of the run once every request is done, so the range of the timeseries should be aligned
+// to the coarsest granularity to avoid partial aggregates at its ends.
+type Downsample struct {
+	// Granularities are the granularities of the aggregates, e.g. ["1h", "1d"]. A granularity is an integer number
+	// of seconds, a duration string, or a number of days like "1d".
+	Granularities []string `yaml:"granularities"`
+
+	// Table is the table of the aggregates of each granularity, which can reference the granularity with the
+	// "{{ .Granularity }}" template. The default is the table of the request suffixed with the granularity.
+	Table string `yaml:"table"`
+
+	// TimeField is the field of the start time of a candle, the default is "time". The time is either a number of
+	// seconds or milliseconds since the epoch, or a string in the time layout.
+	TimeField string `yaml:"timeField"`
+
+	// TimeLayout is the layout of the string times, the default is RFC3339.
+	TimeLayout string `yaml:"timeLayout"`
+
+	// Open, High, Low, Close, and Volume are the fields of the prices and volume of a candle, the defaults are
+	// "open", "high", "low", "close", and "volume". Candles without a volume are aggregated without one.
+	Open   string `yaml:"open"`
+	High   string `yaml:"high"`
+	Low    string `yaml:"low"`
+	Close  string `yaml:"close"`
+	Volume string `yaml:"volume"`
+}
+
+// parseDownsampleGranularity will parse a granularity, which may be a number of days.
+func parseDownsampleGranularity(val string) (time.Duration, error) {
+	if days := strings.TrimSuffix(val, "d"); days != val {
+		count, err := strconv.Atoi(days)
+		if err != nil || count <= 0 {
+			return 0, InvalidDownsampleError(fmt.Sprintf("unable to parse granularity %q", val))
+		}
+
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+
+	granularity, err := parseGranularity(val)
+	if err != nil {
+		return 0, InvalidDownsampleError(fmt.Sprintf("unable to parse granularity %q", val))
+	}
+
+	return granularity, nil
+}
+
+func (ds *Downsample) validate() error {
+	if ds == nil {
+		return nil
+	}
+
+	if len(ds.Granularities) == 0 {
+		return InvalidDownsampleError("no granularities")
+	}
+
+	for _, granularity := range ds.Granularities {
+		if _, err := parseDownsampleGranularity(granularity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// downsampleField will return the field of the candle, or the default if it is not set.
+func downsampleField(name, def string) string {
+	if name == "" {
+		return def
+	}
+
+	return name
+}
+
+// candle is a single candle of a timeseries, or the aggregate of the candles in a bucket.
+type candle struct {
+	start, end             time.Time
+	open, high, low, close float64
+	volume                 *float64
+}
+
+// merge will add the candle to the aggregate.
+func (agg *candle) merge(c *candle) {
+	if c.start.Before(agg.start) {
+		agg.start, agg.open = c.start, c.open
+	}
+
+	if !c.end.Before(agg.end) {
+		agg.end, agg.close = c.end, c.close
+	}
+
+	if c.high > agg.high {
+		agg.high = c.high
+	}
+
+	if c.low < agg.low {
+		agg.low = c.low
+	}
+
+	if c.volume != nil {
+		volume := *c.volume
+		if agg.volume != nil {
+			volume += *agg.volume
+		}
+
+		agg.volume = &volume
+	}
+}
+
+// downsampleTable is the aggregates of the candles of a table at a granularity.
+type downsampleTable struct {
+	ds *Downsample
+
+	// millis and numeric are the format of the times of the candles, which is used for the times of the aggregates.
+	millis, numeric bool
+
+	buckets map[time.Time]*candle
+
+	// seen are the start times of the candles in the buckets, since the chunks of a timeseries may overlap.
+	seen map[time.Time]bool
+}
+
+// downsampler aggregates the candles that are upserted during a run.
+type downsampler struct {
+	mu sync.Mutex
+
+	// tables maps the tables of the aggregates to their buckets.
+	tables map[string]*downsampleTable
+}
+
+func newDownsampler() *downsampler {
+	return &downsampler{tables: make(map[string]*downsampleTable)}
+}
+
+// parseTime will parse the time of a candle, returning whether it is numeric and in milliseconds.
+func (ds *Downsample) parseTime(value interface{}) (time.Time, bool, bool, error) {
+	switch value := value.(type) {
+	case float64:
+		if value >= unixMillisThreshold {
+			return time.UnixMilli(int64(value)).UTC(), true, true, nil
+		}
+
+		return time.Unix(int64(value), 0).UTC(), true, false, nil
+	case string:
+		parsed, err := time.Parse(downsampleField(ds.TimeLayout, time.RFC3339), value)
+		if err != nil {
+			return time.Time{}, false, false, fmt.Errorf("unable to parse candle time %q: %w", value, err)
+		}
+
+		return parsed.UTC(), false, false, nil
+	default:
+		return time.Time{}, false, false, fmt.Errorf("unexpected candle time %v", value)
+	}
+}
+
+// parsePrice will parse a number of a candle, which may be encoded as a string.
+func parsePrice(record map[string]interface{}, name string) (float64, bool, error) {
+	switch value := record[name].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return value, true, nil
+	case string:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("unable to parse candle field %q: %w", name, err)
+		}
+
+		return parsed, true, nil
+	default:
+		return 0, false, fmt.Errorf("unexpected candle field %q: %v", name, value)
+	}
+}
+
+// parseCandle will parse the candle of a record, returning the format of its time.
+func (ds *Downsample) parseCandle(record map[string]interface{}) (*candle, bool, bool, error) {
+	start, numeric, millis, err := ds.parseTime(record[downsampleField(ds.TimeField, "time")])
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	c := &candle{start: start, end: start}
+
+	for _, price := range []struct {
+		name string
+		dst  *float64
+	}{
+		{downsampleField(ds.Open, "open"), &c.open},
+		{downsampleField(ds.High, "high"), &c.high},
+		{downsampleField(ds.Low, "low"), &c.low},
+		{downsampleField(ds.Close, "close"), &c.close},
+	} {
+		value, ok, err := parsePrice(record, price.name)
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		if !ok {
+			return nil, false, false, fmt.Errorf("candle has no field %q", price.name)
+		}
+
+		*price.dst = value
+	}
+
+	volume, ok, err := parsePrice(record, downsampleField(ds.Volume, "volume"))
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	if ok {
+		c.volume = &volume
+	}
+
+	return c, numeric, millis, nil
+}
+
+// add will aggregate the JSON encoded candles of the table into the buckets of each granularity of the downsampling.
+func (sampler *downsampler) add(ds *Downsample, data []byte, table string) error {
+	if ds == nil {
+		return nil
+	}
+
+	var records []map[string]interface{}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("unable to downsample records of %q: %w", table, err)
+	}
+
+	sampler.mu.Lock()
+	defer sampler.mu.Unlock()
+
+	for _, granularity := range ds.Granularities {
+		duration, err := parseDownsampleGranularity(granularity)
+		if err != nil {
+			return err
+		}
+
+		name := ds.Table
+		if name == "" {
+			name = table
+		}
+
+		name, err = granularityTable(name, granularity)
+		if err != nil {
+			return err
+		}
+
+		dst, ok := sampler.tables[name]
+		if !ok {
+			dst = &downsampleTable{ds: ds, buckets: make(map[time.Time]*candle), seen: make(map[time.Time]bool)}
+			sampler.tables[name] = dst
+		}
+
+		for _, record := range records {
+			c, numeric, millis, err := ds.parseCandle(record)
+			if err != nil {
+				return fmt.Errorf("unable to downsample records of %q: %w", table, err)
+			}
+
+			if dst.seen[c.start] {
+				continue
+			}
+
+			dst.seen[c.start] = true
+			dst.numeric, dst.millis = numeric, millis
+
+			bucket := c.start.Truncate(duration)
+			if agg, ok := dst.buckets[bucket]; ok {
+				agg.merge(c)
+
+				continue
+			}
+
+			agg := *c
+			dst.buckets[bucket] = &agg
+		}
+	}
+
+	return nil
+}
+
+// records will return the JSON encoded aggregates of the table, ordered by time.
+func (dst *downsampleTable) records() ([]byte, error) {
+	buckets := make([]time.Time, 0, len(dst.buckets))
+	for bucket := range dst.buckets {
+		buckets = append(buckets, bucket)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Before(buckets[j]) })
+
+	records := make([]map[string]interface{}, 0, len(buckets))
+
+	for _, bucket := range buckets {
+		agg := dst.buckets[bucket]
+
+		var start interface{}
+
+		switch {
+		case dst.millis:
+			start = bucket.UnixMilli()
+		case dst.numeric:
+			start = bucket.Unix()
+		default:
+			start = bucket.Format(downsampleField(dst.ds.TimeLayout, time.RFC3339))
+		}
+
+		record := map[string]interface{}{
+			downsampleField(dst.ds.TimeField, "time"): start,
+			downsampleField(dst.ds.Open, "open"):      agg.open,
+			downsampleField(dst.ds.High, "high"):      agg.high,
+			downsampleField(dst.ds.Low, "low"):        agg.low,
+			downsampleField(dst.ds.Close, "close"):    agg.close,
+		}
+
+		if agg.volume != nil {
+			record[downsampleField(dst.ds.Volume, "volume")] = *agg.volume
+		}
+
+		records = append(records, record)
+	}
+
+	bytes, err := json.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal downsampled records: %w", err)
+	}
+
+	return bytes, nil
+}
+
+// upsertRequests will return the upsert requests of the aggregates of every table, ordered by table.
+func (sampler *downsampler) upsertRequests() ([]*proto.UpsertRequest, error) {
+	sampler.mu.Lock()
+	defer sampler.mu.Unlock()
+
+	tables := make([]string, 0, len(sampler.tables))
+	for table := range sampler.tables {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	reqs := make([]*proto.UpsertRequest, 0, len(tables))
+
+	for _, table := range tables {
+		data, err := sampler.tables[table].records()
+		if err != nil {
+			return nil, err
+		}
+
+		reqs = append(reqs, &proto.UpsertRequest{
+			Table:    table,
+			Data:     data,
+			DataType: int32(tools.UpsertDataJSON),
+		})
+	}
+
+	return reqs, nil
+}
+
+// transactDownsamples will send the upserts of the aggregates of the run to the transactions of the repositories, so
+// that they are committed with the candles they are computed from.
+func transactDownsamples(ctx context.Context, cfg *repoConfig) error {
+	reqs, err := cfg.downsamples.upsertRequests()
+	if err != nil {
+		return err
+	}
+
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	for _, req := range reqs {
+		if err := cfg.schemas[req.Table].check(req.Data, req.Table); err != nil {
+			return fmt.Errorf("error validating downsampled records: %w", err)
+		}
+	}
+
+	upserts, err := partitionUpserts(reqs, cfg.schemas)
+	if err != nil {
+		return fmt.Errorf("error partitioning downsampled records: %w", err)
+	}
+
+	tools.LogEvent{Msg: "upserting the downsampled records of tables", Count: len(reqs)}.Log(cfg.logger, logrus.InfoLevel)
+
+	return transactUpserts(ctx, 0, cfg, &repoJob{}, upserts)
+}
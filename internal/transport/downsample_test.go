@@ -0,0 +1,152 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownsample(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name string
+			ds   *Downsample
+			err  error
+		}{
+			{"nil", nil, nil},
+			{"valid", &Downsample{Granularities: []string{"3600", "4h", "1d"}}, nil},
+			{"no granularities", &Downsample{}, ErrInvalidDownsample},
+			{"invalid granularity", &Downsample{Granularities: []string{"hourly"}}, ErrInvalidDownsample},
+			{"invalid days", &Downsample{Granularities: []string{"0d"}}, ErrInvalidDownsample},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.ds.validate(); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("aggregates", func(t *testing.T) {
+		t.Parallel()
+
+		ds := &Downsample{Granularities: []string{"1h", "1d"}}
+		sampler := newDownsampler()
+
+		// The chunks overlap on the candle at 01:00, which is aggregated once.
+		for _, data := range []string{
+			`[{"time":"2022-06-01T00:00:00Z","open":1,"high":4,"low":1,"close":3,"volume":10},
+			  {"time":"2022-06-01T00:30:00Z","open":3,"high":5,"low":2,"close":4,"volume":5},
+			  {"time":"2022-06-01T01:00:00Z","open":"4","high":"6","low":"3","close":"5","volume":"1"}]`,
+			`[{"time":"2022-06-01T01:00:00Z","open":4,"high":6,"low":3,"close":5,"volume":1},
+			  {"time":"2022-06-01T01:30:00Z","open":5,"high":5,"low":0.5,"close":2,"volume":2}]`,
+		} {
+			if err := sampler.add(ds, []byte(data), "candles_30m"); err != nil {
+				t.Fatalf("error adding candles: %v", err)
+			}
+		}
+
+		reqs, err := sampler.upsertRequests()
+		if err != nil {
+			t.Fatalf("error building upsert requests: %v", err)
+		}
+
+		expected := map[string][]map[string]interface{}{
+			"candles_30m_1d": {
+				{"time": "2022-06-01T00:00:00Z", "open": 1.0, "high": 6.0, "low": 0.5, "close": 2.0, "volume": 18.0},
+			},
+			"candles_30m_1h": {
+				{"time": "2022-06-01T00:00:00Z", "open": 1.0, "high": 5.0, "low": 1.0, "close": 4.0, "volume": 15.0},
+				{"time": "2022-06-01T01:00:00Z", "open": 4.0, "high": 6.0, "low": 0.5, "close": 2.0, "volume": 3.0},
+			},
+		}
+
+		if len(reqs) != len(expected) {
+			t.Fatalf("expected %d upsert requests, got %d", len(expected), len(reqs))
+		}
+
+		for _, req := range reqs {
+			var records []map[string]interface{}
+			if err := json.Unmarshal(req.Data, &records); err != nil {
+				t.Fatalf("error decoding records: %v", err)
+			}
+
+			if !reflect.DeepEqual(records, expected[req.Table]) {
+				t.Fatalf("expected %s records %v, got %v", req.Table, expected[req.Table], records)
+			}
+		}
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		t.Parallel()
+
+		ds := &Downsample{
+			Granularities: []string{"3600"},
+			Table:         "rollup_{{ .Granularity }}",
+			TimeField:     "t",
+			Open:          "o",
+			High:          "h",
+			Low:           "l",
+			Close:         "c",
+		}
+		sampler := newDownsampler()
+
+		start := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+		data := []byte(`[{"t":1654041600000,"o":1,"h":2,"l":1,"c":2},{"t":1654043400000,"o":2,"h":3,"l":2,"c":3}]`)
+
+		if err := sampler.add(ds, data, "candles"); err != nil {
+			t.Fatalf("error adding candles: %v", err)
+		}
+
+		reqs, err := sampler.upsertRequests()
+		if err != nil {
+			t.Fatalf("error building upsert requests: %v", err)
+		}
+
+		var records []map[string]interface{}
+		if err := json.Unmarshal(reqs[0].Data, &records); err != nil {
+			t.Fatalf("error decoding records: %v", err)
+		}
+
+		expected := []map[string]interface{}{
+			{"t": float64(start.UnixMilli()), "o": 1.0, "h": 3.0, "l": 1.0, "c": 3.0},
+		}
+		if reqs[0].Table != "rollup_3600" || !reflect.DeepEqual(records, expected) {
+			t.Fatalf("expected rollup_3600 records %v, got %s records %v", expected, reqs[0].Table, records)
+		}
+
+		if err := sampler.add(ds, []byte(`[{"t":1654041600}]`), "candles"); err == nil {
+			t.Fatal("expected an error for candles without prices")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		sampler := newDownsampler()
+		if err := sampler.add(nil, []byte(`not json`), "candles"); err != nil {
+			t.Fatalf("expected no error without downsampling, got %v", err)
+		}
+
+		if reqs, err := sampler.upsertRequests(); err != nil || len(reqs) != 0 {
+			t.Fatalf("expected no upsert requests, got %v (%v)", reqs, err)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEgress(t *testing.T) {
+	t.Parallel()
+
+	t.Run("proxy", func(t *testing.T) {
+		t.Parallel()
+
+		var proxied int32
+
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Host == "api.test.invalid" {
+				atomic.AddInt32(&proxied, 1)
+			}
+
+			fmt.Fprint(w, `[]`)
+		}))
+		t.Cleanup(proxy.Close)
+
+		cfg, err := NewConfig([]byte(fmt.Sprintf(`
+url: http://api.test.invalid
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /proxied
+    egress:
+      proxy: %s
+  - endpoint: /also-proxied
+    egress:
+      proxy: %s
+  - endpoint: /direct
+`, proxy.URL, proxy.URL)))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		requests, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error flattening requests: %v", err)
+		}
+
+		if requests[0].fetchConfig.C != requests[1].fetchConfig.C {
+			t.Fatalf("expected requests with the same egress to share a client")
+		}
+
+		if requests[0].fetchConfig.C == requests[2].fetchConfig.C {
+			t.Fatalf("expected the direct request to use the default client")
+		}
+
+		for _, req := range requests[:2] {
+			if _, _, _, err := fetch(context.Background(), &webJob{flattenedRequest: req, logger: cfg.Logger}); err != nil {
+				t.Fatalf("error fetching through proxy: %v", err)
+			}
+		}
+
+		if atomic.LoadInt32(&proxied) != 2 {
+			t.Fatalf("expected 2 proxied requests, got %d", proxied)
+		}
+	})
+
+	t.Run("invalid source IP", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := (&Egress{SourceIP: "not-an-ip"}).newRoundTripper()
+		if !errors.Is(err, ErrInvalidEgress) {
+			t.Fatalf("expected invalid egress error, got %v", err)
+		}
+	})
+}
+
+func TestRunClients(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /candles
+  - endpoint: /trades
+    egress:
+      proxy: http://proxy.test.com:3128
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	const runs = 4
+
+	var wg sync.WaitGroup
+
+	results := make([][]*flattenedRequest, runs)
+	errs := make([]error, runs)
+
+	for run := 0; run < runs; run++ {
+		wg.Add(1)
+
+		go func(run int) {
+			defer wg.Done()
+
+			results[run], errs[run] = cfg.flattenRequests(context.Background())
+		}(run)
+	}
+
+	wg.Wait()
+
+	for run := 0; run < runs; run++ {
+		if errs[run] != nil {
+			t.Fatalf("error flattening requests: %v", errs[run])
+		}
+
+		for idx, req := range results[run] {
+			first := results[0][idx].fetchConfig.C
+
+			if run > 0 && req.fetchConfig.C == first {
+				t.Fatalf("expected every run to have its own client for request %d", idx)
+			}
+
+			if req.fetchConfig.C.Transport != first.Transport {
+				t.Fatalf("expected every run to share the round tripper of request %d", idx)
+			}
+		}
+	}
+
+	if results[0][0].fetchConfig.C.Transport == results[0][1].fetchConfig.C.Transport {
+		t.Fatalf("expected requests with an egress to use their own round tripper")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stateKeySize is the size of the AES-256 key that encrypts the local state files.
+const stateKeySize = 32
+
+// encryptedStatePrefix is the prefix of encrypted state files and of the encrypted lines of the dead letter file. The
+// prefix is followed by the base64 encoded nonce and ciphertext.
+const encryptedStatePrefix = "gidari:aes-gcm:"
+
+var (
+	// ErrInvalidStateKey is returned when the state encryption key is not a base64 encoded 32 byte key.
+	ErrInvalidStateKey = fmt.Errorf("invalid state encryption key")
+
+	// ErrDecryptState is returned when an encrypted state file can not be decrypted, e.g. because it was encrypted
+	// with a different key.
+	ErrDecryptState = fmt.Errorf("unable to decrypt state")
+
+	// ErrPlaintextState is returned when a state file is not encrypted although a key is configured, e.g. because it
+	// was replaced with a forged file, unless plain text is allowed to migrate the state files.
+	ErrPlaintextState = fmt.Errorf("state is not encrypted")
+)
+
+// InvalidStateKeyError wraps an error with ErrInvalidStateKey.
+func InvalidStateKeyError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidStateKey, msg)
+}
+
+// StateEncryption encrypts the local state files at rest, i.e. the snapshot file with its watermarks, the dead letter
+// file, and the archived responses, since they can contain URLs with signed tokens and records of the responses. The
+// files are encrypted with AES-256-GCM. Plain text files, e.g. written before the encryption was configured, are
+// rejected unless AllowPlaintext is set, since anyone who can write the files could otherwise replace them with
+// unauthenticated state.
+type StateEncryption struct {
+	// Key is the base64 encoded 32 byte key, e.g. generated with "openssl rand -base64 32".
+	Key string `yaml:"key"`
+
+	// KeyFile is the path to a file with the base64 encoded key, which is used if the key is not set so that the key
+	// does not need to be in the configuration.
+	KeyFile string `yaml:"keyFile"`
+
+	// AllowPlaintext will read the plain text state files as they are, to migrate the files written before the
+	// encryption was configured. They are encrypted when they are written again.
+	AllowPlaintext bool `yaml:"allowPlaintext"`
+}
+
+// stateCipher encrypts and decrypts the local state files. A nil stateCipher leaves the state in plain text.
+type stateCipher struct {
+	aead cipher.AEAD
+
+	// allowPlaintext will open plain text state as it is.
+	allowPlaintext bool
+}
+
+// cipher will return the cipher of the key of the state encryption, or nil if the state is not encrypted.
+func (enc *StateEncryption) cipher() (*stateCipher, error) {
+	if enc == nil {
+		return nil, nil
+	}
+
+	encoded := enc.Key
+	if encoded == "" {
+		if enc.KeyFile == "" {
+			return nil, InvalidStateKeyError("no key or key file")
+		}
+
+		raw, err := os.ReadFile(enc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read state encryption key file: %w", err)
+		}
+
+		encoded = string(raw)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, InvalidStateKeyError("key is not base64 encoded")
+	}
+
+	if len(key) != stateKeySize {
+		return nil, InvalidStateKeyError(fmt.Sprintf("key is %d bytes, not %d", len(key), stateKeySize))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create state cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create state cipher: %w", err)
+	}
+
+	return &stateCipher{aead: aead, allowPlaintext: enc.AllowPlaintext}, nil
+}
+
+// seal will encrypt the plain text with a random nonce, returning the prefixed and base64 encoded ciphertext.
+func (sc *stateCipher) seal(plaintext []byte) ([]byte, error) {
+	if sc == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, sc.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("unable to generate nonce: %w", err)
+	}
+
+	sealed := sc.aead.Seal(nonce, nonce, plaintext, nil)
+
+	return []byte(encryptedStatePrefix + base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// open will decrypt data sealed by the cipher. Data without the prefix is plain text, which is returned as is if the
+// state is not encrypted or plain text is allowed. Empty data is returned as is.
+func (sc *stateCipher) open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedStatePrefix)) {
+		if sc != nil && !sc.allowPlaintext && len(bytes.TrimSpace(data)) > 0 {
+			return nil, fmt.Errorf("%w: set stateEncryption.allowPlaintext to migrate plain text state", ErrPlaintextState)
+		}
+
+		return data, nil
+	}
+
+	if sc == nil {
+		return nil, fmt.Errorf("%w: state is encrypted and no key is configured", ErrDecryptState)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data[len(encryptedStatePrefix):])))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptState, err)
+	}
+
+	if len(sealed) < sc.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext is too short", ErrDecryptState)
+	}
+
+	nonce, ciphertext := sealed[:sc.aead.NonceSize()], sealed[sc.aead.NonceSize():]
+
+	plaintext, err := sc.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptState, err)
+	}
+
+	return plaintext, nil
+}
+
+// Decrypt will return the plain text of a state file, i.e. a snapshot or dead letter file, that is encrypted with the
+// state encryption of the configuration. The lines of dead letter files are decrypted individually.
+func Decrypt(cfg *Config, path string) ([]byte, error) {
+	sc, err := cfg.StateEncryption.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state file: %w", err)
+	}
+
+	var out bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+
+	for scanner.Scan() {
+		line, err := sc.open(scanner.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read state file: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
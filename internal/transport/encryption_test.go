@@ -0,0 +1,211 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/sirupsen/logrus"
+)
+
+func TestStateEncryption(t *testing.T) {
+	t.Parallel()
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, stateKeySize))
+	otherKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, stateKeySize))
+
+	t.Run("cipher", func(t *testing.T) {
+		t.Parallel()
+
+		keyFile := filepath.Join(t.TempDir(), "state.key")
+		if err := os.WriteFile(keyFile, []byte(key+"\n"), 0o600); err != nil {
+			t.Fatalf("failed to write key file: %v", err)
+		}
+
+		for _, tcase := range []struct {
+			name string
+			enc  *StateEncryption
+			err  error
+		}{
+			{"nil", nil, nil},
+			{"key", &StateEncryption{Key: key}, nil},
+			{"key file", &StateEncryption{KeyFile: keyFile}, nil},
+			{"missing", &StateEncryption{}, ErrInvalidStateKey},
+			{"not base64", &StateEncryption{Key: "not a key!"}, ErrInvalidStateKey},
+			{"short", &StateEncryption{Key: base64.StdEncoding.EncodeToString([]byte("short"))}, ErrInvalidStateKey},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if _, err := tcase.enc.cipher(); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("seal and open", func(t *testing.T) {
+		t.Parallel()
+
+		sc, err := (&StateEncryption{Key: key}).cipher()
+		if err != nil {
+			t.Fatalf("failed to create cipher: %v", err)
+		}
+
+		plaintext := []byte(`{"url":"https://api.test.com/candles?signature=secret"}`)
+
+		sealed, err := sc.seal(plaintext)
+		if err != nil {
+			t.Fatalf("failed to seal: %v", err)
+		}
+
+		if bytes.Contains(sealed, []byte("secret")) {
+			t.Fatalf("expected the sealed state not to contain the plain text: %s", sealed)
+		}
+
+		opened, err := sc.open(sealed)
+		if err != nil {
+			t.Fatalf("failed to open: %v", err)
+		}
+
+		if !bytes.Equal(opened, plaintext) {
+			t.Fatalf("expected %s, got %s", plaintext, opened)
+		}
+
+		// Plain text is rejected once a key is configured, unless it is allowed to migrate the state.
+		if _, err = sc.open(plaintext); !errors.Is(err, ErrPlaintextState) {
+			t.Fatalf("expected ErrPlaintextState for plain text, got %v", err)
+		}
+
+		if opened, err = sc.open(nil); err != nil || len(opened) != 0 {
+			t.Fatalf("expected empty state to be read as is, got %s: %v", opened, err)
+		}
+
+		migrating, err := (&StateEncryption{Key: key, AllowPlaintext: true}).cipher()
+		if err != nil {
+			t.Fatalf("failed to create cipher: %v", err)
+		}
+
+		if opened, err = migrating.open(plaintext); err != nil || !bytes.Equal(opened, plaintext) {
+			t.Fatalf("expected plain text to be read as is while migrating, got %s: %v", opened, err)
+		}
+
+		other, err := (&StateEncryption{Key: otherKey}).cipher()
+		if err != nil {
+			t.Fatalf("failed to create cipher: %v", err)
+		}
+
+		if _, err := other.open(sealed); !errors.Is(err, ErrDecryptState) {
+			t.Fatalf("expected ErrDecryptState with the wrong key, got %v", err)
+		}
+
+		var none *stateCipher
+		if _, err := none.open(sealed); !errors.Is(err, ErrDecryptState) {
+			t.Fatalf("expected ErrDecryptState without a key, got %v", err)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /candles
+    query:
+      signature: secret
+`))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		cfg.StateEncryption = &StateEncryption{Key: key}
+		cfg.Snapshot = &Snapshot{File: filepath.Join(t.TempDir(), "snapshot.json"), Resume: true}
+
+		requests, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error flattening requests: %v", err)
+		}
+
+		cfg.writeSnapshot(context.Background(), fileCheckpoints{}, requests, nil)
+
+		raw, err := os.ReadFile(cfg.Snapshot.File)
+		if err != nil {
+			t.Fatalf("error reading snapshot: %v", err)
+		}
+
+		if bytes.Contains(raw, []byte("secret")) {
+			t.Fatalf("expected the snapshot to be encrypted: %s", raw)
+		}
+
+		resumed, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error resuming requests: %v", err)
+		}
+
+		if len(resumed) != 1 || resumed[0].fetchConfig.URL.String() != requests[0].fetchConfig.URL.String() {
+			t.Fatalf("expected the request to be resumed from the encrypted snapshot, got %v", resumed)
+		}
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := &Config{StateEncryption: &StateEncryption{Key: key}}
+
+		sc, err := cfg.StateEncryption.cipher()
+		if err != nil {
+			t.Fatalf("failed to create cipher: %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+		dlw := newDeadLetterWriter(&DeadLetter{File: path}, logrus.New(), sc)
+
+		errs := []*proto.RecordError{{Index: 1, Message: "duplicate key"}, {Index: 2, Message: "value too long"}}
+		if err := dlw.write("postgresql", "trades", errs); err != nil {
+			t.Fatalf("failed to write dead letter records: %v", err)
+		}
+
+		if err := dlw.close(); err != nil {
+			t.Fatalf("failed to close dead letter writer: %v", err)
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read dead letter file: %v", err)
+		}
+
+		if bytes.Contains(raw, []byte("duplicate key")) {
+			t.Fatalf("expected the dead letter file to be encrypted: %s", raw)
+		}
+
+		plaintext, err := Decrypt(cfg, path)
+		if err != nil {
+			t.Fatalf("failed to decrypt dead letter file: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(plaintext)), "\n")
+		if len(lines) != len(errs) || !strings.Contains(lines[0], "duplicate key") ||
+			!strings.Contains(lines[1], "value too long") {
+			t.Fatalf("unexpected decrypted dead letter file: %s", plaintext)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// ErrMissingEnvVar is returned when a configuration value references an environment variable that is not set.
+var ErrMissingEnvVar = fmt.Errorf("environment variable is not set")
+
+// MissingEnvVarError wraps an error with ErrMissingEnvVar.
+func MissingEnvVarError(name string) error {
+	return fmt.Errorf("%w: %s", ErrMissingEnvVar, name)
+}
+
+// envVarRegex matches the "${NAME}" references to environment variables. Only the braced form is matched, so that
+// secrets with a literal "$" are left as they are.
+var envVarRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv will replace the "${NAME}" references in the value with the values of the environment variables.
+// Referencing an unset variable is an error, so that a missing secret fails the configuration rather than the
+// requests that are signed with it.
+func expandEnv(value string) (string, error) {
+	var err error
+
+	expanded := envVarRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envVarRegex.FindStringSubmatch(ref)[1]
+
+		envValue, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = MissingEnvVarError(name)
+		}
+
+		return envValue
+	})
+
+	return expanded, err
+}
+
+// expandEnv will replace the references to environment variables in the credentials, e.g. `secret: ${API_SECRET}`,
+// so that configurations can be committed without their secrets.
+func (authentication *Authentication) expandEnv() error {
+	var fields []*string
+
+	if apiKey := authentication.APIKey; apiKey != nil {
+		fields = append(fields, &apiKey.Key, &apiKey.Secret, &apiKey.Passphrase)
+	}
+
+	if auth2 := authentication.Auth2; auth2 != nil {
+		fields = append(fields, &auth2.Bearer, &auth2.ClientID, &auth2.ClientSecret)
+	}
+
+	if oauth1 := authentication.OAuth1; oauth1 != nil {
+		fields = append(fields, &oauth1.ConsumerKey, &oauth1.ConsumerSecret, &oauth1.Token, &oauth1.TokenSecret)
+	}
+
+	if sigv4 := authentication.SigV4; sigv4 != nil {
+		fields = append(fields, &sigv4.AccessKeyID, &sigv4.SecretAccessKey, &sigv4.SessionToken)
+	}
+
+	if jwt := authentication.JWT; jwt != nil {
+		fields = append(fields, &jwt.PrivateKey, &jwt.KeyID)
+	}
+
+	if basic := authentication.Basic; basic != nil {
+		fields = append(fields, &basic.Username, &basic.Password)
+	}
+
+	if customKey := authentication.CustomKey; customKey != nil {
+		fields = append(fields, &customKey.Value)
+	}
+
+	for _, field := range fields {
+		expanded, err := expandEnv(*field)
+		if err != nil {
+			return fmt.Errorf("unable to expand authentication: %w", err)
+		}
+
+		*field = expanded
+	}
+
+	session, err := authentication.Session.withStrings(expandEnv)
+	if err != nil {
+		return fmt.Errorf("unable to expand authentication: %w", err)
+	}
+
+	registered, err := authentication.Registered.withStrings(expandEnv)
+	if err != nil {
+		return fmt.Errorf("unable to expand authentication: %w", err)
+	}
+
+	authentication.Session = session
+	authentication.Registered = registered
+
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GIDARI_TEST_SECRET", "s3cr3t")
+	t.Setenv("GIDARI_TEST_EMPTY", "")
+
+	for _, tcase := range []struct {
+		value    string
+		expected string
+		err      error
+	}{
+		{value: "literal", expected: "literal"},
+		{value: "${GIDARI_TEST_SECRET}", expected: "s3cr3t"},
+		{value: "Bearer ${GIDARI_TEST_SECRET}", expected: "Bearer s3cr3t"},
+		{value: "${GIDARI_TEST_EMPTY}", expected: ""},
+		{value: "pa$$word$GIDARI_TEST_SECRET", expected: "pa$$word$GIDARI_TEST_SECRET"},
+		{value: "${GIDARI_TEST_UNSET}", err: ErrMissingEnvVar},
+	} {
+		expanded, err := expandEnv(tcase.value)
+		if !errors.Is(err, tcase.err) {
+			t.Fatalf("expected error %v for %q, got %v", tcase.err, tcase.value, err)
+		}
+
+		if err == nil && expanded != tcase.expected {
+			t.Fatalf("expected %q to expand to %q, got %q", tcase.value, tcase.expected, expanded)
+		}
+	}
+}
+
+func TestNewConfigExpandsAuthentication(t *testing.T) {
+	t.Setenv("GIDARI_TEST_KEY", "key")
+	t.Setenv("GIDARI_TEST_SECRET", "secret")
+
+	cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 1
+  period: 1s
+authentication:
+  apiKey:
+    key: ${GIDARI_TEST_KEY}
+    secret: ${GIDARI_TEST_SECRET}
+    passphrase: literal
+requests:
+  - endpoint: /accounts
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	apiKey := cfg.Authentication.APIKey
+	if apiKey.Key != "key" || apiKey.Secret != "secret" || apiKey.Passphrase != "literal" {
+		t.Fatalf("unexpected credentials: %+v", apiKey)
+	}
+
+	_, err = NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 1
+  period: 1s
+authentication:
+  auth2:
+    bearer: ${GIDARI_TEST_UNSET}
+requests:
+  - endpoint: /accounts
+`))
+	if !errors.Is(err, ErrMissingEnvVar) {
+		t.Fatalf("expected a missing environment variable error, got %v", err)
+	}
+}
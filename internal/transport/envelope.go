@@ -0,0 +1,146 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+const (
+	// nextCursorMetadata and hasMoreMetadata are the run metadata keys of the pagination metadata of a response.
+	nextCursorMetadata = "nextCursor"
+	hasMoreMetadata    = "hasMore"
+)
+
+// ErrInvalidEnvelope is returned when a response does not match the envelope of its request.
+var ErrInvalidEnvelope = fmt.Errorf("invalid envelope")
+
+// InvalidEnvelopeError wraps an error with ErrInvalidEnvelope.
+func InvalidEnvelopeError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidEnvelope, msg)
+}
+
+// Page is the pagination metadata of a response.
+type Page struct {
+	// NextCursor is the cursor of the next page, or empty if the response does not have one.
+	NextCursor string
+
+	// HasMore is true if the web API has more records after the response.
+	HasMore bool
+}
+
+// metadata will return the page as run metadata.
+func (page *Page) metadata() map[string]string {
+	if page == nil || (page.NextCursor == "" && !page.HasMore) {
+		return nil
+	}
+
+	metadata := map[string]string{hasMoreMetadata: strconv.FormatBool(page.HasMore)}
+	if page.NextCursor != "" {
+		metadata[nextCursorMetadata] = page.NextCursor
+	}
+
+	return metadata
+}
+
+// decoder unwraps the records of a response body and extracts the pagination metadata of the response. The body is
+// decoded once, so that pagination strategies use the metadata of the same decoding as the records instead of each
+// parsing the body again.
+type decoder interface {
+	decode(body []byte) ([]byte, *Page, error)
+}
+
+// rawDecoder decodes responses whose body is the records, without pagination metadata.
+type rawDecoder struct{}
+
+func (rawDecoder) decode(body []byte) ([]byte, *Page, error) {
+	return body, new(Page), nil
+}
+
+// Envelope is the structure of a response that wraps its records with metadata, e.g.
+// `{"data": [...], "meta": {"next_cursor": "abc", "has_more": true}}`. Paths are dot-separated, see "Split".
+type Envelope struct {
+	// Records is the path to the records of the response.
+	Records string `yaml:"records" json:"records,omitempty"`
+
+	// NextCursor is the path to the cursor of the next page. A missing or null cursor means there is no next page.
+	NextCursor string `yaml:"nextCursor" json:"nextCursor,omitempty"`
+
+	// HasMore is the path to a boolean that is true if there are more records. If the path is not set, there are more
+	// records if the response has a next cursor.
+	HasMore string `yaml:"hasMore" json:"hasMore,omitempty"`
+}
+
+// newDecoder will return the decoder for responses with the envelope, a nil envelope decodes the body as records.
+func newDecoder(envelope *Envelope) decoder {
+	if envelope == nil {
+		return rawDecoder{}
+	}
+
+	return envelope
+}
+
+// lookupOptional will return the value at the path of the decoded data, or nil if the path does not exist.
+func lookupOptional(decoded interface{}, path string) interface{} {
+	val, err := tools.LookupJSONPath(decoded, path)
+	if err != nil {
+		return nil
+	}
+
+	return val
+}
+
+func (envelope *Envelope) decode(body []byte) ([]byte, *Page, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil, nil, fmt.Errorf("unable to decode envelope: %w", err)
+	}
+
+	records, err := tools.LookupJSONPath(decoded, envelope.Records)
+	if err != nil {
+		return nil, nil, InvalidEnvelopeError(fmt.Sprintf("records: %v", err))
+	}
+
+	page := new(Page)
+
+	if envelope.NextCursor != "" {
+		switch cursor := lookupOptional(decoded, envelope.NextCursor).(type) {
+		case nil:
+		case string:
+			page.NextCursor = cursor
+		case float64:
+			page.NextCursor = strconv.FormatFloat(cursor, 'f', -1, 64)
+		default:
+			return nil, nil, InvalidEnvelopeError(fmt.Sprintf("next cursor is a %T", cursor))
+		}
+	}
+
+	page.HasMore = page.NextCursor != ""
+
+	if envelope.HasMore != "" {
+		switch hasMore := lookupOptional(decoded, envelope.HasMore).(type) {
+		case nil:
+			page.HasMore = false
+		case bool:
+			page.HasMore = hasMore
+		default:
+			return nil, nil, InvalidEnvelopeError(fmt.Sprintf("has more is a %T", hasMore))
+		}
+	}
+
+	bytes, err := json.Marshal(records)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to encode records: %w", err)
+	}
+
+	return bytes, page, nil
+}
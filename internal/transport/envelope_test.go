@@ -0,0 +1,112 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	t.Parallel()
+
+	envelope := &Envelope{Records: "data", NextCursor: "meta.next_cursor", HasMore: "meta.has_more"}
+
+	for _, tcase := range []struct {
+		name     string
+		envelope *Envelope
+		body     string
+		records  string
+		page     Page
+		err      error
+	}{
+		{
+			name:     "no envelope",
+			envelope: nil,
+			body:     `[{"id":1}]`,
+			records:  `[{"id":1}]`,
+		},
+		{
+			name:     "more records",
+			envelope: envelope,
+			body:     `{"data":[{"id":1}],"meta":{"next_cursor":"abc","has_more":true}}`,
+			records:  `[{"id":1}]`,
+			page:     Page{NextCursor: "abc", HasMore: true},
+		},
+		{
+			name:     "last page",
+			envelope: envelope,
+			body:     `{"data":[{"id":1}],"meta":{"next_cursor":null,"has_more":false}}`,
+			records:  `[{"id":1}]`,
+		},
+		{
+			name:     "numeric cursor without has more",
+			envelope: &Envelope{Records: "results", NextCursor: "next"},
+			body:     `{"results":[],"next":1200}`,
+			records:  `[]`,
+			page:     Page{NextCursor: "1200", HasMore: true},
+		},
+		{
+			name:     "missing metadata",
+			envelope: envelope,
+			body:     `{"data":{"id":1}}`,
+			records:  `{"id":1}`,
+		},
+		{
+			name:     "missing records",
+			envelope: envelope,
+			body:     `{"items":[]}`,
+			err:      ErrInvalidEnvelope,
+		},
+		{
+			name:     "invalid has more",
+			envelope: envelope,
+			body:     `{"data":[],"meta":{"has_more":"yes"}}`,
+			err:      ErrInvalidEnvelope,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			records, page, err := newDecoder(tcase.envelope).decode([]byte(tcase.body))
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if string(records) != tcase.records {
+				t.Fatalf("expected records %s, got %s", tcase.records, records)
+			}
+
+			if *page != tcase.page {
+				t.Fatalf("expected page %+v, got %+v", tcase.page, *page)
+			}
+		})
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		t.Parallel()
+
+		page := &Page{NextCursor: "abc", HasMore: true}
+		expected := map[string]string{"nextCursor": "abc", "hasMore": "true"}
+
+		if metadata := page.metadata(); !reflect.DeepEqual(metadata, expected) {
+			t.Fatalf("expected metadata %v, got %v", expected, metadata)
+		}
+
+		if metadata := new(Page).metadata(); metadata != nil {
+			t.Fatalf("expected no metadata, got %v", metadata)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownErrorMode is returned when the configuration references an error mode that does not exist.
+var ErrUnknownErrorMode = fmt.Errorf("unknown error mode")
+
+// UnknownErrorModeError wraps an error with ErrUnknownErrorMode.
+func UnknownErrorModeError(name string) error {
+	return fmt.Errorf("%w: %q", ErrUnknownErrorMode, name)
+}
+
+// ErrorMode is how an upsert operation handles the requests that fail.
+type ErrorMode string
+
+const (
+	// ErrorModeFirst will stop the operation once a request fails, the requests that are not done are not made. The
+	// error of the failed request is returned. This is the default mode.
+	ErrorModeFirst ErrorMode = "first"
+
+	// ErrorModeCollect will make every request, returning the errors of all of the requests that fail.
+	ErrorModeCollect ErrorMode = "collect"
+)
+
+// validate will return an error if the error mode is not supported.
+func (mode ErrorMode) validate() error {
+	switch mode {
+	case "", ErrorModeFirst, ErrorModeCollect:
+		return nil
+	default:
+		return UnknownErrorModeError(string(mode))
+	}
+}
+
+// RequestError is the error of a request that failed during an upsert operation.
+type RequestError struct {
+	// Table is the table of the request.
+	Table string
+
+	// URL is the URL of the request.
+	URL string
+
+	Err error
+}
+
+// newRequestError will wrap the error of the request.
+func newRequestError(req *flattenedRequest, err error) *RequestError {
+	reqErr := &RequestError{Table: req.table, Err: err}
+	if req.fetchConfig != nil && req.fetchConfig.URL != nil {
+		reqErr.URL = req.fetchConfig.URL.String()
+	}
+
+	return reqErr
+}
+
+func (reqErr *RequestError) Error() string {
+	return fmt.Sprintf("request for %q failed (%s): %v", reqErr.Table, reqErr.URL, reqErr.Err)
+}
+
+func (reqErr *RequestError) Unwrap() error { return reqErr.Err }
+
+// RequestErrors are the errors of the requests that failed during an upsert operation, in the order they failed.
+type RequestErrors []*RequestError
+
+func (errs RequestErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for idx, err := range errs {
+		msgs[idx] = err.Error()
+	}
+
+	return fmt.Sprintf("%d requests failed: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+// Is will return true if the error of any of the requests is the target.
+func (errs RequestErrors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As will set the target to the first error of the requests that matches it.
+func (errs RequestErrors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failures collects the errors of the failed requests of an upsert operation.
+type failures struct {
+	mode ErrorMode
+	errs RequestErrors
+}
+
+// add will add the error of a failed request, returning true if the operation should stop.
+func (f *failures) add(err *RequestError) bool {
+	f.errs = append(f.errs, err)
+
+	return f.mode != ErrorModeCollect
+}
+
+// err will return the error of the failed requests, or nil if no request failed.
+func (f *failures) err() error {
+	switch {
+	case len(f.errs) == 0:
+		return nil
+	case f.mode == ErrorModeCollect:
+		return f.errs
+	default:
+		return f.errs[0]
+	}
+}
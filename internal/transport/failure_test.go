@@ -0,0 +1,124 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+func TestErrorMode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			mode ErrorMode
+			err  error
+		}{
+			{"", nil},
+			{ErrorModeFirst, nil},
+			{ErrorModeCollect, nil},
+			{"all", ErrUnknownErrorMode},
+		} {
+			if err := tcase.mode.validate(); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v for mode %q, got %v", tcase.err, tcase.mode, err)
+			}
+		}
+	})
+
+	t.Run("request errors", func(t *testing.T) {
+		t.Parallel()
+
+		errs := RequestErrors{
+			{Table: "candles", Err: fmt.Errorf("candles error")},
+			{Table: "trades", Err: ErrStaleResponse},
+		}
+
+		if !errors.Is(errs, ErrStaleResponse) {
+			t.Fatalf("expected the errors to match the error of a request")
+		}
+
+		var reqErr *RequestError
+		if !errors.As(errs, &reqErr) || reqErr.Table != "candles" {
+			t.Fatalf("expected the errors to match the first request error, got %v", reqErr)
+		}
+	})
+
+	for _, tcase := range []struct {
+		mode     ErrorMode
+		failures int
+	}{
+		{ErrorModeFirst, 1},
+		{ErrorModeCollect, 2},
+	} {
+		tcase := tcase
+
+		t.Run(fmt.Sprintf("upsert %s", tcase.mode), func(t *testing.T) {
+			t.Parallel()
+
+			var requests int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+
+				if r.URL.Path != "/ok" {
+					w.WriteHeader(http.StatusInternalServerError)
+
+					return
+				}
+
+				fmt.Fprint(w, `[]`)
+			}))
+			t.Cleanup(server.Close)
+
+			// The failing requests depend on the table of the successful request, so that it is made first.
+			cfg, err := NewConfig([]byte(fmt.Sprintf(`
+url: %s
+errorMode: %s
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /ok
+  - endpoint: /first
+    dependsOn: [ok]
+  - endpoint: /second
+    dependsOn: [first]
+`, server.URL, tcase.mode)))
+			if err != nil {
+				t.Fatalf("error creating config: %v", err)
+			}
+
+			_, err = Upsert(context.Background(), cfg)
+
+			var rspErr *web.ResponseError
+			if !errors.As(err, &rspErr) || rspErr.StatusCode != http.StatusInternalServerError {
+				t.Fatalf("expected the response error of the failed request, got %v", err)
+			}
+
+			var reqErrs RequestErrors
+
+			if errors.As(err, &reqErrs) != (tcase.mode == ErrorModeCollect) {
+				t.Fatalf("expected the errors of every request to be collected in mode %q, got %v", tcase.mode, err)
+			}
+
+			if got := atomic.LoadInt32(&requests); got != int32(tcase.failures+1) {
+				t.Fatalf("expected %d requests, got %d", tcase.failures+1, got)
+			}
+		})
+	}
+}
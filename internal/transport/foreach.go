@@ -0,0 +1,306 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/tools"
+	"golang.org/x/time/rate"
+)
+
+// defaultForeachPath is the default path of the values of a foreach request.
+const defaultForeachPath = "id"
+
+// ErrInvalidForeach is returned when the foreach of a request is invalid.
+var ErrInvalidForeach = fmt.Errorf("invalid foreach")
+
+// InvalidForeachError wraps an error with ErrInvalidForeach.
+func InvalidForeachError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidForeach, msg)
+}
+
+// Foreach fans a request out into a request for every value at a path of the records that the run upserts into a
+// table, e.g. a "/accounts/{{ .Each }}/ledger" request for the "id" of every record of the "accounts" table. The
+// request depends on the table, so it is expanded once every request writing to the table is done. The value is
+// rendered into the endpoint, query, and body templates of the request as "{{ .Each }}".
+type Foreach struct {
+	// Table is the table of the records that the values are taken from. A request of the run must write to it.
+	Table string `yaml:"table"`
+
+	// Path is the dot-separated path of the value in each record, the default is "id". Records without the path are
+	// skipped, and each distinct value is requested once.
+	Path string `yaml:"path"`
+
+	// Where keeps only the records whose fields have the values, e.g. {"quote_currency": "USD"}. The fields are
+	// dot-separated paths, and the values are compared as they are rendered into the templates.
+	Where map[string]string `yaml:"where"`
+
+	// Universe is the name of a universe of the configuration to take the values from, instead of a table. The table,
+	// path, and where of the foreach are set from the universe.
+	Universe string `yaml:"universe"`
+}
+
+func (foreach *Foreach) path() string {
+	if foreach.Path == "" {
+		return defaultForeachPath
+	}
+
+	return foreach.Path
+}
+
+// validate will ensure that the foreach takes its values from a table that is written by one of the requests. The
+// tables of the requests without a table are named with the table naming.
+func (foreach *Foreach) validate(requests []*Request, naming TableNaming) error {
+	if foreach == nil {
+		return nil
+	}
+
+	if foreach.Table == "" {
+		return InvalidForeachError("no table")
+	}
+
+	for _, req := range requests {
+		if req.Sink != nil {
+			continue
+		}
+
+		named := *req
+		if named.Table == "" {
+			named.Table = naming.tableName(req.Endpoint)
+		}
+
+		for _, table := range named.tables() {
+			if table == foreach.Table {
+				return nil
+			}
+		}
+	}
+
+	return InvalidForeachError(fmt.Sprintf("no request writes to table %q", foreach.Table))
+}
+
+// foreachRequest is the request of a foreach, which is flattened for every value once the values are collected.
+type foreachRequest struct {
+	req     *Request
+	rurl    url.URL
+	client  *web.Client
+	limiter *rate.Limiter
+}
+
+// flattenForeach will return the flattened request that holds the place of the requests of the foreach in the run
+// until they are expanded. It depends on the table of the foreach, in addition to the dependencies of the request.
+func (req *Request) flattenForeach(rurl url.URL, client *web.Client, limiter *rate.Limiter) *flattenedRequest {
+	dependsOn := make([]string, 0, len(req.DependsOn)+1)
+	dependsOn = append(dependsOn, req.DependsOn...)
+	dependsOn = append(dependsOn, req.Foreach.Table)
+
+	base := rurl
+
+	return &flattenedRequest{
+		fetchConfig: &web.FetchConfig{C: client, Method: req.Method, URL: &base, RateLimiter: limiter},
+		table:       req.Table,
+		split:       req.Split,
+		sink:        req.Sink,
+		dependsOn:   dependsOn,
+		foreach:     &foreachRequest{req: req, rurl: rurl, client: client, limiter: limiter},
+	}
+}
+
+// expand will flatten the request for every value.
+func (foreach *foreachRequest) expand(values []string) ([]*flattenedRequest, error) {
+	var expanded []*flattenedRequest
+
+	for _, value := range values {
+		req := *foreach.req
+		req.each = value
+
+		flatReqs, err := req.flattenTimeseries(foreach.rurl, foreach.client)
+		if err != nil {
+			return nil, fmt.Errorf("unable to expand foreach value %q: %w", value, err)
+		}
+
+		for _, flatReq := range flatReqs {
+			flatReq.fetchConfig.RateLimiter = foreach.limiter
+		}
+
+		expanded = append(expanded, flatReqs...)
+	}
+
+	return expanded, nil
+}
+
+// foreachKey identifies the values at a path of the records of a table that match a filter.
+type foreachKey struct {
+	table, path string
+
+	// where is the encoded filter of the records, see key.
+	where string
+}
+
+// key will return the key of the values of the foreach.
+func (foreach *Foreach) key() foreachKey {
+	where := make(url.Values, len(foreach.Where))
+	for field, value := range foreach.Where {
+		where.Set(field, value)
+	}
+
+	return foreachKey{table: foreach.Table, path: foreach.path(), where: where.Encode()}
+}
+
+// match will return true if the fields of the record have the values of the filter. Records without a field of the
+// filter do not match.
+func match(record interface{}, where map[string]string) bool {
+	for field, expected := range where {
+		val, err := tools.LookupJSONPath(record, field)
+		if err != nil || val == nil {
+			return false
+		}
+
+		if value, err := foreachValue(val); err != nil || value != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// foreachValues collects the values of the foreach requests from the records that are upserted during a run.
+type foreachValues struct {
+	mu sync.Mutex
+
+	// keys are the keys of the values that are collected for each table, and where are their filters.
+	keys  map[string][]foreachKey
+	where map[foreachKey]map[string]string
+
+	// values are the distinct values of each path, in the order they are collected.
+	values map[foreachKey][]string
+	seen   map[foreachKey]map[string]bool
+}
+
+// newForeachValues will return the collector of the values of the foreach requests.
+func newForeachValues(requests []*Request) *foreachValues {
+	fv := &foreachValues{
+		keys:   make(map[string][]foreachKey),
+		where:  make(map[foreachKey]map[string]string),
+		values: make(map[foreachKey][]string),
+		seen:   make(map[foreachKey]map[string]bool),
+	}
+
+	for _, req := range requests {
+		if req.Foreach == nil {
+			continue
+		}
+
+		key := req.Foreach.key()
+		if fv.seen[key] != nil {
+			continue
+		}
+
+		fv.seen[key] = make(map[string]bool)
+		fv.keys[key.table] = append(fv.keys[key.table], key)
+		fv.where[key] = req.Foreach.Where
+	}
+
+	return fv
+}
+
+// foreachValue will format a value of a record for a template.
+func foreachValue(val interface{}) (string, error) {
+	switch val := val.(type) {
+	case string:
+		return val, nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	default:
+		bytes, err := json.Marshal(val)
+		if err != nil {
+			return "", fmt.Errorf("unable to format foreach value: %w", err)
+		}
+
+		return string(bytes), nil
+	}
+}
+
+// collect will add the values of the JSON encoded records of the table.
+func (fv *foreachValues) collect(table string, data []byte) error {
+	if fv == nil || len(fv.keys[table]) == 0 {
+		return nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("unable to collect foreach values of %q: %w", table, err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	for _, key := range fv.keys[table] {
+		for _, record := range records {
+			if !match(record, fv.where[key]) {
+				continue
+			}
+
+			val, err := tools.LookupJSONPath(record, key.path)
+			if err != nil || val == nil {
+				continue
+			}
+
+			value, err := foreachValue(val)
+			if err != nil {
+				return err
+			}
+
+			if !fv.seen[key][value] {
+				fv.seen[key][value] = true
+				fv.values[key] = append(fv.values[key], value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// get will return the values collected for the foreach.
+func (fv *foreachValues) get(foreach *Foreach) []string {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	return fv.values[foreach.key()]
+}
+
+// expand will return the requests of a foreach request, with the values collected for it. The pending requests of the
+// tables of the foreach request are adjusted for the number of requests it expands into, and the foreach request is
+// done, returning the blocked requests that are released.
+func (bar *barrier) expand(req *flattenedRequest, values *foreachValues) ([]*flattenedRequest, []*flattenedRequest,
+	error,
+) {
+	expanded, err := req.foreach.expand(values.get(req.foreach.req.Foreach))
+	if err != nil {
+		return nil, bar.done(req), err
+	}
+
+	for _, table := range req.tables() {
+		bar.pending[table] += len(expanded)
+	}
+
+	return expanded, bar.done(req), nil
+}
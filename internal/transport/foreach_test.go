@@ -0,0 +1,262 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForeach(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		requests := []*Request{{Endpoint: "/v2/accounts"}, {Table: "exports", Sink: &Sink{}}}
+
+		for _, tcase := range []struct {
+			name    string
+			foreach *Foreach
+			err     error
+		}{
+			{"nil", nil, nil},
+			{"valid", &Foreach{Table: "accounts"}, nil},
+			{"no table", &Foreach{}, ErrInvalidForeach},
+			{"unknown table", &Foreach{Table: "orders"}, ErrInvalidForeach},
+			{"sink table", &Foreach{Table: "exports"}, ErrInvalidForeach},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.foreach.validate(requests, TableNamingLast); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		t.Parallel()
+
+		values := newForeachValues([]*Request{
+			{Foreach: &Foreach{Table: "accounts"}},
+			{Foreach: &Foreach{Table: "accounts", Path: "owner.name"}},
+		})
+
+		for _, data := range []string{
+			`[{"id":"a","owner":{"name":"x"}},{"id":2},{"currency":"USD"}]`,
+			`[{"id":"a"},{"id":true,"owner":{"name":"y"}}]`,
+			`{"id":"c"}`,
+		} {
+			if err := values.collect("accounts", []byte(data)); err != nil {
+				t.Fatalf("error collecting values: %v", err)
+			}
+		}
+
+		if err := values.collect("orders", []byte(`not json`)); err != nil {
+			t.Fatalf("expected the records of other tables to be ignored, got %v", err)
+		}
+
+		if ids := values.get(&Foreach{Table: "accounts"}); !reflect.DeepEqual(ids, []string{"a", "2", "true", "c"}) {
+			t.Fatalf("unexpected ids %v", ids)
+		}
+
+		names := values.get(&Foreach{Table: "accounts", Path: "owner.name"})
+		if !reflect.DeepEqual(names, []string{"x", "y"}) {
+			t.Fatalf("unexpected names %v", names)
+		}
+	})
+
+	t.Run("expand", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /accounts
+  - endpoint: /accounts/{{ .Each }}/ledger
+    table: ledger
+    query:
+      currency: "{{ .Each | lower }}"
+    foreach:
+      table: accounts
+  - endpoint: /reports
+    dependsOn: [ledger]
+`))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		requests, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error flattening requests: %v", err)
+		}
+
+		bar, err := newBarrier(requests)
+		if err != nil {
+			t.Fatalf("error creating barrier: %v", err)
+		}
+
+		queue := bar.release(requests)
+		if len(queue) != 1 || queue[0].table != "accounts" {
+			t.Fatalf("expected only the accounts request to be released, got %d requests", len(queue))
+		}
+
+		values := newForeachValues(cfg.Requests)
+		if err := values.collect("accounts", []byte(`[{"id":"A1"},{"id":"B2"}]`)); err != nil {
+			t.Fatalf("error collecting values: %v", err)
+		}
+
+		released := bar.done(queue[0])
+		if len(released) != 1 || released[0].foreach == nil {
+			t.Fatalf("expected the foreach request to be released, got %d requests", len(released))
+		}
+
+		expanded, released, err := bar.expand(released[0], values)
+		if err != nil {
+			t.Fatalf("error expanding foreach request: %v", err)
+		}
+
+		if len(released) != 0 {
+			t.Fatalf("expected the reports request to wait for the expanded requests, got %d released", len(released))
+		}
+
+		var urls []string
+		for _, req := range expanded {
+			urls = append(urls, req.fetchConfig.URL.String())
+		}
+
+		expected := []string{
+			"https://api.test.com/accounts/A1/ledger?currency=a1",
+			"https://api.test.com/accounts/B2/ledger?currency=b2",
+		}
+		if !reflect.DeepEqual(urls, expected) {
+			t.Fatalf("expected urls %v, got %v", expected, urls)
+		}
+
+		if released := bar.done(expanded[0]); len(released) != 0 {
+			t.Fatalf("expected the reports request to wait for every expanded request, got %d released", len(released))
+		}
+
+		if released := bar.done(expanded[1]); len(released) != 1 || released[0].table != "reports" {
+			t.Fatalf("expected the reports request to be released, got %d requests", len(released))
+		}
+	})
+
+	t.Run("expand without values", func(t *testing.T) {
+		t.Parallel()
+
+		req := &Request{Endpoint: "/accounts/{{ .Each }}/ledger", Table: "ledger", Foreach: &Foreach{Table: "accounts"}}
+		rurl, _ := url.Parse("https://api.test.com")
+		placeholder := req.flattenForeach(*rurl, nil, nil)
+
+		dependent := &flattenedRequest{table: "reports", dependsOn: []string{"ledger"}}
+
+		bar, err := newBarrier([]*flattenedRequest{placeholder, dependent})
+		if err != nil {
+			t.Fatalf("error creating barrier: %v", err)
+		}
+
+		bar.release([]*flattenedRequest{dependent})
+
+		expanded, released, err := bar.expand(placeholder, newForeachValues([]*Request{req}))
+		if err != nil || len(expanded) != 0 {
+			t.Fatalf("expected no expanded requests, got %d (%v)", len(expanded), err)
+		}
+
+		if len(released) != 1 || released[0] != dependent {
+			t.Fatalf("expected the dependent request to be released, got %d requests", len(released))
+		}
+	})
+}
+
+// upsertForeach will run the configuration against a server whose accounts have the ids, and return the number of
+// ledger requests that completed. The run fails the test if it does not complete within the timeout.
+func upsertForeach(t *testing.T, config string, ids int) int {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/accounts" {
+			fmt.Fprint(w, `[{"id":1}]`)
+
+			return
+		}
+
+		accounts := make([]string, ids)
+		for idx := range accounts {
+			accounts[idx] = fmt.Sprintf(`{"id":"A%d","currency":"USD"}`, idx)
+		}
+
+		fmt.Fprintf(w, "[%s]", strings.Join(accounts, ","))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte("url: " + server.URL + config))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	var (
+		mutex     sync.Mutex
+		completed int
+	)
+
+	cfg.Progress = func(event *ProgressEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if event.Type == ProgressRequestCompleted && event.Table == "ledger" {
+			completed++
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := Upsert(ctx, cfg); err != nil {
+		t.Fatalf("error upserting: %v", err)
+	}
+
+	return completed
+}
+
+func TestUpsertForeach(t *testing.T) {
+	t.Parallel()
+
+	// The foreach request expands into far more requests than the configuration has, which the workers must not be
+	// blocked on.
+	completed := upsertForeach(t, `
+rateLimit:
+  burst: 1000
+  period: 1s
+requests:
+  - endpoint: /accounts
+  - endpoint: /accounts/{{ .Each }}/ledger
+    table: ledger
+    foreach:
+      table: accounts
+`, 300)
+	if completed != 300 {
+		t.Fatalf("expected 300 ledger requests to complete, got %d", completed)
+	}
+}
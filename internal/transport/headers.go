@@ -0,0 +1,28 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import "net/textproto"
+
+// mergeHeaders will return the headers of the configuration merged with the headers of a request, keyed by their
+// canonical names so that the headers of the request take precedence regardless of their case.
+func mergeHeaders(global, headers map[string]string) map[string]string {
+	if len(global) == 0 && len(headers) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(global)+len(headers))
+
+	for _, src := range []map[string]string{global, headers} {
+		for key, value := range src {
+			merged[textproto.CanonicalMIMEHeaderKey(key)] = value
+		}
+	}
+
+	return merged
+}
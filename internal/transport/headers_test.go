@@ -0,0 +1,56 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+headers:
+  x-tenant-id: acme
+  Accept: application/json
+requests:
+  - endpoint: /candles
+  - endpoint: /orders
+    headers:
+      accept: application/vnd.api+json
+      API-Version: "2022-11-28"
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	requests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	for idx, expected := range []http.Header{
+		{"X-Tenant-Id": {"acme"}, "Accept": {"application/json"}},
+		{"X-Tenant-Id": {"acme"}, "Accept": {"application/vnd.api+json"}, "Api-Version": {"2022-11-28"}},
+	} {
+		if header := requests[idx].fetchConfig.Header; !reflect.DeepEqual(header, expected) {
+			t.Fatalf("expected request %d to have headers %v, got %v", idx, expected, header)
+		}
+	}
+
+	if merged := mergeHeaders(nil, nil); merged != nil {
+		t.Fatalf("expected no headers, got %v", merged)
+	}
+}
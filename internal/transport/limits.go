@@ -0,0 +1,173 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidLimits is returned when the limits of a request are not valid.
+	ErrInvalidLimits = fmt.Errorf("invalid limits")
+
+	// ErrLimitExceeded is returned when the response of a request with the "fail" limit action exceeds its limits.
+	ErrLimitExceeded = fmt.Errorf("limit exceeded")
+)
+
+// InvalidLimitsError wraps an error with ErrInvalidLimits.
+func InvalidLimitsError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidLimits, msg)
+}
+
+// LimitExceededError wraps an error with ErrLimitExceeded.
+func LimitExceededError(table, msg string) error {
+	return fmt.Errorf("%w: %s: %s", ErrLimitExceeded, table, msg)
+}
+
+// LimitAction is what happens to the response of a request that exceeds its limits.
+type LimitAction string
+
+const (
+	// LimitActionWarn will log a warning and upsert the response as it is. This is the default action.
+	LimitActionWarn LimitAction = "warn"
+
+	// LimitActionTruncate will log a warning and upsert the first records of the response that are within the limits.
+	LimitActionTruncate LimitAction = "truncate"
+
+	// LimitActionFail will fail the request.
+	LimitActionFail LimitAction = "fail"
+)
+
+// Limits are the guardrails of the responses of a request, protecting the repositories from an upstream bug that
+// suddenly returns far more data than expected. The limits apply to the records of every page of the response, after
+// they are unwrapped from their envelope. A response that exceeds them sends a "ProgressLimitExceeded" event.
+type Limits struct {
+	// MaxBytes is the maximum size of the JSON encoded records of the response. There is no limit if it is zero.
+	MaxBytes int64 `yaml:"maxBytes"`
+
+	// MaxRecords is the maximum number of records of the response. There is no limit if it is zero.
+	MaxRecords int `yaml:"maxRecords"`
+
+	// Action is what happens to a response that exceeds the limits: "warn" (the default), "truncate", or "fail".
+	Action LimitAction `yaml:"action"`
+}
+
+// validate will ensure that the limits are valid.
+func (limits *Limits) validate() error {
+	if limits == nil {
+		return nil
+	}
+
+	if limits.MaxBytes < 0 || limits.MaxRecords < 0 {
+		return InvalidLimitsError("maxBytes and maxRecords must not be negative")
+	}
+
+	if limits.MaxBytes == 0 && limits.MaxRecords == 0 {
+		return InvalidLimitsError("maxBytes or maxRecords is required")
+	}
+
+	switch limits.Action {
+	case "", LimitActionWarn, LimitActionTruncate, LimitActionFail:
+		return nil
+	default:
+		return InvalidLimitsError(fmt.Sprintf("unknown action %q", limits.Action))
+	}
+}
+
+// exceeded will return a description of the limits that the size and the number of records exceed, or an empty string
+// if they are within the limits.
+func (limits *Limits) exceeded(size int64, count int) string {
+	switch {
+	case limits.MaxBytes > 0 && size > limits.MaxBytes:
+		return fmt.Sprintf("%d bytes exceed the limit of %d bytes", size, limits.MaxBytes)
+	case limits.MaxRecords > 0 && count > limits.MaxRecords:
+		return fmt.Sprintf("%d records exceed the limit of %d records", count, limits.MaxRecords)
+	default:
+		return ""
+	}
+}
+
+// check will apply the limits to the JSON encoded records of the response of the job, returning the records to upsert.
+// A response that is a single object is a single record. If the response exceeds the limits, a progress event is sent
+// with the size and number of records of the response.
+func (limits *Limits) check(job *webJob, data []byte, webQueue int) ([]byte, error) {
+	if limits == nil {
+		return data, nil
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		records = []json.RawMessage{data}
+	}
+
+	msg := limits.exceeded(int64(len(data)), len(records))
+	if msg == "" {
+		return data, nil
+	}
+
+	job.progress.send(&ProgressEvent{
+		Type:     ProgressLimitExceeded,
+		Table:    job.table,
+		Records:  int64(len(records)),
+		Bytes:    int64(len(data)),
+		WebQueue: webQueue,
+	})
+
+	switch limits.Action {
+	case LimitActionFail:
+		return nil, LimitExceededError(job.table, msg)
+	case LimitActionTruncate:
+		logWarn := tools.LogEvent{
+			Table: job.table,
+			Msg:   "truncating response that exceeds the limits",
+			Count: len(records),
+			Bytes: int64(len(data)),
+		}
+		logWarn.Log(job.logger, logrus.WarnLevel)
+
+		return limits.truncate(records)
+	default:
+		logWarn := tools.LogEvent{
+			Table: job.table,
+			Msg:   "response exceeds limits",
+			Count: len(records),
+			Bytes: int64(len(data)),
+		}
+		logWarn.Log(job.logger, logrus.WarnLevel)
+
+		return data, nil
+	}
+}
+
+// truncate will JSON encode the first records that are within the limits.
+func (limits *Limits) truncate(records []json.RawMessage) ([]byte, error) {
+	// size is the size of the encoded array of the records that are kept, including the brackets and commas.
+	size := int64(1)
+
+	var kept int
+
+	for _, record := range records {
+		if limits.exceeded(size+int64(len(record))+1, kept+1) != "" {
+			break
+		}
+
+		size += int64(len(record)) + 1
+		kept++
+	}
+
+	bytes, err := json.Marshal(records[:kept])
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode truncated records: %w", err)
+	}
+
+	return bytes, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name   string
+			limits *Limits
+			err    error
+		}{
+			{"nil", nil, nil},
+			{"records", &Limits{MaxRecords: 10}, nil},
+			{"bytes", &Limits{MaxBytes: 1024, Action: LimitActionFail}, nil},
+			{"no limits", &Limits{Action: LimitActionWarn}, ErrInvalidLimits},
+			{"negative", &Limits{MaxRecords: -1}, ErrInvalidLimits},
+			{"unknown action", &Limits{MaxRecords: 10, Action: "drop"}, ErrInvalidLimits},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.limits.validate(); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		t.Parallel()
+
+		const records = `[{"id":1},{"id":2},{"id":3}]`
+
+		for _, tcase := range []struct {
+			name     string
+			limits   *Limits
+			data     string
+			expected string
+			exceeded bool
+			err      error
+		}{
+			{"nil", nil, records, records, false, nil},
+			{"within", &Limits{MaxRecords: 3, MaxBytes: 100}, records, records, false, nil},
+			{"warn", &Limits{MaxRecords: 2}, records, records, true, nil},
+			{"truncate records", &Limits{MaxRecords: 2, Action: LimitActionTruncate}, records, `[{"id":1},{"id":2}]`, true, nil},
+			{"truncate bytes", &Limits{MaxBytes: 20, Action: LimitActionTruncate}, records, `[{"id":1},{"id":2}]`, true, nil},
+			{"fail", &Limits{MaxBytes: 20, Action: LimitActionFail}, records, "", true, ErrLimitExceeded},
+			{"single object", &Limits{MaxBytes: 5, Action: LimitActionFail}, `{"id":1}`, "", true, ErrLimitExceeded},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				var events []*ProgressEvent
+
+				job := &webJob{
+					flattenedRequest: &flattenedRequest{table: "candles"},
+					logger:           logrus.New(),
+					progress:         newProgress(func(event *ProgressEvent) { events = append(events, event) }),
+				}
+
+				data, err := tcase.limits.check(job, []byte(tcase.data), 0)
+				if !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+
+				if string(data) != tcase.expected {
+					t.Fatalf("expected records %s, got %s", tcase.expected, data)
+				}
+
+				if exceeded := len(events) == 1 && events[0].Type == ProgressLimitExceeded; exceeded != tcase.exceeded {
+					t.Fatalf("expected a limit exceeded event to be %v, got events %v", tcase.exceeded, events)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,201 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// defaultLineageField is the default field of the run ID on upserted records.
+	defaultLineageField = "gidariRunId"
+
+	// runIDEntropy is the number of random bytes in a run ID.
+	runIDEntropy = 4
+)
+
+var (
+	// ErrLineageDisabled is returned when purging a run with a configuration that does not have lineage.
+	ErrLineageDisabled = fmt.Errorf("lineage is not configured")
+
+	// ErrMissingRunID is returned when purging without a run ID.
+	ErrMissingRunID = fmt.Errorf("missing run ID")
+)
+
+// Lineage stamps every upserted record with the ID of the run that wrote it, so that the records of a bad run can be
+// traced and purged. The run ID is returned on the result of the upsert operation.
+type Lineage struct {
+	// Field is the name of the field of the run ID on the records, the default is "gidariRunId". Postgres tables need
+	// a column for the field, which is added to the tables created from schemas.
+	Field string `yaml:"field"`
+}
+
+// field will return the name of the field of the run ID.
+func (lineage *Lineage) field() string {
+	if lineage.Field == "" {
+		return defaultLineageField
+	}
+
+	return lineage.Field
+}
+
+// fields will return the fields to set on the records of the run, or nil if lineage is not configured.
+func (lineage *Lineage) fields(runID string) map[string]interface{} {
+	if lineage == nil {
+		return nil
+	}
+
+	return map[string]interface{}{lineage.field(): runID}
+}
+
+// addColumn will add the column of the run ID to the request, if lineage is configured and the table does not already
+// have the column.
+func (lineage *Lineage) addColumn(req *proto.CreateTableRequest) {
+	if lineage == nil {
+		return
+	}
+
+	for _, column := range req.Columns {
+		if column.Name == lineage.field() {
+			return
+		}
+	}
+
+	req.Columns = append(req.Columns, &proto.Column{Name: lineage.field(), Type: storage.ColumnTypeString})
+}
+
+// newRunID will return a new run ID, which is the start time of the run followed by random bytes so that concurrent
+// runs have different IDs.
+func newRunID() (string, error) {
+	entropy := make([]byte, runIDEntropy)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", fmt.Errorf("unable to generate run ID: %w", err)
+	}
+
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(entropy)), nil
+}
+
+// PurgeResult is the result of a purge operation.
+type PurgeResult struct {
+	// Tables maps each table to the number of records deleted, summed over every repository.
+	Tables map[string]int64
+
+	mutex sync.Mutex
+}
+
+func (result *PurgeResult) add(table string, rsp *proto.DeleteResponse) {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+
+	result.Tables[table] += rsp.GetDeletedCount()
+}
+
+// purgeTables will return the sorted tables that the requests of the configuration write to.
+func (cfg *Config) purgeTables() ([]string, error) {
+	requests, err := cfg.expandRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+
+	for _, req := range requests {
+		for _, table := range req.tables() {
+			if table != "" {
+				set[table] = true
+			}
+		}
+	}
+
+	tables := make([]string, 0, len(set))
+	for table := range set {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	return tables, nil
+}
+
+// Purge will delete the records written by a run from the tables of the configuration, in every storage that the
+// tables are routed to. This undoes a bad run without truncating the records of other runs. The deletes on each
+// storage are made in a single transaction, so a storage is either purged entirely or not at all.
+func Purge(ctx context.Context, cfg *Config, runID string) (*PurgeResult, error) {
+	start := time.Now()
+
+	if cfg.Lineage == nil {
+		return nil, ErrLineageDisabled
+	}
+
+	if runID == "" {
+		return nil, ErrMissingRunID
+	}
+
+	tables, err := cfg.purgeTables()
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := structpb.NewStruct(cfg.Lineage.fields(runID))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create purge scope: %w", err)
+	}
+
+	repos, closeRepos, err := cfg.repos(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeRepos()
+
+	result := &PurgeResult{Tables: make(map[string]int64)}
+	routing := cfg.routing()
+
+	for idx, repo := range repos {
+		for _, table := range routing.filter(idx, tables) {
+			req := &proto.DeleteRequest{Table: table, Required: required}
+
+			repo.TransactContext(ctx, func(sctx context.Context, repo repository.Generic) error {
+				rsp, err := repo.Delete(sctx, req)
+				if err != nil {
+					return fmt.Errorf("unable to purge table %q: %w", req.Table, err)
+				}
+
+				result.add(req.Table, rsp)
+
+				return nil
+			})
+		}
+
+		if err := repo.Commit(); err != nil {
+			return nil, fmt.Errorf("unable to commit purge on %q: %w", storage.Scheme(repo.Type()), err)
+		}
+	}
+
+	logInfo := tools.LogEvent{
+		Duration: time.Since(start),
+		Msg:      "purged run",
+		RunID:    runID,
+	}
+	logInfo.Log(cfg.Logger, logrus.InfoLevel)
+
+	return result, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+)
+
+func TestLineage(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fields", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name     string
+			lineage  *Lineage
+			expected map[string]interface{}
+		}{
+			{name: "disabled", lineage: nil, expected: nil},
+			{name: "default", lineage: &Lineage{}, expected: map[string]interface{}{"gidariRunId": "run"}},
+			{name: "field", lineage: &Lineage{Field: "run_id"}, expected: map[string]interface{}{"run_id": "run"}},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if fields := tcase.lineage.fields("run"); !reflect.DeepEqual(fields, tcase.expected) {
+					t.Fatalf("expected fields %v, got %v", tcase.expected, fields)
+				}
+			})
+		}
+	})
+
+	t.Run("add column", func(t *testing.T) {
+		t.Parallel()
+
+		req := &proto.CreateTableRequest{Table: "candles", Columns: []*proto.Column{{Name: "time"}}}
+
+		lineage := &Lineage{Field: "run_id"}
+		lineage.addColumn(req)
+		lineage.addColumn(req)
+
+		if len(req.Columns) != 2 || req.Columns[1].Name != "run_id" || req.Columns[1].Type != "string" {
+			t.Fatalf("expected the run ID column to be added once, got %v", req.Columns)
+		}
+	})
+
+	t.Run("run ID", func(t *testing.T) {
+		t.Parallel()
+
+		first, err := newRunID()
+		if err != nil {
+			t.Fatalf("failed to generate run ID: %v", err)
+		}
+
+		second, err := newRunID()
+		if err != nil {
+			t.Fatalf("failed to generate run ID: %v", err)
+		}
+
+		if first == second {
+			t.Fatalf("expected distinct run IDs, got %q twice", first)
+		}
+	})
+}
+
+func TestPurge(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 1
+  period: 1
+lineage:
+  field: run_id
+requests:
+  - endpoint: /products
+  - endpoint: /accounts
+    split:
+      - path: data
+        table: balances
+      - path: holds
+        table: holds
+  - endpoint: /products
+    table: products
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	tables, err := cfg.purgeTables()
+	if err != nil {
+		t.Fatalf("error listing purge tables: %v", err)
+	}
+
+	if expected := []string{"balances", "holds", "products"}; !reflect.DeepEqual(tables, expected) {
+		t.Fatalf("expected purge tables %v, got %v", expected, tables)
+	}
+
+	if _, err := Purge(context.Background(), cfg, ""); !errors.Is(err, ErrMissingRunID) {
+		t.Fatalf("expected error %v, got %v", ErrMissingRunID, err)
+	}
+
+	cfg.Lineage = nil
+	if _, err := Purge(context.Background(), cfg, "run"); !errors.Is(err, ErrLineageDisabled) {
+		t.Fatalf("expected error %v, got %v", ErrLineageDisabled, err)
+	}
+}
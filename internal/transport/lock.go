@@ -0,0 +1,167 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// lockFileMode is the file mode of the lock file.
+const lockFileMode = 0o600
+
+var (
+	// ErrInvalidRunLock is returned when the run lock of the configuration is invalid.
+	ErrInvalidRunLock = fmt.Errorf("invalid run lock")
+
+	// ErrRunLocked is returned when another process holds the run lock of the configuration.
+	ErrRunLocked = fmt.Errorf("run is locked by another process")
+
+	// errFileLocked is returned when another process holds the lock of a file.
+	errFileLocked = fmt.Errorf("file is locked")
+)
+
+// RunLock prevents two processes from running the configuration at the same time, e.g. a cron job that starts before
+// the previous one finishes, which would corrupt the watermarks of the requests and exceed the rate limits of the web
+// API. The lock is either a lock on a file, for processes on the same host, or an advisory lock on the storages, for
+// processes on different hosts. A run that cannot acquire the lock fails with ErrRunLocked instead of waiting.
+type RunLock struct {
+	// File is the path of the lock file, which is created if it does not exist.
+	File string `yaml:"file"`
+
+	// Storage will take an advisory lock on every storage that supports them, e.g. PostgreSQL. At least one of the
+	// storages must support advisory locks.
+	Storage bool `yaml:"storage"`
+
+	// Key is the key of the advisory locks, the default is the URL of the configuration.
+	Key string `yaml:"key"`
+}
+
+// validate will ensure that the run lock is valid.
+func (lock *RunLock) validate() error {
+	if lock != nil && lock.File == "" && !lock.Storage {
+		return fmt.Errorf("%w: file or storage is required", ErrInvalidRunLock)
+	}
+
+	return nil
+}
+
+// key will return the key of the advisory locks of the configuration.
+func (lock *RunLock) key(cfg *Config) string {
+	if lock.Key != "" {
+		return lock.Key
+	}
+
+	return "gidari:" + cfg.RawURL
+}
+
+// acquire will take the run lock of the configuration, returning the function that releases it. Nothing is locked if
+// the run lock is not configured.
+func (lock *RunLock) acquire(ctx context.Context, cfg *Config) (func(), error) {
+	var releases []func() error
+
+	release := func() { releaseLocks(cfg, releases) }
+
+	if lock == nil {
+		return release, nil
+	}
+
+	if lock.File != "" {
+		unlock, err := lockFile(lock.File)
+		if errors.Is(err, errFileLocked) {
+			return nil, fmt.Errorf("%w: %q", ErrRunLocked, lock.File)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		releases = append(releases, unlock)
+	}
+
+	if lock.Storage {
+		storageReleases, err := lock.acquireStorages(ctx, cfg)
+		if err != nil {
+			release()
+
+			return nil, err
+		}
+
+		releases = append(releases, storageReleases...)
+	}
+
+	return release, nil
+}
+
+// acquireStorages will take the advisory lock of the configuration on every storage that supports them.
+func (lock *RunLock) acquireStorages(ctx context.Context, cfg *Config) ([]func() error, error) {
+	var releases []func() error
+
+	key := lock.key(cfg)
+
+	for _, dns := range cfg.ConnectionStrings {
+		resolved, err := resolveSecret(ctx, dns)
+		if err != nil {
+			releaseLocks(cfg, releases)
+
+			return nil, fmt.Errorf("unable to resolve connection string: %w", err)
+		}
+
+		repo, err := repository.New(ctx, resolved)
+		if err != nil {
+			releaseLocks(cfg, releases)
+
+			return nil, WrapRepositoryError(repository.FailedToCreateRepositoryError(err))
+		}
+
+		unlock, err := repo.TryLock(ctx, key)
+		if errors.Is(err, storage.ErrLockNotSupported) {
+			repo.Close()
+
+			continue
+		}
+
+		if err != nil {
+			repo.Close()
+			releaseLocks(cfg, releases)
+
+			if errors.Is(err, storage.ErrLocked) {
+				return nil, fmt.Errorf("%w: %q on %s", ErrRunLocked, key, storage.Scheme(repo.Type()))
+			}
+
+			return nil, err
+		}
+
+		releases = append(releases, func() error {
+			defer repo.Close()
+
+			return unlock()
+		})
+	}
+
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("%w: none of the storages support advisory locks", ErrInvalidRunLock)
+	}
+
+	return releases, nil
+}
+
+// releaseLocks will release the locks in the reverse order they were taken, logging the errors.
+func releaseLocks(cfg *Config, releases []func() error) {
+	for idx := len(releases) - 1; idx >= 0; idx-- {
+		if err := releases[idx](); err != nil {
+			tools.LogEvent{Msg: "unable to release run lock", Err: err}.Log(cfg.Logger, logrus.ErrorLevel)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile will take an exclusive lock on the file, or return errFileLocked if another process holds it. The lock is
+// released by the operating system if the process exits without releasing it.
+func lockFile(name string) (func() error, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, lockFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errFileLocked
+		}
+
+		return nil, fmt.Errorf("unable to lock file: %w", err)
+	}
+
+	return func() error {
+		defer file.Close()
+
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_UN); err != nil {
+			return fmt.Errorf("unable to unlock file: %w", err)
+		}
+
+		return nil
+	}, nil
+}
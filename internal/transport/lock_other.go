@@ -0,0 +1,45 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// lockFile will create the file exclusively, or return errFileLocked if it exists. The file is removed when the lock
+// is released, so a process that exits without releasing the lock leaves a stale lock file that must be removed.
+func lockFile(name string) (func() error, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_RDWR, lockFileMode)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, errFileLocked
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create lock file: %w", err)
+	}
+
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("unable to write lock file: %w", err)
+	}
+
+	return func() error {
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("unable to remove lock file: %w", err)
+		}
+
+		return nil
+	}, nil
+}
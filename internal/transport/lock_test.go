@@ -0,0 +1,85 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRunLock(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		if err := (&RunLock{Key: "run"}).validate(); !errors.Is(err, ErrInvalidRunLock) {
+			t.Fatalf("expected error %v, got %v", ErrInvalidRunLock, err)
+		}
+
+		for _, lock := range []*RunLock{nil, {File: "gidari.lock"}, {Storage: true}} {
+			if err := lock.validate(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	})
+
+	t.Run("key", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := &Config{RawURL: "https://api.test.com"}
+
+		if key := (&RunLock{}).key(cfg); key != "gidari:https://api.test.com" {
+			t.Fatalf("unexpected default key %q", key)
+		}
+
+		if key := (&RunLock{Key: "candles"}).key(cfg); key != "candles" {
+			t.Fatalf("unexpected key %q", key)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := &Config{Logger: logrus.New()}
+		lock := &RunLock{File: filepath.Join(t.TempDir(), "gidari.lock")}
+
+		release, err := lock.acquire(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("failed to acquire lock: %v", err)
+		}
+
+		if _, err := lock.acquire(context.Background(), cfg); !errors.Is(err, ErrRunLocked) {
+			t.Fatalf("expected error %v, got %v", ErrRunLocked, err)
+		}
+
+		release()
+
+		release, err = lock.acquire(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("failed to acquire released lock: %v", err)
+		}
+
+		release()
+	})
+
+	t.Run("no lock", func(t *testing.T) {
+		t.Parallel()
+
+		release, err := (*RunLock)(nil).acquire(context.Background(), &Config{Logger: logrus.New()})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		release()
+	})
+}
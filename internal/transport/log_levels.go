@@ -0,0 +1,90 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The subsystems of the logs, which can have log levels of their own.
+const (
+	// logWeb are the logs of the web requests, e.g. each completed request, retries, and quiet hours.
+	logWeb = "web"
+
+	// logRepository are the logs of the storage operations, e.g. each upsert and the repositories that are opened.
+	logRepository = "repository"
+
+	// logPlanner are the logs of the planning of an operation, e.g. the number of requests and their duration.
+	logPlanner = "planner"
+
+	// logAuth are the logs of the authentication of the web clients.
+	logAuth = "auth"
+)
+
+// logSubsystems are the subsystems that can have log levels.
+var logSubsystems = map[string]bool{logWeb: true, logRepository: true, logPlanner: true, logAuth: true}
+
+// ErrInvalidLogLevel is returned when a log level of the configuration is invalid.
+var ErrInvalidLogLevel = fmt.Errorf("invalid log level")
+
+// InvalidLogLevelError wraps an error with ErrInvalidLogLevel.
+func InvalidLogLevelError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidLogLevel, msg)
+}
+
+// validateLogLevels will ensure that the log levels are for known subsystems and are logrus levels.
+func validateLogLevels(levels map[string]string) error {
+	for subsystem, level := range levels {
+		if !logSubsystems[subsystem] {
+			known := make([]string, 0, len(logSubsystems))
+			for name := range logSubsystems {
+				known = append(known, name)
+			}
+
+			sort.Strings(known)
+
+			return InvalidLogLevelError(fmt.Sprintf("unknown subsystem %q, expected one of %s", subsystem,
+				strings.Join(known, ", ")))
+		}
+
+		if _, err := logrus.ParseLevel(level); err != nil {
+			return InvalidLogLevelError(fmt.Sprintf("%q for subsystem %q", level, subsystem))
+		}
+	}
+
+	return nil
+}
+
+// logger will return the logger of a subsystem: the logger of the configuration, with the level of the subsystem if
+// it has one. The logger of a subsystem writes to the output of the logger of the configuration with its formatter
+// and hooks, as they are when the logger is returned.
+func (cfg *Config) logger(subsystem string) *logrus.Logger {
+	raw, ok := cfg.LogLevels[subsystem]
+	if !ok {
+		return cfg.Logger
+	}
+
+	level, err := logrus.ParseLevel(raw)
+	if err != nil {
+		return cfg.Logger
+	}
+
+	return &logrus.Logger{
+		Out:          cfg.Logger.Out,
+		Hooks:        cfg.Logger.Hooks,
+		Formatter:    cfg.Logger.Formatter,
+		ReportCaller: cfg.Logger.ReportCaller,
+		Level:        level,
+		ExitFunc:     cfg.Logger.ExitFunc,
+		BufferPool:   cfg.Logger.BufferPool,
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestValidateLogLevels(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		levels map[string]string
+		err    error
+	}{
+		{"empty", nil, nil},
+		{"valid", map[string]string{"web": "warn", "repository": "debug", "planner": "error", "auth": "trace"}, nil},
+		{"unknown subsystem", map[string]string{"storage": "warn"}, ErrInvalidLogLevel},
+		{"unknown level", map[string]string{"web": "loud"}, ErrInvalidLogLevel},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := validateLogLevels(tcase.levels); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+		})
+	}
+}
+
+func TestConfigLogger(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+
+	cfg := &Config{Logger: logrus.New(), LogLevels: map[string]string{logWeb: "warn", logAuth: "debug"}}
+	cfg.Logger.SetOutput(&out)
+	cfg.Logger.SetLevel(logrus.InfoLevel)
+
+	if cfg.logger(logRepository) != cfg.Logger {
+		t.Fatal("expected a subsystem without a level to use the logger of the configuration")
+	}
+
+	cfg.logger(logWeb).Info("web request completed")
+	cfg.logger(logWeb).Warn("web request retried")
+	cfg.logger(logAuth).Debug("created web client")
+	cfg.logger(logRepository).Debug("upserted records")
+
+	logs := out.String()
+	for _, expected := range []string{"web request retried", "created web client"} {
+		if !strings.Contains(logs, expected) {
+			t.Fatalf("expected the logs to contain %q: %s", expected, logs)
+		}
+	}
+
+	for _, unexpected := range []string{"web request completed", "upserted records"} {
+		if strings.Contains(logs, unexpected) {
+			t.Fatalf("expected the logs not to contain %q: %s", unexpected, logs)
+		}
+	}
+}
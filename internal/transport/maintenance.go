@@ -0,0 +1,166 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaintenanceMaxWait is the default maximum time that a request waits for the web API to come back from
+// maintenance.
+const defaultMaintenanceMaxWait = time.Hour
+
+// ErrInvalidMaintenance is returned when the maintenance configuration is invalid.
+var ErrInvalidMaintenance = fmt.Errorf("invalid maintenance")
+
+// InvalidMaintenanceError wraps an error with ErrInvalidMaintenance.
+func InvalidMaintenanceError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidMaintenance, msg)
+}
+
+// MaintenanceWindow is an announced window of downtime of the web API.
+type MaintenanceWindow struct {
+	// Start and End are the RFC 3339 times the window starts and ends, e.g. "2022-06-01T02:00:00Z".
+	Start time.Time `yaml:"start"`
+	End   time.Time `yaml:"end"`
+}
+
+// Maintenance configures how a run waits out the downtime of the web API, rather than failing. Requests are paused
+// during the announced maintenance windows, and requests that fail with a 503 response are made again after the
+// "Retry-After" delay of the response or, if the response has none, after the delays of the backoff schedule.
+type Maintenance struct {
+	// Windows are the announced maintenance windows. Requests are paused until the window ends.
+	Windows []*MaintenanceWindow `yaml:"windows"`
+
+	// Backoff are the delays between the attempts of a request that fails with a 503 response without a
+	// "Retry-After" header, e.g. ["1m", "5m", "15m"]. The last delay is repeated until the max wait is exceeded. If
+	// no delays are set, those responses are not retried.
+	Backoff []time.Duration `yaml:"backoff"`
+
+	// MaxWait is the maximum time that a request waits for 503 responses to end before it fails, the default is one
+	// hour.
+	MaxWait time.Duration `yaml:"maxWait"`
+}
+
+func (maintenance *Maintenance) validate() error {
+	if maintenance == nil {
+		return nil
+	}
+
+	for _, window := range maintenance.Windows {
+		if window.Start.IsZero() || window.End.IsZero() {
+			return InvalidMaintenanceError("windows must have a start and an end")
+		}
+
+		if !window.End.After(window.Start) {
+			return InvalidMaintenanceError(fmt.Sprintf("window ending at %v does not end after its start", window.End))
+		}
+	}
+
+	for _, delay := range maintenance.Backoff {
+		if delay <= 0 {
+			return InvalidMaintenanceError("backoff delays must be positive")
+		}
+	}
+
+	if maintenance.MaxWait < 0 {
+		return InvalidMaintenanceError("maxWait is negative")
+	}
+
+	return nil
+}
+
+func (maintenance *Maintenance) maxWait() time.Duration {
+	if maintenance.MaxWait == 0 {
+		return defaultMaintenanceMaxWait
+	}
+
+	return maintenance.MaxWait
+}
+
+// active will return the latest end of the maintenance windows that the time is in.
+func (maintenance *Maintenance) active(now time.Time) (time.Time, bool) {
+	if maintenance == nil {
+		return time.Time{}, false
+	}
+
+	var end time.Time
+
+	for _, window := range maintenance.Windows {
+		if !now.Before(window.Start) && now.Before(window.End) && window.End.After(end) {
+			end = window.End
+		}
+	}
+
+	return end, !end.IsZero()
+}
+
+// handles will return true if the error is a 503 response that is retried with the maintenance configuration.
+func (maintenance *Maintenance) handles(err error) bool {
+	if maintenance == nil {
+		return false
+	}
+
+	var rspErr *web.ResponseError
+
+	return errors.As(err, &rspErr) && rspErr.StatusCode == http.StatusServiceUnavailable
+}
+
+// backoff will return the delay before the next attempt of a request that failed with a 503 response, given the
+// number of previous 503 responses and the time of the first response. The second value is false if the request
+// should fail.
+func (maintenance *Maintenance) backoff(err error, unavailable int, since, now time.Time) (time.Duration, bool) {
+	delay, ok := retryAfter(err, now)
+	if !ok {
+		if len(maintenance.Backoff) == 0 {
+			return 0, false
+		}
+
+		idx := unavailable
+		if idx >= len(maintenance.Backoff) {
+			idx = len(maintenance.Backoff) - 1
+		}
+
+		delay = maintenance.Backoff[idx]
+	}
+
+	if now.Add(delay).Sub(since) > maintenance.maxWait() {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// waitMaintenance will block while the current time is in a maintenance window.
+func waitMaintenance(ctx context.Context, maintenance *Maintenance, logger *logrus.Logger) error {
+	for {
+		now := time.Now()
+
+		end, ok := maintenance.active(now)
+		if !ok {
+			return nil
+		}
+
+		logInfo := tools.LogEvent{Msg: "maintenance window: requests paused", Until: end}
+		logInfo.Log(logger, logrus.InfoLevel)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("unable to wait for maintenance window: %w", ctx.Err())
+		case <-time.After(end.Sub(now)):
+		}
+	}
+}
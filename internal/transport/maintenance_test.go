@@ -0,0 +1,199 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2022, 6, 1, 2, 0, 0, 0, time.UTC)
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name        string
+			maintenance *Maintenance
+			err         error
+		}{
+			{"nil", nil, nil},
+			{"valid", &Maintenance{
+				Windows: []*MaintenanceWindow{{Start: start, End: start.Add(time.Hour)}},
+				Backoff: []time.Duration{time.Minute},
+			}, nil},
+			{"no end", &Maintenance{Windows: []*MaintenanceWindow{{Start: start}}}, ErrInvalidMaintenance},
+			{"end before start", &Maintenance{
+				Windows: []*MaintenanceWindow{{Start: start, End: start.Add(-time.Hour)}},
+			}, ErrInvalidMaintenance},
+			{"zero backoff", &Maintenance{Backoff: []time.Duration{0}}, ErrInvalidMaintenance},
+			{"negative max wait", &Maintenance{MaxWait: -time.Second}, ErrInvalidMaintenance},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.maintenance.validate(); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("decode", func(t *testing.T) {
+		t.Parallel()
+
+		var maintenance Maintenance
+
+		err := yaml.Unmarshal([]byte(`
+windows:
+  - start: 2022-06-01T02:00:00Z
+    end: 2022-06-01T03:00:00Z
+backoff: [1m, 5m]
+maxWait: 2h
+`), &maintenance)
+		if err != nil {
+			t.Fatalf("error decoding maintenance: %v", err)
+		}
+
+		if !maintenance.Windows[0].Start.Equal(start) || !maintenance.Windows[0].End.Equal(start.Add(time.Hour)) {
+			t.Fatalf("unexpected window %+v", maintenance.Windows[0])
+		}
+
+		if len(maintenance.Backoff) != 2 || maintenance.Backoff[1] != 5*time.Minute || maintenance.MaxWait != 2*time.Hour {
+			t.Fatalf("unexpected backoff %v and max wait %v", maintenance.Backoff, maintenance.MaxWait)
+		}
+	})
+
+	t.Run("active", func(t *testing.T) {
+		t.Parallel()
+
+		maintenance := &Maintenance{Windows: []*MaintenanceWindow{
+			{Start: start, End: start.Add(time.Hour)},
+			{Start: start.Add(30 * time.Minute), End: start.Add(2 * time.Hour)},
+		}}
+
+		for _, tcase := range []struct {
+			now    time.Time
+			end    time.Time
+			active bool
+		}{
+			{start.Add(-time.Minute), time.Time{}, false},
+			{start, start.Add(time.Hour), true},
+			{start.Add(45 * time.Minute), start.Add(2 * time.Hour), true},
+			{start.Add(2 * time.Hour), time.Time{}, false},
+		} {
+			end, active := maintenance.active(tcase.now)
+			if !end.Equal(tcase.end) || active != tcase.active {
+				t.Fatalf("expected (%v, %v) at %v, got (%v, %v)", tcase.end, tcase.active, tcase.now, end, active)
+			}
+		}
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		t.Parallel()
+
+		maintenance := &Maintenance{Backoff: []time.Duration{time.Minute, 5 * time.Minute}, MaxWait: 20 * time.Minute}
+		unavailable := &web.ResponseError{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+		retryAfter := &web.ResponseError{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Retry-After": {"600"}},
+		}
+
+		for _, tcase := range []struct {
+			name        string
+			err         error
+			unavailable int
+			elapsed     time.Duration
+			delay       time.Duration
+			ok          bool
+		}{
+			{"first", unavailable, 0, 0, time.Minute, true},
+			{"second", unavailable, 1, time.Minute, 5 * time.Minute, true},
+			{"repeated", unavailable, 4, 10 * time.Minute, 5 * time.Minute, true},
+			{"retry after", retryAfter, 0, 0, 10 * time.Minute, true},
+			{"max wait", unavailable, 5, 16 * time.Minute, 0, false},
+		} {
+			delay, ok := maintenance.backoff(tcase.err, tcase.unavailable, start, start.Add(tcase.elapsed))
+			if delay != tcase.delay || ok != tcase.ok {
+				t.Fatalf("expected %s backoff (%v, %v), got (%v, %v)", tcase.name, tcase.delay, tcase.ok, delay, ok)
+			}
+		}
+
+		if _, ok := (&Maintenance{}).backoff(unavailable, 0, start, start); ok {
+			t.Fatal("expected no backoff without a schedule")
+		}
+
+		if (*Maintenance)(nil).handles(unavailable) {
+			t.Fatal("expected 503 responses not to be handled without a maintenance configuration")
+		}
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) <= 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			fmt.Fprint(w, `[]`)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		rurl, _ := url.Parse(server.URL)
+		job := &webJob{
+			flattenedRequest: &flattenedRequest{
+				fetchConfig: &web.FetchConfig{
+					C:           client,
+					Method:      http.MethodGet,
+					URL:         rurl,
+					RateLimiter: rate.NewLimiter(rate.Every(time.Millisecond), 1),
+				},
+			},
+			logger:      logrus.New(),
+			maintenance: &Maintenance{Backoff: []time.Duration{time.Millisecond}},
+		}
+
+		rsp, err := fetchThrottled(context.Background(), job)
+		if err != nil {
+			t.Fatalf("expected the request to succeed after maintenance, got %v", err)
+		}
+
+		rsp.Body.Close()
+
+		if got := atomic.LoadInt32(&calls); got != 4 {
+			t.Fatalf("expected 4 calls, got %d", got)
+		}
+	})
+}
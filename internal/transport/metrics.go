@@ -0,0 +1,135 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// The keys of the metrics of a table.
+const (
+	metricRequests = "requests"
+	metricRows     = "rows"
+	metricBytes    = "bytes"
+	metricErrors   = "errors"
+
+	metricLimitsExceeded = "limitsExceeded"
+	metricNotModified    = "notModified"
+)
+
+// The keys of the timings of the workers.
+const (
+	metricRateLimiter = "rateLimiter"
+	metricNetwork     = "network"
+	metricStorage     = "storage"
+)
+
+// metrics are the live counters of the upsert operations of the process, published with expvar as "gidari". They are
+// served on "/debug/vars" by any HTTP server using http.DefaultServeMux, e.g. to inspect a long-running process
+// without a metrics system.
+var metrics = newPipelineMetrics(expvar.NewMap("gidari"))
+
+// pipelineMetrics are the counters of the upsert pipeline. Table counters are summed over every operation, and the
+// queue depths are those of the most recent event.
+type pipelineMetrics struct {
+	mutex  sync.Mutex
+	tables *expvar.Map
+
+	webQueue        *expvar.Int
+	repositoryQueue *expvar.Int
+
+	// timings are the seconds that the workers spent waiting on the rate limiter, on the network, and on storage.
+	timings *expvar.Map
+}
+
+func newPipelineMetrics(root *expvar.Map) *pipelineMetrics {
+	pm := &pipelineMetrics{
+		tables:          new(expvar.Map).Init(),
+		webQueue:        new(expvar.Int),
+		repositoryQueue: new(expvar.Int),
+		timings:         new(expvar.Map).Init(),
+	}
+
+	for _, key := range []string{metricRateLimiter, metricNetwork, metricStorage} {
+		pm.timings.AddFloat(key, 0)
+	}
+
+	root.Set("tables", pm.tables)
+	root.Set("webQueue", pm.webQueue)
+	root.Set("repositoryQueue", pm.repositoryQueue)
+	root.Set("timings", pm.timings)
+
+	return pm
+}
+
+// table will return the counters of the table, creating them if they do not exist.
+func (pm *pipelineMetrics) table(name string) *expvar.Map {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	if counters, ok := pm.tables.Get(name).(*expvar.Map); ok {
+		return counters
+	}
+
+	counters := new(expvar.Map).Init()
+	keys := []string{metricRequests, metricRows, metricBytes, metricErrors, metricLimitsExceeded, metricNotModified}
+	for _, key := range keys {
+		counters.Add(key, 0)
+	}
+
+	pm.tables.Set(name, counters)
+
+	return counters
+}
+
+// addTimings will add the durations to the timings of the workers.
+func (pm *pipelineMetrics) addTimings(rateLimiter, network, storage time.Duration) {
+	if pm == nil {
+		return
+	}
+
+	for key, d := range map[string]time.Duration{
+		metricRateLimiter: rateLimiter,
+		metricNetwork:     network,
+		metricStorage:     storage,
+	} {
+		if d > 0 {
+			pm.timings.AddFloat(key, d.Seconds())
+		}
+	}
+}
+
+// observe will update the counters with a progress event.
+func (pm *pipelineMetrics) observe(event *ProgressEvent) {
+	if pm == nil {
+		return
+	}
+
+	switch event.Type {
+	case ProgressPlanned:
+		pm.table(event.Table)
+	case ProgressRequestCompleted:
+		pm.table(event.Table).Add(metricRequests, 1)
+		pm.webQueue.Set(int64(event.WebQueue))
+		pm.repositoryQueue.Set(int64(event.RepositoryQueue))
+	case ProgressRequestFailed:
+		pm.table(event.Table).Add(metricErrors, 1)
+	case ProgressUpserted:
+		counters := pm.table(event.Table)
+		counters.Add(metricRows, event.Records)
+		counters.Add(metricBytes, event.Bytes)
+		counters.Add(metricErrors, event.RecordErrors)
+		pm.repositoryQueue.Set(int64(event.RepositoryQueue))
+	case ProgressLimitExceeded:
+		pm.table(event.Table).Add(metricLimitsExceeded, 1)
+	case ProgressNotModified:
+		pm.table(event.Table).Add(metricNotModified, 1)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"reflect"
+	"testing"
+)
+
+func TestPipelineMetrics(t *testing.T) {
+	t.Parallel()
+
+	root := new(expvar.Map).Init()
+	prog := &progress{metrics: newPipelineMetrics(root)}
+
+	for _, event := range []*ProgressEvent{
+		{Type: ProgressPlanned, Table: "candles", Requests: 2},
+		{Type: ProgressPlanned, Table: "trades", Requests: 1},
+		{Type: ProgressRequestCompleted, Table: "candles", WebQueue: 1, RepositoryQueue: 3},
+		{Type: ProgressRequestFailed, Table: "trades", Err: errors.New("failed")},
+		{Type: ProgressUpserted, Table: "candles", Records: 10, RecordErrors: 1, Bytes: 512, RepositoryQueue: 2},
+		{Type: ProgressRequestCompleted, Table: "candles", WebQueue: 0, RepositoryQueue: 1},
+		{Type: ProgressUpserted, Table: "candles", Records: 5, Bytes: 256, RepositoryQueue: 0},
+		{Type: ProgressLimitExceeded, Table: "candles"},
+		{Type: ProgressNotModified, Table: "trades"},
+	} {
+		prog.send(event)
+	}
+
+	var decoded struct {
+		Tables          map[string]map[string]int64 `json:"tables"`
+		WebQueue        int64                       `json:"webQueue"`
+		RepositoryQueue int64                       `json:"repositoryQueue"`
+	}
+
+	if err := json.Unmarshal([]byte(root.String()), &decoded); err != nil {
+		t.Fatalf("error decoding metrics: %v", err)
+	}
+
+	expected := map[string]map[string]int64{
+		"candles": {"requests": 2, "rows": 15, "bytes": 768, "errors": 1, "limitsExceeded": 1, "notModified": 0},
+		"trades":  {"requests": 0, "rows": 0, "bytes": 0, "errors": 1, "limitsExceeded": 0, "notModified": 1},
+	}
+
+	if !reflect.DeepEqual(decoded.Tables, expected) {
+		t.Fatalf("expected table metrics %v, got %v", expected, decoded.Tables)
+	}
+
+	if decoded.WebQueue != 0 || decoded.RepositoryQueue != 0 {
+		t.Fatalf("expected empty queues, got web %d and repository %d", decoded.WebQueue, decoded.RepositoryQueue)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The types of normalizers.
+const (
+	// NormalizeLocale converts numbers formatted for a locale, e.g. "1.234,56" for "de", into numbers.
+	NormalizeLocale = "locale"
+
+	// NormalizePercent converts percent strings into fractions, e.g. "12,5 %" is 0.125.
+	NormalizePercent = "percent"
+
+	// NormalizeUnits converts numbers with a unit suffix into numbers, e.g. "1.2k" is 1200.
+	NormalizeUnits = "units"
+)
+
+// percentDivisor converts a percentage into a fraction.
+const percentDivisor = 100
+
+var (
+	// ErrInvalidNormalizer is returned when a normalizer in the configuration is invalid.
+	ErrInvalidNormalizer = fmt.Errorf("invalid normalizer")
+
+	// ErrNormalize is returned when a field value can not be normalized.
+	ErrNormalize = fmt.Errorf("unable to normalize")
+)
+
+// InvalidNormalizerError wraps an error with ErrInvalidNormalizer.
+func InvalidNormalizerError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidNormalizer, msg)
+}
+
+// NormalizeError wraps an error with ErrNormalize.
+func NormalizeError(table, field string, val interface{}) error {
+	return fmt.Errorf("%w: field %q of table %q: %q", ErrNormalize, field, table, val)
+}
+
+// defaultUnits are the multipliers of the unit suffixes of the "units" normalizer if none are configured. Suffixes
+// are case insensitive.
+var defaultUnits = map[string]float64{"k": 1e3, "m": 1e6, "b": 1e9, "t": 1e12}
+
+// commaDecimalLanguages are the languages whose locales use a comma as the decimal separator.
+var commaDecimalLanguages = map[string]bool{
+	"bg": true, "cs": true, "da": true, "de": true, "el": true, "es": true, "et": true, "fi": true, "fr": true,
+	"hr": true, "hu": true, "id": true, "it": true, "lt": true, "lv": true, "nb": true, "nl": true, "no": true,
+	"pl": true, "pt": true, "ro": true, "ru": true, "sk": true, "sl": true, "sr": true, "sv": true, "tr": true,
+	"uk": true, "vi": true,
+}
+
+// Normalizer converts the string values of fields of messy web APIs into numbers before they are upserted, e.g. so
+// that "1.234,56", "12%", and "1.2k" can be stored in numeric columns. Values that are already numbers or null are
+// not changed, and strings that can not be converted fail the upsert.
+type Normalizer struct {
+	// Fields are the names of the fields of the records to normalize.
+	Fields []string `yaml:"fields"`
+
+	// Table restricts the normalizer to the records of a table, e.g. one of the split tables of the request. The
+	// default is every table of the request.
+	Table string `yaml:"table"`
+
+	// Type is the type of the normalizer: "locale", "percent", or "units".
+	Type string `yaml:"type"`
+
+	// Locale is the locale of the numbers, e.g. "de-DE", which decides if the decimal separator is a comma or a
+	// period. Group separators are removed. The default is "en", with a period decimal separator.
+	Locale string `yaml:"locale"`
+
+	// Units are the multipliers of the unit suffixes for the "units" type, e.g. {"k": 1000}. The default is "k", "m",
+	// "b", and "t" for thousands, millions, billions, and trillions.
+	Units map[string]float64 `yaml:"units"`
+}
+
+// validate will ensure that the normalizer is well defined.
+func (norm *Normalizer) validate() error {
+	switch norm.Type {
+	case NormalizeLocale, NormalizePercent, NormalizeUnits:
+	default:
+		return InvalidNormalizerError(fmt.Sprintf("unknown type %q", norm.Type))
+	}
+
+	if len(norm.Fields) == 0 {
+		return InvalidNormalizerError("no fields")
+	}
+
+	for suffix := range norm.Units {
+		if suffix == "" || strings.IndexFunc(suffix, unicode.IsDigit) >= 0 {
+			return InvalidNormalizerError(fmt.Sprintf("invalid unit suffix %q", suffix))
+		}
+	}
+
+	return nil
+}
+
+// decimalSeparator will return the decimal separator of the locale of the normalizer.
+func (norm *Normalizer) decimalSeparator() rune {
+	language := norm.Locale
+	if idx := strings.IndexAny(language, "-_"); idx >= 0 {
+		language = language[:idx]
+	}
+
+	if commaDecimalLanguages[strings.ToLower(language)] {
+		return ','
+	}
+
+	return '.'
+}
+
+// parseNumber will parse a number formatted with the decimal separator, removing group separators and spaces.
+func parseNumber(str string, decimal rune) (float64, error) {
+	var bldr strings.Builder
+
+	for _, char := range str {
+		switch {
+		case char == decimal:
+			bldr.WriteRune('.')
+		case char == '.' || char == ',' || char == '\'' || unicode.IsSpace(char):
+			// Group separators, including non-breaking spaces.
+		default:
+			bldr.WriteRune(char)
+		}
+	}
+
+	num, err := strconv.ParseFloat(bldr.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse number: %w", err)
+	}
+
+	return num, nil
+}
+
+// convert will convert the string into a number.
+func (norm *Normalizer) convert(str string) (float64, error) {
+	str = strings.TrimSpace(str)
+	decimal := norm.decimalSeparator()
+
+	switch norm.Type {
+	case NormalizePercent:
+		num, err := parseNumber(strings.TrimSuffix(str, "%"), decimal)
+		if err != nil {
+			return 0, err
+		}
+
+		return num / percentDivisor, nil
+	case NormalizeUnits:
+		units := norm.Units
+		if units == nil {
+			units = defaultUnits
+		}
+
+		number := strings.TrimRightFunc(str, unicode.IsLetter)
+		suffix := strings.TrimSpace(str[len(number):])
+
+		multiplier := 1.0
+
+		if suffix != "" {
+			var ok bool
+			if multiplier, ok = units[suffix]; !ok {
+				if multiplier, ok = units[strings.ToLower(suffix)]; !ok {
+					return 0, fmt.Errorf("unknown unit suffix %q", suffix)
+				}
+			}
+		}
+
+		num, err := parseNumber(number, decimal)
+		if err != nil {
+			return 0, err
+		}
+
+		return num * multiplier, nil
+	default:
+		return parseNumber(str, decimal)
+	}
+}
+
+// normalize will convert the fields of the JSON encoded records of the table with the normalizers of the request. The
+// data can be a single JSON object or an array of JSON objects.
+func normalize(data []byte, table string, normalizers []*Normalizer) ([]byte, error) {
+	var applied []*Normalizer
+
+	for _, norm := range normalizers {
+		if norm.Table == "" || norm.Table == table {
+			applied = append(applied, norm)
+		}
+	}
+
+	if len(applied) == 0 {
+		return data, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("unable to decode records for table %q: %w", table, err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	for _, record := range records {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, norm := range applied {
+			for _, field := range norm.Fields {
+				str, ok := fields[field].(string)
+				if !ok {
+					continue
+				}
+
+				num, err := norm.convert(str)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", NormalizeError(table, field, str), err)
+				}
+
+				fields[field] = num
+			}
+		}
+	}
+
+	bytes, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode records for table %q: %w", table, err)
+	}
+
+	return bytes, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizerConvert(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		norm     *Normalizer
+		str      string
+		expected float64
+		err      bool
+	}{
+		{name: "en", norm: &Normalizer{Type: NormalizeLocale}, str: "1,234.56", expected: 1234.56},
+		{name: "de", norm: &Normalizer{Type: NormalizeLocale, Locale: "de-DE"}, str: "1.234,56", expected: 1234.56},
+		{name: "fr", norm: &Normalizer{Type: NormalizeLocale, Locale: "fr_FR"}, str: "-1 234,5", expected: -1234.5},
+		{name: "ch", norm: &Normalizer{Type: NormalizeLocale, Locale: "en-CH"}, str: "1'000", expected: 1000},
+		{name: "invalid", norm: &Normalizer{Type: NormalizeLocale}, str: "n/a", err: true},
+		{name: "percent", norm: &Normalizer{Type: NormalizePercent}, str: "12.5%", expected: 0.125},
+		{name: "percent de", norm: &Normalizer{Type: NormalizePercent, Locale: "de"}, str: "-3,5 %", expected: -0.035},
+		{name: "units", norm: &Normalizer{Type: NormalizeUnits}, str: "1.2k", expected: 1200},
+		{name: "units upper", norm: &Normalizer{Type: NormalizeUnits}, str: "3.5 M", expected: 3.5e6},
+		{name: "units none", norm: &Normalizer{Type: NormalizeUnits}, str: "42", expected: 42},
+		{
+			name:     "units custom",
+			norm:     &Normalizer{Type: NormalizeUnits, Units: map[string]float64{"KB": 1024}},
+			str:      "2KB",
+			expected: 2048,
+		},
+		{name: "units unknown", norm: &Normalizer{Type: NormalizeUnits}, str: "2x", err: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			num, err := tcase.norm.convert(tcase.str)
+			if tcase.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", num)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to convert %q: %v", tcase.str, err)
+			}
+
+			if num != tcase.expected {
+				t.Fatalf("expected %v, got %v", tcase.expected, num)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	normalizers := []*Normalizer{
+		{Type: NormalizeLocale, Locale: "de", Fields: []string{"price"}},
+		{Type: NormalizeUnits, Fields: []string{"volume"}, Table: "tickers"},
+	}
+
+	for _, norm := range normalizers {
+		if err := norm.validate(); err != nil {
+			t.Fatalf("expected a valid normalizer, got %v", err)
+		}
+	}
+
+	data := []byte(`[{"price": "1.234,5", "volume": "2k"}, {"price": 7, "volume": null}]`)
+
+	for _, tcase := range []struct {
+		table    string
+		expected []map[string]interface{}
+	}{
+		{
+			table: "tickers",
+			expected: []map[string]interface{}{
+				{"price": 1234.5, "volume": 2000.0},
+				{"price": 7.0, "volume": nil},
+			},
+		},
+		{
+			table: "trades",
+			expected: []map[string]interface{}{
+				{"price": 1234.5, "volume": "2k"},
+				{"price": 7.0, "volume": nil},
+			},
+		},
+	} {
+		normalized, err := normalize(data, tcase.table, normalizers)
+		if err != nil {
+			t.Fatalf("failed to normalize %q: %v", tcase.table, err)
+		}
+
+		var records []map[string]interface{}
+		if err := json.Unmarshal(normalized, &records); err != nil {
+			t.Fatalf("failed to decode records: %v", err)
+		}
+
+		if !reflect.DeepEqual(records, tcase.expected) {
+			t.Fatalf("expected %v, got %v", tcase.expected, records)
+		}
+	}
+
+	if _, err := normalize([]byte(`{"price": "-"}`), "tickers", normalizers); !errors.Is(err, ErrNormalize) {
+		t.Fatalf("expected error %v, got %v", ErrNormalize, err)
+	}
+
+	for _, norm := range []*Normalizer{
+		{Type: "currency", Fields: []string{"price"}},
+		{Type: NormalizePercent},
+		{Type: NormalizeUnits, Fields: []string{"volume"}, Units: map[string]float64{"1k": 1000}},
+	} {
+		if err := norm.validate(); !errors.Is(err, ErrInvalidNormalizer) {
+			t.Errorf("expected error %v, got %v", ErrInvalidNormalizer, err)
+		}
+	}
+}
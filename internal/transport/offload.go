@@ -0,0 +1,271 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+)
+
+const (
+	// defaultMaxRecordSize is the size of the largest record that is not offloaded, if the offload does not define
+	// one. It is below the 16 MiB limit of MongoDB documents, leaving room for the overhead of BSON.
+	defaultMaxRecordSize = 15 << 20
+
+	// defaultOffloadField is the default field of the pointer to the offloaded payload of a record.
+	defaultOffloadField = "gidariOffload"
+
+	// offloadScalarSize is the size of the largest scalar field that is kept on the pointer record of an offloaded
+	// record, so that its key and partition fields are still upserted.
+	offloadScalarSize = 1024
+
+	// offloadFileMode is the file mode of the payloads offloaded to a directory.
+	offloadFileMode = 0o600
+
+	// offloadDirMode is the file mode of the directories of the offloaded payloads.
+	offloadDirMode = 0o700
+)
+
+// ErrInvalidOffload is returned when the offload of the configuration is invalid.
+var ErrInvalidOffload = fmt.Errorf("invalid offload")
+
+// InvalidOffloadError wraps an error with ErrInvalidOffload.
+func InvalidOffloadError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidOffload, msg)
+}
+
+// ObjectStore stores the payloads of the records that are offloaded, e.g. a bucket of an object storage service.
+type ObjectStore interface {
+	// Put will store the payload under the key, returning the location of the payload, e.g. its URL. The keys are
+	// derived from the content of the payloads, so a payload that is put again can be skipped.
+	Put(ctx context.Context, key string, payload []byte) (string, error)
+}
+
+// Offload routes the records that exceed a size to an object store, instead of failing the batch, e.g. the records
+// exceeding the 16 MiB limit of MongoDB documents. The payload of such a record is stored in the object store, and a
+// pointer record is upserted in its place. The pointer record has the scalar fields of the record, so that its key
+// and partition fields are still upserted, and a field with the location, size, and SHA-256 of the payload.
+type Offload struct {
+	// MaxRecordSize is the size in bytes of the largest JSON encoded record that is upserted as it is. The default is
+	// 15 MiB.
+	MaxRecordSize int `yaml:"maxRecordSize"`
+
+	// Dir is the directory the payloads are stored in, e.g. the mount of an object storage bucket, in a directory per
+	// table. It is required unless there is a Store.
+	Dir string `yaml:"dir"`
+
+	// Field is the name of the field of the pointer to the payload on the pointer records, the default is
+	// "gidariOffload". Postgres tables need a JSON column for the field, which is added to the tables created from
+	// schemas.
+	Field string `yaml:"field"`
+
+	// Store is the object store of the payloads, e.g. an object storage client of a program using the library. It
+	// takes precedence over the directory.
+	Store ObjectStore `yaml:"-"`
+}
+
+// validate will ensure that the offload is valid.
+func (offload *Offload) validate() error {
+	if offload == nil {
+		return nil
+	}
+
+	if offload.Dir == "" && offload.Store == nil {
+		return InvalidOffloadError("dir is required")
+	}
+
+	if offload.MaxRecordSize < 0 {
+		return InvalidOffloadError("maxRecordSize must not be negative")
+	}
+
+	return nil
+}
+
+// field will return the name of the field of the pointer to the payload.
+func (offload *Offload) field() string {
+	if offload.Field == "" {
+		return defaultOffloadField
+	}
+
+	return offload.Field
+}
+
+// maxRecordSize will return the size of the largest record that is not offloaded.
+func (offload *Offload) maxRecordSize() int {
+	if offload.MaxRecordSize == 0 {
+		return defaultMaxRecordSize
+	}
+
+	return offload.MaxRecordSize
+}
+
+// store will return the object store of the payloads.
+func (offload *Offload) store() ObjectStore {
+	if offload.Store != nil {
+		return offload.Store
+	}
+
+	return &dirObjectStore{dir: offload.Dir}
+}
+
+// addColumn will add the column of the pointer to the request, if offload is configured and the table does not
+// already have the column.
+func (offload *Offload) addColumn(req *proto.CreateTableRequest) {
+	if offload == nil {
+		return
+	}
+
+	for _, column := range req.Columns {
+		if column.Name == offload.field() {
+			return
+		}
+	}
+
+	req.Columns = append(req.Columns, &proto.Column{Name: offload.field(), Type: storage.ColumnTypeJSON})
+}
+
+// offloadPointer is the pointer to the offloaded payload of a record.
+type offloadPointer struct {
+	Location string `json:"location"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// records will offload the records of the table that exceed the maximum size, returning the records with pointer
+// records in their place and the number of records that are offloaded. The data is returned as it is if no record is
+// offloaded.
+func (offload *Offload) records(ctx context.Context, data []byte, table string) ([]byte, int, error) {
+	if offload == nil || len(data) <= offload.maxRecordSize() {
+		return data, 0, nil
+	}
+
+	var records []json.RawMessage
+
+	single := false
+	if err := json.Unmarshal(data, &records); err != nil {
+		records, single = []json.RawMessage{data}, true
+	}
+
+	count := 0
+
+	for idx, record := range records {
+		if len(record) <= offload.maxRecordSize() {
+			continue
+		}
+
+		pointer, err := offload.record(ctx, record, table)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		records[idx] = pointer
+		count++
+	}
+
+	if count == 0 {
+		return data, 0, nil
+	}
+
+	if single {
+		return records[0], count, nil
+	}
+
+	encoded, err := json.Marshal(records)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to marshal offloaded records: %w", err)
+	}
+
+	return encoded, count, nil
+}
+
+// record will store the payload of the record in the object store, and return its pointer record.
+func (offload *Offload) record(ctx context.Context, record json.RawMessage, table string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return nil, fmt.Errorf("unable to offload record of table %q: record is not an object", table)
+	}
+
+	sum := sha256.Sum256(record)
+	digest := hex.EncodeToString(sum[:])
+
+	location, err := offload.store().Put(ctx, fmt.Sprintf("%s/%s.json", url.PathEscape(table), digest), record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to offload record of table %q: %w", table, err)
+	}
+
+	pointer := make(map[string]interface{}, len(fields)+1)
+
+	for name, value := range fields {
+		trimmed := bytes.TrimSpace(value)
+		if len(trimmed) > offloadScalarSize || bytes.HasPrefix(trimmed, []byte("{")) ||
+			bytes.HasPrefix(trimmed, []byte("[")) {
+			continue
+		}
+
+		pointer[name] = value
+	}
+
+	pointer[offload.field()] = &offloadPointer{Location: location, Size: len(record), SHA256: digest}
+
+	encoded, err := json.Marshal(pointer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal pointer record: %w", err)
+	}
+
+	return encoded, nil
+}
+
+// dirObjectStore is an object store on a directory.
+type dirObjectStore struct {
+	dir string
+}
+
+// Put will write the payload to the file of the key in the directory, unless the file exists.
+func (store *dirObjectStore) Put(_ context.Context, key string, payload []byte) (string, error) {
+	path, err := filepath.Abs(filepath.Join(store.dir, filepath.FromSlash(key)))
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve offload path: %w", err)
+	}
+
+	location := (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+
+	if _, err := os.Stat(path); err == nil {
+		return location, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("unable to stat offloaded payload: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), offloadDirMode); err != nil {
+		return "", fmt.Errorf("unable to create offload directory: %w", err)
+	}
+
+	// The payload is written to a temporary file that is renamed, so that a partially written payload is never at
+	// the path of its key.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, payload, offloadFileMode); err != nil {
+		return "", fmt.Errorf("unable to write offloaded payload: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("unable to write offloaded payload: %w", err)
+	}
+
+	return location, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+)
+
+// memoryObjectStore is an object store that holds the payloads in memory.
+type memoryObjectStore map[string][]byte
+
+func (store memoryObjectStore) Put(_ context.Context, key string, payload []byte) (string, error) {
+	store[key] = payload
+
+	return "mem://" + key, nil
+}
+
+func TestOffload(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			offload *Offload
+			err     error
+		}{
+			{nil, nil},
+			{&Offload{Dir: "offload"}, nil},
+			{&Offload{Store: memoryObjectStore{}}, nil},
+			{&Offload{}, ErrInvalidOffload},
+			{&Offload{Dir: "offload", MaxRecordSize: -1}, ErrInvalidOffload},
+		} {
+			if err := tcase.offload.validate(); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v for %+v, got %v", tcase.err, tcase.offload, err)
+			}
+		}
+	})
+
+	t.Run("dir", func(t *testing.T) {
+		t.Parallel()
+
+		offload := &Offload{Dir: t.TempDir(), MaxRecordSize: 64}
+		large := `{"id":2,"name":"beta","payload":{"blob":"` + strings.Repeat("x", 100) + `"}}`
+		data := []byte(`[{"id":1,"name":"alpha"},` + large + `]`)
+
+		offloaded, count, err := offload.records(context.Background(), data, "candles")
+		if err != nil {
+			t.Fatalf("error offloading records: %v", err)
+		}
+
+		if count != 1 {
+			t.Fatalf("expected 1 offloaded record, got %d", count)
+		}
+
+		var records []map[string]interface{}
+		if err := json.Unmarshal(offloaded, &records); err != nil {
+			t.Fatalf("error decoding records: %v", err)
+		}
+
+		if len(records) != 2 || records[0]["name"] != "alpha" || records[0][defaultOffloadField] != nil {
+			t.Fatalf("expected the small record to be upserted as it is: %v", records)
+		}
+
+		pointer, ok := records[1][defaultOffloadField].(map[string]interface{})
+		if !ok || records[1]["id"] != float64(2) || records[1]["name"] != "beta" || records[1]["payload"] != nil {
+			t.Fatalf("unexpected pointer record: %v", records[1])
+		}
+
+		location, err := url.Parse(pointer["location"].(string))
+		if err != nil {
+			t.Fatalf("error parsing location: %v", err)
+		}
+
+		payload, err := os.ReadFile(location.Path)
+		if err != nil {
+			t.Fatalf("error reading offloaded payload: %v", err)
+		}
+
+		if string(payload) != large || pointer["size"] != float64(len(large)) {
+			t.Fatalf("unexpected offloaded payload %s with pointer %v", payload, pointer)
+		}
+
+		// Offloading the same record again stores it at the same location.
+		again, _, err := offload.records(context.Background(), data, "candles")
+		if err != nil || string(again) != string(offloaded) {
+			t.Fatalf("expected the same pointer records, got %s (%v)", again, err)
+		}
+	})
+
+	t.Run("store", func(t *testing.T) {
+		t.Parallel()
+
+		store := memoryObjectStore{}
+		offload := &Offload{Store: store, MaxRecordSize: 16, Field: "blob"}
+
+		data, count, err := offload.records(context.Background(), []byte(`{"id":"BTC-USD","bids":[1,2,3,4]}`), "book")
+		if err != nil || count != 1 {
+			t.Fatalf("expected 1 offloaded record, got %d (%v)", count, err)
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			t.Fatalf("error decoding record: %v", err)
+		}
+
+		pointer, ok := record["blob"].(map[string]interface{})
+		if !ok || record["id"] != "BTC-USD" || len(store) != 1 {
+			t.Fatalf("unexpected pointer record %v", record)
+		}
+
+		if key := strings.TrimPrefix(pointer["location"].(string), "mem://"); store[key] == nil {
+			t.Fatalf("expected the payload at %q", key)
+		}
+
+		small := []byte(`[{"id":1}]`)
+		if data, count, err := offload.records(context.Background(), small, "book"); err != nil || count != 0 ||
+			string(data) != string(small) {
+			t.Fatalf("expected the records as they are, got %s (%d, %v)", data, count, err)
+		}
+	})
+
+	t.Run("add column", func(t *testing.T) {
+		t.Parallel()
+
+		req := &proto.CreateTableRequest{Table: "candles"}
+
+		(&Offload{Dir: "offload"}).addColumn(req)
+		(&Offload{Dir: "offload"}).addColumn(req)
+		(*Offload)(nil).addColumn(req)
+
+		if len(req.Columns) != 1 || req.Columns[0].Name != defaultOffloadField {
+			t.Fatalf("expected the offload column, got %v", req.Columns)
+		}
+	})
+}
@@ -0,0 +1,372 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+// ErrInvalidPagination is returned when the pagination of a request is invalid.
+var ErrInvalidPagination = fmt.Errorf("invalid pagination")
+
+// InvalidPaginationError wraps an error with ErrInvalidPagination.
+func InvalidPaginationError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidPagination, msg)
+}
+
+// Pagination pages through the records of an endpoint, so that every page does not need to be defined as its own
+// request. Offset pagination increments the offset query param by the page size until a page has no records, and
+// token pagination sets the token query param to the next page token of the response until the token is empty. The
+// records of every page are upserted together as the records of the request.
+type Pagination struct {
+	// OffsetName is the name of the offset query param of offset pagination, e.g. "offset".
+	OffsetName string `yaml:"offsetName" json:"offsetName,omitempty"`
+
+	// TokenName is the name of the query param of token pagination that the next page token is set to, e.g.
+	// "page_token".
+	TokenName string `yaml:"tokenName" json:"tokenName,omitempty"`
+
+	// TokenPath is the dot-separated path to the next page token in the response body of token pagination, e.g.
+	// "meta.next_page_token". If the path is not set, the next cursor of the envelope of the request is the token.
+	TokenPath string `yaml:"tokenPath" json:"tokenPath,omitempty"`
+
+	// LimitName is the name of the limit query param, e.g. "limit". If the name is empty, the limit is not sent and
+	// the web API must return pages of the page size.
+	LimitName string `yaml:"limitName" json:"limitName,omitempty"`
+
+	// PageSize is the number of records of each page, which is the increment of the offset. It is required for offset
+	// pagination.
+	PageSize int `yaml:"pageSize" json:"pageSize,omitempty"`
+
+	// Start is the offset of the first page of offset pagination, the default is 0.
+	Start int `yaml:"start" json:"start,omitempty"`
+
+	// MaxPages is the maximum number of pages to request, the default is no maximum.
+	MaxPages int `yaml:"maxPages" json:"maxPages,omitempty"`
+}
+
+// validate will ensure that the pagination of the request is well defined.
+func (pagination *Pagination) validate(envelope *Envelope) error {
+	if pagination == nil {
+		return nil
+	}
+
+	switch {
+	case pagination.OffsetName != "" && pagination.TokenName != "":
+		return InvalidPaginationError("offset and token names are exclusive")
+	case pagination.OffsetName != "":
+		if pagination.PageSize <= 0 {
+			return InvalidPaginationError(fmt.Sprintf("page size %d is not positive", pagination.PageSize))
+		}
+	case pagination.TokenName != "":
+		if pagination.TokenPath == "" && (envelope == nil || envelope.NextCursor == "") {
+			return InvalidPaginationError("no token path or envelope next cursor")
+		}
+	default:
+		return InvalidPaginationError("no offset or token name")
+	}
+
+	if pagination.Start < 0 || pagination.MaxPages < 0 || pagination.PageSize < 0 {
+		return InvalidPaginationError("start, page size, and max pages can not be negative")
+	}
+
+	return nil
+}
+
+// setQueryParam will set the query param in the encoded query, replacing any values it already has. The other params
+// are not re-encoded, so that literal separators in their values are kept.
+func setQueryParam(rawQuery, name, value string) string {
+	pairs := make([]string, 0, strings.Count(rawQuery, "&")+2)
+
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+
+		key := pair
+		if idx := strings.Index(pair, "="); idx >= 0 {
+			key = pair[:idx]
+		}
+
+		if unescaped, err := url.QueryUnescape(key); err == nil && unescaped == name {
+			continue
+		}
+
+		pairs = append(pairs, pair)
+	}
+
+	pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(value))
+
+	return strings.Join(pairs, "&")
+}
+
+// first will return a copy of the job that requests the first page. Token pagination decodes the next page token
+// with the envelope of the request, so the job of the first page and its following pages decode the token path as
+// the next cursor of the envelope.
+func (pagination *Pagination) first(job *webJob) *webJob {
+	if pagination.TokenPath != "" {
+		envelope := new(Envelope)
+		if job.envelope != nil {
+			*envelope = *job.envelope
+		}
+
+		envelope.NextCursor = pagination.TokenPath
+
+		req := *job.flattenedRequest
+		req.envelope = envelope
+
+		tokenJob := *job
+		tokenJob.flattenedRequest = &req
+		job = &tokenJob
+	}
+
+	if pagination.OffsetName != "" {
+		return pagination.page(job, pagination.OffsetName, strconv.Itoa(pagination.Start))
+	}
+
+	return pagination.page(job, "", "")
+}
+
+// next will return a copy of the job that requests the page after the current page, or nil if it was the last page.
+func (pagination *Pagination) next(job *webJob, pages int, records []json.RawMessage, page *Page) *webJob {
+	if pagination.MaxPages > 0 && pages >= pagination.MaxPages {
+		return nil
+	}
+
+	if pagination.OffsetName != "" {
+		if len(records) == 0 {
+			return nil
+		}
+
+		return pagination.page(job, pagination.OffsetName, strconv.Itoa(pagination.Start+pages*pagination.PageSize))
+	}
+
+	if page == nil || page.NextCursor == "" {
+		return nil
+	}
+
+	return pagination.page(job, pagination.TokenName, page.NextCursor)
+}
+
+// page will return a copy of the job that requests the page with the query param, along with the limit.
+func (pagination *Pagination) page(job *webJob, name, value string) *webJob {
+	rurl := *job.fetchConfig.URL
+
+	if name != "" {
+		rurl.RawQuery = setQueryParam(rurl.RawQuery, name, value)
+	}
+
+	if pagination.LimitName != "" && pagination.PageSize > 0 {
+		rurl.RawQuery = setQueryParam(rurl.RawQuery, pagination.LimitName, strconv.Itoa(pagination.PageSize))
+	}
+
+	return job.withURL(&rurl)
+}
+
+// withURL will return a copy of the job that requests the URL.
+func (job *webJob) withURL(rurl *url.URL) *webJob {
+	fetchConfig := *job.fetchConfig
+	fetchConfig.URL = rurl
+
+	req := *job.flattenedRequest
+	req.fetchConfig = &fetchConfig
+
+	page := *job
+	page.flattenedRequest = &req
+
+	return &page
+}
+
+// linkPattern matches the links of a "Link" header and their params, e.g. `<https://api.test.com?page=2>; rel="next"`.
+var linkPattern = regexp.MustCompile(`<([^>]*)>([^<]*)`)
+
+// nextLink will return the URL of the "next" link of an RFC 5988 "Link" header, e.g. of GitHub-style APIs, resolved
+// against the URL of the request. If the response does not have a next link, nil is returned.
+func nextLink(header http.Header, base *url.URL) *url.URL {
+	for _, value := range header.Values("Link") {
+		for _, match := range linkPattern.FindAllStringSubmatch(value, -1) {
+			// The params of a link end at the comma before the next link.
+			params := strings.TrimRight(strings.TrimSpace(match[2]), ", ")
+
+			for _, param := range strings.Split(params, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(val), `"`)) {
+					if !strings.EqualFold(rel, "next") {
+						continue
+					}
+
+					next, err := base.Parse(strings.TrimSpace(match[1]))
+					if err != nil {
+						return nil
+					}
+
+					return next
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// notRecordsError is returned when a page of a paginated request is not an array of records.
+func notRecordsError(pages int, job *webJob) error {
+	return fmt.Errorf("%w: page %d of %s is not an array of records", ErrInvalidPagination, pages,
+		job.fetchConfig.URL.Redacted())
+}
+
+// fetchPages will make the web request for the job, and the requests for the following pages if the request is
+// paginated. The following pages share the rate limiter of the request. If there is more than one page, the records
+// of the pages are returned as a single JSON array, along with the response of the first page and the pagination
+// metadata of the last page. If the request is not paginated and the response has an RFC 5988 "next" link, the page
+// it links to is a request of its own that follows the job.
+func fetchPages(ctx context.Context, job *webJob) (*web.FetchResponse, []byte, *Page, error) {
+	pagination := job.pagination
+
+	current := job
+	if pagination != nil {
+		current = pagination.first(job)
+	} else {
+		if job.cache.fresh(job.flattenedRequest) {
+			return nil, nil, nil, errNotModified
+		}
+
+		current = job.cache.conditional(job)
+	}
+
+	rsp, data, page, err := fetch(ctx, current)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if pagination != nil {
+		return followPages(ctx, job, current, rsp, data, page)
+	}
+
+	if link := nextLink(rsp.Header, rsp.Request.URL); link != nil {
+		if err := job.follow(current, link, data); err != nil {
+			return nil, nil, nil, err
+		}
+
+		return rsp, data, page, nil
+	}
+
+	job.store(rsp)
+
+	return rsp, data, page, nil
+}
+
+// follow will make the page that the response of the job links to the next request of the job, so that the pages are
+// requests of their own, which are retried, upserted, and reported on one at a time. The records of a page that links
+// to a next page must be an array. A link to a page of the request that was already requested is not followed, so
+// that a cycle of links ends.
+func (job *webJob) follow(current *webJob, link *url.URL, records []byte) error {
+	if job.linked == nil {
+		job.linked = map[string]bool{job.fetchConfig.URL.String(): true}
+	}
+
+	var pageRecords []json.RawMessage
+	if err := json.Unmarshal(records, &pageRecords); err != nil {
+		return notRecordsError(len(job.linked), current)
+	}
+
+	if job.linked[link.String()] {
+		return nil
+	}
+
+	job.linked[link.String()] = true
+	job.next = append(job.next, job.withURL(link).flattenedRequest)
+
+	return nil
+}
+
+// store will store the validators of the response of the job in the cache. Only the validators of single pages are
+// cached, since a page that is not modified does not mean that the pages that follow it are not, so the responses of
+// the pages of links are not cached.
+func (job *webJob) store(rsp *web.FetchResponse) {
+	if job.linked == nil {
+		job.cache.store(job.flattenedRequest, rsp)
+	}
+}
+
+// followPages will make the requests for the pages that follow the first page of the paginated job, whose response is
+// decoded into data and page, like fetchPages.
+func followPages(ctx context.Context, job, current *webJob, rsp *web.FetchResponse, data []byte,
+	page *Page,
+) (*web.FetchResponse, []byte, *Page, error) {
+	pagination := job.pagination
+
+	var (
+		first *web.FetchResponse
+		last  *Page
+	)
+
+	records := make([]json.RawMessage, 0)
+	visited := map[string]bool{current.fetchConfig.URL.String(): true}
+
+	for pages := 1; ; pages++ {
+		if pages > 1 {
+			var err error
+			if rsp, data, page, err = fetch(ctx, current); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		var pageRecords []json.RawMessage
+		if err := json.Unmarshal(data, &pageRecords); err != nil {
+			return nil, nil, nil, notRecordsError(pages, current)
+		}
+
+		next := pagination.next(current, pages, pageRecords, page)
+		if next != nil && visited[next.fetchConfig.URL.String()] {
+			next = nil
+		}
+
+		// A single page is returned as it is. Only the validators of single pages are cached, since a page that is not
+		// modified does not mean that the pages that follow it are not.
+		if pages == 1 && next == nil {
+			job.cache.store(job.flattenedRequest, rsp)
+
+			return rsp, data, page, nil
+		}
+
+		if first == nil {
+			first = rsp
+		}
+
+		last = page
+		records = append(records, pageRecords...)
+
+		if next == nil {
+			break
+		}
+
+		visited[next.fetchConfig.URL.String()] = true
+		current = next
+	}
+
+	bytes, err := json.Marshal(records)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to encode records: %w", err)
+	}
+
+	return first, bytes, last, nil
+}
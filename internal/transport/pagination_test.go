@@ -0,0 +1,431 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func TestPagination(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		cursor := &Envelope{Records: "data", NextCursor: "meta.next"}
+
+		for _, tcase := range []struct {
+			name       string
+			pagination *Pagination
+			envelope   *Envelope
+			err        error
+		}{
+			{"nil", nil, nil, nil},
+			{"offset", &Pagination{OffsetName: "offset", LimitName: "limit", PageSize: 100}, nil, nil},
+			{"token path", &Pagination{TokenName: "page_token", TokenPath: "meta.next_page_token"}, nil, nil},
+			{"token envelope", &Pagination{TokenName: "page_token"}, cursor, nil},
+			{"no name", &Pagination{PageSize: 100}, nil, ErrInvalidPagination},
+			{"both names", &Pagination{OffsetName: "offset", TokenName: "page_token", PageSize: 100}, cursor,
+				ErrInvalidPagination},
+			{"no page size", &Pagination{OffsetName: "offset"}, nil, ErrInvalidPagination},
+			{"no token path", &Pagination{TokenName: "page_token"}, nil, ErrInvalidPagination},
+			{"negative start", &Pagination{OffsetName: "offset", PageSize: 100, Start: -1}, nil, ErrInvalidPagination},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.pagination.validate(tcase.envelope); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("set query param", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			raw, name, value, expected string
+		}{
+			{"", "offset", "0", "offset=0"},
+			{"symbols=BTC,ETH&offset=100", "offset", "200", "symbols=BTC,ETH&offset=200"},
+			{"offset=1&offset=2&limit=5", "offset", "10", "limit=5&offset=10"},
+		} {
+			if got := setQueryParam(tcase.raw, tcase.name, tcase.value); got != tcase.expected {
+				t.Fatalf("expected %q, got %q", tcase.expected, got)
+			}
+		}
+	})
+
+	t.Run("fetch pages", func(t *testing.T) {
+		t.Parallel()
+
+		const total = 25
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+			records := []map[string]int{}
+			for id := offset; id < offset+limit && id < total; id++ {
+				records = append(records, map[string]int{"id": id})
+			}
+
+			if err := json.NewEncoder(w).Encode(records); err != nil {
+				t.Errorf("failed to encode records: %v", err)
+			}
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		newJob := func(pagination *Pagination) *webJob {
+			rurl, _ := url.Parse(server.URL)
+
+			return &webJob{
+				flattenedRequest: &flattenedRequest{
+					fetchConfig: &web.FetchConfig{
+						C:           client,
+						Method:      http.MethodGet,
+						URL:         rurl,
+						RateLimiter: rate.NewLimiter(rate.Inf, 1),
+					},
+					pagination: pagination,
+				},
+				logger: logrus.New(),
+			}
+		}
+
+		for _, tcase := range []struct {
+			name       string
+			pagination *Pagination
+			expected   int
+		}{
+			{"every page", &Pagination{OffsetName: "offset", LimitName: "limit", PageSize: 10}, total},
+			{"start", &Pagination{OffsetName: "offset", LimitName: "limit", PageSize: 10, Start: 20}, 5},
+			{"max pages", &Pagination{OffsetName: "offset", LimitName: "limit", PageSize: 10, MaxPages: 2}, 20},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				rsp, data, _, err := fetchPages(context.Background(), newJob(tcase.pagination))
+				if err != nil {
+					t.Fatalf("failed to fetch pages: %v", err)
+				}
+
+				var records []map[string]int
+				if err := json.Unmarshal(data, &records); err != nil {
+					t.Fatalf("failed to decode records: %v", err)
+				}
+
+				if len(records) != tcase.expected {
+					t.Fatalf("expected %d records, got %d", tcase.expected, len(records))
+				}
+
+				if records[0]["id"] != tcase.pagination.Start {
+					t.Fatalf("expected the first record to be %d, got %d", tcase.pagination.Start, records[0]["id"])
+				}
+
+				expectedQuery := fmt.Sprintf("offset=%d&limit=10", tcase.pagination.Start)
+				if rsp.Request.URL.RawQuery != expectedQuery {
+					t.Fatalf("expected the first page query %q, got %q", expectedQuery, rsp.Request.URL.RawQuery)
+				}
+			})
+		}
+	})
+
+	t.Run("next link", func(t *testing.T) {
+		t.Parallel()
+
+		base, _ := url.Parse("https://api.test.com/repos?per_page=2&page=1")
+
+		for _, tcase := range []struct {
+			name, header, expected string
+		}{
+			{"none", "", ""},
+			{"github", `<https://api.test.com/repos?page=2>; rel="next", <https://api.test.com/repos?page=5>; rel="last"`,
+				"https://api.test.com/repos?page=2"},
+			{"relative", `</repos?page=3>; rel=next`, "https://api.test.com/repos?page=3"},
+			{"rel list", `<https://api.test.com/repos?page=4>; title="more"; rel="next last"`,
+				"https://api.test.com/repos?page=4"},
+			{"last page", `<https://api.test.com/repos?page=1>; rel="first", <https://api.test.com/repos?page=1>; rel="prev"`,
+				""},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				header := http.Header{}
+				if tcase.header != "" {
+					header.Set("Link", tcase.header)
+				}
+
+				var got string
+				if next := nextLink(header, base); next != nil {
+					got = next.String()
+				}
+
+				if got != tcase.expected {
+					t.Fatalf("expected %q, got %q", tcase.expected, got)
+				}
+			})
+		}
+	})
+
+	t.Run("follow links", func(t *testing.T) {
+		t.Parallel()
+
+		const pages = 3
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page == 0 {
+				page = 1
+			}
+
+			if page < pages {
+				w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+			}
+
+			fmt.Fprintf(w, `[{"page":%d},{"page":%d}]`, page, page)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		rurl, _ := url.Parse(server.URL + "/repos")
+		limiter := rate.NewLimiter(rate.Inf, 1)
+		job := &webJob{
+			flattenedRequest: &flattenedRequest{
+				fetchConfig: &web.FetchConfig{C: client, Method: http.MethodGet, URL: rurl, RateLimiter: limiter},
+			},
+			logger: logrus.New(),
+		}
+
+		// Every page is a request of its own, which follows the request of the page that links to it.
+		var records []map[string]int
+
+		for requests := 1; ; requests++ {
+			_, data, _, err := fetchPages(context.Background(), job)
+			if err != nil {
+				t.Fatalf("failed to fetch pages: %v", err)
+			}
+
+			var pageRecords []map[string]int
+			if err := json.Unmarshal(data, &pageRecords); err != nil {
+				t.Fatalf("failed to decode records: %v", err)
+			}
+
+			records = append(records, pageRecords...)
+
+			if len(job.next) == 0 {
+				if requests != pages {
+					t.Fatalf("expected %d requests, got %d", pages, requests)
+				}
+
+				break
+			}
+
+			job = &webJob{flattenedRequest: job.next[0], logger: job.logger}
+		}
+
+		if len(records) != 2*pages || records[len(records)-1]["page"] != pages {
+			t.Fatalf("expected the records of %d pages, got %v", pages, records)
+		}
+	})
+
+	t.Run("link cycle", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page := 2
+			if r.URL.Query().Get("page") == "2" {
+				page = 1
+			}
+
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page))
+			fmt.Fprint(w, `[]`)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		rurl, _ := url.Parse(server.URL + "/repos?page=1")
+		job := &webJob{
+			flattenedRequest: &flattenedRequest{
+				fetchConfig: &web.FetchConfig{
+					C:           client,
+					Method:      http.MethodGet,
+					URL:         rurl,
+					RateLimiter: rate.NewLimiter(rate.Inf, 1),
+				},
+			},
+			logger: logrus.New(),
+		}
+
+		if _, _, _, err := fetchPages(context.Background(), job); err != nil || len(job.next) != 1 {
+			t.Fatalf("expected a next page, got %d: %v", len(job.next), err)
+		}
+
+		job = &webJob{flattenedRequest: job.next[0], logger: job.logger}
+		if _, _, _, err := fetchPages(context.Background(), job); err != nil || len(job.next) != 0 {
+			t.Fatalf("expected the link back to the first page not to be followed, got %d: %v", len(job.next), err)
+		}
+	})
+	t.Run("next page token", func(t *testing.T) {
+		t.Parallel()
+
+		tokens := map[string]string{"": "b", "b": "c", "c": ""}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get("page_token")
+
+			next, ok := tokens[token]
+			if !ok {
+				t.Errorf("unexpected page token %q", token)
+			}
+
+			fmt.Fprintf(w, `{"data":[{"page":%q}],"meta":{"next_page_token":%q}}`, token, next)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		rurl, _ := url.Parse(server.URL + "/items")
+		job := &webJob{
+			flattenedRequest: &flattenedRequest{
+				fetchConfig: &web.FetchConfig{
+					C:           client,
+					Method:      http.MethodGet,
+					URL:         rurl,
+					RateLimiter: rate.NewLimiter(rate.Inf, 1),
+				},
+				envelope:   &Envelope{Records: "data"},
+				pagination: &Pagination{TokenName: "page_token", TokenPath: "meta.next_page_token"},
+			},
+			logger: logrus.New(),
+		}
+
+		_, data, _, err := fetchPages(context.Background(), job)
+		if err != nil {
+			t.Fatalf("failed to fetch pages: %v", err)
+		}
+
+		if string(data) != `[{"page":""},{"page":"b"},{"page":"c"}]` {
+			t.Fatalf("unexpected records: %s", data)
+		}
+	})
+}
+
+func TestUpsertLinkedPages(t *testing.T) {
+	t.Parallel()
+
+	const pages = 3
+
+	var (
+		mutex    sync.Mutex
+		requests []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		mutex.Unlock()
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if r.URL.Path == "/repos" && page < pages {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+		}
+
+		fmt.Fprintf(w, `[{"id":%d}]`, page)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+rateLimit:
+  burst: 10
+  period: 1s
+requests:
+  - endpoint: /repos
+    query:
+      page: "1"
+  - endpoint: /owners
+    dependsOn: [repos]
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	planned, completed := make(map[string]int), make(map[string]int)
+
+	cfg.Progress = func(event *ProgressEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch event.Type {
+		case ProgressPlanned:
+			planned[event.Table] += event.Requests
+		case ProgressRequestCompleted:
+			completed[event.Table]++
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := Upsert(ctx, cfg); err != nil {
+		t.Fatalf("error upserting: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// Every page is planned and completed as a request of its own, and the dependent request waits for the last page.
+	if planned["repos"] != pages || completed["repos"] != pages {
+		t.Fatalf("expected %d planned and completed pages, got %d and %d", pages, planned["repos"],
+			completed["repos"])
+	}
+
+	expected := []string{"/repos?page=1", "/repos?page=2", "/repos?page=3", "/owners"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("expected requests %v, got %v", expected, requests)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+// The periods of partitions.
+const (
+	PartitionDay   = "day"
+	PartitionMonth = "month"
+	PartitionYear  = "year"
+)
+
+// partitionLayouts are the time layouts of the table name suffixes of the partitions of each period.
+var partitionLayouts = map[string]string{
+	PartitionDay:   "2006_01_02",
+	PartitionMonth: "2006_01",
+	PartitionYear:  "2006",
+}
+
+// Partition splits the records of a table by the period of a timestamp field, so that huge timeseries tables are
+// stored in a table per period, e.g. "candles_2024_05" for the records of May 2024. If the schema of the table creates
+// it, then the table of each period is created when records are first written to it. The tables of the periods are
+// not truncated or purged with the table of the schema, unless the partitions are native.
+type Partition struct {
+	// Field is the timestamp field of the records that decides their period. It must be a timestamp column of the
+	// schema.
+	Field string `yaml:"field"`
+
+	// Period is the period of each partition: "day", "month", or "year". The default is "month".
+	Period string `yaml:"period"`
+
+	// Native will use the native partitions of the storage instead of a table per period. The records are written to
+	// the table of the schema, which is created as a partitioned table, and the storage routes them to the partition
+	// of their period. The primary key of the schema must include the field. Storages without native partitions
+	// store the records in the table of the schema.
+	Native bool `yaml:"native"`
+}
+
+// period will return the period of the partition.
+func (partition *Partition) period() string {
+	if partition.Period == "" {
+		return PartitionMonth
+	}
+
+	return partition.Period
+}
+
+// validate will ensure that the partition is well defined for the schema of the table.
+func (partition *Partition) validate(table string, schema *Schema) error {
+	if _, ok := partitionLayouts[partition.period()]; !ok {
+		return InvalidSchemaError(table, fmt.Sprintf("unknown partition period %q", partition.Period))
+	}
+
+	var found bool
+
+	for _, column := range schema.Columns {
+		if column.Name == partition.Field {
+			if column.Type != storage.ColumnTypeTimestamp || !column.Required {
+				return InvalidSchemaError(table, fmt.Sprintf("partition field %q is not a required timestamp",
+					partition.Field))
+			}
+
+			found = true
+		}
+	}
+
+	if !found {
+		return InvalidSchemaError(table, fmt.Sprintf("partition field %q is not a column", partition.Field))
+	}
+
+	if !partition.Native || len(schema.PrimaryKey) == 0 {
+		return nil
+	}
+
+	for _, key := range schema.PrimaryKey {
+		if key == partition.Field {
+			return nil
+		}
+	}
+
+	return InvalidSchemaError(table, fmt.Sprintf("primary key does not include partition field %q", partition.Field))
+}
+
+// bounds will return the period that includes the time, which includes the start and excludes the end.
+func (partition *Partition) bounds(tstamp time.Time) (time.Time, time.Time) {
+	tstamp = tstamp.UTC()
+
+	switch partition.period() {
+	case PartitionDay:
+		start := time.Date(tstamp.Year(), tstamp.Month(), tstamp.Day(), 0, 0, 0, 0, time.UTC)
+
+		return start, start.AddDate(0, 0, 1)
+	case PartitionYear:
+		start := time.Date(tstamp.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := time.Date(tstamp.Year(), tstamp.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// partitionPeriod is the period of a partition of a table.
+type partitionPeriod struct {
+	// table is the name of the table of the period, e.g. "candles_2024_05".
+	table string
+
+	start time.Time
+	end   time.Time
+}
+
+// partitionedUpsert is an upsert request along with the table of its schema and the period of its records, if the
+// table is partitioned.
+type partitionedUpsert struct {
+	req *proto.UpsertRequest
+
+	// table is the table of the schema of the records, which decides the storages the records are routed to.
+	table string
+
+	// period is the period of the records, or nil if the table is not partitioned.
+	period *partitionPeriod
+}
+
+// partitionUpserts will split the records of the upsert requests of partitioned tables by their period. The requests
+// of tables without a partition are not changed.
+func partitionUpserts(reqs []*proto.UpsertRequest, schemas map[string]*Schema) ([]*partitionedUpsert, error) {
+	upserts := make([]*partitionedUpsert, 0, len(reqs))
+
+	for _, req := range reqs {
+		schema := schemas[req.Table]
+		if schema == nil || schema.Partition == nil {
+			upserts = append(upserts, &partitionedUpsert{req: req, table: req.Table})
+
+			continue
+		}
+
+		partitioned, err := schema.Partition.split(req)
+		if err != nil {
+			return nil, err
+		}
+
+		upserts = append(upserts, partitioned...)
+	}
+
+	return upserts, nil
+}
+
+// split will split the records of the upsert request by their period, in the order of the periods.
+func (partition *Partition) split(req *proto.UpsertRequest) ([]*partitionedUpsert, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(req.Data, &decoded); err != nil {
+		return nil, fmt.Errorf("unable to decode records for table %q: %w", req.Table, err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	periods := make(map[time.Time]*partitionPeriod)
+	grouped := make(map[time.Time][]interface{})
+
+	for idx, record := range records {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			return nil, SchemaViolationError(req.Table, idx, "record is not an object")
+		}
+
+		tstamp, err := tools.ParseJSONTime(fields[partition.Field])
+		if err != nil {
+			return nil, SchemaViolationError(req.Table, idx, fmt.Sprintf("partition field %q: %v", partition.Field,
+				err))
+		}
+
+		start, end := partition.bounds(tstamp)
+		if _, ok := periods[start]; !ok {
+			periods[start] = &partitionPeriod{
+				table: fmt.Sprintf("%s_%s", req.Table, start.Format(partitionLayouts[partition.period()])),
+				start: start,
+				end:   end,
+			}
+		}
+
+		grouped[start] = append(grouped[start], record)
+	}
+
+	starts := make([]time.Time, 0, len(periods))
+	for start := range periods {
+		starts = append(starts, start)
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	upserts := make([]*partitionedUpsert, 0, len(starts))
+
+	for _, start := range starts {
+		data, err := json.Marshal(grouped[start])
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode records for table %q: %w", req.Table, err)
+		}
+
+		table := periods[start].table
+		if partition.Native {
+			table = req.Table
+		}
+
+		upserts = append(upserts, &partitionedUpsert{
+			req:    &proto.UpsertRequest{Table: table, Data: data, DataType: req.DataType},
+			table:  req.Table,
+			period: periods[start],
+		})
+	}
+
+	return upserts, nil
+}
+
+// partitionCreator creates the partitions of the schemas that are created, the first time records are written to
+// them on each repository.
+type partitionCreator struct {
+	mutex   sync.Mutex
+	schemas map[string]*Schema
+	lineage *Lineage
+	offload *Offload
+
+	// created are the partitions that exist, keyed by the repository index and the table of the partition.
+	created map[string]bool
+}
+
+func newPartitionCreator(schemas map[string]*Schema, lineage *Lineage, offload *Offload) *partitionCreator {
+	return &partitionCreator{schemas: schemas, lineage: lineage, offload: offload, created: make(map[string]bool)}
+}
+
+// createTableRequest will return the request to create the partition of the upsert.
+func (creator *partitionCreator) createTableRequest(upsert *partitionedUpsert) *proto.CreateTableRequest {
+	schema := creator.schemas[upsert.table]
+
+	if schema.Partition.Native {
+		return &proto.CreateTableRequest{
+			Table: upsert.period.table,
+			PartitionOf: &proto.PartitionOf{
+				Table: upsert.table,
+				Start: upsert.period.start.Format(time.RFC3339),
+				End:   upsert.period.end.Format(time.RFC3339),
+			},
+		}
+	}
+
+	req := schema.createTableRequest(upsert.period.table)
+	creator.lineage.addColumn(req)
+	creator.offload.addColumn(req)
+
+	// Index names are unique in a database, so the indexes of each period are named for its table.
+	for _, index := range req.Indexes {
+		if index.Name != "" {
+			index.Name = fmt.Sprintf("%s_%s", upsert.period.table, index.Name)
+		}
+	}
+
+	return req
+}
+
+// create will create the partition of the upsert on the repository at the index, if the schema of its table is
+// created and the partition has not been created on the repository.
+func (creator *partitionCreator) create(ctx context.Context, repoIdx int, repo repository.Generic,
+	upsert *partitionedUpsert,
+) error {
+	if upsert.period == nil || !creator.schemas[upsert.table].Create {
+		return nil
+	}
+
+	key := fmt.Sprintf("%d/%s", repoIdx, upsert.period.table)
+
+	creator.mutex.Lock()
+	defer creator.mutex.Unlock()
+
+	if creator.created[key] {
+		return nil
+	}
+
+	if _, err := repo.CreateTable(ctx, creator.createTableRequest(upsert)); err != nil {
+		return fmt.Errorf("unable to create partition %q: %w", upsert.period.table, err)
+	}
+
+	creator.created[key] = true
+
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+)
+
+func TestPartitionValidate(t *testing.T) {
+	t.Parallel()
+
+	columns := []*Column{
+		{Name: "time", Type: "timestamp", Required: true},
+		{Name: "product_id", Type: "string", Required: true},
+		{Name: "updated", Type: "timestamp"},
+	}
+
+	for _, tcase := range []struct {
+		name   string
+		schema *Schema
+		valid  bool
+	}{
+		{
+			name:   "month",
+			schema: &Schema{Columns: columns, Partition: &Partition{Field: "time"}},
+			valid:  true,
+		},
+		{
+			name: "native",
+			schema: &Schema{
+				Columns:    columns,
+				PrimaryKey: []string{"product_id", "time"},
+				Partition:  &Partition{Field: "time", Period: PartitionDay, Native: true},
+			},
+			valid: true,
+		},
+		{
+			name: "native primary key",
+			schema: &Schema{
+				Columns:    columns,
+				PrimaryKey: []string{"product_id"},
+				Partition:  &Partition{Field: "time", Native: true},
+			},
+		},
+		{
+			name:   "period",
+			schema: &Schema{Columns: columns, Partition: &Partition{Field: "time", Period: "week"}},
+		},
+		{
+			name:   "missing column",
+			schema: &Schema{Columns: columns, Partition: &Partition{Field: "created"}},
+		},
+		{
+			name:   "optional column",
+			schema: &Schema{Columns: columns, Partition: &Partition{Field: "updated"}},
+		},
+		{
+			name:   "string column",
+			schema: &Schema{Columns: columns, Partition: &Partition{Field: "product_id"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tcase.schema.validate("candles")
+			if tcase.valid && err != nil {
+				t.Fatalf("expected a valid schema, got %v", err)
+			}
+
+			if !tcase.valid && !errors.Is(err, ErrInvalidSchema) {
+				t.Fatalf("expected error %v, got %v", ErrInvalidSchema, err)
+			}
+		})
+	}
+}
+
+func TestPartitionUpserts(t *testing.T) {
+	t.Parallel()
+
+	schemas := map[string]*Schema{
+		"candles": {
+			Columns:   []*Column{{Name: "time", Type: "timestamp", Required: true}},
+			Partition: &Partition{Field: "time"},
+			Create:    true,
+		},
+		"trades": {
+			Columns:   []*Column{{Name: "time", Type: "timestamp", Required: true}},
+			Partition: &Partition{Field: "time", Period: PartitionYear, Native: true},
+		},
+	}
+
+	data := []byte(`[{"time": "2024-06-02T10:00:00Z"}, {"time": "2024-05-31T23:00:00Z"}, {"time": 1717200000}]`)
+
+	upserts, err := partitionUpserts([]*proto.UpsertRequest{
+		{Table: "candles", Data: data},
+		{Table: "trades", Data: data},
+		{Table: "products", Data: data},
+	}, schemas)
+	if err != nil {
+		t.Fatalf("failed to partition upserts: %v", err)
+	}
+
+	expected := []struct {
+		table     string
+		upsert    string
+		partition string
+		start     string
+		end       string
+		records   string
+	}{
+		{
+			table: "candles", upsert: "candles_2024_05", partition: "candles_2024_05",
+			start: "2024-05-01T00:00:00Z", end: "2024-06-01T00:00:00Z",
+			records: `[{"time":"2024-05-31T23:00:00Z"}]`,
+		},
+		{
+			table: "candles", upsert: "candles_2024_06", partition: "candles_2024_06",
+			start: "2024-06-01T00:00:00Z", end: "2024-07-01T00:00:00Z",
+			records: `[{"time":"2024-06-02T10:00:00Z"},{"time":1717200000}]`,
+		},
+		{
+			table: "trades", upsert: "trades", partition: "trades_2024",
+			start: "2024-01-01T00:00:00Z", end: "2025-01-01T00:00:00Z",
+			records: `[{"time":"2024-06-02T10:00:00Z"},{"time":"2024-05-31T23:00:00Z"},{"time":1717200000}]`,
+		},
+		{table: "products", upsert: "products", records: string(data)},
+	}
+
+	if len(upserts) != len(expected) {
+		t.Fatalf("expected %d upserts, got %d", len(expected), len(upserts))
+	}
+
+	creator := newPartitionCreator(schemas, &Lineage{}, nil)
+
+	for idx, exp := range expected {
+		upsert := upserts[idx]
+		if upsert.table != exp.table || upsert.req.Table != exp.upsert || string(upsert.req.Data) != exp.records {
+			t.Errorf("expected upsert of %s into %s with %s, got %s into %s with %s", exp.table, exp.upsert,
+				exp.records, upsert.table, upsert.req.Table, upsert.req.Data)
+		}
+
+		if exp.partition == "" {
+			if upsert.period != nil {
+				t.Errorf("expected no partition for %s, got %v", exp.table, upsert.period.table)
+			}
+
+			continue
+		}
+
+		req := creator.createTableRequest(upsert)
+		if req.Table != exp.partition {
+			t.Errorf("expected partition %s, got %s", exp.partition, req.Table)
+		}
+
+		if exp.upsert == exp.table {
+			partitionOf := req.GetPartitionOf()
+			if partitionOf.GetTable() != exp.table || partitionOf.GetStart() != exp.start ||
+				partitionOf.GetEnd() != exp.end {
+				t.Errorf("expected native partition of %s from %s to %s, got %v", exp.table, exp.start, exp.end,
+					partitionOf)
+			}
+
+			continue
+		}
+
+		if len(req.Columns) != 2 || req.Columns[1].Name != defaultLineageField {
+			t.Errorf("expected the columns of the schema and the lineage column, got %v", req.Columns)
+		}
+	}
+
+	if _, err := partitionUpserts([]*proto.UpsertRequest{{Table: "candles", Data: []byte(`[{"close": 1}]`)}},
+		schemas); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("expected error %v, got %v", ErrSchemaViolation, err)
+	}
+}
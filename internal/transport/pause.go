@@ -0,0 +1,103 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// Pause pauses and resumes the web requests of the Upsert operations that use it, e.g. for operators to yield the
+// quota of the web API to other systems temporarily. While paused, the requests in flight finish and their records
+// are upserted, but no new request is made until the operations are resumed. The transactions of the operations stay
+// open while they are paused, so the records of a run are still committed together.
+type Pause struct {
+	mutex sync.Mutex
+
+	// resumed is closed when the operations are resumed. It is nil if they are not paused.
+	resumed chan struct{}
+	since   time.Time
+}
+
+// NewPause will return a Pause that is not paused.
+func NewPause() *Pause {
+	return new(Pause)
+}
+
+// WithPause will pause the web requests of the operation while the pause is paused.
+func WithPause(pause *Pause) UpsertOption {
+	return func(opts *upsertOptions) { opts.pause = pause }
+}
+
+// Pause will stop the operations from making new web requests until Resume is called. It returns false if the
+// operations are already paused.
+func (pause *Pause) Pause() bool {
+	pause.mutex.Lock()
+	defer pause.mutex.Unlock()
+
+	if pause.resumed != nil {
+		return false
+	}
+
+	pause.resumed = make(chan struct{})
+	pause.since = time.Now()
+
+	return true
+}
+
+// Resume will let the operations make web requests again. It returns false if the operations are not paused.
+func (pause *Pause) Resume() bool {
+	pause.mutex.Lock()
+	defer pause.mutex.Unlock()
+
+	if pause.resumed == nil {
+		return false
+	}
+
+	close(pause.resumed)
+	pause.resumed = nil
+
+	return true
+}
+
+// Paused will return true and the time the operations were paused at if they are paused.
+func (pause *Pause) Paused() (bool, time.Time) {
+	pause.mutex.Lock()
+	defer pause.mutex.Unlock()
+
+	return pause.resumed != nil, pause.since
+}
+
+// wait will block until the operations are resumed, if they are paused. A nil pause is never paused.
+func (pause *Pause) wait(ctx context.Context, logger *logrus.Logger) error {
+	if pause == nil {
+		return nil
+	}
+
+	pause.mutex.Lock()
+	resumed := pause.resumed
+	pause.mutex.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+
+	tools.LogEvent{Msg: "paused: waiting to be resumed"}.Log(logger, logrus.InfoLevel)
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("unable to wait for resume: %w", ctx.Err())
+	case <-resumed:
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPause(t *testing.T) {
+	t.Parallel()
+
+	pause := NewPause()
+
+	if paused, _ := pause.Paused(); paused || pause.Resume() {
+		t.Fatalf("expected a new pause not to be paused")
+	}
+
+	if !pause.Pause() || pause.Pause() {
+		t.Fatalf("expected the pause to be paused once")
+	}
+
+	if paused, since := pause.Paused(); !paused || since.IsZero() {
+		t.Fatalf("expected the pause to be paused with its time")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := pause.wait(ctx, logrus.New()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to be canceled, got %v", err)
+	}
+
+	if !pause.Resume() || pause.Resume() {
+		t.Fatalf("expected the pause to be resumed once")
+	}
+
+	if err := pause.wait(context.Background(), logrus.New()); err != nil {
+		t.Fatalf("expected a resumed pause not to wait, got %v", err)
+	}
+
+	if err := (*Pause)(nil).wait(context.Background(), logrus.New()); err != nil {
+		t.Fatalf("expected a nil pause not to wait, got %v", err)
+	}
+}
+
+func TestFetchPaused(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(`[{"id":1}]`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /products
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	flattenedRequests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	pause := NewPause()
+	pause.Pause()
+
+	job := &webJob{flattenedRequest: flattenedRequests[0], logger: cfg.logger(logWeb), pause: pause}
+	fetched := make(chan error, 1)
+
+	go func() {
+		_, _, _, err := fetch(context.Background(), job)
+		fetched <- err
+	}()
+
+	select {
+	case err := <-fetched:
+		t.Fatalf("expected the request to wait while paused, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Fatalf("expected no request while paused")
+	}
+
+	pause.Resume()
+
+	if err := <-fetched; err != nil {
+		t.Fatalf("error fetching: %v", err)
+	}
+
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("expected the request to be made once resumed")
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrCostCeilingExceeded is returned when the plan for an operation exceeds the configured cost ceiling.
+var ErrCostCeilingExceeded = fmt.Errorf("cost ceiling exceeded")
+
+// CostCeilingExceededError wraps an error with ErrCostCeilingExceeded.
+func CostCeilingExceededError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrCostCeilingExceeded, msg)
+}
+
+// CostCeiling is the maximum cost that an operation is allowed to have. An operation whose plan exceeds the ceiling
+// will not be executed.
+type CostCeiling struct {
+	// MaxRequests is the maximum number of web requests for an operation.
+	MaxRequests int `yaml:"maxRequests"`
+
+	// MaxDuration is the maximum estimated duration of an operation, e.g. "2h".
+	MaxDuration time.Duration `yaml:"maxDuration"`
+}
+
+// check will return an error if the plan exceeds the cost ceiling.
+func (ceiling *CostCeiling) check(plan *Plan) error {
+	if ceiling == nil {
+		return nil
+	}
+
+	if ceiling.MaxRequests > 0 && plan.Requests > ceiling.MaxRequests {
+		return CostCeilingExceededError(fmt.Sprintf("%d requests exceeds the maximum of %d", plan.Requests,
+			ceiling.MaxRequests))
+	}
+
+	if ceiling.MaxDuration > 0 && plan.EstimatedDuration > ceiling.MaxDuration {
+		return CostCeilingExceededError(fmt.Sprintf("estimated duration of %v exceeds the maximum of %v",
+			plan.EstimatedDuration, ceiling.MaxDuration))
+	}
+
+	return nil
+}
+
+// Plan is the estimated cost of an upsert operation on the web API.
+type Plan struct {
+	// Requests is the total number of web requests the operation will make.
+	Requests int
+
+	// Tables is the number of web requests whose data is stored in each table.
+	Tables map[string]int
+
+	// EstimatedDuration is the least amount of time the rate limits allow the web requests to be made in. The
+	// actual duration will be longer by the latency of the web API and the storage.
+	EstimatedDuration time.Duration
+}
+
+// newPlan will estimate the cost of making the flattened requests.
+func newPlan(flattenedRequests []*flattenedRequest) *Plan {
+	plan := &Plan{Tables: make(map[string]int)}
+
+	// Requests that share a rate limiter are throttled together, requests with different limiters are not.
+	limited := make(map[*rate.Limiter]int)
+
+	for _, req := range flattenedRequests {
+		plan.Requests++
+
+		for _, table := range req.tables() {
+			plan.Tables[table]++
+		}
+
+		limited[req.fetchConfig.RateLimiter]++
+	}
+
+	for limiter, count := range limited {
+		if duration := estimateLimiterDuration(limiter, count); duration > plan.EstimatedDuration {
+			plan.EstimatedDuration = duration
+		}
+	}
+
+	return plan
+}
+
+// estimateLimiterDuration will return the least amount of time a rate limiter will allow a number of events in. The
+// first burst of events are allowed immediately, then events are allowed at the rate of the limiter.
+func estimateLimiterDuration(limiter *rate.Limiter, count int) time.Duration {
+	if limiter == nil || limiter.Limit() == rate.Inf || count <= limiter.Burst() {
+		return 0
+	}
+
+	if limiter.Limit() <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	seconds := float64(count-limiter.Burst()) / float64(limiter.Limit())
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Estimate will plan the upsert operation for the configuration without making any web requests, returning the
+// number of requests it will make and the estimated duration of the operation. The secrets of the authentication are
+// not resolved and the snapshot is not resumed, so the plan is of a run from the start.
+func Estimate(ctx context.Context, cfg *Config) (*Plan, error) {
+	flattenedRequests, err := cfg.planRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPlan(flattenedRequests), nil
+}
+
+// PlannedRequest is a web request that an upsert operation makes, as flattened from a request of the configuration
+// and chunked by its timeseries.
+type PlannedRequest struct {
+	// Method and URL are the method and URL of the web request, with the query of its chunk.
+	Method string
+	URL    *url.URL
+
+	// Body, ContentType, and Header are the body and headers of the web request. Authentication is added by the web
+	// client when the request is made, so it is not included.
+	Body        []byte
+	ContentType string
+	Header      http.Header
+
+	// Tables are the tables that the records of the response are upserted into, or nil if the response is streamed
+	// to a sink.
+	Tables []string
+
+	// ChunkStart and ChunkEnd are the time range of the timeseries chunk of the request, zero if the request is not
+	// chunked.
+	ChunkStart time.Time
+	ChunkEnd   time.Time
+
+	// RateLimitGroup is the key of the rate limiter of the request. Requests with the same key are throttled together.
+	RateLimitGroup string
+
+	// Limit and Burst are the rate of the rate limiter of the request in requests per second, and its burst.
+	Limit float64
+	Burst int
+
+	// DependsOn are the tables that must be upserted before the request is made.
+	DependsOn []string
+
+	// Foreach is set if the request is fanned out into a request for every value of a table during the run. The URL
+	// of the request is the base URL, since the requests are not known until the values are collected.
+	Foreach *Foreach
+}
+
+// newPlannedRequest will return the planned request of a flattened request.
+func newPlannedRequest(req *flattenedRequest) *PlannedRequest {
+	rurl := *req.fetchConfig.URL
+
+	planned := &PlannedRequest{
+		Method:         req.fetchConfig.Method,
+		URL:            &rurl,
+		Body:           req.fetchConfig.Body,
+		ContentType:    req.fetchConfig.ContentType,
+		Header:         req.fetchConfig.Header.Clone(),
+		RateLimitGroup: req.rateLimitGroup,
+		DependsOn:      req.dependsOn,
+	}
+
+	if req.sink == nil {
+		planned.Tables = req.tables()
+	}
+
+	if req.foreach != nil {
+		planned.Foreach = req.foreach.req.Foreach
+	}
+
+	if req.chunk != nil {
+		planned.ChunkStart, planned.ChunkEnd = req.chunk[0], req.chunk[1]
+	}
+
+	if limiter := req.fetchConfig.RateLimiter; limiter != nil {
+		planned.Limit, planned.Burst = float64(limiter.Limit()), limiter.Burst()
+	}
+
+	return planned
+}
+
+// PlanRequests will flatten the requests of the configuration into the web requests that an upsert operation makes,
+// in the order of the configuration, without making any web requests. Like Estimate, the plan is of a run from the
+// start.
+func PlanRequests(ctx context.Context, cfg *Config) ([]*PlannedRequest, error) {
+	flattenedRequests, err := cfg.planRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	planned := make([]*PlannedRequest, 0, len(flattenedRequests))
+	for _, req := range flattenedRequests {
+		planned = append(planned, newPlannedRequest(req))
+	}
+
+	return planned, nil
+}
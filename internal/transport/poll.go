@@ -0,0 +1,276 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+// poller holds the validators of the endpoints that a daemon polls, as of the latest run that upserted them.
+type poller struct {
+	// validators are the validators of the endpoints, by the URL of their request.
+	validators map[string]*cacheValidators
+
+	// seeded is true once the validators of the cache of the configuration are loaded.
+	seeded bool
+}
+
+func newPoller() *poller {
+	return &poller{validators: make(map[string]*cacheValidators)}
+}
+
+// pollable will return true if a change of the endpoint of the request can be detected with a HEAD request. Like
+// conditional requests, only GET requests without pagination are polled.
+func pollable(req *flattenedRequest) bool {
+	return req.fetchConfig.Method == http.MethodGet && req.pagination == nil && req.foreach == nil &&
+		req.cacheMode != CacheModeNever
+}
+
+// unchanged will return true if the validators of an endpoint match its previous validators. Endpoints without
+// validators are always changed.
+func (validators *cacheValidators) unchanged(previous *cacheValidators) bool {
+	if validators == nil || previous == nil {
+		return false
+	}
+
+	if validators.ETag != "" {
+		return validators.ETag == previous.ETag
+	}
+
+	return validators.LastModified != "" && validators.LastModified == previous.LastModified
+}
+
+// head will make a HEAD request to the endpoint of the request with its rate limiter and retry policy, returning the
+// validators of the response.
+func head(ctx context.Context, cfg *Config, req *flattenedRequest) (*cacheValidators, error) {
+	fetchConfig := *req.fetchConfig
+	fetchConfig.Method = http.MethodHead
+	fetchConfig.Body = nil
+
+	headReq := *req
+	headReq.fetchConfig = &fetchConfig
+
+	retry := cfg.Retry
+	if req.retry != nil {
+		retry = req.retry
+	}
+
+	job := &webJob{
+		flattenedRequest: &headReq,
+		logger:           cfg.logger(logWeb),
+		quietHours:       cfg.QuietHours,
+		maintenance:      cfg.Maintenance,
+		retry:            retry,
+	}
+
+	if err := waitMaintenance(ctx, job.maintenance, job.logger); err != nil {
+		return nil, err
+	}
+
+	if err := waitQuietHours(ctx, job.quietHours, job.logger); err != nil {
+		return nil, err
+	}
+
+	rsp, err := fetchThrottled(ctx, job)
+	if err != nil {
+		return nil, WrapWebError(err)
+	}
+
+	rsp.Body.Close()
+
+	return newCacheValidators(rsp.Header, time.Now()), nil
+}
+
+// changedRequests will return the changed requests in order, along with the requests that write to the same tables,
+// since the tables of the run may be truncated.
+func changedRequests(requests []*flattenedRequest, changed map[*flattenedRequest]bool) []*flattenedRequest {
+	reqs := make([]*flattenedRequest, 0, len(changed))
+	for req := range changed {
+		reqs = append(reqs, req)
+	}
+
+	changedTables := requestTables(reqs)
+
+	var run []*flattenedRequest
+
+	for _, req := range requests {
+		if changed[req] {
+			run = append(run, req)
+
+			continue
+		}
+
+		for _, table := range req.tables() {
+			if changedTables[table] {
+				run = append(run, req)
+
+				break
+			}
+		}
+	}
+
+	return run
+}
+
+// seed will load the validators of the cache of the configuration on the first poll, so that the endpoints that are
+// cached are not upserted again by the first run.
+func (poller *poller) seed(ctx context.Context, cfg *Config) error {
+	if poller.seeded {
+		return nil
+	}
+
+	sc, err := cfg.StateEncryption.cipher()
+	if err != nil {
+		return err
+	}
+
+	store, err := cfg.checkpointStore(ctx)
+	if err != nil {
+		return err
+	}
+
+	rc, err := cfg.Cache.load(ctx, store, sc, nil)
+	if err != nil {
+		return err
+	}
+
+	if rc != nil {
+		for key, validators := range rc.validators {
+			poller.validators[key] = validators
+		}
+	}
+
+	poller.seeded = true
+
+	return nil
+}
+
+// poll will make a HEAD request to the endpoint of every request of the configuration, and run the Upsert operation
+// with the requests whose endpoints changed since the latest run that upserted them, along with the requests that can
+// not be polled. The second value is false if no endpoint changed, in which case there is no run. The HEAD requests and
+// the run are paused while the pause is paused.
+func (poller *poller) poll(ctx context.Context, cfg *Config, pause *Pause) (*UpsertResult, bool, error) {
+	if err := poller.seed(ctx, cfg); err != nil {
+		return nil, false, err
+	}
+
+	requests, err := cfg.flattenRequests(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var (
+		changed  = make(map[*flattenedRequest]bool)
+		observed = make(map[string]*cacheValidators)
+		polled   int
+	)
+
+	for _, req := range requests {
+		if !pollable(req) {
+			changed[req] = true
+
+			continue
+		}
+
+		if err := pause.wait(ctx, cfg.logger(logWeb)); err != nil {
+			return nil, false, fmt.Errorf("poll canceled: %w", err)
+		}
+
+		validators, err := head(ctx, cfg, req)
+		if err != nil && ctx.Err() != nil {
+			return nil, false, fmt.Errorf("poll canceled: %w", ctx.Err())
+		}
+
+		// Endpoints that can not be polled, e.g. that do not allow HEAD requests, are upserted on every poll.
+		if err != nil {
+			logDebug := tools.LogEvent{Msg: "unable to poll", URL: req.fetchConfig.URL.Redacted(), Err: err}
+			logDebug.Log(cfg.logger(logWeb), logrus.DebugLevel)
+
+			changed[req] = true
+
+			continue
+		}
+
+		polled++
+
+		key := req.fetchConfig.URL.String()
+		if validators.unchanged(poller.validators[key]) {
+			continue
+		}
+
+		observed[key] = validators
+		changed[req] = true
+	}
+
+	run := changedRequests(requests, changed)
+	if len(run) == 0 {
+		logInfo := tools.LogEvent{Msg: "poll completed: endpoints unchanged", Count: polled}
+		logInfo.Log(cfg.logger(logPlanner), logrus.InfoLevel)
+
+		return nil, false, nil
+	}
+
+	logInfo := tools.LogEvent{Msg: "poll completed: upserting requests", Count: len(run), Total: len(requests)}
+	logInfo.Log(cfg.logger(logPlanner), logrus.InfoLevel)
+
+	result, err := Upsert(ctx, cfg, withRequests(run), WithPause(pause))
+	if err != nil {
+		return nil, true, err
+	}
+
+	// The validators are only kept once the requests are upserted, so that failed runs are retried on the next poll.
+	for key, validators := range observed {
+		poller.validators[key] = validators
+	}
+
+	return result, true, nil
+}
+
+// Poll will poll the endpoints of the configuration with HEAD requests now and then every interval, until the context
+// is canceled, and run the Upsert operation with only the requests whose endpoints changed since they were last
+// upserted, according to the "ETag" or "Last-Modified" headers of the responses. This minimizes the requests to
+// slowly-changing reference data. The HEAD requests use the rate limiters and retry policies of the requests.
+// Requests that can not be polled, e.g. POST requests, paginated requests, requests with a cache mode of "never", and
+// endpoints without validators, are upserted on every poll that runs. Only the tables of the requests that run are
+// truncated, and the requests that write to the same tables as a changed request also run.
+//
+// The result of every run is passed to handle, which may be nil; polls without changes do not run and are not passed
+// to handle. Poll returns once the context is canceled and the run in flight has stopped.
+func (daemon *Daemon) Poll(ctx context.Context, handle func(*UpsertResult, error)) {
+	ticker := time.NewTicker(daemon.interval)
+	defer ticker.Stop()
+
+	poller := newPoller()
+
+	for {
+		if err := daemon.pause.wait(ctx, daemon.Config().logger(logPlanner)); err != nil {
+			return
+		}
+
+		result, ran, err := poller.poll(ctx, daemon.Config(), daemon.pause)
+		if handle != nil && (ran || err != nil) {
+			handle(result, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// The ticker may be ready at the same time as the context is canceled.
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheValidatorsUnchanged(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name       string
+		validators *cacheValidators
+		previous   *cacheValidators
+		unchanged  bool
+	}{
+		{"no previous", &cacheValidators{ETag: `"a"`}, nil, false},
+		{"no validators", nil, &cacheValidators{ETag: `"a"`}, false},
+		{"same etag", &cacheValidators{ETag: `"a"`}, &cacheValidators{ETag: `"a"`}, true},
+		{"different etag", &cacheValidators{ETag: `"b"`}, &cacheValidators{ETag: `"a"`}, false},
+		{
+			"same last modified",
+			&cacheValidators{LastModified: "Tue, 10 May 2022 00:00:00 GMT"},
+			&cacheValidators{LastModified: "Tue, 10 May 2022 00:00:00 GMT"},
+			true,
+		},
+		{"empty", &cacheValidators{}, &cacheValidators{}, false},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if unchanged := tcase.validators.unchanged(tcase.previous); unchanged != tcase.unchanged {
+				t.Fatalf("expected unchanged to be %v, got %v", tcase.unchanged, unchanged)
+			}
+		})
+	}
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+
+	var heads, gets int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&heads, 1)
+		} else {
+			atomic.AddInt32(&gets, 1)
+		}
+
+		w.Header().Set("ETag", `"`+r.URL.Path+`"`)
+	}))
+	defer server.Close()
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+rateLimit:
+  burst: 10
+  period: 1s
+requests:
+  - endpoint: /assets
+  - endpoint: /currencies
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	poller := newPoller()
+	poller.validators[server.URL+"/assets"] = &cacheValidators{ETag: `"/assets"`}
+	poller.validators[server.URL+"/currencies"] = &cacheValidators{ETag: `"/currencies"`}
+
+	result, ran, err := poller.poll(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatalf("error polling: %v", err)
+	}
+
+	if ran || result != nil {
+		t.Fatalf("expected no run for unchanged endpoints")
+	}
+
+	if atomic.LoadInt32(&heads) != 2 || atomic.LoadInt32(&gets) != 0 {
+		t.Fatalf("expected 2 HEAD requests and no GET requests, got %d and %d", heads, gets)
+	}
+}
+
+func TestChangedRequests(t *testing.T) {
+	t.Parallel()
+
+	assets := &flattenedRequest{table: "assets"}
+	currencies := &flattenedRequest{table: "currencies"}
+	moreAssets := &flattenedRequest{table: "assets"}
+	requests := []*flattenedRequest{assets, currencies, moreAssets}
+
+	run := changedRequests(requests, map[*flattenedRequest]bool{moreAssets: true})
+	if len(run) != 2 || run[0] != assets || run[1] != moreAssets {
+		t.Fatalf("expected the requests of the changed table, got %v", run)
+	}
+}
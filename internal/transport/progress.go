@@ -0,0 +1,122 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"sync"
+	"time"
+)
+
+// ProgressEventType is the type of a progress event.
+type ProgressEventType uint8
+
+const (
+	// ProgressPlanned is sent once for the table of each request before any web request is made, with the number of
+	// web requests planned for the table, and again for the pages that the responses link to as they are planned.
+	ProgressPlanned ProgressEventType = iota
+
+	// ProgressRequestCompleted is sent when a web request completes.
+	ProgressRequestCompleted
+
+	// ProgressRequestFailed is sent when a web request fails.
+	ProgressRequestFailed
+
+	// ProgressUpserted is sent when the records of a web request are upserted into a table of a storage.
+	ProgressUpserted
+
+	// ProgressLimitExceeded is sent when the response of a web request exceeds the limits of the request, with the
+	// size and number of records of the response.
+	ProgressLimitExceeded
+
+	// ProgressNotModified is sent when the response of a conditional web request is not modified, before the request
+	// completes. The records of the response are not upserted again.
+	ProgressNotModified
+)
+
+// ProgressEvent is an event on the progress of an upsert operation.
+type ProgressEvent struct {
+	Type ProgressEventType
+
+	// Time is the time of the event.
+	Time time.Time
+
+	// Table is the table of the request for planned and request events, and the table the records were upserted
+	// into for upserted events.
+	Table string
+
+	// Requests is the number of web requests planned for the table.
+	Requests int
+
+	// Records is the number of records upserted.
+	Records int64
+
+	// RecordErrors is the number of records that failed to upsert.
+	RecordErrors int64
+
+	// Bytes is the size of the JSON encoded records upserted.
+	Bytes int64
+
+	// Err is the error of a failed request.
+	Err error
+
+	// WebQueue and RepositoryQueue are the number of jobs waiting for a web worker and a repository worker at the
+	// time of the event.
+	WebQueue        int
+	RepositoryQueue int
+}
+
+// progress sends the progress events of an operation to the progress callback of the configuration and the metrics
+// of the process. Events are sent one at a time, so the callback does not need to be safe for concurrent use.
+type progress struct {
+	mutex    sync.Mutex
+	callback func(*ProgressEvent)
+	metrics  *pipelineMetrics
+}
+
+func newProgress(callback func(*ProgressEvent)) *progress {
+	return &progress{callback: callback, metrics: metrics}
+}
+
+// send will send the event to the metrics and to the callback, if there is one.
+func (prog *progress) send(event *ProgressEvent) {
+	if prog == nil {
+		return
+	}
+
+	prog.mutex.Lock()
+	defer prog.mutex.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	prog.metrics.observe(event)
+
+	if prog.callback != nil {
+		prog.callback(event)
+	}
+}
+
+// planned will send a planned event for the table of each request, in the order the tables are first requested.
+func (prog *progress) planned(flattenedRequests []*flattenedRequest) {
+	var tables []string
+
+	requests := make(map[string]int)
+
+	for _, req := range flattenedRequests {
+		if _, ok := requests[req.table]; !ok {
+			tables = append(tables, req.table)
+		}
+
+		requests[req.table]++
+	}
+
+	for _, table := range tables {
+		prog.send(&ProgressEvent{Type: ProgressPlanned, Table: table, Requests: requests[table]})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+
+	t.Run("planned", func(t *testing.T) {
+		t.Parallel()
+
+		var events []*ProgressEvent
+
+		prog := newProgress(func(event *ProgressEvent) { events = append(events, event) })
+		prog.planned([]*flattenedRequest{{table: "candles"}, {table: "trades"}, {table: "candles"}})
+
+		planned := make([][2]interface{}, 0, len(events))
+
+		for _, event := range events {
+			if event.Type != ProgressPlanned || event.Time.IsZero() {
+				t.Fatalf("unexpected event: %+v", event)
+			}
+
+			planned = append(planned, [2]interface{}{event.Table, event.Requests})
+		}
+
+		if expected := [][2]interface{}{{"candles", 2}, {"trades", 1}}; !reflect.DeepEqual(planned, expected) {
+			t.Fatalf("expected planned events %v, got %v", expected, planned)
+		}
+	})
+
+	t.Run("no callback", func(t *testing.T) {
+		t.Parallel()
+
+		var prog *progress
+		prog.send(&ProgressEvent{Type: ProgressRequestCompleted})
+
+		newProgress(nil).send(&ProgressEvent{Type: ProgressRequestCompleted})
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidProjection is returned when the include or exclude fields of a request are invalid.
+var ErrInvalidProjection = fmt.Errorf("invalid projection")
+
+// InvalidProjectionError wraps an error with ErrInvalidProjection.
+func InvalidProjectionError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidProjection, msg)
+}
+
+// projection is the fields of the records of a request that are stored. The fields are dot-separated paths to the
+// fields of nested objects, e.g. "user.email".
+type projection struct {
+	// Include are the only fields that are stored, if there are any.
+	Include []string `json:"include,omitempty"`
+
+	// Exclude are the fields that are removed, after the include fields are selected.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// projection will return the projection of the request, or nil if the request stores every field.
+func (req *Request) projection() *projection {
+	if len(req.IncludeFields) == 0 && len(req.ExcludeFields) == 0 {
+		return nil
+	}
+
+	return &projection{Include: req.IncludeFields, Exclude: req.ExcludeFields}
+}
+
+// validateProjection will ensure that the include and exclude fields of the request are valid paths.
+func (req *Request) validateProjection() error {
+	for _, path := range append(append([]string{}, req.IncludeFields...), req.ExcludeFields...) {
+		for _, part := range strings.Split(path, ".") {
+			if part == "" {
+				return InvalidProjectionError(fmt.Sprintf("invalid field %q of table %q", path, req.Table))
+			}
+		}
+	}
+
+	return nil
+}
+
+// project will keep the include fields and remove the exclude fields of the JSON encoded records of the table. The
+// data can be a single JSON object or an array of JSON objects.
+func project(data []byte, table string, proj *projection) ([]byte, error) {
+	if proj == nil {
+		return data, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("unable to decode records for table %q: %w", table, err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	for idx, record := range records {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if len(proj.Include) > 0 {
+			included := make(map[string]interface{})
+			for _, path := range proj.Include {
+				includeField(fields, included, strings.Split(path, "."))
+			}
+
+			fields = included
+		}
+
+		for _, path := range proj.Exclude {
+			excludeField(fields, strings.Split(path, "."))
+		}
+
+		records[idx] = fields
+	}
+
+	if _, ok := decoded.([]interface{}); !ok {
+		decoded = records[0]
+	}
+
+	bytes, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode records for table %q: %w", table, err)
+	}
+
+	return bytes, nil
+}
+
+// includeField will copy the field at the path from the source record into the destination record, creating the
+// parent objects of the field in the destination. Fields that are not in the source are ignored.
+func includeField(src, dst map[string]interface{}, path []string) {
+	value, ok := src[path[0]]
+	if !ok {
+		return
+	}
+
+	if len(path) == 1 {
+		dst[path[0]] = value
+
+		return
+	}
+
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	child, ok := dst[path[0]].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		dst[path[0]] = child
+	}
+
+	includeField(nested, child, path[1:])
+}
+
+// excludeField will remove the field at the path from the record.
+func excludeField(fields map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		delete(fields, path[0])
+
+		return
+	}
+
+	if nested, ok := fields[path[0]].(map[string]interface{}); ok {
+		excludeField(nested, path[1:])
+	}
+}
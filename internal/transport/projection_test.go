@@ -0,0 +1,110 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[{"id": 1, "price": 2, "user": {"name": "a", "email": "a@test.com", "ssn": "1"}}, "raw"]`)
+
+	for _, tcase := range []struct {
+		name       string
+		data       []byte
+		projection *projection
+		expected   string
+	}{
+		{
+			name:     "no projection",
+			data:     []byte(`[{"id": 1}]`),
+			expected: `[{"id": 1}]`,
+		},
+		{
+			name:       "include",
+			data:       data,
+			projection: &projection{Include: []string{"id", "user.email", "missing", "price.value"}},
+			expected:   `[{"id":1,"user":{"email":"a@test.com"}},"raw"]`,
+		},
+		{
+			name:       "exclude",
+			data:       data,
+			projection: &projection{Exclude: []string{"price", "user.ssn", "missing.field"}},
+			expected:   `[{"id":1,"user":{"email":"a@test.com","name":"a"}},"raw"]`,
+		},
+		{
+			name:       "include and exclude",
+			data:       data,
+			projection: &projection{Include: []string{"id", "user"}, Exclude: []string{"user.ssn"}},
+			expected:   `[{"id":1,"user":{"email":"a@test.com","name":"a"}},"raw"]`,
+		},
+		{
+			name:       "object",
+			data:       []byte(`{"id": 1, "secret": "s"}`),
+			projection: &projection{Exclude: []string{"secret"}},
+			expected:   `{"id":1}`,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			projected, err := project(tcase.data, "table", tcase.projection)
+			if err != nil {
+				t.Fatalf("failed to project records: %v", err)
+			}
+
+			if string(projected) != tcase.expected {
+				t.Fatalf("expected %s, got %s", tcase.expected, projected)
+			}
+		})
+	}
+}
+
+func TestPrepareProjection(t *testing.T) {
+	t.Parallel()
+
+	job := &repoJob{
+		projection: &projection{Include: []string{"id"}},
+		fields:     map[string]interface{}{"run_id": "run"},
+	}
+
+	data, err := job.prepare([]byte(`[{"id": 1, "price": 2}]`), "table")
+	if err != nil {
+		t.Fatalf("failed to prepare records: %v", err)
+	}
+
+	if expected := `[{"id":1,"run_id":"run"}]`; string(data) != expected {
+		t.Fatalf("expected the header and lineage fields to be kept, got %s", data)
+	}
+}
+
+func TestValidateProjection(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		req *Request
+		err bool
+	}{
+		{req: &Request{IncludeFields: []string{"id", "user.email"}, ExcludeFields: []string{"user.ssn"}}},
+		{req: &Request{IncludeFields: []string{"user."}}, err: true},
+		{req: &Request{ExcludeFields: []string{""}}, err: true},
+	} {
+		if err := tcase.req.validateProjection(); tcase.err != errors.Is(err, ErrInvalidProjection) {
+			t.Fatalf("unexpected error for %v: %v", tcase.req.IncludeFields, err)
+		}
+	}
+
+	if (&Request{}).projection() != nil {
+		t.Fatalf("expected no projection without include or exclude fields")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidProxy is returned when the proxy of the configuration is invalid.
+var ErrInvalidProxy = fmt.Errorf("invalid proxy")
+
+// InvalidProxyError wraps an error with ErrInvalidProxy.
+func InvalidProxyError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidProxy, msg)
+}
+
+// proxySchemes are the schemes of the proxies that requests can be sent through.
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// Proxy is the proxy that the requests are sent through, e.g. from inside a corporate network. Requests with an egress
+// proxy of their own use it instead. Without a proxy, the requests use the proxy of the HTTPS_PROXY, HTTP_PROXY, and
+// NO_PROXY environment variables, if they are set.
+type Proxy struct {
+	// URL is the URL of the proxy, with an "http", "https", or "socks5" scheme, e.g. "http://proxy.internal:3128".
+	URL string `yaml:"url"`
+
+	// Username and Password are the credentials of the proxy. They take precedence over the credentials of the URL.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// NoProxy are the hosts that are reached directly instead of through the proxy. A host is an IP address, a CIDR
+	// range, or a domain name that also matches its subdomains, e.g. "example.com" matches "api.example.com". A
+	// domain name with a leading dot only matches its subdomains. A host can have a port, e.g. "example.com:8443",
+	// and "*" reaches every host directly.
+	NoProxy []string `yaml:"noProxy"`
+}
+
+// validate will ensure that the proxy is valid.
+func (proxy *Proxy) validate() error {
+	if proxy == nil {
+		return nil
+	}
+
+	_, err := proxy.url()
+
+	return err
+}
+
+// url will return the URL of the proxy, with its credentials.
+func (proxy *Proxy) url() (*url.URL, error) {
+	if proxy.URL == "" {
+		return nil, InvalidProxyError("url is required")
+	}
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		return nil, InvalidProxyError(fmt.Sprintf("unable to parse url: %v", err))
+	}
+
+	if !proxySchemes[proxyURL.Scheme] || proxyURL.Host == "" {
+		return nil, InvalidProxyError(fmt.Sprintf("url %q must have a host and an http, https, or socks5 scheme",
+			proxy.URL))
+	}
+
+	if proxy.Username != "" || proxy.Password != "" {
+		proxyURL.User = url.UserPassword(proxy.Username, proxy.Password)
+	}
+
+	return proxyURL, nil
+}
+
+// proxyFunc will return the function that selects the proxy of a request for an http.Transport.
+func (proxy *Proxy) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	proxyURL, err := proxy.url()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if proxy.bypass(req.URL) {
+			return nil, nil
+		}
+
+		return proxyURL, nil
+	}, nil
+}
+
+// bypass will return true if the URL is reached directly, instead of through the proxy.
+func (proxy *Proxy) bypass(rurl *url.URL) bool {
+	host := strings.ToLower(rurl.Hostname())
+
+	port := rurl.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[rurl.Scheme]
+	}
+
+	for _, entry := range proxy.NoProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "*" {
+			return true
+		}
+
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(host); ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+
+		if ip := net.ParseIP(entryHost); ip != nil {
+			if ip.Equal(net.ParseIP(host)) {
+				return true
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(host, entryHost) {
+				return true
+			}
+
+			continue
+		}
+
+		if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+
+	return false
+}
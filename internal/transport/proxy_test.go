@@ -0,0 +1,127 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			proxy *Proxy
+			err   error
+		}{
+			{nil, nil},
+			{&Proxy{URL: "http://proxy.internal:3128"}, nil},
+			{&Proxy{URL: "socks5://proxy.internal:1080"}, nil},
+			{&Proxy{}, ErrInvalidProxy},
+			{&Proxy{URL: "ftp://proxy.internal"}, ErrInvalidProxy},
+			{&Proxy{URL: "proxy.internal:3128"}, ErrInvalidProxy},
+		} {
+			if err := tcase.proxy.validate(); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v for %+v, got %v", tcase.err, tcase.proxy, err)
+			}
+		}
+	})
+
+	t.Run("bypass", func(t *testing.T) {
+		t.Parallel()
+
+		proxy := &Proxy{
+			URL:     "http://proxy.internal:3128",
+			NoProxy: []string{"example.com", ".internal.net", "10.0.0.0/8", "192.168.1.1", "metrics.io:8443"},
+		}
+
+		for _, tcase := range []struct {
+			rawURL string
+			bypass bool
+		}{
+			{"https://example.com/candles", true},
+			{"https://api.example.com/candles", true},
+			{"https://notexample.com/candles", false},
+			{"https://internal.net/candles", false},
+			{"https://api.internal.net/candles", true},
+			{"http://10.1.2.3/candles", true},
+			{"http://11.1.2.3/candles", false},
+			{"http://192.168.1.1:8080/candles", true},
+			{"https://metrics.io:8443/candles", true},
+			{"https://metrics.io/candles", false},
+		} {
+			rurl, err := url.Parse(tcase.rawURL)
+			if err != nil {
+				t.Fatalf("error parsing URL: %v", err)
+			}
+
+			if bypass := proxy.bypass(rurl); bypass != tcase.bypass {
+				t.Fatalf("expected bypass %v for %q, got %v", tcase.bypass, tcase.rawURL, bypass)
+			}
+		}
+
+		if !(&Proxy{NoProxy: []string{"*"}}).bypass(&url.URL{Scheme: "https", Host: "api.test.com"}) {
+			t.Fatal("expected every host to bypass the proxy")
+		}
+	})
+
+	t.Run("round tripper", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Proxied-Host", r.Host)
+			w.Header().Set("X-Proxy-Authorization", r.Header.Get("Proxy-Authorization"))
+			io.WriteString(w, `[{"id":1}]`)
+		}))
+		t.Cleanup(server.Close)
+
+		cfg := &Config{Proxy: &Proxy{URL: server.URL, Username: "user", Password: "pass"}}
+
+		rt, err := cfg.newRoundTripper(new(Egress))
+		if err != nil {
+			t.Fatalf("error creating round tripper: %v", err)
+		}
+
+		rsp, err := (&http.Client{Transport: rt}).Get("http://api.test.com/candles")
+		if err != nil {
+			t.Fatalf("error making request: %v", err)
+		}
+
+		rsp.Body.Close()
+
+		if got := rsp.Header.Get("X-Proxied-Host"); got != "api.test.com" {
+			t.Fatalf("expected the proxy to receive the request for %q, got %q", "api.test.com", got)
+		}
+
+		expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+		if got := rsp.Header.Get("X-Proxy-Authorization"); got != expected {
+			t.Fatalf("expected the proxy credentials %q, got %q", expected, got)
+		}
+
+		// Requests with an egress proxy of their own use it instead.
+		egressRT, err := cfg.newRoundTripper(&Egress{Proxy: "http://egress.internal:3128"})
+		if err != nil {
+			t.Fatalf("error creating round tripper: %v", err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "http://api.test.com/candles", nil)
+
+		proxyURL, err := egressRT.(*http.Transport).Proxy(req)
+		if err != nil || proxyURL.Host != "egress.internal:3128" {
+			t.Fatalf("expected the egress proxy, got %v (%v)", proxyURL, err)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// quietClockLayout is the layout of the start and end times of a quiet window.
+const quietClockLayout = "15:04"
+
+// ErrInvalidQuietWindow is returned when a quiet window in the configuration is invalid.
+var ErrInvalidQuietWindow = fmt.Errorf("invalid quiet window")
+
+// InvalidQuietWindowError wraps an error with ErrInvalidQuietWindow.
+func InvalidQuietWindowError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidQuietWindow, msg)
+}
+
+// quietWeekdays maps the day names of a quiet window to weekdays.
+var quietWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// QuietWindow is a recurring time window during which requests are paused or made at a reduced rate, so that long
+// backfills do not compete with business-hours traffic against shared APIs or databases. For example, a window on
+// "mon" to "fri" from "09:00" to "17:00" with a rate of 0.5 makes at most one request every two seconds during
+// business hours.
+type QuietWindow struct {
+	// Days are the days of the week the window starts on, e.g. "mon" or "sat". If no days are set, the window
+	// starts on every day.
+	Days []string `yaml:"days"`
+
+	// Start and End are the times of day the window starts and ends, e.g. "09:00" and "17:00". If the end is not
+	// after the start, the window ends on the next day, e.g. "22:00" to "06:00".
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+
+	// Timezone is the IANA time zone of the start and end times, the default is UTC.
+	Timezone string `yaml:"timezone"`
+
+	// Rate is the maximum number of requests per second during the window. If the rate is zero, requests are paused
+	// until the window ends.
+	Rate float64 `yaml:"rate"`
+
+	once     sync.Once
+	schedule *quietSchedule
+	err      error
+}
+
+// quietSchedule is the parsed form of a quiet window.
+type quietSchedule struct {
+	// days are the weekdays the window starts on, nil for every day.
+	days map[time.Weekday]bool
+
+	// start and end are the offsets of the window from midnight.
+	start, end time.Duration
+
+	location *time.Location
+
+	// limiter limits the requests during the window, nil if requests are paused.
+	limiter *rate.Limiter
+}
+
+// parseQuietClock will parse a time of day into its offset from midnight.
+func parseQuietClock(clock string) (time.Duration, error) {
+	parsed, err := time.Parse(quietClockLayout, clock)
+	if err != nil {
+		return 0, InvalidQuietWindowError(fmt.Sprintf("unable to parse time %q: %v", clock, err))
+	}
+
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// load will parse the quiet window on first use. The schedule, and so the rate limiter of the window, is shared by
+// every operation on the configuration.
+func (window *QuietWindow) load() (*quietSchedule, error) {
+	window.once.Do(func() {
+		window.schedule, window.err = window.parse()
+	})
+
+	return window.schedule, window.err
+}
+
+func (window *QuietWindow) parse() (*quietSchedule, error) {
+	schedule := &quietSchedule{location: time.UTC}
+
+	var err error
+
+	if schedule.start, err = parseQuietClock(window.Start); err != nil {
+		return nil, err
+	}
+
+	if schedule.end, err = parseQuietClock(window.End); err != nil {
+		return nil, err
+	}
+
+	if window.Timezone != "" {
+		if schedule.location, err = time.LoadLocation(window.Timezone); err != nil {
+			return nil, InvalidQuietWindowError(fmt.Sprintf("unable to load timezone %q: %v", window.Timezone, err))
+		}
+	}
+
+	for _, day := range window.Days {
+		weekday, ok := quietWeekdays[strings.ToLower(day)]
+		if !ok {
+			return nil, InvalidQuietWindowError(fmt.Sprintf("unknown day %q", day))
+		}
+
+		if schedule.days == nil {
+			schedule.days = make(map[time.Weekday]bool)
+		}
+
+		schedule.days[weekday] = true
+	}
+
+	if window.Rate < 0 {
+		return nil, InvalidQuietWindowError("rate is negative")
+	}
+
+	if window.Rate > 0 {
+		schedule.limiter = rate.NewLimiter(rate.Limit(window.Rate), 1)
+	}
+
+	return schedule, nil
+}
+
+// active will return the end of the window if the time is in the window.
+func (schedule *quietSchedule) active(now time.Time) (time.Time, bool) {
+	local := now.In(schedule.location)
+
+	// A window that ends on the next day may have started yesterday.
+	for _, offset := range []int{0, -1} {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, schedule.location)
+		if schedule.days != nil && !schedule.days[day.Weekday()] {
+			continue
+		}
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), 0, int(schedule.start.Minutes()), 0, 0,
+			schedule.location)
+
+		end := time.Date(day.Year(), day.Month(), day.Day(), 0, int(schedule.end.Minutes()), 0, 0,
+			schedule.location)
+		if schedule.end <= schedule.start {
+			end = end.AddDate(0, 0, 1)
+		}
+
+		if !local.Before(start) && local.Before(end) {
+			return end, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// waitQuietHours will block while the current time is in a quiet window that pauses requests, and then wait on the
+// rate limiter of the slowest quiet window that the current time is in.
+func waitQuietHours(ctx context.Context, windows []*QuietWindow, logger *logrus.Logger) error {
+	for {
+		now := time.Now()
+
+		var (
+			paused  time.Time
+			limiter *rate.Limiter
+		)
+
+		for _, window := range windows {
+			schedule, err := window.load()
+			if err != nil {
+				return err
+			}
+
+			end, ok := schedule.active(now)
+			if !ok {
+				continue
+			}
+
+			if schedule.limiter == nil {
+				if end.After(paused) {
+					paused = end
+				}
+
+				continue
+			}
+
+			if limiter == nil || schedule.limiter.Limit() < limiter.Limit() {
+				limiter = schedule.limiter
+			}
+		}
+
+		if paused.IsZero() {
+			if limiter == nil {
+				return nil
+			}
+
+			if err := limiter.Wait(ctx); err != nil {
+				return fmt.Errorf("unable to wait for quiet window: %w", err)
+			}
+
+			return nil
+		}
+
+		logInfo := tools.LogEvent{Msg: "quiet window: requests paused", Until: paused}
+		logInfo.Log(logger, logrus.InfoLevel)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("unable to wait for quiet window: %w", ctx.Err())
+		case <-time.After(paused.Sub(now)):
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestQuietWindow(t *testing.T) {
+	t.Parallel()
+
+	// 2022-05-10 is a Tuesday.
+	tuesday := func(hour, minute int) time.Time {
+		return time.Date(2022, 5, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, tcase := range []struct {
+		name   string
+		window *QuietWindow
+		now    time.Time
+		end    time.Time
+		active bool
+	}{
+		{
+			name:   "business hours",
+			window: &QuietWindow{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00"},
+			now:    tuesday(12, 30),
+			end:    tuesday(17, 0),
+			active: true,
+		},
+		{
+			name:   "after business hours",
+			window: &QuietWindow{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00"},
+			now:    tuesday(17, 0),
+		},
+		{
+			name:   "other day",
+			window: &QuietWindow{Days: []string{"Sat"}, Start: "09:00", End: "17:00"},
+			now:    tuesday(12, 30),
+		},
+		{
+			name:   "overnight from yesterday",
+			window: &QuietWindow{Days: []string{"mon"}, Start: "22:00", End: "06:00"},
+			now:    tuesday(5, 0),
+			end:    tuesday(6, 0),
+			active: true,
+		},
+		{
+			name:   "overnight not started",
+			window: &QuietWindow{Days: []string{"tue"}, Start: "22:00", End: "06:00"},
+			now:    tuesday(5, 0),
+		},
+		{
+			name:   "timezone",
+			window: &QuietWindow{Start: "09:00", End: "17:00", Timezone: "America/New_York"},
+			now:    tuesday(20, 0),
+			end:    tuesday(21, 0),
+			active: true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := tcase.window.load()
+			if err != nil {
+				t.Fatalf("error loading window: %v", err)
+			}
+
+			end, active := schedule.active(tcase.now)
+			if active != tcase.active || !end.Equal(tcase.end) {
+				t.Fatalf("expected (%v, %t), got (%v, %t)", tcase.end, tcase.active, end, active)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, window := range []*QuietWindow{
+			{Start: "9am", End: "17:00"},
+			{Start: "09:00", End: "17:00", Days: []string{"someday"}},
+			{Start: "09:00", End: "17:00", Timezone: "Mars/Olympus_Mons"},
+			{Start: "09:00", End: "17:00", Rate: -1},
+		} {
+			if _, err := window.load(); !errors.Is(err, ErrInvalidQuietWindow) {
+				t.Errorf("expected error %v, got %v", ErrInvalidQuietWindow, err)
+			}
+		}
+	})
+
+	t.Run("pause", func(t *testing.T) {
+		t.Parallel()
+
+		// A window that starts and ends at midnight spans the whole day.
+		windows := []*QuietWindow{{Start: "00:00", End: "00:00"}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := waitQuietHours(ctx, windows, logrus.New()); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the requests to be paused, got %v", err)
+		}
+	})
+
+	t.Run("reduced rate", func(t *testing.T) {
+		t.Parallel()
+
+		windows := []*QuietWindow{{Start: "00:00", End: "00:00", Rate: 20}}
+		start := time.Now()
+
+		for i := 0; i < 3; i++ {
+			if err := waitQuietHours(context.Background(), windows, logrus.New()); err != nil {
+				t.Fatalf("expected the request to be limited, got %v", err)
+			}
+		}
+
+		// The first request is made immediately and the next two wait 50ms each.
+		if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+			t.Fatalf("expected the requests to be limited, took %v", elapsed)
+		}
+	})
+}
@@ -8,14 +8,25 @@
 package transport
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/proto"
 	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// defaultSingletonKey is the record field that keys singleton records if the request does not define one.
+const defaultSingletonKey = "id"
+
 // Request is the information needed to query the web API for data to transport.
 type Request struct {
 	// Method is the HTTP(s) method used to construct the http request to fetch data for storage.
@@ -28,6 +39,10 @@ type Request struct {
 	// Query represent the query params to apply to the URL generated by the request.
 	Query map[string]string
 
+	// QueryParams are the query params with a list of values, which are either repeated or joined into a single
+	// value, e.g. "symbol=BTC&symbol=ETH" or "symbols=BTC,ETH".
+	QueryParams []*QueryParam `yaml:"queryParams"`
+
 	// Timeseries indicates that the underlying data should be queries as a time series. This means that the
 	Timeseries *timeseries `yaml:"timeseries"`
 
@@ -37,31 +52,366 @@ type Request struct {
 	// Truncate before upserting on single request
 	Truncate *bool `yaml:"truncate"`
 
+	// TruncateScope will delete only the records within the scope of the request before upserting data, instead
+	// of truncating the entire table. Requests with a truncate scope are not truncated by "Truncate".
+	TruncateScope *TruncateScope `yaml:"truncateScope"`
+
+	// Split maps record paths in the response body to their own tables. This is used for endpoints that return
+	// several datasets in a single response, e.g. {"trades": [...], "orders": [...]}. If Split is defined, the
+	// response body will not be stored in "Table".
+	Split []*Split `yaml:"split"`
+
+	// ResponseHeaders are the response headers to capture, either into a field on every record of the response or
+	// into the metadata of the run, e.g. a pagination cursor or a request ID for auditing.
+	ResponseHeaders []*ResponseHeader `yaml:"responseHeaders"`
+
+	// Singleton indicates that the endpoint returns a single JSON object instead of an array of records, e.g. account
+	// information or the server status. The object is upserted as a single record keyed by "SingletonKey".
+	Singleton bool `yaml:"singleton"`
+
+	// SingletonKey is the record field that keys a singleton record, the default is "id". If the response object
+	// does not have the field, it is set to the name of the table so that every run updates the same record.
+	SingletonKey string `yaml:"singletonKey"`
+
+	// Staleness will reject and fetch the response again if its newest record is older than a maximum age.
+	Staleness *Staleness `yaml:"staleness"`
+
+	// Egress is the network route of the request, e.g. a proxy or a source IP. If the egress is not set, the request
+	// goes direct.
+	Egress *Egress `yaml:"egress"`
+
+	// RateLimitGroup is the name of the rate limit group of the request. Requests in the same group share a rate
+	// limiter, e.g. endpoints that share an upstream quota. If the group is not defined in the rate limit groups of
+	// the configuration, the group is limited by the rate limit of the configuration.
+	RateLimitGroup string `yaml:"rateLimitGroup"`
+
+	// RateLimit is the rate limit of the endpoint of the request, for endpoints with their own documented limits. The
+	// request gets a rate limiter of its own, which is shared by its timeseries chunks and by the other requests to
+	// the endpoint, instead of the limiter of the configuration. It can not be set with a rate limit group.
+	RateLimit *RateLimitConfig `yaml:"rateLimit"`
+
+	// Sink will stream the response to a file instead of upserting it into the repositories, e.g. for export
+	// endpoints that return multi-GB responses. The split, staleness, singleton, envelope, normalize, pagination,
+	// and response header settings do not apply to requests with a sink.
+	Sink *Sink `yaml:"sink"`
+
+	// Envelope unwraps the records of responses that wrap them with metadata, and extracts the pagination metadata
+	// of the response. If the envelope is not set, the response body is the records.
+	Envelope *Envelope `yaml:"envelope"`
+
+	// Normalize converts the locale formatted numbers, percent strings, and numbers with unit suffixes of the fields
+	// of the records into numbers before they are upserted.
+	Normalize []*Normalizer `yaml:"normalize"`
+
+	// IncludeFields are the only fields of the records that are stored, and ExcludeFields are the fields that are not
+	// stored, e.g. to avoid persisting sensitive fields. The fields are dot-separated paths, e.g. "user.email". The
+	// fields set from the response headers and the lineage of the run are always stored.
+	IncludeFields []string `yaml:"includeFields"`
+	ExcludeFields []string `yaml:"excludeFields"`
+
+	// Pagination pages through the records of the endpoint by incrementing an offset query param by a page size
+	// until a page has no records. Requests without a pagination follow the "next" links of the "Link" header of the
+	// responses, if they have one.
+	Pagination *Pagination `yaml:"pagination"`
+
+	// Retry is the policy for making the request again if it fails, instead of the retry policy of the configuration.
+	Retry *Retry `yaml:"retry"`
+
+	// Tags are labels of the request, e.g. ["prices", "daily"], so that a run can select a subset of the requests of
+	// the configuration with a "tags" selector.
+	Tags []string `yaml:"tags"`
+
+	// DependsOn are the tables that the request depends on. The request is not made until every request of the run
+	// that writes to the tables, including every chunk of a timeseries, is upserted.
+	DependsOn []string `yaml:"dependsOn"`
+
+	// Limits are the maximum size and number of records of the responses of the request, and what happens to the
+	// responses that exceed them. They do not apply to requests with a sink.
+	Limits *Limits `yaml:"limits"`
+
+	// Body is the body of the request, e.g. the filters of a search or a GraphQL query, which is JSON encoded. The
+	// default method of requests with a body is "POST".
+	Body interface{} `yaml:"body"`
+
+	// BodyTemplate is the body of the request as a Go template, which can use the template functions and the
+	// boundaries of the timeseries chunk of the request as "{{ .Start }}" and "{{ .End }}". It can not be set with a
+	// body.
+	BodyTemplate string `yaml:"bodyTemplate"`
+
+	// ContentType is the content type of the body of the request, the default is "application/json".
+	ContentType string `yaml:"contentType"`
+
+	// Headers are the headers of the request, e.g. "Accept: application/vnd.api+json" or an API version. They are
+	// merged with the headers of the configuration, and take precedence over them. The values can use templates.
+	Headers map[string]string `yaml:"headers"`
+
+	// Cache is how the request uses the cache of the configuration: "prefer", "never", or "refresh". The default is
+	// "prefer".
+	Cache CacheMode `yaml:"cache"`
+
+	// Foreach fans the request out into a request for every value at a path of the records of a table, which is
+	// rendered into the templates of the request as "{{ .Each }}".
+	Foreach *Foreach `yaml:"foreach"`
+
+	// each is the value of the foreach of the request, once it is expanded.
+	each string
+
+	// chunkBounds are the formatted boundaries of the timeseries chunk of the request, which are rendered into the
+	// body template.
+	chunkBounds *[2]string
+
 	// Chunks of requests should share a rate limiter, probably all of them; inheriting the rate limiter from the
 	// root configuration.
 	rateLimiter *rate.Limiter
 }
 
-// newFetchConfig will constrcut a new HTTP request from the transport request.
-func (req *Request) newFetchConfig(rurl url.URL, client *web.Client) *web.FetchConfig {
-	rurl.Path = path.Join(rurl.Path, req.Endpoint)
+// QueryParam is a query param with a list of values.
+type QueryParam struct {
+	// Name is the name of the query param.
+	Name string `yaml:"name"`
+
+	// Values are the values of the query param.
+	Values []string `yaml:"values"`
+
+	// Separator is used to join the values into a single value. The values are escaped, but the separator is not,
+	// so that APIs that expect a literal separator like "," receive it. If the separator is empty, the param is
+	// repeated for every value.
+	Separator string `yaml:"separator"`
+}
+
+// encode will encode the query param into URL query form.
+func (param *QueryParam) encode() string {
+	name := url.QueryEscape(param.Name)
+
+	values := make([]string, 0, len(param.Values))
+	for _, value := range param.Values {
+		values = append(values, url.QueryEscape(value))
+	}
+
+	if param.Separator == "" {
+		pairs := make([]string, 0, len(values))
+		for _, value := range values {
+			pairs = append(pairs, name+"="+value)
+		}
+
+		return strings.Join(pairs, "&")
+	}
+
+	return name + "=" + strings.Join(values, param.Separator)
+}
+
+// encodeQueryParams will encode the query params into URL query form, in the order they are defined.
+func encodeQueryParams(params []*QueryParam) string {
+	encoded := make([]string, 0, len(params))
+
+	for _, param := range params {
+		if len(param.Values) == 0 {
+			continue
+		}
+
+		encoded = append(encoded, param.encode())
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+// ResponseHeader is a mapping of a response header to the record field where its value should be stored.
+type ResponseHeader struct {
+	// Header is the canonical name of the response header, e.g. "CB-AFTER".
+	Header string `yaml:"header"`
+
+	// Field is the record field where the value of the header is stored. If the field is empty, the value is stored
+	// in the metadata of the run instead of the records.
+	Field string `yaml:"field"`
+}
+
+// Split is a mapping of a record path in a response body to the table where the records should be stored.
+type Split struct {
+	// Path is the dot-separated path to the records in the response body, e.g. "data.trades".
+	Path string `yaml:"path"`
+
+	// Table is the name of the table/collection to insert the records at "Path".
+	Table string `yaml:"table"`
+}
+
+// TruncateScope is the scope of records to delete before upserting data for a request.
+type TruncateScope struct {
+	// Required are the field values that a record must have to be deleted, e.g. {"product_id": "BTC-USD"}.
+	Required map[string]interface{} `yaml:"required"`
+
+	// TimeField is the record field that holds the timeseries time. For timeseries requests, the records where
+	// "TimeField" is within the range of a chunk are deleted before the chunk is upserted. The range is formatted
+	// with the timeseries layout.
+	TimeField string `yaml:"timeField"`
+}
+
+// newDeleteRequests will return the delete requests for the truncate scope of a request over the tables. If the
+// chunk is not nil, the delete requests are restricted to the chunk's time range.
+func (scope *TruncateScope) newDeleteRequests(tables []string, chunk *[2]string) ([]*proto.DeleteRequest, error) {
+	if scope == nil {
+		return nil, nil
+	}
+
+	required, err := structpb.NewStruct(scope.Required)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create truncate scope: %w", err)
+	}
+
+	reqs := make([]*proto.DeleteRequest, 0, len(tables))
+
+	for _, table := range tables {
+		req := &proto.DeleteRequest{Table: table, Required: required}
+		if chunk != nil && scope.TimeField != "" {
+			req.RangeField = scope.TimeField
+			req.RangeStart = chunk[0]
+			req.RangeEnd = chunk[1]
+		}
+
+		reqs = append(reqs, req)
+	}
+
+	return reqs, nil
+}
+
+// tables will return the names of all tables that data for the request is stored in.
+func (req *Request) tables() []string {
+	if len(req.Split) == 0 {
+		return []string{req.Table}
+	}
+
+	tables := make([]string, 0, len(req.Split))
+	for _, split := range req.Split {
+		tables = append(tables, split.Table)
+	}
+
+	return tables
+}
+
+// granularityTable will return the table name for a granularity. If the table is a template, then it is executed
+// with the granularity. Otherwise, the granularity is appended to the table name.
+func granularityTable(table, granularity string) (string, error) {
+	if !strings.Contains(table, "{{") {
+		return fmt.Sprintf("%s_%s", table, granularity), nil
+	}
+
+	tmpl, err := template.New("table").Funcs(templateFuncs).Parse(table)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse table template %q: %w", table, err)
+	}
+
+	var bldr strings.Builder
+	if err := tmpl.Execute(&bldr, struct{ Granularity string }{granularity}); err != nil {
+		return "", fmt.Errorf("unable to execute table template %q: %w", table, err)
+	}
+
+	return bldr.String(), nil
+}
+
+// expandGranularities will return a copy of the request for each of the timeseries granularities. If the request
+// has no granularities, the request itself is returned.
+func (req *Request) expandGranularities() ([]*Request, error) {
+	if req.Timeseries == nil || len(req.Timeseries.Granularities) == 0 {
+		return []*Request{req}, nil
+	}
+
+	if req.Timeseries.GranularityName == "" {
+		return nil, MissingTimeseriesFieldError("granularityName")
+	}
+
+	requests := make([]*Request, 0, len(req.Timeseries.Granularities))
+
+	for _, granularity := range req.Timeseries.Granularities {
+		expanded := *req
+
+		timeseries := *req.Timeseries
+		timeseries.Granularities = nil
+		expanded.Timeseries = &timeseries
+
+		expanded.Query = make(map[string]string, len(req.Query)+1)
+		for key, value := range req.Query {
+			expanded.Query[key] = value
+		}
+
+		expanded.Query[timeseries.GranularityName] = granularity
+
+		var err error
+
+		expanded.Table, err = granularityTable(req.Table, granularity)
+		if err != nil {
+			return nil, err
+		}
+
+		expanded.Split = make([]*Split, 0, len(req.Split))
+
+		for _, split := range req.Split {
+			table, err := granularityTable(split.Table, granularity)
+			if err != nil {
+				return nil, err
+			}
+
+			expanded.Split = append(expanded.Split, &Split{Path: split.Path, Table: table})
+		}
+
+		requests = append(requests, &expanded)
+	}
+
+	return requests, nil
+}
+
+// newFetchConfig will constrcut a new HTTP request from the transport request. The templates in the request values are
+// executed for every fetch config.
+func (req *Request) newFetchConfig(rurl url.URL, client *web.Client) (*web.FetchConfig, error) {
+	rendered, err := req.render()
+	if err != nil {
+		return nil, err
+	}
+
+	body, contentType, err := req.newBody(req.chunkBounds)
+	if err != nil {
+		return nil, err
+	}
+
+	rurl.Path = path.Join(rurl.Path, rendered.Endpoint)
 
 	// Add the query params to the URL.
-	if req.Query != nil {
+	if rendered.Query != nil {
 		query := rurl.Query()
-		for key, value := range req.Query {
+		for key, value := range rendered.Query {
 			query.Set(key, value)
 		}
 
 		rurl.RawQuery = query.Encode()
 	}
 
-	return &web.FetchConfig{
-		Method:      req.Method,
+	// The query params are appended to the encoded query, so that their separators are not escaped.
+	if params := encodeQueryParams(rendered.QueryParams); params != "" {
+		if rurl.RawQuery != "" {
+			rurl.RawQuery += "&"
+		}
+
+		rurl.RawQuery += params
+	}
+
+	fetchConfig := &web.FetchConfig{
+		Method:      rendered.Method,
 		URL:         &rurl,
 		C:           client,
-		RateLimiter: req.rateLimiter,
+		RateLimiter: rendered.rateLimiter,
+	}
+
+	if body != nil {
+		fetchConfig.Body = body
+		fetchConfig.ContentType = contentType
 	}
+
+	if len(rendered.Headers) > 0 {
+		fetchConfig.Header = make(http.Header, len(rendered.Headers))
+		for key, value := range rendered.Headers {
+			fetchConfig.Header.Set(key, value)
+		}
+	}
+
+	return fetchConfig, nil
 }
 
 // flattenedRequest contains all of the request information to create a web job. The number of flattened request  for an
@@ -69,36 +419,213 @@ func (req *Request) newFetchConfig(rurl url.URL, client *web.Client) *web.FetchC
 type flattenedRequest struct {
 	fetchConfig *web.FetchConfig
 	table       string
+	split       []*Split
+
+	// deletes are the requests to delete the records in the scope of the request before upserting.
+	deletes []*proto.DeleteRequest
+
+	// headers are the response headers to capture.
+	headers []*ResponseHeader
+
+	// singletonKey is the key field of a singleton response. It is empty if the response is not a singleton.
+	singletonKey string
+
+	// staleness guards against upserting stale responses.
+	staleness *Staleness
+
+	// chunk is the time range of the request, if the request is a timeseries chunk.
+	chunk *[2]time.Time
+
+	// egress is the network route of the request.
+	egress *Egress
+
+	// rateLimitGroup is the key of the rate limiter of the request, see limiterKey.
+	rateLimitGroup string
+
+	// sink is the file the response is streamed to, instead of the repositories.
+	sink *Sink
+
+	// concurrency limits the number of chunks of the timeseries request that are fetched at the same time. It is
+	// shared by the chunks of the request, and nil if there is no limit.
+	concurrency chan struct{}
+
+	// envelope unwraps the records of the response.
+	envelope *Envelope
+
+	// normalizers convert the fields of the records before they are upserted.
+	normalizers []*Normalizer
+
+	// projection selects the fields of the records that are upserted.
+	projection *projection
+
+	// pagination pages through the records of the request.
+	pagination *Pagination
+
+	// retry is the retry policy of the request, or nil if it uses the policy of the configuration.
+	retry *Retry
+
+	// dependsOn are the tables that must be upserted before the request is made.
+	dependsOn []string
+
+	// limits are the guardrails of the responses of the request.
+	limits *Limits
+
+	// cacheMode is how the request uses the cache of the configuration.
+	cacheMode CacheMode
+
+	// downsample aggregates the candles of the timeseries of the request at coarser granularities.
+	downsample *Downsample
+
+	// bisect splits the chunk of the request into smaller ranges if it times out.
+	bisect *chunkBisect
+
+	// foreach is the request of a foreach, which holds the place of its requests until they are expanded with the
+	// values of its table.
+	foreach *foreachRequest
+
+	// linked are the URLs of the pages of the request that its responses linked to, which is shared by the pages of
+	// the request. It is nil if the response of the request did not link to a next page.
+	linked map[string]bool
+}
+
+// acquire will wait until the request can be fetched without exceeding the concurrency of its timeseries, returning a
+// function that releases the request's slot.
+func (req *flattenedRequest) acquire(ctx context.Context) (func(), error) {
+	if req.concurrency == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case req.concurrency <- struct{}{}:
+		return func() { <-req.concurrency }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("unable to acquire chunk concurrency: %w", ctx.Err())
+	}
+}
+
+// endpointLimiterPrefix prefixes the endpoint of requests with a rate limit of their own in the keys of the rate
+// limiters, so that they do not share a limiter with a rate limit group.
+const endpointLimiterPrefix = "endpoint:"
+
+// validateRateLimit will ensure that the rate limit of the request is valid.
+func (req *Request) validateRateLimit() error {
+	if req.RateLimit == nil {
+		return nil
+	}
+
+	if req.RateLimitGroup != "" {
+		return fmt.Errorf("%w: request %q has a rate limit and a rate limit group", ErrInvalidRateLimit,
+			req.Endpoint)
+	}
+
+	if err := req.RateLimit.validate(); err != nil {
+		return fmt.Errorf("%w: request %q: %s", ErrInvalidRateLimit, req.Endpoint, err.Error())
+	}
+
+	return nil
+}
+
+// limiterKey will return the key of the rate limiter of the request: the endpoint if the request has a rate limit of
+// its own, otherwise the rate limit group.
+func (req *Request) limiterKey() string {
+	if req.RateLimit != nil {
+		return endpointLimiterPrefix + req.Endpoint
+	}
+
+	return req.RateLimitGroup
+}
+
+// tables will return the names of all tables that data for the flattened request is stored in.
+func (req *flattenedRequest) tables() []string {
+	if len(req.split) == 0 {
+		return []string{req.table}
+	}
+
+	tables := make([]string, 0, len(req.split))
+	for _, split := range req.split {
+		tables = append(tables, split.Table)
+	}
+
+	return tables
+}
+
+// singletonKey will return the key field of singleton responses, or an empty string if the request is not a singleton.
+func (req *Request) singletonKey() string {
+	if !req.Singleton {
+		return ""
+	}
+
+	if req.SingletonKey == "" {
+		return defaultSingletonKey
+	}
+
+	return req.SingletonKey
 }
 
 // flatten will compress the request information into a "web.FetchConfig" request and a "table" name for storage
 // interaction.
-func (req *Request) flatten(rurl url.URL, client *web.Client) *flattenedRequest {
-	fetchConfig := req.newFetchConfig(rurl, client)
+func (req *Request) flatten(rurl url.URL, client *web.Client) (*flattenedRequest, error) {
+	fetchConfig, err := req.newFetchConfig(rurl, client)
+	if err != nil {
+		return nil, err
+	}
 
-	return &flattenedRequest{
-		fetchConfig: fetchConfig,
-		table:       req.Table,
+	deletes, err := req.TruncateScope.newDeleteRequests(req.tables(), nil)
+	if err != nil {
+		return nil, err
 	}
+
+	return &flattenedRequest{
+		fetchConfig:    fetchConfig,
+		table:          req.Table,
+		split:          req.Split,
+		deletes:        deletes,
+		headers:        req.ResponseHeaders,
+		singletonKey:   req.singletonKey(),
+		staleness:      req.Staleness,
+		egress:         req.Egress,
+		rateLimitGroup: req.limiterKey(),
+		sink:           req.Sink,
+		envelope:       req.Envelope,
+		normalizers:    req.Normalize,
+		projection:     req.projection(),
+		pagination:     req.Pagination,
+		retry:          req.Retry,
+		dependsOn:      req.DependsOn,
+		limits:         req.Limits,
+		cacheMode:      req.Cache,
+	}, nil
 }
 
 // flattenTimeseries will compress the request information into a "web.FetchConfig" request and a "table" name for
 // storage interaction. This function will create a flattened request for each time series in the request. If no
 // timeseries are defined, this function will return a single flattened request.
+//
+// The request is not mutated by this method, so it is safe to flatten the same request from concurrent operations.
 func (req *Request) flattenTimeseries(rurl url.URL, client *web.Client) ([]*flattenedRequest, error) {
-	timeseries := req.Timeseries
-	if timeseries == nil {
-		flatReq := req.flatten(rurl, client)
+	if req.Timeseries == nil {
+		flatReq, err := req.flatten(rurl, client)
+		if err != nil {
+			return nil, err
+		}
 
 		return []*flattenedRequest{flatReq}, nil
 	}
 
-	requests := make([]*flattenedRequest, 0, len(timeseries.chunks))
+	// Copy the timeseries so that chunking does not leak state between operations.
+	timeseries := *req.Timeseries
+	timeseries.chunks = nil
+
+	// Render the query so that the timeseries range can be defined with templates, e.g. relative to "now".
+	rendered, err := req.render()
+	if err != nil {
+		return nil, err
+	}
 
 	// Add the query params to the URL.
-	if req.Query != nil {
+	if rendered.Query != nil {
 		query := rurl.Query()
-		for key, value := range req.Query {
+		for key, value := range rendered.Query {
 			query.Set(key, value)
 		}
 
@@ -109,19 +636,84 @@ func (req *Request) flattenTimeseries(rurl url.URL, client *web.Client) ([]*flat
 		return nil, fmt.Errorf("failed to set time series chunks: %w", err)
 	}
 
+	requests := make([]*flattenedRequest, 0, len(timeseries.chunks))
+
+	var concurrency chan struct{}
+	if timeseries.Concurrency > 0 {
+		concurrency = make(chan struct{}, timeseries.Concurrency)
+	}
+
 	for _, chunk := range timeseries.chunks {
 		// copy the request and update it to reflect the partitioned timeseries
-		chunkReq := req
-		chunkReq.Query[timeseries.StartName] = chunk[0].Format(*timeseries.Layout)
-		chunkReq.Query[timeseries.EndName] = chunk[1].Format(*timeseries.Layout)
+		chunkReq := *req
+		chunkReq.Query = make(map[string]string, len(req.Query)+2)
+
+		for key, value := range req.Query {
+			chunkReq.Query[key] = value
+		}
 
-		fetchConfig := chunkReq.newFetchConfig(rurl, client)
+		bounds := [2]string{chunk[0].Format(*timeseries.Layout), chunk[1].Format(*timeseries.Layout)}
+		chunkReq.Query[timeseries.StartName] = bounds[0]
+		chunkReq.Query[timeseries.EndName] = bounds[1]
+		chunkReq.chunkBounds = &bounds
+
+		fetchConfig, err := chunkReq.newFetchConfig(rurl, client)
+		if err != nil {
+			return nil, err
+		}
+
+		deletes, err := req.TruncateScope.newDeleteRequests(req.tables(), &bounds)
+		if err != nil {
+			return nil, err
+		}
 
 		requests = append(requests, &flattenedRequest{
-			fetchConfig: fetchConfig,
-			table:       req.Table,
+			fetchConfig:    fetchConfig,
+			table:          req.Table,
+			split:          req.Split,
+			deletes:        deletes,
+			headers:        req.ResponseHeaders,
+			singletonKey:   req.singletonKey(),
+			staleness:      req.Staleness,
+			chunk:          &[2]time.Time{chunk[0], chunk[1]},
+			egress:         req.Egress,
+			rateLimitGroup: req.limiterKey(),
+			sink:           req.Sink,
+			concurrency:    concurrency,
+			envelope:       req.Envelope,
+			normalizers:    req.Normalize,
+			projection:     req.projection(),
+			pagination:     req.Pagination,
+			retry:          req.Retry,
+			dependsOn:      req.DependsOn,
+			limits:         req.Limits,
+			cacheMode:      req.Cache,
+			downsample:     timeseries.Downsample,
+			bisect:         timeseries.chunkBisect(),
 		})
 	}
 
 	return requests, nil
 }
+
+// singletonRecord will validate that the JSON encoded data is a single object and key it, setting the key field to the
+// name of the table if the object does not have one.
+func singletonRecord(data []byte, key, table string) ([]byte, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, SingletonNotObjectError(table)
+	}
+
+	if _, ok := record[key]; ok {
+		return data, nil
+	}
+
+	record[key] = table
+
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal singleton record: %w", err)
+	}
+
+	return bytes, nil
+}
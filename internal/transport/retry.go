@@ -0,0 +1,206 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultRetryMaxAttempts is the number of attempts of a request, including the first, if the retry policy does
+	// not define one.
+	defaultRetryMaxAttempts = 3
+
+	// defaultRetryBaseDelay and defaultRetryMaxDelay are the delays before the first retry and the maximum delay
+	// between retries, if the retry policy does not define them.
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
+
+	// retryJitterDivisor is the divisor of the delay that is jittered, so that a delay is at least half of the
+	// exponential delay.
+	retryJitterDivisor = 2
+)
+
+// defaultRetryStatusCodes are the response status codes that are retried if the retry policy does not define them.
+var defaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// ErrInvalidRetry is returned when a retry policy in the configuration is invalid.
+var ErrInvalidRetry = fmt.Errorf("invalid retry policy")
+
+// InvalidRetryError wraps an error with ErrInvalidRetry.
+func InvalidRetryError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRetry, msg)
+}
+
+// Retry is the policy for making a failed web request again, instead of failing the operation. A request is retried
+// if the connection fails or the web API responds with one of the retryable status codes. The delay before each retry
+// doubles from the base delay up to the maximum delay, and is jittered so that the requests that failed together are
+// not retried together.
+type Retry struct {
+	// MaxAttempts is the maximum number of attempts of a request, including the first. The default is 3.
+	MaxAttempts int `yaml:"maxAttempts" json:"maxAttempts,omitempty"`
+
+	// BaseDelay is the delay before the first retry, the default is 500ms.
+	BaseDelay time.Duration `yaml:"baseDelay" json:"baseDelay,omitempty"`
+
+	// MaxDelay is the maximum delay before a retry, the default is 30s.
+	MaxDelay time.Duration `yaml:"maxDelay" json:"maxDelay,omitempty"`
+
+	// StatusCodes are the response status codes that are retried. The default is 408, 429, 500, 502, 503, and 504.
+	StatusCodes []int `yaml:"statusCodes" json:"statusCodes,omitempty"`
+}
+
+// validate will ensure that the retry policy is well defined.
+func (retry *Retry) validate() error {
+	if retry == nil {
+		return nil
+	}
+
+	if retry.MaxAttempts < 0 || retry.BaseDelay < 0 || retry.MaxDelay < 0 {
+		return InvalidRetryError("max attempts and delays can not be negative")
+	}
+
+	if retry.BaseDelay > 0 && retry.MaxDelay > 0 && retry.BaseDelay > retry.MaxDelay {
+		return InvalidRetryError(fmt.Sprintf("base delay %v is greater than max delay %v", retry.BaseDelay,
+			retry.MaxDelay))
+	}
+
+	for _, code := range retry.StatusCodes {
+		if code < http.StatusContinue || code > http.StatusNetworkAuthenticationRequired {
+			return InvalidRetryError(fmt.Sprintf("invalid status code %d", code))
+		}
+	}
+
+	return nil
+}
+
+func (retry *Retry) maxAttempts() int {
+	if retry.MaxAttempts == 0 {
+		return defaultRetryMaxAttempts
+	}
+
+	return retry.MaxAttempts
+}
+
+func (retry *Retry) baseDelay() time.Duration {
+	if retry.BaseDelay == 0 {
+		return defaultRetryBaseDelay
+	}
+
+	return retry.BaseDelay
+}
+
+func (retry *Retry) maxDelay() time.Duration {
+	if retry.MaxDelay == 0 {
+		return defaultRetryMaxDelay
+	}
+
+	return retry.MaxDelay
+}
+
+// retryable will return true if the error of a request can be retried: the web API responded with a retryable status
+// code or the request did not reach it.
+func (retry *Retry) retryable(err error) bool {
+	var rspErr *web.ResponseError
+	if errors.As(err, &rspErr) {
+		codes := retry.StatusCodes
+		if codes == nil {
+			codes = defaultRetryStatusCodes
+		}
+
+		for _, code := range codes {
+			if code == rspErr.StatusCode {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var urlErr *url.Error
+
+	return errors.As(err, &urlErr)
+}
+
+// backoff will return the jittered delay before the retry after the attempt. The delay is between half and all of the
+// exponential delay of the attempt.
+func (retry *Retry) backoff(attempt int) time.Duration {
+	delay := retry.baseDelay()
+	for a := 1; a < attempt && delay < retry.maxDelay(); a++ {
+		delay *= 2
+	}
+
+	if delay > retry.maxDelay() {
+		delay = retry.maxDelay()
+	}
+
+	half := delay / retryJitterDivisor
+
+	jitter, err := rand.Int(rand.Reader, big.NewInt(int64(half)+1))
+	if err != nil {
+		return delay
+	}
+
+	return half + time.Duration(jitter.Int64())
+}
+
+// fetch will make the web request, retrying it with the policy until it succeeds or the attempts are exhausted. A nil
+// policy makes the request once. The time of every attempt is added to the timings.
+func (retry *Retry) fetch(ctx context.Context, cfg *web.FetchConfig, logger *logrus.Logger,
+	timings *timingCounters,
+) (*web.FetchResponse, error) {
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+
+		rsp, err := web.Fetch(ctx, cfg)
+		timings.addResponse(rsp, time.Since(start))
+		if err == nil || retry == nil || attempt >= retry.maxAttempts() || !retry.retryable(err) || ctx.Err() != nil {
+			return rsp, err
+		}
+
+		// Throttled requests are retried after the delay of the web API, instead of the backoff.
+		if _, throttled := retryAfter(err, time.Now()); throttled {
+			return rsp, err
+		}
+
+		delay := retry.backoff(attempt)
+
+		logWarn := tools.LogEvent{
+			Msg:     "retrying request",
+			URL:     cfg.URL.Redacted(),
+			Delay:   delay,
+			Attempt: attempt,
+			Err:     err,
+		}
+		logWarn.Log(logger, logrus.WarnLevel)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("unable to retry request: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
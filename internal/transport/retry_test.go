@@ -0,0 +1,170 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name  string
+			retry *Retry
+			err   error
+		}{
+			{"nil", nil, nil},
+			{"defaults", &Retry{}, nil},
+			{"valid", &Retry{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, StatusCodes: []int{503}}, nil},
+			{"negative attempts", &Retry{MaxAttempts: -1}, ErrInvalidRetry},
+			{"base above max", &Retry{BaseDelay: time.Minute, MaxDelay: time.Second}, ErrInvalidRetry},
+			{"status code", &Retry{StatusCodes: []int{42}}, ErrInvalidRetry},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tcase.retry.validate(); !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("retryable", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name     string
+			retry    *Retry
+			err      error
+			expected bool
+		}{
+			{"default status", &Retry{}, &web.ResponseError{StatusCode: http.StatusServiceUnavailable}, true},
+			{"not found", &Retry{}, &web.ResponseError{StatusCode: http.StatusNotFound}, false},
+			{"configured status", &Retry{StatusCodes: []int{http.StatusNotFound}},
+				fmt.Errorf("wrapped: %w", &web.ResponseError{StatusCode: http.StatusNotFound}), true},
+			{"connection", &Retry{}, &url.Error{Op: "Get", URL: "https://api.test.com", Err: errors.New("refused")}, true},
+			{"decode", &Retry{}, errors.New("unable to decode"), false},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				if retryable := tcase.retry.retryable(tcase.err); retryable != tcase.expected {
+					t.Fatalf("expected retryable %v, got %v", tcase.expected, retryable)
+				}
+			})
+		}
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		t.Parallel()
+
+		retry := &Retry{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+		for _, tcase := range []struct {
+			attempt int
+			delay   time.Duration
+		}{
+			{1, 100 * time.Millisecond},
+			{2, 200 * time.Millisecond},
+			{4, 800 * time.Millisecond},
+			{10, time.Second},
+		} {
+			for i := 0; i < 10; i++ {
+				if delay := retry.backoff(tcase.attempt); delay < tcase.delay/2 || delay > tcase.delay {
+					t.Fatalf("expected the delay of attempt %d to be within [%v, %v], got %v", tcase.attempt,
+						tcase.delay/2, tcase.delay, delay)
+				}
+			}
+		}
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name     string
+			retry    *Retry
+			failures int32
+			status   int
+			calls    int32
+			err      error
+		}{
+			{"no policy", nil, 1, http.StatusServiceUnavailable, 1, web.ErrGettingResponse},
+			{"recovers", &Retry{BaseDelay: time.Millisecond}, 2, http.StatusServiceUnavailable, 3, nil},
+			{"exhausted", &Retry{MaxAttempts: 2, BaseDelay: time.Millisecond}, 5, http.StatusBadGateway, 2,
+				web.ErrGettingResponse},
+			{"not retryable", &Retry{BaseDelay: time.Millisecond}, 1, http.StatusNotFound, 1, web.ErrGettingResponse},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				var calls int32
+
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if atomic.AddInt32(&calls, 1) <= tcase.failures {
+						w.WriteHeader(tcase.status)
+
+						return
+					}
+
+					fmt.Fprint(w, `[]`)
+				}))
+				t.Cleanup(server.Close)
+
+				client, err := web.NewClient(context.Background(), http.DefaultTransport)
+				if err != nil {
+					t.Fatalf("error creating client: %v", err)
+				}
+
+				rurl, _ := url.Parse(server.URL)
+				cfg := &web.FetchConfig{
+					C:           client,
+					Method:      http.MethodGet,
+					URL:         rurl,
+					RateLimiter: rate.NewLimiter(rate.Inf, 1),
+				}
+
+				rsp, err := tcase.retry.fetch(context.Background(), cfg, logrus.New(), nil)
+				if !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+
+				if rsp != nil {
+					rsp.Body.Close()
+				}
+
+				if got := atomic.LoadInt32(&calls); got != tcase.calls {
+					t.Fatalf("expected %d calls, got %d", tcase.calls, got)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"path"
+)
+
+// ErrInvalidRoute is returned when a route in the configuration is invalid.
+var ErrInvalidRoute = fmt.Errorf("invalid route")
+
+// InvalidRouteError wraps an error with ErrInvalidRoute.
+func InvalidRouteError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRoute, msg)
+}
+
+// Route restricts the tables that are written to a storage, e.g. to write raw payloads to one storage and normalized
+// records to another. A storage with routes only receives the tables that match one of its routes, and a storage
+// without routes receives every table.
+type Route struct {
+	// ConnectionString is the connection string of the storage, as it appears in the connection strings of the
+	// configuration.
+	ConnectionString string `yaml:"connectionString"`
+
+	// Tables are the names of the tables written to the storage. Names can be glob patterns, e.g. "raw_*".
+	Tables []string `yaml:"tables"`
+}
+
+// matches will return true if the table matches one of the tables of the route.
+func (route *Route) matches(table string) bool {
+	for _, pattern := range route.Tables {
+		// The patterns are validated with the configuration, so the error can be ignored.
+		if ok, _ := path.Match(pattern, table); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate will ensure that the route is for a storage of the configuration and that its patterns are valid.
+func (route *Route) validate(connectionStrings []string) error {
+	var found bool
+
+	for _, dns := range connectionStrings {
+		if dns == route.ConnectionString {
+			found = true
+
+			break
+		}
+	}
+
+	if !found {
+		return InvalidRouteError("connection string is not in the connection strings of the configuration")
+	}
+
+	for _, pattern := range route.Tables {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return InvalidRouteError(fmt.Sprintf("table pattern %q: %v", pattern, err))
+		}
+	}
+
+	return nil
+}
+
+// routing decides which tables are written to the repositories of an operation. The repositories are in the order of
+// the connection strings of the configuration.
+type routing struct {
+	connectionStrings []string
+	routes            []*Route
+}
+
+func (cfg *Config) routing() *routing {
+	return &routing{connectionStrings: cfg.ConnectionStrings, routes: cfg.Routes}
+}
+
+// accepts will return true if the table is written to the repository at the index.
+func (rtg *routing) accepts(repo int, table string) bool {
+	if rtg == nil || repo >= len(rtg.connectionStrings) {
+		return true
+	}
+
+	var routed bool
+
+	for _, route := range rtg.routes {
+		if route.ConnectionString != rtg.connectionStrings[repo] {
+			continue
+		}
+
+		if route.matches(table) {
+			return true
+		}
+
+		routed = true
+	}
+
+	return !routed
+}
+
+// filter will return the tables that are written to the repository at the index.
+func (rtg *routing) filter(repo int, tables []string) []string {
+	filtered := make([]string, 0, len(tables))
+
+	for _, table := range tables {
+		if rtg.accepts(repo, table) {
+			filtered = append(filtered, table)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,446 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/repository"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultRunStatsTable is the default table of the statistics of the runs.
+	defaultRunStatsTable = "gidari_run_stats"
+
+	// defaultRunStatsHistory is the default number of previous runs that the latest run is compared with.
+	defaultRunStatsHistory = 10
+
+	// defaultRunStatsMaxDrop is the default fraction that the records of a table can drop by before it is anomalous.
+	defaultRunStatsMaxDrop = 0.5
+)
+
+// ErrInvalidRunStats is returned when the run statistics of the configuration are invalid.
+var ErrInvalidRunStats = fmt.Errorf("invalid run stats")
+
+// InvalidRunStatsError wraps an error with ErrInvalidRunStats.
+func InvalidRunStatsError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRunStats, msg)
+}
+
+// RunStats persists the number of records of every table of a run into a statistics table, on the transactions of the
+// run, so that the latest run can be compared with the previous runs with "Compare". A table whose records drop by
+// more than the maximum drop from the previous runs often indicates a silent change of the web API, e.g. a renamed
+// field of an envelope or a smaller default page size.
+type RunStats struct {
+	// Table is the table of the statistics, the default is "gidari_run_stats". It is created if it does not exist.
+	Table string `yaml:"table"`
+
+	// History is the number of previous runs that the latest run is compared with, the default is 10.
+	History int `yaml:"history"`
+
+	// MaxDrop is the fraction that the records of a table can drop by from the median of the previous runs before
+	// the table is anomalous, the default is 0.5.
+	MaxDrop float64 `yaml:"maxDrop"`
+}
+
+// validate will ensure that the run statistics are valid.
+func (stats *RunStats) validate() error {
+	if stats == nil {
+		return nil
+	}
+
+	if stats.History < 0 {
+		return InvalidRunStatsError("history must not be negative")
+	}
+
+	if stats.MaxDrop < 0 || stats.MaxDrop >= 1 {
+		return InvalidRunStatsError("maxDrop must be at least 0 and less than 1")
+	}
+
+	return nil
+}
+
+// table will return the table of the statistics.
+func (stats *RunStats) table() string {
+	if stats.Table == "" {
+		return defaultRunStatsTable
+	}
+
+	return stats.Table
+}
+
+// history will return the number of previous runs that the latest run is compared with.
+func (stats *RunStats) history() int {
+	if stats.History == 0 {
+		return defaultRunStatsHistory
+	}
+
+	return stats.History
+}
+
+// maxDrop will return the fraction that the records of a table can drop by before it is anomalous.
+func (stats *RunStats) maxDrop() float64 {
+	if stats.MaxDrop == 0 {
+		return defaultRunStatsMaxDrop
+	}
+
+	return stats.MaxDrop
+}
+
+// createTableRequest will return the request to create the statistics table.
+func (stats *RunStats) createTableRequest() *proto.CreateTableRequest {
+	return &proto.CreateTableRequest{
+		Table: stats.table(),
+		Columns: []*proto.Column{
+			{Name: "id", Type: "string", Required: true},
+			{Name: "runId", Type: "string", Required: true},
+			{Name: "tableName", Type: "string", Required: true},
+			{Name: "records", Type: "integer", Required: true},
+			{Name: "upserted", Type: "integer", Required: true},
+			{Name: "matched", Type: "integer", Required: true},
+			{Name: "recordErrors", Type: "integer", Required: true},
+			{Name: "startedAt", Type: "timestamp", Required: true},
+			{Name: "completedAt", Type: "timestamp", Required: true},
+		},
+		PrimaryKeys: []string{"id"},
+	}
+}
+
+// runStatsEntry is a record of the statistics table, with the counts of a table of a run over every repository.
+type runStatsEntry struct {
+	ID           string `json:"id"`
+	RunID        string `json:"runId"`
+	TableName    string `json:"tableName"`
+	Records      int64  `json:"records"`
+	Upserted     int64  `json:"upserted"`
+	Matched      int64  `json:"matched"`
+	RecordErrors int64  `json:"recordErrors"`
+	StartedAt    string `json:"startedAt"`
+	CompletedAt  string `json:"completedAt"`
+}
+
+// entries will return the statistics of the tables of the run. The tables that the run did not upsert any records
+// into have statistics with no records, since a table that stops receiving records is the most anomalous drop.
+func (stats *RunStats) entries(result *UpsertResult, tables map[string]bool, start, end time.Time) []*runStatsEntry {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+
+	names := make([]string, 0, len(tables)+len(result.Tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+
+	for table := range result.Tables {
+		if !tables[table] {
+			names = append(names, table)
+		}
+	}
+
+	sort.Strings(names)
+
+	entries := make([]*runStatsEntry, 0, len(names))
+
+	for _, table := range names {
+		if table == stats.table() {
+			continue
+		}
+
+		rsp := result.Tables[table]
+		entries = append(entries, &runStatsEntry{
+			ID:           result.RunID + "/" + table,
+			RunID:        result.RunID,
+			TableName:    table,
+			Records:      rsp.GetUpsertedCount() + rsp.GetMatchedCount(),
+			Upserted:     rsp.GetUpsertedCount(),
+			Matched:      rsp.GetMatchedCount(),
+			RecordErrors: int64(len(rsp.GetErrors())),
+			StartedAt:    start.UTC().Format(time.RFC3339Nano),
+			CompletedAt:  end.UTC().Format(time.RFC3339Nano),
+		})
+	}
+
+	return entries
+}
+
+// transactRunStats will upsert the statistics of the run into the statistics table of every repository, on the
+// transactions of the run. The counts of the upserts are only complete once the transactions have executed them, so
+// the transactions are flushed first.
+func transactRunStats(ctx context.Context, cfg *repoConfig, stats *RunStats, tables map[string]bool,
+	start time.Time,
+) error {
+	if stats == nil {
+		return nil
+	}
+
+	cfg.flush(ctx)
+
+	data, err := json.Marshal(stats.entries(cfg.result, tables, start, time.Now()))
+	if err != nil {
+		return fmt.Errorf("unable to encode run stats: %w", err)
+	}
+
+	for _, repo := range cfg.repos {
+		if _, err := repo.CreateTable(ctx, stats.createTableRequest()); err != nil {
+			return fmt.Errorf("unable to create run stats table %q: %w", stats.table(), err)
+		}
+
+		req := &proto.UpsertRequest{Table: stats.table(), Data: data, DataType: int32(tools.UpsertDataJSON)}
+
+		repo.TransactContext(ctx, func(sctx context.Context, repo repository.Generic) error {
+			sctx, cancel := cfg.withTimeout(sctx)
+			defer cancel()
+
+			if _, err := repo.Upsert(sctx, req); err != nil {
+				return fmt.Errorf("unable to upsert run stats: %w", err)
+			}
+
+			return nil
+		})
+	}
+
+	return nil
+}
+
+// TableComparison compares the records of a table in the latest run with the previous runs.
+type TableComparison struct {
+	// Table is the name of the table.
+	Table string
+
+	// Records is the number of records of the table in the latest run, over every repository.
+	Records int64
+
+	// Previous are the numbers of records of the table in the previous runs that have it, from the oldest to the
+	// most recent.
+	Previous []int64
+
+	// Baseline is the median of the previous numbers of records.
+	Baseline float64
+
+	// Change is the fraction that the records changed by from the baseline, e.g. -0.75 for a drop of 75%. It is 0 if
+	// there is no baseline.
+	Change float64
+
+	// Anomalous is true if the records dropped by more than the maximum drop of the run statistics.
+	Anomalous bool
+}
+
+// RunComparison is the result of a compare operation.
+type RunComparison struct {
+	// RunID is the ID of the latest run.
+	RunID string
+
+	// CompletedAt is the time that the latest run completed.
+	CompletedAt time.Time
+
+	// PreviousRuns are the IDs of the previous runs that the latest run is compared with, from the oldest to the
+	// most recent.
+	PreviousRuns []string
+
+	// Tables are the comparisons of the tables of the latest and previous runs, sorted by table.
+	Tables []*TableComparison
+}
+
+// Anomalies will return the sorted tables whose records dropped by more than the maximum drop.
+func (comparison *RunComparison) Anomalies() []string {
+	var tables []string
+
+	for _, table := range comparison.Tables {
+		if table.Anomalous {
+			tables = append(tables, table.Table)
+		}
+	}
+
+	return tables
+}
+
+// runStatsRun is the statistics of the tables of a run, read from the statistics table.
+type runStatsRun struct {
+	id          string
+	completedAt time.Time
+	records     map[string]int64
+}
+
+// readRunStats will read the runs of the statistics table, sorted by the time that they completed.
+func readRunStats(ctx context.Context, scanner tableScanner, table string) ([]*runStatsRun, error) {
+	byID := make(map[string]*runStatsRun)
+
+	err := scanner.Scan(ctx, table, func(record map[string]interface{}) error {
+		runID, _ := record["runId"].(string)
+		tableName, _ := record["tableName"].(string)
+
+		completedAt, err := time.Parse(time.RFC3339Nano, fmt.Sprint(record["completedAt"]))
+		if err != nil {
+			return fmt.Errorf("unable to parse completedAt of run %q: %w", runID, err)
+		}
+
+		run, ok := byID[runID]
+		if !ok {
+			run = &runStatsRun{id: runID, completedAt: completedAt, records: make(map[string]int64)}
+			byID[runID] = run
+		}
+
+		run.records[tableName] = runStatsInt(record["records"])
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan table %q: %w", table, err)
+	}
+
+	runs := make([]*runStatsRun, 0, len(byID))
+	for _, run := range byID {
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].completedAt.Equal(runs[j].completedAt) {
+			return runs[i].completedAt.Before(runs[j].completedAt)
+		}
+
+		return runs[i].id < runs[j].id
+	})
+
+	return runs, nil
+}
+
+// runStatsInt will return the integer of a number read from a storage, which decodes numbers with different types.
+func runStatsInt(val interface{}) int64 {
+	switch val := val.(type) {
+	case float64:
+		return int64(val)
+	case int64:
+		return val
+	case int32:
+		return int64(val)
+	case int:
+		return int64(val)
+	default:
+		return 0
+	}
+}
+
+// compareRuns will compare the latest run with the previous runs, up to the history of the statistics.
+func (stats *RunStats) compareRuns(runs []*runStatsRun) *RunComparison {
+	if len(runs) == 0 {
+		return &RunComparison{}
+	}
+
+	latest := runs[len(runs)-1]
+
+	previous := runs[:len(runs)-1]
+	if len(previous) > stats.history() {
+		previous = previous[len(previous)-stats.history():]
+	}
+
+	comparison := &RunComparison{RunID: latest.id, CompletedAt: latest.completedAt}
+
+	tables := make(map[string]bool)
+	for table := range latest.records {
+		tables[table] = true
+	}
+
+	for _, run := range previous {
+		comparison.PreviousRuns = append(comparison.PreviousRuns, run.id)
+
+		for table := range run.records {
+			tables[table] = true
+		}
+	}
+
+	for table := range tables {
+		tcmp := &TableComparison{Table: table, Records: latest.records[table]}
+
+		for _, run := range previous {
+			if records, ok := run.records[table]; ok {
+				tcmp.Previous = append(tcmp.Previous, records)
+			}
+		}
+
+		if len(tcmp.Previous) > 0 {
+			tcmp.Baseline = median(tcmp.Previous)
+		}
+
+		if tcmp.Baseline > 0 {
+			tcmp.Change = (float64(tcmp.Records) - tcmp.Baseline) / tcmp.Baseline
+			tcmp.Anomalous = tcmp.Change < -stats.maxDrop()
+		}
+
+		comparison.Tables = append(comparison.Tables, tcmp)
+	}
+
+	sort.Slice(comparison.Tables, func(i, j int) bool { return comparison.Tables[i].Table < comparison.Tables[j].Table })
+
+	return comparison
+}
+
+// median will return the median of the values, which is not skewed by a single previous run that was anomalous.
+func median(values []int64) float64 {
+	sorted := append([]int64{}, values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return float64(sorted[mid])
+	}
+
+	return float64(sorted[mid-1]+sorted[mid]) / 2
+}
+
+// Compare will compare the records of every table of the latest run with the previous runs, from the statistics
+// table on the first storage of the configuration, flagging the tables whose records dropped by more than the maximum
+// drop of the run statistics. The configuration must have run statistics, and the storage must implement the Scanner
+// interface of the storage package.
+func Compare(ctx context.Context, cfg *Config) (*RunComparison, error) {
+	start := time.Now()
+
+	if cfg.RunStats == nil {
+		return nil, InvalidRunStatsError("the configuration has no run stats")
+	}
+
+	if len(cfg.ConnectionStrings) == 0 {
+		return nil, InvalidRunStatsError("the configuration has no connection strings")
+	}
+
+	resolved, err := resolveSecret(ctx, cfg.ConnectionStrings[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve connection string: %w", err)
+	}
+
+	repo, err := repository.New(ctx, resolved)
+	if err != nil {
+		return nil, WrapRepositoryError(repository.FailedToCreateRepositoryError(err))
+	}
+
+	defer repo.Close()
+
+	runs, err := readRunStats(ctx, repo, cfg.RunStats.table())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read run stats on %q: %w", storage.Scheme(repo.Type()), err)
+	}
+
+	comparison := cfg.RunStats.compareRuns(runs)
+
+	logInfo := tools.LogEvent{
+		Duration: time.Since(start),
+		Msg:      "compared run with previous runs",
+		RunID:    comparison.RunID,
+		Count:    len(comparison.Anomalies()),
+		Previous: len(comparison.PreviousRuns),
+	}
+	logInfo.Log(cfg.Logger, logrus.InfoLevel)
+
+	return comparison, nil
+}
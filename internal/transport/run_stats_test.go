@@ -0,0 +1,179 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/proto"
+)
+
+func TestRunStatsValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name  string
+		stats *RunStats
+		err   error
+	}{
+		{name: "nil"},
+		{name: "default", stats: &RunStats{}},
+		{name: "custom", stats: &RunStats{Table: "runs", History: 5, MaxDrop: 0.25}},
+		{name: "negative history", stats: &RunStats{History: -1}, err: ErrInvalidRunStats},
+		{name: "negative max drop", stats: &RunStats{MaxDrop: -0.1}, err: ErrInvalidRunStats},
+		{name: "max drop of one", stats: &RunStats{MaxDrop: 1}, err: ErrInvalidRunStats},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tcase.stats.validate(); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+		})
+	}
+}
+
+func TestRunStatsEntries(t *testing.T) {
+	t.Parallel()
+
+	result := newUpsertResult()
+	result.RunID = "run-1"
+	result.add("candles", &proto.UpsertResponse{UpsertedCount: 3, MatchedCount: 2})
+	result.add("candles", &proto.UpsertResponse{UpsertedCount: 1, Errors: []*proto.RecordError{{Index: 0}}})
+	result.add("candles_1h", &proto.UpsertResponse{UpsertedCount: 1})
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := (&RunStats{}).entries(result, map[string]bool{"candles": true, "trades": true}, start,
+		start.Add(time.Minute))
+
+	expected := []*runStatsEntry{
+		{
+			ID: "run-1/candles", RunID: "run-1", TableName: "candles", Records: 6, Upserted: 4, Matched: 2,
+			RecordErrors: 1, StartedAt: "2022-01-01T00:00:00Z", CompletedAt: "2022-01-01T00:01:00Z",
+		},
+		{
+			ID: "run-1/candles_1h", RunID: "run-1", TableName: "candles_1h", Records: 1, Upserted: 1,
+			StartedAt: "2022-01-01T00:00:00Z", CompletedAt: "2022-01-01T00:01:00Z",
+		},
+		{
+			ID: "run-1/trades", RunID: "run-1", TableName: "trades",
+			StartedAt: "2022-01-01T00:00:00Z", CompletedAt: "2022-01-01T00:01:00Z",
+		},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestRunStatsCompare(t *testing.T) {
+	t.Parallel()
+
+	// record is a record of the statistics table as read from a storage, with the number types of the storage.
+	record := func(runID, table string, minute int, records interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"runId":       runID,
+			"tableName":   table,
+			"records":     records,
+			"completedAt": time.Date(2022, 1, 1, 0, minute, 0, 0, time.UTC).Format(time.RFC3339Nano),
+		}
+	}
+
+	scanner := fakeScanner{defaultRunStatsTable: {
+		record("run-1", "candles", 1, float64(1000)),
+		record("run-1", "trades", 1, float64(10)),
+		record("run-2", "candles", 2, int64(1100)),
+		record("run-2", "trades", 2, int64(0)),
+		record("run-3", "candles", 3, int32(900)),
+		record("run-3", "trades", 3, int32(12)),
+		record("run-3", "fills", 3, int32(5)),
+		record("run-4", "candles", 4, float64(300)),
+		record("run-4", "trades", 4, float64(11)),
+	}}
+
+	runs, err := readRunStats(context.Background(), scanner, defaultRunStatsTable)
+	if err != nil {
+		t.Fatalf("failed to read run stats: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name      string
+		stats     *RunStats
+		previous  []string
+		tables    []*TableComparison
+		anomalies []string
+	}{
+		{
+			name:     "default",
+			stats:    &RunStats{},
+			previous: []string{"run-1", "run-2", "run-3"},
+			tables: []*TableComparison{
+				{Table: "candles", Records: 300, Previous: []int64{1000, 1100, 900}, Baseline: 1000, Change: -0.7,
+					Anomalous: true},
+				{Table: "fills", Previous: []int64{5}, Baseline: 5, Change: -1, Anomalous: true},
+				{Table: "trades", Records: 11, Previous: []int64{10, 0, 12}, Baseline: 10, Change: 0.1},
+			},
+			anomalies: []string{"candles", "fills"},
+		},
+		{
+			name:     "history",
+			stats:    &RunStats{History: 1, MaxDrop: 0.9},
+			previous: []string{"run-3"},
+			tables: []*TableComparison{
+				{Table: "candles", Records: 300, Previous: []int64{900}, Baseline: 900, Change: -2.0 / 3},
+				{Table: "fills", Previous: []int64{5}, Baseline: 5, Change: -1, Anomalous: true},
+				{Table: "trades", Records: 11, Previous: []int64{12}, Baseline: 12, Change: -1.0 / 12},
+			},
+			anomalies: []string{"fills"},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			comparison := tcase.stats.compareRuns(runs)
+			if comparison.RunID != "run-4" || !reflect.DeepEqual(comparison.PreviousRuns, tcase.previous) {
+				t.Fatalf("unexpected runs: %q compared with %v", comparison.RunID, comparison.PreviousRuns)
+			}
+
+			if len(comparison.Tables) != len(tcase.tables) {
+				t.Fatalf("expected %d tables, got %d", len(tcase.tables), len(comparison.Tables))
+			}
+
+			for idx, expected := range tcase.tables {
+				got := comparison.Tables[idx]
+
+				// The change is compared within a tolerance, since it is a float division.
+				if diff := got.Change - expected.Change; diff > 1e-9 || diff < -1e-9 {
+					t.Fatalf("expected change %v of %q, got %v", expected.Change, expected.Table, got.Change)
+				}
+
+				got.Change = expected.Change
+
+				if !reflect.DeepEqual(got, expected) {
+					t.Fatalf("expected %+v, got %+v", expected, got)
+				}
+			}
+
+			if anomalies := comparison.Anomalies(); !reflect.DeepEqual(anomalies, tcase.anomalies) {
+				t.Fatalf("expected anomalies %v, got %v", tcase.anomalies, anomalies)
+			}
+		})
+	}
+
+	if comparison := (&RunStats{}).compareRuns(nil); comparison.RunID != "" || len(comparison.Tables) != 0 {
+		t.Fatalf("expected an empty comparison without runs, got %+v", comparison)
+	}
+}
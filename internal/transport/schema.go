@@ -0,0 +1,286 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidSchema is returned when a schema in the configuration is invalid.
+	ErrInvalidSchema = fmt.Errorf("invalid schema")
+
+	// ErrSchemaViolation is returned when a record does not conform to the schema of its table.
+	ErrSchemaViolation = fmt.Errorf("schema violation")
+)
+
+// InvalidSchemaError wraps an error with ErrInvalidSchema.
+func InvalidSchemaError(table, msg string) error {
+	return fmt.Errorf("%w for table %q: %s", ErrInvalidSchema, table, msg)
+}
+
+// SchemaViolationError wraps an error with ErrSchemaViolation.
+func SchemaViolationError(table string, index int, msg string) error {
+	return fmt.Errorf("%w: record %d of table %q: %s", ErrSchemaViolation, index, table, msg)
+}
+
+// Schema is the definition of a table. Records upserted into the table are validated against the columns of the
+// schema, and the table can be created in the storage before the upsert. This makes the shape of the data explicit
+// instead of relying on the behavior of each storage, e.g. postgres ignoring fields that are not columns.
+type Schema struct {
+	// Columns are the columns of the table. Records may have fields that are not columns.
+	Columns []*Column `yaml:"columns"`
+
+	// PrimaryKey are the columns that key the records of the table.
+	PrimaryKey []string `yaml:"primaryKey"`
+
+	// Indexes are the indexes of the table.
+	Indexes []*Index `yaml:"indexes"`
+
+	// Create will create the table and its indexes in the storage if they do not exist, before the upsert. Existing
+	// tables are not altered.
+	Create bool `yaml:"create"`
+
+	// Partition splits the records of the table by the period of a timestamp field.
+	Partition *Partition `yaml:"partition"`
+}
+
+// Column is a column of a schema.
+type Column struct {
+	// Name is the name of the column.
+	Name string `yaml:"name"`
+
+	// Type is the type of the column: "string", "integer", "number", "boolean", "timestamp", or "json".
+	Type string `yaml:"type"`
+
+	// Required will reject records that do not have a non-null value for the column.
+	Required bool `yaml:"required"`
+}
+
+// Index is an index of a schema.
+type Index struct {
+	// Name is the name of the index, the default is derived from the table and columns.
+	Name string `yaml:"name"`
+
+	// Columns are the columns of the index, in order.
+	Columns []string `yaml:"columns"`
+
+	// Unique will make the index a unique constraint.
+	Unique bool `yaml:"unique"`
+}
+
+// validate will ensure that the schema is well defined.
+func (schema *Schema) validate(table string) error {
+	if schema == nil {
+		return InvalidSchemaError(table, "schema is empty")
+	}
+
+	columns := make(map[string]bool, len(schema.Columns))
+
+	for _, column := range schema.Columns {
+		if column.Name == "" {
+			return InvalidSchemaError(table, "column name is empty")
+		}
+
+		if _, ok := columnValidators[column.Type]; !ok {
+			return InvalidSchemaError(table, fmt.Sprintf("unknown type %q for column %q", column.Type, column.Name))
+		}
+
+		columns[column.Name] = true
+	}
+
+	for _, key := range schema.PrimaryKey {
+		if !columns[key] {
+			return InvalidSchemaError(table, fmt.Sprintf("primary key %q is not a column", key))
+		}
+	}
+
+	for _, index := range schema.Indexes {
+		if len(index.Columns) == 0 {
+			return InvalidSchemaError(table, "index has no columns")
+		}
+
+		for _, column := range index.Columns {
+			if !columns[column] {
+				return InvalidSchemaError(table, fmt.Sprintf("index column %q is not a column", column))
+			}
+		}
+	}
+
+	if schema.Partition != nil {
+		return schema.Partition.validate(table, schema)
+	}
+
+	return nil
+}
+
+// columnValidators check that a decoded JSON value is of a column type.
+var columnValidators = map[string]func(interface{}) bool{
+	storage.ColumnTypeString: func(val interface{}) bool {
+		_, ok := val.(string)
+
+		return ok
+	},
+	storage.ColumnTypeInteger: func(val interface{}) bool {
+		num, ok := val.(float64)
+
+		return ok && num == math.Trunc(num)
+	},
+	storage.ColumnTypeNumber: func(val interface{}) bool {
+		_, ok := val.(float64)
+
+		return ok
+	},
+	storage.ColumnTypeBoolean: func(val interface{}) bool {
+		_, ok := val.(bool)
+
+		return ok
+	},
+	storage.ColumnTypeTimestamp: func(val interface{}) bool {
+		_, err := tools.ParseJSONTime(val)
+
+		return err == nil
+	},
+	storage.ColumnTypeJSON: func(interface{}) bool { return true },
+}
+
+// check will validate the JSON encoded records of the table against the schema. The data can be a single JSON object
+// or an array of JSON objects. A nil schema accepts every record.
+func (schema *Schema) check(data []byte, table string) error {
+	if schema == nil {
+		return nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("unable to decode records for table %q: %w", table, err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	for idx, record := range records {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			return SchemaViolationError(table, idx, "record is not an object")
+		}
+
+		for _, column := range schema.Columns {
+			val, ok := fields[column.Name]
+			if !ok || val == nil {
+				if column.Required {
+					return SchemaViolationError(table, idx, fmt.Sprintf("missing required column %q", column.Name))
+				}
+
+				continue
+			}
+
+			if !columnValidators[column.Type](val) {
+				return SchemaViolationError(table, idx, fmt.Sprintf("column %q is not of type %q", column.Name,
+					column.Type))
+			}
+		}
+	}
+
+	return nil
+}
+
+// createTableRequest will return the request to create the table of the schema.
+func (schema *Schema) createTableRequest(table string) *proto.CreateTableRequest {
+	req := &proto.CreateTableRequest{Table: table, PrimaryKeys: schema.PrimaryKey}
+	if schema.Partition != nil && schema.Partition.Native {
+		req.PartitionBy = schema.Partition.Field
+	}
+
+	for _, column := range schema.Columns {
+		req.Columns = append(req.Columns, &proto.Column{
+			Name:     column.Name,
+			Type:     column.Type,
+			Required: column.Required,
+		})
+	}
+
+	for _, index := range schema.Indexes {
+		req.Indexes = append(req.Indexes, &proto.Index{
+			Name:    index.Name,
+			Columns: index.Columns,
+			Unique:  index.Unique,
+		})
+	}
+
+	return req
+}
+
+// createSchemas will create the tables of the schemas that should be created in the storages that the tables are
+// routed to. Tables that are partitioned into a table per period are created when records are written to each period.
+func createSchemas(ctx context.Context, cfg *Config) error {
+	tables := make([]string, 0, len(cfg.Schemas))
+
+	for table, schema := range cfg.Schemas {
+		if schema.Create && (schema.Partition == nil || schema.Partition.Native) {
+			tables = append(tables, table)
+		}
+	}
+
+	if len(tables) == 0 {
+		return nil
+	}
+
+	sort.Strings(tables)
+
+	repos, closeRepos, err := cfg.repos(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer closeRepos()
+
+	routing := cfg.routing()
+
+	for idx, repo := range repos {
+		for _, table := range routing.filter(idx, tables) {
+			start := time.Now()
+
+			req := cfg.Schemas[table].createTableRequest(table)
+			cfg.Lineage.addColumn(req)
+			cfg.Offload.addColumn(req)
+
+			rsp, err := repo.CreateTable(ctx, req)
+			if err != nil {
+				return fmt.Errorf("unable to create schema: %w", err)
+			}
+
+			msg := "schema exists"
+			if rsp.GetCreated() {
+				msg = "schema created"
+			}
+
+			logInfo := tools.LogEvent{
+				Duration: time.Since(start),
+				Storage:  storage.Scheme(repo.Type()),
+				Table:    table,
+				Msg:      msg,
+			}
+			logInfo.Log(cfg.logger(logRepository), logrus.InfoLevel)
+		}
+	}
+
+	return nil
+}
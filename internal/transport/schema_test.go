@@ -0,0 +1,100 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+
+	schema := &Schema{
+		Columns: []*Column{
+			{Name: "product_id", Type: "string", Required: true},
+			{Name: "time", Type: "timestamp", Required: true},
+			{Name: "trade_id", Type: "integer"},
+			{Name: "price", Type: "number"},
+			{Name: "meta", Type: "json"},
+		},
+		PrimaryKey: []string{"product_id", "trade_id"},
+		Indexes:    []*Index{{Columns: []string{"time"}}},
+	}
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		if err := schema.validate("trades"); err != nil {
+			t.Fatalf("expected a valid schema, got %v", err)
+		}
+
+		for _, invalid := range []*Schema{
+			nil,
+			{Columns: []*Column{{Name: "id", Type: "uuid"}}},
+			{Columns: []*Column{{Name: "id", Type: "string"}}, PrimaryKey: []string{"key"}},
+			{Columns: []*Column{{Name: "id", Type: "string"}}, Indexes: []*Index{{Columns: []string{"time"}}}},
+		} {
+			if err := invalid.validate("trades"); !errors.Is(err, ErrInvalidSchema) {
+				t.Errorf("expected error %v, got %v", ErrInvalidSchema, err)
+			}
+		}
+	})
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		err  error
+	}{
+		{name: "valid", data: `[{"product_id":"BTC-USD","time":"2022-05-10T00:00:00Z","trade_id":1,"price":1.5,` +
+			`"meta":{"a":1},"extra":true}]`},
+		{name: "unix timestamp", data: `{"product_id":"BTC-USD","time":1652140800,"trade_id":null}`},
+		{name: "missing required", data: `[{"product_id":"BTC-USD"}]`, err: ErrSchemaViolation},
+		{name: "null required", data: `[{"product_id":null,"time":1652140800}]`, err: ErrSchemaViolation},
+		{name: "fractional integer", data: `[{"product_id":"BTC-USD","time":1652140800,"trade_id":1.5}]`,
+			err: ErrSchemaViolation},
+		{name: "string number", data: `[{"product_id":"BTC-USD","time":1652140800,"price":"1.5"}]`,
+			err: ErrSchemaViolation},
+		{name: "invalid timestamp", data: `[{"product_id":"BTC-USD","time":"yesterday"}]`, err: ErrSchemaViolation},
+		{name: "not an object", data: `[1]`, err: ErrSchemaViolation},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := schema.check([]byte(tcase.data), "trades"); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+		})
+	}
+
+	t.Run("no schema", func(t *testing.T) {
+		t.Parallel()
+
+		var schema *Schema
+		if err := schema.check([]byte(`[1]`), "trades"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("create table request", func(t *testing.T) {
+		t.Parallel()
+
+		req := schema.createTableRequest("trades")
+		if req.GetTable() != "trades" || len(req.GetColumns()) != 5 || len(req.GetPrimaryKeys()) != 2 ||
+			len(req.GetIndexes()) != 1 {
+			t.Fatalf("unexpected create table request: %v", req)
+		}
+
+		if column := req.GetColumns()[1]; column.GetName() != "time" || column.GetType() != "timestamp" ||
+			!column.GetRequired() {
+			t.Fatalf("unexpected column: %v", column)
+		}
+	})
+}
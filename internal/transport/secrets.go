@@ -0,0 +1,282 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web/auth"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// secretsManagerPrefix references a secret of AWS Secrets Manager, e.g. "secretsmanager:prod/exchange#secret" for
+	// the "secret" field of a JSON secret.
+	secretsManagerPrefix = "secretsmanager:"
+
+	// ssmPrefix references a parameter of the AWS SSM Parameter Store, e.g. "ssm:/prod/postgres/dns".
+	ssmPrefix = "ssm:"
+
+	// awsTimeout is the timeout of the requests to AWS.
+	awsTimeout = 30 * time.Second
+)
+
+// ErrInvalidSecretReference is returned when a reference to a secret can not be resolved.
+var ErrInvalidSecretReference = fmt.Errorf("invalid secret reference")
+
+// InvalidSecretReferenceError wraps an error with ErrInvalidSecretReference.
+func InvalidSecretReferenceError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSecretReference, msg)
+}
+
+// awsSecret is a reference to a secret of AWS Secrets Manager or a parameter of the SSM Parameter Store.
+type awsSecret struct {
+	service, target string
+	payload         map[string]interface{}
+
+	// id is the name or ARN of the secret, and field is the field of a JSON secret.
+	id, field string
+}
+
+// parseAWSSecret will parse the reference to an AWS secret, returning false if the value is not a reference.
+func parseAWSSecret(value string) (*awsSecret, bool) {
+	if id := strings.TrimPrefix(value, secretsManagerPrefix); id != value {
+		id, field, _ := strings.Cut(id, "#")
+
+		return &awsSecret{
+			service: "secretsmanager",
+			target:  "secretsmanager.GetSecretValue",
+			payload: map[string]interface{}{"SecretId": id},
+			id:      id,
+			field:   field,
+		}, true
+	}
+
+	if name := strings.TrimPrefix(value, ssmPrefix); name != value {
+		return &awsSecret{
+			service: "ssm",
+			target:  "AmazonSSM.GetParameter",
+			payload: map[string]interface{}{"Name": name, "WithDecryption": true},
+			id:      name,
+		}, true
+	}
+
+	return nil, false
+}
+
+// region will return the region of the secret, which is the region of its ARN or the region of the environment.
+func (secret *awsSecret) region() string {
+	if parts := strings.Split(secret.id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		return parts[3]
+	}
+
+	return envRegion()
+}
+
+// envRegion will return the AWS region of the environment.
+func envRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// endpoint will return the endpoint of the service of the secret in the region. The AWS_ENDPOINT_URL environment
+// variable overrides the endpoint, e.g. for a VPC endpoint.
+func (secret *awsSecret) endpoint(region string) string {
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		return endpoint
+	}
+
+	return fmt.Sprintf("https://%s.%s.amazonaws.com/", secret.service, region)
+}
+
+// fetch will return the value of the secret, or of the field of the secret.
+func (secret *awsSecret) fetch(ctx context.Context) (string, error) {
+	creds, err := auth.NewAWSCredentialsChain("").Retrieve(ctx)
+	if err != nil {
+		return "", InvalidSecretReferenceError(err.Error())
+	}
+
+	region := secret.region()
+	if region == "" {
+		return "", InvalidSecretReferenceError(fmt.Sprintf("no region for %q", secret.id))
+	}
+
+	body, err := json.Marshal(secret.payload)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode %s request: %w", secret.service, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, awsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, secret.endpoint(region), bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("unable to create %s request: %w", secret.service, err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", secret.target)
+	auth.SignV4(req, body, creds, region, secret.service, time.Now())
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to reach %s: %w", secret.service, err)
+	}
+
+	defer rsp.Body.Close()
+
+	var decoded struct {
+		SecretString string `json:"SecretString"`
+		Parameter    struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(rsp.Body).Decode(&decoded); err != nil {
+		return "", fmt.Errorf("unable to decode %s response: %w", secret.service, err)
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to get %q from %s: %s %s", secret.id, secret.service, decoded.Type,
+			decoded.Message)
+	}
+
+	if secret.service == "ssm" {
+		return decoded.Parameter.Value, nil
+	}
+
+	if secret.field == "" {
+		return decoded.SecretString, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(decoded.SecretString), &fields); err != nil {
+		return "", InvalidSecretReferenceError(fmt.Sprintf("secret %q is not a JSON object", secret.id))
+	}
+
+	value, ok := fields[secret.field].(string)
+	if !ok {
+		return "", InvalidSecretReferenceError(fmt.Sprintf("secret %q has no string field %q", secret.id, secret.field))
+	}
+
+	return value, nil
+}
+
+// resolveSecret will return the value of a reference to a secret of AWS Secrets Manager or a parameter of the AWS SSM
+// Parameter Store. Other values are returned as they are.
+func resolveSecret(ctx context.Context, value string) (string, error) {
+	secret, ok := parseAWSSecret(value)
+	if !ok {
+		return value, nil
+	}
+
+	return secret.fetch(ctx)
+}
+
+// resolve will return the authentication with the credentials of its Vault secret, if it has one, and with the
+// references to AWS secrets resolved. The credentials of the configuration are not modified.
+func (authentication *Authentication) resolve(ctx context.Context, logger *logrus.Logger) (*Authentication, error) {
+	resolved := *authentication
+
+	if authentication.Vault != nil {
+		fields, err := authentication.Vault.credentials(ctx, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved.withVaultFields(fields)
+
+		if resolved.APIKey == nil && resolved.Auth2 == nil {
+			return nil, fmt.Errorf("vault secret %q has no \"key\" or \"bearer\" field", authentication.Vault.Path)
+		}
+	}
+
+	var fields []*string
+
+	if resolved.APIKey != nil {
+		apiKey := *resolved.APIKey
+		resolved.APIKey = &apiKey
+		fields = append(fields, &apiKey.Key, &apiKey.Secret, &apiKey.Passphrase)
+	}
+
+	if resolved.Auth2 != nil {
+		auth2 := *resolved.Auth2
+		resolved.Auth2 = &auth2
+		fields = append(fields, &auth2.Bearer, &auth2.ClientID, &auth2.ClientSecret)
+	}
+
+	if resolved.OAuth1 != nil {
+		oauth1 := *resolved.OAuth1
+		resolved.OAuth1 = &oauth1
+		fields = append(fields, &oauth1.ConsumerKey, &oauth1.ConsumerSecret, &oauth1.Token, &oauth1.TokenSecret)
+	}
+
+	if resolved.SigV4 != nil {
+		sigv4 := *resolved.SigV4
+		resolved.SigV4 = &sigv4
+		fields = append(fields, &sigv4.AccessKeyID, &sigv4.SecretAccessKey, &sigv4.SessionToken)
+	}
+
+	if resolved.JWT != nil {
+		jwt := *resolved.JWT
+		resolved.JWT = &jwt
+		fields = append(fields, &jwt.PrivateKey, &jwt.KeyID)
+	}
+
+	if resolved.Basic != nil {
+		basic := *resolved.Basic
+		resolved.Basic = &basic
+		fields = append(fields, &basic.Username, &basic.Password)
+	}
+
+	if resolved.CustomKey != nil {
+		customKey := *resolved.CustomKey
+		resolved.CustomKey = &customKey
+		fields = append(fields, &customKey.Value)
+	}
+
+	for _, field := range fields {
+		value, err := resolveSecret(ctx, *field)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve authentication: %w", err)
+		}
+
+		*field = value
+	}
+
+	resolveValue := func(value string) (string, error) {
+		return resolveSecret(ctx, value)
+	}
+
+	session, err := resolved.Session.withStrings(resolveValue)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve authentication: %w", err)
+	}
+
+	registered, err := resolved.Registered.withStrings(resolveValue)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve authentication: %w", err)
+	}
+
+	resolved.Session = session
+	resolved.Registered = registered
+
+	return &resolved, nil
+}
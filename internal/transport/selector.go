@@ -0,0 +1,116 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The keys of selectors.
+const (
+	// SelectTags selects the requests with one of the tags, e.g. "tags=prices,daily".
+	SelectTags = "tags"
+
+	// SelectTable selects the requests that write to one of the tables, e.g. "table=candles".
+	SelectTable = "table"
+)
+
+// ErrInvalidSelector is returned when a selector of the requests to run is invalid.
+var ErrInvalidSelector = fmt.Errorf("invalid selector")
+
+// InvalidSelectorError wraps an error with ErrInvalidSelector.
+func InvalidSelectorError(selector, msg string) error {
+	return fmt.Errorf("%w: %q: %s", ErrInvalidSelector, selector, msg)
+}
+
+// selector selects the requests of an operation by a key and a comma separated list of values, e.g. "tags=prices". A
+// request is selected if it has one of the values.
+type selector struct {
+	key    string
+	values map[string]bool
+}
+
+// parseSelector will parse a "key=value,value" selector.
+func parseSelector(str string) (*selector, error) {
+	key, list, ok := strings.Cut(str, "=")
+	if !ok {
+		return nil, InvalidSelectorError(str, "expected key=value")
+	}
+
+	sel := &selector{key: strings.TrimSpace(key), values: make(map[string]bool)}
+
+	switch sel.key {
+	case SelectTags, SelectTable:
+	default:
+		return nil, InvalidSelectorError(str, fmt.Sprintf("unknown key %q", sel.key))
+	}
+
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			sel.values[value] = true
+		}
+	}
+
+	if len(sel.values) == 0 {
+		return nil, InvalidSelectorError(str, "no values")
+	}
+
+	return sel, nil
+}
+
+// matches will return true if the request has one of the values of the selector.
+func (sel *selector) matches(req *Request) bool {
+	var labels []string
+
+	switch sel.key {
+	case SelectTags:
+		labels = req.Tags
+	case SelectTable:
+		labels = req.tables()
+	}
+
+	for _, label := range labels {
+		if sel.values[label] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectRequests will return the requests that match every selector of the configuration. If the configuration has no
+// selectors, every request is returned.
+func (cfg *Config) selectRequests() ([]*Request, error) {
+	selectors := make([]*selector, 0, len(cfg.Only))
+
+	for _, str := range cfg.Only {
+		sel, err := parseSelector(str)
+		if err != nil {
+			return nil, err
+		}
+
+		selectors = append(selectors, sel)
+	}
+
+	requests := make([]*Request, 0, len(cfg.Requests))
+
+	for _, req := range cfg.Requests {
+		selected := true
+
+		for _, sel := range selectors {
+			selected = selected && sel.matches(req)
+		}
+
+		if selected {
+			requests = append(requests, req)
+		}
+	}
+
+	return requests, nil
+}
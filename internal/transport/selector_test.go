@@ -0,0 +1,68 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSelectRequests(t *testing.T) {
+	t.Parallel()
+
+	requests := []*Request{
+		{Table: "candles", Tags: []string{"prices", "daily"}},
+		{Table: "tickers", Tags: []string{"prices"}},
+		{Table: "accounts", Tags: []string{"daily"}},
+		{Table: "raw", Split: []*Split{{Path: "trades", Table: "trades"}}},
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		only     []string
+		expected []string
+		err      error
+	}{
+		{name: "no selectors", expected: []string{"candles", "tickers", "accounts", "raw"}},
+		{name: "tag", only: []string{"tags=prices"}, expected: []string{"candles", "tickers"}},
+		{name: "any tag", only: []string{"tags=prices, daily"}, expected: []string{"candles", "tickers", "accounts"}},
+		{name: "every selector", only: []string{"tags=prices", "tags=daily"}, expected: []string{"candles"}},
+		{name: "split table", only: []string{"table=trades,accounts"}, expected: []string{"accounts", "raw"}},
+		{name: "no match", only: []string{"tags=hourly"}, expected: []string{}},
+		{name: "unknown key", only: []string{"endpoint=/candles"}, err: ErrInvalidSelector},
+		{name: "no values", only: []string{"tags="}, err: ErrInvalidSelector},
+		{name: "no key", only: []string{"prices"}, err: ErrInvalidSelector},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &Config{Requests: requests, Only: tcase.only}
+
+			selected, err := cfg.selectRequests()
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			tables := make([]string, 0, len(selected))
+			for _, req := range selected {
+				tables = append(tables, req.Table)
+			}
+
+			if !reflect.DeepEqual(tables, tcase.expected) {
+				t.Fatalf("expected %v, got %v", tcase.expected, tables)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"unicode"
+)
+
+const sinkFileMode = 0o600
+
+// Sink is a file that the response of a request is streamed to, instead of being upserted into the repositories. The
+// response is decoded on the fly and written as JSON lines, one line per record, so that multi-GB responses (e.g.
+// export endpoints) are transported with constant memory. The records of every chunk of the request are appended to
+// the file.
+type Sink struct {
+	// File is the path to the JSON lines file.
+	File string `yaml:"file" json:"file"`
+}
+
+// sinkFile is an open sink file. The mutex is held while a response is streamed to the file, so that the records of
+// concurrent responses are not interleaved.
+type sinkFile struct {
+	mutex  sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// stream will decode the records of the JSON encoded response and append them to the file as JSON lines, returning the
+// number of records written. The response can be a single JSON object or an array of JSON values.
+func (sf *sinkFile) stream(body io.Reader) (int64, error) {
+	sf.mutex.Lock()
+	defer sf.mutex.Unlock()
+
+	count, err := streamRecords(body, sf.writer)
+	if err != nil {
+		return count, err
+	}
+
+	if err := sf.writer.Flush(); err != nil {
+		return count, fmt.Errorf("unable to flush sink file: %w", err)
+	}
+
+	return count, nil
+}
+
+// sinkWriters are the sink files of an operation, which are opened on first use. It is safe for concurrent use.
+type sinkWriters struct {
+	mutex sync.Mutex
+	files map[string]*sinkFile
+}
+
+func newSinkWriters() *sinkWriters {
+	return &sinkWriters{files: make(map[string]*sinkFile)}
+}
+
+// open will return the sink file for the path, opening it for appending if it is not already open.
+func (sw *sinkWriters) open(path string) (*sinkFile, error) {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	if sf, ok := sw.files[path]; ok {
+		return sf, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, sinkFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sink file: %w", err)
+	}
+
+	sf := &sinkFile{file: file, writer: bufio.NewWriter(file)}
+	sw.files[path] = sf
+
+	return sf, nil
+}
+
+// close will close every sink file that has been opened.
+func (sw *sinkWriters) close() error {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	for path, sf := range sw.files {
+		if err := sf.file.Close(); err != nil {
+			return fmt.Errorf("unable to close sink file %q: %w", path, err)
+		}
+
+		delete(sw.files, path)
+	}
+
+	return nil
+}
+
+// streamRecords will decode the records of a JSON encoded response one at a time and write each as a compact JSON
+// line, returning the number of records written.
+func streamRecords(body io.Reader, writer io.Writer) (int64, error) {
+	reader := bufio.NewReader(body)
+
+	first, err := peekJSON(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	decoder := json.NewDecoder(reader)
+
+	var (
+		count  int64
+		record json.RawMessage
+		line   bytes.Buffer
+	)
+
+	writeRecord := func() error {
+		line.Reset()
+
+		if err := json.Compact(&line, record); err != nil {
+			return fmt.Errorf("unable to compact record: %w", err)
+		}
+
+		line.WriteByte('\n')
+
+		if _, err := writer.Write(line.Bytes()); err != nil {
+			return fmt.Errorf("unable to write record: %w", err)
+		}
+
+		count++
+
+		return nil
+	}
+
+	if first != '[' {
+		if err := decoder.Decode(&record); err != nil {
+			return 0, fmt.Errorf("unable to decode record: %w", err)
+		}
+
+		return count, writeRecord()
+	}
+
+	// Consume the opening bracket of the array.
+	if _, err := decoder.Token(); err != nil {
+		return 0, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	for decoder.More() {
+		if err := decoder.Decode(&record); err != nil {
+			return count, fmt.Errorf("unable to decode record: %w", err)
+		}
+
+		if err := writeRecord(); err != nil {
+			return count, err
+		}
+	}
+
+	// Consume the closing bracket of the array.
+	if _, err := decoder.Token(); err != nil {
+		return count, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	return count, nil
+}
+
+// peekJSON will return the first non-whitespace byte of the reader without consuming it.
+func peekJSON(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("unable to read response: %w", err)
+		}
+
+		if !unicode.IsSpace(rune(b)) {
+			if err := reader.UnreadByte(); err != nil {
+				return 0, fmt.Errorf("unable to read response: %w", err)
+			}
+
+			return b, nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func TestStreamRecords(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name  string
+		body  string
+		lines string
+		err   bool
+	}{
+		{name: "array", body: "[{\"id\": 1},\n {\"id\": 2, \"tags\": [\"a\", \"b\"]}]",
+			lines: "{\"id\":1}\n{\"id\":2,\"tags\":[\"a\",\"b\"]}\n"},
+		{name: "object", body: "\n {\"id\": 1, \"nested\": {\"x\": true}}", lines: "{\"id\":1,\"nested\":{\"x\":true}}\n"},
+		{name: "empty array", body: "[]", lines: ""},
+		{name: "truncated", body: `[{"id":1},{"id"`, lines: "{\"id\":1}\n", err: true},
+		{name: "empty", body: "", err: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var bldr strings.Builder
+
+			count, err := streamRecords(strings.NewReader(tcase.body), &bldr)
+			if tcase.err != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if bldr.String() != tcase.lines {
+				t.Fatalf("expected lines %q, got %q", tcase.lines, bldr.String())
+			}
+
+			if want := int64(strings.Count(tcase.lines, "\n")); count != want {
+				t.Fatalf("expected %d records, got %d", want, count)
+			}
+		})
+	}
+
+	t.Run("web job", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`[{"id":1},{"id":2},{"id":3}]`))
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		file := filepath.Join(t.TempDir(), "export.jsonl")
+		sinks := newSinkWriters()
+		rurl, _ := url.Parse(server.URL)
+
+		job := &webJob{
+			flattenedRequest: &flattenedRequest{
+				fetchConfig: &web.FetchConfig{
+					C:           client,
+					Method:      http.MethodGet,
+					URL:         rurl,
+					RateLimiter: rate.NewLimiter(rate.Inf, 1),
+				},
+				table: "exports",
+				sink:  &Sink{File: file},
+			},
+			logger: logrus.New(),
+			sinks:  sinks,
+		}
+
+		// Stream the response twice to check that the records are appended.
+		for i := 0; i < 2; i++ {
+			if _, count, err := stream(context.Background(), job); err != nil || count != 3 {
+				t.Fatalf("expected 3 records, got %d (%v)", count, err)
+			}
+		}
+
+		if err := sinks.close(); err != nil {
+			t.Fatalf("error closing sinks: %v", err)
+		}
+
+		bytes, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("error reading sink file: %v", err)
+		}
+
+		if lines := strings.Count(string(bytes), "\n"); lines != 6 {
+			t.Fatalf("expected 6 lines, got %d", lines)
+		}
+	})
+}
@@ -0,0 +1,297 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSmokeTimeout is the time limit of a smoke test if none is given.
+	DefaultSmokeTimeout = time.Minute
+
+	// smokeSamples is the maximum number of decoded records that are reported for each table.
+	smokeSamples = 3
+
+	// smokeConcurrency is the number of requests that a smoke test makes at the same time. The requests are still
+	// throttled by their rate limiters.
+	smokeConcurrency = 8
+)
+
+// ErrSmokeTestFailed is returned by SmokeResult.Err when a request of the smoke test failed.
+var ErrSmokeTestFailed = fmt.Errorf("smoke test failed")
+
+// SmokeTestFailedError wraps an error with ErrSmokeTestFailed.
+func SmokeTestFailedError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrSmokeTestFailed, msg)
+}
+
+// SmokeRequest is the result of smoke testing a request of the configuration.
+type SmokeRequest struct {
+	// Endpoint and Table are the endpoint and the table of the request.
+	Endpoint string
+	Table    string
+
+	// URL is the URL of the first chunk of the request, which is the only chunk that is fetched.
+	URL string
+
+	// Records is the number of records that were decoded from the first page of the response.
+	Records int
+
+	// Duration is the time it took to fetch and decode the first page.
+	Duration time.Duration
+
+	// Skipped is the reason the request was not made, e.g. a request of a foreach whose values are only known during
+	// a run. It is empty if the request was made.
+	Skipped string
+
+	// Err is the error of the request, e.g. a web error or a record that violates the schema of its table.
+	Err error
+}
+
+// SmokeTable is the result of smoke testing the requests of a table.
+type SmokeTable struct {
+	// Records is the number of records that were decoded for the table.
+	Records int
+
+	// Samples are the first decoded records of the table, as they would be upserted.
+	Samples []json.RawMessage
+}
+
+// SmokeResult is the result of a smoke test of the configuration.
+type SmokeResult struct {
+	// Requests are the results of the requests, in the order of the configuration.
+	Requests []*SmokeRequest
+
+	// Tables are the records that were decoded for each table.
+	Tables map[string]*SmokeTable
+
+	// Duration is the time the smoke test took.
+	Duration time.Duration
+}
+
+// Err will return an error wrapping ErrSmokeTestFailed if any request of the smoke test failed.
+func (result *SmokeResult) Err() error {
+	var failed int
+
+	for _, req := range result.Requests {
+		if req.Err != nil {
+			failed++
+		}
+	}
+
+	if failed == 0 {
+		return nil
+	}
+
+	return SmokeTestFailedError(fmt.Sprintf("%d of %d requests failed", failed, len(result.Requests)))
+}
+
+// smokeJob is a request of the smoke test with the flattened request of its first chunk.
+type smokeJob struct {
+	result *SmokeRequest
+	req    *flattenedRequest
+}
+
+// Smoke will test the configuration by making only the first chunk of every request and decoding the first page of
+// its response, without writing to the storage. The records are decoded and validated against the schemas of their
+// tables as they would be upserted, and a sample of the records of each table is returned. Requests that are not
+// made before the timeout are reported as skipped, so that a large configuration can be validated in a short time.
+func Smoke(ctx context.Context, cfg *Config, timeout time.Duration) (*SmokeResult, error) {
+	start := time.Now()
+
+	if timeout <= 0 {
+		timeout = DefaultSmokeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	jobs, err := cfg.smokeJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SmokeResult{Tables: make(map[string]*SmokeTable)}
+	upserts := make([][]json.RawMessage, len(jobs))
+
+	var wg sync.WaitGroup
+
+	slots := make(chan struct{}, smokeConcurrency)
+
+	for idx, job := range jobs {
+		result.Requests = append(result.Requests, job.result)
+
+		if job.req == nil {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(idx int, job *smokeJob) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				job.result.Skipped = "the time limit of the smoke test was reached"
+
+				return
+			}
+
+			upserts[idx] = cfg.smoke(ctx, job)
+		}(idx, job)
+	}
+
+	wg.Wait()
+
+	// The tables are added in the order of the requests, so that the samples do not depend on the order the requests
+	// completed in.
+	for idx, job := range jobs {
+		table := result.Tables[job.result.Table]
+		if table == nil && job.result.Err == nil && job.result.Skipped == "" {
+			table = new(SmokeTable)
+			result.Tables[job.result.Table] = table
+		}
+
+		for _, record := range upserts[idx] {
+			table.Records++
+
+			if len(table.Samples) < smokeSamples {
+				table.Samples = append(table.Samples, record)
+			}
+		}
+	}
+
+	result.Duration = time.Since(start)
+
+	return result, nil
+}
+
+// smokeJobs will return the requests of the smoke test, with the flattened request of the first chunk of every request
+// that can be made.
+func (cfg *Config) smokeJobs(ctx context.Context) ([]*smokeJob, error) {
+	requests, err := cfg.expandRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(requests) == 0 {
+		return nil, ErrNoRequests
+	}
+
+	limiters := cfg.runLimiters()
+	clients := cfg.newRunClients()
+
+	jobs := make([]*smokeJob, 0, len(requests))
+
+	for _, req := range requests {
+		job := &smokeJob{result: &SmokeRequest{Endpoint: req.Endpoint, Table: req.Table}}
+		jobs = append(jobs, job)
+
+		switch {
+		case req.Foreach != nil:
+			job.result.Skipped = "the requests of a foreach are only known during a run"
+
+			continue
+		case req.Sink != nil:
+			job.result.Skipped = "the response is streamed to a sink"
+
+			continue
+		}
+
+		client, err := clients.client(ctx, req.Egress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to web API: %w", err)
+		}
+
+		flatReqs, err := req.flattenTimeseries(*cfg.URL, client)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(flatReqs) == 0 {
+			job.result.Skipped = "the request has no chunks"
+
+			continue
+		}
+
+		job.req = flatReqs[0]
+		job.req.fetchConfig.RateLimiter = limiters[req.limiterKey()]
+		job.result.Table = job.req.table
+		job.result.URL = job.req.fetchConfig.URL.String()
+	}
+
+	return jobs, nil
+}
+
+// smoke will make the request of the job and return the records of its response that would be upserted into the table
+// of the request, setting the result of the job.
+func (cfg *Config) smoke(ctx context.Context, job *smokeJob) []json.RawMessage {
+	start := time.Now()
+	defer func() { job.result.Duration = time.Since(start) }()
+
+	upserts, err := sampleUpserts(ctx, cfg, job.req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("the time limit of the smoke test was reached: %w", err)
+		}
+
+		job.result.Err = err
+
+		return nil
+	}
+
+	var records []json.RawMessage
+
+	for _, upsert := range upserts {
+		if err := cfg.Schemas[upsert.Table].check(upsert.Data, upsert.Table); err != nil {
+			job.result.Err = err
+
+			return nil
+		}
+
+		decoded, err := decodeRecords(upsert.Data)
+		if err != nil {
+			job.result.Err = err
+
+			return nil
+		}
+
+		// The records of split tables are counted by the request, but only the records of its table are sampled.
+		job.result.Records += len(decoded)
+
+		if upsert.Table == job.req.table {
+			records = append(records, decoded...)
+		}
+	}
+
+	return records
+}
+
+// decodeRecords will return the records of JSON encoded data, which can be a single JSON object or an array of JSON
+// objects.
+func decodeRecords(data []byte) ([]json.RawMessage, error) {
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err == nil {
+		return records, nil
+	}
+
+	var record json.RawMessage
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("unable to decode records: %w", err)
+	}
+
+	return []json.RawMessage{record}, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSmoke(t *testing.T) {
+	t.Parallel()
+
+	var candles int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/candles":
+			atomic.AddInt32(&candles, 1)
+			_, _ = w.Write([]byte(`[{"time":"2022-05-10T00:00:00Z","close":1},{"time":"2022-05-10T00:01:00Z","close":2},` +
+				`{"time":"2022-05-10T00:02:00Z","close":3},{"time":"2022-05-10T00:03:00Z","close":4}]`))
+		case "/trades":
+			_, _ = w.Write([]byte(`[{"price":1}]`))
+		case "/products":
+			_, _ = w.Write([]byte(`{"id":"BTC-USD"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+rateLimit:
+  burst: 5
+  period: 1s
+schemas:
+  trades:
+    columns:
+      - name: time
+        type: timestamp
+        required: true
+requests:
+  - endpoint: /candles
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-10T03:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+  - endpoint: /trades
+  - endpoint: /products
+  - endpoint: /products/{{ .Each }}/book
+    table: books
+    foreach:
+      table: products
+  - endpoint: /missing
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	result, err := Smoke(context.Background(), cfg, 0)
+	if err != nil {
+		t.Fatalf("error smoke testing config: %v", err)
+	}
+
+	if candles != 1 {
+		t.Fatalf("expected only the first chunk of the timeseries to be fetched, got %d requests", candles)
+	}
+
+	if len(result.Requests) != 5 {
+		t.Fatalf("expected 5 requests, got %d", len(result.Requests))
+	}
+
+	for idx, expected := range []struct {
+		table   string
+		records int
+		skipped bool
+		err     string
+	}{
+		{table: "candles", records: 4},
+		{table: "trades", err: `missing required column "time"`},
+		{table: "products", records: 1},
+		{table: "books", skipped: true},
+		{table: "missing", err: "404"},
+	} {
+		req := result.Requests[idx]
+
+		if req.Table != expected.table || req.Records != expected.records || (req.Skipped != "") != expected.skipped {
+			t.Fatalf("expected request %d to be %+v, got %+v", idx, expected, req)
+		}
+
+		if (expected.err == "") != (req.Err == nil) || (req.Err != nil && !strings.Contains(req.Err.Error(), expected.err)) {
+			t.Fatalf("expected request %d to have error %q, got %v", idx, expected.err, req.Err)
+		}
+	}
+
+	if table := result.Tables["candles"]; table == nil || table.Records != 4 || len(table.Samples) != smokeSamples {
+		t.Fatalf("expected 4 candles with %d samples, got %+v", smokeSamples, table)
+	}
+
+	if table := result.Tables["products"]; table == nil || string(table.Samples[0]) != `{"id":"BTC-USD"}` {
+		t.Fatalf("expected the product to be sampled, got %+v", table)
+	}
+
+	if _, ok := result.Tables["trades"]; ok {
+		t.Fatalf("expected no samples for a table whose request failed")
+	}
+
+	if err := result.Err(); !errors.Is(err, ErrSmokeTestFailed) || !strings.Contains(err.Error(), "2 of 5") {
+		t.Fatalf("expected a smoke test failed error, got %v", err)
+	}
+}
+
+func TestSmokeTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /candles
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	result, err := Smoke(context.Background(), cfg, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("error smoke testing config: %v", err)
+	}
+
+	if err := result.Requests[0].Err; err == nil || !strings.Contains(err.Error(), "time limit") {
+		t.Fatalf("expected the request to exceed the time limit, got %v", err)
+	}
+}
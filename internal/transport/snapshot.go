@@ -0,0 +1,323 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/proto"
+	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Snapshot is the configuration for writing a resumable snapshot of an operation when it is canceled or fails. The
+// snapshot contains the requests that did not complete, so that a later operation can resume from them instead of
+// starting over.
+type Snapshot struct {
+	// File is the path to the snapshot file, or its key on the store of the checkpoints of the configuration.
+	File string `yaml:"file"`
+
+	// Resume will make the operation resume from the snapshot file if it exists, instead of making every request in
+	// the configuration. Tables are not truncated when resuming. The snapshot file is removed once the resumed
+	// operation completes.
+	Resume bool `yaml:"resume"`
+}
+
+// resumable will return true if the operation should resume from the snapshot on the store.
+func (snap *Snapshot) resumable(ctx context.Context, store CheckpointStore) (bool, error) {
+	if snap == nil || !snap.Resume || snap.File == "" {
+		return false, nil
+	}
+
+	_, err := store.Get(ctx, snap.File)
+	if errors.Is(err, ErrCheckpointNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("unable to read snapshot: %w", err)
+	}
+
+	return true, nil
+}
+
+// snapshotRequest is the serializable form of a flattened request.
+type snapshotRequest struct {
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	Body         []byte            `json:"body,omitempty"`
+	ContentType  string            `json:"contentType,omitempty"`
+	Header       http.Header       `json:"requestHeaders,omitempty"`
+	Table        string            `json:"table"`
+	Split        []*Split          `json:"split,omitempty"`
+	Deletes      []json.RawMessage `json:"deletes,omitempty"`
+	Headers      []*ResponseHeader `json:"headers,omitempty"`
+	SingletonKey string            `json:"singletonKey,omitempty"`
+	Staleness    *Staleness        `json:"staleness,omitempty"`
+	Chunk        *[2]time.Time     `json:"chunk,omitempty"`
+	Egress       *Egress           `json:"egress,omitempty"`
+	Group        string            `json:"rateLimitGroup,omitempty"`
+	Sink         *Sink             `json:"sink,omitempty"`
+	Concurrency  int               `json:"concurrency,omitempty"`
+	Envelope     *Envelope         `json:"envelope,omitempty"`
+	Normalize    []*Normalizer     `json:"normalize,omitempty"`
+	Projection   *projection       `json:"projection,omitempty"`
+	Pagination   *Pagination       `json:"pagination,omitempty"`
+	Retry        *Retry            `json:"retry,omitempty"`
+	DependsOn    []string          `json:"dependsOn,omitempty"`
+	Limits       *Limits           `json:"limits,omitempty"`
+	CacheMode    CacheMode         `json:"cacheMode,omitempty"`
+	Downsample   *Downsample       `json:"downsample,omitempty"`
+	Bisect       *chunkBisect      `json:"bisect,omitempty"`
+}
+
+// snapshotState is the content of a snapshot file.
+type snapshotState struct {
+	// CreatedAt is the time the snapshot was written.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Completed is the number of requests that completed before the snapshot was written.
+	Completed int `json:"completed"`
+
+	// Watermarks maps each table to the end of the latest timeseries chunk that completed for the table.
+	Watermarks map[string]time.Time `json:"watermarks,omitempty"`
+
+	// Requests are the requests that did not complete.
+	Requests []*snapshotRequest `json:"requests"`
+}
+
+func newSnapshotRequest(req *flattenedRequest) (*snapshotRequest, error) {
+	deletes := make([]json.RawMessage, 0, len(req.deletes))
+
+	for _, del := range req.deletes {
+		bytes, err := protojson.Marshal(del)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal delete request: %w", err)
+		}
+
+		deletes = append(deletes, bytes)
+	}
+
+	return &snapshotRequest{
+		Method:       req.fetchConfig.Method,
+		URL:          req.fetchConfig.URL.String(),
+		Body:         req.fetchConfig.Body,
+		ContentType:  req.fetchConfig.ContentType,
+		Header:       req.fetchConfig.Header,
+		Table:        req.table,
+		Split:        req.split,
+		Deletes:      deletes,
+		Headers:      req.headers,
+		SingletonKey: req.singletonKey,
+		Staleness:    req.staleness,
+		Chunk:        req.chunk,
+		Egress:       req.egress,
+		Group:        req.rateLimitGroup,
+		Sink:         req.sink,
+		Concurrency:  cap(req.concurrency),
+		Envelope:     req.envelope,
+		Normalize:    req.normalizers,
+		Projection:   req.projection,
+		Pagination:   req.pagination,
+		Retry:        req.retry,
+		DependsOn:    req.dependsOn,
+		Limits:       req.limits,
+		CacheMode:    req.cacheMode,
+		Downsample:   req.downsample,
+		Bisect:       req.bisect,
+	}, nil
+}
+
+// flatten will convert the snapshot request back into a flattened request that uses the client and rate limiter.
+func (snapReq *snapshotRequest) flatten(client *web.Client, limiter *rate.Limiter) (*flattenedRequest, error) {
+	rurl, err := url.Parse(snapReq.URL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot request URL: %w", err)
+	}
+
+	deletes := make([]*proto.DeleteRequest, 0, len(snapReq.Deletes))
+
+	for _, bytes := range snapReq.Deletes {
+		del := new(proto.DeleteRequest)
+		if err := protojson.Unmarshal(bytes, del); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal delete request: %w", err)
+		}
+
+		deletes = append(deletes, del)
+	}
+
+	return &flattenedRequest{
+		fetchConfig: &web.FetchConfig{
+			C:           client,
+			Method:      snapReq.Method,
+			URL:         rurl,
+			RateLimiter: limiter,
+			Body:        snapReq.Body,
+			ContentType: snapReq.ContentType,
+			Header:      snapReq.Header,
+		},
+		table:          snapReq.Table,
+		split:          snapReq.Split,
+		deletes:        deletes,
+		headers:        snapReq.Headers,
+		singletonKey:   snapReq.SingletonKey,
+		staleness:      snapReq.Staleness,
+		chunk:          snapReq.Chunk,
+		egress:         snapReq.Egress,
+		rateLimitGroup: snapReq.Group,
+		sink:           snapReq.Sink,
+		envelope:       snapReq.Envelope,
+		normalizers:    snapReq.Normalize,
+		projection:     snapReq.Projection,
+		pagination:     snapReq.Pagination,
+		retry:          snapReq.Retry,
+		dependsOn:      snapReq.DependsOn,
+		limits:         snapReq.Limits,
+		cacheMode:      snapReq.CacheMode,
+		downsample:     snapReq.Downsample,
+		bisect:         snapReq.Bisect,
+	}, nil
+}
+
+// write will write the requests that are not completed to the snapshot on the store, along with the watermarks of the
+// completed requests. The snapshot is encrypted with the state cipher, if it is not nil.
+func (snap *Snapshot) write(ctx context.Context, store CheckpointStore, requests []*flattenedRequest,
+	completed map[*flattenedRequest]bool, sc *stateCipher,
+) error {
+	state := &snapshotState{
+		CreatedAt:  time.Now().UTC(),
+		Watermarks: make(map[string]time.Time),
+	}
+
+	for _, req := range requests {
+		if completed[req] {
+			state.Completed++
+
+			if req.chunk == nil {
+				continue
+			}
+
+			for _, table := range req.tables() {
+				if end := req.chunk[1]; end.After(state.Watermarks[table]) {
+					state.Watermarks[table] = end
+				}
+			}
+
+			continue
+		}
+
+		// The foreach requests that are not expanded can not be resumed, since the values of their tables are not
+		// known to the resumed run.
+		if req.foreach != nil {
+			continue
+		}
+
+		snapReq, err := newSnapshotRequest(req)
+		if err != nil {
+			return err
+		}
+
+		state.Requests = append(state.Requests, snapReq)
+	}
+
+	bytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal snapshot: %w", err)
+	}
+
+	if bytes, err = sc.seal(bytes); err != nil {
+		return fmt.Errorf("unable to encrypt snapshot: %w", err)
+	}
+
+	if err := store.Put(ctx, snap.File, bytes); err != nil {
+		return fmt.Errorf("unable to write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// load will read the requests from the snapshot on the store, using the web clients of the operation and the rate
+// limiters of their rate limit groups. Requests of groups that no longer exist use the rate limiter for requests
+// without a group.
+func (snap *Snapshot) load(ctx context.Context, cfg *Config, store CheckpointStore, clients *runClients,
+	limiters map[string]*rate.Limiter,
+) ([]*flattenedRequest, error) {
+	bytes, err := store.Get(ctx, snap.File)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot: %w", err)
+	}
+
+	sc, err := cfg.StateEncryption.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes, err = sc.open(bytes); err != nil {
+		return nil, err
+	}
+
+	var state snapshotState
+	if err := json.Unmarshal(bytes, &state); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal snapshot: %w", err)
+	}
+
+	requests := make([]*flattenedRequest, 0, len(state.Requests))
+
+	// The chunks of a timeseries request share the limit on their concurrency. Since the chunks only differ in their
+	// query, they are grouped by their method, table, and the URL without the query.
+	concurrency := make(map[string]chan struct{})
+
+	for _, snapReq := range state.Requests {
+		client, err := clients.client(ctx, snapReq.Egress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to web API: %w", err)
+		}
+
+		limiter, ok := limiters[snapReq.Group]
+		if !ok {
+			limiter = limiters[""]
+		}
+
+		req, err := snapReq.flatten(client, limiter)
+		if err != nil {
+			return nil, err
+		}
+
+		if snapReq.Concurrency > 0 {
+			rurl := *req.fetchConfig.URL
+			rurl.RawQuery = ""
+			key := fmt.Sprintf("%s %s %s", snapReq.Method, snapReq.Table, rurl.String())
+
+			if _, ok := concurrency[key]; !ok {
+				concurrency[key] = make(chan struct{}, snapReq.Concurrency)
+			}
+
+			req.concurrency = concurrency[key]
+		}
+
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+// remove will remove the snapshot from the store, if it exists.
+func (snap *Snapshot) remove(ctx context.Context, store CheckpointStore) error {
+	if err := store.Delete(ctx, snap.File); err != nil {
+		return fmt.Errorf("unable to remove snapshot: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /candles
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-10T03:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+    truncateScope:
+      required:
+        product_id: BTC-USD
+      timeField: time
+`)
+
+	cfg, err := NewConfig(cfgYAML)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	cfg.Snapshot = &Snapshot{File: filepath.Join(t.TempDir(), "snapshot.json"), Resume: true}
+
+	resumable := func() bool {
+		ok, err := cfg.Snapshot.resumable(context.Background(), fileCheckpoints{})
+		if err != nil {
+			t.Fatalf("error reading snapshot: %v", err)
+		}
+
+		return ok
+	}
+
+	if resumable() {
+		t.Fatalf("expected the snapshot not to be resumable before it is written")
+	}
+
+	requests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(requests))
+	}
+
+	completed := map[*flattenedRequest]bool{requests[0]: true, requests[1]: true}
+	if err := cfg.Snapshot.write(context.Background(), fileCheckpoints{}, requests, completed, nil); err != nil {
+		t.Fatalf("error writing snapshot: %v", err)
+	}
+
+	bytes, err := os.ReadFile(cfg.Snapshot.File)
+	if err != nil {
+		t.Fatalf("error reading snapshot: %v", err)
+	}
+
+	var state snapshotState
+	if err := json.Unmarshal(bytes, &state); err != nil {
+		t.Fatalf("error decoding snapshot: %v", err)
+	}
+
+	watermark := time.Date(2022, 5, 10, 2, 0, 0, 0, time.UTC)
+	if state.Completed != 2 || !state.Watermarks["candles"].Equal(watermark) {
+		t.Fatalf("unexpected snapshot state: %+v", state)
+	}
+
+	if !resumable() {
+		t.Fatalf("expected the snapshot to be resumable")
+	}
+
+	resumed, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error resuming requests: %v", err)
+	}
+
+	if len(resumed) != 1 {
+		t.Fatalf("expected 1 resumed request, got %d", len(resumed))
+	}
+
+	if resumed[0].fetchConfig.URL.String() != requests[2].fetchConfig.URL.String() {
+		t.Fatalf("expected resumed URL %v, got %v", requests[2].fetchConfig.URL, resumed[0].fetchConfig.URL)
+	}
+
+	if resumed[0].fetchConfig.RateLimiter != cfg.rateLimiters[""] {
+		t.Fatalf("expected the resumed request to share the rate limiter of the config")
+	}
+
+	if len(resumed[0].deletes) != 1 || !proto.Equal(resumed[0].deletes[0], requests[2].deletes[0]) {
+		t.Fatalf("expected resumed deletes %v, got %v", requests[2].deletes, resumed[0].deletes)
+	}
+
+	if err := cfg.Snapshot.remove(context.Background(), fileCheckpoints{}); err != nil {
+		t.Fatalf("error removing snapshot: %v", err)
+	}
+
+	if resumable() {
+		t.Fatalf("expected the snapshot not to be resumable after it is removed")
+	}
+}
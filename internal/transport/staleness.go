@@ -0,0 +1,103 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+// defaultStalenessRetryInterval is the time to wait before fetching a stale response again, if the staleness guard
+// does not define one.
+const defaultStalenessRetryInterval = time.Second
+
+// ErrStaleResponse is returned when the newest record of a response is older than the maximum age of the request.
+var ErrStaleResponse = fmt.Errorf("stale response")
+
+// StaleResponseError wraps an error with ErrStaleResponse.
+func StaleResponseError(newest time.Time, age time.Duration) error {
+	return fmt.Errorf("%w: newest record at %v is %v old", ErrStaleResponse, newest, age)
+}
+
+// Staleness is a guard against loading stale data, e.g. from an upstream cache or a lagging replica. A response is
+// stale if the newest timestamp of its records is older than the maximum age. Stale responses are fetched again until
+// the retries are exhausted.
+type Staleness struct {
+	// Field is the dot-separated path to the timestamp of each record. The timestamp may be a number of seconds
+	// since the unix epoch or an RFC3339 string.
+	Field string `yaml:"field"`
+
+	// MaxAge is the maximum age of the newest record in the response, e.g. "5m".
+	MaxAge time.Duration `yaml:"maxAge"`
+
+	// Retries is the number of times to fetch a stale response again before failing.
+	Retries int `yaml:"retries"`
+
+	// RetryInterval is the time to wait before fetching a stale response again, the default is one second.
+	RetryInterval time.Duration `yaml:"retryInterval"`
+}
+
+// retryInterval will return the time to wait before fetching a stale response again.
+func (staleness *Staleness) retryInterval() time.Duration {
+	if staleness.RetryInterval <= 0 {
+		return defaultStalenessRetryInterval
+	}
+
+	return staleness.RetryInterval
+}
+
+// check will return an error if the newest record in the JSON encoded response is older than the maximum age. The
+// records are the response itself if it is an object, or the elements of the response if it is an array. Records
+// without the timestamp field are ignored, and a response without any timestamps is never stale.
+func (staleness *Staleness) check(data []byte, now time.Time) error {
+	if staleness == nil {
+		return nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	var newest time.Time
+
+	for _, record := range records {
+		val, err := tools.LookupJSONPath(record, staleness.Field)
+		if errors.Is(err, tools.ErrJSONPathNotFound) {
+			continue
+		}
+
+		timestamp, err := tools.ParseJSONTime(val)
+		if err != nil {
+			return fmt.Errorf("unable to parse %q: %w", staleness.Field, err)
+		}
+
+		if timestamp.After(newest) {
+			newest = timestamp
+		}
+	}
+
+	if newest.IsZero() {
+		return nil
+	}
+
+	if age := now.Sub(newest); age > staleness.MaxAge {
+		return StaleResponseError(newest, age)
+	}
+
+	return nil
+}
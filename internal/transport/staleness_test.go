@@ -0,0 +1,105 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func TestStaleness(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 5, 10, 12, 0, 0, 0, time.UTC)
+	staleness := &Staleness{Field: "time", MaxAge: time.Hour}
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		err  error
+	}{
+		{name: "fresh array", data: `[{"time":"2022-05-10T10:00:00Z"},{"time":"2022-05-10T11:30:00Z"}]`},
+		{name: "stale array", data: `[{"time":"2022-05-10T10:00:00Z"},{"time":"2022-05-10T10:30:00Z"}]`,
+			err: ErrStaleResponse},
+		{name: "unix seconds", data: fmt.Sprintf(`{"time":%d}`, now.Add(-2*time.Hour).Unix()), err: ErrStaleResponse},
+		{name: "no timestamps", data: `[{"id":1}]`},
+		{name: "empty", data: `[]`},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := staleness.check([]byte(tcase.data), now); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+		})
+	}
+
+	t.Run("retry", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timestamp := time.Now().Add(-2 * time.Hour)
+			if atomic.AddInt32(&calls, 1) > 1 {
+				timestamp = time.Now()
+			}
+
+			fmt.Fprintf(w, `[{"time":%q}]`, timestamp.Format(time.RFC3339))
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		rurl, _ := url.Parse(server.URL)
+		job := &webJob{
+			flattenedRequest: &flattenedRequest{
+				fetchConfig: &web.FetchConfig{
+					C:           client,
+					Method:      http.MethodGet,
+					URL:         rurl,
+					RateLimiter: rate.NewLimiter(rate.Inf, 1),
+				},
+				staleness: &Staleness{
+					Field:         "time",
+					MaxAge:        time.Hour,
+					Retries:       1,
+					RetryInterval: time.Millisecond,
+				},
+			},
+			logger: logrus.New(),
+		}
+
+		if _, _, _, err := fetch(context.Background(), job); err != nil {
+			t.Fatalf("expected the retry to succeed, got %v", err)
+		}
+
+		job.staleness.Retries = 0
+		atomic.StoreInt32(&calls, 0)
+
+		if _, _, _, err := fetch(context.Background(), job); !errors.Is(err, ErrStaleResponse) {
+			t.Fatalf("expected a stale response error, got %v", err)
+		}
+	})
+}
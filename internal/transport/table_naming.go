@@ -0,0 +1,117 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownTableNaming is returned when the configuration references a table naming strategy that does not exist.
+var ErrUnknownTableNaming = fmt.Errorf("unknown table naming strategy")
+
+// UnknownTableNamingError wraps an error with ErrUnknownTableNaming.
+func UnknownTableNamingError(name string) error {
+	return fmt.Errorf("%w: %q", ErrUnknownTableNaming, name)
+}
+
+// TableNaming is the strategy used to derive the name of a table from the endpoint of a request that does not define
+// a table.
+type TableNaming string
+
+const (
+	// TableNamingLast will use the last segment of the endpoint, e.g. "/products/{id}/candles" is stored in
+	// "candles". This is the default strategy.
+	TableNamingLast TableNaming = "last"
+
+	// TableNamingPath will join the static segments of the endpoint, singularizing the segments that precede a path
+	// parameter, e.g. "/products/{id}/candles" is stored in "product_candles".
+	TableNamingPath TableNaming = "path"
+)
+
+// validate will return an error if the table naming strategy is not supported.
+func (naming TableNaming) validate() error {
+	switch naming {
+	case "", TableNamingLast, TableNamingPath:
+		return nil
+	default:
+		return UnknownTableNamingError(string(naming))
+	}
+}
+
+// tableName will derive the name of a table from the endpoint.
+func (naming TableNaming) tableName(endpoint string) string {
+	if naming != TableNamingPath {
+		endpointParts := strings.Split(endpoint, "/")
+
+		return endpointParts[len(endpointParts)-1]
+	}
+
+	// Ignore the query string, the path parameters are all that is used to name the table.
+	endpoint = strings.SplitN(endpoint, "?", 2)[0]
+
+	var segments []string
+
+	for _, segment := range strings.Split(endpoint, "/") {
+		if segment == "" {
+			continue
+		}
+
+		if isPathParameter(segment) {
+			// The collection preceding a path parameter refers to a single item of that collection.
+			if len(segments) > 0 {
+				segments[len(segments)-1] = singularize(segments[len(segments)-1])
+			}
+
+			continue
+		}
+
+		if sanitized := sanitizeTableSegment(segment); sanitized != "" {
+			segments = append(segments, sanitized)
+		}
+	}
+
+	return strings.Join(segments, "_")
+}
+
+// isPathParameter will return true if the endpoint segment is a placeholder for a path parameter, e.g. "{id}" or ":id".
+func isPathParameter(segment string) bool {
+	return strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// sanitizeTableSegment will lowercase the segment and replace every character that is not valid in an unquoted table
+// name with an underscore, collapsing consecutive underscores.
+func sanitizeTableSegment(segment string) string {
+	var builder strings.Builder
+
+	for _, r := range strings.ToLower(segment) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			builder.WriteRune(r)
+
+			continue
+		}
+
+		if s := builder.String(); s != "" && !strings.HasSuffix(s, "_") {
+			builder.WriteRune('_')
+		}
+	}
+
+	return strings.TrimSuffix(builder.String(), "_")
+}
+
+// singularize will naively convert a plural english word into its singular form.
+func singularize(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "ss"):
+		return word
+	default:
+		return strings.TrimSuffix(word, "s")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTableNaming(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		naming   TableNaming
+		endpoint string
+		expected string
+	}{
+		{naming: "", endpoint: "/products/{id}/candles", expected: "candles"},
+		{naming: TableNamingLast, endpoint: "/accounts", expected: "accounts"},
+		{naming: TableNamingPath, endpoint: "/products/{id}/candles", expected: "product_candles"},
+		{naming: TableNamingPath, endpoint: "/products/:id/candles", expected: "product_candles"},
+		{naming: TableNamingPath, endpoint: "/currencies/{id}/orders/{id}", expected: "currency_order"},
+		{naming: TableNamingPath, endpoint: "/v2/Order-Book?level=2", expected: "v2_order_book"},
+		{naming: TableNamingPath, endpoint: "/accounts/", expected: "accounts"},
+	} {
+		tcase := tcase
+
+		t.Run(fmt.Sprintf("%s %s", tcase.naming, tcase.endpoint), func(t *testing.T) {
+			t.Parallel()
+
+			if actual := tcase.naming.tableName(tcase.endpoint); actual != tcase.expected {
+				t.Fatalf("expected table %q, got %q", tcase.expected, actual)
+			}
+		})
+	}
+
+	t.Run("unknown strategy", func(t *testing.T) {
+		t.Parallel()
+
+		if err := TableNaming("camel").validate(); !errors.Is(err, ErrUnknownTableNaming) {
+			t.Fatalf("expected unknown table naming error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// uuidSize is the number of random bytes in a UUID.
+	uuidSize = 16
+
+	// uuidVersionByte and uuidVariantByte are the indexes of the bytes that hold the version and variant of a UUID.
+	uuidVersionByte = 6
+	uuidVariantByte = 8
+
+	// hoursPerDay is used to support a "d" unit in template durations.
+	hoursPerDay = 24
+)
+
+// templateTime is a time returned by template functions. It is printed in RFC3339 format.
+type templateTime struct{ time.Time }
+
+// String will format the time in RFC3339 format.
+func (t templateTime) String() string {
+	return t.Format(time.RFC3339)
+}
+
+// templateFuncs are the functions that can be used in the templates of request values, e.g. the endpoint and query
+// values. For example, the query value `{{ dateAdd "-1d" now | format "2006-01-02" }}` is yesterday's date.
+var templateFuncs = template.FuncMap{
+	// now returns the current UTC time.
+	"now": func() templateTime { return templateTime{time.Now().UTC()} },
+
+	// dateAdd adds a duration to a time, e.g. "-1h" or "7d".
+	"dateAdd": func(duration string, t templateTime) (templateTime, error) {
+		d, err := parseTemplateDuration(duration)
+		if err != nil {
+			return templateTime{}, err
+		}
+
+		return templateTime{t.Add(d)}, nil
+	},
+
+	// format formats a time with a Go time layout.
+	"format": func(layout string, t templateTime) string { return t.Format(layout) },
+
+	// unix returns the number of seconds since the unix epoch of a time.
+	"unix": func(t templateTime) int64 { return t.Unix() },
+
+	// env returns the value of an environment variable.
+	"env": os.Getenv,
+
+	// uuid returns a random (version 4) UUID.
+	"uuid": newUUID,
+
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// parseTemplateDuration will parse a duration string, with support for a number of days, e.g. "-7d".
+func parseTemplateDuration(duration string) (time.Duration, error) {
+	if days := strings.TrimSuffix(duration, "d"); days != duration {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse duration %q: %w", duration, err)
+		}
+
+		return time.Duration(n) * hoursPerDay * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse duration %q: %w", duration, err)
+	}
+
+	return d, nil
+}
+
+// newUUID will return a random (version 4) UUID.
+func newUUID() (string, error) {
+	b := make([]byte, uuidSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate uuid: %w", err)
+	}
+
+	b[uuidVersionByte] = (b[uuidVersionByte] & 0x0f) | 0x40
+	b[uuidVariantByte] = (b[uuidVariantByte] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// templateData is the data of the endpoint and query templates of a request. Each is the value of a foreach request,
+// and is empty for other requests.
+type templateData struct {
+	Each string
+}
+
+// renderTemplate will execute the template functions in a request value with the data. Values without a template are
+// returned as they are.
+func renderTemplate(name, text string, data interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse %s template %q: %w", name, text, err)
+	}
+
+	var bldr strings.Builder
+	if err := tmpl.Execute(&bldr, data); err != nil {
+		return "", fmt.Errorf("unable to execute %s template %q: %w", name, text, err)
+	}
+
+	return bldr.String(), nil
+}
+
+// render will return a copy of the request with the templates in the endpoint, query, and header values executed. The
+// templates are executed every time the request is rendered, so values like "now" and "uuid" are evaluated for every
+// request and every chunk of a timeseries.
+func (req *Request) render() (*Request, error) {
+	rendered := *req
+	data := templateData{Each: req.each}
+
+	var err error
+
+	rendered.Endpoint, err = renderTemplate("endpoint", req.Endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Query != nil {
+		rendered.Query = make(map[string]string, len(req.Query))
+
+		for key, value := range req.Query {
+			if rendered.Query[key], err = renderTemplate("query", value, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if req.QueryParams != nil {
+		rendered.QueryParams = make([]*QueryParam, 0, len(req.QueryParams))
+
+		for _, param := range req.QueryParams {
+			renderedParam := *param
+			renderedParam.Values = make([]string, len(param.Values))
+
+			for idx, value := range param.Values {
+				if renderedParam.Values[idx], err = renderTemplate("query", value, data); err != nil {
+					return nil, err
+				}
+			}
+
+			rendered.QueryParams = append(rendered.QueryParams, &renderedParam)
+		}
+	}
+
+	if req.Headers != nil {
+		rendered.Headers = make(map[string]string, len(req.Headers))
+
+		for key, value := range req.Headers {
+			if rendered.Headers[key], err = renderTemplate("header", value, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &rendered, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	t.Setenv("GIDARI_TEST_PRODUCT", "btc-usd")
+
+	today := time.Now().UTC().Format("2006-01-02")
+	yesterday := time.Now().UTC().Add(-24 * time.Hour).Format("2006-01-02")
+
+	for _, tcase := range []struct {
+		text     string
+		expected string
+		pattern  string
+	}{
+		{text: "plain", expected: "plain"},
+		{text: `{{ now | format "2006-01-02" }}`, expected: today},
+		{text: `{{ now | dateAdd "-1d" | format "2006-01-02" }}`, expected: yesterday},
+		{text: `{{ env "GIDARI_TEST_PRODUCT" | upper }}`, expected: "BTC-USD"},
+		{text: `{{ lower "ABC" }}`, expected: "abc"},
+		{text: `{{ uuid }}`, pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{text: `{{ now }}`, pattern: `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`},
+	} {
+		actual, err := renderTemplate("test", tcase.text, nil)
+		if err != nil {
+			t.Fatalf("error rendering %q: %v", tcase.text, err)
+		}
+
+		if tcase.pattern != "" {
+			if !regexp.MustCompile(tcase.pattern).MatchString(actual) {
+				t.Errorf("expected %q to render to a match of %q, got %q", tcase.text, tcase.pattern, actual)
+			}
+
+			continue
+		}
+
+		if actual != tcase.expected {
+			t.Errorf("expected %q to render to %q, got %q", tcase.text, tcase.expected, actual)
+		}
+	}
+
+	if _, err := renderTemplate("test", `{{ dateAdd "tomorrow" now }}`, nil); err == nil {
+		t.Errorf("expected an error for an invalid duration")
+	}
+}
+
+func TestRequestTemplates(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /products/{{ upper "btc-usd" }}/candles
+    table: candles
+    query:
+      start: '{{ now | dateAdd "-3h" | format "2006-01-02T15:00:00Z07:00" }}'
+      end: '{{ now | format "2006-01-02T15:00:00Z07:00" }}'
+      request_id: '{{ uuid }}'
+    headers:
+      X-Request-Date: '{{ now | format "2006-01-02" }}'
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+`)
+
+	cfg, err := NewConfig(cfgYAML)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	requests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(requests))
+	}
+
+	ids := make(map[string]bool)
+
+	for _, req := range requests {
+		if req.fetchConfig.URL.Path != "/products/BTC-USD/candles" {
+			t.Fatalf("unexpected path: %s", req.fetchConfig.URL.Path)
+		}
+
+		if date := req.fetchConfig.Header.Get("X-Request-Date"); date != time.Now().UTC().Format("2006-01-02") {
+			t.Fatalf("unexpected header: %s", date)
+		}
+
+		ids[req.fetchConfig.URL.Query().Get("request_id")] = true
+	}
+
+	if len(ids) != len(requests) {
+		t.Fatalf("expected the uuid to be evaluated for every chunk, got %v", ids)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// maxThrottledAttempts is the number of times that a request is made again after the web API throttles it, before the
+// request fails.
+const maxThrottledAttempts = 10
+
+// retryAfter will return the delay of the "Retry-After" header of a 429 or 503 response error, which is either a
+// number of seconds or an HTTP date. The second value is false if the error is not a throttled response.
+func retryAfter(err error, now time.Time) (time.Duration, bool) {
+	var rspErr *web.ResponseError
+	if !errors.As(err, &rspErr) {
+		return 0, false
+	}
+
+	if rspErr.StatusCode != http.StatusTooManyRequests && rspErr.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	value := strings.TrimSpace(rspErr.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+
+	return 0, true
+}
+
+// pauseLimiter will reserve the tokens of the rate limiter until the next token is available after the delay, so that
+// every request sharing the limiter is paused. It returns false if the limiter can not be paused, e.g. if it has no
+// limit.
+func pauseLimiter(limiter *rate.Limiter, delay time.Duration) bool {
+	if limiter.Limit() == rate.Inf || limiter.Limit() <= 0 || limiter.Burst() <= 0 {
+		return false
+	}
+
+	now := time.Now()
+
+	for {
+		reservation := limiter.ReserveN(now, limiter.Burst())
+		if !reservation.OK() {
+			return false
+		}
+
+		if reservation.DelayFrom(now) >= delay {
+			return true
+		}
+	}
+}
+
+// fetchThrottled will make the web request of the job with its retry policy. If the web API throttles the request
+// with a 429 or 503 response and a "Retry-After" header, the rate limiter of the request is paused for the delay and
+// the request is made again, instead of failing. Requests with an unlimited rate limiter sleep for the delay instead.
+// If the job has a maintenance configuration, 503 responses are retried with its backoff schedule until its max wait
+// is exceeded, rather than a fixed number of times.
+func fetchThrottled(ctx context.Context, job *webJob) (*web.FetchResponse, error) {
+	var (
+		throttled, unavailable int
+		since                  time.Time
+	)
+
+	for {
+		start := time.Now()
+
+		rsp, err := job.retry.fetch(ctx, job.fetchConfig, job.logger, job.result.timingCounters())
+		if ctx.Err() != nil {
+			return rsp, err
+		}
+
+		if err == nil && rsp != nil {
+			job.autoscaler.observe(time.Since(start), rsp.RateLimiterWait)
+		}
+
+		now := time.Now()
+		if since.IsZero() {
+			since = now
+		}
+
+		var (
+			delay time.Duration
+			ok    bool
+			msg   = "request throttled by the web API, pausing"
+		)
+
+		if job.maintenance.handles(err) {
+			if delay, ok = job.maintenance.backoff(err, unavailable, since, now); !ok {
+				return rsp, err
+			}
+
+			unavailable++
+			msg = "request unavailable during maintenance of the web API, pausing"
+		} else {
+			if delay, ok = retryAfter(err, now); !ok || throttled >= maxThrottledAttempts {
+				return rsp, err
+			}
+
+			throttled++
+		}
+
+		logWarn := tools.LogEvent{Msg: msg, URL: job.fetchConfig.URL.Redacted(), Delay: delay}
+		logWarn.Log(job.logger, logrus.WarnLevel)
+
+		if pauseLimiter(job.fetchConfig.RateLimiter, delay) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("unable to retry throttled request: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
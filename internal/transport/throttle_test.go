@@ -0,0 +1,134 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	t.Run("retry after", func(t *testing.T) {
+		t.Parallel()
+
+		now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+		for _, tcase := range []struct {
+			name      string
+			status    int
+			header    string
+			delay     time.Duration
+			throttled bool
+		}{
+			{"seconds", http.StatusTooManyRequests, "120", 2 * time.Minute, true},
+			{"date", http.StatusServiceUnavailable, "Sat, 01 Oct 2022 12:00:30 GMT", 30 * time.Second, true},
+			{"past date", http.StatusTooManyRequests, "Sat, 01 Oct 2022 11:00:00 GMT", 0, true},
+			{"no header", http.StatusTooManyRequests, "", 0, false},
+			{"invalid", http.StatusTooManyRequests, "soon", 0, false},
+			{"negative", http.StatusTooManyRequests, "-1", 0, false},
+			{"not throttled", http.StatusInternalServerError, "120", 0, false},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				header := http.Header{}
+				if tcase.header != "" {
+					header.Set("Retry-After", tcase.header)
+				}
+
+				err := fmt.Errorf("wrapped: %w", &web.ResponseError{StatusCode: tcase.status, Header: header})
+
+				delay, throttled := retryAfter(err, now)
+				if delay != tcase.delay || throttled != tcase.throttled {
+					t.Fatalf("expected (%v, %v), got (%v, %v)", tcase.delay, tcase.throttled, delay, throttled)
+				}
+			})
+		}
+	})
+
+	t.Run("pause limiter", func(t *testing.T) {
+		t.Parallel()
+
+		limiter := rate.NewLimiter(rate.Every(10*time.Millisecond), 2)
+		if !pauseLimiter(limiter, time.Second) {
+			t.Fatalf("expected the limiter to be paused")
+		}
+
+		reservation := limiter.Reserve()
+		defer reservation.Cancel()
+
+		if delay := reservation.Delay(); delay < time.Second-10*time.Millisecond {
+			t.Fatalf("expected the next token to be available after a second, got %v", delay)
+		}
+
+		if pauseLimiter(rate.NewLimiter(rate.Inf, 1), time.Second) {
+			t.Fatalf("expected an unlimited limiter not to be paused")
+		}
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) <= 2 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+
+				return
+			}
+
+			fmt.Fprint(w, `[]`)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := web.NewClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+
+		rurl, _ := url.Parse(server.URL)
+		job := &webJob{
+			flattenedRequest: &flattenedRequest{
+				fetchConfig: &web.FetchConfig{
+					C:           client,
+					Method:      http.MethodGet,
+					URL:         rurl,
+					RateLimiter: rate.NewLimiter(rate.Every(time.Millisecond), 1),
+				},
+			},
+			logger: logrus.New(),
+		}
+
+		rsp, err := fetchThrottled(context.Background(), job)
+		if err != nil {
+			t.Fatalf("expected the throttled request to succeed, got %v", err)
+		}
+
+		rsp.Body.Close()
+
+		if got := atomic.LoadInt32(&calls); got != 3 {
+			t.Fatalf("expected 3 calls, got %d", got)
+		}
+	})
+}
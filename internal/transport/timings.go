@@ -0,0 +1,99 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+// Timings is the time that the workers of a run spent on each stage of the pipeline, summed over the workers. It shows
+// what limits a run: a run that mostly waits on the rate limiter needs a higher tier of the web API, and a run that
+// mostly waits on storage needs a faster or better tuned database.
+type Timings struct {
+	// RateLimiter is the time that the web requests waited on the rate limiter before they were made.
+	RateLimiter time.Duration
+
+	// Network is the time of the web requests, from when they were made until their responses were read. The time of
+	// the requests that failed includes their wait on the rate limiter.
+	Network time.Duration
+
+	// Storage is the time of the storage operations of the upserts, i.e. the upserts and the scoped deletes.
+	Storage time.Duration
+}
+
+// String will return the timings with the share of each stage, e.g. "rate limiter 1m0s (75%), network 15s (18%),
+// storage 5s (6%)".
+func (timings Timings) String() string {
+	total := timings.RateLimiter + timings.Network + timings.Storage
+
+	share := func(d time.Duration) int64 {
+		if total <= 0 {
+			return 0
+		}
+
+		return int64(d * 100 / total)
+	}
+
+	return fmt.Sprintf("rate limiter %s (%d%%), network %s (%d%%), storage %s (%d%%)",
+		timings.RateLimiter, share(timings.RateLimiter), timings.Network, share(timings.Network), timings.Storage,
+		share(timings.Storage))
+}
+
+// timingCounters are the timings of a run, which are added to by the web and repository workers concurrently.
+type timingCounters struct {
+	rateLimiter int64
+	network     int64
+	storage     int64
+}
+
+// addFetch will add the time of a web request and of its wait on the rate limiter.
+func (counters *timingCounters) addFetch(rateLimiter, network time.Duration) {
+	metrics.addTimings(rateLimiter, network, 0)
+
+	if counters == nil {
+		return
+	}
+
+	atomic.AddInt64(&counters.rateLimiter, int64(rateLimiter))
+	atomic.AddInt64(&counters.network, int64(network))
+}
+
+// addStorage will add the time of a storage operation.
+func (counters *timingCounters) addStorage(d time.Duration) {
+	metrics.addTimings(0, 0, d)
+
+	if counters == nil {
+		return
+	}
+
+	atomic.AddInt64(&counters.storage, int64(d))
+}
+
+// addResponse will add the time of a web request that took the duration, which includes its wait on the rate limiter.
+// The wait is only known for the requests that succeeded.
+func (counters *timingCounters) addResponse(rsp *web.FetchResponse, d time.Duration) {
+	var wait time.Duration
+	if rsp != nil && rsp.RateLimiterWait <= d {
+		wait = rsp.RateLimiterWait
+	}
+
+	counters.addFetch(wait, d-wait)
+}
+
+// load will return the timings that have been added.
+func (counters *timingCounters) load() Timings {
+	return Timings{
+		RateLimiter: time.Duration(atomic.LoadInt64(&counters.rateLimiter)),
+		Network:     time.Duration(atomic.LoadInt64(&counters.network)),
+		Storage:     time.Duration(atomic.LoadInt64(&counters.storage)),
+	}
+}
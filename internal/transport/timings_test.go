@@ -0,0 +1,77 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alpine-hodler/gidari/internal/web"
+)
+
+func TestTimingCounters(t *testing.T) {
+	t.Parallel()
+
+	result := newUpsertResult()
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 10; worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			counters := result.timingCounters()
+			counters.addResponse(&web.FetchResponse{RateLimiterWait: 3 * time.Second}, 4*time.Second)
+			counters.addResponse(nil, time.Second)
+			counters.addStorage(2 * time.Second)
+		}()
+	}
+
+	wg.Wait()
+
+	expected := Timings{RateLimiter: 30 * time.Second, Network: 20 * time.Second, Storage: 20 * time.Second}
+	if got := result.Timings(); got != expected {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+
+	var nilResult *UpsertResult
+	nilResult.timingCounters().addStorage(time.Second)
+}
+
+func TestTimingsString(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		timings  Timings
+		expected string
+	}{
+		{
+			name:     "empty",
+			expected: "rate limiter 0s (0%), network 0s (0%), storage 0s (0%)",
+		},
+		{
+			name:     "rate limited",
+			timings:  Timings{RateLimiter: time.Minute, Network: 15 * time.Second, Storage: 5 * time.Second},
+			expected: "rate limiter 1m0s (75%), network 15s (18%), storage 5s (6%)",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tcase.timings.String(); got != tcase.expected {
+				t.Fatalf("expected %q, got %q", tcase.expected, got)
+			}
+		})
+	}
+}
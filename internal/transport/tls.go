@@ -0,0 +1,84 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// ErrInvalidTLS is returned when the TLS configuration is invalid.
+var ErrInvalidTLS = fmt.Errorf("invalid tls")
+
+// InvalidTLSError wraps an error with ErrInvalidTLS.
+func InvalidTLSError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidTLS, msg)
+}
+
+// TLS is the TLS configuration of the web requests, for internal web APIs fronted by a private PKI or mutual TLS.
+type TLS struct {
+	// CertFile and KeyFile are the paths of the PEM encoded certificate and private key that authenticate the
+	// requests to web APIs requiring mutual TLS. They must be set together.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// CAFile is the path of a PEM encoded bundle of the root certificates that verify the web API, e.g. of a private
+	// certificate authority. The default is the root certificates of the host.
+	CAFile string `yaml:"caFile"`
+
+	// ServerName is the name of the web API that its certificate is verified against, the default is the host of the
+	// URL of the requests.
+	ServerName string `yaml:"serverName"`
+}
+
+// validate will ensure that the TLS configuration is valid, and that its files can be loaded.
+func (cfg *TLS) validate() error {
+	_, err := cfg.config()
+
+	return err
+}
+
+// config will load the TLS configuration of the requests, or return nil if there is none.
+func (cfg *TLS) config() (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, InvalidTLSError("certFile and keyFile must be set together")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, InvalidTLSError(fmt.Sprintf("unable to load client certificate: %v", err))
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		bundle, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, InvalidTLSError(fmt.Sprintf("unable to read CA file: %v", err))
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, InvalidTLSError(fmt.Sprintf("no certificates in CA file %q", cfg.CAFile))
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
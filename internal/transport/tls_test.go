@@ -0,0 +1,152 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert will write a self-signed client certificate and its key to the directory, returning the paths of
+// the files and the certificate.
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gidari"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshaling key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("error writing certificate: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("error writing key: %v", err)
+	}
+
+	return certFile, keyFile, cert
+}
+
+func TestTLS(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":1}]`))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("error writing CA file: %v", err)
+	}
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			cfg *TLS
+			err error
+		}{
+			{nil, nil},
+			{&TLS{CAFile: caFile}, nil},
+			{&TLS{CertFile: certFile, KeyFile: keyFile}, nil},
+			{&TLS{CertFile: certFile}, ErrInvalidTLS},
+			{&TLS{CertFile: certFile, KeyFile: caFile}, ErrInvalidTLS},
+			{&TLS{CAFile: keyFile}, ErrInvalidTLS},
+			{&TLS{CAFile: filepath.Join(dir, "missing.pem")}, ErrInvalidTLS},
+		} {
+			if err := tcase.cfg.validate(); !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v for %+v, got %v", tcase.err, tcase.cfg, err)
+			}
+		}
+	})
+
+	t.Run("mutual tls", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name string
+			cfg  *TLS
+			ok   bool
+		}{
+			{"client certificate", &TLS{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}, true},
+			{"no client certificate", &TLS{CAFile: caFile}, false},
+			{"no CA", &TLS{CertFile: certFile, KeyFile: keyFile}, false},
+		} {
+			rt, err := (&Config{TLS: tcase.cfg}).newRoundTripper(new(Egress))
+			if err != nil {
+				t.Fatalf("error creating round tripper: %v", err)
+			}
+
+			rsp, err := (&http.Client{Transport: rt}).Get(server.URL)
+			if err == nil {
+				rsp.Body.Close()
+			}
+
+			if ok := err == nil && rsp.StatusCode == http.StatusOK; ok != tcase.ok {
+				t.Fatalf("expected the request with %s to succeed: %v, got %v", tcase.name, tcase.ok, err)
+			}
+		}
+	})
+}
@@ -9,12 +9,17 @@ package transport
 
 import (
 	"context"
+	"crypto"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"runtime"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alpine-hodler/gidari/internal/storage"
@@ -37,8 +42,15 @@ var (
 	ErrSettingTimeseriesChunks  = fmt.Errorf("failed to set timeseries chunks")
 	ErrUnableToParse            = fmt.Errorf("unable to parse")
 	ErrNoRequests               = fmt.Errorf("no requests defined")
+	ErrSingletonNotObject       = fmt.Errorf("singleton response is not a JSON object")
+	ErrInvalidAuthentication    = fmt.Errorf("invalid authentication")
 )
 
+// InvalidAuthenticationError is returned when the authentication configuration is invalid.
+func InvalidAuthenticationError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidAuthentication, msg)
+}
+
 // MissingConfigFieldError is returned when a configuration field is missing.
 func MissingConfigFieldError(field string) error {
 	return fmt.Errorf("%w: %s", ErrMissingConfigField, field)
@@ -59,6 +71,11 @@ func UnableToParseError(name string) error {
 	return fmt.Errorf("%s %w", name, ErrUnableToParse)
 }
 
+// SingletonNotObjectError is returned when the response of a singleton request is not a single JSON object.
+func SingletonNotObjectError(table string) error {
+	return fmt.Errorf("%w: %s", ErrSingletonNotObject, table)
+}
+
 // WrapRepositoryError will wrap an error from the repository with a message.
 func WrapRepositoryError(err error) error {
 	return fmt.Errorf("repository: %w", err)
@@ -71,20 +88,498 @@ func WrapWebError(err error) error {
 
 // APIKey is one method of HTTP(s) transport that requires a passphrase, key, and secret.
 type APIKey struct {
-	Passphrase string `yaml:"passphrase"`
-	Key        string `yaml:"key"`
-	Secret     string `yaml:"secret"`
+	Passphrase string     `yaml:"passphrase"`
+	Key        string     `yaml:"key"`
+	Secret     string     `yaml:"secret"`
+	ClockSync  *ClockSync `yaml:"clockSync"`
+}
+
+// ClockSync is the configuration for synchronizing the timestamps of request signatures with the server time of the
+// web API, for APIs that reject signatures when the local clock drifts beyond their tolerance.
+type ClockSync struct {
+	// Endpoint is the fragment of the URL that returns the server time. If the endpoint is empty, then the clock
+	// is synchronized with the "Date" header of every response.
+	Endpoint string `yaml:"endpoint"`
+
+	// Field is the dot-separated path to the server time in the endpoint's JSON response. The server time may be
+	// a number of seconds since the unix epoch or an RFC3339 string. If the field is empty, the "Date" header of
+	// the endpoint's response is used.
+	Field string `yaml:"field"`
+}
+
+// newClock will create a clock for signing requests. If an endpoint is defined, the clock is synchronized with the
+// endpoint before it is returned, with the base round tripper of the requests. If there is no clock sync
+// configuration, the clock uses the local time.
+func (cs *ClockSync) newClock(ctx context.Context, rurl url.URL, base http.RoundTripper) (*auth.Clock, error) {
+	if cs == nil {
+		return auth.NewClock(), nil
+	}
+
+	clock := auth.NewClock()
+	if cs.Endpoint == "" {
+		return clock.SetSyncDate(true), nil
+	}
+
+	rurl.Path = path.Join(rurl.Path, cs.Endpoint)
+	if err := clock.Sync(ctx, &http.Client{Transport: base}, rurl.String(), cs.Field); err != nil {
+		return nil, WrapWebError(err)
+	}
+
+	return clock, nil
 }
 
 // Auth2 is a struct that contains the authentication data for a web API that uses OAuth2.
 type Auth2 struct {
 	Bearer string `yaml:"bearer"`
+
+	// TokenURL, ClientID, ClientSecret, and Scopes are the OAuth2 client credentials flow, which is used instead of a
+	// static bearer. The bearer is fetched from the token URL and fetched again when it expires, e.g. during a long
+	// timeseries backfill.
+	TokenURL     string   `yaml:"tokenURL"`
+	ClientID     string   `yaml:"clientID"`
+	ClientSecret string   `yaml:"clientSecret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+func (auth2 *Auth2) validate() error {
+	if auth2 == nil {
+		return nil
+	}
+
+	if auth2.TokenURL == "" {
+		if auth2.ClientID != "" || auth2.ClientSecret != "" || len(auth2.Scopes) > 0 {
+			return InvalidAuthenticationError("auth2 client credentials require a tokenURL")
+		}
+
+		return nil
+	}
+
+	if auth2.Bearer != "" {
+		return InvalidAuthenticationError("auth2 can not have both a bearer and a tokenURL")
+	}
+
+	if auth2.ClientID == "" || auth2.ClientSecret == "" {
+		return InvalidAuthenticationError("auth2 tokenURL requires a clientID and clientSecret")
+	}
+
+	return nil
+}
+
+// OAuth1 is the authentication data for a web API that signs requests with OAuth1, e.g. the consumer and access token
+// credentials of a Twitter app.
+type OAuth1 struct {
+	ConsumerKey    string `yaml:"consumerKey"`
+	ConsumerSecret string `yaml:"consumerSecret"`
+
+	// Token and TokenSecret are the access token credentials. They are empty for two-legged requests, which are signed
+	// with only the consumer credentials.
+	Token       string `yaml:"token"`
+	TokenSecret string `yaml:"tokenSecret"`
+
+	// SignatureMethod is the method used to sign the requests, "HMAC-SHA1" or "HMAC-SHA256". The default is
+	// "HMAC-SHA1".
+	SignatureMethod string `yaml:"signatureMethod"`
+
+	ClockSync *ClockSync `yaml:"clockSync"`
+}
+
+func (oauth1 *OAuth1) validate() error {
+	if oauth1 == nil {
+		return nil
+	}
+
+	if oauth1.ConsumerKey == "" || oauth1.ConsumerSecret == "" {
+		return InvalidAuthenticationError("oauth1 requires a consumerKey and consumerSecret")
+	}
+
+	if oauth1.SignatureMethod == "" {
+		return nil
+	}
+
+	for _, method := range auth.OAuth1SignatureMethods {
+		if oauth1.SignatureMethod == method {
+			return nil
+		}
+	}
+
+	return InvalidAuthenticationError(fmt.Sprintf("unsupported oauth1 signature method %q", oauth1.SignatureMethod))
+}
+
+// SigV4 is the authentication data for an AWS-hosted web API that signs requests with AWS Signature Version 4, e.g.
+// API Gateway or OpenSearch.
+type SigV4 struct {
+	// Region is the region of the web API, the default is the AWS_REGION or AWS_DEFAULT_REGION environment variable.
+	Region string `yaml:"region"`
+
+	// Service is the signing name of the service of the web API, e.g. "execute-api" for API Gateway or "es" for
+	// OpenSearch.
+	Service string `yaml:"service"`
+
+	// AccessKeyID, SecretAccessKey, and SessionToken are the credentials that sign the requests. If they are empty,
+	// the credentials are retrieved like the AWS SDKs do: from the environment, the profile of the shared credentials
+	// file, the role of the ECS task, or the role of the EC2 instance.
+	AccessKeyID     string `yaml:"accessKeyID"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+	SessionToken    string `yaml:"sessionToken"`
+
+	// Profile is the profile of the shared credentials file, the default is the AWS_PROFILE environment variable or
+	// "default".
+	Profile string `yaml:"profile"`
+}
+
+func (sigv4 *SigV4) validate() error {
+	if sigv4 == nil {
+		return nil
+	}
+
+	if sigv4.Service == "" {
+		return InvalidAuthenticationError("sigV4 requires a service")
+	}
+
+	if (sigv4.AccessKeyID == "") != (sigv4.SecretAccessKey == "") {
+		return InvalidAuthenticationError("sigV4 requires both an accessKeyID and secretAccessKey, or neither")
+	}
+
+	return nil
+}
+
+// region will return the region of the web API.
+func (sigv4 *SigV4) region() string {
+	if sigv4.Region != "" {
+		return sigv4.Region
+	}
+
+	return envRegion()
+}
+
+// credentials will return the provider of the credentials that sign the requests.
+func (sigv4 *SigV4) credentials() auth.AWSCredentialsProvider {
+	if sigv4.AccessKeyID != "" {
+		return auth.StaticAWSCredentials{
+			AccessKeyID:     sigv4.AccessKeyID,
+			SecretAccessKey: sigv4.SecretAccessKey,
+			SessionToken:    sigv4.SessionToken,
+		}
+	}
+
+	return auth.NewAWSCredentialsChain(sigv4.Profile)
+}
+
+// JWT is the authentication data for a web API that authorizes requests with a bearer JWT signed by a private key of
+// the client, instead of a token issued by the web API.
+type JWT struct {
+	// PrivateKey is the PEM encoded RSA or ECDSA private key that signs the tokens. PrivateKeyFile is the path to a
+	// file with the key, which is used if PrivateKey is empty.
+	PrivateKey     string `yaml:"privateKey"`
+	PrivateKeyFile string `yaml:"privateKeyFile"`
+
+	// Algorithm is the algorithm of the signatures, "RS256" or "ES256". The default is the algorithm of the key.
+	Algorithm string `yaml:"algorithm"`
+
+	// KeyID is the "kid" header of the tokens, which identifies the key to the web API.
+	KeyID string `yaml:"keyID"`
+
+	// Claims are the claims of the tokens, e.g. "iss", "sub", and "aud". The "iat", "nbf", and "exp" claims are set
+	// when a token is signed.
+	Claims map[string]interface{} `yaml:"claims"`
+
+	// TTL is the lifetime of the tokens, the default is 5 minutes. The tokens are signed again shortly before they
+	// expire.
+	TTL time.Duration `yaml:"ttl"`
+
+	ClockSync *ClockSync `yaml:"clockSync"`
+}
+
+func (jwt *JWT) validate() error {
+	if jwt == nil {
+		return nil
+	}
+
+	if jwt.PrivateKey == "" && jwt.PrivateKeyFile == "" {
+		return InvalidAuthenticationError("jwt requires a privateKey or privateKeyFile")
+	}
+
+	if jwt.TTL < 0 {
+		return InvalidAuthenticationError("jwt ttl must not be negative")
+	}
+
+	if jwt.Algorithm == "" {
+		return nil
+	}
+
+	for _, algorithm := range auth.JWTAlgorithms {
+		if jwt.Algorithm == algorithm {
+			return nil
+		}
+	}
+
+	return InvalidAuthenticationError(fmt.Sprintf("unsupported jwt algorithm %q", jwt.Algorithm))
+}
+
+// key will return the private key that signs the tokens.
+func (jwt *JWT) key() (crypto.Signer, error) {
+	data := []byte(jwt.PrivateKey)
+
+	if jwt.PrivateKey == "" {
+		var err error
+		if data, err = os.ReadFile(jwt.PrivateKeyFile); err != nil {
+			return nil, InvalidAuthenticationError(fmt.Sprintf("unable to read jwt private key: %v", err))
+		}
+	}
+
+	key, err := auth.ParseJWTPrivateKey(data)
+	if err != nil {
+		return nil, InvalidAuthenticationError(err.Error())
+	}
+
+	return key, nil
+}
+
+// claims will return the claims of the tokens, with the maps decoded from YAML converted to maps that can be JSON
+// encoded.
+func (jwt *JWT) claims() map[string]interface{} {
+	claims := make(map[string]interface{}, len(jwt.Claims))
+	for name, value := range jwt.Claims {
+		claims[name] = jsonValue(value)
+	}
+
+	return claims
+}
+
+// Basic is the authentication data for a web API that authorizes requests with HTTP Basic authentication, e.g.
+// internal and legacy web APIs.
+type Basic struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+func (basic *Basic) validate() error {
+	if basic == nil {
+		return nil
+	}
+
+	// RFC 7617 does not allow colons in the user-id, since the first colon separates it from the password.
+	if basic.Username == "" || strings.Contains(basic.Username, ":") {
+		return InvalidAuthenticationError("basic requires a username without colons")
+	}
+
+	return nil
+}
+
+// CustomKey is the authentication data for a web API that authorizes requests with an API key in a header or a query
+// parameter, e.g. "X-Api-Key: <key>", instead of a signature like APIKey.
+type CustomKey struct {
+	// Header is the name of the header of the key, e.g. "X-Api-Key".
+	Header string `yaml:"header"`
+
+	// QueryParam is the name of the query parameter of the key, e.g. "api_key".
+	QueryParam string `yaml:"queryParam"`
+
+	// Value is the key.
+	Value string `yaml:"value"`
+}
+
+func (customKey *CustomKey) validate() error {
+	if customKey == nil {
+		return nil
+	}
+
+	if customKey.Header == "" && customKey.QueryParam == "" {
+		return InvalidAuthenticationError("customKey requires a header or queryParam")
+	}
+
+	if customKey.Value == "" {
+		return InvalidAuthenticationError("customKey requires a value")
+	}
+
+	return nil
+}
+
+// Session is the authentication data for a web API whose requests are authorized by the cookies of a session. The
+// login request is sent before the first request of every web client, and the cookies of its response are sent with
+// the requests of the run.
+type Session struct {
+	// LoginURL is the URL of the login request, which can be relative to the URL of the configuration.
+	LoginURL string `yaml:"loginUrl"`
+
+	// Method is the method of the login request, the default is POST.
+	Method string `yaml:"method"`
+
+	// Form is the form of the login request, which is sent URL encoded, e.g. the username and password.
+	Form map[string]string `yaml:"form"`
+
+	// Body is the body of the login request, if it has no form, e.g. a JSON object with the credentials.
+	Body string `yaml:"body"`
+
+	// ContentType is the content type of the body, the default is "application/json".
+	ContentType string `yaml:"contentType"`
+
+	// Headers are the headers of the login request.
+	Headers map[string]string `yaml:"headers"`
+}
+
+func (session *Session) validate() error {
+	if session == nil {
+		return nil
+	}
+
+	if session.LoginURL == "" {
+		return InvalidAuthenticationError("session requires a loginUrl")
+	}
+
+	if len(session.Form) > 0 && session.Body != "" {
+		return InvalidAuthenticationError("session can not have both a form and a body")
+	}
+
+	return nil
+}
+
+// login will return the body and content type of the login request.
+func (session *Session) login() ([]byte, string) {
+	if len(session.Form) > 0 {
+		form := make(url.Values, len(session.Form))
+		for name, value := range session.Form {
+			form.Set(name, value)
+		}
+
+		return []byte(form.Encode()), "application/x-www-form-urlencoded"
+	}
+
+	if session.Body == "" {
+		return nil, session.ContentType
+	}
+
+	contentType := session.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	return []byte(session.Body), contentType
+}
+
+// header will return the headers of the login request.
+func (session *Session) header() http.Header {
+	header := make(http.Header, len(session.Headers))
+	for name, value := range session.Headers {
+		header.Set(name, value)
+	}
+
+	return header
+}
+
+// withStrings will return a copy of the session with its form, body, and headers replaced by the function, e.g. to
+// expand their references to environment variables.
+func (session *Session) withStrings(fn func(string) (string, error)) (*Session, error) {
+	if session == nil {
+		return nil, nil
+	}
+
+	replaced := *session
+
+	var err error
+	if replaced.Body, err = fn(session.Body); err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+
+	for _, values := range []*map[string]string{&replaced.Form, &replaced.Headers} {
+		original := *values
+		if original == nil {
+			continue
+		}
+
+		*values = make(map[string]string, len(original))
+
+		for name, value := range original {
+			if (*values)[name], err = fn(value); err != nil {
+				return nil, fmt.Errorf("%q: %w", name, err)
+			}
+		}
+	}
+
+	return &replaced, nil
+}
+
+// RegisteredAuth is the authentication data for a web API whose requests are authorized by a transport that is
+// registered with the Register function of the auth package, e.g. for a signature scheme that gidari does not
+// implement.
+type RegisteredAuth struct {
+	// Name is the name that the transport is registered with.
+	Name string `yaml:"name"`
+
+	// Params are passed to the factory of the transport, e.g. its credentials. The string params can reference
+	// environment variables and secrets like the other credentials.
+	Params map[string]interface{} `yaml:"params"`
+}
+
+func (registered *RegisteredAuth) validate() error {
+	if registered == nil {
+		return nil
+	}
+
+	if registered.Name == "" {
+		return InvalidAuthenticationError("registered requires a name")
+	}
+
+	if !auth.Registered(registered.Name) {
+		return InvalidAuthenticationError(auth.UnregisteredTransportError(registered.Name).Error())
+	}
+
+	return nil
+}
+
+// params will return the params of the transport, with the maps of the YAML converted to be keyed by strings.
+func (registered *RegisteredAuth) params() map[string]interface{} {
+	params := make(map[string]interface{}, len(registered.Params))
+	for name, value := range registered.Params {
+		params[name] = jsonValue(value)
+	}
+
+	return params
+}
+
+// withStrings will return a copy of the registered authentication with its string params replaced by the function,
+// e.g. to expand their references to environment variables.
+func (registered *RegisteredAuth) withStrings(fn func(string) (string, error)) (*RegisteredAuth, error) {
+	if registered == nil {
+		return nil, nil
+	}
+
+	replaced := *registered
+	replaced.Params = make(map[string]interface{}, len(registered.Params))
+
+	for name, value := range registered.Params {
+		if str, ok := value.(string); ok {
+			var err error
+			if value, err = fn(str); err != nil {
+				return nil, fmt.Errorf("param %q: %w", name, err)
+			}
+		}
+
+		replaced.Params[name] = value
+	}
+
+	return &replaced, nil
 }
 
 // Authentication is the credential information to be used to construct an HTTP(s) transport for accessing the API.
 type Authentication struct {
 	APIKey *APIKey `yaml:"apiKey"`
 	Auth2  *Auth2  `yaml:"auth2"`
+	OAuth1 *OAuth1 `yaml:"oauth1"`
+	SigV4  *SigV4  `yaml:"sigV4"`
+	JWT    *JWT    `yaml:"jwt"`
+	Basic  *Basic  `yaml:"basic"`
+
+	CustomKey *CustomKey `yaml:"customKey"`
+
+	// Session authorizes the requests with the cookies of a session, which is started with a login request.
+	Session *Session `yaml:"session"`
+
+	// Registered authorizes the requests with a transport that is registered by a library user.
+	Registered *RegisteredAuth `yaml:"registered"`
+
+	// Vault resolves the credentials from a secret in HashiCorp Vault when the web clients are created.
+	Vault *Vault `yaml:"vault"`
 }
 
 // timeseries is a struct that contains the information needed to query a web API for timeseries data.
@@ -100,6 +595,32 @@ type timeseries struct {
 	// to be RFC3339.
 	Layout *string `yaml:"layout"`
 
+	// GranularityName is the name of the query parameter that holds the granularity of the data, e.g. the width
+	// of a candle. The value can be an integer number of seconds or a duration string like "5m". Together with
+	// "MaxRecords", this is used to compute the period when "Period" is not set.
+	GranularityName string `yaml:"granularityName"`
+
+	// MaxRecords is the maximum number of records the web API will return for a single request.
+	MaxRecords int32 `yaml:"maxRecords"`
+
+	// Granularities will expand the request into a separate set of chunked requests for each granularity, setting
+	// the "GranularityName" query parameter to the granularity. Each granularity is stored in its own table, the
+	// table name can reference the granularity with the "{{ .Granularity }}" template, e.g.
+	// "candles_{{ .Granularity }}". If the table name has no template, the granularity is appended to it.
+	Granularities []string `yaml:"granularities"`
+
+	// Concurrency is the maximum number of chunks of the request that are fetched at the same time, e.g. for web
+	// APIs that forbid parallel historical queries per key. This is independent of the number of workers, and the
+	// default is no limit.
+	Concurrency int `yaml:"concurrency"`
+
+	// Downsample upserts the aggregates of the candles of the timeseries at coarser granularities into companion
+	// tables.
+	Downsample *Downsample `yaml:"downsample"`
+
+	// Bisect splits the chunks that time out into smaller ranges, instead of failing the request.
+	Bisect *Bisect `yaml:"bisect"`
+
 	// chunks are the time ranges for which we can query the API. These are broken up into pieces for API requests
 	// that only return a limited number of results.
 	chunks [][2]time.Time
@@ -136,8 +657,13 @@ func (ts *timeseries) chunk(rurl url.URL) error {
 		return UnableToParseError("endTime")
 	}
 
+	period, err := ts.period(query)
+	if err != nil {
+		return err
+	}
+
 	for start.Before(end) {
-		next := start.Add(time.Second * time.Duration(ts.Period))
+		next := start.Add(period)
 		if next.Before(end) {
 			ts.chunks = append(ts.chunks, [2]time.Time{start, next})
 		} else {
@@ -150,6 +676,49 @@ func (ts *timeseries) chunk(rurl url.URL) error {
 	return nil
 }
 
+// period will return the size of each chunk. If the "Period" is not set, then the period is the largest range that
+// the web API can serve in a single request, given the granularity on the query and the "MaxRecords". Since most
+// web APIs treat both ends of the range as inclusive, the range is reduced by one granularity.
+func (ts *timeseries) period(query url.Values) (time.Duration, error) {
+	if ts.Period > 0 {
+		return time.Second * time.Duration(ts.Period), nil
+	}
+
+	if ts.GranularityName == "" || ts.MaxRecords <= 0 {
+		return 0, MissingTimeseriesFieldError("period")
+	}
+
+	granularitySlice := query[ts.GranularityName]
+	if len(granularitySlice) != 1 {
+		return 0, MissingTimeseriesFieldError("granularityName")
+	}
+
+	granularity, err := parseGranularity(granularitySlice[0])
+	if err != nil {
+		return 0, err
+	}
+
+	if ts.MaxRecords == 1 {
+		return granularity, nil
+	}
+
+	return granularity * time.Duration(ts.MaxRecords-1), nil
+}
+
+// parseGranularity will parse a granularity as an integer number of seconds or as a duration string.
+func parseGranularity(val string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(val, 10, 64); err == nil && seconds > 0 {
+		return time.Second * time.Duration(seconds), nil
+	}
+
+	granularity, err := time.ParseDuration(val)
+	if err != nil || granularity <= 0 {
+		return 0, UnableToParseError("granularity")
+	}
+
+	return granularity, nil
+}
+
 // RateLimitConfig is the data needed for constructing a rate limit for the HTTP requests.
 type RateLimitConfig struct {
 	// Burst represents the number of requests that we limit over a period frequency.
@@ -157,6 +726,16 @@ type RateLimitConfig struct {
 
 	// Period is the number of times to allow a burst per second.
 	Period *time.Duration `yaml:"period"`
+
+	// PerRun will construct a new rate limiter for every transport operation instead of sharing a single limiter
+	// between all operations made with the configuration. This is useful when the same configuration is used to
+	// run overlapping operations that are rate limited independently by the web API, e.g. for different tenants.
+	PerRun bool `yaml:"perRun"`
+}
+
+// newLimiter will return a new rate limiter for the rate limit configuration.
+func (rl RateLimitConfig) newLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Every(*rl.Period), *rl.Burst)
 }
 
 func (rl RateLimitConfig) validate() error {
@@ -179,90 +758,419 @@ type Config struct {
 	ConnectionStrings []string         `yaml:"connectionStrings"`
 	Requests          []*Request       `yaml:"requests"`
 	RateLimitConfig   *RateLimitConfig `yaml:"rateLimit"`
+	DeadLetter        *DeadLetter      `yaml:"deadLetter"`
+	CostCeiling       *CostCeiling     `yaml:"costCeiling"`
+	TableNaming       TableNaming      `yaml:"tableNaming"`
+	Snapshot          *Snapshot        `yaml:"snapshot"`
 	Logger            *logrus.Logger
 	Truncate          bool
 
-	URL *url.URL `yaml:"-"`
-}
+	// TruncateCascade will also truncate the tables that reference the truncated tables with foreign keys. By default,
+	// tables referenced by tables that are not truncated are deleted in the order of their dependencies instead.
+	TruncateCascade bool `yaml:"truncateCascade"`
 
-// New config takes a YAML byte slice and returns a new transport configuration for upserting data to storage.
-//
-// For web requests defined on the transport configuration, the default HTTP Request Method is "GET". Furthermore,
-// if rate limit data has not been defined for a request it will inherit the rate limit data from the transport config.
-func NewConfig(yamlBytes []byte) (*Config, error) {
-	var cfg Config
+	// RateLimitGroups are the rate limits of groups of requests that share an upstream quota. Requests in a group
+	// share a limiter that is independent of the limiters of other groups and of the requests without a group.
+	RateLimitGroups map[string]*RateLimitConfig `yaml:"rateLimitGroups"`
 
-	cfg.Logger = logrus.New()
+	// Schemas are the definitions of tables, keyed by the table name. Records upserted into a table with a schema are
+	// validated against it.
+	Schemas map[string]*Schema `yaml:"schemas"`
 
-	if err := yaml.Unmarshal(yamlBytes, &cfg); err != nil {
-		return nil, fmt.Errorf("unable to unmarshal YAML: %w", err)
-	}
+	// QuietHours are the recurring time windows during which requests are paused or made at a reduced rate.
+	QuietHours []*QuietWindow `yaml:"quietHours"`
 
-	if err := cfg.validate(); err != nil {
-		return nil, err
-	}
+	// Maintenance pauses requests during the maintenance windows of the web API and backs off on 503 responses.
+	Maintenance *Maintenance `yaml:"maintenance"`
 
-	// Parse the raw URL
-	var err error
+	// Routes restrict the tables that are written to each storage. A storage without routes receives every table.
+	Routes []*Route `yaml:"routes"`
 
-	cfg.URL, err = url.Parse(cfg.RawURL)
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse URL: %w", err)
-	}
+	// StateEncryption encrypts the snapshot and dead letter files at rest with a user-supplied key.
+	StateEncryption *StateEncryption `yaml:"stateEncryption"`
 
-	// create a rate limiter to pass to all "flattenedRequest". This has to be defined outside of the scope of
-	// individual "flattenedRequest"s so that they all share the same rate limiter, even concurrent requests to
-	// different endpoints could cause a rate limit error on a web API.
-	rateLimiter := rate.NewLimiter(rate.Every(*cfg.RateLimitConfig.Period), *cfg.RateLimitConfig.Burst)
+	// Retry is the policy for making failed web requests again, instead of failing the operation. Requests with a retry
+	// policy of their own use it instead. The default is to not retry requests.
+	Retry *Retry `yaml:"retry"`
 
-	// Update default request data.
-	for _, req := range cfg.Requests {
-		if req.Method == "" {
-			req.Method = http.MethodGet
-		}
+	// Only are the selectors of the requests to run, e.g. "tags=prices" or "table=candles,trades". A request is run if
+	// it matches every selector, and it matches a selector if it has one of its comma separated values. If there are
+	// no selectors, every request is run.
+	Only []string `yaml:"only"`
 
-		if req.Table == "" {
-			endpointParts := strings.Split(req.Endpoint, "/")
-			req.Table = endpointParts[len(endpointParts)-1]
-		}
+	// Lineage stamps every upserted record with the ID of the run that wrote it, so that a run can be purged.
+	Lineage *Lineage `yaml:"lineage"`
 
-		req.rateLimiter = rateLimiter
-	}
+	// Audit logs every upsert that overwrites an existing record with different values into an audit table.
+	Audit *Audit `yaml:"audit"`
+
+	// RunStats persists the number of records of every table of a run, so that runs can be compared with "Compare".
+	RunStats *RunStats `yaml:"runStats"`
+
+	// Checkpoints stores the snapshot and the cache on a durable store instead of the local filesystem.
+	Checkpoints *Checkpoints `yaml:"checkpoints"`
+
+	// TransactionTimeout is the maximum duration of each storage operation in the transactions of an upsert
+	// operation, e.g. an upsert or a scoped delete. Operations that exceed the timeout are canceled and fail the
+	// transaction. The default is no timeout, operations are only canceled with the context of the operation.
+	TransactionTimeout time.Duration `yaml:"transactionTimeout"`
+
+	// ErrorMode is how an upsert operation handles the requests that fail, either stopping at the first failure or
+	// making every request and returning the errors of all the requests that fail. The default is "first".
+	ErrorMode ErrorMode `yaml:"errorMode"`
+
+	// Compression gzips the large request bodies and negotiates compressed responses. The default is to send the
+	// request bodies as they are.
+	Compression *Compression `yaml:"compression"`
+
+	// DisableDecompression requests the responses without an encoding and reads them as they are, for web APIs that
+	// mis-report the encoding of their responses. By default, the responses are requested compressed and decoded.
+	DisableDecompression bool `yaml:"disableDecompression"`
+
+	// WebWorkers is the number of requests that are made at the same time, and StorageWorkers is the number of
+	// responses that are sent to the repositories at the same time. The default of both is the number of CPUs.
+	WebWorkers     int `yaml:"webWorkers"`
+	StorageWorkers int `yaml:"storageWorkers"`
+
+	// DecodeWorkers is the number of response bodies that are decoded at the same time, on workers of their own so
+	// that decoding large bodies does not hold the web workers. The default is the number of CPUs.
+	DecodeWorkers int `yaml:"decodeWorkers"`
+
+	// Autoscale adjusts the number of web workers while the operation runs, based on the latency of the requests, the
+	// time they wait on the rate limiter, and the depth of the repository queue.
+	Autoscale *Autoscale `yaml:"autoscale"`
+
+	// Universes are the named lists of instruments of the web API, e.g. the products of an exchange, that requests
+	// iterate over with a foreach of the universe.
+	Universes map[string]*Universe `yaml:"universes"`
+
+	// Archive stores the raw body of every response that is upserted, so that the responses can be replayed.
+	Archive *Archive `yaml:"archive"`
+
+	// Cache sends conditional requests with the validators of the previous responses, and skips the requests whose
+	// responses are not modified.
+	Cache *Cache `yaml:"cache"`
+
+	// Lock prevents two processes from running the configuration at the same time.
+	Lock *RunLock `yaml:"lock"`
+
+	// LogLevels are the log levels of the subsystems of the logs, i.e. "web", "repository", "planner", and "auth",
+	// e.g. "warn" for the web requests of a large backfill. Subsystems without a level log at the level of Logger.
+	LogLevels map[string]string `yaml:"logLevels"`
+
+	// TLS is the TLS configuration of the requests, e.g. a client certificate for mutual TLS or a private CA.
+	TLS *TLS `yaml:"tls"`
+
+	// Offload routes the records that exceed a size to an object store, upserting pointer records in their place.
+	Offload *Offload `yaml:"offload"`
+
+	// Proxy is the proxy that the requests are sent through. The default is the proxy of the environment variables.
+	Proxy *Proxy `yaml:"proxy"`
+
+	// Headers are the headers of every request, e.g. a tenant ID. The headers of a request take precedence over them.
+	Headers map[string]string `yaml:"headers"`
+
+	// Progress is called with the progress events of an upsert operation, e.g. to report the progress of each
+	// request. Events are sent one at a time.
+	Progress func(*ProgressEvent) `yaml:"-"`
+
+	URL *url.URL `yaml:"-"`
+
+	// conn are the connection pools shared by all operations made with the configuration.
+	conn *connection
+
+	// rateLimiters are the rate limiters shared by the requests of the configuration, keyed by the rate limit group.
+	// The limiter for requests without a group is keyed by the empty string.
+	rateLimiters map[string]*rate.Limiter
+}
+
+// connection caches the base round trippers of a configuration, so that the operations made with the configuration
+// reuse the same connection pools instead of dialing the web API again for every run. The web clients, along with the
+// state of their authentication, are created for every operation.
+type connection struct {
+	mutex sync.Mutex
+
+	// transports are the base round trippers keyed by the egress route, the round tripper of requests without an
+	// egress is keyed by the empty string.
+	transports map[string]http.RoundTripper
+}
+
+// New config takes a YAML byte slice and returns a new transport configuration for upserting data to storage.
+//
+// For web requests defined on the transport configuration, the default HTTP Request Method is "GET". Furthermore,
+// if rate limit data has not been defined for a request it will inherit the rate limit data from the transport config.
+func NewConfig(yamlBytes []byte) (*Config, error) {
+	return newConfig(yamlBytes, func(yamlBytes []byte, cfg *Config) error {
+		return yaml.Unmarshal(yamlBytes, cfg)
+	})
+}
+
+// NewStrictConfig is like NewConfig, but returns an error wrapping ErrUnknownConfigKey if the YAML has keys that are
+// not settings, e.g. a misspelled "ratelimit" instead of "rateLimit", which NewConfig ignores.
+func NewStrictConfig(yamlBytes []byte) (*Config, error) {
+	return newConfig(yamlBytes, unmarshalStrict)
+}
+
+// newConfig will return the configuration of the YAML, decoded with the unmarshal function.
+func newConfig(yamlBytes []byte, unmarshal func([]byte, *Config) error) (*Config, error) {
+	var cfg Config
+
+	cfg.Logger = logrus.New()
+
+	if err := unmarshal(yamlBytes, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal YAML: %w", err)
+	}
+
+	if err := cfg.expandUniverses(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Authentication.expandEnv(); err != nil {
+		return nil, err
+	}
+
+	// Parse the raw URL
+	var err error
+
+	cfg.URL, err = url.Parse(cfg.RawURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse URL: %w", err)
+	}
+
+	// create a rate limiter to pass to all "flattenedRequest". This has to be defined outside of the scope of
+	// individual "flattenedRequest"s so that they all share the same rate limiter, even concurrent requests to
+	// different endpoints could cause a rate limit error on a web API. Requests in a rate limit group share the
+	// limiter of the group instead.
+	cfg.rateLimiters = cfg.newLimiters()
+
+	// Update default request data.
+	for _, req := range cfg.Requests {
+		if req.Method == "" && req.hasBody() {
+			req.Method = http.MethodPost
+		}
+
+		if req.Method == "" {
+			req.Method = http.MethodGet
+		}
+
+		if req.Table == "" {
+			req.Table = cfg.TableNaming.tableName(req.Endpoint)
+		}
+
+		req.Headers = mergeHeaders(cfg.Headers, req.Headers)
+		req.rateLimiter = cfg.rateLimiters[req.limiterKey()]
+	}
+
+	cfg.conn = new(connection)
 
 	return &cfg, nil
 }
 
-// connect will attempt to connect to the web API client. Since there are multiple ways to build a transport given the
-// authentication data, this method will exhaust every transport option in the "Authentication" struct.
-func (cfg *Config) connect(ctx context.Context) (*web.Client, error) {
-	if apiKey := cfg.Authentication.APIKey; apiKey != nil {
+// newClient will attempt to create a web API client. Since there are multiple ways to build a transport given the
+// authentication data, this method will exhaust every transport option in the "Authentication" struct. The base
+// round tripper sends the authenticated requests, if it is nil then http.DefaultTransport is used.
+func (cfg *Config) newClient(ctx context.Context, base http.RoundTripper) (*web.Client, error) {
+	logger := cfg.logger(logAuth)
+
+	authentication, err := cfg.Authentication.resolve(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey := authentication.APIKey; apiKey != nil {
+		clock, err := apiKey.ClockSync.newClock(ctx, *cfg.URL, base)
+		if err != nil {
+			return nil, err
+		}
+
 		client, err := web.NewClient(ctx, auth.NewAPIKey().
 			SetURL(cfg.RawURL).
 			SetKey(apiKey.Key).
 			SetPassphrase(apiKey.Passphrase).
-			SetSecret(apiKey.Secret))
+			SetSecret(apiKey.Secret).
+			SetClock(clock).
+			SetBase(base))
+		if err != nil {
+			return nil, WrapWebError(web.FailedToCreateClientError(err))
+		}
+
+		tools.LogEvent{Msg: "created web client with API key authentication"}.Log(logger, logrus.DebugLevel)
+
+		return client, nil
+	}
+
+	if auth2 := authentication.Auth2; auth2 != nil {
+		client, err := web.NewClient(ctx, auth.NewAuth2().
+			SetBearer(auth2.Bearer).
+			SetClientCredentials(auth2.TokenURL, auth2.ClientID, auth2.ClientSecret, auth2.Scopes).
+			SetURL(cfg.RawURL).
+			SetBase(base))
+		if err != nil {
+			return nil, WrapWebError(web.FailedToCreateClientError(err))
+		}
+
+		tools.LogEvent{Msg: "created web client with bearer authentication"}.Log(logger, logrus.DebugLevel)
+
+		return client, nil
+	}
+
+	if oauth1 := authentication.OAuth1; oauth1 != nil {
+		clock, err := oauth1.ClockSync.newClock(ctx, *cfg.URL, base)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := web.NewClient(ctx, auth.NewAuth1().
+			SetConsumerKey(oauth1.ConsumerKey).
+			SetConsumerSecret(oauth1.ConsumerSecret).
+			SetAccessToken(oauth1.Token).
+			SetAccessTokenSecret(oauth1.TokenSecret).
+			SetSignatureMethod(oauth1.SignatureMethod).
+			SetClock(clock).
+			SetURL(cfg.RawURL).
+			SetBase(base))
+		if err != nil {
+			return nil, WrapWebError(web.FailedToCreateClientError(err))
+		}
+
+		tools.LogEvent{Msg: "created web client with OAuth1 authentication"}.Log(logger, logrus.DebugLevel)
+
+		return client, nil
+	}
+
+	if sigv4 := authentication.SigV4; sigv4 != nil {
+		region := sigv4.region()
+		if region == "" {
+			return nil, InvalidAuthenticationError("sigV4 has no region and AWS_REGION is not set")
+		}
+
+		// The signature includes a hash of the body, so the requests are compressed before they are signed. The
+		// compression of the base round tripper leaves the compressed bodies as they are.
+		client, err := web.NewClient(ctx, cfg.Compression.wrap(auth.NewSigV4().
+			SetRegion(region).
+			SetService(sigv4.Service).
+			SetCredentials(sigv4.credentials()).
+			SetURL(cfg.RawURL).
+			SetBase(base), cfg.DisableDecompression))
+		if err != nil {
+			return nil, WrapWebError(web.FailedToCreateClientError(err))
+		}
+
+		tools.LogEvent{Msg: "created web client with SigV4 authentication"}.Log(logger, logrus.DebugLevel)
+
+		return client, nil
+	}
+
+	if jwt := authentication.JWT; jwt != nil {
+		key, err := jwt.key()
+		if err != nil {
+			return nil, err
+		}
+
+		clock, err := jwt.ClockSync.newClock(ctx, *cfg.URL, base)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := web.NewClient(ctx, auth.NewJWT().
+			SetKey(key).
+			SetAlgorithm(jwt.Algorithm).
+			SetKeyID(jwt.KeyID).
+			SetClaims(jwt.claims()).
+			SetTTL(jwt.TTL).
+			SetClock(clock).
+			SetURL(cfg.RawURL).
+			SetBase(base))
+		if err != nil {
+			return nil, WrapWebError(web.FailedToCreateClientError(err))
+		}
+
+		tools.LogEvent{Msg: "created web client with JWT authentication"}.Log(logger, logrus.DebugLevel)
+
+		return client, nil
+	}
+
+	if basic := authentication.Basic; basic != nil {
+		client, err := web.NewClient(ctx, auth.NewBasic().
+			SetEmail(basic.Username).
+			SetPassword(basic.Password).
+			SetURL(cfg.RawURL).
+			SetBase(base))
+		if err != nil {
+			return nil, WrapWebError(web.FailedToCreateClientError(err))
+		}
+
+		tools.LogEvent{Msg: "created web client with basic authentication"}.Log(logger, logrus.DebugLevel)
+
+		return client, nil
+	}
+
+	if customKey := authentication.CustomKey; customKey != nil {
+		client, err := web.NewClient(ctx, auth.NewCustomKey().
+			SetHeader(customKey.Header).
+			SetQueryParam(customKey.QueryParam).
+			SetValue(customKey.Value).
+			SetURL(cfg.RawURL).
+			SetBase(base))
+		if err != nil {
+			return nil, WrapWebError(web.FailedToCreateClientError(err))
+		}
+
+		tools.LogEvent{Msg: "created web client with custom key authentication"}.Log(logger, logrus.DebugLevel)
+
+		return client, nil
+	}
+
+	if session := authentication.Session; session != nil {
+		body, contentType := session.login()
+
+		client, err := web.NewClient(ctx, auth.NewSession().
+			SetLogin(session.Method, session.LoginURL, body, contentType).
+			SetHeader(session.header()).
+			SetURL(cfg.RawURL).
+			SetBase(base))
 		if err != nil {
 			return nil, WrapWebError(web.FailedToCreateClientError(err))
 		}
 
+		tools.LogEvent{Msg: "created web client with session authentication"}.Log(logger, logrus.DebugLevel)
+
 		return client, nil
 	}
 
-	if apiKey := cfg.Authentication.Auth2; apiKey != nil {
-		client, err := web.NewClient(ctx, auth.NewAuth2().SetBearer(apiKey.Bearer).SetURL(cfg.RawURL))
+	if registered := authentication.Registered; registered != nil {
+		transport, err := auth.NewRegistered(ctx, registered.Name, auth.Config{
+			URL:    cfg.RawURL,
+			Params: registered.params(),
+			Base:   base,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create registered transport: %w", err)
+		}
+
+		client, err := web.NewClient(ctx, transport)
 		if err != nil {
 			return nil, WrapWebError(web.FailedToCreateClientError(err))
 		}
 
+		logDebug := tools.LogEvent{Msg: "created web client with registered authentication", Name: registered.Name}
+		logDebug.Log(logger, logrus.DebugLevel)
+
 		return client, nil
 	}
 
 	// In the case of no authentication, create a client without an auth transport.
-	client, err := web.NewClient(ctx, nil)
+	client, err := web.NewClient(ctx, base)
 	if err != nil {
 		return nil, WrapWebError(web.FailedToCreateClientError(err))
 	}
 
+	tools.LogEvent{Msg: "created web client without authentication"}.Log(logger, logrus.DebugLevel)
+
 	return client, nil
 }
 
@@ -271,200 +1179,1327 @@ type repoCloser func()
 // repos will return a slice of generic repositories along with associated transaction instances.
 func (cfg *Config) repos(ctx context.Context) ([]repository.Generic, repoCloser, error) {
 	repos := []repository.Generic{}
+	logger := cfg.logger(logRepository)
 
 	for _, dns := range cfg.ConnectionStrings {
-		repo, err := repository.NewTx(ctx, dns)
+		resolved, err := resolveSecret(ctx, dns)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to resolve connection string: %w", err)
+		}
+
+		repo, err := repository.NewTx(ctx, resolved)
 		if err != nil {
 			return nil, nil, WrapRepositoryError(repository.FailedToCreateRepositoryError(err))
 		}
 
-		logInfo := tools.LogFormatter{
-			Msg: fmt.Sprintf("created repository for %q", dns),
+		logInfo := tools.LogEvent{
+			Msg:     "created repository",
+			Storage: dns,
 		}
-		cfg.Logger.Info(logInfo.String())
+		logInfo.Log(logger, logrus.InfoLevel)
 
 		repos = append(repos, repo)
 	}
 
-	return repos, func() {
-		for _, repo := range repos {
-			repo.Close()
+	return repos, func() {
+		for _, repo := range repos {
+			repo.Close()
+
+			logInfo := tools.LogEvent{
+				Msg:     "closed repository",
+				Storage: storage.Scheme(repo.Type()),
+			}
+			logInfo.Log(logger, logrus.InfoLevel)
+		}
+	}, nil
+}
+
+// validate will ensure that the configuration is valid for querying the web API.
+func (cfg *Config) validate() error {
+	if cfg.RateLimitConfig == nil {
+		return MissingConfigFieldError("rateLimit")
+	}
+
+	if err := cfg.RateLimitConfig.validate(); err != nil {
+		return ErrInvalidRateLimit
+	}
+
+	for name, group := range cfg.RateLimitGroups {
+		if group == nil || group.validate() != nil {
+			return fmt.Errorf("%w: rate limit group %q", ErrInvalidRateLimit, name)
+		}
+	}
+
+	if err := cfg.TableNaming.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.ErrorMode.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Compression.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Archive.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Cache.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Lock.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.Auth2.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.OAuth1.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.SigV4.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.JWT.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.Basic.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.CustomKey.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.Session.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.Registered.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Authentication.Vault.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Autoscale.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Audit.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.RunStats.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Checkpoints.validate(); err != nil {
+		return err
+	}
+
+	if err := validateLogLevels(cfg.LogLevels); err != nil {
+		return err
+	}
+
+	if err := cfg.Proxy.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.Offload.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.TLS.validate(); err != nil {
+		return err
+	}
+
+	if _, err := newUpsertOptions(cfg, nil); err != nil {
+		return err
+	}
+
+	for table, schema := range cfg.Schemas {
+		if err := schema.validate(table); err != nil {
+			return err
+		}
+	}
+
+	for _, route := range cfg.Routes {
+		if err := route.validate(cfg.ConnectionStrings); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.Retry.validate(); err != nil {
+		return err
+	}
+
+	if _, err := cfg.StateEncryption.cipher(); err != nil {
+		return err
+	}
+
+	for _, str := range cfg.Only {
+		if _, err := parseSelector(str); err != nil {
+			return err
+		}
+	}
+
+	for _, req := range cfg.Requests {
+		if err := req.validateRateLimit(); err != nil {
+			return err
+		}
+
+		if err := req.Pagination.validate(req.Envelope); err != nil {
+			return err
+		}
+
+		if err := req.Retry.validate(); err != nil {
+			return err
+		}
+
+		if err := req.Limits.validate(); err != nil {
+			return err
+		}
+
+		if err := req.Cache.validate(); err != nil {
+			return err
+		}
+
+		if req.Timeseries != nil {
+			if err := req.Timeseries.Downsample.validate(); err != nil {
+				return err
+			}
+
+			if err := req.Timeseries.Bisect.validate(req); err != nil {
+				return err
+			}
+		}
+
+		if err := req.Foreach.validate(cfg.Requests, cfg.TableNaming); err != nil {
+			return err
+		}
+
+		if err := req.validateProjection(); err != nil {
+			return err
+		}
+
+		if err := req.validateBody(); err != nil {
+			return err
+		}
+
+		for _, norm := range req.Normalize {
+			if err := norm.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, window := range cfg.QuietHours {
+		if _, err := window.load(); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.Maintenance.validate(); err != nil {
+		return err
+	}
+
+	if cfg.ConnectionStrings == nil {
+		logWarn := tools.LogEvent{
+			Msg: "no connectionStrings specified in the config file",
+		}
+		logWarn.Log(cfg.Logger, logrus.WarnLevel)
+	}
+
+	return nil
+}
+
+// expandRequests will expand the configuration requests into the requests that should be flattened.
+func (cfg *Config) expandRequests() ([]*Request, error) {
+	selected, err := cfg.selectRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []*Request
+
+	for _, req := range selected {
+		expanded, err := req.expandGranularities()
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, expanded...)
+	}
+
+	return requests, nil
+}
+
+// newLimiters will create the rate limiters for the requests of the configuration, keyed by the rate limit group.
+// Groups that are referenced by a request but have no rate limit of their own get an independent limiter with the
+// rate limit of the configuration. Requests with a rate limit of their own get a limiter keyed by their endpoint.
+func (cfg *Config) newLimiters() map[string]*rate.Limiter {
+	limiters := map[string]*rate.Limiter{"": cfg.RateLimitConfig.newLimiter()}
+
+	for name, group := range cfg.RateLimitGroups {
+		limiters[name] = group.newLimiter()
+	}
+
+	for _, req := range cfg.Requests {
+		key := req.limiterKey()
+		if _, ok := limiters[key]; ok {
+			continue
+		}
+
+		if req.RateLimit != nil {
+			limiters[key] = req.RateLimit.newLimiter()
+		} else {
+			limiters[key] = cfg.RateLimitConfig.newLimiter()
+		}
+	}
+
+	return limiters
+}
+
+// runLimiters will return the rate limiters for a run. If the rate limiter is scoped to the run, then new limiters are
+// created for every run.
+func (cfg *Config) runLimiters() map[string]*rate.Limiter {
+	if cfg.RateLimitConfig != nil && cfg.RateLimitConfig.PerRun {
+		return cfg.newLimiters()
+	}
+
+	return cfg.rateLimiters
+}
+
+// flattenRequests will flatten the requests into a single slice for HTTP requests. The requests of every call use new
+// web clients, which share the connection pools of the configuration.
+func (cfg *Config) flattenRequests(ctx context.Context) ([]*flattenedRequest, error) {
+	limiters := cfg.runLimiters()
+	clients := cfg.newRunClients()
+
+	store, err := cfg.checkpointStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if resumable, err := cfg.Snapshot.resumable(ctx, store); err != nil {
+		return nil, err
+	} else if resumable {
+		return cfg.Snapshot.load(ctx, cfg, store, clients, limiters)
+	}
+
+	return cfg.flatten(ctx, clients, limiters)
+}
+
+// planRequests will flatten the requests like flattenRequests for a run from the start, without making any web
+// requests or reading the checkpoints: the web clients are not authenticated and the snapshot is not resumed.
+func (cfg *Config) planRequests(ctx context.Context) ([]*flattenedRequest, error) {
+	return cfg.flatten(ctx, cfg.newPlanClients(), cfg.runLimiters())
+}
+
+// flatten will flatten the requests of the configuration with the web clients and the rate limiters of a run.
+func (cfg *Config) flatten(ctx context.Context, clients *runClients,
+	limiters map[string]*rate.Limiter,
+) ([]*flattenedRequest, error) {
+	var flattenedRequests []*flattenedRequest
+
+	requests, err := cfg.expandRequests()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, req := range requests {
+		client, err := clients.client(ctx, req.Egress)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to web API: %w", err)
+		}
+
+		if req.Foreach != nil {
+			flattenedRequests = append(flattenedRequests, req.flattenForeach(*cfg.URL, client, limiters[req.limiterKey()]))
+
+			continue
+		}
+
+		flatReqs, err := req.flattenTimeseries(*cfg.URL, client)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, flatReq := range flatReqs {
+			flatReq.fetchConfig.RateLimiter = limiters[req.limiterKey()]
+		}
+
+		flattenedRequests = append(flattenedRequests, flatReqs...)
+	}
+
+	if len(flattenedRequests) == 0 {
+		return nil, ErrNoRequests
+	}
+
+	return flattenedRequests, nil
+}
+
+// writeSnapshot will write the requests that did not complete to the snapshot on the store, if a snapshot is
+// configured. The snapshot is written without the cancellation of the context, since it is written once the operation
+// is canceled.
+func (cfg *Config) writeSnapshot(ctx context.Context, store CheckpointStore, requests []*flattenedRequest,
+	completed map[*flattenedRequest]bool,
+) {
+	if cfg.Snapshot == nil || cfg.Snapshot.File == "" {
+		return
+	}
+
+	sc, err := cfg.StateEncryption.cipher()
+	if err != nil {
+		tools.LogEvent{Msg: err.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+
+		return
+	}
+
+	if err := cfg.Snapshot.write(withoutCancel(ctx), store, requests, completed, sc); err != nil {
+		tools.LogEvent{Msg: err.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+
+		return
+	}
+
+	logInfo := tools.LogEvent{
+		Msg:   "wrote snapshot of incomplete requests",
+		Count: len(requests) - len(completed),
+		File:  cfg.Snapshot.File,
+	}
+	logInfo.Log(cfg.Logger, logrus.InfoLevel)
+}
+
+// jobDone is sent when the workers are done with a flattened request.
+type jobDone struct {
+	req *flattenedRequest
+
+	// canceled is true if the request did not complete because the context was canceled.
+	canceled bool
+
+	// err is the error of the request, if it failed.
+	err error
+
+	// next are the requests of the pages that follow the request, which are made once it is done.
+	next []*flattenedRequest
+}
+
+type repoJob struct {
+	request *flattenedRequest
+
+	req   http.Request
+	b     []byte
+	table string
+	split []*Split
+
+	// deletes are executed on the repository before the data is upserted.
+	deletes []*proto.DeleteRequest
+
+	// fields are set on every record of the response before the data is upserted.
+	fields map[string]interface{}
+
+	// metadata are the response headers captured for the run.
+	metadata map[string]string
+
+	// singletonKey is the key field of a singleton response. It is empty if the response is not a singleton.
+	singletonKey string
+
+	// normalizers convert the fields of the records before the data is upserted.
+	normalizers []*Normalizer
+
+	// projection selects the fields of the records before the data is upserted.
+	projection *projection
+
+	// upserts are the upserts of the records, which are prepared by the decode workers.
+	upserts []*partitionedUpsert
+
+	// next are the requests of the pages that follow the request, which are made once the records are upserted.
+	next []*flattenedRequest
+}
+
+// newRepoJob will return the repository job of the records of a response to the request. The captured response headers
+// and the lineage fields are set on the records, and the pagination metadata of the page is added to the metadata of
+// the run.
+func newRepoJob(req *flattenedRequest, header http.Header, records []byte, page *Page,
+	lineage map[string]interface{},
+) *repoJob {
+	fields, metadata := captureHeaders(header, req.headers)
+
+	for field, value := range lineage {
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+
+		fields[field] = value
+	}
+
+	for key, value := range page.metadata() {
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+
+		metadata[key] = value
+	}
+
+	return &repoJob{
+		request:      req,
+		b:            records,
+		table:        req.table,
+		split:        req.split,
+		deletes:      req.deletes,
+		fields:       fields,
+		metadata:     metadata,
+		singletonKey: req.singletonKey,
+		normalizers:  req.normalizers,
+		projection:   req.projection,
+	}
+}
+
+// captureHeaders will capture the values of the response headers into record fields and run metadata. Headers that are
+// not on the response are ignored.
+func captureHeaders(header http.Header, headers []*ResponseHeader) (map[string]interface{}, map[string]string) {
+	var (
+		fields   map[string]interface{}
+		metadata map[string]string
+	)
+
+	for _, capture := range headers {
+		values, ok := header[http.CanonicalHeaderKey(capture.Header)]
+		if !ok || len(values) == 0 {
+			continue
+		}
+
+		if capture.Field == "" {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+
+			metadata[capture.Header] = values[0]
+
+			continue
+		}
+
+		if fields == nil {
+			fields = make(map[string]interface{})
+		}
+
+		fields[capture.Field] = values[0]
+	}
+
+	return fields, metadata
+}
+
+// newUpsertRequests will create the upsert requests for a repository job. If the job has no split, then the entire
+// body is upserted into the job's table. Otherwise, the records at each split path are upserted into the split's
+// table.
+func newUpsertRequests(job *repoJob) ([]*proto.UpsertRequest, error) {
+	if len(job.split) == 0 {
+		data, err := job.prepare(job.b, job.table)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*proto.UpsertRequest{
+			{
+				Table:    job.table,
+				Data:     data,
+				DataType: int32(tools.UpsertDataJSON),
+			},
+		}, nil
+	}
+
+	reqs := make([]*proto.UpsertRequest, 0, len(job.split))
+
+	for _, split := range job.split {
+		data, err := tools.ExtractJSONPath(job.b, split.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to split response for table %q: %w", split.Table, err)
+		}
+
+		data, err = job.prepare(data, split.Table)
+		if err != nil {
+			return nil, err
+		}
+
+		reqs = append(reqs, &proto.UpsertRequest{
+			Table:    split.Table,
+			Data:     data,
+			DataType: int32(tools.UpsertDataJSON),
+		})
+	}
+
+	return reqs, nil
+}
+
+// prepare will project and normalize the records of the table, set the response header fields on them, and key
+// singleton records.
+func (job *repoJob) prepare(data []byte, table string) ([]byte, error) {
+	data, err := project(data, table, job.projection)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = normalize(data, table, job.normalizers)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = tools.SetJSONFields(data, job.fields)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set response header fields for table %q: %w", table, err)
+	}
+
+	if job.singletonKey == "" {
+		return data, nil
+	}
+
+	return singletonRecord(data, job.singletonKey, table)
+}
+
+// UpsertResult is the aggregate result of an upsert operation.
+type UpsertResult struct {
+	// RunID is the ID of the run, which is set on every record if lineage is configured. The records of the run can
+	// be deleted with "Purge".
+	RunID string
+
+	// Tables maps each table to the sum of the upsert responses for that table, over every repository.
+	Tables map[string]*proto.UpsertResponse
+
+	// Metadata maps each table to the response headers captured as run metadata for that table. If the header is
+	// captured from several responses, the value of the most recent response is kept.
+	Metadata map[string]map[string]string
+
+	mutex sync.Mutex
+
+	// timings are the times of the stages of the pipeline, which are added to concurrently.
+	timings timingCounters
+}
+
+func newUpsertResult() *UpsertResult {
+	return &UpsertResult{
+		Tables:   make(map[string]*proto.UpsertResponse),
+		Metadata: make(map[string]map[string]string),
+	}
+}
+
+// addMetadata will add the captured response headers to the metadata of the table.
+func (result *UpsertResult) addMetadata(table string, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+
+	agg, ok := result.Metadata[table]
+	if !ok {
+		agg = make(map[string]string, len(metadata))
+		result.Metadata[table] = agg
+	}
+
+	for header, value := range metadata {
+		agg[header] = value
+	}
+}
+
+// add will add the counts on an upsert response to the aggregate for the table.
+func (result *UpsertResult) add(table string, rsp *proto.UpsertResponse) {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+
+	agg, ok := result.Tables[table]
+	if !ok {
+		agg = new(proto.UpsertResponse)
+		result.Tables[table] = agg
+	}
+
+	agg.UpsertedCount += rsp.GetUpsertedCount()
+	agg.MatchedCount += rsp.GetMatchedCount()
+	agg.Errors = append(agg.Errors, rsp.GetErrors()...)
+}
+
+// UpsertedCount is the total number of records upserted over every table.
+func (result *UpsertResult) UpsertedCount() int64 {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+
+	var count int64
+	for _, rsp := range result.Tables {
+		count += rsp.UpsertedCount
+	}
+
+	return count
+}
+
+// Timings is the time that the workers of the run spent waiting on the rate limiter, on the network, and on storage.
+// It is safe to call while the run is in progress.
+func (result *UpsertResult) Timings() Timings {
+	return result.timings.load()
+}
+
+// timingCounters will return the counters of the timings of the run, or nil if there is no result, e.g. for the web
+// requests of code generation.
+func (result *UpsertResult) timingCounters() *timingCounters {
+	if result == nil {
+		return nil
+	}
+
+	return &result.timings
+}
+
+// MatchedCount is the total number of records matched over every table.
+func (result *UpsertResult) MatchedCount() int64 {
+	result.mutex.Lock()
+	defer result.mutex.Unlock()
+
+	var count int64
+	for _, rsp := range result.Tables {
+		count += rsp.MatchedCount
+	}
+
+	return count
+}
+
+type repoConfig struct {
+	repos      []repository.Generic
+	closeRepos repoCloser
+	jobs       chan *repoJob
+	decodeJobs chan *decodeJob
+	done       chan *jobDone
+	logger     *logrus.Logger
+	result     *UpsertResult
+	deadLetter *deadLetterWriter
+	sinks      *sinkWriters
+	schemas    map[string]*Schema
+	progress   *progress
+
+	// archive writes the raw bodies of the responses to the archive, if it is configured.
+	archive *archiveWriter
+
+	// cache holds the validators of the responses for conditional requests, if it is configured.
+	cache *responseCache
+
+	// timeout is the maximum duration of each storage operation in the transactions.
+	timeout time.Duration
+
+	// routing decides which tables are written to each repository.
+	routing *routing
+
+	// partitions creates the partitions of partitioned tables when records are first written to them.
+	partitions *partitionCreator
+
+	// offload routes the oversized records to an object store, if it is configured.
+	offload *Offload
+
+	// downsamples aggregates the candles of the timeseries with downsampling.
+	downsamples *downsampler
+
+	// foreach collects the values of the foreach requests from the upserted records.
+	foreach *foreachValues
+
+	// autoscaler observes the latency of the requests, if the web workers are autoscaled.
+	autoscaler *autoscaler
+
+	// audit writes the audit records of the upserts that overwrite existing records, if the audit is configured.
+	audit *auditor
+
+	// pause pauses the web requests of the operation, if it is paused.
+	pause *Pause
+}
+
+func newRepoConfig(ctx context.Context, cfg *Config, volume int) (*repoConfig, error) {
+	runID, err := newRunID()
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := cfg.StateEncryption.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	repos, closeRepos, err := cfg.repos(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newUpsertResult()
+	result.RunID = runID
+
+	var scaler *autoscaler
+	if cfg.Autoscale != nil {
+		scaler = &autoscaler{}
+	}
+
+	return &repoConfig{
+		repos:       repos,
+		closeRepos:  closeRepos,
+		jobs:        make(chan *repoJob, volume*len(repos)),
+		decodeJobs:  make(chan *decodeJob, volume),
+		done:        make(chan *jobDone, volume),
+		logger:      cfg.logger(logRepository),
+		result:      result,
+		deadLetter:  newDeadLetterWriter(cfg.DeadLetter, cfg.logger(logRepository), sc),
+		sinks:       newSinkWriters(),
+		archive:     newArchiveWriter(cfg.Archive, sc),
+		schemas:     cfg.Schemas,
+		progress:    newProgress(cfg.Progress),
+		timeout:     cfg.TransactionTimeout,
+		routing:     cfg.routing(),
+		partitions:  newPartitionCreator(cfg.Schemas, cfg.Lineage, cfg.Offload),
+		offload:     cfg.Offload,
+		downsamples: newDownsampler(),
+		foreach:     newForeachValues(cfg.Requests),
+		autoscaler:  scaler,
+		audit:       newAuditor(cfg.Audit, runID, cfg.Lineage),
+	}, nil
+}
+
+// flush will wait until the storage operations sent to the transactions of the repositories are executed. The
+// operations of a transaction are executed in order, so an empty operation is received once the ones before it are
+// done.
+func (cfg *repoConfig) flush(ctx context.Context) {
+	for _, repo := range cfg.repos {
+		repo.TransactContext(ctx, func(context.Context, repository.Generic) error { return nil })
+	}
+}
+
+// withTimeout will return the context of a storage operation, which is canceled after the transaction timeout.
+func (cfg *repoConfig) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, cfg.timeout)
+}
+
+// uncanceledContext is a context with the values of its parent, but without its deadline and cancellation.
+type uncanceledContext struct {
+	context.Context
+}
+
+func (uncanceledContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (uncanceledContext) Done() <-chan struct{}       { return nil }
+func (uncanceledContext) Err() error                  { return nil }
+
+// withoutCancel will return a context with the values of ctx that is never canceled.
+func withoutCancel(ctx context.Context) context.Context {
+	return uncanceledContext{ctx}
+}
+
+// repositoryWorker will upsert the records of the jobs until the jobs channel is closed. Once the context is canceled,
+// the jobs are not upserted and are done as canceled.
+func repositoryWorker(ctx context.Context, workerID int, cfg *repoConfig) {
+	for job := range cfg.jobs {
+		if ctx.Err() != nil {
+			cfg.done <- &jobDone{req: job.request, canceled: true}
+
+			continue
+		}
+
+		if err := transactUpserts(ctx, workerID, cfg, job, job.upserts); err != nil {
+			cfg.done <- &jobDone{req: job.request, err: err}
+
+			continue
+		}
+
+		cfg.done <- &jobDone{req: job.request, next: job.next}
+	}
+}
+
+// prepareUpserts will build the validated and partitioned upsert requests of the job, offloading the records that
+// exceed the maximum size.
+func prepareUpserts(ctx context.Context, cfg *repoConfig, job *repoJob) ([]*partitionedUpsert, error) {
+	reqs, err := newUpsertRequests(job)
+	if err != nil {
+		return nil, fmt.Errorf("error building upsert requests: %w", err)
+	}
+
+	for _, req := range reqs {
+		if err := cfg.schemas[req.Table].check(req.Data, req.Table); err != nil {
+			return nil, fmt.Errorf("error validating records: %w", err)
+		}
+
+		if req.Table == job.table {
+			if err := cfg.downsamples.add(job.request.downsample, req.Data, req.Table); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := cfg.foreach.collect(req.Table, req.Data); err != nil {
+			return nil, err
+		}
+
+		var offloaded int
+		if req.Data, offloaded, err = cfg.offload.records(ctx, req.Data, req.Table); err != nil {
+			return nil, fmt.Errorf("error offloading records: %w", err)
+		}
+
+		if offloaded > 0 {
+			logInfo := tools.LogEvent{Msg: "offloaded oversized records", Table: req.Table, Count: offloaded}
+			logInfo.Log(cfg.logger, logrus.InfoLevel)
+		}
+	}
+
+	upserts, err := partitionUpserts(reqs, cfg.schemas)
+	if err != nil {
+		return nil, fmt.Errorf("error partitioning records: %w", err)
+	}
+
+	for _, req := range reqs {
+		cfg.result.addMetadata(req.Table, job.metadata)
+	}
+
+	return upserts, nil
+}
+
+// transactUpserts will send the scoped deletes and the upserts of the job to the transactions of the repositories. The
+// errors of the storage operations fail their transaction, and are returned when the transaction is committed.
+func transactUpserts(ctx context.Context, workerID int, cfg *repoConfig, job *repoJob,
+	upserts []*partitionedUpsert,
+) error {
+	for idx, repo := range cfg.repos {
+		// Delete the records in the scope of the request before upserting, on the same transaction.
+		for _, req := range job.deletes {
+			if !cfg.routing.accepts(idx, req.Table) {
+				continue
+			}
+
+			req := req
+			txfn := func(sctx context.Context, repo repository.Generic) error {
+				start := time.Now()
+
+				sctx, cancel := cfg.withTimeout(sctx)
+				defer cancel()
+
+				rsp, err := repo.Delete(sctx, req)
+				cfg.result.timings.addStorage(time.Since(start))
+
+				if err != nil && ctx.Err() != nil {
+					return fmt.Errorf("delete canceled: %w", ctx.Err())
+				}
+
+				if err != nil {
+					return fmt.Errorf("error deleting truncate scope: %w", err)
+				}
+
+				logInfo := tools.LogEvent{
+					WorkerID:     workerID,
+					WorkerName:   "repository",
+					Duration:     time.Since(start),
+					Storage:      storage.Scheme(repo.Type()),
+					Table:        req.Table,
+					Msg:          "scoped truncate completed",
+					DeletedCount: rsp.DeletedCount,
+				}
+
+				logInfo.Log(cfg.logger, logrus.InfoLevel)
+
+				return nil
+			}
+			repo.TransactContext(ctx, txfn)
+		}
+
+		for _, upsert := range upserts {
+			if !cfg.routing.accepts(idx, upsert.table) {
+				continue
+			}
+
+			if err := cfg.partitions.create(ctx, idx, repo, upsert); err != nil {
+				return fmt.Errorf("error creating partition: %w", err)
+			}
+
+			if err := cfg.audit.create(ctx, idx, repo, upsert.req.Table); err != nil {
+				return err
+			}
+
+			idx, req := idx, upsert.req
+			txfn := func(sctx context.Context, repo repository.Generic) error {
+				start := time.Now()
+
+				sctx, cancel := cfg.withTimeout(sctx)
+				defer cancel()
+
+				// Read the records that the upsert overwrites before they are overwritten.
+				changes, err := cfg.audit.changes(sctx, idx, repo, req)
+				if err != nil {
+					return fmt.Errorf("error auditing upsert: %w", err)
+				}
+
+				rsp, err := repo.Upsert(sctx, req)
+				cfg.result.timings.addStorage(time.Since(start))
+
+				if err != nil && ctx.Err() != nil {
+					return fmt.Errorf("upsert canceled: %w", ctx.Err())
+				}
+
+				if err != nil {
+					return fmt.Errorf("error upserting data: %w", err)
+				}
+
+				if err := cfg.audit.write(sctx, idx, repo, changes, rsp.Errors); err != nil {
+					return fmt.Errorf("error auditing upsert: %w", err)
+				}
+
+				cfg.result.add(req.Table, rsp)
+
+				cfg.progress.send(&ProgressEvent{
+					Type:            ProgressUpserted,
+					Table:           req.Table,
+					Records:         rsp.UpsertedCount,
+					RecordErrors:    int64(len(rsp.Errors)),
+					Bytes:           int64(len(req.Data)),
+					RepositoryQueue: len(cfg.jobs),
+				})
+
+				rt := repo.Type()
+
+				// Route the records that failed to upsert to the dead letter handling.
+				if len(rsp.Errors) > 0 {
+					if err := cfg.deadLetter.write(storage.Scheme(rt), req.Table, rsp.Errors); err != nil {
+						return fmt.Errorf("error writing dead letter records: %w", err)
+					}
+				}
+
+				logInfo := tools.LogEvent{
+					WorkerID:      workerID,
+					WorkerName:    "repository",
+					Duration:      time.Since(start),
+					Storage:       storage.Scheme(rt),
+					Table:         req.Table,
+					Msg:           "partial upsert completed",
+					UpsertedCount: rsp.UpsertedCount,
+					MatchedCount:  rsp.MatchedCount,
+				}
+
+				logInfo.Log(cfg.logger, logrus.InfoLevel)
+
+				return nil
+			}
+			// Put the data onto the transaction channel for storage.
+			repo.TransactContext(ctx, txfn)
+		}
+	}
+
+	return nil
+}
+
+type webJob struct {
+	*flattenedRequest
+	repoJobs chan<- *repoJob
+	done     chan<- *jobDone
+	logger   *logrus.Logger
+	sinks    *sinkWriters
+	result   *UpsertResult
+
+	// quietHours are the windows during which the request is paused or made at a reduced rate.
+	quietHours []*QuietWindow
+
+	// maintenance pauses the request during maintenance windows and backs off on 503 responses.
+	maintenance *Maintenance
+
+	progress *progress
+
+	// lineage are the fields of the run ID, which are set on every record of the response.
+	lineage map[string]interface{}
+
+	// retry is the retry policy of the request.
+	retry *Retry
+
+	// archive writes the raw bodies of the responses of the request to the archive.
+	archive *archiveWriter
+
+	// cache sends the request conditionally with the validators of its previous response.
+	cache *responseCache
+
+	// autoscaler observes the latency of the request, if the web workers are autoscaled.
+	autoscaler *autoscaler
+
+	// pause holds the request until the operation is resumed, if it is paused.
+	pause *Pause
+
+	// decodeJobs are the responses of the requests, which are decoded and prepared for the repositories by the
+	// decode workers.
+	decodeJobs chan<- *decodeJob
+
+	// next are the requests of the pages that the responses of the request link to, which are made once the records
+	// of the request are upserted.
+	next []*flattenedRequest
+}
+
+func newWebJob(cfg *Config, req *flattenedRequest, repoConfig *repoConfig) *webJob {
+	retry := cfg.Retry
+	if req.retry != nil {
+		retry = req.retry
+	}
+
+	return &webJob{
+		flattenedRequest: req,
+		repoJobs:         repoConfig.jobs,
+		decodeJobs:       repoConfig.decodeJobs,
+		done:             repoConfig.done,
+		logger:           cfg.logger(logWeb),
+		sinks:            repoConfig.sinks,
+		result:           repoConfig.result,
+		quietHours:       cfg.QuietHours,
+		maintenance:      cfg.Maintenance,
+		progress:         repoConfig.progress,
+		lineage:          cfg.Lineage.fields(repoConfig.result.RunID),
+		retry:            retry,
+		archive:          repoConfig.archive,
+		cache:            repoConfig.cache,
+		autoscaler:       repoConfig.autoscaler,
+		pause:            repoConfig.pause,
+	}
+}
+
+// fetch will make the web request for the job and decode the records and pagination metadata of the response body. If
+// the response is stale, the request is made again until the retries of the staleness guard are exhausted.
+func fetch(ctx context.Context, job *webJob) (*web.FetchResponse, []byte, *Page, error) {
+	for attempt := 0; ; attempt++ {
+		rsp, bytes, err := fetchBody(ctx, job)
+		if err != nil {
+			return rsp, nil, nil, err
+		}
+
+		records, page, err := newDecoder(job.envelope).decode(bytes)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		err = job.staleness.check(records, time.Now())
+		if err == nil {
+			// Only the responses that are upserted are archived, so that they can be replayed.
+			if err := job.archive.write(job.table, rsp, bytes); err != nil {
+				return nil, nil, nil, err
+			}
+
+			return rsp, records, page, nil
+		}
+
+		if !errors.Is(err, ErrStaleResponse) || attempt >= job.staleness.Retries {
+			return nil, nil, nil, err
+		}
+
+		logWarn := tools.LogEvent{Msg: "retrying stale response", Err: err}
+		logWarn.Log(job.logger, logrus.WarnLevel)
 
-			logInfo := tools.LogFormatter{
-				Msg: fmt.Sprintf("closed repository for %q", storage.Scheme(repo.Type())),
-			}
-			cfg.Logger.Info(logInfo.String())
+		select {
+		case <-ctx.Done():
+			return nil, nil, nil, fmt.Errorf("unable to retry stale response: %w", ctx.Err())
+		case <-time.After(job.staleness.retryInterval()):
 		}
-	}, nil
+	}
 }
 
-// validate will ensure that the configuration is valid for querying the web API.
-func (cfg *Config) validate() error {
-	if cfg.RateLimitConfig == nil {
-		return MissingConfigFieldError("rateLimit")
+// fetchBody will make the web request for the job and read the response body, without decoding it. If the response is
+// not modified, it is returned with errNotModified.
+func fetchBody(ctx context.Context, job *webJob) (*web.FetchResponse, []byte, error) {
+	if err := job.pause.wait(ctx, job.logger); err != nil {
+		return nil, nil, err
 	}
 
-	if err := cfg.RateLimitConfig.validate(); err != nil {
-		return ErrInvalidRateLimit
+	if err := waitMaintenance(ctx, job.maintenance, job.logger); err != nil {
+		return nil, nil, err
 	}
 
-	if cfg.ConnectionStrings == nil {
-		logWarn := tools.LogFormatter{
-			Msg: "no connectionStrings specified in the config file",
-		}
-		cfg.Logger.Warn(logWarn.String())
+	if err := waitQuietHours(ctx, job.quietHours, job.logger); err != nil {
+		return nil, nil, err
 	}
 
-	return nil
-}
-
-// flattenRequests will flatten the requests into a single slice for HTTP requests.
-func (cfg *Config) flattenRequests(ctx context.Context) ([]*flattenedRequest, error) {
-	client, err := cfg.connect(ctx)
+	release, err := job.acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to web API: %w", err)
+		return nil, nil, err
 	}
 
-	var flattenedRequests []*flattenedRequest
+	defer release()
 
-	for _, req := range cfg.Requests {
-		flatReqs, err := req.flattenTimeseries(*cfg.URL, client)
-		if err != nil {
-			return nil, err
-		}
+	rsp, err := fetchThrottled(ctx, job)
+	if err != nil {
+		return nil, nil, WrapWebError(err)
+	}
 
-		flattenedRequests = append(flattenedRequests, flatReqs...)
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode == http.StatusNotModified {
+		return rsp, nil, errNotModified
 	}
 
-	if len(flattenedRequests) == 0 {
-		return nil, ErrNoRequests
+	bytes, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read response body: %w", err)
 	}
 
-	return flattenedRequests, nil
+	return rsp, bytes, nil
 }
 
-type repoJob struct {
-	req   http.Request
-	b     []byte
-	table string
-}
+// stream will make the web request for the job and stream the response body to the sink file of the job, returning the
+// number of records written.
+func stream(ctx context.Context, job *webJob) (*web.FetchResponse, int64, error) {
+	if err := waitMaintenance(ctx, job.maintenance, job.logger); err != nil {
+		return nil, 0, err
+	}
 
-type repoConfig struct {
-	repos      []repository.Generic
-	closeRepos repoCloser
-	jobs       chan *repoJob
-	done       chan bool
-	logger     *logrus.Logger
-}
+	if err := waitQuietHours(ctx, job.quietHours, job.logger); err != nil {
+		return nil, 0, err
+	}
 
-func newRepoConfig(ctx context.Context, cfg *Config, volume int) (*repoConfig, error) {
-	repos, closeRepos, err := cfg.repos(ctx)
+	release, err := job.acquire(ctx)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return &repoConfig{
-		repos:      repos,
-		closeRepos: closeRepos,
-		jobs:       make(chan *repoJob, volume*len(repos)),
-		done:       make(chan bool, volume),
-		logger:     cfg.Logger,
-	}, nil
+	defer release()
+
+	rsp, err := fetchThrottled(ctx, job)
+	if err != nil {
+		return nil, 0, WrapWebError(err)
+	}
+
+	defer rsp.Body.Close()
+
+	sink, err := job.sinks.open(job.sink.File)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count, err := sink.stream(rsp.Body)
+	if err != nil {
+		return nil, count, fmt.Errorf("unable to stream response to sink: %w", err)
+	}
+
+	return rsp, count, nil
 }
 
-func repositoryWorker(_ context.Context, workerID int, cfg *repoConfig) {
-	for job := range cfg.jobs {
-		reqs := []*proto.UpsertRequest{
-			{
-				Table:    job.table,
-				Data:     job.b,
-				DataType: int32(tools.UpsertDataJSON),
-			},
+// webWorker will make the web requests of the jobs until the jobs channel is closed, or until it receives from the quit
+// channel between jobs. Once the context is canceled, the requests are not made and are done as canceled.
+func webWorker(ctx context.Context, workerID int, jobs <-chan *webJob, quit <-chan struct{}) {
+	for {
+		var job *webJob
+
+		select {
+		case <-quit:
+			return
+		case next, ok := <-jobs:
+			if !ok {
+				return
+			}
+
+			job = next
 		}
 
-		for _, req := range reqs {
-			for _, repo := range cfg.repos {
-				txfn := func(sctx context.Context, repo repository.Generic) error {
-					start := time.Now()
+		if ctx.Err() != nil {
+			job.done <- &jobDone{req: job.flattenedRequest, canceled: true}
 
-					rsp, err := repo.Upsert(sctx, req)
-					if err != nil {
-						cfg.logger.Fatalf("error upserting data: %v", err)
+			continue
+		}
 
-						return fmt.Errorf("error upserting data: %w", err)
-					}
+		start := time.Now()
 
-					rt := repo.Type()
+		if job.sink != nil {
+			streamSinkJob(ctx, workerID, job, start, len(jobs))
 
-					msg := fmt.Sprintf("partial upsert completed: %s.%s", storage.Scheme(rt), req.Table)
-					logInfo := tools.LogFormatter{
-						WorkerID:      workerID,
-						WorkerName:    "repository",
-						Duration:      time.Since(start),
-						Msg:           msg,
-						UpsertedCount: rsp.UpsertedCount,
-						MatchedCount:  rsp.MatchedCount,
-					}
+			continue
+		}
 
-					cfg.logger.Infof(logInfo.String())
+		decode := &decodeJob{webJob: job, workerID: workerID, start: start}
 
-					return nil
-				}
-				// Put the data onto the transaction channel for storage.
-				repo.Transact(txfn)
-			}
+		var err error
+		if job.deferrable() {
+			decode.rsp, decode.body, decode.page, decode.undecoded, err = fetchUndecoded(ctx, job)
+		} else {
+			decode.rsp, decode.body, decode.page, err = fetchBisected(ctx, job)
 		}
 
-		cfg.done <- true
-	}
-}
+		if err != nil && ctx.Err() != nil {
+			// The operation was canceled, so the request is left for the snapshot.
+			job.done <- &jobDone{req: job.flattenedRequest, canceled: true}
 
-type webJob struct {
-	*flattenedRequest
-	repoJobs chan<- *repoJob
-	logger   *logrus.Logger
-}
+			continue
+		}
 
-func newWebJob(cfg *Config, req *flattenedRequest, repoJobs chan<- *repoJob) *webJob {
-	return &webJob{
-		flattenedRequest: req,
-		repoJobs:         repoJobs,
-		logger:           cfg.Logger,
-	}
-}
+		// The records of a response that is not modified are already upserted, so there is no repository job.
+		if errors.Is(err, errNotModified) {
+			job.progress.send(&ProgressEvent{Type: ProgressNotModified, Table: job.table, WebQueue: len(jobs)})
+			job.progress.send(&ProgressEvent{
+				Type:            ProgressRequestCompleted,
+				Table:           job.table,
+				WebQueue:        len(jobs),
+				RepositoryQueue: len(job.repoJobs),
+			})
+			job.done <- &jobDone{req: job.flattenedRequest}
 
-func webWorker(ctx context.Context, workerID int, jobs <-chan *webJob) {
-	for job := range jobs {
-		start := time.Now()
+			logWebRequest(job.logger, workerID, start, job.fetchConfig.URL, tools.LogEvent{Msg: "web request not modified"})
 
-		rsp, err := web.Fetch(ctx, job.fetchConfig)
-		if err != nil {
-			job.logger.Fatal(err)
+			continue
 		}
 
-		bytes, err := io.ReadAll(rsp.Body)
 		if err != nil {
-			job.logger.Fatal(err)
+			job.progress.send(&ProgressEvent{Type: ProgressRequestFailed, Table: job.table, Err: err})
+			job.done <- &jobDone{req: job.flattenedRequest, err: err}
+
+			continue
 		}
 
-		job.repoJobs <- &repoJob{b: bytes, req: *rsp.Request, table: job.table}
+		// The response is decoded by a decode worker, so that the web worker can make its next request.
+		decode.webQueue = len(jobs)
+		job.decodeJobs <- decode
+	}
+}
+
+// streamSinkJob will stream the response of a sink job to its file. The job is done once the response is streamed,
+// since the records are not upserted into the repositories.
+func streamSinkJob(ctx context.Context, workerID int, job *webJob, start time.Time, webQueue int) {
+	rsp, count, err := stream(ctx, job)
+	if err != nil && ctx.Err() != nil {
+		// The operation was canceled, so the request is left for the snapshot.
+		job.done <- &jobDone{req: job.flattenedRequest, canceled: true}
 
-		// strings.Replace is used to ensure no line endings are present in the user input.
-		escapedPath := strings.ReplaceAll(rsp.Request.URL.Path, "\n", "")
-		escapedPath = strings.ReplaceAll(escapedPath, "\r", "")
+		return
+	}
 
-		escapedHost := strings.ReplaceAll(rsp.Request.URL.Host, "\n", "")
-		escapedHost = strings.ReplaceAll(escapedHost, "\r", "")
+	if err != nil {
+		job.progress.send(&ProgressEvent{Type: ProgressRequestFailed, Table: job.table, Err: err})
+		job.done <- &jobDone{req: job.flattenedRequest, err: err}
 
-		logInfo := tools.LogFormatter{
-			WorkerID:   workerID,
-			WorkerName: "web",
-			Duration:   time.Since(start),
-			Host:       escapedHost,
-			Msg:        fmt.Sprintf("web request completed: %s", escapedPath),
-		}
-		job.logger.Infof(logInfo.String())
+		return
 	}
+
+	job.result.add(job.table, &proto.UpsertResponse{UpsertedCount: count})
+
+	job.progress.send(&ProgressEvent{Type: ProgressRequestCompleted, Table: job.table, WebQueue: webQueue})
+	job.progress.send(&ProgressEvent{Type: ProgressUpserted, Table: job.table, Records: count, WebQueue: webQueue})
+
+	job.done <- &jobDone{req: job.flattenedRequest}
+
+	logInfo := tools.LogEvent{Msg: "web request streamed", File: job.sink.File, Count: int(count)}
+	logWebRequest(job.logger, workerID, start, rsp.Request.URL, logInfo)
+}
+
+// logWebRequest will log the completion of a web request, with the worker, duration, host, and path of the request
+// set on the event.
+func logWebRequest(logger *logrus.Logger, workerID int, start time.Time, rurl *url.URL, logInfo tools.LogEvent) {
+	// strings.Replace is used to ensure no line endings are present in the user input.
+	escapedPath := strings.ReplaceAll(rurl.Path, "\n", "")
+	escapedPath = strings.ReplaceAll(escapedPath, "\r", "")
+
+	escapedHost := strings.ReplaceAll(rurl.Host, "\n", "")
+	escapedHost = strings.ReplaceAll(escapedHost, "\r", "")
+
+	logInfo.WorkerID = workerID
+	logInfo.WorkerName = "web"
+	logInfo.Duration = time.Since(start)
+	logInfo.Host = escapedHost
+	logInfo.Path = escapedPath
+	logInfo.Log(logger, logrus.InfoLevel)
 }
 
 func truncate(ctx context.Context, cfg *Config, truncateRequest *proto.TruncateRequest) error {
@@ -477,55 +2512,110 @@ func truncate(ctx context.Context, cfg *Config, truncateRequest *proto.TruncateR
 
 	defer closeRepos()
 
-	for _, repo := range repos {
+	routing := cfg.routing()
+
+	for idx, repo := range repos {
 		start := time.Now()
 
-		_, err := repo.Truncate(ctx, truncateRequest)
+		// Only truncate the tables that are routed to the repository.
+		routed := &proto.TruncateRequest{
+			Tables:  routing.filter(idx, truncateRequest.Tables),
+			Cascade: truncateRequest.Cascade,
+		}
+
+		_, err := repo.Truncate(ctx, routed)
 		if err != nil {
 			return fmt.Errorf("unable to truncate tables: %w", err)
 		}
 
 		rt := repo.Type()
-		tables := strings.Join(truncateRequest.Tables, ", ")
-		msg := fmt.Sprintf("truncated tables on %q: %v", storage.Scheme(rt), tables)
-
-		logInfo := tools.LogFormatter{
+		tables := strings.Join(routed.Tables, ", ")
+		logInfo := tools.LogEvent{
 			Duration: time.Since(start),
-			Msg:      msg,
+			Storage:  storage.Scheme(rt),
+			Table:    tables,
+			Msg:      "truncated tables",
 		}
-		cfg.Logger.Infof(logInfo.String())
+		logInfo.Log(cfg.logger(logRepository), logrus.InfoLevel)
 	}
 
-	logInfo := tools.LogFormatter{
+	logInfo := tools.LogEvent{
 		Duration: time.Since(start),
 		Msg:      "truncate completed",
 	}
-	cfg.Logger.Info(logInfo.String())
+	logInfo.Log(cfg.logger(logRepository), logrus.InfoLevel)
 
 	return nil
 }
 
 // Truncate will truncate the defined tables in the configuration.
 func Truncate(ctx context.Context, cfg *Config) error {
+	return truncateTables(ctx, cfg, nil)
+}
+
+// requestTables will return the tables that the requests write to.
+func requestTables(requests []*flattenedRequest) map[string]bool {
+	tables := make(map[string]bool)
+	for _, req := range requests {
+		for _, table := range req.tables() {
+			tables[table] = true
+		}
+	}
+
+	return tables
+}
+
+// filterTables will return the tables that are in the filter, or every table if the filter is nil.
+func filterTables(tables []string, filter map[string]bool) []string {
+	if filter == nil {
+		return tables
+	}
+
+	var filtered []string
+
+	for _, table := range tables {
+		if filter[table] {
+			filtered = append(filtered, table)
+		}
+	}
+
+	return filtered
+}
+
+// truncateTables will truncate the tables of the configuration, like Truncate, that are in the filter.
+func truncateTables(ctx context.Context, cfg *Config, filter map[string]bool) error {
 	// truncateRequest is a special request that will truncate the table before upserting data.
-	truncateRequest := new(proto.TruncateRequest)
+	truncateRequest := &proto.TruncateRequest{Cascade: cfg.TruncateCascade}
+
+	requests, err := cfg.expandRequests()
+	if err != nil {
+		return err
+	}
 
 	if cfg.Truncate {
-		for _, req := range cfg.Requests {
+		for _, req := range requests {
 			// Add the table to the list of tables to truncate.
-			if req.Truncate != nil && *req.Truncate {
-				truncateRequest.Tables = append(truncateRequest.Tables, req.Table)
+			if req.Truncate != nil && *req.Truncate && req.TruncateScope == nil {
+				truncateRequest.Tables = append(truncateRequest.Tables, req.tables()...)
 			}
 		}
 	} else {
 		// checking for request-specific truncate
-		for _, req := range cfg.Requests {
-			if table := req.Table; req.Truncate != nil && *req.Truncate && table != "" {
-				truncateRequest.Tables = append(truncateRequest.Tables, table)
+		for _, req := range requests {
+			if req.Truncate == nil || !*req.Truncate || req.TruncateScope != nil {
+				continue
+			}
+
+			for _, table := range req.tables() {
+				if table != "" {
+					truncateRequest.Tables = append(truncateRequest.Tables, table)
+				}
 			}
 		}
 	}
 
+	truncateRequest.Tables = filterTables(truncateRequest.Tables, filter)
+
 	return truncate(ctx, cfg, truncateRequest)
 }
 
@@ -535,63 +2625,342 @@ func Truncate(ctx context.Context, cfg *Config) error {
 // repository, a transaction will be created and used to upsert data. The transaction will be committed at the end
 // of the upsert operation. If the transaction fails, the transaction will be rolled back. Note that it is possible
 // for some repository transactions to succeed and others to fail.
-func Upsert(ctx context.Context, cfg *Config) error {
+//
+// The result contains the number of records upserted and matched for each table, summed over every repository.
+//
+// If requests fail, the transactions are rolled back and the errors of the requests are returned as a *RequestError,
+// or as RequestErrors if the error mode of the configuration collects the errors of every request.
+//
+// The options take precedence over the configuration of the operation, e.g. the number of workers.
+func Upsert(ctx context.Context, cfg *Config, options ...UpsertOption) (*UpsertResult, error) {
 	start := time.Now()
-	threads := runtime.NumCPU()
 
-	if err := Truncate(ctx, cfg); err != nil {
-		return err
+	opts, err := newUpsertOptions(cfg, options)
+	if err != nil {
+		return nil, err
 	}
 
-	flattenedRequests, err := cfg.flattenRequests(ctx)
+	release, err := cfg.Lock.acquire(ctx, cfg)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	defer release()
+
+	flattenedRequests := opts.requests
+
+	// tables are the tables that are truncated, which are every table unless the requests are set by the options.
+	var tables map[string]bool
+	if flattenedRequests != nil {
+		tables = requestTables(flattenedRequests)
+	} else if flattenedRequests, err = cfg.flattenRequests(ctx); err != nil {
+		return nil, err
 	}
 
-	repoConfig, err := newRepoConfig(ctx, cfg, len(flattenedRequests))
+	barrier, err := newBarrier(flattenedRequests)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	plan := newPlan(flattenedRequests)
+
+	logInfo := tools.LogEvent{
+		Msg:      "planned requests with an estimated duration",
+		Count:    plan.Requests,
+		Duration: plan.EstimatedDuration,
+	}
+	logInfo.Log(cfg.logger(logPlanner), logrus.InfoLevel)
+
+	if err := cfg.CostCeiling.check(plan); err != nil {
+		return nil, err
+	}
+
+	if err := createSchemas(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	// Tables are not truncated when resuming, since they hold the data of the requests that completed before the
+	// snapshot.
+	store, err := cfg.checkpointStore(ctx)
+	if err != nil {
+		return nil, err
 	}
 
+	resumed, err := cfg.Snapshot.resumable(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resumed {
+		if err := truncateTables(ctx, cfg, tables); err != nil {
+			return nil, err
+		}
+	}
+
+	// The transactions are started without the cancellation of the context, so that they can still be committed or
+	// rolled back once the operation is canceled. The storage operations are canceled with the context.
+	repoConfig, err := newRepoConfig(withoutCancel(ctx), cfg, len(flattenedRequests))
+	if err != nil {
+		return nil, err
+	}
+
+	repoConfig.pause = opts.pause
+
+	// Requests for the tables that are truncated are not conditional, since their records are deleted.
+	var truncated []string
+	if !resumed {
+		if truncated, err = cfg.truncatedTables(); err != nil {
+			return nil, err
+		}
+
+		truncated = filterTables(truncated, tables)
+	}
+
+	sc, err := cfg.StateEncryption.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if repoConfig.cache, err = cfg.Cache.load(ctx, store, sc, truncated); err != nil {
+		return nil, err
+	}
+
+	repoConfig.progress.planned(flattenedRequests)
+
 	defer repoConfig.closeRepos()
 
+	defer func() {
+		if err := repoConfig.deadLetter.close(); err != nil {
+			tools.LogEvent{Msg: err.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+		}
+
+		if err := repoConfig.sinks.close(); err != nil {
+			tools.LogEvent{Msg: err.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+		}
+	}()
+
+	// The workers are stopped with the run context once a request fails, unless the errors of every request are
+	// collected. The workers do not return the errors of the requests, which are done with their errors instead, so
+	// that the errors are collected in the order of the jobs and the workers keep going in the collect error mode.
+	runCtx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
+
+	var workers sync.WaitGroup
+
 	// Start the repository workers.
-	for id := 1; id <= threads; id++ {
-		go repositoryWorker(ctx, id, repoConfig)
+	for id := 1; id <= opts.storageWorkers; id++ {
+		id := id
+
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			repositoryWorker(runCtx, id, repoConfig)
+		}()
 	}
 
-	cfg.Logger.Info(tools.LogFormatter{Msg: "repository workers started"}.String())
+	tools.LogEvent{Msg: "repository workers started"}.Log(cfg.logger(logRepository), logrus.InfoLevel)
+
+	// Start the decode workers, which prepare the responses of the web workers for the repository workers.
+	for id := 1; id <= opts.decodeWorkers; id++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			decodeWorker(runCtx, repoConfig)
+		}()
+	}
 
 	webWorkerJobs := make(chan *webJob, len(cfg.Requests))
 
-	// Start the same number of web workers as the cores on the machine.
-	for id := 1; id <= threads; id++ {
-		go webWorker(ctx, id, webWorkerJobs)
+	// Start the web workers, which are adjusted while the operation runs if it is autoscaled.
+	webWorkers, maxWebWorkers := opts.webWorkers, opts.webWorkers
+	if cfg.Autoscale != nil {
+		webWorkers = cfg.Autoscale.clamp(webWorkers)
+		_, maxWebWorkers = cfg.Autoscale.bounds()
+	}
+
+	pool := newWebPool(runCtx, &workers, webWorkerJobs, cfg.logger(logWeb), maxWebWorkers)
+	pool.resize(webWorkers)
+
+	stopAutoscale := func() {}
+	if cfg.Autoscale != nil {
+		stopAutoscale = pool.autoscale(cfg.Autoscale, repoConfig.autoscaler, repoConfig.jobs, opts.storageWorkers)
+	}
+
+	tools.LogEvent{Msg: "web workers started"}.Log(cfg.logger(logWeb), logrus.InfoLevel)
+
+	// Enqueue the worker jobs until the run is stopped, holding back the requests that depend on tables until the
+	// requests writing to the tables are done, and wait for all of the data to flush.
+	completed := make(map[*flattenedRequest]bool, len(flattenedRequests))
+	failed := &failures{mode: cfg.ErrorMode}
+	queue := barrier.release(flattenedRequests)
+	canceled := false
+
+	var enqueued, received int
+
+	// receive will handle a job that the workers are done with, releasing the requests that depend on it.
+	receive := func(done *jobDone) {
+		received++
+
+		switch {
+		case done.err != nil:
+			reqErr := newRequestError(done.req, done.err)
+			tools.LogEvent{Msg: reqErr.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+
+			if failed.add(reqErr) {
+				stopRun()
+			}
+		case !done.canceled:
+			completed[done.req] = true
+
+			// The pages that the response links to are requests of their own, which hold back the dependents of
+			// their tables like the request.
+			for _, next := range done.next {
+				barrier.add(next)
+			}
+
+			repoConfig.progress.planned(done.next)
+			flattenedRequests = append(flattenedRequests, done.next...)
+			queue = append(queue, done.next...)
+		}
+
+		if released := barrier.done(done.req); len(released) > 0 {
+			// The upserts of the dependencies are executed before the dependent requests are made.
+			repoConfig.flush(ctx)
+
+			queue = append(queue, released...)
+		}
+	}
+
+	for {
+		for len(queue) > 0 && !canceled {
+			// Foreach requests are replaced by their requests, with the values collected from their table.
+			if req := queue[0]; req.foreach != nil {
+				expanded, released, err := barrier.expand(req, repoConfig.foreach)
+				queue = append(append(queue[1:], expanded...), released...)
+
+				if err != nil {
+					reqErr := newRequestError(req, err)
+					tools.LogEvent{Msg: reqErr.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+
+					if failed.add(reqErr) {
+						stopRun()
+					}
+
+					continue
+				}
+
+				logInfo := tools.LogEvent{Msg: "expanded foreach request", Table: req.table, Count: len(expanded)}
+				logInfo.Log(cfg.logger(logPlanner), logrus.InfoLevel)
+
+				flattenedRequests = append(flattenedRequests, expanded...)
+				completed[req] = true
+
+				continue
+			}
+
+			// The jobs that are done are received while the requests are enqueued, since foreach requests expand into
+			// more requests than the channels of the workers can hold.
+			select {
+			case <-runCtx.Done():
+				canceled = true
+			case done := <-repoConfig.done:
+				receive(done)
+			case webWorkerJobs <- newWebJob(cfg, queue[0], repoConfig):
+				queue = queue[1:]
+				enqueued++
+			}
+		}
+
+		if received == enqueued {
+			break
+		}
+
+		receive(<-repoConfig.done)
+	}
+
+	// Every job is done, so the workers are stopped.
+	stopAutoscale()
+	close(webWorkerJobs)
+	close(repoConfig.decodeJobs)
+	close(repoConfig.jobs)
+
+	workers.Wait()
+
+	logInfo = tools.LogEvent{WorkerName: "web", Msg: "web worker jobs done", Count: enqueued}
+	logInfo.Log(cfg.logger(logWeb), logrus.InfoLevel)
+
+	// The error of a run is the error of its failed requests, or the error of its context if it was canceled.
+	runErr := failed.err()
+	if runErr == nil && ctx.Err() != nil {
+		runErr = fmt.Errorf("upsert canceled: %w", ctx.Err())
 	}
 
-	cfg.Logger.Info(tools.LogFormatter{Msg: "web workers started"}.String())
+	// The aggregates of the timeseries are only upserted once every candle of the run is.
+	if runErr == nil {
+		if err := transactDownsamples(ctx, repoConfig); err != nil {
+			runErr = err
+		}
+	}
 
-	// Enqueue the worker jobs
-	for _, req := range flattenedRequests {
-		webWorkerJobs <- newWebJob(cfg, req, repoConfig.jobs)
+	// The statistics of the run are committed with its records, so only the runs that completed have statistics.
+	if runErr == nil {
+		if err := transactRunStats(ctx, repoConfig, cfg.RunStats, requestTables(flattenedRequests), start); err != nil {
+			runErr = err
+		}
 	}
 
-	cfg.Logger.Info(tools.LogFormatter{Msg: "web worker jobs enqueued"}.String())
+	// The transactions of a failed or canceled run are rolled back, unless there is a snapshot to resume the run from,
+	// in which case the completed requests are committed.
+	if runErr != nil && (cfg.Snapshot == nil || cfg.Snapshot.File == "") {
+		for _, repo := range repoConfig.repos {
+			if rbErr := repo.Rollback(); rbErr != nil {
+				tools.LogEvent{Msg: "unable to rollback", Err: rbErr}.Log(cfg.Logger, logrus.ErrorLevel)
+			}
+		}
 
-	// Wait for all of the data to flush.
-	for a := 1; a <= len(flattenedRequests); a++ {
-		<-repoConfig.done
+		return nil, runErr
 	}
 
 	// Commit the transactions and check for errors.
 	for _, repo := range repoConfig.repos {
 		if err := repo.Commit(); err != nil {
-			return fmt.Errorf("unable to commit transaction: %w", err)
+			// None of the requests can be assumed to be stored if the commit fails.
+			cfg.writeSnapshot(ctx, store, flattenedRequests, nil)
+
+			return nil, fmt.Errorf("unable to commit transaction: %w", err)
 		}
 	}
 
-	logInfo := tools.LogFormatter{Duration: time.Since(start), Msg: "upsert completed"}
-	cfg.Logger.Info(logInfo.String())
+	if err := repoConfig.cache.write(withoutCancel(ctx), completed); err != nil {
+		tools.LogEvent{Msg: err.Error()}.Log(cfg.Logger, logrus.ErrorLevel)
+	}
+
+	if runErr != nil {
+		cfg.writeSnapshot(ctx, store, flattenedRequests, completed)
 
-	return nil
+		return nil, runErr
+	}
+
+	if resumed {
+		if err := cfg.Snapshot.remove(ctx, store); err != nil {
+			return nil, err
+		}
+	}
+
+	timings := repoConfig.result.Timings()
+	logInfo = tools.LogEvent{
+		Duration:        time.Since(start),
+		Msg:             "upsert completed",
+		RunID:           repoConfig.result.RunID,
+		RateLimiterTime: timings.RateLimiter,
+		NetworkTime:     timings.Network,
+		StorageTime:     timings.Storage,
+	}
+	logInfo.Log(cfg.Logger, logrus.InfoLevel)
+
+	return repoConfig.result, nil
 }
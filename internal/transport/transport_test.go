@@ -9,14 +9,29 @@ package transport
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alpine-hodler/gidari/internal/web"
+	"github.com/alpine-hodler/gidari/internal/web/auth"
+	"github.com/alpine-hodler/gidari/proto"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 func TestTimeseries(t *testing.T) {
@@ -181,6 +196,62 @@ func TestTimeseries(t *testing.T) {
 	})
 }
 
+func TestTimeseriesGranularity(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		granularity string
+		maxRecords  int32
+		period      int32
+		expected    int
+		err         error
+	}{
+		{name: "seconds", granularity: "3600", maxRecords: 7, expected: 4},
+		{name: "duration", granularity: "1h", maxRecords: 7, expected: 4},
+		{name: "single record", granularity: "1h", maxRecords: 1, expected: 24},
+		{name: "period takes precedence", granularity: "1h", maxRecords: 7, period: 43200, expected: 2},
+		{name: "missing max records", granularity: "1h", err: ErrMissingTimeseriesField},
+		{name: "invalid granularity", granularity: "hourly", maxRecords: 7, err: ErrUnableToParse},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			timeseries := &timeseries{
+				StartName:       "start",
+				EndName:         "end",
+				GranularityName: "granularity",
+				MaxRecords:      test.maxRecords,
+				Period:          test.period,
+			}
+
+			testURL, err := url.Parse("https//api.test.com/")
+			if err != nil {
+				t.Fatalf("error parsing url: %v", err)
+			}
+
+			query := testURL.Query()
+			query.Set("start", "2022-05-10T00:00:00Z")
+			query.Set("end", "2022-05-11T00:00:00Z")
+			query.Set("granularity", test.granularity)
+			testURL.RawQuery = query.Encode()
+
+			err = timeseries.chunk(*testURL)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if len(timeseries.chunks) != test.expected {
+				t.Fatalf("expected %d chunks, got %d", test.expected, len(timeseries.chunks))
+			}
+		})
+	}
+}
+
 func TestUpsert(t *testing.T) {
 	t.Parallel()
 
@@ -236,7 +307,7 @@ func TestUpsert(t *testing.T) {
 			}
 
 			// Upsert the fixture.
-			if err := Upsert(context.Background(), cfg); err != nil {
+			if _, err := Upsert(context.Background(), cfg); err != nil {
 				t.Fatalf("error upserting: %v", err)
 			}
 
@@ -266,3 +337,1230 @@ func TestUpsert(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigConcurrency(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 1
+  period: 1
+requests:
+  - endpoint: /candles
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-11T00:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 18000
+`)
+
+	t.Run("flatten requests concurrently", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := NewConfig(cfgYAML)
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		const runs = 8
+
+		counts := make(chan int, runs)
+		transports := make(chan interface{}, runs)
+
+		for run := 0; run < runs; run++ {
+			go func() {
+				flatReqs, err := cfg.flattenRequests(context.Background())
+
+				counts <- len(flatReqs)
+				if err != nil {
+					t.Errorf("error flattening requests: %v", err)
+
+					return
+				}
+
+				transports <- flatReqs[0].fetchConfig.C.Transport
+			}()
+		}
+
+		var transport interface{}
+		for run := 0; run < runs; run++ {
+			if count := <-counts; count != 5 {
+				t.Fatalf("expected 5 flattened requests, got %d", count)
+			}
+
+			if got := <-transports; run == 0 {
+				transport = got
+			} else if got != transport {
+				t.Fatalf("expected the round tripper to be shared between runs")
+			}
+		}
+
+		if cfg.Requests[0].Query["end"] != "2022-05-11T00:00:00Z" {
+			t.Fatalf("expected the request query to be unchanged, got %v", cfg.Requests[0].Query)
+		}
+	})
+
+	t.Run("per run rate limiter", func(t *testing.T) {
+		t.Parallel()
+
+		cfg, err := NewConfig(cfgYAML)
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		cfg.RateLimitConfig.PerRun = true
+
+		run1, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error flattening requests: %v", err)
+		}
+
+		run2, err := cfg.flattenRequests(context.Background())
+		if err != nil {
+			t.Fatalf("error flattening requests: %v", err)
+		}
+
+		if run1[0].fetchConfig.RateLimiter == run2[0].fetchConfig.RateLimiter {
+			t.Fatalf("expected each run to have its own rate limiter")
+		}
+
+		if run1[0].fetchConfig.RateLimiter != run1[1].fetchConfig.RateLimiter {
+			t.Fatalf("expected requests in the same run to share a rate limiter")
+		}
+	})
+}
+
+func TestNewUpsertRequests(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"trades":[{"id":1}],"orders":[{"id":2},{"id":3}]}`)
+
+	t.Run("no split", func(t *testing.T) {
+		t.Parallel()
+
+		reqs, err := newUpsertRequests(&repoJob{b: body, table: "snapshot"})
+		if err != nil {
+			t.Fatalf("error creating upsert requests: %v", err)
+		}
+
+		if len(reqs) != 1 || reqs[0].Table != "snapshot" || string(reqs[0].Data) != string(body) {
+			t.Fatalf("unexpected upsert requests: %v", reqs)
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		t.Parallel()
+
+		reqs, err := newUpsertRequests(&repoJob{b: body, table: "snapshot", split: []*Split{
+			{Path: "trades", Table: "trades"},
+			{Path: "orders", Table: "orders"},
+		}})
+		if err != nil {
+			t.Fatalf("error creating upsert requests: %v", err)
+		}
+
+		if len(reqs) != 2 {
+			t.Fatalf("expected 2 upsert requests, got %d", len(reqs))
+		}
+
+		if reqs[0].Table != "trades" || string(reqs[0].Data) != `[{"id":1}]` {
+			t.Fatalf("unexpected trades request: %v", reqs[0])
+		}
+
+		if reqs[1].Table != "orders" || string(reqs[1].Data) != `[{"id":2},{"id":3}]` {
+			t.Fatalf("unexpected orders request: %v", reqs[1])
+		}
+	})
+
+	t.Run("missing path", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newUpsertRequests(&repoJob{b: body, split: []*Split{{Path: "fills", Table: "fills"}}})
+		if err == nil {
+			t.Fatalf("expected an error for a missing split path")
+		}
+	})
+
+	t.Run("response header fields", func(t *testing.T) {
+		t.Parallel()
+
+		fields := map[string]interface{}{"request_id": "abc"}
+
+		reqs, err := newUpsertRequests(&repoJob{b: body, fields: fields, split: []*Split{
+			{Path: "trades", Table: "trades"},
+		}})
+		if err != nil {
+			t.Fatalf("error creating upsert requests: %v", err)
+		}
+
+		if string(reqs[0].Data) != `[{"id":1,"request_id":"abc"}]` {
+			t.Fatalf("unexpected trades request: %v", reqs[0])
+		}
+	})
+}
+
+func TestCaptureHeaders(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{}
+	header.Set("Cb-After", "123")
+	header.Set("X-Request-Id", "abc")
+
+	fields, metadata := captureHeaders(header, []*ResponseHeader{
+		{Header: "CB-AFTER", Field: "cursor"},
+		{Header: "X-Request-Id"},
+		{Header: "X-Missing", Field: "missing"},
+	})
+
+	if !reflect.DeepEqual(fields, map[string]interface{}{"cursor": "123"}) {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+
+	if !reflect.DeepEqual(metadata, map[string]string{"X-Request-Id": "abc"}) {
+		t.Fatalf("unexpected metadata: %v", metadata)
+	}
+}
+
+func TestUpsertResult(t *testing.T) {
+	t.Parallel()
+
+	result := newUpsertResult()
+	result.add("candles", &proto.UpsertResponse{UpsertedCount: 2, MatchedCount: 1})
+	result.add("candles", &proto.UpsertResponse{UpsertedCount: 3})
+	result.add("trades", &proto.UpsertResponse{MatchedCount: 4})
+
+	if rsp := result.Tables["candles"]; rsp.UpsertedCount != 5 || rsp.MatchedCount != 1 {
+		t.Fatalf("unexpected candles result: %v", rsp)
+	}
+
+	if rsp := result.Tables["trades"]; rsp.UpsertedCount != 0 || rsp.MatchedCount != 4 {
+		t.Fatalf("unexpected trades result: %v", rsp)
+	}
+
+	if result.UpsertedCount() != 5 || result.MatchedCount() != 5 {
+		t.Fatalf("unexpected totals: upserted=%d, matched=%d", result.UpsertedCount(), result.MatchedCount())
+	}
+}
+
+func TestTruncateScope(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 1
+  period: 1
+requests:
+  - endpoint: /products/BTC-USD/candles
+    table: candles
+    truncate: true
+    truncateScope:
+      required:
+        product_id: BTC-USD
+      timeField: time
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-10T10:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 18000
+  - endpoint: /products
+    truncate: true
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	flatReqs, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	if len(flatReqs) != 3 {
+		t.Fatalf("expected 3 flattened requests, got %d", len(flatReqs))
+	}
+
+	for idx, expRange := range [][2]string{
+		{"2022-05-10T00:00:00Z", "2022-05-10T05:00:00Z"},
+		{"2022-05-10T05:00:00Z", "2022-05-10T10:00:00Z"},
+	} {
+		deletes := flatReqs[idx].deletes
+		if len(deletes) != 1 {
+			t.Fatalf("expected 1 delete request, got %d", len(deletes))
+		}
+
+		del := deletes[0]
+		if del.Table != "candles" || del.RangeField != "time" || del.RangeStart != expRange[0] ||
+			del.RangeEnd != expRange[1] {
+			t.Fatalf("unexpected delete request: %v", del)
+		}
+
+		if del.Required.AsMap()["product_id"] != "BTC-USD" {
+			t.Fatalf("unexpected required fields: %v", del.Required.AsMap())
+		}
+	}
+
+	if len(flatReqs[2].deletes) != 0 {
+		t.Fatalf("expected no delete requests for a request without a truncate scope")
+	}
+}
+
+func TestExpandGranularities(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 1
+  period: 1
+requests:
+  - endpoint: /products/BTC-USD/candles
+    table: candles_{{ .Granularity }}_btc
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-11T00:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      granularityName: granularity
+      maxRecords: 5
+      granularities: ["3600", "21600"]
+  - endpoint: /products/ETH-USD/candles
+    table: eth
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-11T00:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 86400
+      granularityName: granularity
+      granularities: ["1m"]
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	flatReqs, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	tables := make(map[string]int)
+	for _, flatReq := range flatReqs {
+		tables[flatReq.table]++
+
+		granularity := flatReq.fetchConfig.URL.Query().Get("granularity")
+		if granularity == "" {
+			t.Fatalf("expected granularity on the query: %v", flatReq.fetchConfig.URL)
+		}
+	}
+
+	expected := map[string]int{"candles_3600_btc": 6, "candles_21600_btc": 1, "eth_1m": 1}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Fatalf("expected tables %v, got %v", expected, tables)
+	}
+
+	if len(cfg.Requests[0].Query) != 2 {
+		t.Fatalf("expected the request query to be unchanged, got %v", cfg.Requests[0].Query)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 2
+  period: 1s
+costCeiling:
+  maxDuration: 1m
+requests:
+  - endpoint: /candles
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-11T00:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+  - endpoint: /products
+`)
+
+	cfg, err := NewConfig(cfgYAML)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	plan, err := Estimate(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("error estimating config: %v", err)
+	}
+
+	if plan.Requests != 25 || plan.Tables["candles"] != 24 || plan.Tables["products"] != 1 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+
+	if plan.EstimatedDuration != 23*time.Second {
+		t.Fatalf("expected an estimated duration of 23s, got %v", plan.EstimatedDuration)
+	}
+
+	if err := cfg.CostCeiling.check(plan); err != nil {
+		t.Fatalf("expected the plan to be within the cost ceiling: %v", err)
+	}
+
+	cfg.CostCeiling.MaxRequests = 10
+	if err := cfg.CostCeiling.check(plan); !errors.Is(err, ErrCostCeilingExceeded) {
+		t.Fatalf("expected the plan to exceed the cost ceiling, got %v", err)
+	}
+
+	t.Run("without web requests", func(t *testing.T) {
+		t.Parallel()
+
+		var requests int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+		}))
+		defer server.Close()
+
+		cfg, err := NewConfig([]byte(fmt.Sprintf(`
+url: %s
+rateLimit:
+  burst: 1
+  period: 1s
+authentication:
+  apiKey:
+    key: k
+    secret: czM=
+    passphrase: p
+    clockSync:
+      endpoint: /time
+requests:
+  - endpoint: /products
+`, server.URL)))
+		if err != nil {
+			t.Fatalf("error creating config: %v", err)
+		}
+
+		if _, err := Estimate(context.Background(), cfg); err != nil {
+			t.Fatalf("error estimating config: %v", err)
+		}
+
+		if got := atomic.LoadInt32(&requests); got != 0 {
+			t.Fatalf("expected no web requests, got %d", got)
+		}
+	})
+}
+
+func TestPlanRequests(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 2
+  period: 1s
+requests:
+  - endpoint: /candles
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-10T02:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+  - endpoint: /orders
+    split:
+      - path: fills
+        table: fills
+    dependsOn: [candles]
+`)
+
+	cfg, err := NewConfig(cfgYAML)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	planned, err := PlanRequests(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("error planning requests: %v", err)
+	}
+
+	if len(planned) != 3 {
+		t.Fatalf("expected 3 planned requests, got %d", len(planned))
+	}
+
+	start := time.Date(2022, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	for idx, req := range planned[:2] {
+		chunkStart := start.Add(time.Duration(idx) * time.Hour)
+		if !req.ChunkStart.Equal(chunkStart) || !req.ChunkEnd.Equal(chunkStart.Add(time.Hour)) {
+			t.Fatalf("unexpected chunk of request %d: %v to %v", idx, req.ChunkStart, req.ChunkEnd)
+		}
+
+		if req.URL.Query().Get("start") != chunkStart.Format(time.RFC3339) || req.Method != http.MethodGet {
+			t.Fatalf("unexpected request %d: %s %s", idx, req.Method, req.URL)
+		}
+
+		if !reflect.DeepEqual(req.Tables, []string{"candles"}) || req.Limit != 1 || req.Burst != 2 {
+			t.Fatalf("unexpected planned request %d: %+v", idx, req)
+		}
+	}
+
+	orders := planned[2]
+	if !orders.ChunkStart.IsZero() || !reflect.DeepEqual(orders.Tables, []string{"fills"}) ||
+		!reflect.DeepEqual(orders.DependsOn, []string{"candles"}) {
+		t.Fatalf("unexpected planned request: %+v", orders)
+	}
+}
+
+func TestSingletonRecord(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		data     string
+		expected string
+		err      error
+	}{
+		{name: "keyed object", data: `{"id":"abc","status":"ok"}`, expected: `{"id":"abc","status":"ok"}`},
+		{name: "unkeyed object", data: `{"status":"ok"}`, expected: `{"id":"status","status":"ok"}`},
+		{name: "array", data: `[{"status":"ok"}]`, err: ErrSingletonNotObject},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			reqs, err := newUpsertRequests(&repoJob{b: []byte(tcase.data), table: "status", singletonKey: "id"})
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if err == nil && string(reqs[0].Data) != tcase.expected {
+				t.Fatalf("expected data %s, got %s", tcase.expected, reqs[0].Data)
+			}
+		})
+	}
+}
+
+func TestRateLimitGroups(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+rateLimitGroups:
+  market:
+    burst: 1
+    period: 1s
+requests:
+  - endpoint: /trades
+    rateLimitGroup: market
+  - endpoint: /candles
+    rateLimitGroup: market
+  - endpoint: /orders
+    rateLimitGroup: account
+  - endpoint: /products
+  - endpoint: /currencies
+`)
+
+	cfg, err := NewConfig(cfgYAML)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	requests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	limiter := func(idx int) *rate.Limiter { return requests[idx].fetchConfig.RateLimiter }
+
+	if limiter(0) != limiter(1) || limiter(0).Burst() != 1 {
+		t.Fatalf("expected requests in the market group to share the group limiter")
+	}
+
+	if limiter(2) == limiter(3) || limiter(2).Burst() != 5 {
+		t.Fatalf("expected an undefined group to get an independent limiter with the config rate limit")
+	}
+
+	if limiter(3) != limiter(4) || limiter(0) == limiter(3) {
+		t.Fatalf("expected requests without a group to share the config limiter")
+	}
+
+	t.Run("invalid group", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+rateLimitGroups:
+  market:
+    burst: 1
+`))
+		if !errors.Is(err, ErrInvalidRateLimit) {
+			t.Fatalf("expected invalid rate limit error, got %v", err)
+		}
+	})
+}
+
+func TestRequestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /trades
+    rateLimit:
+      burst: 2
+      period: 1s
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+      layout: 2006-01-02T15:04:05Z07:00
+    query:
+      start: "2022-05-10T00:00:00Z"
+      end: "2022-05-10T03:00:00Z"
+  - endpoint: /trades
+    query:
+      symbol: BTC
+    rateLimit:
+      burst: 2
+      period: 1s
+  - endpoint: /candles
+    rateLimit:
+      burst: 1
+      period: 1m
+  - endpoint: /products
+`)
+
+	cfg, err := NewConfig(cfgYAML)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	requests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	if len(requests) != 6 {
+		t.Fatalf("expected 3 timeseries chunks and 3 requests, got %d requests", len(requests))
+	}
+
+	limiter := func(idx int) *rate.Limiter { return requests[idx].fetchConfig.RateLimiter }
+	last := len(requests) - 1
+
+	for idx := 1; idx < last-1; idx++ {
+		if limiter(idx) != limiter(0) {
+			t.Fatalf("expected the chunks and requests of an endpoint to share the endpoint limiter")
+		}
+	}
+
+	if limiter(0).Burst() != 2 || limiter(last-1).Burst() != 1 || limiter(last-1).Limit() != rate.Every(time.Minute) {
+		t.Fatalf("expected the limiters of the endpoints to have the rate limits of the requests")
+	}
+
+	if limiter(last) == limiter(0) || limiter(last) == limiter(last-1) || limiter(last).Burst() != 5 {
+		t.Fatalf("expected requests without a rate limit to use the config limiter")
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct{ name, request string }{
+			{"group", `
+  - endpoint: /trades
+    rateLimitGroup: market
+    rateLimit:
+      burst: 1
+      period: 1s`},
+			{"no period", `
+  - endpoint: /trades
+    rateLimit:
+      burst: 1`},
+		} {
+			tcase := tcase
+
+			t.Run(tcase.name, func(t *testing.T) {
+				t.Parallel()
+
+				_, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:` + tcase.request))
+				if !errors.Is(err, ErrInvalidRateLimit) {
+					t.Fatalf("expected invalid rate limit error, got %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestQueryParams(t *testing.T) {
+	t.Parallel()
+
+	cfgYAML := []byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 5
+  period: 1s
+requests:
+  - endpoint: /tickers
+    query:
+      limit: "10"
+    queryParams:
+      - name: symbol
+        values: [BTC, ETH]
+      - name: symbols
+        values: [BTC, ETH/USD]
+        separator: ","
+      - name: empty
+`)
+
+	cfg, err := NewConfig(cfgYAML)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	requests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	expected := "limit=10&symbol=BTC&symbol=ETH&symbols=BTC,ETH%2FUSD"
+	if actual := requests[0].fetchConfig.URL.RawQuery; actual != expected {
+		t.Fatalf("expected query %q, got %q", expected, actual)
+	}
+}
+
+func TestChunkConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var inFlight, maxInFlight int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			highest := atomic.LoadInt32(&maxInFlight)
+			if current <= highest || atomic.CompareAndSwapInt32(&maxInFlight, highest, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg, err := NewConfig([]byte(`
+url: ` + server.URL + `
+rateLimit:
+  burst: 10
+  period: 1
+requests:
+  - endpoint: /candles
+    query:
+      start: 2022-05-10T00:00:00Z
+      end: 2022-05-11T00:00:00Z
+    timeseries:
+      startName: start
+      endName: end
+      period: 3600
+      concurrency: 2
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	requests, err := cfg.flattenRequests(context.Background())
+	if err != nil {
+		t.Fatalf("error flattening requests: %v", err)
+	}
+
+	for _, req := range requests {
+		if req.concurrency == nil || req.concurrency != requests[0].concurrency || cap(req.concurrency) != 2 {
+			t.Fatalf("expected the chunks to share a concurrency limit of 2")
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for _, req := range requests[:8] {
+		wg.Add(1)
+
+		go func(req *flattenedRequest) {
+			defer wg.Done()
+
+			if _, _, _, err := fetch(context.Background(), &webJob{flattenedRequest: req, logger: cfg.Logger}); err != nil {
+				t.Errorf("error fetching chunk: %v", err)
+			}
+		}(req)
+	}
+
+	wg.Wait()
+
+	if highest := atomic.LoadInt32(&maxInFlight); highest != 2 {
+		t.Fatalf("expected at most 2 chunks in flight, got %d", highest)
+	}
+}
+
+func TestTransactionTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := (&repoConfig{}).withTimeout(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatalf("expected no deadline without a transaction timeout")
+	}
+
+	cancel()
+
+	if ctx.Err() == nil {
+		t.Fatalf("expected the context to be canceled")
+	}
+
+	ctx, cancel = (&repoConfig{timeout: time.Minute}).withTimeout(context.Background())
+	defer cancel()
+
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Fatalf("expected a deadline within the transaction timeout, got %v", deadline)
+	}
+}
+
+func TestAuth2Validate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name  string
+		auth2 *Auth2
+		err   bool
+	}{
+		{name: "bearer", auth2: &Auth2{Bearer: "b"}},
+		{name: "client credentials", auth2: &Auth2{TokenURL: "/token", ClientID: "i", ClientSecret: "s"}},
+		{name: "bearer and token url", auth2: &Auth2{Bearer: "b", TokenURL: "/token"}, err: true},
+		{name: "no client secret", auth2: &Auth2{TokenURL: "/token", ClientID: "i"}, err: true},
+		{name: "no token url", auth2: &Auth2{ClientID: "i", ClientSecret: "s"}, err: true},
+	} {
+		if err := tcase.auth2.validate(); tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+	}
+}
+
+func TestOAuth1Validate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		oauth1 *OAuth1
+		err    bool
+	}{
+		{name: "three-legged", oauth1: &OAuth1{ConsumerKey: "k", ConsumerSecret: "s", Token: "t", TokenSecret: "ts"}},
+		{name: "two-legged", oauth1: &OAuth1{ConsumerKey: "k", ConsumerSecret: "s", SignatureMethod: "HMAC-SHA256"}},
+		{name: "no consumer secret", oauth1: &OAuth1{ConsumerKey: "k"}, err: true},
+		{
+			name:   "unsupported",
+			oauth1: &OAuth1{ConsumerKey: "k", ConsumerSecret: "s", SignatureMethod: "PLAINTEXT"},
+			err:    true,
+		},
+	} {
+		if err := tcase.oauth1.validate(); tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+	}
+}
+
+func TestJWTValidate(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		jwt  *JWT
+		err  bool
+	}{
+		{name: "key file", jwt: &JWT{PrivateKeyFile: keyFile, Algorithm: "ES256", TTL: time.Minute}},
+		{name: "invalid key", jwt: &JWT{PrivateKey: "key"}, err: true},
+		{name: "missing key file", jwt: &JWT{PrivateKeyFile: keyFile + ".missing"}, err: true},
+		{name: "no key", jwt: &JWT{Algorithm: "RS256"}, err: true},
+		{name: "unsupported", jwt: &JWT{PrivateKeyFile: keyFile, Algorithm: "HS256"}, err: true},
+		{name: "negative ttl", jwt: &JWT{PrivateKeyFile: keyFile, TTL: -time.Second}, err: true},
+	} {
+		err := tcase.jwt.validate()
+		if err == nil {
+			_, err = tcase.jwt.key()
+		}
+
+		if tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+	}
+}
+
+func TestSigV4Validate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name  string
+		sigv4 *SigV4
+		err   bool
+	}{
+		{name: "credentials chain", sigv4: &SigV4{Service: "execute-api"}},
+		{name: "static credentials", sigv4: &SigV4{Service: "es", AccessKeyID: "AKID", SecretAccessKey: "s"}},
+		{name: "no service", sigv4: &SigV4{Region: "us-east-1"}, err: true},
+		{name: "no secret access key", sigv4: &SigV4{Service: "es", AccessKeyID: "AKID"}, err: true},
+	} {
+		if err := tcase.sigv4.validate(); tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+	}
+}
+
+func TestCanceledWorkers(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), tcontextKey{}, "value"))
+	cancel()
+
+	t.Run("without cancel", func(t *testing.T) {
+		t.Parallel()
+
+		uncanceled := withoutCancel(ctx)
+		if uncanceled.Err() != nil || uncanceled.Done() != nil {
+			t.Fatalf("expected the context not to be canceled")
+		}
+
+		if uncanceled.Value(tcontextKey{}) != "value" {
+			t.Fatalf("expected the context to have the values of its parent")
+		}
+	})
+
+	t.Run("web worker", func(t *testing.T) {
+		t.Parallel()
+
+		var calls int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+		}))
+		t.Cleanup(server.Close)
+
+		rurl, _ := url.Parse(server.URL)
+		done := make(chan *jobDone, 1)
+		jobs := make(chan *webJob, 1)
+		jobs <- &webJob{
+			flattenedRequest: &flattenedRequest{fetchConfig: &web.FetchConfig{URL: rurl}},
+			done:             done,
+			logger:           logrus.New(),
+		}
+		close(jobs)
+
+		webWorker(ctx, 1, jobs, nil)
+
+		if jd := <-done; !jd.canceled {
+			t.Fatalf("expected the job to be done as canceled")
+		}
+
+		if atomic.LoadInt32(&calls) != 0 {
+			t.Fatalf("expected no web requests once the context is canceled")
+		}
+	})
+
+	t.Run("repository worker", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := &repoConfig{jobs: make(chan *repoJob, 1), done: make(chan *jobDone, 1), logger: logrus.New()}
+		cfg.jobs <- &repoJob{request: &flattenedRequest{}, b: []byte(`[{"id":1}]`)}
+		close(cfg.jobs)
+
+		// The worker returns once the jobs channel is closed.
+		repositoryWorker(ctx, 1, cfg)
+
+		if jd := <-cfg.done; !jd.canceled {
+			t.Fatalf("expected the job to be done as canceled")
+		}
+	})
+}
+
+type tcontextKey struct{}
+
+func TestBasic(t *testing.T) {
+	t.Parallel()
+
+	t.Run("validate", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tcase := range []struct {
+			name  string
+			basic *Basic
+			err   bool
+		}{
+			{name: "nil"},
+			{name: "username and password", basic: &Basic{Username: "user", Password: "pass"}},
+			{name: "no password", basic: &Basic{Username: "user"}},
+			{name: "no username", basic: &Basic{Password: "pass"}, err: true},
+			{name: "colon", basic: &Basic{Username: "us:er", Password: "pass"}, err: true},
+		} {
+			if err := tcase.basic.validate(); tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+				t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+			}
+		}
+	})
+
+	t.Run("new client", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		defer server.Close()
+
+		rurl, _ := url.Parse(server.URL)
+		cfg := &Config{
+			RawURL:         server.URL,
+			URL:            rurl,
+			Logger:         logrus.New(),
+			Authentication: Authentication{Basic: &Basic{Username: "user", Password: "pass"}},
+		}
+
+		client, err := cfg.newClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		rsp, err := web.Fetch(context.Background(), &web.FetchConfig{
+			C:           client,
+			Method:      http.MethodGet,
+			URL:         rurl,
+			RateLimiter: rate.NewLimiter(rate.Inf, 1),
+		})
+		if err != nil {
+			t.Fatalf("failed to fetch: %v", err)
+		}
+
+		rsp.Body.Close()
+	})
+}
+
+func TestCustomKeyValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		customKey *CustomKey
+		err       bool
+	}{
+		{name: "nil"},
+		{name: "header", customKey: &CustomKey{Header: "X-Api-Key", Value: "key"}},
+		{name: "query param", customKey: &CustomKey{QueryParam: "api_key", Value: "key"}},
+		{name: "no name", customKey: &CustomKey{Value: "key"}, err: true},
+		{name: "no value", customKey: &CustomKey{Header: "X-Api-Key"}, err: true},
+	} {
+		if err := tcase.customKey.validate(); tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	t.Run("validate", func(t *testing.T) {
+		for _, tcase := range []struct {
+			name    string
+			session *Session
+			err     bool
+		}{
+			{name: "nil"},
+			{name: "form", session: &Session{LoginURL: "/login", Form: map[string]string{"username": "user"}}},
+			{name: "body", session: &Session{LoginURL: "/login", Body: `{"username":"user"}`}},
+			{name: "no login url", session: &Session{Form: map[string]string{"username": "user"}}, err: true},
+			{
+				name:    "form and body",
+				session: &Session{LoginURL: "/login", Form: map[string]string{"username": "user"}, Body: "{}"},
+				err:     true,
+			},
+		} {
+			if err := tcase.session.validate(); tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+				t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+			}
+		}
+	})
+
+	t.Run("new client", func(t *testing.T) {
+		t.Setenv("GIDARI_TEST_SESSION_PASSWORD", "pass")
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/login" {
+				if r.PostFormValue("username") != "user" || r.PostFormValue("password") != "pass" {
+					w.WriteHeader(http.StatusUnauthorized)
+
+					return
+				}
+
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+
+				return
+			}
+
+			if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "s1" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		defer server.Close()
+
+		authentication := Authentication{Session: &Session{
+			LoginURL: "login",
+			Form:     map[string]string{"username": "user", "password": "${GIDARI_TEST_SESSION_PASSWORD}"},
+		}}
+
+		if err := authentication.expandEnv(); err != nil {
+			t.Fatalf("failed to expand authentication: %v", err)
+		}
+
+		rurl, _ := url.Parse(server.URL + "/api/")
+		cfg := &Config{RawURL: rurl.String(), URL: rurl, Logger: logrus.New(), Authentication: authentication}
+
+		client, err := cfg.newClient(context.Background(), http.DefaultTransport)
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+
+		rsp, err := web.Fetch(context.Background(), &web.FetchConfig{
+			C:           client,
+			Method:      http.MethodGet,
+			URL:         rurl,
+			RateLimiter: rate.NewLimiter(rate.Inf, 1),
+		})
+		if err != nil {
+			t.Fatalf("failed to fetch: %v", err)
+		}
+
+		rsp.Body.Close()
+	})
+}
+
+// roundTripperFunc is a transport that is a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestRegisteredAuth(t *testing.T) {
+	auth.Register("transport-test-hmac", func(_ context.Context, cfg auth.Config) (auth.Transport, error) {
+		key, _ := cfg.Params["key"].(string)
+		headers, _ := cfg.Params["headers"].(map[string]interface{})
+
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Key", key)
+			req.Header.Set("X-Key-Header", fmt.Sprint(headers["key"]))
+
+			return cfg.Base.RoundTrip(req)
+		}), nil
+	})
+
+	for _, tcase := range []struct {
+		name       string
+		registered *RegisteredAuth
+		err        bool
+	}{
+		{name: "nil"},
+		{name: "registered", registered: &RegisteredAuth{Name: "transport-test-hmac"}},
+		{name: "no name", registered: &RegisteredAuth{}, err: true},
+		{name: "unregistered", registered: &RegisteredAuth{Name: "transport-test-missing"}, err: true},
+	} {
+		if err := tcase.registered.validate(); tcase.err != errors.Is(err, ErrInvalidAuthentication) {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Key") != "secret" || r.Header.Get("X-Key-Header") != "X-Signature" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	t.Setenv("TRANSPORT_TEST_HMAC_KEY", "secret")
+
+	rurl, _ := url.Parse(server.URL)
+	cfg := &Config{
+		RawURL: server.URL,
+		URL:    rurl,
+		Logger: logrus.New(),
+		Authentication: Authentication{Registered: &RegisteredAuth{
+			Name: "transport-test-hmac",
+			Params: map[string]interface{}{
+				"key":     "${TRANSPORT_TEST_HMAC_KEY}",
+				"headers": map[interface{}]interface{}{"key": "X-Signature"},
+			},
+		}},
+	}
+
+	if err := cfg.Authentication.expandEnv(); err != nil {
+		t.Fatalf("failed to expand authentication: %v", err)
+	}
+
+	client, err := cfg.newClient(context.Background(), http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	rsp, err := web.Fetch(context.Background(), &web.FetchConfig{
+		C:           client,
+		Method:      http.MethodGet,
+		URL:         rurl,
+		RateLimiter: rate.NewLimiter(rate.Inf, 1),
+	})
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+
+	rsp.Body.Close()
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrInvalidUniverse is returned when a universe of the configuration is invalid.
+var ErrInvalidUniverse = fmt.Errorf("invalid universe")
+
+// InvalidUniverseError wraps an error with ErrInvalidUniverse.
+func InvalidUniverseError(name, msg string) error {
+	return fmt.Errorf("%w %q: %s", ErrInvalidUniverse, name, msg)
+}
+
+// Universe is the list of instruments of a web API, e.g. the products of an exchange, that the requests of the
+// configuration iterate over. The universe is a request of the run, which upserts the instruments into its table, and
+// the requests with a foreach of the universe are made for the symbol of every instrument:
+//
+//	universes:
+//	  products:
+//	    endpoint: /products
+//	    path: id
+//	    where:
+//	      quote_currency: USD
+//	requests:
+//	  - endpoint: /products/{{ .Each }}/candles
+//	    foreach:
+//	      universe: products
+type Universe struct {
+	// Request is the request of the instruments, e.g. its endpoint and table.
+	Request `yaml:",inline"`
+
+	// Path is the dot-separated path of the symbol in each instrument, the default is "id".
+	Path string `yaml:"path"`
+
+	// Where keeps only the symbols of the instruments whose fields have the values, e.g. {"status": "online"}. Every
+	// instrument is upserted into the table of the universe.
+	Where map[string]string `yaml:"where"`
+}
+
+// expandUniverses will add the request of every universe to the requests of the configuration, and set the foreach
+// of the requests that iterate over a universe to the table, path, and filter of the universe.
+func (cfg *Config) expandUniverses() error {
+	names := make([]string, 0, len(cfg.Universes))
+	for name := range cfg.Universes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		universe := cfg.Universes[name]
+		if universe == nil || universe.Endpoint == "" {
+			return InvalidUniverseError(name, "no endpoint")
+		}
+
+		if universe.Foreach != nil || universe.Sink != nil || len(universe.Split) > 0 {
+			return InvalidUniverseError(name, "a universe can not have a foreach, sink, or split")
+		}
+
+		req := universe.Request
+		if req.Table == "" {
+			req.Table = cfg.TableNaming.tableName(req.Endpoint)
+		}
+
+		universe.Table = req.Table
+		cfg.Requests = append(cfg.Requests, &req)
+	}
+
+	for _, req := range cfg.Requests {
+		if req.Foreach == nil || req.Foreach.Universe == "" {
+			continue
+		}
+
+		universe, ok := cfg.Universes[req.Foreach.Universe]
+		if !ok {
+			return InvalidForeachError(fmt.Sprintf("unknown universe %q", req.Foreach.Universe))
+		}
+
+		if req.Foreach.Table != "" || req.Foreach.Path != "" || len(req.Foreach.Where) > 0 {
+			return InvalidForeachError("a foreach of a universe can not have a table, path, or where")
+		}
+
+		foreach := *req.Foreach
+		foreach.Table = universe.Table
+		foreach.Path = universe.Path
+		foreach.Where = universe.Where
+		req.Foreach = &foreach
+	}
+
+	return nil
+}
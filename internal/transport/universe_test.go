@@ -0,0 +1,110 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUniverses(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := NewConfig([]byte(`
+url: https://api.test.com
+rateLimit:
+  burst: 1
+  period: 1s
+universes:
+  products:
+    endpoint: /products
+    where:
+      quote_currency: USD
+requests:
+  - endpoint: /products/{{ .Each }}/candles
+    table: candles
+    foreach:
+      universe: products
+`))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	if len(cfg.Requests) != 2 || cfg.Requests[1].Endpoint != "/products" || cfg.Requests[1].Table != "products" {
+		t.Fatalf("expected the request of the universe, got %+v", cfg.Requests)
+	}
+
+	foreach := cfg.Requests[0].Foreach
+	if foreach.Table != "products" || foreach.path() != "id" ||
+		!reflect.DeepEqual(foreach.Where, map[string]string{"quote_currency": "USD"}) {
+		t.Fatalf("unexpected foreach %+v", foreach)
+	}
+
+	values := newForeachValues(cfg.Requests)
+	if err := values.collect("products", []byte(`[{"id":"BTC-USD","quote_currency":"USD"},{"id":"BTC-EUR",`+
+		`"quote_currency":"EUR"},{"id":"ETH-USD","quote_currency":"USD"},{"id":"SOL-USD"}]`)); err != nil {
+		t.Fatalf("error collecting values: %v", err)
+	}
+
+	if symbols := values.get(foreach); !reflect.DeepEqual(symbols, []string{"BTC-USD", "ETH-USD"}) {
+		t.Fatalf("unexpected symbols %v", symbols)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		yaml string
+		err  error
+	}{
+		{
+			name: "no endpoint",
+			yaml: "universes:\n  products:\n    table: products\n",
+			err:  ErrInvalidUniverse,
+		},
+		{
+			name: "unknown universe",
+			yaml: "requests:\n  - endpoint: /candles\n    foreach:\n      universe: products\n",
+			err:  ErrInvalidForeach,
+		},
+		{
+			name: "universe and table",
+			yaml: "universes:\n  products:\n    endpoint: /products\n" +
+				"requests:\n  - endpoint: /candles\n    foreach:\n      universe: products\n      table: products\n",
+			err: ErrInvalidForeach,
+		},
+	} {
+		_, err := NewConfig([]byte("url: https://api.test.com\nrateLimit:\n  burst: 1\n  period: 1s\n" + tcase.yaml))
+		if !errors.Is(err, tcase.err) {
+			t.Fatalf("%s: expected error %v, got %v", tcase.name, tcase.err, err)
+		}
+	}
+}
+
+func TestUpsertUniverse(t *testing.T) {
+	t.Parallel()
+
+	// A universe of far more instruments than the requests of the configuration expands like a foreach request.
+	completed := upsertForeach(t, `
+rateLimit:
+  burst: 1000
+  period: 1s
+universes:
+  accounts:
+    endpoint: /accounts
+    where:
+      currency: USD
+requests:
+  - endpoint: /accounts/{{ .Each }}/ledger
+    table: ledger
+    foreach:
+      universe: accounts
+`, 500)
+	if completed != 500 {
+		t.Fatalf("expected 500 ledger requests to complete, got %d", completed)
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultVaultMount is the default mount path of the Kubernetes auth method of Vault.
+	defaultVaultMount = "kubernetes"
+
+	// vaultJWTFile is the service account token that is exchanged for a Vault token with the role.
+	vaultJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	// vaultTimeout is the timeout of the requests to Vault.
+	vaultTimeout = 30 * time.Second
+
+	// vaultRenewFraction is the fraction of a lease after which it is renewed.
+	vaultRenewFraction = 2.0 / 3.0
+)
+
+// ErrInvalidVault is returned when the Vault configuration is invalid.
+var ErrInvalidVault = fmt.Errorf("invalid vault")
+
+// InvalidVaultError wraps an error with ErrInvalidVault.
+func InvalidVaultError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidVault, msg)
+}
+
+// Vault resolves the credentials of the web API from a secret in HashiCorp Vault when the web clients are created,
+// instead of the configuration. The "key", "secret", and "passphrase" fields of the secret are the API key, and the
+// "bearer" field is the bearer token. The Vault token and the lease of the secret are renewed in the background, so
+// that they do not expire during long runs.
+type Vault struct {
+	// Address is the address of Vault, e.g. "https://vault.internal:8200". The default is the VAULT_ADDR
+	// environment variable.
+	Address string `yaml:"address"`
+
+	// Path is the path of the secret, e.g. "secret/data/coinbase" for a version 2 KV secrets engine.
+	Path string `yaml:"path"`
+
+	// Role is the role to log in with the Kubernetes auth method, using the token of the service account of the pod.
+	// If the role is empty, the VAULT_TOKEN environment variable is used.
+	Role string `yaml:"role"`
+
+	// Mount is the mount path of the Kubernetes auth method, the default is "kubernetes".
+	Mount string `yaml:"mount"`
+
+	session vaultSession
+}
+
+func (vault *Vault) validate() error {
+	if vault == nil {
+		return nil
+	}
+
+	if vault.Path == "" {
+		return InvalidVaultError("no path")
+	}
+
+	return nil
+}
+
+func (vault *Vault) address() string {
+	if vault.Address == "" {
+		return strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	}
+
+	return strings.TrimSuffix(vault.Address, "/")
+}
+
+func (vault *Vault) mount() string {
+	if vault.Mount == "" {
+		return defaultVaultMount
+	}
+
+	return vault.Mount
+}
+
+// vaultSession holds the token of a Vault and the lease of its secret, which are renewed while the runs of the
+// configuration use them.
+type vaultSession struct {
+	mutex sync.Mutex
+
+	// token is the Vault token, and tokenExpires is when it expires if it was issued by a login.
+	token        string
+	tokenExpires time.Time
+	renewable    bool
+
+	// leaseID and leaseDuration are the lease of the latest secret, if it has one.
+	leaseID       string
+	leaseDuration time.Duration
+
+	// renewing is true once the background renewal is started.
+	renewing bool
+}
+
+// vaultResponse is the response of the Vault API to a login, a read, or a renewal.
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// do will send a request to the Vault API and decode its response.
+func (vault *Vault) do(ctx context.Context, method, path, token string, body interface{}) (*vaultResponse, error) {
+	address := vault.address()
+	if address == "" {
+		return nil, InvalidVaultError("no address")
+	}
+
+	var reader io.Reader
+
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode vault request: %w", err)
+		}
+
+		reader = bytes.NewReader(encoded)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, address+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create vault request: %w", err)
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach vault: %w", err)
+	}
+
+	defer rsp.Body.Close()
+
+	var decoded vaultResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&decoded); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to decode vault response: %w", err)
+	}
+
+	if rsp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("vault %s %s failed with status %d: %s", method, path, rsp.StatusCode,
+			strings.Join(decoded.Errors, "; "))
+	}
+
+	return &decoded, nil
+}
+
+// login will return a Vault token, logging in with the role if the token of the session expired.
+func (vault *Vault) login(ctx context.Context) (string, error) {
+	if vault.Role == "" {
+		token := os.Getenv("VAULT_TOKEN")
+		if token == "" {
+			return "", InvalidVaultError("no role and no VAULT_TOKEN")
+		}
+
+		return token, nil
+	}
+
+	session := &vault.session
+	if session.token != "" && time.Now().Before(session.tokenExpires) {
+		return session.token, nil
+	}
+
+	jwt, err := os.ReadFile(vaultJWTFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read service account token: %w", err)
+	}
+
+	body := map[string]string{"role": vault.Role, "jwt": strings.TrimSpace(string(jwt))}
+
+	rsp, err := vault.do(ctx, http.MethodPost, "auth/"+vault.mount()+"/login", "", body)
+	if err != nil {
+		return "", err
+	}
+
+	if rsp.Auth == nil || rsp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login returned no token")
+	}
+
+	session.token = rsp.Auth.ClientToken
+	session.tokenExpires = time.Now().Add(time.Duration(rsp.Auth.LeaseDuration) * time.Second)
+	session.renewable = rsp.Auth.Renewable
+
+	return session.token, nil
+}
+
+// read will return the fields of the secret. The data of version 2 KV secrets is nested in a "data" field.
+func (vault *Vault) read(ctx context.Context, token string) (map[string]string, error) {
+	rsp, err := vault.do(ctx, http.MethodGet, vault.Path, token, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := rsp.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = nested
+	}
+
+	fields := make(map[string]string, len(data))
+
+	for key, value := range data {
+		if str, ok := value.(string); ok {
+			fields[key] = str
+		}
+	}
+
+	session := &vault.session
+	session.leaseID = ""
+	session.leaseDuration = 0
+
+	if rsp.LeaseID != "" && rsp.Renewable {
+		session.leaseID = rsp.LeaseID
+		session.leaseDuration = time.Duration(rsp.LeaseDuration) * time.Second
+	}
+
+	return fields, nil
+}
+
+// renewal will return the delay until the token or the lease of the session is renewed, or false if neither is
+// renewable.
+func (session *vaultSession) renewal() (time.Duration, bool) {
+	var delay time.Duration
+
+	if session.renewable && !session.tokenExpires.IsZero() {
+		delay = time.Duration(float64(time.Until(session.tokenExpires)) * vaultRenewFraction)
+	}
+
+	if session.leaseID != "" {
+		leaseDelay := time.Duration(float64(session.leaseDuration) * vaultRenewFraction)
+		if delay == 0 || leaseDelay < delay {
+			delay = leaseDelay
+		}
+	}
+
+	return delay, delay > 0
+}
+
+// renew will renew the token and the lease of the session until the context is canceled or they can not be renewed.
+func (vault *Vault) renew(ctx context.Context, logger *logrus.Logger) {
+	session := &vault.session
+
+	for {
+		session.mutex.Lock()
+		delay, ok := session.renewal()
+
+		if !ok {
+			session.renewing = false
+			session.mutex.Unlock()
+
+			return
+		}
+
+		session.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			session.mutex.Lock()
+			session.renewing = false
+			session.mutex.Unlock()
+
+			return
+		case <-time.After(delay):
+		}
+
+		if err := vault.renewOnce(ctx); err != nil {
+			tools.LogEvent{Msg: "unable to renew vault lease", Err: err}.Log(logger, logrus.WarnLevel)
+
+			session.mutex.Lock()
+			session.renewing = false
+			session.mutex.Unlock()
+
+			return
+		}
+	}
+}
+
+// renewOnce will renew the token and the lease of the session.
+func (vault *Vault) renewOnce(ctx context.Context) error {
+	session := &vault.session
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.renewable && !session.tokenExpires.IsZero() {
+		rsp, err := vault.do(ctx, http.MethodPost, "auth/token/renew-self", session.token, nil)
+		if err != nil {
+			return err
+		}
+
+		if rsp.Auth != nil {
+			session.tokenExpires = time.Now().Add(time.Duration(rsp.Auth.LeaseDuration) * time.Second)
+			session.renewable = rsp.Auth.Renewable
+		}
+	}
+
+	if session.leaseID != "" {
+		token := session.token
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+
+		body := map[string]string{"lease_id": session.leaseID}
+
+		rsp, err := vault.do(ctx, http.MethodPut, "sys/leases/renew", token, body)
+		if err != nil {
+			return err
+		}
+
+		session.leaseDuration = time.Duration(rsp.LeaseDuration) * time.Second
+		if !rsp.Renewable || session.leaseDuration == 0 {
+			session.leaseID = ""
+		}
+	}
+
+	return nil
+}
+
+// credentials will read the fields of the secret, and start renewing its lease and the token in the background until
+// the context is canceled.
+func (vault *Vault) credentials(ctx context.Context, logger *logrus.Logger) (map[string]string, error) {
+	session := &vault.session
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	token, err := vault.login(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to log in to vault: %w", err)
+	}
+
+	fields, err := vault.read(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vault secret %q: %w", vault.Path, err)
+	}
+
+	tools.LogEvent{Msg: "read credentials from vault secret", Path: vault.Path}.Log(logger, logrus.DebugLevel)
+
+	if _, ok := session.renewal(); ok && !session.renewing {
+		session.renewing = true
+
+		go vault.renew(ctx, logger)
+	}
+
+	return fields, nil
+}
+
+// withVaultFields will set the credentials of the authentication to the fields of its Vault secret. The credentials of
+// the configuration are kept for the fields that the secret does not have.
+func (authentication *Authentication) withVaultFields(fields map[string]string) {
+	if bearer, ok := fields["bearer"]; ok {
+		auth2 := Auth2{}
+		if authentication.Auth2 != nil {
+			auth2 = *authentication.Auth2
+		}
+
+		auth2.Bearer = bearer
+		authentication.Auth2 = &auth2
+	}
+
+	if _, ok := fields["key"]; ok {
+		apiKey := APIKey{}
+		if authentication.APIKey != nil {
+			apiKey = *authentication.APIKey
+		}
+
+		for name, dst := range map[string]*string{
+			"key":        &apiKey.Key,
+			"secret":     &apiKey.Secret,
+			"passphrase": &apiKey.Passphrase,
+		} {
+			if value, ok := fields[name]; ok {
+				*dst = value
+			}
+		}
+
+		authentication.APIKey = &apiKey
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestVaultResolve(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "root")
+
+	var renewals int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/exchange":
+			_, _ = w.Write([]byte(`{"data":{"data":{"key":"k","secret":"s","passphrase":"p"},"metadata":{}}}`))
+		case "/v1/secret/token":
+			_, _ = w.Write([]byte(`{"data":{"bearer":"b"}}`))
+		case "/v1/database/creds/api":
+			_, _ = w.Write([]byte(`{"lease_id":"database/creds/api/1","lease_duration":1,"renewable":true,` +
+				`"data":{"bearer":"leased"}}`))
+		case "/v1/sys/leases/renew":
+			atomic.AddInt32(&renewals, 1)
+			_, _ = w.Write([]byte(`{"lease_id":"database/creds/api/1","lease_duration":1,"renewable":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+
+	t.Run("api key of a kv version 2 secret", func(t *testing.T) {
+		authentication := &Authentication{
+			APIKey: &APIKey{ClockSync: &ClockSync{}},
+			Vault:  &Vault{Address: server.URL, Path: "secret/data/exchange"},
+		}
+
+		resolved, err := authentication.resolve(context.Background(), logger)
+		if err != nil {
+			t.Fatalf("error resolving authentication: %v", err)
+		}
+
+		apiKey := resolved.APIKey
+		if apiKey.Key != "k" || apiKey.Secret != "s" || apiKey.Passphrase != "p" || apiKey.ClockSync == nil {
+			t.Fatalf("unexpected api key: %+v", apiKey)
+		}
+
+		if authentication.APIKey.Key != "" {
+			t.Fatalf("expected the configuration to be unchanged")
+		}
+	})
+
+	t.Run("bearer of a kv version 1 secret", func(t *testing.T) {
+		authentication := &Authentication{Vault: &Vault{Address: server.URL, Path: "secret/token"}}
+
+		resolved, err := authentication.resolve(context.Background(), logger)
+		if err != nil {
+			t.Fatalf("error resolving authentication: %v", err)
+		}
+
+		if resolved.Auth2 == nil || resolved.Auth2.Bearer != "b" || resolved.APIKey != nil {
+			t.Fatalf("unexpected authentication: %+v", resolved)
+		}
+	})
+
+	t.Run("missing secret", func(t *testing.T) {
+		authentication := &Authentication{Vault: &Vault{Address: server.URL, Path: "secret/missing"}}
+
+		if _, err := authentication.resolve(context.Background(), logger); err == nil {
+			t.Fatalf("expected an error for a missing secret")
+		}
+	})
+
+	t.Run("renews the lease of the secret", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		authentication := &Authentication{Vault: &Vault{Address: server.URL, Path: "database/creds/api"}}
+
+		resolved, err := authentication.resolve(ctx, logger)
+		if err != nil {
+			t.Fatalf("error resolving authentication: %v", err)
+		}
+
+		if resolved.Auth2.Bearer != "leased" {
+			t.Fatalf("unexpected bearer: %s", resolved.Auth2.Bearer)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&renewals) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the lease to be renewed")
+			}
+
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+}
+
+func TestVaultValidate(t *testing.T) {
+	t.Parallel()
+
+	if err := (&Vault{Address: "http://localhost:8200"}).validate(); err == nil {
+		t.Fatalf("expected an error for a vault without a path")
+	}
+
+	if err := (&Vault{Path: "secret/data/exchange"}).validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultWebhookSignatureHeader, defaultWebhookTimestampHeader, and defaultWebhookEventIDHeader are the default
+	// headers of the signature, timestamp, and event ID of webhook deliveries.
+	defaultWebhookSignatureHeader = "X-Signature"
+	defaultWebhookTimestampHeader = "X-Timestamp"
+	defaultWebhookEventIDHeader   = "X-Event-Id"
+
+	// defaultWebhookTolerance is the default maximum age of a webhook delivery.
+	defaultWebhookTolerance = 5 * time.Minute
+
+	// defaultWebhookMaxBodySize is the default maximum size of the body of a webhook delivery, in bytes.
+	defaultWebhookMaxBodySize = 1 << 20
+
+	// webhookSignaturePrefix is the optional prefix of the signature header, e.g. "sha256=abc".
+	webhookSignaturePrefix = "sha256="
+)
+
+var (
+	// ErrInvalidSignature is returned when the signature of a webhook delivery does not match its body.
+	ErrInvalidSignature = fmt.Errorf("invalid webhook signature")
+
+	// ErrStaleDelivery is returned when the timestamp of a webhook delivery is outside of the tolerance.
+	ErrStaleDelivery = fmt.Errorf("stale webhook delivery")
+
+	// ErrMissingWebhookHeader is returned when a webhook delivery does not have a required header.
+	ErrMissingWebhookHeader = fmt.Errorf("missing webhook header")
+)
+
+// Webhook verifies that webhook deliveries are sent by the web API and are not replayed, before they are handled. A
+// delivery is accepted if its signature is the hex encoded HMAC-SHA256 of "<timestamp>.<body>" with the secret, its
+// timestamp is within the tolerance of the current time, and neither its event ID nor its signature has been delivered
+// before. The event ID is not signed, so a delivery that is replayed with another event ID is recognized by its
+// signature.
+type Webhook struct {
+	// Secret is the secret shared with the web API that signs the deliveries.
+	Secret string `yaml:"secret"`
+
+	// SignatureHeader is the header of the signature, the default is "X-Signature". The signature may be prefixed
+	// with "sha256=".
+	SignatureHeader string `yaml:"signatureHeader"`
+
+	// TimestampHeader is the header of the time the delivery was signed, in seconds since the unix epoch. The default
+	// is "X-Timestamp".
+	TimestampHeader string `yaml:"timestampHeader"`
+
+	// EventIDHeader is the header of the unique ID of the event, the default is "X-Event-Id". Redeliveries of an
+	// event have the same ID.
+	EventIDHeader string `yaml:"eventIdHeader"`
+
+	// Tolerance is the maximum difference between the timestamp of a delivery and the current time, the default is
+	// 5 minutes.
+	Tolerance time.Duration `yaml:"tolerance"`
+
+	// MaxBodySize is the maximum size of the body of a delivery in bytes, the default is 1 MiB. Larger deliveries
+	// are rejected before they are verified.
+	MaxBodySize int64 `yaml:"maxBodySize"`
+
+	once   sync.Once
+	events *webhookEvents
+}
+
+func (webhook *Webhook) header(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+
+	return name
+}
+
+func (webhook *Webhook) tolerance() time.Duration {
+	if webhook.Tolerance <= 0 {
+		return defaultWebhookTolerance
+	}
+
+	return webhook.Tolerance
+}
+
+func (webhook *Webhook) maxBodySize() int64 {
+	if webhook.MaxBodySize <= 0 {
+		return defaultWebhookMaxBodySize
+	}
+
+	return webhook.MaxBodySize
+}
+
+// sign will return the hex encoded signature of the body at the timestamp.
+func (webhook *Webhook) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify will verify the signature and timestamp of the delivery, returning the keys that identify it as delivered:
+// its event ID and its signature.
+func (webhook *Webhook) verify(header http.Header, body []byte, now time.Time) ([]string, error) {
+	signature := header.Get(webhook.header(webhook.SignatureHeader, defaultWebhookSignatureHeader))
+	timestamp := header.Get(webhook.header(webhook.TimestampHeader, defaultWebhookTimestampHeader))
+	eventID := header.Get(webhook.header(webhook.EventIDHeader, defaultWebhookEventIDHeader))
+
+	for _, required := range [][2]string{{"signature", signature}, {"timestamp", timestamp}, {"event ID", eventID}} {
+		if required[1] == "" {
+			return nil, fmt.Errorf("%w: %s", ErrMissingWebhookHeader, required[0])
+		}
+	}
+
+	signature = strings.TrimPrefix(signature, webhookSignaturePrefix)
+	if !hmac.Equal([]byte(signature), []byte(webhook.sign(timestamp, body))) {
+		return nil, ErrInvalidSignature
+	}
+
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timestamp %q", ErrStaleDelivery, timestamp)
+	}
+
+	age := now.Sub(time.Unix(sec, 0))
+	if age > webhook.tolerance() || -age > webhook.tolerance() {
+		return nil, fmt.Errorf("%w: signed %v ago", ErrStaleDelivery, age.Round(time.Second))
+	}
+
+	return []string{"event:" + eventID, "signature:" + signature}, nil
+}
+
+// Guard will return a handler that verifies deliveries before they are handled by the next handler. Forged and stale
+// deliveries are rejected as unauthorized, and deliveries larger than the maximum body size as too large. Replayed
+// deliveries are acknowledged without being handled, so that the web
+// API does not retry them, and deliveries of an event that is being handled are rejected as a conflict. If the next
+// handler does not respond with a success status, the event is forgotten so that it can be redelivered.
+func (webhook *Webhook) Guard(next http.Handler) http.Handler {
+	webhook.once.Do(func() {
+		// Deliveries older than the tolerance are rejected, so event IDs only need to be kept for twice the tolerance
+		// to cover timestamps in the future.
+		webhook.events = newWebhookEvents(2 * webhook.tolerance())
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhook.maxBodySize()))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "body is too large", http.StatusRequestEntityTooLarge)
+
+				return
+			}
+
+			http.Error(w, "unable to read body", http.StatusBadRequest)
+
+			return
+		}
+
+		now := time.Now()
+
+		keys, err := webhook.verify(r.Header, body, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+
+			return
+		}
+
+		switch webhook.events.begin(now, keys...) {
+		case webhookEventDone:
+			w.WriteHeader(http.StatusOK)
+
+			return
+		case webhookEventPending:
+			http.Error(w, "event is being handled", http.StatusConflict)
+
+			return
+		case webhookEventNew:
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(recorder, r)
+
+		webhook.events.end(recorder.status < http.StatusMultipleChoices, keys...)
+	})
+}
+
+// statusRecorder records the status of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// webhookEventState is the state of the deliveries of an event.
+type webhookEventState uint8
+
+const (
+	// webhookEventNew is an event that has not been delivered.
+	webhookEventNew webhookEventState = iota
+
+	// webhookEventPending is an event whose delivery is being handled.
+	webhookEventPending
+
+	// webhookEventDone is an event whose delivery has been handled.
+	webhookEventDone
+)
+
+// webhookEvent is an event that has been delivered.
+type webhookEvent struct {
+	seen time.Time
+	done bool
+}
+
+// webhookEvents are the keys of the deliveries that have been delivered, which are forgotten after the retention.
+type webhookEvents struct {
+	mutex     sync.Mutex
+	retention time.Duration
+	events    map[string]*webhookEvent
+}
+
+func newWebhookEvents(retention time.Duration) *webhookEvents {
+	return &webhookEvents{retention: retention, events: make(map[string]*webhookEvent)}
+}
+
+// begin will return the state of the delivery with the keys before it, and mark new deliveries as pending. A delivery
+// is done or pending if any of its keys is.
+func (events *webhookEvents) begin(now time.Time, keys ...string) webhookEventState {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	for id, event := range events.events {
+		if event.done && now.Sub(event.seen) > events.retention {
+			delete(events.events, id)
+		}
+	}
+
+	state := webhookEventNew
+
+	for _, key := range keys {
+		if event, ok := events.events[key]; ok {
+			if event.done {
+				return webhookEventDone
+			}
+
+			state = webhookEventPending
+		}
+	}
+
+	if state == webhookEventNew {
+		for _, key := range keys {
+			events.events[key] = &webhookEvent{seen: now}
+		}
+	}
+
+	return state
+}
+
+// end will mark the pending delivery as done if it was handled, or forget it so that it can be delivered again.
+func (events *webhookEvents) end(handled bool, keys ...string) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	for _, key := range keys {
+		if !handled {
+			delete(events.events, key)
+
+			continue
+		}
+
+		events.events[key].done = true
+	}
+}
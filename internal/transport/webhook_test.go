@@ -0,0 +1,127 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookGuard(t *testing.T) {
+	t.Parallel()
+
+	webhook := &Webhook{Secret: "secret", Tolerance: time.Minute}
+
+	var handled int32
+
+	guard := webhook.Guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+		}
+
+		// The handler fails deliveries of the "fail" event, which should be redelivered.
+		if strings.Contains(string(body), "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		atomic.AddInt32(&handled, 1)
+	}))
+
+	now := time.Now()
+
+	deliver := func(eventID, body string, signed time.Time, signature string) int {
+		timestamp := strconv.FormatInt(signed.Unix(), 10)
+		if signature == "" {
+			signature = webhookSignaturePrefix + webhook.sign(timestamp, []byte(body))
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		req.Header.Set("X-Signature", signature)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Event-Id", eventID)
+
+		rec := httptest.NewRecorder()
+		guard.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	for _, tcase := range []struct {
+		name      string
+		eventID   string
+		body      string
+		signed    time.Time
+		signature string
+		status    int
+		handled   int32
+	}{
+		{name: "delivery", eventID: "1", body: `{"id": 1}`, signed: now, status: http.StatusOK, handled: 1},
+		{name: "replay", eventID: "1", body: `{"id": 1}`, signed: now, status: http.StatusOK, handled: 1},
+		{name: "replay as new event", eventID: "7", body: `{"id": 1}`, signed: now, status: http.StatusOK, handled: 1},
+		{name: "forged", eventID: "2", body: `{"id": 2}`, signed: now, signature: "abc", status: 401, handled: 1},
+		{name: "stale", eventID: "3", body: `{"id": 3}`, signed: now.Add(-time.Hour), status: 401, handled: 1},
+		{name: "future", eventID: "4", body: `{"id": 4}`, signed: now.Add(time.Hour), status: 401, handled: 1},
+		{name: "failed", eventID: "5", body: `"fail"`, signed: now, status: 500, handled: 1},
+		{name: "redelivery", eventID: "5", body: `"fail"`, signed: now, status: 500, handled: 1},
+		{name: "new", eventID: "6", body: `{"id": 6}`, signed: now, status: http.StatusOK, handled: 2},
+	} {
+		if status := deliver(tcase.eventID, tcase.body, tcase.signed, tcase.signature); status != tcase.status {
+			t.Errorf("%s: expected status %d, got %d", tcase.name, tcase.status, status)
+		}
+
+		if count := atomic.LoadInt32(&handled); count != tcase.handled {
+			t.Errorf("%s: expected %d handled deliveries, got %d", tcase.name, tcase.handled, count)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	guard.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without headers, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	if status := deliver("8", strings.Repeat("a", defaultWebhookMaxBodySize+1), now, ""); status != 413 {
+		t.Errorf("expected status %d for a large body, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	t.Parallel()
+
+	events := newWebhookEvents(time.Minute)
+	now := time.Now()
+
+	if state := events.begin(now, "1", "a"); state != webhookEventNew {
+		t.Fatalf("expected a new event, got %v", state)
+	}
+
+	if state := events.begin(now, "1", "b"); state != webhookEventPending {
+		t.Fatalf("expected a pending event, got %v", state)
+	}
+
+	events.end(true, "1", "a")
+
+	if state := events.begin(now.Add(time.Second), "2", "a"); state != webhookEventDone {
+		t.Fatalf("expected a done event, got %v", state)
+	}
+
+	if state := events.begin(now.Add(2*time.Minute), "1", "a"); state != webhookEventNew {
+		t.Fatalf("expected the event to be forgotten after the retention, got %v", state)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// ErrInvalidWorkers is returned when the number of workers of an upsert operation is negative.
+var ErrInvalidWorkers = fmt.Errorf("invalid number of workers")
+
+// InvalidWorkersError wraps an error with ErrInvalidWorkers.
+func InvalidWorkersError(name string, workers int) error {
+	return fmt.Errorf("%w: %s is %d", ErrInvalidWorkers, name, workers)
+}
+
+// UpsertOption is an option of an upsert operation, which takes precedence over the configuration.
+type UpsertOption func(*upsertOptions)
+
+// upsertOptions are the options of an upsert operation.
+type upsertOptions struct {
+	webWorkers     int
+	storageWorkers int
+	decodeWorkers  int
+
+	// requests are the requests of the operation, in place of the requests of the configuration. Only the tables of
+	// the requests are truncated.
+	requests []*flattenedRequest
+
+	// pause pauses the web requests of the operation, e.g. the pause of a daemon.
+	pause *Pause
+}
+
+// WithWebWorkers will set the number of workers that make the web requests of the operation.
+func WithWebWorkers(workers int) UpsertOption {
+	return func(opts *upsertOptions) { opts.webWorkers = workers }
+}
+
+// WithStorageWorkers will set the number of workers that send the records of the operation to the repositories.
+func WithStorageWorkers(workers int) UpsertOption {
+	return func(opts *upsertOptions) { opts.storageWorkers = workers }
+}
+
+// WithDecodeWorkers will set the number of workers that decode the response bodies of the operation.
+func WithDecodeWorkers(workers int) UpsertOption {
+	return func(opts *upsertOptions) { opts.decodeWorkers = workers }
+}
+
+// withRequests will set the requests of the operation, e.g. the requests of the endpoints that changed since a poll.
+func withRequests(requests []*flattenedRequest) UpsertOption {
+	return func(opts *upsertOptions) { opts.requests = requests }
+}
+
+// newUpsertOptions will return the options of an upsert operation with the configuration, applying the options on top.
+// The number of workers that are not set is the number of CPUs.
+func newUpsertOptions(cfg *Config, options []UpsertOption) (*upsertOptions, error) {
+	opts := &upsertOptions{
+		webWorkers:     cfg.WebWorkers,
+		storageWorkers: cfg.StorageWorkers,
+		decodeWorkers:  cfg.DecodeWorkers,
+	}
+
+	for _, option := range options {
+		option(opts)
+	}
+
+	if opts.webWorkers < 0 {
+		return nil, InvalidWorkersError("webWorkers", opts.webWorkers)
+	}
+
+	if opts.storageWorkers < 0 {
+		return nil, InvalidWorkersError("storageWorkers", opts.storageWorkers)
+	}
+
+	if opts.decodeWorkers < 0 {
+		return nil, InvalidWorkersError("decodeWorkers", opts.decodeWorkers)
+	}
+
+	if opts.webWorkers == 0 {
+		opts.webWorkers = runtime.NumCPU()
+	}
+
+	if opts.storageWorkers == 0 {
+		opts.storageWorkers = runtime.NumCPU()
+	}
+
+	if opts.decodeWorkers == 0 {
+		opts.decodeWorkers = runtime.NumCPU()
+	}
+
+	return opts, nil
+}
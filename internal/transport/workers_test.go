@@ -0,0 +1,59 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package transport
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestUpsertOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name           string
+		cfg            *Config
+		options        []UpsertOption
+		webWorkers     int
+		storageWorkers int
+		decodeWorkers  int
+		err            error
+	}{
+		{"default", &Config{}, nil, runtime.NumCPU(), runtime.NumCPU(), runtime.NumCPU(), nil},
+		{"config", &Config{WebWorkers: 64, StorageWorkers: 2, DecodeWorkers: 1}, nil, 64, 2, 1, nil},
+		{
+			"options", &Config{WebWorkers: 64, StorageWorkers: 2, DecodeWorkers: 1},
+			[]UpsertOption{WithWebWorkers(8), WithStorageWorkers(1), WithDecodeWorkers(4)}, 8, 1, 4, nil,
+		},
+		{"negative config", &Config{WebWorkers: -1}, nil, 0, 0, 0, ErrInvalidWorkers},
+		{"negative option", &Config{}, []UpsertOption{WithStorageWorkers(-1)}, 0, 0, 0, ErrInvalidWorkers},
+		{"negative decode workers", &Config{DecodeWorkers: -1}, nil, 0, 0, 0, ErrInvalidWorkers},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts, err := newUpsertOptions(tcase.cfg, tcase.options)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if opts.webWorkers != tcase.webWorkers || opts.storageWorkers != tcase.storageWorkers ||
+				opts.decodeWorkers != tcase.decodeWorkers {
+				t.Fatalf("expected %d web, %d storage, and %d decode workers, got %d, %d, and %d", tcase.webWorkers,
+					tcase.storageWorkers, tcase.decodeWorkers, opts.webWorkers, opts.storageWorkers, opts.decodeWorkers)
+			}
+		})
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"time"
 
 	"github.com/alpine-hodler/gidari/tools"
 )
@@ -31,6 +30,8 @@ type APIKey struct {
 	passphrase string
 	secret     string
 	url        *url.URL
+	clock      *Clock
+	base       http.RoundTripper
 }
 
 // NewAPIKey will return an APIKey authentication transport.
@@ -59,6 +60,20 @@ func (auth *APIKey) SetSecret(secret string) *APIKey {
 	return auth
 }
 
+// SetClock will set the clock used to timestamp the request signatures.
+func (auth *APIKey) SetClock(clock *Clock) *APIKey {
+	auth.clock = clock
+
+	return auth
+}
+
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *APIKey) SetBase(base http.RoundTripper) *APIKey {
+	auth.base = base
+
+	return auth
+}
+
 // SetURL will set the key field on APIKey.
 func (auth *APIKey) SetURL(u string) *APIKey {
 	auth.url, _ = url.Parse(u)
@@ -73,7 +88,7 @@ func (auth *APIKey) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	var (
-		timestamp = strconv.FormatInt(time.Now().Unix(), apiKeyTimestampBase)
+		timestamp = strconv.FormatInt(auth.clock.Now().Unix(), apiKeyTimestampBase)
 		msg       = tools.NewHTTPMessage(req, timestamp)
 	)
 
@@ -91,10 +106,12 @@ func (auth *APIKey) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Add("cb-access-sign", sig)
 	req.Header.Add("cb-access-timestamp", timestamp)
 
-	rsp, err := http.DefaultTransport.RoundTrip(req)
+	rsp, err := roundTrip(auth.base, req)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
 
+	auth.clock.observe(rsp)
+
 	return rsp, nil
 }
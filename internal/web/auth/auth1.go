@@ -33,6 +33,7 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
@@ -43,7 +44,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 const (
@@ -59,6 +59,7 @@ const (
 	contentType                 = "Content-Type"
 	formContentType             = "application/x-www-form-urlencoded"
 	defaultOauthSignatureMethod = "HMAC-SHA1"
+	hmacSHA256SignatureMethod   = "HMAC-SHA256"
 	oauthConsumerKeyParam       = "oauth_consumer_key"
 	oauthNonceParam             = "oauth_nonce"
 	oauthSignatureParam         = "oauth_signature"
@@ -77,8 +78,17 @@ type Auth1 struct {
 	consumerKey       string
 	consumerSecret    string
 	url               *url.URL
+	clock             *Clock
+	base              http.RoundTripper
+	signatureMethod   string
 }
 
+// ErrUnsupportedSignatureMethod is returned when the OAuth1 signature method is not supported.
+var ErrUnsupportedSignatureMethod = fmt.Errorf("unsupported signature method")
+
+// OAuth1SignatureMethods are the supported OAuth1 signature methods, the default is "HMAC-SHA1".
+var OAuth1SignatureMethods = []string{defaultOauthSignatureMethod, hmacSHA256SignatureMethod}
+
 // NewAuth1 will return an OAuth1 http transpoauth.
 func NewAuth1() *Auth1 {
 	return new(Auth1)
@@ -98,15 +108,32 @@ func (auth *Auth1) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
-	rsp, err := http.DefaultTransport.RoundTrip(req)
+	rsp, err := roundTrip(auth.base, req)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", err, ErrRequestFailed)
 	}
 
+	auth.clock.observe(rsp)
+
 	return rsp, nil
 }
 
-// SetConsumerKey will set the consumerKey field on Auth1.
+// SetClock will set the clock used to timestamp the request signatures.
+func (auth *Auth1) SetClock(clock *Clock) *Auth1 {
+	auth.clock = clock
+
+	return auth
+}
+
+// SetSignatureMethod will set the method used to sign the requests, "HMAC-SHA1" or "HMAC-SHA256". The default is
+// "HMAC-SHA1".
+func (auth *Auth1) SetSignatureMethod(val string) *Auth1 {
+	auth.signatureMethod = val
+
+	return auth
+}
+
+// SetAccessToken will set the accessToken field on Auth1.
 func (auth *Auth1) SetAccessToken(val string) *Auth1 {
 	auth.accessToken = val
 
@@ -137,14 +164,28 @@ func (auth *Auth1) SetConsumerSecret(val string) *Auth1 {
 // setRequestAuthHeader sets the OAuth1 header for making authenticated requests with an AccessToken (token credential)
 // according to RFC 5849 3.1.
 func (auth *Auth1) setRequestAuthHeader(req *http.Request) error {
+	method, algo := defaultOauthSignatureMethod, sha1.New
+
+	switch auth.signatureMethod {
+	case "", defaultOauthSignatureMethod:
+	case hmacSHA256SignatureMethod:
+		method, algo = hmacSHA256SignatureMethod, sha256.New
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedSignatureMethod, auth.signatureMethod)
+	}
+
 	oauthParams := map[string]string{
 		oauthConsumerKeyParam:     auth.consumerKey,
-		oauthSignatureMethodParam: defaultOauthSignatureMethod,
-		oauthTimestampParam:       strconv.FormatInt(time.Now().Unix(), oathTimestampBase),
+		oauthSignatureMethodParam: method,
+		oauthTimestampParam:       strconv.FormatInt(auth.clock.Now().Unix(), oathTimestampBase),
 		oauthNonceParam:           nonce(),
 		oauthVersionParam:         oauthVersion1,
 	}
-	oauthParams[oautTParam] = auth.accessToken
+
+	// The token is omitted by two-legged requests, which are signed with only the consumer credentials.
+	if auth.accessToken != "" {
+		oauthParams[oautTParam] = auth.accessToken
+	}
 
 	params, err := collectParameters(req, oauthParams)
 	if err != nil {
@@ -152,13 +193,20 @@ func (auth *Auth1) setRequestAuthHeader(req *http.Request) error {
 	}
 
 	signatureBase := signatureBase(req, params)
-	signature := hmacSign(auth.consumerSecret, auth.accessTokenSecret, signatureBase, sha256.New)
+	signature := hmacSign(auth.consumerSecret, auth.accessTokenSecret, signatureBase, algo)
 	oauthParams[oauthSignatureParam] = signature
 	req.Header.Set(authorizationHeaderParam, authHeaderValue(oauthParams))
 
 	return nil
 }
 
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *Auth1) SetBase(base http.RoundTripper) *Auth1 {
+	auth.base = base
+
+	return auth
+}
+
 // SetURL will set the key field on APIKey.
 func (auth *Auth1) SetURL(u string) *Auth1 {
 	auth.url, _ = url.Parse(u)
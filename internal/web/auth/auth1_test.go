@@ -0,0 +1,117 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"crypto/sha1"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuth1Signature(t *testing.T) {
+	t.Parallel()
+
+	// The example of the Twitter documentation for creating a signature.
+	body := "status=Hello%20Ladies%20%2B%20Gentlemen%2C%20a%20signed%20OAuth%20request%21"
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.twitter.com/1.1/statuses/update.json?include_entities=true",
+		strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	req.Header.Set(contentType, formContentType)
+
+	params, err := collectParameters(req, map[string]string{
+		oauthConsumerKeyParam:     "xvz1evFS4wEEPTGEFPHBog",
+		oauthNonceParam:           "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg",
+		oauthSignatureMethodParam: defaultOauthSignatureMethod,
+		oauthTimestampParam:       "1318622958",
+		oautTParam:                "370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb",
+		oauthVersionParam:         oauthVersion1,
+	})
+	if err != nil {
+		t.Fatalf("failed to collect parameters: %v", err)
+	}
+
+	signature := hmacSign("kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE",
+		signatureBase(req, params), sha1.New)
+	if expected := "hCtSmYh+iHYCEqBWrE7C7hYmtUk="; signature != expected {
+		t.Fatalf("expected signature %q, got %q", expected, signature)
+	}
+}
+
+func TestAuth1RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name     string
+		method   string
+		token    string
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "default",
+			token:    "token",
+			expected: []string{`oauth_signature_method="HMAC-SHA1"`, `oauth_token="token"`},
+		},
+		{
+			name:     "hmac-sha256 two-legged",
+			method:   "HMAC-SHA256",
+			expected: []string{`oauth_signature_method="HMAC-SHA256"`},
+		},
+		{name: "unsupported", method: "RSA-SHA1", err: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var authorization string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get(authorizationHeaderParam)
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: NewAuth1().SetURL(server.URL).SetConsumerKey("key").
+				SetConsumerSecret("secret").SetAccessToken(tcase.token).SetAccessTokenSecret("token secret").
+				SetSignatureMethod(tcase.method)}
+
+			rsp, err := client.Get(server.URL + "/candles")
+			if tcase.err {
+				if !errors.Is(err, ErrUnsupportedSignatureMethod) {
+					t.Fatalf("expected an unsupported signature method error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to get candles: %v", err)
+			}
+
+			rsp.Body.Close()
+
+			expected := append([]string{`OAuth `, `oauth_consumer_key="key"`, `oauth_signature="`}, tcase.expected...)
+			for _, part := range expected {
+				if !strings.Contains(authorization, part) {
+					t.Fatalf("expected %q in the authorization %q", part, authorization)
+				}
+			}
+
+			if tcase.token == "" && strings.Contains(authorization, oautTParam) {
+				t.Fatalf("expected no token in the authorization %q", authorization)
+			}
+		})
+	}
+}
@@ -8,15 +8,44 @@
 package auth
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
+// tokenExpiryDelta is how long before its expiry a token of the client credentials flow is refreshed, so that it does
+// not expire while a request is in flight.
+const tokenExpiryDelta = 30 * time.Second
+
+// ErrTokenRequestFailed is returned when a token can not be fetched with the client credentials flow.
+var ErrTokenRequestFailed = fmt.Errorf("token request failed")
+
+// TokenRequestError wraps an error with ErrTokenRequestFailed.
+func TokenRequestError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrTokenRequestFailed, msg)
+}
+
 // Auth2 is an OAuth2 http transport.
 type Auth2 struct {
 	bearer string
 	url    *url.URL
+	base   http.RoundTripper
+
+	// tokenURL, clientID, clientSecret, and scopes are the client credentials flow, which fetches the bearer from the
+	// token URL instead of using a static bearer.
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	// mutex guards the bearer and its expiry, which are cached until the bearer expires.
+	mutex  sync.Mutex
+	expiry time.Time
 }
 
 // NewAuth2 will return an OAuth2 http transport.
@@ -31,6 +60,24 @@ func (auth *Auth2) SetBearer(val string) *Auth2 {
 	return auth
 }
 
+// SetClientCredentials will set the transport to fetch its bearer from the token URL with the OAuth2 client
+// credentials flow. The bearer is cached and fetched again shortly before it expires.
+func (auth *Auth2) SetClientCredentials(tokenURL, clientID, clientSecret string, scopes []string) *Auth2 {
+	auth.tokenURL = tokenURL
+	auth.clientID = clientID
+	auth.clientSecret = clientSecret
+	auth.scopes = scopes
+
+	return auth
+}
+
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *Auth2) SetBase(base http.RoundTripper) *Auth2 {
+	auth.base = base
+
+	return auth
+}
+
 // SetURL will set the key field on APIKey.
 func (auth *Auth2) SetURL(u string) *Auth2 {
 	auth.url, _ = url.Parse(u)
@@ -44,14 +91,108 @@ func (auth *Auth2) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, ErrURLRequired
 	}
 
+	bearer, err := auth.token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
 	req.URL.Scheme = auth.url.Scheme
 	req.URL.Host = auth.url.Host
-	req.Header.Set(authorizationHeaderParam, fmt.Sprintf("%s %s", bearerHeaderPrefix, auth.bearer))
+	req.Header.Set(authorizationHeaderParam, fmt.Sprintf("%s %s", bearerHeaderPrefix, bearer))
 
-	rsp, err := http.DefaultTransport.RoundTrip(req)
+	rsp, err := roundTrip(auth.base, req)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
 	}
 
 	return rsp, nil
 }
+
+// Refresh will discard the bearer of the client credentials flow, so that the next request fetches a new bearer from
+// the token URL. A static bearer can not be refreshed.
+func (auth *Auth2) Refresh() bool {
+	if auth.tokenURL == "" {
+		return false
+	}
+
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	auth.bearer = ""
+	auth.expiry = time.Time{}
+
+	return true
+}
+
+// token will return the bearer of the transport. With the client credentials flow, the cached bearer is returned
+// until it is about to expire, then a new bearer is fetched from the token URL.
+func (auth *Auth2) token(ctx context.Context) (string, error) {
+	if auth.tokenURL == "" {
+		return auth.bearer, nil
+	}
+
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	if auth.bearer != "" && (auth.expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(auth.expiry)) {
+		return auth.bearer, nil
+	}
+
+	bearer, expiresIn, err := auth.fetchToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	auth.bearer = bearer
+	auth.expiry = time.Time{}
+
+	if expiresIn > 0 {
+		auth.expiry = time.Now().Add(expiresIn)
+	}
+
+	return bearer, nil
+}
+
+// fetchToken will request a bearer from the token URL with the client credentials grant, authenticating the client
+// with HTTP basic authentication. It returns the bearer and how long it is valid, which is zero if the token URL does
+// not say.
+func (auth *Auth2) fetchToken(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(auth.scopes) > 0 {
+		form.Set("scope", strings.Join(auth.scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, auth.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, TokenRequestError(err.Error())
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(auth.clientID), url.QueryEscape(auth.clientSecret))
+
+	rsp, err := roundTrip(auth.base, req)
+	if err != nil {
+		return "", 0, TokenRequestError(err.Error())
+	}
+
+	defer rsp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.NewDecoder(rsp.Body).Decode(&token); err != nil {
+		return "", 0, TokenRequestError(fmt.Sprintf("unable to decode response with status %d: %v", rsp.StatusCode, err))
+	}
+
+	if rsp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", 0, TokenRequestError(fmt.Sprintf("status %d: %s %s", rsp.StatusCode, token.Error,
+			token.ErrorDescription))
+	}
+
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuth2ClientCredentials(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name      string
+		expiresIn int
+		tokens    int32
+	}{
+		{name: "cached", expiresIn: 3600, tokens: 1},
+		{name: "no expiry", expiresIn: 0, tokens: 1},
+		{name: "refreshed", expiresIn: 1, tokens: 3},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var tokens int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" {
+					id, secret, _ := r.BasicAuth()
+					if id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" ||
+						r.FormValue("scope") != "read write" {
+						w.WriteHeader(http.StatusUnauthorized)
+						_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+
+						return
+					}
+
+					count := atomic.AddInt32(&tokens, 1)
+					_, _ = fmt.Fprintf(w, `{"access_token":"token%d","expires_in":%d}`, count, tcase.expiresIn)
+
+					return
+				}
+
+				if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token%d", atomic.LoadInt32(&tokens)) {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: NewAuth2().SetURL(server.URL).
+				SetClientCredentials(server.URL+"/token", "client", "secret", []string{"read", "write"})}
+
+			for i := 0; i < 3; i++ {
+				rsp, err := client.Get(server.URL + "/candles")
+				if err != nil {
+					t.Fatalf("failed to get candles: %v", err)
+				}
+
+				rsp.Body.Close()
+
+				if rsp.StatusCode != http.StatusOK {
+					t.Fatalf("expected status 200, got %d", rsp.StatusCode)
+				}
+			}
+
+			if tokens != tcase.tokens {
+				t.Fatalf("expected %d token requests, got %d", tcase.tokens, tokens)
+			}
+		})
+	}
+}
+
+func TestAuth2ClientCredentialsError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewAuth2().SetURL(server.URL).
+		SetClientCredentials(server.URL+"/token", "client", "wrong", nil)}
+
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrTokenRequestFailed) {
+		t.Fatalf("expected a token request error, got %v", err)
+	}
+}
+
+func TestAuth2Refresh(t *testing.T) {
+	t.Parallel()
+
+	if NewAuth2().SetBearer("static").Refresh() {
+		t.Fatalf("expected a static bearer not to be refreshed")
+	}
+
+	var tokens int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := atomic.AddInt32(&tokens, 1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"token%d","expires_in":3600}`, count)
+	}))
+	defer server.Close()
+
+	transport := NewAuth2().SetURL(server.URL).SetClientCredentials(server.URL+"/token", "client", "secret", nil)
+
+	for _, expected := range []string{"token1", "token2"} {
+		bearer, err := transport.token(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get token: %v", err)
+		}
+
+		if bearer != expected {
+			t.Fatalf("expected bearer %q, got %q", expected, bearer)
+		}
+
+		if !transport.Refresh() {
+			t.Fatalf("expected the client credentials to be refreshed")
+		}
+	}
+}
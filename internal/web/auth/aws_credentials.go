@@ -0,0 +1,326 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// awsCredentialsExpiryDelta is how long before their expiry temporary credentials are retrieved again.
+	awsCredentialsExpiryDelta = 5 * time.Minute
+
+	// awsMetadataTimeout is the timeout of the requests to the container and instance metadata endpoints, which are
+	// not reachable outside of AWS.
+	awsMetadataTimeout = 2 * time.Second
+
+	// awsContainerEndpoint is the host of the credentials endpoint of ECS tasks.
+	awsContainerEndpoint = "http://169.254.170.2"
+
+	// awsInstanceEndpoint is the host of the instance metadata service of EC2.
+	awsInstanceEndpoint = "http://169.254.169.254"
+
+	// awsInstanceTokenTTL is the lifetime of the session tokens of the instance metadata service, in seconds.
+	awsInstanceTokenTTL = "21600"
+)
+
+// ErrNoAWSCredentials is returned when no provider of the credentials chain has AWS credentials.
+var ErrNoAWSCredentials = fmt.Errorf("no AWS credentials")
+
+// NoAWSCredentialsError wraps an error with ErrNoAWSCredentials.
+func NoAWSCredentialsError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrNoAWSCredentials, msg)
+}
+
+// AWSCredentialsChain retrieves AWS credentials like the AWS SDKs do, from the first of these providers that has them:
+//
+//  1. the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN environment variables.
+//  2. the profile of the shared credentials file, which is AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials.
+//  3. the credentials endpoint of an ECS task.
+//  4. the role of an EC2 instance, from the instance metadata service.
+//
+// The credentials are cached, and temporary credentials are retrieved again shortly before they expire.
+type AWSCredentialsChain struct {
+	profile string
+	client  *http.Client
+
+	mutex  sync.Mutex
+	creds  *AWSCredentials
+	expiry time.Time
+}
+
+// NewAWSCredentialsChain will return a credentials chain that reads the profile of the shared credentials file. If the
+// profile is empty, the AWS_PROFILE environment variable or "default" is used.
+func NewAWSCredentialsChain(profile string) *AWSCredentialsChain {
+	return &AWSCredentialsChain{profile: profile, client: &http.Client{Timeout: awsMetadataTimeout}}
+}
+
+// Retrieve will return the credentials of the first provider of the chain that has them.
+func (chain *AWSCredentialsChain) Retrieve(ctx context.Context) (AWSCredentials, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	if chain.creds != nil && (chain.expiry.IsZero() || time.Now().Add(awsCredentialsExpiryDelta).Before(chain.expiry)) {
+		return *chain.creds, nil
+	}
+
+	providers := []func(context.Context) (*AWSCredentials, time.Time, error){
+		chain.fromEnv,
+		chain.fromSharedFile,
+		chain.fromContainer,
+		chain.fromInstance,
+	}
+
+	for _, provider := range providers {
+		creds, expiry, err := provider(ctx)
+		if err != nil {
+			return AWSCredentials{}, err
+		}
+
+		if creds != nil {
+			chain.creds, chain.expiry = creds, expiry
+
+			return *creds, nil
+		}
+	}
+
+	return AWSCredentials{}, NoAWSCredentialsError("set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a profile, or a role")
+}
+
+// Refresh will discard the cached credentials, so that the next request retrieves them from the chain again.
+func (chain *AWSCredentialsChain) Refresh() bool {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	chain.creds = nil
+	chain.expiry = time.Time{}
+
+	return true
+}
+
+func (chain *AWSCredentialsChain) fromEnv(context.Context) (*AWSCredentials, time.Time, error) {
+	creds := &AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, time.Time{}, nil
+	}
+
+	return creds, time.Time{}, nil
+}
+
+// fromSharedFile will read the credentials of the profile from the shared credentials file, which is an INI file with
+// a section for every profile.
+func (chain *AWSCredentialsChain) fromSharedFile(context.Context) (*AWSCredentials, time.Time, error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if home, err := os.UserHomeDir(); path == "" && err == nil {
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	if path == "" {
+		return nil, time.Time{}, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to open %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	profile := chain.profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+
+	if profile == "" {
+		profile = "default"
+	}
+
+	var (
+		creds   AWSCredentials
+		section string
+	)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, time.Time{}, nil
+	}
+
+	return &creds, time.Time{}, nil
+}
+
+// awsTemporaryCredentials are the credentials of the container and instance metadata endpoints.
+type awsTemporaryCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// fromContainer will retrieve the credentials of the role of an ECS task, if the process runs in one.
+func (chain *AWSCredentialsChain) fromContainer(ctx context.Context) (*AWSCredentials, time.Time, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = awsContainerEndpoint + relative
+	}
+
+	if endpoint == "" {
+		return nil, time.Time{}, nil
+	}
+
+	header := http.Header{}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		header.Set("Authorization", token)
+	}
+
+	body, err := chain.get(ctx, http.MethodGet, endpoint, header)
+	if err != nil {
+		return nil, time.Time{}, NoAWSCredentialsError(fmt.Sprintf("container credentials: %v", err))
+	}
+
+	return decodeTemporaryCredentials(body)
+}
+
+// fromInstance will retrieve the credentials of the role of the EC2 instance with the instance metadata service v2.
+// The service is not used if AWS_EC2_METADATA_DISABLED is "true", or if it is not reachable.
+func (chain *AWSCredentialsChain) fromInstance(ctx context.Context) (*AWSCredentials, time.Time, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, time.Time{}, nil
+	}
+
+	endpoint := strings.TrimSuffix(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = awsInstanceEndpoint
+	}
+
+	// If there is no session token, the process does not run on an EC2 instance.
+	token, ok := chain.instanceToken(ctx, endpoint)
+	if !ok {
+		return nil, time.Time{}, nil
+	}
+
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+	rolesURL := endpoint + "/latest/meta-data/iam/security-credentials/"
+
+	roles, err := chain.get(ctx, http.MethodGet, rolesURL, header)
+	if err != nil {
+		return nil, time.Time{}, NoAWSCredentialsError(fmt.Sprintf("instance role: %v", err))
+	}
+
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if role == "" {
+		return nil, time.Time{}, nil
+	}
+
+	body, err := chain.get(ctx, http.MethodGet, rolesURL+role, header)
+	if err != nil {
+		return nil, time.Time{}, NoAWSCredentialsError(fmt.Sprintf("instance credentials: %v", err))
+	}
+
+	return decodeTemporaryCredentials(body)
+}
+
+// instanceToken will return a session token of the instance metadata service, or false if it is not reachable.
+func (chain *AWSCredentialsChain) instanceToken(ctx context.Context, endpoint string) (string, bool) {
+	token, err := chain.get(ctx, http.MethodPut, endpoint+"/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {awsInstanceTokenTTL}})
+
+	return string(token), err == nil
+}
+
+func decodeTemporaryCredentials(body []byte) (*AWSCredentials, time.Time, error) {
+	var temporary awsTemporaryCredentials
+	if err := json.Unmarshal(body, &temporary); err != nil {
+		return nil, time.Time{}, NoAWSCredentialsError(fmt.Sprintf("unable to decode credentials: %v", err))
+	}
+
+	return &AWSCredentials{
+		AccessKeyID:     temporary.AccessKeyID,
+		SecretAccessKey: temporary.SecretAccessKey,
+		SessionToken:    temporary.Token,
+	}, temporary.Expiration, nil
+}
+
+// get will return the body of a request to a metadata endpoint.
+func (chain *AWSCredentialsChain) get(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req.Header = header
+
+	rsp, err := chain.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach %s: %w", url, err)
+	}
+
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d from %s", rsp.StatusCode, url)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// metadataServer is a container credentials endpoint and an instance metadata service.
+func metadataServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	creds := `{"AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"token","Expiration":"` + expiration + `"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/container" && r.Header.Get("Authorization") == "container-token":
+			_, _ = w.Write([]byte(creds))
+		case r.URL.Path == "/latest/api/token" && r.Method == http.MethodPut:
+			_, _ = w.Write([]byte("imds-token"))
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("role\n"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/role":
+			_, _ = w.Write([]byte(creds))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestAWSCredentialsChain(t *testing.T) {
+	server := metadataServer(t)
+
+	file := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(file, []byte("[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = s1\n\n"+
+		"[prod]\naws_access_key_id=AKIDPROD\naws_secret_access_key=s2\naws_session_token=t2\n"), 0o600); err != nil {
+		t.Fatalf("failed to write credentials: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		profile  string
+		env      map[string]string
+		expected AWSCredentials
+		err      error
+	}{
+		{
+			name:     "env",
+			env:      map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "s"},
+			expected: AWSCredentials{AccessKeyID: "AKIDENV", SecretAccessKey: "s"},
+		},
+		{
+			name:     "default profile",
+			env:      map[string]string{"AWS_SHARED_CREDENTIALS_FILE": file},
+			expected: AWSCredentials{AccessKeyID: "AKIDDEFAULT", SecretAccessKey: "s1"},
+		},
+		{
+			name:     "profile",
+			profile:  "prod",
+			env:      map[string]string{"AWS_SHARED_CREDENTIALS_FILE": file},
+			expected: AWSCredentials{AccessKeyID: "AKIDPROD", SecretAccessKey: "s2", SessionToken: "t2"},
+		},
+		{
+			name: "container",
+			env: map[string]string{
+				"AWS_CONTAINER_CREDENTIALS_FULL_URI": server.URL + "/container",
+				"AWS_CONTAINER_AUTHORIZATION_TOKEN":  "container-token",
+			},
+			expected: AWSCredentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", SessionToken: "token"},
+		},
+		{
+			name: "instance",
+			env: map[string]string{
+				"AWS_EC2_METADATA_DISABLED":         "false",
+				"AWS_EC2_METADATA_SERVICE_ENDPOINT": server.URL,
+			},
+			expected: AWSCredentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", SessionToken: "token"},
+		},
+		{name: "none", err: ErrNoAWSCredentials},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			for _, name := range []string{
+				"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+				"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+			} {
+				t.Setenv(name, "")
+			}
+
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "missing"))
+			t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+			for name, value := range tcase.env {
+				t.Setenv(name, value)
+			}
+
+			creds, err := NewAWSCredentialsChain(tcase.profile).Retrieve(context.Background())
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if creds != tcase.expected {
+				t.Fatalf("expected credentials %+v, got %+v", tcase.expected, creds)
+			}
+		})
+	}
+}
@@ -13,9 +13,11 @@ import (
 	"net/url"
 )
 
+// Basic is an http transport that authorizes requests with HTTP Basic authentication.
 type Basic struct {
 	email, password string
 	url             *url.URL
+	base            http.RoundTripper
 }
 
 // NewBasic will return an Basic http transport.
@@ -37,6 +39,13 @@ func (auth *Basic) SetPassword(val string) *Basic {
 	return auth
 }
 
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *Basic) SetBase(base http.RoundTripper) *Basic {
+	auth.base = base
+
+	return auth
+}
+
 // SetURL will set the key field on Basic.
 func (auth *Basic) SetURL(val string) *Basic {
 	auth.url, _ = url.Parse(val)
@@ -44,7 +53,7 @@ func (auth *Basic) SetURL(val string) *Basic {
 	return auth
 }
 
-// RoundTrip authorizes the request with a signed OAuth1 Authorization header using the author and TokenSource.
+// RoundTrip authorizes the request with a Basic Authorization header of the email and password.
 func (auth *Basic) RoundTrip(req *http.Request) (*http.Response, error) {
 	if auth.url == nil {
 		return nil, ErrURLRequired
@@ -54,7 +63,7 @@ func (auth *Basic) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.URL.Host = auth.url.Host
 	req.SetBasicAuth(auth.email, auth.password)
 
-	rsp, err := http.DefaultTransport.RoundTrip(req)
+	rsp, err := roundTrip(auth.base, req)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", ErrRequestFailed, err)
 	}
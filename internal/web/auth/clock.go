@@ -0,0 +1,155 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+// clockRoundTripDivisor is used to estimate the moment during a round trip that the server recorded its time.
+const clockRoundTripDivisor = 2
+
+var (
+	// ErrClockSync is returned when the clock is unable to synchronize with the server time.
+	ErrClockSync = fmt.Errorf("unable to sync clock")
+
+	// ErrUnsupportedServerTime is returned when the server time is not a number or a string.
+	ErrUnsupportedServerTime = fmt.Errorf("unsupported server time")
+)
+
+// ClockSyncError wraps an error with ErrClockSync.
+func ClockSyncError(err error) error {
+	return fmt.Errorf("%w: %v", ErrClockSync, err)
+}
+
+// Clock is the source of time for the timestamps embedded in request signatures. A clock can be synchronized with
+// the server time of a web API so that requests do not fail when the local clock drifts beyond the tolerance of the
+// API.
+type Clock struct {
+	// offset is the server time minus the local time in nanoseconds.
+	offset int64
+
+	// syncDate will update the offset using the "Date" header of every response.
+	syncDate bool
+}
+
+// NewClock will return a clock with no offset from the local time.
+func NewClock() *Clock {
+	return new(Clock)
+}
+
+// SetSyncDate will set the clock to synchronize with the "Date" header of every response observed by the transport.
+func (clock *Clock) SetSyncDate(val bool) *Clock {
+	clock.syncDate = val
+
+	return clock
+}
+
+// Now will return the current time adjusted by the server offset. A nil clock will return the local time.
+func (clock *Clock) Now() time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+
+	return time.Now().Add(clock.Offset())
+}
+
+// Offset is the duration between the server time and the local time.
+func (clock *Clock) Offset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&clock.offset))
+}
+
+// setOffset will set the offset between the server time and the local time.
+func (clock *Clock) setOffset(offset time.Duration) {
+	atomic.StoreInt64(&clock.offset, int64(offset))
+}
+
+// observe will update the offset from the "Date" header of the response if the clock is set to sync with it. Since
+// the "Date" header has a resolution of one second, the offset is only updated when it changes by more than a second.
+func (clock *Clock) observe(rsp *http.Response) {
+	if clock == nil || !clock.syncDate || rsp == nil {
+		return
+	}
+
+	date, err := http.ParseTime(rsp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	offset := time.Until(date)
+	if math.Abs(float64(offset-clock.Offset())) > float64(time.Second) {
+		clock.setOffset(offset)
+	}
+}
+
+// Sync will synchronize the clock with the server time returned by a time endpoint. The field is the dot-separated
+// path to the server time in the JSON response, which may be a number of seconds since the unix epoch or an RFC3339
+// string. If the field is empty, the "Date" header of the response is used.
+func (clock *Clock) Sync(ctx context.Context, client *http.Client, uri, field string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return ClockSyncError(err)
+	}
+
+	start := time.Now()
+
+	rsp, err := client.Do(req)
+	if err != nil {
+		return ClockSyncError(err)
+	}
+	defer rsp.Body.Close()
+
+	// Assume that the server time was recorded half way through the round trip.
+	local := start.Add(time.Since(start) / clockRoundTripDivisor)
+
+	serverTime, err := parseServerTime(rsp, field)
+	if err != nil {
+		return ClockSyncError(err)
+	}
+
+	clock.setOffset(serverTime.Sub(local))
+
+	return nil
+}
+
+// parseServerTime will parse the server time from the response.
+func parseServerTime(rsp *http.Response, field string) (time.Time, error) {
+	if field == "" {
+		date, err := http.ParseTime(rsp.Header.Get("Date"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to parse date header: %w", err)
+		}
+
+		return date, nil
+	}
+
+	var body interface{}
+	if err := json.NewDecoder(rsp.Body).Decode(&body); err != nil {
+		return time.Time{}, fmt.Errorf("unable to decode response: %w", err)
+	}
+
+	val, err := tools.LookupJSONPath(body, field)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to find server time: %w", err)
+	}
+
+	serverTime, err := tools.ParseJSONTime(val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrUnsupportedServerTime, err)
+	}
+
+	return serverTime, nil
+}
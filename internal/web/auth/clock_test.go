@@ -0,0 +1,92 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const clockTestSkew = 2 * time.Minute
+
+func newClockTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverTime := time.Now().Add(clockTestSkew)
+
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+
+		switch r.URL.Path {
+		case "/epoch":
+			fmt.Fprintf(w, `{"data":{"epoch":%d.5}}`, serverTime.Unix())
+		case "/iso":
+			fmt.Fprintf(w, `{"iso":%q}`, serverTime.Format(time.RFC3339Nano))
+		}
+	}))
+}
+
+func TestClock(t *testing.T) {
+	t.Parallel()
+
+	testServer := newClockTestServer()
+	t.Cleanup(testServer.Close)
+
+	for _, tcase := range []struct {
+		name, path, field string
+	}{
+		{name: "epoch field", path: "/epoch", field: "data.epoch"},
+		{name: "iso field", path: "/iso", field: "iso"},
+		{name: "date header", path: "/epoch"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := NewClock()
+			if err := clock.Sync(context.Background(), testServer.Client(), testServer.URL+tcase.path,
+				tcase.field); err != nil {
+				t.Fatalf("failed to sync clock: %v", err)
+			}
+
+			if drift := clock.Offset() - clockTestSkew; drift < -2*time.Second || drift > 2*time.Second {
+				t.Fatalf("expected an offset of about %v, got %v", clockTestSkew, clock.Offset())
+			}
+		})
+	}
+
+	t.Run("observe date header", func(t *testing.T) {
+		t.Parallel()
+
+		clock := NewClock().SetSyncDate(true)
+
+		rsp, err := testServer.Client().Get(testServer.URL)
+		if err != nil {
+			t.Fatalf("failed to make request: %v", err)
+		}
+		defer rsp.Body.Close()
+
+		clock.observe(rsp)
+
+		if drift := clock.Offset() - clockTestSkew; drift < -2*time.Second || drift > 2*time.Second {
+			t.Fatalf("expected an offset of about %v, got %v", clockTestSkew, clock.Offset())
+		}
+	})
+
+	t.Run("nil clock", func(t *testing.T) {
+		t.Parallel()
+
+		var clock *Clock
+		if time.Since(clock.Now()) > time.Second {
+			t.Fatalf("expected a nil clock to use the local time")
+		}
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// CustomKey is an http transport that authorizes requests with an API key in a header or a query parameter, e.g.
+// "X-Api-Key: <key>" or "?api_key=<key>", for web APIs that do not sign their requests.
+type CustomKey struct {
+	header, queryParam, value string
+	url                       *url.URL
+	base                      http.RoundTripper
+}
+
+// NewCustomKey will return a CustomKey http transport.
+func NewCustomKey() *CustomKey {
+	return new(CustomKey)
+}
+
+// SetHeader will set the name of the header of the key.
+func (auth *CustomKey) SetHeader(name string) *CustomKey {
+	auth.header = name
+
+	return auth
+}
+
+// SetQueryParam will set the name of the query parameter of the key.
+func (auth *CustomKey) SetQueryParam(name string) *CustomKey {
+	auth.queryParam = name
+
+	return auth
+}
+
+// SetValue will set the key.
+func (auth *CustomKey) SetValue(val string) *CustomKey {
+	auth.value = val
+
+	return auth
+}
+
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *CustomKey) SetBase(base http.RoundTripper) *CustomKey {
+	auth.base = base
+
+	return auth
+}
+
+// SetURL will set the URL of the web API.
+func (auth *CustomKey) SetURL(u string) *CustomKey {
+	auth.url, _ = url.Parse(u)
+
+	return auth
+}
+
+// RoundTrip authorizes the request with the key in its header and its query parameter, whichever are set.
+func (auth *CustomKey) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth.url == nil {
+		return nil, ErrURLRequired
+	}
+
+	// The key is set on a copy of the request, so that the URL of the request does not leak the key into the errors
+	// and logs of its caller.
+	req = req.Clone(req.Context())
+	req.URL.Scheme = auth.url.Scheme
+	req.URL.Host = auth.url.Host
+
+	if auth.header != "" {
+		req.Header.Set(auth.header, auth.value)
+	}
+
+	if auth.queryParam != "" {
+		query := req.URL.Query()
+		query.Set(auth.queryParam, auth.value)
+		req.URL.RawQuery = query.Encode()
+	}
+
+	rsp, err := roundTrip(auth.base, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+
+	return rsp, nil
+}
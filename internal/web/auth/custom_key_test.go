@@ -0,0 +1,72 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCustomKeyRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name       string
+		header     string
+		queryParam string
+		expected   string
+	}{
+		{name: "header", header: "X-Api-Key", expected: "header=key query="},
+		{name: "query param", queryParam: "api_key", expected: "header= query=key"},
+		{name: "both", header: "X-Api-Key", queryParam: "api_key", expected: "header=key query=key"},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = "header=" + r.Header.Get("X-Api-Key") + " query=" + r.URL.Query().Get("api_key")
+
+				if r.URL.Query().Get("symbol") != "BTC-USD" {
+					t.Errorf("expected the query of the request to be kept, got %q", r.URL.RawQuery)
+				}
+			}))
+			defer server.Close()
+
+			transport := NewCustomKey().
+				SetHeader(tcase.header).
+				SetQueryParam(tcase.queryParam).
+				SetValue("key").
+				SetURL(server.URL)
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/candles?symbol=BTC-USD", nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			rsp, err := (&http.Client{Transport: transport}).Do(req)
+			if err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+
+			rsp.Body.Close()
+
+			if got != tcase.expected {
+				t.Fatalf("expected %q, got %q", tcase.expected, got)
+			}
+
+			if req.URL.Query().Get("api_key") != "" || req.Header.Get("X-Api-Key") != "" {
+				t.Fatalf("expected the request of the caller to be unchanged, got %v", req.URL)
+			}
+		})
+	}
+}
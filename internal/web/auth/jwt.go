@@ -0,0 +1,324 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// JWTAlgorithmRS256 signs the tokens with RSASSA-PKCS1-v1_5 and SHA-256.
+	JWTAlgorithmRS256 = "RS256"
+
+	// JWTAlgorithmES256 signs the tokens with ECDSA on the P-256 curve and SHA-256.
+	JWTAlgorithmES256 = "ES256"
+
+	// defaultJWTTTL is the lifetime of the tokens, if the transport does not set one.
+	defaultJWTTTL = 5 * time.Minute
+
+	// es256CoordinateSize is the size in bytes of each of the two integers of an ES256 signature.
+	es256CoordinateSize = 32
+)
+
+var (
+	// JWTAlgorithms are the supported algorithms of the JWT transport.
+	JWTAlgorithms = []string{JWTAlgorithmRS256, JWTAlgorithmES256}
+
+	// ErrInvalidJWTKey is returned when the private key of a JWT transport can not be used to sign its tokens.
+	ErrInvalidJWTKey = fmt.Errorf("invalid jwt private key")
+)
+
+// InvalidJWTKeyError wraps an error with ErrInvalidJWTKey.
+func InvalidJWTKeyError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidJWTKey, msg)
+}
+
+// ParseJWTPrivateKey will parse a PEM encoded RSA or ECDSA private key, in the PKCS #8, PKCS #1, or SEC 1 format.
+func ParseJWTPrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, InvalidJWTKeyError("no PEM block")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, InvalidJWTKeyError(err.Error())
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, InvalidJWTKeyError(fmt.Sprintf("unsupported key type %T", key))
+	}
+}
+
+// JWT is an http transport that authorizes requests with a bearer JWT signed by a private key, for web APIs that
+// require locally signed tokens instead of issuing them. The token is cached and signed again shortly before it
+// expires.
+type JWT struct {
+	url   *url.URL
+	base  http.RoundTripper
+	clock *Clock
+
+	key       crypto.Signer
+	algorithm string
+	keyID     string
+	claims    map[string]interface{}
+	ttl       time.Duration
+
+	// mutex guards the token and its expiry.
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewJWT will return a JWT http transport.
+func NewJWT() *JWT {
+	return new(JWT)
+}
+
+// SetKey will set the private key that signs the tokens.
+func (auth *JWT) SetKey(key crypto.Signer) *JWT {
+	auth.key = key
+
+	return auth
+}
+
+// SetAlgorithm will set the algorithm of the signatures, "RS256" or "ES256". The default is the algorithm of the
+// type of the private key.
+func (auth *JWT) SetAlgorithm(algorithm string) *JWT {
+	auth.algorithm = algorithm
+
+	return auth
+}
+
+// SetKeyID will set the "kid" header of the tokens, which identifies the key to the web API.
+func (auth *JWT) SetKeyID(keyID string) *JWT {
+	auth.keyID = keyID
+
+	return auth
+}
+
+// SetClaims will set the claims of the tokens, e.g. "iss", "sub", and "aud". The "iat", "nbf", and "exp" claims are set
+// when a token is signed.
+func (auth *JWT) SetClaims(claims map[string]interface{}) *JWT {
+	auth.claims = claims
+
+	return auth
+}
+
+// SetTTL will set the lifetime of the tokens, the default is 5 minutes.
+func (auth *JWT) SetTTL(ttl time.Duration) *JWT {
+	auth.ttl = ttl
+
+	return auth
+}
+
+// SetClock will set the clock used to timestamp the tokens.
+func (auth *JWT) SetClock(clock *Clock) *JWT {
+	auth.clock = clock
+
+	return auth
+}
+
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *JWT) SetBase(base http.RoundTripper) *JWT {
+	auth.base = base
+
+	return auth
+}
+
+// SetURL will set the URL of the web API.
+func (auth *JWT) SetURL(u string) *JWT {
+	auth.url, _ = url.Parse(u)
+
+	return auth
+}
+
+// RoundTrip authorizes the request with the bearer JWT.
+func (auth *JWT) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth.url == nil {
+		return nil, ErrURLRequired
+	}
+
+	token, err := auth.sign()
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.Scheme = auth.url.Scheme
+	req.URL.Host = auth.url.Host
+	req.Header.Set(authorizationHeaderParam, fmt.Sprintf("%s %s", bearerHeaderPrefix, token))
+
+	rsp, err := roundTrip(auth.base, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+
+	return rsp, nil
+}
+
+// Refresh will discard the cached token, so that the next request signs a new token.
+func (auth *JWT) Refresh() bool {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	auth.token = ""
+
+	return true
+}
+
+// sign will return the cached token until it is about to expire, then sign a new token.
+func (auth *JWT) sign() (string, error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	now := auth.clock.Now()
+	if auth.token != "" && now.Add(tokenExpiryDelta).Before(auth.expiry) {
+		return auth.token, nil
+	}
+
+	ttl := auth.ttl
+	if ttl <= 0 {
+		ttl = defaultJWTTTL
+	}
+
+	algorithm, err := auth.keyAlgorithm()
+	if err != nil {
+		return "", err
+	}
+
+	header := map[string]interface{}{"alg": algorithm, "typ": "JWT"}
+	if auth.keyID != "" {
+		header["kid"] = auth.keyID
+	}
+
+	claims := make(map[string]interface{}, len(auth.claims)+3)
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+
+	expiry := now.Add(ttl)
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = expiry.Unix()
+
+	encodedHeader, err := encodeJWTSegment(header)
+	if err != nil {
+		return "", err
+	}
+
+	encodedClaims, err := encodeJWTSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodedHeader + "." + encodedClaims
+
+	signature, err := auth.signature(algorithm, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	auth.token = signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	auth.expiry = expiry
+
+	return auth.token, nil
+}
+
+// keyAlgorithm will return the algorithm of the signatures, ensuring that it can be used with the private key.
+func (auth *JWT) keyAlgorithm() (string, error) {
+	switch key := auth.key.(type) {
+	case *rsa.PrivateKey:
+		if auth.algorithm != "" && auth.algorithm != JWTAlgorithmRS256 {
+			return "", InvalidJWTKeyError(fmt.Sprintf("an RSA key can not sign %s tokens", auth.algorithm))
+		}
+
+		return JWTAlgorithmRS256, nil
+	case *ecdsa.PrivateKey:
+		if auth.algorithm != "" && auth.algorithm != JWTAlgorithmES256 {
+			return "", InvalidJWTKeyError(fmt.Sprintf("an ECDSA key can not sign %s tokens", auth.algorithm))
+		}
+
+		if key.Curve != elliptic.P256() {
+			return "", InvalidJWTKeyError("ES256 requires a P-256 key")
+		}
+
+		return JWTAlgorithmES256, nil
+	default:
+		return "", InvalidJWTKeyError(fmt.Sprintf("unsupported key type %T", auth.key))
+	}
+}
+
+// signature will sign the input with the private key. ES256 signatures are the big-endian integers r and s of the
+// ECDSA signature, each padded to 32 bytes, rather than their ASN.1 encoding.
+func (auth *JWT) signature(algorithm string, input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+
+	if algorithm == JWTAlgorithmES256 {
+		key, _ := auth.key.(*ecdsa.PrivateKey)
+
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, fmt.Errorf("unable to sign token: %w", err)
+		}
+
+		signature := make([]byte, 2*es256CoordinateSize)
+		r.FillBytes(signature[:es256CoordinateSize])
+		s.FillBytes(signature[es256CoordinateSize:])
+
+		return signature, nil
+	}
+
+	signature, err := auth.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign token: %w", err)
+	}
+
+	return signature, nil
+}
+
+// encodeJWTSegment will return the base64url encoding of the JSON encoding of a header or the claims of a token.
+func encodeJWTSegment(segment map[string]interface{}) (string, error) {
+	data, err := json.Marshal(segment)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
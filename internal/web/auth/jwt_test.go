@@ -0,0 +1,217 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifyJWT will verify the signature of the token with the public key and return its header and claims.
+func verifyJWT(t *testing.T, token string, pub crypto.PublicKey) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 segments, got %q", token)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			t.Fatalf("invalid RS256 signature: %v", err)
+		}
+	case *ecdsa.PublicKey:
+		r := new(big.Int).SetBytes(signature[:es256CoordinateSize])
+		s := new(big.Int).SetBytes(signature[es256CoordinateSize:])
+
+		if len(signature) != 2*es256CoordinateSize || !ecdsa.Verify(pub, digest[:], r, s) {
+			t.Fatalf("invalid ES256 signature")
+		}
+	}
+
+	segments := make([]map[string]interface{}, 2)
+
+	for idx := range segments {
+		data, err := base64.RawURLEncoding.DecodeString(parts[idx])
+		if err != nil {
+			t.Fatalf("failed to decode segment: %v", err)
+		}
+
+		if err := json.Unmarshal(data, &segments[idx]); err != nil {
+			t.Fatalf("failed to unmarshal segment: %v", err)
+		}
+	}
+
+	return segments[0], segments[1]
+}
+
+func TestParseJWTPrivateKey(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ecdsa key: %v", err)
+	}
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal ecdsa key: %v", err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal pkcs8 key: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name  string
+		block *pem.Block
+		err   error
+	}{
+		{name: "pkcs1", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}},
+		{name: "sec1", block: &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}},
+		{name: "pkcs8", block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}},
+		{name: "invalid", block: &pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")}, err: ErrInvalidJWTKey},
+		{name: "not pem", err: ErrInvalidJWTKey},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var data []byte
+			if tcase.block != nil {
+				data = pem.EncodeToMemory(tcase.block)
+			}
+
+			key, err := ParseJWTPrivateKey(data)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if tcase.err == nil && key == nil {
+				t.Fatalf("expected a key")
+			}
+		})
+	}
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ecdsa key: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name      string
+		key       crypto.Signer
+		algorithm string
+		ttl       time.Duration
+		resigned  bool
+		err       error
+	}{
+		{name: "rs256", key: rsaKey, algorithm: JWTAlgorithmRS256},
+		{name: "es256", key: ecKey, algorithm: JWTAlgorithmES256},
+		{name: "default algorithm", key: ecKey},
+		{name: "resigned before expiry", key: ecKey, ttl: 10 * time.Second, resigned: true},
+		{name: "mismatched algorithm", key: rsaKey, algorithm: JWTAlgorithmES256, err: ErrInvalidJWTKey},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var tokens []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tokens = append(tokens, strings.TrimPrefix(r.Header.Get(authorizationHeaderParam), "Bearer "))
+			}))
+			defer server.Close()
+
+			transport := NewJWT().
+				SetKey(tcase.key).
+				SetAlgorithm(tcase.algorithm).
+				SetKeyID("key-1").
+				SetClaims(map[string]interface{}{"iss": "gidari", "aud": []interface{}{"api"}}).
+				SetTTL(tcase.ttl).
+				SetURL(server.URL)
+
+			client := &http.Client{Transport: transport}
+
+			for attempt := 0; attempt < 2; attempt++ {
+				rsp, err := client.Get(server.URL + "/accounts")
+				if !errors.Is(err, tcase.err) {
+					t.Fatalf("expected error %v, got %v", tcase.err, err)
+				}
+
+				if err != nil {
+					return
+				}
+
+				rsp.Body.Close()
+			}
+
+			// ES256 signatures are randomized, so a token that is signed again differs.
+			if len(tokens) != 2 || (tokens[0] != tokens[1]) != tcase.resigned {
+				t.Fatalf("expected the token to be signed again to be %v, got %v", tcase.resigned, tokens)
+			}
+
+			header, claims := verifyJWT(t, tokens[1], tcase.key.Public())
+			if header["kid"] != "key-1" || header["typ"] != "JWT" {
+				t.Fatalf("unexpected header: %v", header)
+			}
+
+			iat, _ := claims["iat"].(float64)
+			exp, _ := claims["exp"].(float64)
+
+			ttl := tcase.ttl
+			if ttl == 0 {
+				ttl = defaultJWTTTL
+			}
+
+			if claims["iss"] != "gidari" || time.Duration(exp-iat)*time.Second != ttl {
+				t.Fatalf("unexpected claims: %v", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// ErrUnregisteredTransport is returned when a transport is not registered with Register.
+var ErrUnregisteredTransport = fmt.Errorf("unregistered transport")
+
+// UnregisteredTransportError wraps an error with ErrUnregisteredTransport.
+func UnregisteredTransportError(name string) error {
+	return fmt.Errorf("%w: %q", ErrUnregisteredTransport, name)
+}
+
+// Config is the configuration of a registered transport.
+type Config struct {
+	// URL is the URL of the web API.
+	URL string
+
+	// Params are the params of the authentication of the configuration, e.g. the credentials of the transport.
+	Params map[string]interface{}
+
+	// Base is the round tripper that must send the authenticated requests, which applies the proxy, TLS, and
+	// compression of the configuration.
+	Base http.RoundTripper
+}
+
+// Factory will construct a registered transport from its configuration.
+type Factory func(ctx context.Context, cfg Config) (Transport, error)
+
+// registry holds the transports added with Register, by name.
+var registry = struct {
+	sync.RWMutex
+
+	factories map[string]Factory
+}{
+	factories: make(map[string]Factory),
+}
+
+// Register will add a transport that is constructed by the factory for the authentications with the name, e.g. for
+// HMAC schemes that gidari does not implement.
+//
+// Register is meant to be called from the init function of the package of a transport. It panics if the factory is
+// nil, or if the name is empty or already registered.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if factory == nil {
+		panic("auth: Register factory is nil")
+	}
+
+	if name == "" {
+		panic("auth: Register of empty name")
+	}
+
+	if _, dup := registry.factories[name]; dup {
+		panic(fmt.Sprintf("auth: Register called twice for name %q", name))
+	}
+
+	registry.factories[name] = factory
+}
+
+// Registered will return true if a transport is registered with the name.
+func Registered(name string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	_, ok := registry.factories[name]
+
+	return ok
+}
+
+// NewRegistered will construct the transport registered with the name.
+func NewRegistered(ctx context.Context, name string, cfg Config) (Transport, error) {
+	registry.RLock()
+	factory, ok := registry.factories[name]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, UnregisteredTransportError(name)
+	}
+
+	transport, err := factory(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct %s transport: %w", name, err)
+	}
+
+	if transport == nil {
+		return nil, fmt.Errorf("failed to construct %s transport: the factory returned nil", name)
+	}
+
+	return transport, nil
+}
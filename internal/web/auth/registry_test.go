@@ -0,0 +1,88 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// roundTripperFunc is a transport that is a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	failed := errors.New("failed")
+
+	Register("registry-test", func(_ context.Context, cfg Config) (Transport, error) {
+		if cfg.Params["fail"] == true {
+			return nil, failed
+		}
+
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Signature", cfg.Params["key"].(string))
+
+			return roundTrip(cfg.Base, req)
+		}), nil
+	})
+
+	Register("registry-test-nil", func(context.Context, Config) (Transport, error) {
+		return nil, nil
+	})
+
+	if !Registered("registry-test") || Registered("registry-test-missing") {
+		t.Fatalf("unexpected registered transports")
+	}
+
+	for _, tcase := range []struct {
+		name string
+		cfg  Config
+		err  bool
+		is   error
+	}{
+		{name: "registry-test", cfg: Config{Params: map[string]interface{}{"key": "k"}}},
+		{name: "registry-test", cfg: Config{Params: map[string]interface{}{"fail": true}}, err: true, is: failed},
+		{name: "registry-test-nil", err: true},
+		{name: "registry-test-missing", err: true, is: ErrUnregisteredTransport},
+	} {
+		transport, err := NewRegistered(context.Background(), tcase.name, tcase.cfg)
+		if tcase.err != (err != nil) || (tcase.is != nil && !errors.Is(err, tcase.is)) {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+
+		if err == nil && transport == nil {
+			t.Fatalf("%s: expected a transport", tcase.name)
+		}
+	}
+
+	for _, tcase := range []struct {
+		name    string
+		factory Factory
+	}{
+		{name: "", factory: func(context.Context, Config) (Transport, error) { return nil, nil }},
+		{name: "registry-test"},
+		{name: "registry-test", factory: func(context.Context, Config) (Transport, error) { return nil, nil }},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected Register of %q to panic", tcase.name)
+				}
+			}()
+
+			Register(tcase.name, tcase.factory)
+		}()
+	}
+}
@@ -17,6 +17,26 @@ var (
 	ErrRequestFailed = fmt.Errorf("request failed")
 )
 
+// Transport is an http transport that authorizes the requests of a web client.
 type Transport interface {
 	http.RoundTripper
 }
+
+// Refresher is implemented by the transports whose credentials can be refreshed, e.g. a token that is revoked before it
+// expires or a session that times out. The web clients refresh the credentials of their transport when a request is
+// unauthorized, and send the request again once.
+type Refresher interface {
+	// Refresh will discard the cached credentials of the transport, so that the next request uses new credentials. It
+	// returns false if the transport has no credentials that can be refreshed, e.g. a static key.
+	Refresh() bool
+}
+
+// roundTrip will send the request using the base round tripper of an auth transport. If the base is nil, the request
+// is sent using http.DefaultTransport.
+func roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+)
+
+// loginErrorBodyLimit is the number of bytes of the body of a failed login response that are in its error.
+const loginErrorBodyLimit = 512
+
+// ErrLoginFailed is returned when the login request of a Session transport fails.
+var ErrLoginFailed = fmt.Errorf("login failed")
+
+// LoginError wraps an error with ErrLoginFailed.
+func LoginError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrLoginFailed, msg)
+}
+
+// Session is an http transport that authorizes requests with the cookies of a session, for web APIs that require a
+// login request instead of credentials on every request. The login request is sent before the first request, and the
+// cookies that its response sets are kept in a cookie jar. The cookies of the jar are sent with every request, and the
+// cookies that the responses set are stored in the jar, e.g. a session that is extended by every response.
+type Session struct {
+	method      string
+	loginURL    string
+	body        []byte
+	contentType string
+	header      http.Header
+	url         *url.URL
+	base        http.RoundTripper
+
+	// mutex guards the jar, which is nil until the login request succeeds.
+	mutex sync.Mutex
+	jar   *cookiejar.Jar
+}
+
+// NewSession will return a Session http transport.
+func NewSession() *Session {
+	return new(Session)
+}
+
+// SetLogin will set the login request, which is resolved against the URL of the web API if it is relative. The
+// default method is POST.
+func (auth *Session) SetLogin(method, loginURL string, body []byte, contentType string) *Session {
+	auth.method = method
+	auth.loginURL = loginURL
+	auth.body = body
+	auth.contentType = contentType
+
+	return auth
+}
+
+// SetHeader will set the headers of the login request.
+func (auth *Session) SetHeader(header http.Header) *Session {
+	auth.header = header
+
+	return auth
+}
+
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *Session) SetBase(base http.RoundTripper) *Session {
+	auth.base = base
+
+	return auth
+}
+
+// SetURL will set the URL of the web API.
+func (auth *Session) SetURL(u string) *Session {
+	auth.url, _ = url.Parse(u)
+
+	return auth
+}
+
+// RoundTrip authorizes the request with the cookies of the session, logging in first if the transport has not.
+func (auth *Session) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth.url == nil {
+		return nil, ErrURLRequired
+	}
+
+	jar, err := auth.session(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cookies are set on a copy of the request, so that the request of the caller is not modified.
+	req = req.Clone(req.Context())
+	req.URL.Scheme = auth.url.Scheme
+	req.URL.Host = auth.url.Host
+
+	for _, cookie := range jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+
+	rsp, err := roundTrip(auth.base, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+
+	jar.SetCookies(req.URL, rsp.Cookies())
+
+	return rsp, nil
+}
+
+// Refresh will discard the cookies of the session, so that the next request sends the login request again.
+func (auth *Session) Refresh() bool {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	auth.jar = nil
+
+	return true
+}
+
+// session will return the cookie jar of the session, sending the login request if it has not succeeded yet.
+func (auth *Session) session(req *http.Request) (*cookiejar.Jar, error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	if auth.jar != nil {
+		return auth.jar, nil
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, LoginError(err.Error())
+	}
+
+	loginURL, err := auth.url.Parse(auth.loginURL)
+	if err != nil {
+		return nil, LoginError(fmt.Sprintf("invalid login url: %v", err))
+	}
+
+	method := auth.method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	login, err := http.NewRequestWithContext(req.Context(), method, loginURL.String(), bytes.NewReader(auth.body))
+	if err != nil {
+		return nil, LoginError(err.Error())
+	}
+
+	for name, values := range auth.header {
+		login.Header[name] = values
+	}
+
+	if auth.contentType != "" {
+		login.Header.Set("Content-Type", auth.contentType)
+	}
+
+	rsp, err := roundTrip(auth.base, login)
+	if err != nil {
+		return nil, LoginError(err.Error())
+	}
+
+	defer rsp.Body.Close()
+
+	// A login that redirects, e.g. to the home page of the web API, sets the cookies on the redirect.
+	if rsp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(rsp.Body, loginErrorBodyLimit))
+
+		return nil, LoginError(fmt.Sprintf("status %d: %s", rsp.StatusCode, body))
+	}
+
+	cookies := rsp.Cookies()
+	if len(cookies) == 0 {
+		return nil, LoginError(fmt.Sprintf("the response with status %d set no cookies", rsp.StatusCode))
+	}
+
+	jar.SetCookies(loginURL, cookies)
+	auth.jar = jar
+
+	return jar, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	var logins int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			atomic.AddInt32(&logins, 1)
+
+			body, _ := io.ReadAll(r.Body)
+			if r.Method != http.MethodPost || string(body) != "username=u&password=p" ||
+				r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" ||
+				r.Header.Get("X-Client") != "gidari" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+			w.Header().Set("Location", "/home")
+			w.WriteHeader(http.StatusFound)
+		case "/orders":
+			cookie, err := r.Cookie("session")
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			// The session is extended by every response.
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: cookie.Value + "+", Path: "/"})
+			_, _ = w.Write([]byte(cookie.Value))
+		}
+	}))
+	defer server.Close()
+
+	transport := NewSession().
+		SetLogin("", "/login", []byte("username=u&password=p"), "application/x-www-form-urlencoded").
+		SetHeader(http.Header{"X-Client": {"gidari"}}).
+		SetURL(server.URL)
+
+	for _, expected := range []string{"s1", "s1+", "s1++"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+
+		rsp, err := (&http.Client{Transport: transport}).Do(req)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK || string(body) != expected {
+			t.Fatalf("expected session %q, got status %d: %s", expected, rsp.StatusCode, body)
+		}
+
+		if req.Header.Get("Cookie") != "" {
+			t.Fatalf("expected the request of the caller to be unchanged")
+		}
+	}
+
+	if logins != 1 {
+		t.Fatalf("expected 1 login, got %d", logins)
+	}
+
+	if !transport.Refresh() {
+		t.Fatalf("expected the session to be refreshed")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	rsp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+
+	rsp.Body.Close()
+
+	if logins != 2 {
+		t.Fatalf("expected the refreshed session to login again, got %d logins", logins)
+	}
+}
+
+func TestSessionLoginFailed(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		handler http.HandlerFunc
+		err     string
+	}{
+		{
+			name: "unauthorized",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte("invalid credentials"))
+			},
+			err: "status 401: invalid credentials",
+		},
+		{
+			name:    "no cookies",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			err:     "set no cookies",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(tcase.handler)
+			defer server.Close()
+
+			transport := NewSession().SetLogin(http.MethodPost, server.URL+"/login", nil, "").SetURL(server.URL)
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			_, err = transport.RoundTrip(req)
+			if !errors.Is(err, ErrLoginFailed) || !strings.Contains(err.Error(), tcase.err) {
+				t.Fatalf("expected a login error with %q, got %v", tcase.err, err)
+			}
+		})
+	}
+}
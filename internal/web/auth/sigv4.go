@@ -0,0 +1,276 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sigV4Algorithm is the algorithm of AWS Signature Version 4.
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+	// sigV4DateLayout and sigV4TimeLayout are the layouts of the date of the credential scope and of the
+	// "X-Amz-Date" header.
+	sigV4DateLayout = "20060102"
+	sigV4TimeLayout = "20060102T150405Z"
+)
+
+// AWSCredentials are the credentials of an AWS identity, which sign requests with AWS Signature Version 4.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is the token of temporary credentials, which is sent in the "X-Amz-Security-Token" header.
+	SessionToken string
+}
+
+// SignV4 will sign the request with AWS Signature Version 4 for the region and service at the time, setting its
+// "X-Amz-Date" and "Authorization" headers. The body is the payload of the request, and every header of the request is
+// signed.
+func SignV4(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeLayout))
+
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders, canonicalHeaders := sigV4Headers(req)
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL),
+		sigV4Query(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(sigV4DateLayout), region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeLayout),
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(sigV4DateLayout))
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// sigV4Path will return the canonical path of the URL.
+func sigV4Path(rurl *url.URL) string {
+	path := rurl.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
+
+// sigV4Query will return the canonical query string, which is sorted by key and value and escaped with "%20" for
+// spaces.
+func sigV4Query(query url.Values) string {
+	params := make([]string, 0, len(query))
+
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, sigV4Escape(key)+"="+sigV4Escape(value))
+		}
+	}
+
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+func sigV4Escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// sigV4Headers will return the signed headers and the canonical headers of the request, which are the host and every
+// header of the request.
+func sigV4Headers(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	values := map[string]string{"host": host}
+
+	for name, headerValues := range req.Header {
+		trimmed := make([]string, len(headerValues))
+		for idx, value := range headerValues {
+			trimmed[idx] = strings.Join(strings.Fields(value), " ")
+		}
+
+		values[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// AWSCredentialsProvider returns the credentials that sign the requests of a SigV4 transport, e.g. an
+// AWSCredentialsChain.
+type AWSCredentialsProvider interface {
+	Retrieve(ctx context.Context) (AWSCredentials, error)
+}
+
+// StaticAWSCredentials is a provider of fixed credentials.
+type StaticAWSCredentials AWSCredentials
+
+// Retrieve will return the credentials.
+func (creds StaticAWSCredentials) Retrieve(context.Context) (AWSCredentials, error) {
+	return AWSCredentials(creds), nil
+}
+
+// SigV4 is an http transport that signs the requests with AWS Signature Version 4, for AWS-hosted web APIs like API
+// Gateway or OpenSearch.
+type SigV4 struct {
+	region  string
+	service string
+	creds   AWSCredentialsProvider
+	url     *url.URL
+	clock   *Clock
+	base    http.RoundTripper
+}
+
+// NewSigV4 will return a SigV4 http transport.
+func NewSigV4() *SigV4 {
+	return new(SigV4)
+}
+
+// SetRegion will set the region that the requests are signed for, e.g. "us-east-1".
+func (auth *SigV4) SetRegion(region string) *SigV4 {
+	auth.region = region
+
+	return auth
+}
+
+// SetService will set the service that the requests are signed for, e.g. "execute-api" for API Gateway or "es" for
+// OpenSearch.
+func (auth *SigV4) SetService(service string) *SigV4 {
+	auth.service = service
+
+	return auth
+}
+
+// SetCredentials will set the provider of the credentials that sign the requests.
+func (auth *SigV4) SetCredentials(creds AWSCredentialsProvider) *SigV4 {
+	auth.creds = creds
+
+	return auth
+}
+
+// SetClock will set the clock used to timestamp the request signatures.
+func (auth *SigV4) SetClock(clock *Clock) *SigV4 {
+	auth.clock = clock
+
+	return auth
+}
+
+// SetBase will set the round tripper used to send the authenticated requests, the default is http.DefaultTransport.
+func (auth *SigV4) SetBase(base http.RoundTripper) *SigV4 {
+	auth.base = base
+
+	return auth
+}
+
+// SetURL will set the URL of the web API.
+func (auth *SigV4) SetURL(u string) *SigV4 {
+	auth.url, _ = url.Parse(u)
+
+	return auth
+}
+
+// Refresh will refresh the credentials of the provider, if the provider is a Refresher, e.g. an AWSCredentialsChain
+// with temporary credentials.
+func (auth *SigV4) Refresh() bool {
+	refresher, ok := auth.creds.(Refresher)
+
+	return ok && refresher.Refresh()
+}
+
+// RoundTrip signs the request with AWS Signature Version 4, which includes a hash of its body.
+func (auth *SigV4) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth.url == nil {
+		return nil, ErrURLRequired
+	}
+
+	creds, err := auth.creds.Retrieve(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.Scheme = auth.url.Scheme
+	req.URL.Host = auth.url.Host
+	req.Host = ""
+
+	var body []byte
+
+	if req.Body != nil {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("unable to read request body: %w", err)
+		}
+
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	SignV4(req, body, creds, auth.region, auth.service, auth.clock.Now())
+
+	rsp, err := roundTrip(auth.base, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+
+	auth.clock.observe(rsp)
+
+	return rsp, nil
+}
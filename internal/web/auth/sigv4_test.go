@@ -0,0 +1,98 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	t.Parallel()
+
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	for _, tcase := range []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			// The "get-vanilla" case of the AWS Signature Version 4 test suite.
+			name: "vanilla",
+			url:  "https://example.amazonaws.com/",
+			expected: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			// The "get-vanilla-query-order-key-case" case of the AWS Signature Version 4 test suite.
+			name: "query order",
+			url:  "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			expected: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(http.MethodGet, tcase.url, nil)
+			if err != nil {
+				t.Fatalf("error creating request: %v", err)
+			}
+
+			SignV4(req, nil, creds, "us-east-1", "service", now)
+
+			if authorization := req.Header.Get("Authorization"); authorization != tcase.expected {
+				t.Fatalf("expected authorization %q, got %q", tcase.expected, authorization)
+			}
+
+			if date := req.Header.Get("X-Amz-Date"); date != "20150830T123600Z" {
+				t.Fatalf("unexpected date: %s", date)
+			}
+		})
+	}
+}
+
+func TestSigV4RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-west-2/execute-api/aws4_request") ||
+			r.Header.Get("X-Amz-Security-Token") != "token" || string(body) != `{"symbol":"BTC"}` {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	creds := StaticAWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}
+	client := &http.Client{Transport: NewSigV4().SetURL(server.URL).SetRegion("us-west-2").SetService("execute-api").
+		SetCredentials(creds)}
+
+	rsp, err := client.Post(server.URL+"/prod/candles", "application/json", strings.NewReader(`{"symbol":"BTC"}`))
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rsp.StatusCode)
+	}
+}
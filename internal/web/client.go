@@ -8,12 +8,14 @@
 package web
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/alpine-hodler/gidari/internal/web/auth"
 	"golang.org/x/time/rate"
@@ -51,13 +53,33 @@ func MissingFetchConfigFieldError(field string) error {
 	return fmt.Errorf("%w: %q", ErrMissingFetchConfigField, field)
 }
 
+// ResponseError is returned when the server responds with an error status. It wraps ErrGettingResponse.
+type ResponseError struct {
+	// StatusCode is the status code of the response, e.g. 429.
+	StatusCode int
+
+	// Status is the status of the response, e.g. "429 Too Many Requests".
+	Status string
+
+	// Header is the header of the response, e.g. with the "Retry-After" of the server.
+	Header http.Header
+}
+
+func (rspErr *ResponseError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrGettingResponse, rspErr.Status)
+}
+
+func (rspErr *ResponseError) Unwrap() error {
+	return ErrGettingResponse
+}
+
 // GettingResponseError is returned when the response fails to get.
 func GettingResponseError(rsp *http.Response) error {
 	if _, err := io.ReadAll(rsp.Body); err != nil {
 		return fmt.Errorf("%w: %v", ErrGettingResponse, err)
 	}
 
-	return fmt.Errorf("%w: %v", ErrGettingResponse, rsp.Status)
+	return &ResponseError{StatusCode: rsp.StatusCode, Status: rsp.Status, Header: rsp.Header}
 }
 
 // Client is a wrapper around the http.Client that will handle authentication and rate limiting.
@@ -71,13 +93,24 @@ func NewClient(_ context.Context, roundtripper auth.Transport) (*Client, error)
 	return c, nil
 }
 
-// newHTTPRequest will return a new request.  If the options are set, this function will encode a body if possible.
-func newHTTPRequest(ctx context.Context, method string, uri fmt.Stringer) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(ctx, method, uri.String(), nil)
+// newHTTPRequest will return a new request, with the body and its content type if the body is not nil.
+func newHTTPRequest(ctx context.Context, method string, uri fmt.Stringer, body []byte,
+	contentType string,
+) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri.String(), reader)
 	if err != nil {
 		return nil, CreateRequestError(err)
 	}
 
+	if body != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
 	return req, nil
 }
 
@@ -94,7 +127,11 @@ func validateResponse(res *http.Response) error {
 		http.StatusInternalServerError,
 		http.StatusNotFound,
 		http.StatusTooManyRequests,
-		http.StatusForbidden:
+		http.StatusForbidden,
+		http.StatusRequestTimeout,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
 		return GettingResponseError(res)
 	}
 
@@ -106,6 +143,15 @@ type FetchConfig struct {
 	Method      string
 	URL         *url.URL
 	RateLimiter *rate.Limiter
+
+	// Body is the body of the request, which is sent with the content type. The request does not have a body if it is
+	// nil.
+	Body        []byte
+	ContentType string
+
+	// Header are the headers of the request, e.g. "Accept" or an API version. They take precedence over the headers
+	// set by the client, including the content type.
+	Header http.Header
 }
 
 func (cfg *FetchConfig) validate() error {
@@ -135,15 +181,72 @@ type FetchResponse struct {
 
 	// Body is the response body from the server.
 	Body io.ReadCloser
+
+	// Header is the response header from the server.
+	Header http.Header
+
+	// StatusCode is the status code of the response, e.g. 304 for a conditional request whose response is not
+	// modified.
+	StatusCode int
+
+	// RateLimiterWait is the time the request waited on the rate limiter before it was made.
+	RateLimiterWait time.Duration
 }
 
-func newFetchResponse(req *http.Request, body io.ReadCloser) *FetchResponse {
+func newFetchResponse(req *http.Request, rsp *http.Response) *FetchResponse {
 	return &FetchResponse{
-		Request: req,
-		Body:    body,
+		Request:    req,
+		Body:       rsp.Body,
+		Header:     rsp.Header,
+		StatusCode: rsp.StatusCode,
 	}
 }
 
+// reauthorize will refresh the credentials of the transport of the client if the response is unauthorized, e.g. for a
+// token that expired before the transport expected, and send the request again once. The response is returned as it
+// is if the transport can not refresh its credentials.
+func (cfg *FetchConfig) reauthorize(ctx context.Context, rsp *http.Response) (*http.Response, *http.Request, error) {
+	if rsp.StatusCode != http.StatusUnauthorized && rsp.StatusCode != http.StatusForbidden {
+		return rsp, rsp.Request, nil
+	}
+
+	refresher, ok := cfg.C.Client.Transport.(auth.Refresher)
+	if !ok || !refresher.Refresh() {
+		return rsp, rsp.Request, nil
+	}
+
+	rsp.Body.Close()
+
+	if err := cfg.RateLimiter.Wait(ctx); err != nil {
+		return nil, nil, fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	req, err := cfg.newRequest(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rsp, err = cfg.C.Client.Do(req); err != nil {
+		return nil, nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	return rsp, req, nil
+}
+
+// newRequest will return the request of the config.
+func (cfg *FetchConfig) newRequest(ctx context.Context) (*http.Request, error) {
+	req, err := newHTTPRequest(ctx, cfg.Method, cfg.URL, cfg.Body, cfg.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	for key, values := range cfg.Header {
+		req.Header[key] = values
+	}
+
+	return req, nil
+}
+
 // Fetch will make an HTTP request using the underlying client and endpoint.
 func Fetch(ctx context.Context, cfg *FetchConfig) (*FetchResponse, error) {
 	if err := cfg.validate(); err != nil {
@@ -151,17 +254,16 @@ func Fetch(ctx context.Context, cfg *FetchConfig) (*FetchResponse, error) {
 	}
 
 	// If the rate limiter is not set, set it with defaults.
+	waitStart := time.Now()
 	if err := cfg.RateLimiter.Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limiter error: %w", err)
 	}
 
-	req, err := newHTTPRequest(ctx, cfg.Method, cfg.URL)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
+	wait := time.Since(waitStart)
 
+	req, err := cfg.newRequest(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("rate limiter timeout: %w", err)
+		return nil, err
 	}
 
 	rsp, err := cfg.C.Client.Do(req)
@@ -169,11 +271,18 @@ func Fetch(ctx context.Context, cfg *FetchConfig) (*FetchResponse, error) {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 
+	if rsp, req, err = cfg.reauthorize(ctx, rsp); err != nil {
+		return nil, err
+	}
+
 	if err := validateResponse(rsp); err != nil {
 		rsp.Body.Close()
 
 		return nil, fmt.Errorf("error validating response: %w", err)
 	}
 
-	return newFetchResponse(req, rsp.Body), nil
+	fetchRsp := newFetchResponse(req, rsp)
+	fetchRsp.RateLimiterWait = wait
+
+	return fetchRsp, nil
 }
@@ -9,6 +9,8 @@ package web
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -400,6 +402,168 @@ func TestFetchWithAPIKey(t *testing.T) {
 }
 
 // createTestServerWithBasicAuth is a helper that creates a httptest.Server with a handler that has basic auth.
+func TestFetchWithBody(t *testing.T) {
+	t.Parallel()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" ||
+			string(body) != `{"limit":100}` {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer testServer.Close()
+
+	client, err := NewClient(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	uri, err := url.Parse(testServer.URL)
+	if err != nil {
+		t.Fatalf("error parsing url: %v", err)
+	}
+
+	// The body is sent again on every fetch, e.g. when the request is retried.
+	for attempt := 0; attempt < 2; attempt++ {
+		rsp, err := Fetch(context.Background(), &FetchConfig{
+			C:           client,
+			Method:      http.MethodPost,
+			URL:         uri,
+			RateLimiter: rate.NewLimiter(rate.Inf, 1),
+			Body:        []byte(`{"limit":100}`),
+			ContentType: "application/json",
+		})
+		if err != nil {
+			t.Fatalf("fetch error: %v", err)
+		}
+
+		rsp.Body.Close()
+	}
+}
+
+func TestFetchWithHeader(t *testing.T) {
+	t.Parallel()
+
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.api+json" || r.Header.Get("X-Tenant-Id") != "acme" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer testServer.Close()
+
+	client, err := NewClient(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	uri, err := url.Parse(testServer.URL)
+	if err != nil {
+		t.Fatalf("error parsing url: %v", err)
+	}
+
+	rsp, err := Fetch(context.Background(), &FetchConfig{
+		C:           client,
+		Method:      http.MethodGet,
+		URL:         uri,
+		RateLimiter: rate.NewLimiter(rate.Inf, 1),
+		Header:      http.Header{"Accept": {"application/vnd.api+json"}, "X-Tenant-Id": {"acme"}},
+	})
+	if err != nil {
+		t.Fatalf("fetch error: %v", err)
+	}
+
+	rsp.Body.Close()
+}
+
+// refreshingTransport authorizes the requests with the number of its refreshes.
+type refreshingTransport struct {
+	refreshes   int
+	refreshable bool
+}
+
+func (transport *refreshingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer token%d", transport.refreshes))
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (transport *refreshingTransport) Refresh() bool {
+	if transport.refreshable {
+		transport.refreshes++
+	}
+
+	return transport.refreshable
+}
+
+func TestFetchReauthorize(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		bearer      string
+		refreshable bool
+		refreshes   int
+		requests    int
+		err         bool
+	}{
+		{name: "authorized", bearer: "token0", refreshable: true, requests: 1},
+		{name: "refreshed", bearer: "token1", refreshable: true, refreshes: 1, requests: 2},
+		{name: "not refreshable", bearer: "token1", requests: 1, err: true},
+		{name: "once", bearer: "token2", refreshable: true, refreshes: 1, requests: 2, err: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests int
+
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				if r.Header.Get("Authorization") != "Bearer "+tcase.bearer || r.Header.Get("X-Tenant-Id") != "acme" {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			defer testServer.Close()
+
+			transport := &refreshingTransport{refreshable: tcase.refreshable}
+
+			client, err := NewClient(context.Background(), transport)
+			if err != nil {
+				t.Fatalf("error creating client: %v", err)
+			}
+
+			uri, err := url.Parse(testServer.URL)
+			if err != nil {
+				t.Fatalf("error parsing url: %v", err)
+			}
+
+			rsp, err := Fetch(context.Background(), &FetchConfig{
+				C:           client,
+				Method:      http.MethodGet,
+				URL:         uri,
+				RateLimiter: rate.NewLimiter(rate.Inf, 1),
+				Header:      http.Header{"X-Tenant-Id": {"acme"}},
+			})
+			if err == nil {
+				rsp.Body.Close()
+			}
+
+			if (err != nil) != tcase.err {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if transport.refreshes != tcase.refreshes || requests != tcase.requests {
+				t.Fatalf("expected %d refreshes and %d requests, got %d and %d", tcase.refreshes, tcase.requests,
+					transport.refreshes, requests)
+			}
+		})
+	}
+}
+
 func createTestServerWithBasicAuth(username, password string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
 		reqUsername, reqPassword, ok := req.BasicAuth()
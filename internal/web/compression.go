@@ -0,0 +1,205 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alpine-hodler/gidari/internal/web/auth"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding are the response encodings negotiated by the compression transport.
+const acceptEncoding = "gzip, deflate, br, zstd"
+
+// ErrUnsupportedEncoding is returned when the server responds with an encoding that was not negotiated.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// UnsupportedEncodingError is returned when the server responds with an encoding that was not negotiated.
+func UnsupportedEncodingError(encoding string) error {
+	return fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+}
+
+// CompressionTransport is a round tripper that gzips the large request bodies and negotiates compressed responses,
+// to reduce the bandwidth of the requests on constrained links. Responses are decoded before they are returned, unless
+// decompression is disabled.
+type CompressionTransport struct {
+	// MinBodySize is the size of the smallest request body that is gzipped. Request bodies are not gzipped if it is
+	// zero.
+	MinBodySize int64
+
+	// DisableDecompression will request the responses without an encoding and return them as they are, e.g. for web
+	// APIs that mis-report the encoding of their responses.
+	DisableDecompression bool
+
+	// Base is the round tripper used to send the requests, the default is http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+// RoundTrip will compress the request body if it is large enough, and decode the compressed response.
+func (ct *CompressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := ct.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	req = req.Clone(req.Context())
+
+	if err := ct.compressBody(req); err != nil {
+		return nil, err
+	}
+
+	// Requests that negotiate their own encodings receive the response as it is.
+	if req.Header.Get("Accept-Encoding") != "" {
+		return base.RoundTrip(req)
+	}
+
+	if ct.DisableDecompression {
+		req.Header.Set("Accept-Encoding", "identity")
+
+		return base.RoundTrip(req)
+	}
+
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	rsp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decodeBody(rsp); err != nil {
+		rsp.Body.Close()
+
+		return nil, err
+	}
+
+	return rsp, nil
+}
+
+// Refresh will refresh the credentials of the base round tripper, if it is an auth.Refresher, e.g. a SigV4 transport
+// that signs the compressed requests.
+func (ct *CompressionTransport) Refresh() bool {
+	refresher, ok := ct.Base.(auth.Refresher)
+
+	return ok && refresher.Refresh()
+}
+
+// compressBody will gzip the body of the request if it is at least the minimum body size and is not encoded.
+func (ct *CompressionTransport) compressBody(req *http.Request) error {
+	if ct.MinBodySize <= 0 || req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+
+	if err != nil {
+		return fmt.Errorf("unable to read request body: %w", err)
+	}
+
+	if int64(len(body)) < ct.MinBodySize {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return fmt.Errorf("unable to compress request body: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("unable to compress request body: %w", err)
+	}
+
+	compressed := buf.Bytes()
+
+	req.Body = io.NopCloser(bytes.NewReader(compressed))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(compressed)), nil }
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	return nil
+}
+
+// decodeBody will replace the body of a compressed response with its decoded body.
+func decodeBody(rsp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(rsp.Header.Get("Content-Encoding")))
+
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip":
+		reader, err = gzip.NewReader(rsp.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(rsp.Body)
+	case "br":
+		// The brotli reader does not read the body until it is read, so an empty body is detected here.
+		buffered := bufio.NewReader(rsp.Body)
+		if _, err = buffered.Peek(1); err == nil {
+			reader = io.NopCloser(brotli.NewReader(buffered))
+		}
+	case "zstd":
+		var decoder *zstd.Decoder
+		if decoder, err = zstd.NewReader(rsp.Body, zstd.WithDecoderConcurrency(1)); err == nil {
+			reader = decoder.IOReadCloser()
+		}
+	default:
+		return UnsupportedEncodingError(encoding)
+	}
+
+	// A compressed response may have an empty body, e.g. a 204 response.
+	if errors.Is(err, io.EOF) {
+		reader, err = http.NoBody, nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to decode %s response: %w", encoding, err)
+	}
+
+	rsp.Body = &decodedBody{ReadCloser: reader, raw: rsp.Body}
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Del("Content-Length")
+	rsp.ContentLength = -1
+	rsp.Uncompressed = true
+
+	return nil
+}
+
+// decodedBody is the decoded body of a compressed response, which closes the raw body of the response.
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (body *decodedBody) Close() error {
+	body.ReadCloser.Close()
+
+	if err := body.raw.Close(); err != nil {
+		return fmt.Errorf("unable to close response body: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressionTransport(t *testing.T) {
+	t.Parallel()
+
+	const payload = `[{"id":1,"name":"alpha"},{"id":2,"name":"beta"}]`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			reader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			body = reader
+		}
+
+		received, _ := io.ReadAll(body)
+
+		w.Header().Set("X-Request-Encoding", r.Header.Get("Content-Encoding"))
+		w.Header().Set("X-Request-Body", string(received))
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+
+		var (
+			buf    bytes.Buffer
+			writer io.WriteCloser
+		)
+
+		encoding := r.URL.Query().Get("encoding")
+
+		switch encoding {
+		case "gzip":
+			writer = gzip.NewWriter(&buf)
+		case "deflate":
+			writer = zlib.NewWriter(&buf)
+		case "zstd":
+			writer, _ = zstd.NewWriter(&buf)
+		case "br":
+			writer = brotli.NewWriter(&buf)
+		default:
+			w.Header().Set("Content-Encoding", encoding)
+			io.WriteString(w, payload)
+
+			return
+		}
+
+		io.WriteString(writer, payload)
+		writer.Close()
+
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(buf.Bytes())
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: &CompressionTransport{MinBodySize: 16}}
+
+	for _, tcase := range []struct {
+		name     string
+		encoding string
+		body     string
+		gzipped  bool
+		err      error
+	}{
+		{"identity", "", "", false, nil},
+		{"gzip response", "gzip", "", false, nil},
+		{"deflate response", "deflate", "", false, nil},
+		{"zstd response", "zstd", "", false, nil},
+		{"brotli response", "br", "", false, nil},
+		{"small body", "", `{"q":1}`, false, nil},
+		{"large body", "gzip", `{"query":"{ candles { open close } }"}`, true, nil},
+		{"unsupported encoding", "compress", "", false, ErrUnsupportedEncoding},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var body io.Reader = http.NoBody
+			if tcase.body != "" {
+				body = strings.NewReader(tcase.body)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+"?encoding="+tcase.encoding, body)
+			if err != nil {
+				t.Fatalf("error creating request: %v", err)
+			}
+
+			rsp, err := client.Do(req)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("expected error %v, got %v", tcase.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			defer rsp.Body.Close()
+
+			decoded, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatalf("error reading response: %v", err)
+			}
+
+			if string(decoded) != payload {
+				t.Fatalf("expected decoded response %s, got %s", payload, decoded)
+			}
+
+			if got := rsp.Header.Get("X-Accept-Encoding"); got != acceptEncoding {
+				t.Fatalf("expected the request to accept %q, got %q", acceptEncoding, got)
+			}
+
+			if gzipped := rsp.Header.Get("X-Request-Encoding") == "gzip"; gzipped != tcase.gzipped {
+				t.Fatalf("expected the request body to be gzipped: %v", tcase.gzipped)
+			}
+
+			if got := rsp.Header.Get("X-Request-Body"); got != tcase.body {
+				t.Fatalf("expected the server to receive %q, got %q", tcase.body, got)
+			}
+		})
+	}
+}
+
+func TestCompressionTransportDisableDecompression(t *testing.T) {
+	t.Parallel()
+
+	// The server mis-reports the encoding of its responses.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", "gzip")
+		io.WriteString(w, `[{"id":1}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: &CompressionTransport{DisableDecompression: true}}
+
+	rsp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatalf("error reading response: %v", err)
+	}
+
+	if string(body) != `[{"id":1}]` {
+		t.Fatalf("expected the response as it was sent, got %s", body)
+	}
+
+	if got := rsp.Header.Get("X-Accept-Encoding"); got != "identity" {
+		t.Fatalf("expected the request to accept %q, got %q", "identity", got)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package planning is the planner of gidari, which flattens the requests of a configuration into the web requests that
+// a Transport operation makes: one for each timeseries chunk and granularity of a request, with its URL, chunk range,
+// and tables. Tooling can use the planned requests for estimation, visualization, or custom executors:
+//
+//	requests, err := planning.Plan(ctx, cfg)
+//	if err != nil {
+//		return err
+//	}
+//
+//	for _, req := range requests {
+//		fmt.Println(req.Method, req.URL, req.Tables, req.ChunkStart, req.ChunkEnd)
+//	}
+package planning
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alpine-hodler/gidari"
+	"github.com/alpine-hodler/gidari/internal/transport"
+)
+
+// Request is a web request that a Transport operation makes.
+type Request = transport.PlannedRequest
+
+// Plan will flatten the requests of the configuration into the web requests that a Transport operation makes, in the
+// order of the configuration, without making any web requests or resolving the secrets of the authentication. A
+// snapshot is not resumed, so the requests are those of a run from the start.
+func Plan(ctx context.Context, cfg *gidari.Config) ([]*Request, error) {
+	requests, err := transport.PlanRequests(ctx, &cfg.Config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to plan the config: %w", err)
+	}
+
+	return requests, nil
+}
+
+// Tables will group the planned requests by the tables that their records are upserted into. A request whose response
+// is split is in the group of each of its tables.
+func Tables(requests []*Request) map[string][]*Request {
+	tables := make(map[string][]*Request)
+
+	for _, req := range requests {
+		for _, table := range req.Tables {
+			tables[table] = append(tables[table], req)
+		}
+	}
+
+	return tables
+}
@@ -30,6 +30,7 @@ type Generic interface {
 	storage.Transactor
 
 	Transact(fn func(ctx context.Context, repo Generic) error)
+	TransactContext(ctx context.Context, fn func(ctx context.Context, repo Generic) error)
 }
 
 // GenericService is the implementation of the Generic service.
@@ -67,7 +68,13 @@ func NewTx(ctx context.Context, dns string) (*GenericService, error) {
 // Transact is a helper function that wraps a function in a transaction and commits or rolls back the transaction. If
 // svc is not a transaction, the function will be executed without executing.
 func (svc *GenericService) Transact(fn func(ctx context.Context, repo Generic) error) {
-	svc.Txn.Send(func(ctx context.Context, stg storage.Storage) error {
+	svc.TransactContext(context.Background(), fn)
+}
+
+// TransactContext is like Transact, but the function is called with a context that carries the transaction and is
+// derived from ctx, so canceling ctx or setting a deadline on it cancels the storage operations of the function.
+func (svc *GenericService) TransactContext(ctx context.Context, fn func(ctx context.Context, repo Generic) error) {
+	svc.Txn.SendContext(ctx, func(ctx context.Context, stg storage.Storage) error {
 		err := fn(ctx, svc)
 		if err != nil {
 			return fmt.Errorf("error executing transaction: %w", err)
@@ -77,6 +84,36 @@ func (svc *GenericService) Transact(fn func(ctx context.Context, repo Generic) e
 	})
 }
 
+// Scan will call fn with every record of a table, if the storage supports it.
+func (svc *GenericService) Scan(ctx context.Context, table string, fn func(record map[string]interface{}) error) error {
+	if err := storage.Scan(ctx, svc.Storage, table, fn); err != nil {
+		return fmt.Errorf("error scanning table: %w", err)
+	}
+
+	return nil
+}
+
+// Find will call fn with every record of a table that matches any of the keys, if the storage supports it.
+func (svc *GenericService) Find(ctx context.Context, table string, keys []map[string]interface{},
+	fn func(record map[string]interface{}) error,
+) error {
+	if err := storage.Find(ctx, svc.Storage, table, keys, fn); err != nil {
+		return fmt.Errorf("error finding records: %w", err)
+	}
+
+	return nil
+}
+
+// TryLock will acquire an advisory lock of the key, if the storage supports it.
+func (svc *GenericService) TryLock(ctx context.Context, key string) (func() error, error) {
+	release, err := storage.TryLock(ctx, svc.Storage, key)
+	if err != nil {
+		return nil, fmt.Errorf("error locking storage: %w", err)
+	}
+
+	return release, nil
+}
+
 // Truncate truncates a table.
 func (svc *GenericService) Truncate(ctx context.Context, req *proto.TruncateRequest) (*proto.TruncateResponse, error) {
 	rsp, err := svc.Storage.Truncate(ctx, req)
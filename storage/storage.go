@@ -0,0 +1,98 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package storage is the API for adding storage backends, e.g. proprietary databases, from external modules. A backend
+// implements Storage and is registered by the scheme of its DNS from the init function of its package:
+//
+//	func init() {
+//		storage.Register("mydb", func(ctx context.Context, dns string) (storage.Storage, error) {
+//			return NewMyDB(ctx, dns)
+//		})
+//	}
+//
+// The "storagetest" package verifies that a backend behaves like the built-in storage.
+package storage
+
+import (
+	"context"
+
+	"github.com/alpine-hodler/gidari/internal/storage"
+	"github.com/alpine-hodler/gidari/proto"
+)
+
+// Column types of a table definition.
+const (
+	ColumnTypeString    = storage.ColumnTypeString
+	ColumnTypeInteger   = storage.ColumnTypeInteger
+	ColumnTypeNumber    = storage.ColumnTypeNumber
+	ColumnTypeBoolean   = storage.ColumnTypeBoolean
+	ColumnTypeTimestamp = storage.ColumnTypeTimestamp
+	ColumnTypeJSON      = storage.ColumnTypeJSON
+)
+
+// Storage is the interface of a storage backend.
+type Storage = storage.Storage
+
+// Scanner is implemented by the storage backends that can read every record of a table, which is required to compute
+// the checksums of their tables.
+type Scanner = storage.Scanner
+
+// Locker is implemented by the storage backends that support advisory locks, which is required to lock the runs of
+// a configuration on them.
+type Locker = storage.Locker
+
+// Factory will construct a storage backend from a DNS.
+type Factory = storage.Factory
+
+// Txn is a transaction of a storage backend, returned by the StartTx method of Storage.
+type Txn = storage.Txn
+
+// TxnChanFn is an operation of a transaction.
+type TxnChanFn = storage.TxnChanFn
+
+// TxnHooks are the functions of a storage backend that end a transaction started with NewTxn.
+type TxnHooks = storage.TxnHooks
+
+// Register will add a storage backend that is constructed by the factory for a DNS with the scheme, e.g.
+// "mydb" for "mydb://localhost:9000/db". It panics if the factory is nil, or if the scheme is empty,
+// already registered, or a scheme of the built-in storage.
+func Register(scheme string, factory Factory) {
+	storage.Register(scheme, factory)
+}
+
+// NewTxn will return a transaction that executes the operations sent to it on the storage, in the order they are sent,
+// and calls the hook of the decision to commit or rollback. Backends use it to implement StartTx.
+func NewTxn(ctx context.Context, stg Storage, hooks TxnHooks) *Txn {
+	return storage.NewTxn(ctx, stg, hooks)
+}
+
+// Server serves a storage backend as the Storage service of the proto package, e.g. on a gRPC server with
+// proto.RegisterStorageServer(server, storage.NewServer(stg)).
+type Server = storage.Server
+
+// NewServer will return a server of the Storage service for the storage backend.
+func NewServer(stg Storage) *Server {
+	return storage.NewServer(stg)
+}
+
+// UpsertStream is the server side of a client stream of upsert batches, e.g. of the UpsertStream RPC of the Storage
+// service of the proto package.
+type UpsertStream = storage.UpsertStream
+
+// ServeUpsertStream will upsert the batches of the stream on the storage in order, and acknowledge every batch with the
+// counts of its records once the stream ends. It returns with the error of the first batch that fails.
+func ServeUpsertStream(ctx context.Context, stg Storage, stream UpsertStream) error {
+	return storage.ServeUpsertStream(ctx, stg, stream)
+}
+
+// TruncateBatch will execute the truncates of the batch on the storage in order, until one fails.
+func TruncateBatch(ctx context.Context, stg Storage, req *proto.TruncateBatchRequest) (*proto.TruncateBatchResponse,
+	error,
+) {
+	return storage.TruncateBatch(ctx, stg, req)
+}
@@ -0,0 +1,259 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+
+// Package storagetest provides a conformance test suite for storage backends, e.g. those added with storage.Register,
+// so that the authors of a backend can verify that it upserts, truncates, and transacts like the built-in storage.
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/alpine-hodler/gidari/proto"
+	"github.com/alpine-hodler/gidari/storage"
+	"github.com/alpine-hodler/gidari/tools"
+)
+
+// TablePrefix is the prefix of the tables that the conformance suite creates, upserts into, and truncates.
+const TablePrefix = "conformance_"
+
+var errConformance = fmt.Errorf("conformance error")
+
+// records are the records upserted by the conformance suite.
+var records = []map[string]interface{}{
+	{"id": "1", "test_string": "alpha"},
+	{"id": "2", "test_string": "beta"},
+}
+
+// Run will run the conformance suite against the storage. Every test of the suite uses its own table, named with the
+// TablePrefix, so the storage should be a database dedicated to testing. The tables are truncated when the suite is
+// done, but they are not dropped.
+func Run(t *testing.T, stg storage.Storage) {
+	t.Helper()
+
+	t.Run("upsert", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		table := createTable(ctx, t, stg, "upsert")
+
+		for i := 0; i < 2; i++ {
+			rsp, err := stg.Upsert(ctx, upsertRequest(t, table))
+			if err != nil {
+				t.Fatalf("failed to upsert records: %v", err)
+			}
+
+			if got := rsp.GetUpsertedCount() + rsp.GetMatchedCount(); got != int64(len(records)) {
+				t.Fatalf("expected upsert %d to write %d records, got %d", i+1, len(records), got)
+			}
+
+			if len(rsp.GetErrors()) != 0 {
+				t.Fatalf("expected no record errors, got %v", rsp.GetErrors())
+			}
+		}
+
+		if tableSize(ctx, t, stg, table) == 0 {
+			t.Fatalf("expected records in %q", table)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		table := createTable(ctx, t, stg, "truncate")
+
+		if _, err := stg.Upsert(ctx, upsertRequest(t, table)); err != nil {
+			t.Fatalf("failed to upsert records: %v", err)
+		}
+
+		if _, err := stg.Truncate(ctx, &proto.TruncateRequest{Tables: []string{table}}); err != nil {
+			t.Fatalf("failed to truncate %q: %v", table, err)
+		}
+
+		if size := tableSize(ctx, t, stg, table); size != 0 {
+			t.Fatalf("expected %q to be empty, got size %d", table, size)
+		}
+
+		if _, err := stg.Truncate(ctx, &proto.TruncateRequest{}); err != nil {
+			t.Fatalf("expected truncating no tables to succeed, got %v", err)
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		table := createTable(ctx, t, stg, "commit")
+
+		txn := startTx(ctx, t, stg)
+		txn.Send(upsertFn(t, table))
+
+		if err := txn.Commit(); err != nil {
+			t.Fatalf("failed to commit transaction: %v", err)
+		}
+
+		if tableSize(ctx, t, stg, table) == 0 {
+			t.Fatalf("expected the committed records in %q", table)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		table := createTable(ctx, t, stg, "rollback")
+
+		txn := startTx(ctx, t, stg)
+		txn.Send(upsertFn(t, table))
+
+		if err := txn.Rollback(); err != nil {
+			t.Fatalf("failed to rollback transaction: %v", err)
+		}
+
+		if size := tableSize(ctx, t, stg, table); size != 0 {
+			t.Fatalf("expected the records in %q to be rolled back, got size %d", table, size)
+		}
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		table := createTable(ctx, t, stg, "rollback_on_error")
+
+		txn := startTx(ctx, t, stg)
+		txn.Send(upsertFn(t, table))
+		txn.Send(func(context.Context, storage.Storage) error { return errConformance })
+
+		var sentAfterError bool
+
+		txn.Send(func(context.Context, storage.Storage) error {
+			sentAfterError = true
+
+			return nil
+		})
+
+		if err := txn.Commit(); err == nil {
+			t.Fatalf("expected the commit of a failed transaction to return an error")
+		}
+
+		if sentAfterError {
+			t.Fatalf("expected the operations after an error to be skipped")
+		}
+
+		if size := tableSize(ctx, t, stg, table); size != 0 {
+			t.Fatalf("expected the records in %q to be rolled back, got size %d", table, size)
+		}
+	})
+
+	t.Run("transact", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		tables := []string{createTable(ctx, t, stg, "transact_a"), createTable(ctx, t, stg, "transact_b")}
+
+		txn := startTx(ctx, t, stg)
+		for _, table := range tables {
+			txn.SendContext(ctx, upsertFn(t, table))
+		}
+
+		if err := txn.Commit(); err != nil {
+			t.Fatalf("failed to commit transaction: %v", err)
+		}
+
+		for _, table := range tables {
+			if tableSize(ctx, t, stg, table) == 0 {
+				t.Fatalf("expected the committed records in %q", table)
+			}
+		}
+	})
+}
+
+// createTable will create an empty table for a test of the suite, and truncate it when the test is done.
+func createTable(ctx context.Context, t *testing.T, stg storage.Storage, name string) string {
+	t.Helper()
+
+	table := TablePrefix + name
+
+	_, err := stg.CreateTable(ctx, &proto.CreateTableRequest{
+		Table: table,
+		Columns: []*proto.Column{
+			{Name: "id", Type: storage.ColumnTypeString, Required: true},
+			{Name: "test_string", Type: storage.ColumnTypeString},
+		},
+		PrimaryKeys: []string{"id"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create table %q: %v", table, err)
+	}
+
+	truncate := func() {
+		if _, err := stg.Truncate(ctx, &proto.TruncateRequest{Tables: []string{table}}); err != nil {
+			t.Fatalf("failed to truncate %q: %v", table, err)
+		}
+	}
+
+	truncate()
+	t.Cleanup(truncate)
+
+	return table
+}
+
+// startTx will start a transaction, failing the test if it can not be started.
+func startTx(ctx context.Context, t *testing.T, stg storage.Storage) *storage.Txn {
+	t.Helper()
+
+	txn, err := stg.StartTx(ctx)
+	if err != nil {
+		t.Fatalf("failed to start transaction: %v", err)
+	}
+
+	return txn
+}
+
+// upsertRequest will return a request to upsert the records of the suite into the table.
+func upsertRequest(t *testing.T, table string) *proto.UpsertRequest {
+	t.Helper()
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatalf("failed to marshal records: %v", err)
+	}
+
+	return &proto.UpsertRequest{Table: table, Data: data, DataType: int32(tools.UpsertDataJSON)}
+}
+
+// upsertFn will return a transaction operation that upserts the records of the suite into the table.
+func upsertFn(t *testing.T, table string) storage.TxnChanFn {
+	t.Helper()
+
+	req := upsertRequest(t, table)
+
+	return func(ctx context.Context, stg storage.Storage) error {
+		if _, err := stg.Upsert(ctx, req); err != nil {
+			return fmt.Errorf("failed to upsert records: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// tableSize will return the size of the table in the storage.
+func tableSize(ctx context.Context, t *testing.T, stg storage.Storage, table string) int64 {
+	t.Helper()
+
+	rsp, err := stg.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+
+	return rsp.GetTableSet()[table].GetSize()
+}
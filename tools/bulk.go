@@ -0,0 +1,384 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// maxLayoutFields is the maximum number of field names of a layout. The records of tables whose field names are
+// data, e.g. objects keyed by the IDs of products, do not grow their layout past it.
+const maxLayoutFields = 1 << 10
+
+// recordLayouts are the field layouts of the records of each table that are encoded by the bulk encoder. The layout of
+// a table is shared by every response of the table, so that responses with the same schema, e.g. the thousands of
+// chunks of a candles backfill, do not discover the fields of their records again.
+var recordLayouts sync.Map
+
+// recordLayout are the field names of the records of a table. The names are interned, so that the records of every
+// response share the strings of their field names rather than allocating them for every record.
+type recordLayout struct {
+	names map[string]string
+}
+
+// layout will return the layout of the table, which is empty if no record of the table has been encoded.
+func layout(table string) *recordLayout {
+	if layout, ok := recordLayouts.Load(table); ok {
+		return layout.(*recordLayout)
+	}
+
+	return &recordLayout{names: map[string]string{}}
+}
+
+// bulkEncoder encodes the JSON records of an upsert request to structs, reusing the layout of their table. It is a
+// fast path of DecodeUpsertRecords: the records are scanned once, without decoding them to interface values and
+// encoding every record to JSON again, and their fields are matched against the names of the layout. Any JSON that the
+// encoder does not expect, e.g. a malformed record, fails the fast path, and the records are decoded by the general
+// path instead, so that it reports the error.
+type bulkEncoder struct {
+	data   []byte
+	pos    int
+	layout *recordLayout
+
+	// added are the field names that are not in the layout of the table, which are added to it once the records are
+	// encoded.
+	added map[string]string
+}
+
+// encodeBulkRecords will encode the JSON records of the table, which are an array of objects or a single object. The
+// second value is false if the records can not be encoded by the fast path.
+func encodeBulkRecords(table string, data []byte) ([]*structpb.Struct, bool) {
+	enc := &bulkEncoder{data: data, layout: layout(table)}
+
+	records, ok := enc.records()
+	if !ok {
+		return nil, false
+	}
+
+	if len(enc.added) > 0 && len(enc.layout.names)+len(enc.added) <= maxLayoutFields {
+		names := make(map[string]string, len(enc.layout.names)+len(enc.added))
+		for _, fields := range []map[string]string{enc.layout.names, enc.added} {
+			for name := range fields {
+				names[name] = name
+			}
+		}
+
+		recordLayouts.Store(table, &recordLayout{names: names})
+	}
+
+	return records, true
+}
+
+// records will encode the records of the data.
+func (enc *bulkEncoder) records() ([]*structpb.Struct, bool) {
+	switch enc.peek() {
+	case '{':
+		record, ok := enc.object()
+		if !ok || !enc.end() {
+			return nil, false
+		}
+
+		return []*structpb.Struct{record}, true
+	case '[':
+		enc.pos++
+	default:
+		return nil, false
+	}
+
+	var records []*structpb.Struct
+
+	if enc.peek() == ']' {
+		enc.pos++
+
+		return records, enc.end()
+	}
+
+	for {
+		if enc.peek() != '{' {
+			return nil, false
+		}
+
+		record, ok := enc.object()
+		if !ok {
+			return nil, false
+		}
+
+		records = append(records, record)
+
+		switch enc.peek() {
+		case ',':
+			enc.pos++
+		case ']':
+			enc.pos++
+
+			return records, enc.end()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// object will encode the object at the position of the encoder.
+func (enc *bulkEncoder) object() (*structpb.Struct, bool) {
+	enc.pos++
+
+	record := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(enc.layout.names))}
+
+	if enc.peek() == '}' {
+		enc.pos++
+
+		return record, true
+	}
+
+	for {
+		if enc.peek() != '"' {
+			return nil, false
+		}
+
+		raw, ok := enc.str()
+		if !ok {
+			return nil, false
+		}
+
+		name, ok := enc.name(raw)
+		if !ok || enc.peek() != ':' {
+			return nil, false
+		}
+
+		enc.pos++
+
+		value, ok := enc.value()
+		if !ok {
+			return nil, false
+		}
+
+		record.Fields[name] = value
+
+		switch enc.peek() {
+		case ',':
+			enc.pos++
+		case '}':
+			enc.pos++
+
+			return record, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// name will return the interned field name of the raw JSON string of a field. Names with escapes are unquoted before
+// they are looked up.
+func (enc *bulkEncoder) name(raw []byte) (string, bool) {
+	if unquoted := raw[1 : len(raw)-1]; bytes.IndexByte(unquoted, '\\') < 0 {
+		if name, ok := enc.layout.names[string(unquoted)]; ok {
+			return name, true
+		}
+	}
+
+	name, ok := enc.unquote(raw)
+	if !ok {
+		return "", false
+	}
+
+	if interned, ok := enc.added[name]; ok {
+		return interned, true
+	}
+
+	if enc.added == nil {
+		enc.added = make(map[string]string)
+	}
+
+	enc.added[name] = name
+
+	return name, true
+}
+
+// value will encode the value at the position of the encoder.
+func (enc *bulkEncoder) value() (*structpb.Value, bool) {
+	switch char := enc.peek(); {
+	case char == '"':
+		raw, ok := enc.str()
+		if !ok {
+			return nil, false
+		}
+
+		str, ok := enc.unquote(raw)
+		if !ok {
+			return nil, false
+		}
+
+		return structpb.NewStringValue(str), true
+	case char == '{' || char == '[':
+		return enc.composite()
+	case char == '-' || isDigit(char):
+		return enc.number()
+	case enc.literal("true"):
+		return structpb.NewBoolValue(true), true
+	case enc.literal("false"):
+		return structpb.NewBoolValue(false), true
+	case enc.literal("null"):
+		return structpb.NewNullValue(), true
+	default:
+		return nil, false
+	}
+}
+
+// literal will advance the encoder past the literal if it is at its position.
+func (enc *bulkEncoder) literal(literal string) bool {
+	end := enc.pos + len(literal)
+	if end > len(enc.data) || string(enc.data[enc.pos:end]) != literal {
+		return false
+	}
+
+	enc.pos = end
+
+	return true
+}
+
+// number will encode the number at the position of the encoder.
+func (enc *bulkEncoder) number() (*structpb.Value, bool) {
+	start := enc.pos
+
+	for enc.pos < len(enc.data) && isNumberChar(enc.data[enc.pos]) {
+		enc.pos++
+	}
+
+	raw := enc.data[start:enc.pos]
+
+	// Leading zeros are not valid JSON, although they are parsed as a float.
+	if digits := bytes.TrimPrefix(raw, []byte("-")); len(digits) > 1 && digits[0] == '0' && isDigit(digits[1]) {
+		return nil, false
+	}
+
+	num, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return structpb.NewNumberValue(num), true
+}
+
+// isNumberChar will return true if the character can be a character of a JSON number.
+func isNumberChar(char byte) bool {
+	return isDigit(char) || char == '-' || char == '+' || char == '.' || char == 'e' || char == 'E'
+}
+
+// isDigit will return true if the character is a decimal digit.
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+// composite will encode the object or array at the position of the encoder. Nested values are rare in the records
+// of timeseries, so they are decoded by the JSON package.
+func (enc *bulkEncoder) composite() (*structpb.Value, bool) {
+	start, depth := enc.pos, 0
+
+	for enc.pos < len(enc.data) {
+		switch enc.data[enc.pos] {
+		case '"':
+			if _, ok := enc.str(); !ok {
+				return nil, false
+			}
+
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		}
+
+		enc.pos++
+
+		if depth == 0 {
+			break
+		}
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(enc.data[start:enc.pos], &decoded); err != nil {
+		return nil, false
+	}
+
+	value, err := structpb.NewValue(decoded)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// str will return the raw JSON string at the position of the encoder, including its quotes.
+func (enc *bulkEncoder) str() ([]byte, bool) {
+	start := enc.pos
+	enc.pos++
+
+	for enc.pos < len(enc.data) {
+		switch char := enc.data[enc.pos]; {
+		case char == '\\':
+			enc.pos += 2
+		case char == '"':
+			enc.pos++
+
+			return enc.data[start:enc.pos], true
+		case char < ' ':
+			return nil, false
+		default:
+			enc.pos++
+		}
+	}
+
+	return nil, false
+}
+
+// unquote will return the string of a raw JSON string. Strings without escapes are valid as they are.
+func (enc *bulkEncoder) unquote(raw []byte) (string, bool) {
+	unquoted := raw[1 : len(raw)-1]
+
+	if bytes.IndexByte(unquoted, '\\') >= 0 {
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return "", false
+		}
+
+		return str, true
+	}
+
+	// Invalid UTF-8 is replaced by the JSON package, so those strings are left to the general path.
+	if !utf8.Valid(unquoted) {
+		return "", false
+	}
+
+	return string(unquoted), true
+}
+
+// peek will skip the whitespace at the position of the encoder and return the character after it, or zero at the end
+// of the data.
+func (enc *bulkEncoder) peek() byte {
+	for enc.pos < len(enc.data) {
+		switch char := enc.data[enc.pos]; char {
+		case ' ', '\t', '\n', '\r':
+			enc.pos++
+		default:
+			return char
+		}
+	}
+
+	return 0
+}
+
+// end will return true if only whitespace follows the position of the encoder.
+func (enc *bulkEncoder) end() bool {
+	return enc.peek() == 0 && enc.pos == len(enc.data)
+}
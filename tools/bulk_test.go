@@ -0,0 +1,150 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	gproto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// decodeGeneralRecords will decode the records with the general path of DecodeUpsertRecords.
+func decodeGeneralRecords(t testing.TB, data string) []*structpb.Struct {
+	t.Helper()
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatalf("failed to unmarshal records: %v", err)
+	}
+
+	records, err := decodeRecords(decoded)
+	if err != nil {
+		t.Fatalf("failed to decode records: %v", err)
+	}
+
+	return records
+}
+
+func TestEncodeBulkRecords(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+	}{
+		{name: "records", data: `[{"time":"2022-05-10T00:00:00Z","open":1.5,"volume":-20,"closed":true},` +
+			`{"time":"2022-05-10T00:01:00Z","open":2e3,"volume":0,"closed":false,"note":null}]`},
+		{name: "single record", data: ` {"id": "BTC-USD", "min_size": 0.001} `},
+		{name: "no records", data: `[]`},
+		{name: "empty record", data: `[{}]`},
+		{name: "nested values", data: `[{"id":"1","bids":[["1.5","2"]],"meta":{"tags":["a"],"q":"x\"y"}}]`},
+		{name: "escapes", data: `[{"name":"café \n\"quoted\"","unicode":"日本"}]`},
+		{name: "duplicate fields", data: `[{"id":"1","id":"2"}]`},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			records, ok := encodeBulkRecords("bulk_"+tcase.name, []byte(tcase.data))
+			if !ok {
+				t.Fatalf("expected the records to be encoded by the fast path")
+			}
+
+			expected := decodeGeneralRecords(t, tcase.data)
+			if len(records) != len(expected) {
+				t.Fatalf("expected %d records, got %d", len(expected), len(records))
+			}
+
+			for idx := range expected {
+				if !gproto.Equal(records[idx], expected[idx]) {
+					t.Fatalf("expected record %d to be %v, got %v", idx, expected[idx], records[idx])
+				}
+			}
+		})
+	}
+
+	for _, data := range []string{
+		`[{"id":1},]`,
+		`[{"id":01}]`,
+		`[{"id":1}] [`,
+		`[1, 2]`,
+		`"records"`,
+		`[{"id":"` + "\xff" + `"}]`,
+		`[{"id":tru}]`,
+		`[{"id":1e999}]`,
+		`[{"id":"1"}`,
+	} {
+		if _, ok := encodeBulkRecords("bulk_invalid", []byte(data)); ok {
+			t.Fatalf("expected %q not to be encoded by the fast path", data)
+		}
+	}
+}
+
+func TestEncodeBulkRecordsLayout(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := encodeBulkRecords("bulk_layout", []byte(`[{"time":"a","open":1}]`)); !ok {
+		t.Fatalf("expected the records to be encoded by the fast path")
+	}
+
+	if _, ok := encodeBulkRecords("bulk_layout", []byte(`[{"time":"b","close":2}]`)); !ok {
+		t.Fatalf("expected the records to be encoded by the fast path")
+	}
+
+	names := layout("bulk_layout").names
+	if len(names) != 3 || names["time"] != "time" || names["open"] != "open" || names["close"] != "close" {
+		t.Fatalf("expected the layout to hold the fields of both responses, got %v", names)
+	}
+
+	fields := make([]string, 0, maxLayoutFields+1)
+	for idx := 0; idx <= maxLayoutFields; idx++ {
+		fields = append(fields, fmt.Sprintf(`"product_%d":1`, idx))
+	}
+
+	if _, ok := encodeBulkRecords("bulk_keyed", []byte("{"+strings.Join(fields, ",")+"}")); !ok {
+		t.Fatalf("expected the records to be encoded by the fast path")
+	}
+
+	if names := layout("bulk_keyed").names; len(names) != 0 {
+		t.Fatalf("expected the layout not to grow past %d fields, got %d", maxLayoutFields, len(names))
+	}
+}
+
+// benchmarkCandles are the records of a response of candles, which share the schema of every candles response.
+func benchmarkCandles() []byte {
+	candles := make([]string, 0, 300)
+	for idx := 0; idx < 300; idx++ {
+		candles = append(candles, fmt.Sprintf(`{"product_id":"BTC-USD","time":"2022-05-10T00:%02d:00Z","open":%d.5,`+
+			`"high":%d.75,"low":%d.25,"close":%d.5,"volume":%d.125}`, idx%60, idx, idx, idx, idx, idx))
+	}
+
+	return []byte("[" + strings.Join(candles, ",") + "]")
+}
+
+func BenchmarkEncodeBulkRecords(b *testing.B) {
+	data := benchmarkCandles()
+
+	b.Run("bulk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, ok := encodeBulkRecords("bulk_benchmark", data); !ok {
+				b.Fatalf("expected the records to be encoded by the fast path")
+			}
+		}
+	})
+
+	b.Run("general", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decodeGeneralRecords(b, string(data))
+		}
+	})
+}
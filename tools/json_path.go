@@ -0,0 +1,140 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrJSONPathNotFound    = fmt.Errorf("json path not found")
+	ErrUnsupportedJSONTime = fmt.Errorf("unsupported json time")
+)
+
+// JSONPathNotFoundError is returned when a path does not exist in decoded JSON data.
+func JSONPathNotFoundError(path string) error {
+	return fmt.Errorf("%w: %q", ErrJSONPathNotFound, path)
+}
+
+// LookupJSONPath will return the value at the dot-separated path in decoded JSON data. Numeric segments of the path
+// are used to index into arrays, e.g. "data.0.id". An empty path returns the data itself.
+func LookupJSONPath(data interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return data, nil
+	}
+
+	val := data
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := val.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return nil, JSONPathNotFoundError(path)
+			}
+
+			val = next
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, JSONPathNotFoundError(path)
+			}
+
+			val = node[idx]
+		default:
+			return nil, JSONPathNotFoundError(path)
+		}
+	}
+
+	return val, nil
+}
+
+// ExtractJSONPath will return the JSON encoded value at the dot-separated path of the JSON encoded data.
+func ExtractJSONPath(data []byte, path string) ([]byte, error) {
+	if path == "" {
+		return data, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFailedToUnmarshalJSON, err)
+	}
+
+	val, err := LookupJSONPath(decoded, path)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := json.Marshal(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFailedToMarshalJSON, err)
+	}
+
+	return bytes, nil
+}
+
+// SetJSONFields will set the fields on every record of the JSON encoded data. The data can be a single JSON object or
+// an array of JSON objects.
+func SetJSONFields(data []byte, fields map[string]interface{}) ([]byte, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFailedToUnmarshalJSON, err)
+	}
+
+	records, ok := decoded.([]interface{})
+	if !ok {
+		records = []interface{}{decoded}
+	}
+
+	for _, record := range records {
+		obj, ok := record.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedDataType, record)
+		}
+
+		for key, val := range fields {
+			obj[key] = val
+		}
+	}
+
+	bytes, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFailedToMarshalJSON, err)
+	}
+
+	return bytes, nil
+}
+
+// ParseJSONTime will parse a decoded JSON value into a time. The value may be a number of seconds since the unix epoch
+// or an RFC3339 string.
+func ParseJSONTime(val interface{}) (time.Time, error) {
+	switch val := val.(type) {
+	case float64:
+		sec, frac := math.Modf(val)
+
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, val)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %v", ErrUnsupportedJSONTime, err)
+		}
+
+		return parsed, nil
+	default:
+		return time.Time{}, fmt.Errorf("%w: %v", ErrUnsupportedJSONTime, val)
+	}
+}
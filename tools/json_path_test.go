@@ -0,0 +1,108 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package tools
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExtractJSONPath(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{"data":{"trades":[{"id":1},{"id":2}],"orders":[]},"meta":{"next":"abc"}}`)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+		err      error
+	}{
+		{name: "empty path", path: "", expected: string(data)},
+		{name: "nested object", path: "meta", expected: `{"next":"abc"}`},
+		{name: "nested array", path: "data.trades", expected: `[{"id":1},{"id":2}]`},
+		{name: "array index", path: "data.trades.1.id", expected: `2`},
+		{name: "string value", path: "meta.next", expected: `"abc"`},
+		{name: "missing key", path: "data.fills", err: ErrJSONPathNotFound},
+		{name: "index out of range", path: "data.trades.2", err: ErrJSONPathNotFound},
+		{name: "path through scalar", path: "meta.next.value", err: ErrJSONPathNotFound},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ExtractJSONPath(data, test.path)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if string(actual) != test.expected {
+				t.Errorf("ExtractJSONPath(%q) = %s; want %s", test.path, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestSetJSONFields(t *testing.T) {
+	t.Parallel()
+
+	fields := map[string]interface{}{"cursor": "abc"}
+
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+		err      error
+	}{
+		{name: "array", data: `[{"id":1},{"id":2}]`, expected: `[{"cursor":"abc","id":1},{"cursor":"abc","id":2}]`},
+		{name: "object", data: `{"id":1}`, expected: `{"cursor":"abc","id":1}`},
+		{name: "scalar records", data: `[1,2]`, err: ErrUnsupportedDataType},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := SetJSONFields([]byte(test.data), fields)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if string(actual) != test.expected {
+				t.Errorf("SetJSONFields(%s) = %s; want %s", test.data, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseJSONTime(t *testing.T) {
+	t.Parallel()
+
+	expected := time.Date(2022, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, val := range []interface{}{float64(expected.Unix()), "2022-05-10T00:00:00Z"} {
+		actual, err := ParseJSONTime(val)
+		if err != nil {
+			t.Fatalf("ParseJSONTime(%v) returned error: %v", val, err)
+		}
+
+		if !actual.Equal(expected) {
+			t.Errorf("ParseJSONTime(%v) = %v; want %v", val, actual, expected)
+		}
+	}
+
+	if _, err := ParseJSONTime(true); !errors.Is(err, ErrUnsupportedJSONTime) {
+		t.Errorf("expected unsupported json time error, got %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package tools
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The keys of the fields of a log event on a logrus entry.
+const (
+	// LogEventWorkerID is the key of the worker id, an int.
+	LogEventWorkerID = "worker_id"
+
+	// LogEventWorkerName is the key of the worker name, a string.
+	LogEventWorkerName = "worker"
+
+	// LogEventDuration is the key of the duration, a time.Duration.
+	LogEventDuration = "duration"
+
+	// LogEventHost is the key of the host name, a string.
+	LogEventHost = "host"
+
+	// LogEventTable is the key of the table, a string.
+	LogEventTable = "table"
+
+	// LogEventUpsertedCount is the key of the upserted count, an int64.
+	LogEventUpsertedCount = "upserted"
+
+	// LogEventMatchedCount is the key of the matched count, an int64.
+	LogEventMatchedCount = "matched"
+
+	// LogEventDeletedCount is the key of the deleted count, an int64.
+	LogEventDeletedCount = "deleted"
+
+	// LogEventCount is the key of the count, an int.
+	LogEventCount = "count"
+
+	// LogEventTotal is the key of the total, an int.
+	LogEventTotal = "total"
+
+	// LogEventPrevious is the key of the previous count, an int.
+	LogEventPrevious = "previous"
+
+	// LogEventBytes is the key of the size in bytes, an int64.
+	LogEventBytes = "bytes"
+
+	// LogEventAttempt is the key of the attempt, an int.
+	LogEventAttempt = "attempt"
+
+	// LogEventDelay is the key of the delay, a time.Duration.
+	LogEventDelay = "delay"
+
+	// LogEventSince is the key of the start of a time range, a time.Time.
+	LogEventSince = "since"
+
+	// LogEventUntil is the key of the end of a time range, a time.Time.
+	LogEventUntil = "until"
+
+	// LogEventURL is the key of the URL, a string.
+	LogEventURL = "url"
+
+	// LogEventPath is the key of the path, a string.
+	LogEventPath = "path"
+
+	// LogEventFile is the key of the file, a string.
+	LogEventFile = "file"
+
+	// LogEventStorage is the key of the storage, a string.
+	LogEventStorage = "storage"
+
+	// LogEventName is the key of the name, a string.
+	LogEventName = "name"
+
+	// LogEventRunID is the key of the run id, a string.
+	LogEventRunID = "run_id"
+
+	// LogEventRecord is the key of the index of a record, an int64.
+	LogEventRecord = "record"
+
+	// LogEventRateLimiterTime, LogEventNetworkTime, and LogEventStorageTime are the keys of the timings of a run,
+	// time.Durations.
+	LogEventRateLimiterTime = "rate_limiter_time"
+	LogEventNetworkTime     = "network_time"
+	LogEventStorageTime     = "storage_time"
+
+	// LogEventError is the key of the error, an error, which is the default key of logrus.WithError.
+	LogEventError = "error"
+)
+
+// LogEvent is a structured log message. Its data is logged as the fields of a logrus entry rather than formatted into
+// the message, so that the formatter of the logger, e.g. logrus.JSONFormatter, writes counts and durations as values,
+// and hooks of the logger, e.g. to export metrics, can read the event from the entry with LogEventFromEntry.
+//
+// The message of an event is constant, e.g. "retrying request", and the data it is about, e.g. the attempt and the
+// delay, are the fields of the event.
+type LogEvent struct {
+	WorkerID      int
+	WorkerName    string
+	Duration      time.Duration
+	Host          string
+	Table         string
+	Msg           string
+	UpsertedCount int64
+	MatchedCount  int64
+	DeletedCount  int64
+
+	// Count is the number of the things that the message is about, e.g. the planned requests, and Total is the number
+	// that they are a part of.
+	Count int
+	Total int
+
+	// Previous is the count before the event, e.g. the number of web workers before they were scaled.
+	Previous int
+
+	Bytes   int64
+	Attempt int
+	Delay   time.Duration
+
+	// Since and Until are the time range of the event, e.g. of a timeseries chunk or of a pause.
+	Since time.Time
+	Until time.Time
+
+	URL     string
+	Path    string
+	File    string
+	Storage string
+	Name    string
+	RunID   string
+
+	// Record is the index of a record, e.g. of a record that failed to upsert. It is a pointer since the first record
+	// has the index zero.
+	Record *int64
+
+	// RateLimiterTime, NetworkTime, and StorageTime are the timings of a run.
+	RateLimiterTime time.Duration
+	NetworkTime     time.Duration
+	StorageTime     time.Duration
+
+	Err error
+}
+
+// Fields will return the fields of the event, omitting those that are not set.
+func (event LogEvent) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+
+	if event.WorkerID > 0 {
+		fields[LogEventWorkerID] = event.WorkerID
+	}
+
+	if event.WorkerName != "" {
+		fields[LogEventWorkerName] = event.WorkerName
+	}
+
+	if event.Duration > 0 {
+		fields[LogEventDuration] = event.Duration
+	}
+
+	if event.Host != "" {
+		fields[LogEventHost] = event.Host
+	}
+
+	if event.Table != "" {
+		fields[LogEventTable] = event.Table
+	}
+
+	if event.UpsertedCount > 0 {
+		fields[LogEventUpsertedCount] = event.UpsertedCount
+	}
+
+	if event.MatchedCount > 0 {
+		fields[LogEventMatchedCount] = event.MatchedCount
+	}
+
+	event.addTimeFields(fields)
+	event.addCountFields(fields)
+	event.addStringFields(fields)
+
+	if event.Record != nil {
+		fields[LogEventRecord] = *event.Record
+	}
+
+	if event.Err != nil {
+		fields[LogEventError] = event.Err
+	}
+
+	return fields
+}
+
+func (event LogEvent) addTimeFields(fields logrus.Fields) {
+	for key, value := range map[string]time.Duration{
+		LogEventDelay:           event.Delay,
+		LogEventRateLimiterTime: event.RateLimiterTime,
+		LogEventNetworkTime:     event.NetworkTime,
+		LogEventStorageTime:     event.StorageTime,
+	} {
+		if value > 0 {
+			fields[key] = value
+		}
+	}
+
+	if !event.Since.IsZero() {
+		fields[LogEventSince] = event.Since
+	}
+
+	if !event.Until.IsZero() {
+		fields[LogEventUntil] = event.Until
+	}
+}
+
+func (event LogEvent) addCountFields(fields logrus.Fields) {
+	for key, value := range map[string]int{
+		LogEventCount:    event.Count,
+		LogEventTotal:    event.Total,
+		LogEventPrevious: event.Previous,
+		LogEventAttempt:  event.Attempt,
+	} {
+		if value > 0 {
+			fields[key] = value
+		}
+	}
+
+	if event.DeletedCount > 0 {
+		fields[LogEventDeletedCount] = event.DeletedCount
+	}
+
+	if event.Bytes > 0 {
+		fields[LogEventBytes] = event.Bytes
+	}
+}
+
+func (event LogEvent) addStringFields(fields logrus.Fields) {
+	for key, value := range map[string]string{
+		LogEventURL:     event.URL,
+		LogEventPath:    event.Path,
+		LogEventFile:    event.File,
+		LogEventStorage: event.Storage,
+		LogEventName:    event.Name,
+		LogEventRunID:   event.RunID,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+}
+
+// Log will log the event at the level, with its message and fields. Nil loggers are ignored.
+func (event LogEvent) Log(logger *logrus.Logger, level logrus.Level) {
+	if logger == nil || !logger.IsLevelEnabled(level) {
+		return
+	}
+
+	logger.WithFields(event.Fields()).Log(level, event.Msg)
+}
+
+// LogEventFromEntry will return the event of a logrus entry, e.g. in a hook of the logger. Fields that are not set
+// on the entry, or that have an unexpected type, are zero.
+func LogEventFromEntry(entry *logrus.Entry) LogEvent {
+	if entry == nil {
+		return LogEvent{}
+	}
+
+	event := LogEvent{Msg: entry.Message}
+	event.WorkerID, _ = entry.Data[LogEventWorkerID].(int)
+	event.WorkerName, _ = entry.Data[LogEventWorkerName].(string)
+	event.Duration, _ = entry.Data[LogEventDuration].(time.Duration)
+	event.Host, _ = entry.Data[LogEventHost].(string)
+	event.Table, _ = entry.Data[LogEventTable].(string)
+	event.UpsertedCount, _ = entry.Data[LogEventUpsertedCount].(int64)
+	event.MatchedCount, _ = entry.Data[LogEventMatchedCount].(int64)
+	event.DeletedCount, _ = entry.Data[LogEventDeletedCount].(int64)
+	event.Count, _ = entry.Data[LogEventCount].(int)
+	event.Total, _ = entry.Data[LogEventTotal].(int)
+	event.Previous, _ = entry.Data[LogEventPrevious].(int)
+	event.Bytes, _ = entry.Data[LogEventBytes].(int64)
+	event.Attempt, _ = entry.Data[LogEventAttempt].(int)
+	event.Delay, _ = entry.Data[LogEventDelay].(time.Duration)
+	event.Since, _ = entry.Data[LogEventSince].(time.Time)
+	event.Until, _ = entry.Data[LogEventUntil].(time.Time)
+	event.URL, _ = entry.Data[LogEventURL].(string)
+	event.Path, _ = entry.Data[LogEventPath].(string)
+	event.File, _ = entry.Data[LogEventFile].(string)
+	event.Storage, _ = entry.Data[LogEventStorage].(string)
+	event.Name, _ = entry.Data[LogEventName].(string)
+	event.RunID, _ = entry.Data[LogEventRunID].(string)
+	event.RateLimiterTime, _ = entry.Data[LogEventRateLimiterTime].(time.Duration)
+	event.NetworkTime, _ = entry.Data[LogEventNetworkTime].(time.Duration)
+	event.StorageTime, _ = entry.Data[LogEventStorageTime].(time.Duration)
+	event.Err, _ = entry.Data[LogEventError].(error)
+
+	if record, ok := entry.Data[LogEventRecord].(int64); ok {
+		event.Record = &record
+	}
+
+	return event
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 The Gidari Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// eventHook records the events of the entries it fires on.
+type eventHook struct {
+	events []LogEvent
+}
+
+func (hook *eventHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (hook *eventHook) Fire(entry *logrus.Entry) error {
+	hook.events = append(hook.events, LogEventFromEntry(entry))
+
+	return nil
+}
+
+func TestLogEvent(t *testing.T) {
+	t.Parallel()
+
+	// The first record has the index zero, which is logged.
+	var record int64
+
+	errTest := fmt.Errorf("test error")
+
+	for _, tcase := range []struct {
+		name   string
+		event  LogEvent
+		fields logrus.Fields
+	}{
+		{name: "empty", event: LogEvent{}, fields: logrus.Fields{}},
+		{name: "msg", event: LogEvent{Msg: "hello"}, fields: logrus.Fields{}},
+		{
+			name: "all",
+			event: LogEvent{
+				WorkerID: 1, WorkerName: "repository", Duration: time.Second, Host: "localhost", Table: "candles",
+				Msg: "upserted", UpsertedCount: 2, MatchedCount: 3,
+			},
+			fields: logrus.Fields{
+				LogEventWorkerID: 1, LogEventWorkerName: "repository", LogEventDuration: time.Second,
+				LogEventHost: "localhost", LogEventTable: "candles", LogEventUpsertedCount: int64(2),
+				LogEventMatchedCount: int64(3),
+			},
+		},
+		{
+			name: "data",
+			event: LogEvent{
+				Msg: "retrying request", DeletedCount: 1, Count: 2, Total: 3, Previous: 4, Bytes: 5, Attempt: 6,
+				Delay: time.Second, Since: time.Unix(1, 0), Until: time.Unix(2, 0), URL: "https://api.example.com",
+				Path: "/candles", File: "snapshot.json", Storage: "postgresql", Name: "coinbase", RunID: "run",
+				Record: &record, RateLimiterTime: time.Second, NetworkTime: time.Minute, StorageTime: time.Hour,
+				Err: errTest,
+			},
+			fields: logrus.Fields{
+				LogEventDeletedCount: int64(1), LogEventCount: 2, LogEventTotal: 3, LogEventPrevious: 4,
+				LogEventBytes: int64(5), LogEventAttempt: 6, LogEventDelay: time.Second, LogEventSince: time.Unix(1, 0),
+				LogEventUntil: time.Unix(2, 0), LogEventURL: "https://api.example.com", LogEventPath: "/candles",
+				LogEventFile: "snapshot.json", LogEventStorage: "postgresql", LogEventName: "coinbase",
+				LogEventRunID: "run", LogEventRecord: int64(0), LogEventRateLimiterTime: time.Second,
+				LogEventNetworkTime: time.Minute, LogEventStorageTime: time.Hour, LogEventError: errTest,
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			if fields := tcase.event.Fields(); !reflect.DeepEqual(fields, tcase.fields) {
+				t.Fatalf("expected fields %v, got %v", tcase.fields, fields)
+			}
+
+			hook := new(eventHook)
+			logger := logrus.New()
+			logger.Out = new(bytes.Buffer)
+			logger.AddHook(hook)
+
+			tcase.event.Log(logger, logrus.InfoLevel)
+			tcase.event.Log(logger, logrus.DebugLevel)
+
+			if len(hook.events) != 1 || !reflect.DeepEqual(hook.events[0], tcase.event) {
+				t.Fatalf("expected the hook to receive %v, got %v", tcase.event, hook.events)
+			}
+		})
+	}
+}
+
+func TestLogEventJSON(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Formatter = new(logrus.JSONFormatter)
+
+	LogEvent{Duration: time.Second, Table: "candles", Msg: "upserted", UpsertedCount: 2}.Log(logger, logrus.InfoLevel)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to decode entry: %v", err)
+	}
+
+	if entry[LogEventDuration] != float64(time.Second) || entry[LogEventUpsertedCount] != float64(2) ||
+		entry[LogEventTable] != "candles" || entry["msg"] != "upserted" {
+		t.Fatalf("expected the data of the event as values, got %v", entry)
+	}
+
+	// Nil loggers are ignored.
+	LogEvent{Msg: "ignored"}.Log(nil, logrus.InfoLevel)
+}
@@ -14,6 +14,8 @@ import (
 )
 
 // LogFormatter encapsulates data that is used to format a log message.
+//
+// Deprecated: use LogEvent, which logs its data as the fields of a logrus entry.
 type LogFormatter struct {
 	WorkerID      int
 	WorkerName    string
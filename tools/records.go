@@ -276,6 +276,11 @@ const (
 // DecodeUpsertRecords will decode the records from the upsert request into a slice of structs.
 func DecodeUpsertRecords(req *proto.UpsertRequest) ([]*structpb.Struct, error) {
 	if UpsertDataType(req.DataType) == UpsertDataJSON {
+		// Records are encoded by the bulk encoder with the layout of their table, unless it can not encode them.
+		if records, ok := encodeBulkRecords(req.GetTable(), req.GetData()); ok {
+			return records, nil
+		}
+
 		var data interface{}
 		if err := json.Unmarshal(req.Data, &data); err != nil {
 			return nil, fmt.Errorf("%w: %v", ErrFailedToUnmarshalJSON, err)